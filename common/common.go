@@ -122,6 +122,10 @@ func walkDirWithSymbolicLinksImpl(root, current string, dirFunc fs.WalkDirFunc,
 				err = errors.Wrapf(err, "WalkDirWithSymbolicLinks failed to resolve symlink %q", entryPath)
 				return err
 			}
+			if !filepath.IsAbs(linkedPath) {
+				// Relative links are relative to the directory of the link.
+				linkedPath = filepath.Join(filepath.Dir(entryPath), linkedPath)
+			}
 			err = walkDirWithSymbolicLinksImpl(root, linkedPath, dirFunc, visited)
 			if err != nil {
 				err = errors.WithMessagef(err, "while traversing symlink %q -> %q", entryPath, linkedPath)
@@ -3,7 +3,9 @@ package common
 import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -20,3 +22,23 @@ func TestReplaceEnvVars(t *testing.T) {
 	want = "foo"
 	assert.Equal(t, want, ReplaceEnvVars(str))
 }
+
+func TestWalkDirWithSymbolicLinks(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "target"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "target", "a.go"), nil, 0600))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "root"), 0700))
+	// Relative link, and a link loop.
+	require.NoError(t, os.Symlink("../target", filepath.Join(dir, "root", "link")))
+	require.NoError(t, os.Symlink("..", filepath.Join(dir, "root", "loop")))
+
+	var files []string
+	err := WalkDirWithSymbolicLinks(filepath.Join(dir, "root"), func(entryPath string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && filepath.Ext(entryPath) == ".go" {
+			files = append(files, entryPath)
+		}
+		return err
+	})
+	require.NoError(t, err)
+	assert.Contains(t, files, filepath.Join(dir, "root", "..", "target", "a.go"))
+}
@@ -0,0 +1,97 @@
+package common
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUSet is a Set with a maximum capacity: when full, inserting a new key evicts the least recently
+// used one (inserted or tested with Has).
+//
+// It is safe for concurrent use.
+type LRUSet[T comparable] struct {
+	mu        sync.Mutex
+	capacity  int
+	order     *list.List // Most recently used in the front.
+	elements  map[T]*list.Element
+	evictions int
+}
+
+// NewLRUSet returns an empty LRUSet with the given capacity. If capacity <= 0, it is unbounded.
+func NewLRUSet[T comparable](capacity int) *LRUSet[T] {
+	return &LRUSet[T]{
+		capacity: capacity,
+		order:    list.New(),
+		elements: make(map[T]*list.Element),
+	}
+}
+
+// Has returns true if the key is in the set, and marks it as recently used.
+func (s *LRUSet[T]) Has(key T) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, found := s.elements[key]
+	if found {
+		s.order.MoveToFront(e)
+	}
+	return found
+}
+
+// Insert key into set, marking it as recently used. If the set is full, the least recently used key
+// is evicted and returned, with evicted set to true.
+func (s *LRUSet[T]) Insert(key T) (evictedKey T, evicted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, found := s.elements[key]; found {
+		s.order.MoveToFront(e)
+		return
+	}
+	s.elements[key] = s.order.PushFront(key)
+	if s.capacity > 0 && s.order.Len() > s.capacity {
+		evictedKey = s.order.Remove(s.order.Back()).(T)
+		delete(s.elements, evictedKey)
+		s.evictions++
+		evicted = true
+	}
+	return
+}
+
+// Delete key from set, if present.
+func (s *LRUSet[T]) Delete(key T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, found := s.elements[key]; found {
+		s.order.Remove(e)
+		delete(s.elements, key)
+	}
+}
+
+// Len returns the number of keys in the set.
+func (s *LRUSet[T]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// Capacity returns the maximum number of keys in the set, or 0 if unbounded.
+func (s *LRUSet[T]) Capacity() int {
+	return max(s.capacity, 0)
+}
+
+// Evictions returns the number of keys evicted so far, to respect the capacity.
+func (s *LRUSet[T]) Evictions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.evictions
+}
+
+// Keys returns the keys in the set, from the least to the most recently used.
+func (s *LRUSet[T]) Keys() []T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]T, 0, s.order.Len())
+	for e := s.order.Back(); e != nil; e = e.Prev() {
+		keys = append(keys, e.Value.(T))
+	}
+	return keys
+}
@@ -0,0 +1,39 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLRUSet(t *testing.T) {
+	s := NewLRUSet[string](3)
+	for _, key := range []string{"a", "b", "c"} {
+		_, evicted := s.Insert(key)
+		assert.False(t, evicted)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, s.Keys())
+
+	// Testing "a" makes it the most recently used, so "b" is evicted next.
+	assert.True(t, s.Has("a"))
+	evictedKey, evicted := s.Insert("d")
+	assert.True(t, evicted)
+	assert.Equal(t, "b", evictedKey)
+	assert.False(t, s.Has("b"))
+	assert.Equal(t, []string{"c", "a", "d"}, s.Keys())
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, 1, s.Evictions())
+
+	s.Delete("c")
+	_, evicted = s.Insert("e")
+	assert.False(t, evicted)
+	assert.Equal(t, []string{"a", "d", "e"}, s.Keys())
+
+	// Unbounded.
+	u := NewLRUSet[int](0)
+	for ii := 0; ii < 100; ii++ {
+		u.Insert(ii)
+	}
+	assert.Equal(t, 100, u.Len())
+	assert.Equal(t, 0, u.Capacity())
+	assert.Equal(t, 0, u.Evictions())
+}
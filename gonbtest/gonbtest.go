@@ -0,0 +1,201 @@
+// Package gonbtest holds tools to write functional tests for GoNB notebooks, executing them
+// with `nbexec` (see `cmd/nbexec`) and converting their output to text with `nbconvert`.
+//
+// It's used by GoNB's own integration tests (in `internal/nbtests`), and can be used to write
+// CI tests for one's own notebooks. A typical test looks like:
+//
+//	func TestMain(m *testing.M) {
+//		jupyterDir, err := gonbtest.InstallTmpGonbKernel(nil, nil)
+//		if err != nil { ... }
+//		runner = &gonbtest.Runner{JupyterDir: jupyterDir, RootDir: "."}
+//		code := m.Run()
+//		_ = os.RemoveAll(jupyterDir)
+//		os.Exit(code)
+//	}
+//
+//	func TestMyNotebook(t *testing.T) {
+//		f, err := runner.Execute("notebooks/my_notebook.ipynb")
+//		require.NoError(t, err)
+//		defer func() { _ = f.Close(); _ = os.Remove(f.Name()) }()
+//		require.NoError(t, gonbtest.Check(f,
+//			gonbtest.Sequence(
+//				gonbtest.Match(gonbtest.OutputLine(1), gonbtest.Separator, "Hello World!", gonbtest.Separator),
+//			), false))
+//	}
+//
+// It requires `jupyter` (with `nbconvert` and `pandoc`) to be installed and in the PATH, and a
+// Chromium browser for `nbexec`.
+package gonbtest
+
+import (
+	"fmt"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// GoNBRootDir returns the root directory of the GoNB source code (the module root), used to
+// compile it.
+func GoNBRootDir() string {
+	_, filePath, _, _ := runtime.Caller(0)
+	rootDir := path.Dir(path.Dir(filePath)) // ".."
+	return rootDir
+}
+
+// InstallTmpGonbKernel will create a temporary directory, set the environment
+// variable JUPYTER_DATA_DIR to that directory, and compile and install
+// GoNB to that directory, so it will be used by `nbconvert`.
+//
+// It also compiles `nbexec` to the same directory, which is used to control the
+// execution of the notebooks.
+//
+// GoNB is compiled from the source of the version of the module being used, see GoNBRootDir.
+//
+// Parameters:
+//   - `runArgs` are passed to `go run --cover <gonbRunArgs> .` command, executed from GoNB's
+//     root directory.
+//   - `extraInstallArgs` are passed to the `gonb --install` execution.
+//     Typical values here include `--logtostderr`, and `--vmodule=...` for verbose output.
+//
+// Notice that this precludes concurrent testing of various versions of GoNB in
+// the same process, since it relies on this one global environment
+// variable (JUPYTER_DATA_DIR) -- but one can still run different processes
+// concurrently.
+func InstallTmpGonbKernel(runArgs, extraInstallArgs []string) (tmpJupyterDir string, err error) {
+	// Create and configure temporary jupyter directory.
+	tmpJupyterDir, err = os.MkdirTemp("", "gonb_nbtests_jupyter")
+	if err != nil {
+		err = errors.Wrap(err, "failed to create temporary directory")
+		return
+	}
+	err = os.Setenv(kernel.JupyterDataDirEnv, tmpJupyterDir)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to set %q", kernel.JupyterDataDirEnv)
+		return
+	}
+
+	// Find root dir of GoNB being tested.
+	rootDir := GoNBRootDir()
+
+	// Run installation:
+	args := []string{"run", "--cover", "--covermode=set"}
+	args = append(args, runArgs...)
+	args = append(args, ".", "--install")
+	args = append(args, extraInstallArgs...)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = rootDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	klog.Infof("GoNB root: %q", rootDir)
+	klog.Infof("Executing: %q", cmd)
+	err = cmd.Run()
+	if err != nil {
+		err = errors.Wrapf(err, "failed to compile and install GoNB with %q", cmd)
+		return
+	}
+
+	// Build nbexec:
+	cmd = exec.Command(
+		"go", "build",
+		"-o", path.Join(tmpJupyterDir, "nbexec"),
+		"-cover", "-covermode=set",
+		"./cmd/nbexec")
+	cmd.Dir = rootDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		err = errors.Wrapf(err, "failed to compile and install `nbexec` with %q", cmd)
+		return
+	}
+	return
+}
+
+// Runner executes notebooks using the GoNB kernel and `nbexec` installed by InstallTmpGonbKernel.
+type Runner struct {
+	// JupyterDir is the directory returned by InstallTmpGonbKernel.
+	JupyterDir string
+
+	// RootDir is the Jupyter root directory: notebooks are given relative to it.
+	RootDir string
+
+	// LogExec enables logging of the execution of the notebook (the Jupyter server and the browser console).
+	LogExec bool
+}
+
+// Execute executes the notebook with `nbexec`, saving it with the outputs, and then converts it
+// to text using `jupyter nbconvert --to asciidoc`. It returns the opened converted text output,
+// a temporary file, which the caller should close and remove.
+//
+// The notebook path is relative to Runner.RootDir. If inputBoxValues are given, they are used
+// in order to fill the input boxes requested by the notebook (they can't contain commas).
+func (r *Runner) Execute(notebook string, inputBoxValues ...string) (*os.File, error) {
+	jupyterExecPath, err := exec.LookPath("jupyter")
+	if err != nil {
+		return nil, errors.Wrap(err, "command `jupyter` (with `nbconvert`) is not in PATH")
+	}
+
+	// Execute notebook.
+	args := []string{"-n=" + notebook, "-jupyter_dir=" + r.RootDir, "-logtostderr"}
+	if r.LogExec {
+		args = append(args, "-jupyter_log", "-console_log", "-vmodule=main=2,nbexec=2")
+	}
+	if len(inputBoxValues) > 0 {
+		for ii, v := range inputBoxValues {
+			if strings.Contains(v, ",") {
+				return nil, errors.Errorf("inputBoxValues[%d]=%q has a comma in it, this won't work", ii, v)
+			}
+		}
+		args = append(args, fmt.Sprintf("-input_boxes=%s", strings.Join(inputBoxValues, ",")))
+	}
+	nbexec := exec.Command(path.Join(r.JupyterDir, "nbexec"), args...)
+	nbexec.Stderr = os.Stderr
+	nbexec.Stdout = os.Stdout
+	if err := nbexec.Run(); err != nil {
+		return nil, errors.Wrapf(err, "failed to execute notebook %q with %q", path.Join(r.RootDir, notebook), nbexec)
+	}
+
+	// Convert notebook output to text ("asciidoc").
+	tmpOutput, err := os.CreateTemp("", "gonb_nbtests_output")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create temporary file for the notebook output")
+	}
+	nbconvertOutputName := tmpOutput.Name()
+	_ = tmpOutput.Close()
+	_ = os.Remove(nbconvertOutputName)
+	nbconvertOutputPath := nbconvertOutputName + ".asciidoc" // nbconvert adds this suffix.
+	nbconvert := exec.Command(
+		jupyterExecPath, "nbconvert", "--to", "asciidoc",
+		"--output", nbconvertOutputName,
+		path.Join(r.RootDir, notebook))
+	nbconvert.Stdout, nbconvert.Stderr = os.Stderr, os.Stdout
+	klog.Infof("Executing: %q", nbconvert)
+	if err := nbconvert.Run(); err != nil {
+		return nil, errors.Wrapf(err, "failed to convert notebook output with %q", nbconvert)
+	}
+
+	// Open converted output:
+	f, err := os.Open(nbconvertOutputPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open the output of %q", nbconvert)
+	}
+	return f, nil
+}
+
+// Clear the outputs of the notebook (path relative to Runner.RootDir), using `nbexec`.
+func (r *Runner) Clear(notebook string) error {
+	nbexec := exec.Command(
+		path.Join(r.JupyterDir, "nbexec"), "-n="+notebook,
+		"-jupyter_dir="+r.RootDir, "-clear")
+	nbexec.Stderr = os.Stderr
+	nbexec.Stdout = os.Stdout
+	if err := nbexec.Run(); err != nil {
+		return errors.Wrapf(err, "failed to clear notebook %q with %q", path.Join(r.RootDir, notebook), nbexec)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package gonbtest
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestMatchers(t *testing.T) {
+	output := strings.Join([]string{
+		InputLine(1),
+		"fmt.Println(\"Hello\")",
+		OutputLine(1),
+		Separator,
+		"Hello",
+		Separator,
+		"unrelated",
+		"x=17",
+	}, "\n")
+
+	// Consecutive matches, in sequence, with unrelated lines in between.
+	require.NoError(t, Check(strings.NewReader(output),
+		Sequence(
+			Match(OutputLine(1), Separator, "Hello", Separator),
+			Match("x=17"),
+		), false))
+
+	// Match lines not consecutive.
+	require.Error(t, Check(strings.NewReader(output),
+		Match(OutputLine(1), "Hello"), false))
+
+	// Sequence out of order.
+	require.Error(t, Check(strings.NewReader(output),
+		Sequence(Match("x=17"), Match("Hello")), false))
+
+	// Capture the line following a match.
+	var captured string
+	require.NoError(t, Check(strings.NewReader(output),
+		Sequence(Match("unrelated"), Capture(&captured)), false))
+	require.Equal(t, "x=17", captured)
+}
@@ -0,0 +1,99 @@
+package gonbui
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+)
+
+// assetsLocation returns the directory where assets are published, creating it if needed, and the URL
+// from where it is served.
+func assetsLocation() (dir, dirUrl string, err error) {
+	dir, dirUrl = os.Getenv(protocol.GONB_ASSETS_DIR_ENV), os.Getenv(protocol.GONB_ASSETS_URL_ENV)
+	if dir == "" || dirUrl == "" {
+		return "", "", errors.Errorf("assets directory not available: $%s or $%s not set, the program must be "+
+			"executed by GoNB, and the Jupyter root directory must be known (see `%%doctor`)",
+			protocol.GONB_ASSETS_DIR_ENV, protocol.GONB_ASSETS_URL_ENV)
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", "", errors.Wrapf(err, "failed to create assets directory %q", dir)
+	}
+	return
+}
+
+// assetUrl returns the URL of the asset with the given name.
+func assetUrl(dirUrl, name string) string {
+	return strings.TrimSuffix(dirUrl, "/") + "/" + url.PathEscape(name)
+}
+
+// PublishAsset copies the file in filePath to the directory of assets served to the front-end, and returns
+// the URL from where it can be fetched. Use it to expose files generated by the program (CSVs, models,
+// binaries, etc.) to the user, e.g. with DownloadLinkHTML or ServeFile.
+//
+// The asset keeps the base name of the file: publishing another file with the same name overwrites it.
+// The assets directory is shared with the `%wasm` files, see `%help` for how to configure its location.
+func PublishAsset(filePath string) (string, error) {
+	dir, dirUrl, err := assetsLocation()
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(filePath)
+	src, err := os.Open(filePath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open %q to publish", filePath)
+	}
+	defer func() { _ = src.Close() }()
+	dstPath := filepath.Join(dir, name)
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create asset %q", dstPath)
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return "", errors.Wrapf(err, "failed to copy %q to asset %q", filePath, dstPath)
+	}
+	if err = dst.Close(); err != nil {
+		return "", errors.Wrapf(err, "failed to write asset %q", dstPath)
+	}
+	return assetUrl(dirUrl, name), nil
+}
+
+// PublishAssetData writes data as an asset with the given name, in the directory of assets served to the
+// front-end, and returns the URL from where it can be fetched. See PublishAsset.
+func PublishAssetData(name string, data []byte) (string, error) {
+	dir, dirUrl, err := assetsLocation()
+	if err != nil {
+		return "", err
+	}
+	name = filepath.Base(name)
+	dstPath := filepath.Join(dir, name)
+	if err = os.WriteFile(dstPath, data, 0644); err != nil {
+		return "", errors.Wrapf(err, "failed to write asset %q", dstPath)
+	}
+	return assetUrl(dirUrl, name), nil
+}
+
+// DownloadLinkHTML returns the HTML for a link that downloads the asset in assetUrl (see PublishAsset)
+// as a file with the given name.
+func DownloadLinkHTML(assetUrl, name string) string {
+	return fmt.Sprintf(`<a href="%s" download="%s" target="_blank">%s</a>`,
+		html.EscapeString(assetUrl), html.EscapeString(name), html.EscapeString(name))
+}
+
+// ServeFile publishes the file in filePath as an asset (see PublishAsset), and displays a link to download it
+// in the output of the cell. It returns the URL of the asset.
+func ServeFile(filePath string) (string, error) {
+	assetUrl, err := PublishAsset(filePath)
+	if err != nil {
+		return "", err
+	}
+	DisplayHTML(DownloadLinkHTML(assetUrl, filepath.Base(filePath)))
+	return assetUrl, nil
+}
@@ -0,0 +1,39 @@
+package comms
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+)
+
+// OnUpdate calls handler with each update to the address from the front-end (e.g.: a button click),
+// in the program's process.
+//
+// Unlike Subscribe, calls to handler are serialized: it is never called concurrently for the same subscription,
+// so it can change the state of the program without extra synchronization with itself.
+// A panic in handler is recovered and logged, so a failing callback doesn't bring down the program.
+//
+// Notice callbacks are only executed while the program is running: typically, the program waits for the
+// interruption of the cell (e.g.: `<-gonbui.Ctx().Done()`) after setting them up.
+//
+// It returns a SubscriptionId that can be used with Unsubscribe.
+func OnUpdate[T protocol.CommValueTypes](address string, handler func(value T)) SubscriptionId {
+	var mu sync.Mutex
+	return Subscribe[T](address, func(address string, value T) {
+		mu.Lock()
+		defer mu.Unlock()
+		callSafely(address, func() { handler(value) })
+	})
+}
+
+// callSafely calls fn, recovering and logging any panic.
+func callSafely(address string, fn func()) {
+	defer func() {
+		if exception := recover(); exception != nil {
+			log.Printf("gonbui/comms: callback for address %q panicked: %v\n%s", address, exception, debug.Stack())
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,47 @@
+package comms
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+)
+
+var (
+	execScopeOnce sync.Once
+	execScope     string
+)
+
+// ExecutionScope returns the prefix of the addresses scoped to the current cell execution (see ScopedAddress),
+// or an empty string if the program is not being executed by GoNB.
+func ExecutionScope() string {
+	execScopeOnce.Do(func() {
+		count, err := strconv.Atoi(os.Getenv(protocol.GONB_EXECUTION_COUNT_ENV))
+		if err == nil && count >= 0 {
+			execScope = protocol.ExecAddressScope(count)
+		}
+	})
+	return execScope
+}
+
+// ScopedAddress returns the address scoped to the current cell execution: it is prefixed with
+// `/exec/<execution_count>/`.
+//
+// When the program finishes, GoNB drops the values pending delivery to scoped addresses, and the front-end
+// removes the subscriptions to them. So re-running the same cell doesn't cross-talk with the widgets
+// left by its previous executions. The widgets in `gonbui/widgets` use scoped addresses.
+//
+// Addresses meant to persist across executions should be prefixed with protocol.PersistentAddressPrefix
+// (`/persistent/`): they are returned unchanged, as are the internal addresses (starting with `#`),
+// the ones already scoped, and all addresses if the program is not executed by GoNB.
+func ScopedAddress(address string) string {
+	scope := ExecutionScope()
+	if scope == "" || strings.HasPrefix(address, "#") ||
+		strings.HasPrefix(address, protocol.PersistentAddressPrefix) ||
+		strings.HasPrefix(address, protocol.ExecAddressPrefix) {
+		return address
+	}
+	return scope + strings.TrimPrefix(address, "/")
+}
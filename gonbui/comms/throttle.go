@@ -0,0 +1,43 @@
+package comms
+
+import (
+	"github.com/janpfeifer/gonb/gonbui"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"time"
+)
+
+// Throttle the updates from the front-end to the given address: GoNB (the kernel) delivers
+// at most one value per period to the program. The first value is delivered immediately, and values
+// arriving during the period are coalesced: only the latest one is delivered at the end of the period.
+//
+// This is useful for widgets that generate many events (e.g.: dragging a slider), when each update
+// is expensive to handle in the program.
+//
+// A period of 0 disables throttling for the address. Throttling is reset at the start of each
+// program execution (cell).
+func Throttle(address string, period time.Duration) {
+	sendThrottle(address, period, false)
+}
+
+// Debounce the updates from the front-end to the given address: GoNB (the kernel) only delivers
+// a value to the program after no new value arrived for the given period. Only the latest value is delivered.
+//
+// This is useful when only the final value of a sequence of events matters (e.g.: text being typed).
+//
+// A period of 0 disables debouncing for the address. Debouncing is reset at the start of each
+// program execution (cell).
+func Debounce(address string, period time.Duration) {
+	sendThrottle(address, period, true)
+}
+
+func sendThrottle(address string, period time.Duration, debounce bool) {
+	data := &protocol.DisplayData{
+		Data: map[protocol.MIMEType]any{
+			protocol.MIMECommThrottle: &protocol.CommThrottle{
+				Address:  address,
+				Period:   period,
+				Debounce: debounce,
+			}},
+	}
+	gonbui.SendData(data)
+}
@@ -0,0 +1,44 @@
+package gonbui
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var (
+	ctxOnce sync.Once
+	ctx     context.Context
+)
+
+// Ctx returns a context canceled when the execution of the cell is interrupted (e.g. the "stop" button in
+// Jupyter, which sends a SIGINT to the program), or when the program receives a SIGTERM. It allows the cell to
+// shut down gracefully, instead of being killed in the middle of a write:
+//
+//	%%
+//	for _, item := range items {
+//		if ctx.Err() != nil {
+//			break  // Interrupted: stop before processing the next item.
+//		}
+//		process(item)
+//	}
+//
+// In `%%` cells that use it, GoNB declares the variable `ctx` with an equivalent context (built with the standard
+// library only), unless `ctx` is a memorized declaration.
+//
+// Once Ctx is called, the first interrupt no longer kills the program: it cancels the context instead, and GoNB
+// kills the program if it hasn't exited a few seconds later. A second interrupt kills the program immediately.
+func Ctx() context.Context {
+	ctxOnce.Do(func() {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-ctx.Done()
+			// Restore the default behavior: the next signal kills the program.
+			stop()
+		}()
+	})
+	return ctx
+}
@@ -0,0 +1,84 @@
+package gonbui
+
+import "github.com/janpfeifer/gonb/gonbui/protocol"
+
+// Display is a handle to an output block in the notebook, that can be updated (replaced) with new
+// content any number of times. It is created with NewDisplay.
+//
+// Displays are transient: GoNB clears them when the program exits, unless Keep is called.
+//
+// Example:
+//
+//	progress := gonbui.NewDisplay()
+//	for ii := 0; ii < 10; ii++ {
+//		progress.HTML(fmt.Sprintf("Count: <b>%d</b>\n", ii))
+//	}
+//	// progress is cleared when the program exits.
+//	gonbui.DisplayHtml("Counting done.")  // Show on final block.
+type Display struct {
+	id string
+}
+
+// NewDisplay creates a new output block in the notebook, and returns a handle to it.
+// Its contents are set with Display.HTML, Display.Markdown or Display.Data. The block only appears
+// when it is first set.
+//
+// The display is registered with GoNB, which clears it when the program exits, unless Display.Keep
+// is called.
+func NewDisplay() *Display {
+	d := &Display{id: "gonb_display_" + UniqueId()}
+	if IsNotebook {
+		SendData(&protocol.DisplayData{
+			Data: map[protocol.MIMEType]any{protocol.MIMEDisplayHandle: &protocol.DisplayHandle{DisplayID: d.id}},
+		})
+	}
+	return d
+}
+
+// Id returns the Jupyter display id of the output block. It can be used with UpdateHtml.
+//
+// Notice this is not a DOM element id -- see UpdateHTML for details.
+func (d *Display) Id() string {
+	return d.id
+}
+
+// Data sets the contents of the display to the given data, keyed by the MIME type.
+// See also Display.HTML and Display.Markdown.
+func (d *Display) Data(data map[protocol.MIMEType]any) {
+	if !IsNotebook {
+		return
+	}
+	SendData(&protocol.DisplayData{
+		Data:      data,
+		DisplayID: d.id,
+	})
+}
+
+// HTML sets the contents of the display to the given HTML.
+func (d *Display) HTML(html string) {
+	d.Data(map[protocol.MIMEType]any{protocol.MIMETextHTML: html})
+}
+
+// Markdown sets the contents of the display to the given Markdown.
+// See DisplayMarkdown for details on the Markdown supported.
+func (d *Display) Markdown(markdown string) {
+	d.Data(map[protocol.MIMEType]any{protocol.MIMETextMarkdown: markdown})
+}
+
+// Clear the contents of the display. It can still be set again afterward.
+func (d *Display) Clear() {
+	d.HTML("")
+}
+
+// Keep the display after the program exits: by default displays created with NewDisplay are
+// cleared when the program exits.
+//
+// It returns itself, so calls can be cascaded.
+func (d *Display) Keep() *Display {
+	if IsNotebook {
+		SendData(&protocol.DisplayData{
+			Data: map[protocol.MIMEType]any{protocol.MIMEDisplayHandle: &protocol.DisplayHandle{DisplayID: d.id, Keep: true}},
+		})
+	}
+	return d
+}
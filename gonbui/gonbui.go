@@ -139,6 +139,9 @@ func openLocked() error {
 	}
 	if gonbWriterPipe == nil {
 		gonbWriterPath := os.Getenv(protocol.GONB_PIPE_ENV)
+		if gonbPipesError = checkPipe(gonbWriterPath); gonbPipesError != nil {
+			return gonbPipesError
+		}
 		Logf("openLocked(): opening writer in %q...", gonbWriterPath)
 		gonbWriterPipe, gonbPipesError = os.OpenFile(gonbWriterPath, os.O_WRONLY, 0600)
 		Logf("openLocked(): opened writer in %q...", gonbWriterPath)
@@ -148,9 +151,23 @@ func openLocked() error {
 			return gonbPipesError
 		}
 		gonbEncoder = gob.NewEncoder(gonbWriterPipe)
+
+		// First message authenticates the program to GoNB.
+		auth := &protocol.DisplayData{Data: map[protocol.MIMEType]any{
+			protocol.MIMEPipeAuth: &protocol.PipeAuth{Secret: os.Getenv(protocol.GONB_PIPE_SECRET_ENV)},
+		}}
+		if gonbPipesError = gonbEncoder.Encode(auth); gonbPipesError != nil {
+			gonbPipesError = errors.Wrapf(gonbPipesError, "failed authenticating to GoNB in pipe %q", gonbWriterPath)
+			closePipesLocked()
+			return gonbPipesError
+		}
 	}
 	if gonbReaderPipe == nil {
 		gonbReaderPath := os.Getenv(protocol.GONB_PIPE_BACK_ENV)
+		if gonbPipesError = checkPipe(gonbReaderPath); gonbPipesError != nil {
+			closePipesLocked()
+			return gonbPipesError
+		}
 		Logf("openLocked(): opening reader in %q...", gonbReaderPath)
 		readerPipe, err := os.OpenFile(gonbReaderPath, os.O_RDONLY, 0600)
 		Logf("openLocked(): opened reader in %q...", gonbReaderPath)
@@ -173,6 +190,21 @@ func openLocked() error {
 	return nil
 }
 
+// checkPipe verifies that pipePath is a named pipe not accessible by other users, before opening it.
+func checkPipe(pipePath string) error {
+	info, err := os.Lstat(pipePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to check pipe %q", pipePath)
+	}
+	if info.Mode().Type() != os.ModeNamedPipe {
+		return errors.Errorf("%q is not a named pipe (mode %s)", pipePath, info.Mode())
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return errors.Errorf("pipe %q is accessible by other users (permissions %s)", pipePath, perm)
+	}
+	return nil
+}
+
 // closePipesLocked closes the remaining opened pipes dropping any errors while closing.
 // It assumes mu is locked.
 //
@@ -252,6 +284,21 @@ func pollReaderPipe() {
 			}
 			mu.Unlock()
 
+		} else if valueMsg.Address == protocol.GonbuiSessionInfoAddress {
+			mu.Lock()
+			deliverSessionInfoLocked(valueMsg)
+			mu.Unlock()
+
+		} else if valueMsg.Address == protocol.GonbuiInputAddress {
+			mu.Lock()
+			deliverInputReplyLocked(valueMsg)
+			mu.Unlock()
+
+		} else if valueMsg.Address == protocol.GonbuiStoreAddress {
+			mu.Lock()
+			deliverStoreReplyLocked(valueMsg)
+			mu.Unlock()
+
 		} else if OnCommValueUpdate != nil {
 			// Generic Comms update.
 			Logf("dispatching OnCommValueUpdate(%q)", valueMsg.Address)
@@ -377,14 +424,10 @@ func DisplayMarkdown(markdown string) {
 // Notice that the value of `counterDisplayId` is not a DOM element id -- unfortunately.
 // If you want a `<div>` that you can manipulate with the [dom] package, create an empty `<div id=%q></div>`
 // with another unique id (see [gonbui.UniqueID]) and use that instead.
+//
+// See also NewDisplay, for a handle to a display that is automatically cleared at the end of the program.
 func UpdateHTML(id, html string) {
-	if !IsNotebook {
-		return
-	}
-	SendData(&protocol.DisplayData{
-		Data:      map[protocol.MIMEType]any{protocol.MIMETextHTML: html},
-		DisplayID: id,
-	})
+	(&Display{id: id}).HTML(html)
 }
 
 // UpdateHtml is an alias for UpdateHTML.
@@ -402,12 +445,67 @@ func UpdateHtml(id, html string) {
 //
 // See example in UpdateHtml, just instead this used Markdown content.
 func UpdateMarkdown(id, markdown string) {
+	(&Display{id: id}).Markdown(markdown)
+}
+
+// BeginBatch starts a batch of display updates: until the matching EndBatch, GoNB holds the updates
+// made with UpdateHTML and UpdateMarkdown (or any DisplayData with a DisplayID), keeping only the latest
+// one for each id, and publishes them all at once when the batch ends.
+//
+// This reduces flicker and the number of messages sent to the front-end, when updating the same output
+// blocks in tight loops. Other outputs (e.g.: DisplayHtml) are not held.
+//
+// Batches can be nested, in which case updates are published when the outermost batch ends. Any
+// pending updates are also published when the program exits.
+func BeginBatch() {
+	sendDisplayBatch(false)
+}
+
+// EndBatch ends a batch of display updates started with BeginBatch, see details there.
+func EndBatch() {
+	sendDisplayBatch(true)
+}
+
+// WithBatch calls fn within a batch of display updates: it is the same as calling BeginBatch before
+// fn, and EndBatch after it (even if fn panics).
+//
+// Example:
+//
+//	statusId, lastId := "status_"+gonbui.UniqueId(), "last_"+gonbui.UniqueId()
+//	for ii, item := range items {
+//		process(item)
+//		gonbui.WithBatch(func() {
+//			gonbui.UpdateHtml(statusId, fmt.Sprintf("Processed <b>%d</b> items", ii+1))
+//			gonbui.UpdateMarkdown(lastId, fmt.Sprintf("Last: `%s`", item))
+//		})
+//	}
+func WithBatch(fn func()) {
+	BeginBatch()
+	defer EndBatch()
+	fn()
+}
+
+func sendDisplayBatch(end bool) {
+	if !IsNotebook {
+		return
+	}
+	SendData(&protocol.DisplayData{
+		Data: map[protocol.MIMEType]any{protocol.MIMEDisplayBatch: &protocol.DisplayBatch{End: end}},
+	})
+}
+
+// ClearOutput clears the output of the cell being executed, so it can be redrawn.
+//
+// If wait is set, the output is only cleared when new output is available, which avoids flickering.
+//
+// Notice that output to stdout/stderr is captured separately by GoNB, so output printed right before
+// calling ClearOutput may be displayed after it.
+func ClearOutput(wait bool) {
 	if !IsNotebook {
 		return
 	}
 	SendData(&protocol.DisplayData{
-		Data:      map[protocol.MIMEType]any{protocol.MIMETextMarkdown: markdown},
-		DisplayID: id,
+		Data: map[protocol.MIMEType]any{protocol.MIMEClearOutput: &protocol.ClearOutput{Wait: wait}},
 	})
 }
 
@@ -0,0 +1,59 @@
+package gonbui
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+)
+
+// InheritedFile returns the file descriptor with the given name inherited from GoNB, for instance a listening
+// socket created with `%listen`. See also Listener.
+//
+// It returns an error if there is no inherited file descriptor with the given name.
+func InheritedFile(name string) (*os.File, error) {
+	fds := os.Getenv(protocol.GONB_FDS_ENV)
+	for _, entry := range strings.Split(fds, ",") {
+		entryName, fdStr, found := strings.Cut(entry, "=")
+		if !found || entryName != name {
+			continue
+		}
+		fd, err := strconv.Atoi(fdStr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid file descriptor for %q in $%s=%q", name, protocol.GONB_FDS_ENV, fds)
+		}
+		return os.NewFile(uintptr(fd), name), nil
+	}
+	return nil, errors.Errorf("no file descriptor %q inherited from GoNB (see `%%listen`)", name)
+}
+
+// Listener returns the listening socket with the given name created by GoNB with `%listen`.
+//
+// Since the socket is owned by GoNB, it remains bound across executions of the cells, so servers developed in a
+// notebook can be restarted on the same port immediately. Closing the returned listener doesn't close the
+// socket in GoNB.
+//
+// Example:
+//
+//	%listen web :8080
+//
+//	func main() {
+//		listener, err := gonbui.Listener("web")
+//		if err != nil { panic(err) }
+//		http.Serve(listener, handler)
+//	}
+func Listener(name string) (net.Listener, error) {
+	f, err := InheritedFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() // net.FileListener duplicates the file descriptor.
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create listener from inherited file descriptor %q", name)
+	}
+	return listener, nil
+}
@@ -0,0 +1,106 @@
+package gonbui
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+)
+
+var (
+	// Control InputRequest requests/replies.
+	nextInputRequestId int
+	inputRequestsMap   = make(map[int]chan string)
+
+	// ErrInputInterrupted is returned by ReadInput (and ReadLine, ReadPassword) if the execution is interrupted
+	// while waiting for the user's input.
+	ErrInputInterrupted = errors.New("interrupted while waiting for input")
+)
+
+// ReadLine opens a text field in the cell output area, and waits for the user to enter a value, which is
+// returned.
+//
+// Unlike RequestInput, the value is not written to the stdin of the program. See ReadInput for timeouts
+// and interruptions.
+func ReadLine(prompt string) (string, error) {
+	return ReadInput(context.Background(), prompt, false)
+}
+
+// ReadPassword is like ReadLine, but the value entered is not displayed.
+func ReadPassword(prompt string) (string, error) {
+	return ReadInput(context.Background(), prompt, true)
+}
+
+// ReadInput opens a text field in the cell output area, and waits for the user to enter a value, which is
+// returned.
+//
+// It returns an error if ctx is done before the user enters a value -- use context.WithTimeout for a timeout --
+// or ErrInputInterrupted if the execution is interrupted (or the program receives a SIGTERM) while waiting.
+// Notice the text field is not closed by the notebook in those cases, and whatever is entered later is discarded.
+//
+// Args:
+//   - prompt: string displayed in front of the field to be entered. Leave empty ("") if not needed.
+//   - password: if whatever the user is typing is not to be displayed.
+func ReadInput(ctx context.Context, prompt string, password bool) (string, error) {
+	if !IsNotebook {
+		return "", errors.New("input not available: program not executed by GoNB")
+	}
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupted)
+
+	mu.Lock()
+	id := nextInputRequestId
+	nextInputRequestId++
+	replyChan := make(chan string, 1)
+	inputRequestsMap[id] = replyChan
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		delete(inputRequestsMap, id)
+		mu.Unlock()
+	}()
+
+	SendData(&protocol.DisplayData{
+		Data: map[protocol.MIMEType]any{
+			protocol.MIMEJupyterInput: &protocol.InputRequest{
+				Prompt:   prompt,
+				Password: password,
+				Reply:    true,
+				Id:       id,
+			},
+		},
+	})
+	if err := Error(); err != nil {
+		return "", err
+	}
+	select {
+	case value := <-replyChan:
+		return value, nil
+	case <-ctx.Done():
+		return "", errors.Wrap(ctx.Err(), "while waiting for input")
+	case <-interrupted:
+		return "", ErrInputInterrupted
+	}
+}
+
+// deliverInputReplyLocked delivers the value entered for an InputRequest.
+// Replies to requests no longer waiting (timed out or interrupted) are discarded.
+// It assumes mu is locked.
+func deliverInputReplyLocked(valueMsg *protocol.CommValue) {
+	reply, ok := valueMsg.Value.(protocol.InputReply)
+	if !ok {
+		Logf("Received invalid InputReply %+v !?", valueMsg)
+		return
+	}
+	replyChan, found := inputRequestsMap[reply.Id]
+	if !found {
+		Logf("Discarded InputReply for request %d no longer waiting", reply.Id)
+		return
+	}
+	delete(inputRequestsMap, reply.Id)
+	replyChan <- reply.Value
+}
@@ -0,0 +1,140 @@
+package gonbui
+
+import (
+	"context"
+	"encoding/gob"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKernel plays the GoNB side of the pipes: it receives the requests of the program, and sends back replies.
+type fakeKernel struct {
+	requests *gob.Decoder
+	replies  *gob.Encoder
+}
+
+// setUpFakeKernel connects gonbui to a fakeKernel through in-process pipes, and starts polling the replies.
+func setUpFakeKernel(t *testing.T) *fakeKernel {
+	requestsReader, requestsWriter, err := os.Pipe()
+	require.NoError(t, err)
+	repliesReader, repliesWriter, err := os.Pipe()
+	require.NoError(t, err)
+
+	mu.Lock()
+	IsNotebook = true
+	gonbWriterPipe, gonbEncoder = requestsWriter, gob.NewEncoder(requestsWriter)
+	gonbReaderPipe, gonbDecoder = repliesReader, gob.NewDecoder(repliesReader)
+	mu.Unlock()
+	pollDone := make(chan struct{})
+	go func() {
+		pollReaderPipe()
+		close(pollDone)
+	}()
+	t.Cleanup(func() {
+		// Closing the kernel side ends pollReaderPipe, and only then the program side can be closed.
+		_ = repliesWriter.Close()
+		_ = requestsReader.Close()
+		<-pollDone
+		mu.Lock()
+		closePipesLocked()
+		IsNotebook = false
+		mu.Unlock()
+	})
+	return &fakeKernel{requests: gob.NewDecoder(requestsReader), replies: gob.NewEncoder(repliesWriter)}
+}
+
+// nextInputRequest waits for the next InputRequest sent by the program.
+func (k *fakeKernel) nextInputRequest(t *testing.T) protocol.InputRequest {
+	var data protocol.DisplayData
+	require.NoError(t, k.requests.Decode(&data))
+	req, ok := data.Data[protocol.MIMEJupyterInput].(protocol.InputRequest)
+	require.True(t, ok, "expected an InputRequest, got %+v", data)
+	return req
+}
+
+// reply sends the value entered for the request id.
+func (k *fakeKernel) reply(t *testing.T, id int, value string) {
+	require.NoError(t, k.replies.Encode(&protocol.CommValue{
+		Address: protocol.GonbuiInputAddress,
+		Value:   protocol.InputReply{Id: id, Value: value},
+	}))
+}
+
+// readInputResult holds the results of a ReadInput call.
+type readInputResult struct {
+	value string
+	err   error
+}
+
+// goReadInput calls ReadInput in a separate goroutine, and returns the channel with its results.
+func goReadInput(ctx context.Context, prompt string) chan readInputResult {
+	results := make(chan readInputResult, 1)
+	go func() {
+		value, err := ReadInput(ctx, prompt, false)
+		results <- readInputResult{value, err}
+	}()
+	return results
+}
+
+func TestReadInput(t *testing.T) {
+	k := setUpFakeKernel(t)
+
+	// Replies to unknown ids are discarded, and the reply is routed to the request with the matching id.
+	results := goReadInput(context.Background(), "name: ")
+	req := k.nextInputRequest(t)
+	assert.Equal(t, "name: ", req.Prompt)
+	assert.True(t, req.Reply)
+	k.reply(t, req.Id+100, "wrong")
+	k.reply(t, req.Id, "Joe")
+	result := <-results
+	require.NoError(t, result.err)
+	assert.Equal(t, "Joe", result.value)
+
+	// A request that timed out no longer waits: its late reply is discarded, and not taken by the next request.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	results = goReadInput(ctx, "timeout: ")
+	lateReq := k.nextInputRequest(t)
+	result = <-results
+	require.ErrorIs(t, result.err, context.DeadlineExceeded)
+	mu.Lock()
+	assert.NotContains(t, inputRequestsMap, lateReq.Id)
+	mu.Unlock()
+
+	results = goReadInput(context.Background(), "age: ")
+	req = k.nextInputRequest(t)
+	assert.NotEqual(t, lateReq.Id, req.Id)
+	k.reply(t, lateReq.Id, "late")
+	k.reply(t, req.Id, "7")
+	result = <-results
+	require.NoError(t, result.err)
+	assert.Equal(t, "7", result.value)
+}
+
+func TestDeliverInputReply(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	replyChan := make(chan string, 1)
+	inputRequestsMap[42] = replyChan
+
+	// Invalid values and unknown ids are discarded.
+	deliverInputReplyLocked(&protocol.CommValue{Address: protocol.GonbuiInputAddress, Value: "not a reply"})
+	deliverInputReplyLocked(&protocol.CommValue{Address: protocol.GonbuiInputAddress,
+		Value: protocol.InputReply{Id: 7, Value: "unknown"}})
+	assert.Empty(t, replyChan)
+	assert.Contains(t, inputRequestsMap, 42)
+
+	// The reply is delivered once, and the request is no longer waiting.
+	deliverInputReplyLocked(&protocol.CommValue{Address: protocol.GonbuiInputAddress,
+		Value: protocol.InputReply{Id: 42, Value: "value"}})
+	assert.Equal(t, "value", <-replyChan)
+	assert.NotContains(t, inputRequestsMap, 42)
+	deliverInputReplyLocked(&protocol.CommValue{Address: protocol.GonbuiInputAddress,
+		Value: protocol.InputReply{Id: 42, Value: "again"}})
+	assert.Empty(t, replyChan)
+}
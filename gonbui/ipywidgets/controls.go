@@ -0,0 +1,49 @@
+package ipywidgets
+
+// This file holds the constructors of the control widgets. Attributes not set take the defaults of the
+// front-end, see the documentation of ipywidgets for the attributes of each widget.
+
+// IntSlider creates a slider of integers with the given value, in the range [min, max].
+// Its value is the attribute "value", see Widget.GetInt.
+func IntSlider(value, min, max int) *Widget {
+	return New("IntSliderModel", "IntSliderView", "SliderStyleModel", map[string]any{
+		"value": value,
+		"min":   min,
+		"max":   max,
+		"step":  1,
+	})
+}
+
+// FloatSlider creates a slider of floats with the given value, in the range [min, max], in increments of step.
+// Its value is the attribute "value", see Widget.GetFloat.
+func FloatSlider(value, min, max, step float64) *Widget {
+	return New("FloatSliderModel", "FloatSliderView", "SliderStyleModel", map[string]any{
+		"value": value,
+		"min":   min,
+		"max":   max,
+		"step":  step,
+	})
+}
+
+// Text creates a single line text input with the given value.
+// Its value is the attribute "value", see Widget.GetString.
+func Text(value string) *Widget {
+	return New("TextModel", "TextView", "TextStyleModel", map[string]any{
+		"value": value,
+	})
+}
+
+// Checkbox creates a checkbox with the given value.
+// Its value is the attribute "value", see Widget.GetBool.
+func Checkbox(value bool) *Widget {
+	return New("CheckboxModel", "CheckboxView", "CheckboxStyleModel", map[string]any{
+		"value": value,
+	})
+}
+
+// Button creates a button with the given description. Use Widget.OnClick to handle clicks.
+func Button(description string) *Widget {
+	return New("ButtonModel", "ButtonView", "ButtonStyleModel", map[string]any{
+		"description": description,
+	})
+}
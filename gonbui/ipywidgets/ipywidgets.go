@@ -0,0 +1,325 @@
+// Package ipywidgets creates stock Jupyter widgets (the ones from the Python `ipywidgets` library, like
+// sliders, text boxes and buttons) from Go programs running in a GoNB notebook.
+//
+// Contrary to the `gonbui/widgets` package, these widgets are rendered by the widget manager of the
+// front-end (JupyterLab, Jupyter Notebook, VSCode, etc.), using the Jupyter widget messaging protocol, and
+// don't require GoNB's WebSocket (see `%widgets`). The front-end must have `ipywidgets` installed.
+//
+// Example:
+//
+//	slider := ipywidgets.IntSlider(50, 0, 100).Set("description", "Size:").Display()
+//	slider.OnChange(func(key string, value any) {
+//		fmt.Printf("%s=%v\n", key, value)
+//	})
+//	button := ipywidgets.Button("Done").Display()
+//	clicked := make(chan bool)
+//	button.OnClick(func() { clicked <- true })
+//	<-clicked
+//	fmt.Printf("Size=%d\n", slider.GetInt("value"))
+package ipywidgets
+
+import (
+	"maps"
+	"math"
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/janpfeifer/gonb/gonbui"
+	"github.com/janpfeifer/gonb/gonbui/comms"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+)
+
+const (
+	// BaseModule is the module of the base Jupyter widget models (e.g.: LayoutModel).
+	BaseModule = "@jupyter-widgets/base"
+
+	// ControlsModule is the module of the Jupyter control widgets (e.g.: IntSliderModel).
+	ControlsModule = "@jupyter-widgets/controls"
+
+	// ModuleVersion is the version of the Jupyter widgets modules used.
+	ModuleVersion = "2.0.0"
+)
+
+// Widget is a model of a Jupyter widget, kept in sync with the front-end.
+//
+// Create it with one of the constructors (IntSlider, Text, Button, etc.) or with New.
+// Its attributes can be set (with Set) before it is opened in the front-end (with Open or Display).
+type Widget struct {
+	modelId string
+
+	mu       sync.Mutex
+	state    map[string]any
+	opened   bool
+	onChange []func(key string, value any)
+	onCustom []func(content map[string]any)
+
+	// children are widgets referenced by this one, opened before it.
+	children []*Widget
+
+	subscribed     bool
+	subscriptionId comms.SubscriptionId
+}
+
+// New creates a widget with the given model and view names in the ControlsModule, and initial state.
+// The widget has a layout (see Layout), and optionally a style model (styleModelName), if it is not empty.
+//
+// Usually one of the specialized constructors (e.g.: IntSlider, Text, Button) is used instead.
+func New(modelName, viewName, styleModelName string, state map[string]any) *Widget {
+	w := newModel(ControlsModule, modelName, viewName, state)
+	layout := newModel(BaseModule, "LayoutModel", "LayoutView", nil)
+	w.children = append(w.children, layout)
+	w.state["layout"] = Ref(layout)
+	if styleModelName != "" {
+		style := newModel(ControlsModule, styleModelName, "StyleView", nil)
+		style.state["_view_module"] = BaseModule
+		w.children = append(w.children, style)
+		w.state["style"] = Ref(style)
+	}
+	return w
+}
+
+// newModel creates a widget model with the given module, model and view names, and initial state.
+func newModel(module, modelName, viewName string, state map[string]any) *Widget {
+	w := &Widget{
+		modelId: uuid.Must(uuid.NewV4()).String(),
+		state: map[string]any{
+			"_model_module":         module,
+			"_model_module_version": ModuleVersion,
+			"_model_name":           modelName,
+			"_view_module":          module,
+			"_view_module_version":  ModuleVersion,
+			"_view_name":            viewName,
+		},
+	}
+	maps.Copy(w.state, state)
+	return w
+}
+
+// Ref returns the reference to the widget used in the state of other widgets, e.g.: as one of the children
+// of a box.
+func Ref(w *Widget) string {
+	return "IPY_MODEL_" + w.modelId
+}
+
+// ModelId returns the unique id of the widget model.
+func (w *Widget) ModelId() string {
+	return w.modelId
+}
+
+// Layout returns the layout model of the widget (with attributes like "width" or "border"), or nil if it
+// doesn't have one.
+func (w *Widget) Layout() *Widget {
+	return w.child("layout")
+}
+
+// Style returns the style model of the widget (with attributes like "description_width" or "handle_color"),
+// or nil if it doesn't have one.
+func (w *Widget) Style() *Widget {
+	return w.child("style")
+}
+
+// child returns the child widget referenced by the given attribute.
+func (w *Widget) child(key string) *Widget {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, child := range w.children {
+		if w.state[key] == Ref(child) {
+			return child
+		}
+	}
+	return nil
+}
+
+// Open the widget model (and the models it references) in the front-end, without displaying it.
+// It's a no-op if it is already opened.
+//
+// It returns itself, so calls can be cascaded.
+func (w *Widget) Open() *Widget {
+	w.open(false)
+	return w
+}
+
+// Display opens the widget model, if not opened yet, and displays the widget in the output of the cell.
+// The same widget can be displayed more than once, and all views will be kept in sync.
+//
+// It returns itself, so calls can be cascaded.
+func (w *Widget) Display() *Widget {
+	w.open(true)
+	return w
+}
+
+// open the widget and optionally display it.
+func (w *Widget) open(display bool) {
+	w.mu.Lock()
+	children := w.children
+	w.mu.Unlock()
+	for _, child := range children {
+		child.Open()
+	}
+
+	w.mu.Lock()
+	req := &protocol.JupyterWidgetRequest{
+		ModelId: w.modelId,
+		Display: display,
+	}
+	if !w.opened {
+		w.opened = true
+		req.Open = true
+		req.State = maps.Clone(w.state)
+	}
+	subscribe := !w.subscribed
+	w.subscribed = true
+	w.mu.Unlock()
+
+	if subscribe {
+		w.subscriptionId = comms.Subscribe(protocol.JupyterWidgetAddressPrefix+w.modelId, w.handleMessage)
+	}
+	sendRequest(req)
+}
+
+// sendRequest sends the request to GoNB.
+func sendRequest(req *protocol.JupyterWidgetRequest) {
+	if gonbui.Open() != nil {
+		return
+	}
+	gonbui.SendData(&protocol.DisplayData{
+		Data: map[protocol.MIMEType]any{protocol.MIMEJupyterWidget: req},
+	})
+}
+
+// Close the widget model in the front-end: its views are removed.
+func (w *Widget) Close() {
+	w.mu.Lock()
+	opened := w.opened
+	subscribed := w.subscribed
+	w.opened, w.subscribed = false, false
+	w.mu.Unlock()
+	if subscribed {
+		comms.Unsubscribe(w.subscriptionId)
+	}
+	if opened {
+		sendRequest(&protocol.JupyterWidgetRequest{ModelId: w.modelId, Close: true})
+	}
+}
+
+// Set the attribute key of the widget to value. If the widget is already opened, the change is sent to
+// the front-end.
+//
+// Values are converted to JSON: use ints, floats, strings, bools, slices and maps of those.
+//
+// It returns itself, so calls can be cascaded.
+func (w *Widget) Set(key string, value any) *Widget {
+	w.mu.Lock()
+	w.state[key] = value
+	opened := w.opened
+	w.mu.Unlock()
+	if opened {
+		sendRequest(&protocol.JupyterWidgetRequest{
+			ModelId: w.modelId,
+			State:   map[string]any{key: value},
+		})
+	}
+	return w
+}
+
+// Get returns the current value of the attribute key of the widget, or nil if it is not set.
+// Numbers changed in the front-end are float64, see GetInt.
+func (w *Widget) Get(key string) any {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.state[key]
+}
+
+// GetInt returns the current value of the attribute key of the widget as an int, or 0 if it is not a number.
+func (w *Widget) GetInt(key string) int {
+	switch value := w.Get(key).(type) {
+	case int:
+		return value
+	case float64:
+		return int(math.Round(value))
+	}
+	return 0
+}
+
+// GetFloat returns the current value of the attribute key of the widget as a float64, or 0 if it is not a number.
+func (w *Widget) GetFloat(key string) float64 {
+	switch value := w.Get(key).(type) {
+	case int:
+		return float64(value)
+	case float64:
+		return value
+	}
+	return 0
+}
+
+// GetString returns the current value of the attribute key of the widget as a string, or "" if it is not a string.
+func (w *Widget) GetString(key string) string {
+	value, _ := w.Get(key).(string)
+	return value
+}
+
+// GetBool returns the current value of the attribute key of the widget as a bool, or false if it is not a bool.
+func (w *Widget) GetBool(key string) bool {
+	value, _ := w.Get(key).(bool)
+	return value
+}
+
+// OnChange registers a callback called whenever an attribute of the widget is changed in the front-end,
+// e.g.: the "value" of a slider.
+// The callback is called in a separate goroutine.
+//
+// It returns itself, so calls can be cascaded.
+func (w *Widget) OnChange(callback func(key string, value any)) *Widget {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onChange = append(w.onChange, callback)
+	return w
+}
+
+// OnCustom registers a callback called whenever the front-end sends a custom message to the widget.
+// The callback is called in a separate goroutine.
+//
+// It returns itself, so calls can be cascaded.
+func (w *Widget) OnCustom(callback func(content map[string]any)) *Widget {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onCustom = append(w.onCustom, callback)
+	return w
+}
+
+// OnClick registers a callback called whenever the button is clicked. Only for Button widgets.
+// The callback is called in a separate goroutine.
+//
+// It returns itself, so calls can be cascaded.
+func (w *Widget) OnClick(callback func()) *Widget {
+	return w.OnCustom(func(content map[string]any) {
+		if content["event"] == "click" {
+			callback()
+		}
+	})
+}
+
+// handleMessage handles the messages sent by GoNB about changes in the front-end.
+func (w *Widget) handleMessage(_ string, msg map[string]any) {
+	switch msg["method"] {
+	case "update":
+		state, _ := msg["state"].(map[string]any)
+		w.mu.Lock()
+		maps.Copy(w.state, state)
+		callbacks := w.onChange
+		w.mu.Unlock()
+		for key, value := range state {
+			for _, callback := range callbacks {
+				callback(key, value)
+			}
+		}
+	case "custom":
+		content, _ := msg["content"].(map[string]any)
+		w.mu.Lock()
+		callbacks := w.onCustom
+		w.mu.Unlock()
+		for _, callback := range callbacks {
+			callback(content)
+		}
+	}
+}
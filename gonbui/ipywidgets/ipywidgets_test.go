@@ -0,0 +1,47 @@
+package ipywidgets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	slider := IntSlider(50, 0, 100).Set("description", "Size:")
+	assert.Equal(t, "IntSliderModel", slider.GetString("_model_name"))
+	assert.Equal(t, ControlsModule, slider.GetString("_model_module"))
+	assert.Equal(t, 50, slider.GetInt("value"))
+	assert.Equal(t, "Size:", slider.Get("description"))
+
+	layout := slider.Layout()
+	require.NotNil(t, layout)
+	assert.Equal(t, "IPY_MODEL_"+layout.ModelId(), slider.Get("layout"))
+	assert.Equal(t, BaseModule, layout.GetString("_model_module"))
+	style := slider.Style()
+	require.NotNil(t, style)
+	assert.Equal(t, "SliderStyleModel", style.GetString("_model_name"))
+	assert.Equal(t, BaseModule, style.GetString("_view_module"))
+	assert.NotEqual(t, layout.ModelId(), style.ModelId())
+}
+
+func TestHandleMessage(t *testing.T) {
+	button := Button("Ok")
+	var changes []string
+	var clicks int
+	button.OnChange(func(key string, value any) { changes = append(changes, key) })
+	button.OnClick(func() { clicks++ })
+
+	button.handleMessage("", map[string]any{"method": "update", "state": map[string]any{"disabled": true}})
+	assert.Equal(t, []string{"disabled"}, changes)
+	assert.True(t, button.GetBool("disabled"))
+
+	button.handleMessage("", map[string]any{"method": "custom", "content": map[string]any{"event": "click"}})
+	button.handleMessage("", map[string]any{"method": "custom", "content": map[string]any{"event": "other"}})
+	assert.Equal(t, 1, clicks)
+
+	slider := FloatSlider(0.5, 0, 1, 0.1)
+	slider.handleMessage("", map[string]any{"method": "update", "state": map[string]any{"value": 0.7}})
+	assert.Equal(t, 0.7, slider.GetFloat("value"))
+	assert.Equal(t, 1, slider.GetInt("value"))
+}
@@ -0,0 +1,110 @@
+package jupyterapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Model of a file or directory in the Jupyter contents API.
+// See https://jupyter-server.readthedocs.io/en/latest/developers/contents.html
+type Model struct {
+	Name string `json:"name"`
+
+	// Path relative to the Jupyter root directory.
+	Path string `json:"path"`
+
+	// Type is one of "file", "directory" or "notebook".
+	Type string `json:"type"`
+
+	// Format of the Content: "text", "base64" or "json". Empty if the content was not requested.
+	Format   string `json:"format,omitempty"`
+	Mimetype string `json:"mimetype,omitempty"`
+
+	// Content of the file (a string), or the list of Model in a directory. Nil if it was not requested.
+	Content json.RawMessage `json:"content,omitempty"`
+
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"last_modified"`
+	Size         int64     `json:"size,omitempty"`
+	Writable     bool      `json:"writable"`
+}
+
+// Stat returns the Model of the file or directory in path, without its content.
+func (c *Client) Stat(path string) (*Model, error) {
+	var m Model
+	if err := c.do(http.MethodGet, "contents/"+escapePath(path)+"?content=0", nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// List the contents of the directory in path. Use "" for the Jupyter root directory.
+func (c *Client) List(path string) ([]Model, error) {
+	var dir Model
+	if err := c.do(http.MethodGet, "contents/"+escapePath(path)+"?type=directory", nil, &dir); err != nil {
+		return nil, err
+	}
+	var entries []Model
+	if err := json.Unmarshal(dir.Content, &entries); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse contents of directory %q", path)
+	}
+	return entries, nil
+}
+
+// Read the contents of the file in path.
+func (c *Client) Read(path string) ([]byte, error) {
+	var m Model
+	if err := c.do(http.MethodGet, "contents/"+escapePath(path)+"?type=file&format=base64", nil, &m); err != nil {
+		return nil, err
+	}
+	var encoded string
+	if err := json.Unmarshal(m.Content, &encoded); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse contents of file %q", path)
+	}
+	if m.Format == "text" {
+		return []byte(encoded), nil
+	}
+	contents, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode contents of file %q", path)
+	}
+	return contents, nil
+}
+
+// Write contents to the file in path, creating or overwriting it. The directory must already exist,
+// see Mkdir.
+func (c *Client) Write(path string, contents []byte) error {
+	encoded, err := json.Marshal(base64.StdEncoding.EncodeToString(contents))
+	if err != nil {
+		return err
+	}
+	return c.save(path, &Model{Type: "file", Format: "base64", Content: encoded})
+}
+
+// Mkdir creates the directory in path. It doesn't fail if the directory already exists.
+func (c *Client) Mkdir(path string) error {
+	return c.save(path, &Model{Type: "directory"})
+}
+
+// Delete the file or (empty) directory in path.
+func (c *Client) Delete(path string) error {
+	return c.do(http.MethodDelete, "contents/"+escapePath(path), nil, nil)
+}
+
+// save the model in path.
+func (c *Client) save(path string, m *Model) error {
+	body, err := json.Marshal(struct {
+		Type    string          `json:"type"`
+		Format  string          `json:"format,omitempty"`
+		Content json.RawMessage `json:"content,omitempty"`
+	}{m.Type, m.Format, m.Content})
+	if err != nil {
+		return err
+	}
+	return c.do(http.MethodPut, "contents/"+escapePath(path), bytes.NewReader(body), nil)
+}
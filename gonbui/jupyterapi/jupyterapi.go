@@ -0,0 +1,284 @@
+// Package jupyterapi provides a client to the REST API of the Jupyter server running the notebook,
+// to be used from cells. It allows, for instance, to list, read and write files relative to the
+// Jupyter root directory, independent of the current working directory of the program.
+//
+// The server (its URL and the authentication token) is discovered using the runtime file the Jupyter
+// server writes (`jpserver-<pid>.json`), where `<pid>` is given by the `JPY_PARENT_PID` environment
+// variable, set by the Jupyter server for the kernel (and inherited by the cell programs).
+//
+// Example: save a file next to the notebook:
+//
+//	client, err := jupyterapi.Discover()
+//	if err != nil { ... }
+//	err = client.Write(jupyterapi.NextToNotebook("results.csv"), csvContent)
+package jupyterapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// JupyterPidEnv is the environment variable set by the Jupyter server with its pid.
+	JupyterPidEnv = "JPY_PARENT_PID"
+
+	// JupyterRuntimeDirEnv is the environment variable that overrides the Jupyter runtime directory.
+	JupyterRuntimeDirEnv = "JUPYTER_RUNTIME_DIR"
+
+	// JupyterSessionNameEnv is the environment variable set by the Jupyter server (since version 2.0) with
+	// the path to the notebook.
+	JupyterSessionNameEnv = "JPY_SESSION_NAME"
+)
+
+// DiscoveryTimeout is the time limit to query each Jupyter server in DiscoverForKernel.
+var DiscoveryTimeout = 5 * time.Second
+
+// Client to the Jupyter server REST API.
+type Client struct {
+	// URL of the Jupyter server, including the base url. E.g.: "http://localhost:8888/".
+	URL string
+
+	// Token used to authenticate to the Jupyter server. It can be empty, if the server requires none.
+	Token string
+
+	// RootDir is the root directory served by the Jupyter server, if known.
+	RootDir string
+
+	// RuntimeFile is the path to the runtime file the server was discovered from, if any.
+	RuntimeFile string
+
+	// HTTPClient used for the requests. It defaults to a client with a 30 seconds timeout.
+	HTTPClient *http.Client
+}
+
+// New creates a Client for the Jupyter server at serverURL, authenticating with token.
+func New(serverURL, token string) *Client {
+	if !strings.HasSuffix(serverURL, "/") {
+		serverURL += "/"
+	}
+	return &Client{
+		URL:        serverURL,
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// serverInfo is the contents of the runtime file written by the Jupyter server.
+type serverInfo struct {
+	URL     string `json:"url"`
+	Token   string `json:"token"`
+	RootDir string `json:"root_dir"`
+
+	// NotebookDir is used by older (`notebook` based) servers instead of RootDir.
+	NotebookDir string `json:"notebook_dir"`
+}
+
+// Discover the Jupyter server running the notebook, and returns a Client to it.
+//
+// It reads the runtime file of the server with the pid given by `$JPY_PARENT_PID`, in the Jupyter runtime
+// directory (see RuntimeDir).
+func Discover() (*Client, error) {
+	pid := os.Getenv(JupyterPidEnv)
+	if pid == "" {
+		return nil, errors.Errorf("cannot discover Jupyter server, because environment variable %q is not set!?",
+			JupyterPidEnv)
+	}
+	runtimeDir, err := RuntimeDir()
+	if err != nil {
+		return nil, err
+	}
+	for _, prefix := range []string{"jpserver", "nbserver"} {
+		var c *Client
+		c, err = readRuntimeFile(filepath.Join(runtimeDir, fmt.Sprintf("%s-%s.json", prefix, pid)))
+		if err == nil {
+			return c, nil
+		}
+	}
+	return nil, errors.WithMessagef(err, "cannot find the runtime file of the Jupyter server with pid %s in %q",
+		pid, runtimeDir)
+}
+
+// DiscoverForKernel finds the Jupyter server running the kernel with the given id, among all the servers
+// with a runtime file in the Jupyter runtime directory (see Servers), by querying their list of kernels.
+//
+// This works even if there are several Jupyter servers running. If kernelId is empty, or if no server reports
+// the kernel, it falls back to Discover.
+func DiscoverForKernel(kernelId string) (*Client, error) {
+	if kernelId == "" {
+		return Discover()
+	}
+	servers, err := Servers()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range servers {
+		probe := *c
+		probe.HTTPClient = &http.Client{Timeout: DiscoveryTimeout}
+		kernels, err := probe.Kernels()
+		if err != nil {
+			// Stale runtime file, or server not accessible.
+			continue
+		}
+		for _, k := range kernels {
+			if k.Id == kernelId {
+				return c, nil
+			}
+		}
+	}
+	return Discover()
+}
+
+// Servers returns a Client for each Jupyter server with a runtime file in the Jupyter runtime directory
+// (see RuntimeDir). Notice some may be stale: runtime files of servers that are no longer running.
+func Servers() ([]*Client, error) {
+	runtimeDir, err := RuntimeDir()
+	if err != nil {
+		return nil, err
+	}
+	var servers []*Client
+	for _, prefix := range []string{"jpserver", "nbserver"} {
+		paths, err := filepath.Glob(filepath.Join(runtimeDir, prefix+"-*.json"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list Jupyter runtime files in %q", runtimeDir)
+		}
+		sort.Strings(paths)
+		for _, runtimePath := range paths {
+			c, err := readRuntimeFile(runtimePath)
+			if err != nil {
+				// Other files match the pattern, e.g. "jpserver-<pid>-open.html".
+				continue
+			}
+			servers = append(servers, c)
+		}
+	}
+	return servers, nil
+}
+
+// readRuntimeFile reads the runtime file written by a Jupyter server, and returns a Client to it.
+func readRuntimeFile(runtimePath string) (*Client, error) {
+	contents, err := os.ReadFile(runtimePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read Jupyter server runtime file %q", runtimePath)
+	}
+	var info serverInfo
+	if err = json.Unmarshal(contents, &info); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse Jupyter server runtime file %q", runtimePath)
+	}
+	if info.URL == "" {
+		return nil, errors.Errorf("Jupyter server runtime file %q has no url", runtimePath)
+	}
+	c := New(info.URL, info.Token)
+	c.RootDir = info.RootDir
+	if c.RootDir == "" {
+		c.RootDir = info.NotebookDir
+	}
+	c.RuntimeFile = runtimePath
+	return c, nil
+}
+
+// BasePath returns the path part of the server URL (the Jupyter "base_url"), always ending with "/".
+// Files in the Jupyter root directory are served under `BasePath() + "files/"`.
+func (c *Client) BasePath() string {
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		return u.Path + "/"
+	}
+	return u.Path
+}
+
+// RuntimeDir returns the Jupyter runtime directory, where the Jupyter servers write their runtime files.
+// It follows the same rules as `jupyter --runtime-dir`.
+func RuntimeDir() (string, error) {
+	if dir := os.Getenv(JupyterRuntimeDirEnv); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("JUPYTER_DATA_DIR"); dir != "" {
+		return filepath.Join(dir, "runtime"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot find Jupyter runtime directory")
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "Jupyter", "runtime"), nil
+	case "windows":
+		return filepath.Join(os.Getenv("APPDATA"), "jupyter", "runtime"), nil
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "jupyter", "runtime"), nil
+	}
+	return filepath.Join(home, ".local", "share", "jupyter", "runtime"), nil
+}
+
+// NotebookPath returns the path of the notebook (relative to the Jupyter root directory), as reported by the
+// Jupyter server in `$JPY_SESSION_NAME`. It returns "" if it's not known.
+func NotebookPath() string {
+	return os.Getenv(JupyterSessionNameEnv)
+}
+
+// NextToNotebook returns the path (relative to the Jupyter root directory, as used by the contents API) of a
+// file with the given name in the same directory as the notebook.
+// If the notebook path is not known, it returns name (in the Jupyter root directory).
+func NextToNotebook(name string) string {
+	return path.Join(path.Dir(filepath.ToSlash(NotebookPath())), name)
+}
+
+// do executes a request to the Jupyter REST API, and decodes the JSON reply into result, if not nil.
+func (c *Client) do(method, apiPath string, body io.Reader, result any) error {
+	u := c.URL + "api/" + strings.TrimPrefix(apiPath, "/")
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create request %s %q", method, u)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "token "+c.Token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "request %s %q failed", method, u)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return errors.Errorf("request %s %q failed with status %q: %s", method, u, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if result == nil {
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errors.Wrapf(err, "failed to decode reply of %s %q", method, u)
+	}
+	return nil
+}
+
+// escapePath escapes each element of a contents API path.
+func escapePath(p string) string {
+	parts := strings.Split(strings.Trim(filepath.ToSlash(p), "/"), "/")
+	for ii, part := range parts {
+		parts[ii] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,145 @@
+package jupyterapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeContentsServer implements a minimal in-memory version of the Jupyter contents API.
+func fakeContentsServer(t *testing.T, token string) *httptest.Server {
+	var mu sync.Mutex
+	files := make(map[string]string) // path -> base64 content.
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "token "+token {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		p := strings.TrimPrefix(r.URL.Path, "/api/contents")
+		p = strings.TrimPrefix(p, "/")
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			var m Model
+			require.NoError(t, json.Unmarshal(body, &m))
+			var content string
+			_ = json.Unmarshal(m.Content, &content)
+			files[p] = content
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("{}"))
+		case http.MethodGet:
+			if p == "" {
+				var entries []Model
+				for name := range files {
+					entries = append(entries, Model{Name: name, Path: name, Type: "file"})
+				}
+				content, _ := json.Marshal(entries)
+				_ = json.NewEncoder(w).Encode(Model{Type: "directory", Format: "json", Content: content})
+				return
+			}
+			content, found := files[p]
+			if !found {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			encoded, _ := json.Marshal(content)
+			_ = json.NewEncoder(w).Encode(Model{Name: p, Path: p, Type: "file", Format: "base64", Content: encoded})
+		case http.MethodDelete:
+			delete(files, p)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+}
+
+func TestContents(t *testing.T) {
+	server := fakeContentsServer(t, "secret")
+	defer server.Close()
+
+	c := New(server.URL, "secret")
+	require.NoError(t, c.Write("results.bin", []byte{0, 1, 2, 255}))
+	contents, err := c.Read("results.bin")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 2, 255}, contents)
+
+	entries, err := c.List("")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "results.bin", entries[0].Name)
+
+	require.NoError(t, c.Delete("results.bin"))
+	_, err = c.Read("results.bin")
+	require.Error(t, err)
+
+	// Wrong token.
+	_, err = New(server.URL, "wrong").List("")
+	require.Error(t, err)
+}
+
+func TestDiscover(t *testing.T) {
+	runtimeDir := t.TempDir()
+	t.Setenv(JupyterRuntimeDirEnv, runtimeDir)
+	t.Setenv(JupyterPidEnv, "1234")
+	require.NoError(t, os.WriteFile(filepath.Join(runtimeDir, "jpserver-1234.json"),
+		[]byte(`{"url": "http://localhost:8888/lab", "token": "abc", "root_dir": "/home/user"}`), 0600))
+	c, err := Discover()
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8888/lab/", c.URL)
+	assert.Equal(t, "abc", c.Token)
+	assert.Equal(t, "/home/user", c.RootDir)
+
+	t.Setenv(JupyterPidEnv, "4321")
+	_, err = Discover()
+	require.Error(t, err)
+}
+
+func TestNextToNotebook(t *testing.T) {
+	t.Setenv(JupyterSessionNameEnv, "experiments/train.ipynb")
+	assert.Equal(t, "experiments/results.csv", NextToNotebook("results.csv"))
+	t.Setenv(JupyterSessionNameEnv, "")
+	assert.Equal(t, "results.csv", NextToNotebook("results.csv"))
+}
+
+func TestDiscoverForKernel(t *testing.T) {
+	newServer := func(kernelId string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/api/kernels", r.URL.Path)
+			_ = json.NewEncoder(w).Encode([]Kernel{{Id: kernelId, Name: "gonb"}})
+		}))
+	}
+	server0, server1 := newServer("kernel_0"), newServer("kernel_1")
+	defer server0.Close()
+	defer server1.Close()
+
+	runtimeDir := t.TempDir()
+	t.Setenv(JupyterRuntimeDirEnv, runtimeDir)
+	t.Setenv(JupyterPidEnv, "100")
+	for ii, server := range []*httptest.Server{server0, server1} {
+		info, _ := json.Marshal(serverInfo{URL: server.URL + "/", RootDir: fmt.Sprintf("/root_%d", ii)})
+		require.NoError(t, os.WriteFile(filepath.Join(runtimeDir, fmt.Sprintf("jpserver-%d.json", 100+ii)), info, 0600))
+	}
+	// Stale runtime file, and a file that is not a runtime file.
+	require.NoError(t, os.WriteFile(filepath.Join(runtimeDir, "jpserver-99.json"), []byte(`{"url": "http://127.0.0.1:1/"}`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(runtimeDir, "jpserver-100-open.html"), []byte(`<html></html>`), 0600))
+
+	c, err := DiscoverForKernel("kernel_1")
+	require.NoError(t, err)
+	assert.Equal(t, "/root_1", c.RootDir)
+
+	// Unknown kernel: falls back to the pid.
+	c, err = DiscoverForKernel("unknown")
+	require.NoError(t, err)
+	assert.Equal(t, "/root_0", c.RootDir)
+	assert.Equal(t, "/", c.BasePath())
+}
@@ -0,0 +1,24 @@
+package jupyterapi
+
+import (
+	"net/http"
+	"time"
+)
+
+// Kernel is the model of a running kernel in the Jupyter kernels API.
+type Kernel struct {
+	Id             string    `json:"id"`
+	Name           string    `json:"name"`
+	ExecutionState string    `json:"execution_state"`
+	LastActivity   time.Time `json:"last_activity"`
+	Connections    int       `json:"connections"`
+}
+
+// Kernels returns the list of kernels running in the Jupyter server.
+func (c *Client) Kernels() ([]Kernel, error) {
+	var kernels []Kernel
+	if err := c.do(http.MethodGet, "kernels", nil, &kernels); err != nil {
+		return nil, err
+	}
+	return kernels, nil
+}
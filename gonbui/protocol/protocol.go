@@ -2,7 +2,11 @@
 // kernel, using the standard Go `encoding/gob` package.
 package protocol
 
-import "encoding/gob"
+import (
+	"encoding/gob"
+	"strconv"
+	"time"
+)
 
 const (
 	// GONB_PIPE_ENV is the name of the environment variable holding
@@ -20,6 +24,11 @@ const (
 	// It is used to receive updates from widgets displayed in the front-end (Jupyter notebook).
 	GONB_PIPE_BACK_ENV = "GONB_PIPE_BACK"
 
+	// GONB_PIPE_SECRET_ENV is the name of the environment variable holding the secret the Go program
+	// uses to authenticate itself to the kernel, in the first message sent through the GONB_PIPE_ENV pipe
+	// (see PipeAuth). It's created anew for each execution.
+	GONB_PIPE_SECRET_ENV = "GONB_PIPE_SECRET"
+
 	// GONB_DIR_ENV is the name of the environment variable holding the
 	// current execution directory for the Go cells, and the scripts executed
 	// with `!` special command.
@@ -36,6 +45,10 @@ const (
 	// `!*` special commands.
 	GONB_TMP_DIR_ENV = "GONB_TMP_DIR"
 
+	// GONB_EXECUTION_COUNT_ENV is the name of the environment variable holding the execution count of the
+	// cell being executed. It is used to scope the comms addresses to the execution, see ExecAddressPrefix.
+	GONB_EXECUTION_COUNT_ENV = "GONB_EXECUTION_COUNT"
+
 	// GONB_JUPYTER_ROOT_ENV is the path to the Jupyter root directory, if GONB managed
 	// to read it (depends on the architecture).
 	//
@@ -69,6 +82,33 @@ const (
 	// see `%help`.
 	GONB_WASM_URL_ENV = "GONB_WASM_URL"
 
+	// GONB_ASSETS_DIR_ENV is the name of the environment variable with the directory where programs can
+	// publish files (assets) to be served to the front-end, from the URL in GONB_ASSETS_URL_ENV.
+	// The directory may not exist yet. See `gonbui.PublishAsset`.
+	GONB_ASSETS_DIR_ENV = "GONB_ASSETS_DIR"
+
+	// GONB_ASSETS_URL_ENV is the name of the environment variable with the URL from where the files in
+	// GONB_ASSETS_DIR_ENV are served.
+	GONB_ASSETS_URL_ENV = "GONB_ASSETS_URL"
+
+	// GONB_RANDOM_SEED_ENV is the name of the environment variable with the fixed random seed set by
+	// `%deterministic on`. Programs that want reproducible outputs should seed their random number generators
+	// with it, when it is set. See `gonbui.RandomSeed`.
+	GONB_RANDOM_SEED_ENV = "GONB_RANDOM_SEED"
+
+	// GONB_GIT_TOPLEVEL_ENV is the name of the environment variable set by `%git root` with the top-level
+	// directory of the git repository holding the current directory.
+	GONB_GIT_TOPLEVEL_ENV = "GONB_GIT_TOPLEVEL"
+
+	// GONB_FDS_ENV is the name of the environment variable with the extra file descriptors (e.g. listening
+	// sockets set with `%listen`) inherited by the program, as a comma-separated list of `<name>=<fd>`.
+	// See `gonbui.InheritedFile` and `gonbui.Listener`.
+	GONB_FDS_ENV = "GONB_FDS"
+
+	// GONB_SHARED_DIR_ENV is the name of the environment variable with the directory (in shared memory, if
+	// available) where programs create the files handed to the following cells with `store.WriteShared`.
+	GONB_SHARED_DIR_ENV = "GONB_SHARED_DIR"
+
 	// GONB_VERSION of the build -- based on latest git tag.
 	GONB_VERSION = "GONB_VERSION"
 
@@ -105,6 +145,64 @@ const (
 	//
 	// It's a GoNB specific mime type.
 	MIMECommSubscribe MIMEType = "gonb/comm_subscribe"
+
+	// MIMECommThrottle maps to a `*CommThrottle`, and configures the throttling (or debouncing) of the
+	// updates from the front-end to the given address.
+	// It's used by `comms.Throttle` and `comms.Debounce`.
+	//
+	// It's a GoNB specific mime type.
+	MIMECommThrottle MIMEType = "gonb/comm_throttle"
+
+	// MIMEJupyterWidget maps to a `*JupyterWidgetRequest`, and opens, updates or closes a model of a
+	// stock Jupyter widget (ipywidgets) in the front-end.
+	// It's used by the `gonbui/ipywidgets` package.
+	//
+	// It's a GoNB specific mime type.
+	MIMEJupyterWidget MIMEType = "gonb/jupyter_widget"
+
+	// MIMEDisplayBatch maps to a `*DisplayBatch`, and starts or ends a batch of display updates.
+	// It's used by `gonbui.BeginBatch` and `gonbui.EndBatch`.
+	//
+	// It's a GoNB specific mime type.
+	MIMEDisplayBatch MIMEType = "gonb/display_batch"
+
+	// MIMEDisplayHandle maps to a `*DisplayHandle`, and registers (or keeps) a display created with
+	// `gonbui.NewDisplay`.
+	//
+	// It's a GoNB specific mime type.
+	MIMEDisplayHandle MIMEType = "gonb/display_handle"
+
+	// MIMEClearOutput maps to a `*ClearOutput`, and clears the output of the cell.
+	// It's used by `gonbui.ClearOutput`.
+	//
+	// It's a GoNB specific mime type.
+	MIMEClearOutput MIMEType = "gonb/clear_output"
+
+	// MIMEPipeAuth maps to a `*PipeAuth`, and authenticates the program to GoNB. It must be the first
+	// message sent through the named pipe. It's sent automatically by `gonbui`.
+	//
+	// It's a GoNB specific mime type.
+	MIMEPipeAuth MIMEType = "gonb/pipe_auth"
+
+	// MIMESessionInfo maps to a `*SessionInfoRequest`, and requests information about the notebook session.
+	// GoNB replies with a `CommValue` to GonbuiSessionInfoAddress, holding a `SessionInfo`.
+	//
+	// It's a GoNB specific mime type.
+	MIMESessionInfo MIMEType = "gonb/session_info"
+
+	// MIMEStoreRequest maps to a `*StoreRequest`, and gets, sets or deletes values of the key/value store hosted
+	// by GoNB. GoNB replies with a `CommValue` to GonbuiStoreAddress, holding a `StoreReply`.
+	// It's used by `gonbui/store`.
+	//
+	// It's a GoNB specific mime type.
+	MIMEStoreRequest MIMEType = "gonb/store_request"
+
+	// MIMEStreamWrite maps to a `*StreamWrite`, and writes text to a named logical stream, which GoNB routes
+	// to a display block or a file (see `%route`).
+	// It's used by `gonbui.Stream`.
+	//
+	// It's a GoNB specific mime type.
+	MIMEStreamWrite MIMEType = "gonb/stream_write"
 )
 
 // DisplayData mimics the contents of the "display_data" message used by Jupyter, see
@@ -134,14 +232,28 @@ type InputRequest struct {
 
 	// Password input, in which case the contents are not displayed.
 	Password bool
+
+	// Reply requests the value entered to be sent back to the program in an InputReply (to GonbuiInputAddress),
+	// with the given Id, instead of being written to its stdin. It's used by `gonbui.ReadLine`.
+	Reply bool
+	Id    int
+}
+
+// InputReply is the value entered by the user for an InputRequest with Reply set.
+type InputReply struct {
+	Id    int
+	Value string
 }
 
 // CommValueTypes currently accepted for communication with front-end.
 // Can be used in generics for type matching, even though through the wire
 // they are simply encoded as `any`.
+//
+// Values of type `[]byte` are sent as binary buffers (not encoded in JSON), and are received
+// in the front-end as a `DataView`. Use it for large payloads, like images, audio or arrays.
 type CommValueTypes interface {
-	int | float64 | string | []int | []float64 | []string |
-		map[string]int | map[string]float64 | map[string]string
+	int | float64 | string | []byte | []int | []float64 | []string |
+		map[string]int | map[string]float64 | map[string]string | map[string]any
 }
 
 // CommValue update or request to the front-end.
@@ -157,26 +269,217 @@ type CommSubscription struct {
 	Unsubscribe bool // Set to true to unsubscribe instead.
 }
 
+// CommThrottle configures how GoNB delivers to the program the updates from the front-end to an address:
+// consecutive values are coalesced, and only the latest is delivered.
+type CommThrottle struct {
+	Address string
+
+	// Period of the throttling: at most one value is delivered per period. Set to 0 to disable it.
+	Period time.Duration
+
+	// Debounce, if set, delays the delivery until no new values arrive for Period, instead.
+	Debounce bool
+}
+
+// DisplayBatch starts or ends a batch of display updates (DisplayData with a DisplayID): while a batch
+// is open, GoNB keeps only the latest update for each DisplayID, and publishes them when the batch ends.
+// Batches can be nested: updates are only published when the outermost batch ends.
+type DisplayBatch struct {
+	End bool // Set to true to end the batch, instead of starting one.
+}
+
+// DisplayHandle registers a display (an output block identified by DisplayID) created by the program
+// with GoNB: registered displays are cleared when the program exits, unless Keep is set.
+type DisplayHandle struct {
+	DisplayID string
+
+	// Keep, if set, unregisters the display, so it is not cleared when the program exits.
+	Keep bool
+}
+
+// ClearOutput requests the output of the cell to be cleared, using Jupyter's "clear_output" message.
+type ClearOutput struct {
+	// Wait, if set, delays clearing the output until new output is available.
+	Wait bool
+}
+
+// PipeAuth authenticates the program to GoNB, it must be the first message sent through the named pipe.
+type PipeAuth struct {
+	// Secret given by GoNB to the program in the environment variable GONB_PIPE_SECRET_ENV.
+	Secret string
+}
+
+// SessionInfoRequest requests the SessionInfo from GoNB. Id is returned in the SessionInfo, to match
+// the reply to the request.
+type SessionInfoRequest struct {
+	Id int
+}
+
+// SessionInfo holds information about the notebook session executing the program.
+type SessionInfo struct {
+	// Id of the SessionInfoRequest.
+	Id int
+
+	// KernelId is the unique id assigned by Jupyter to the kernel. Empty if it's not known.
+	KernelId string
+
+	// NotebookPath is the path to the notebook, as reported by the Jupyter server (usually relative
+	// to the Jupyter root directory, see GONB_JUPYTER_ROOT_ENV). Empty if it's not known.
+	NotebookPath string
+
+	// ExecutionCount of the cell being executed.
+	ExecutionCount int
+
+	// Version and GitCommit of the GoNB kernel.
+	Version, GitCommit string
+}
+
+// StoreOp is the operation of a StoreRequest.
+type StoreOp int
+
+const (
+	StoreGet StoreOp = iota
+	StoreSet
+	StoreDelete
+	StoreKeys
+)
+
+// StoreRequest is a request to the key/value store hosted by GoNB, that keeps its values across the executions
+// of the cells. Id is returned in the StoreReply, to match the reply to the request.
+type StoreRequest struct {
+	Id  int
+	Op  StoreOp
+	Key string
+
+	// Value to set, encoded by the program (`gonbui/store` uses `encoding/gob`): GoNB stores it as is.
+	Value []byte
+
+	// File is set for StoreSet of a file: Value is then the path of a file the program created in the
+	// directory given by GONB_SHARED_DIR_ENV. GoNB owns the file from then on, and removes it when the key
+	// is deleted or replaced.
+	File bool
+}
+
+// StoreReply is the reply of GoNB to a StoreRequest.
+type StoreReply struct {
+	// Id of the StoreRequest.
+	Id int
+
+	// Value and whether it was Found, for StoreGet (Found is also set for StoreDelete).
+	// If File is set, Value is the path of the file set with StoreRequest.File.
+	Value []byte
+	Found bool
+	File  bool
+
+	// Keys in the store, sorted, for StoreKeys.
+	Keys []string
+
+	// Error, if the request failed (e.g. the store is not available).
+	Error string
+}
+
+// StreamWrite writes Text to the named logical stream Name. GoNB routes each named stream separately,
+// by default to its own display block. See `%route`.
+type StreamWrite struct {
+	Name string
+	Text string
+}
+
+// JupyterWidgetRequest opens, updates or closes the model of a Jupyter widget (ipywidgets) in the front-end.
+//
+// Models are kept in sync with the front-end using the Jupyter widget messaging protocol, see
+// https://github.com/jupyter-widgets/ipywidgets/blob/main/packages/schema/messages.md .
+// Changes made in the front-end are sent back to the program as a `CommValue` to the address
+// `JupyterWidgetAddressPrefix + ModelId`, if the program subscribed to it.
+type JupyterWidgetRequest struct {
+	// ModelId is the unique id of the model, also used as its "comm_id".
+	ModelId string
+
+	// Open the model (a "comm_open" message) with the given State.
+	// If not set, the request is an update of the model State.
+	Open bool
+
+	// State of the model: the full state if opening it, or the attributes changed if updating it.
+	State map[string]any
+
+	// Display the view of the widget in the cell output.
+	Display bool
+
+	// Close the model (a "comm_close" message).
+	Close bool
+}
+
+// JupyterWidgetAddressPrefix is the prefix of the address where updates to a Jupyter widget model
+// (ipywidgets) are delivered to the program. The address is the prefix followed by the model id.
+const JupyterWidgetAddressPrefix = "#jupyter.widget/"
+
+const (
+	// ExecAddressPrefix is the prefix of the addresses scoped to a cell execution (see `comms.ScopedAddress`):
+	// it is followed by the execution count, see ExecAddressScope.
+	//
+	// When the cell program finishes, GoNB drops the values not yet delivered to these addresses, and the
+	// front-end removes the subscriptions to them, so re-running the same widget code doesn't cross-talk
+	// with the widgets of previous executions.
+	ExecAddressPrefix = "/exec/"
+
+	// PersistentAddressPrefix is the prefix of addresses meant to persist across executions: they are not
+	// scoped by `comms.ScopedAddress`, nor cleaned up when the program finishes.
+	PersistentAddressPrefix = "/persistent/"
+)
+
+// ExecAddressScope returns the prefix of the addresses scoped to the cell execution with the given count.
+func ExecAddressScope(executionCount int) string {
+	return ExecAddressPrefix + strconv.Itoa(executionCount) + "/"
+}
+
 const (
 	// GonbuiSyncAddress is for internal use -- used to implement `gonbui.Sync`.
 	GonbuiSyncAddress = "#gonbui/sync"
 	// GonbuiSyncAckAddress is for internal use -- used to implement `gonbui.Sync`.
 	GonbuiSyncAckAddress = "#gonbui/sync_ack"
+	// GonbuiSessionInfoAddress is for internal use -- used to implement `gonbui.SessionInfo`.
+	GonbuiSessionInfoAddress = "#gonbui/session_info"
+	// GonbuiInputAddress is for internal use -- used to implement `gonbui.ReadLine`.
+	GonbuiInputAddress = "#gonbui/input"
+	// GonbuiStoreAddress is for internal use -- used to implement `gonbui/store`.
+	GonbuiStoreAddress = "#gonbui/store"
 	// GonbuiStartAddress is for internal use -- used to implement `comms.Start`.
 	GonbuiStartAddress = "#comms/start"
+	// GonbuiOpenedAddress is for internal use -- GoNB sends a value to it every time the connection
+	// with the front-end is (re-)established. Used by `widgets.Bind`.
+	GonbuiOpenedAddress = "#comms/opened"
+	// GonbuiCleanupAddress is for internal use -- GoNB sends to it the ExecAddressScope of a finished
+	// program, for the front-end to remove the subscriptions to its addresses. Front-end code can subscribe
+	// to it to be notified when the program finished.
+	GonbuiCleanupAddress = "#comms/cleanup"
 )
 
 func init() {
 	gob.Register(DisplayData{})
 	gob.Register(InputRequest{})
+	gob.Register(InputReply{})
 	gob.Register(CommValue{})
 	gob.Register(CommSubscription{})
+	gob.Register(CommThrottle{})
+	gob.Register(JupyterWidgetRequest{})
+	gob.Register(DisplayBatch{})
+	gob.Register(DisplayHandle{})
+	gob.Register(ClearOutput{})
+	gob.Register(PipeAuth{})
+	gob.Register(SessionInfoRequest{})
+	gob.Register(SessionInfo{})
+	gob.Register(StoreRequest{})
+	gob.Register(StoreReply{})
+	gob.Register(StreamWrite{})
 
 	// Register CommValueTypes.
+	gob.Register([]byte{})
 	gob.Register([]int{})
 	gob.Register([]float64{})
 	gob.Register([]string{})
 	gob.Register(map[string]int{})
 	gob.Register(map[string]float64{})
 	gob.Register(map[string]string{})
+	gob.Register(map[string]any{})
+	gob.Register([]any{})
 }
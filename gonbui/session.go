@@ -0,0 +1,84 @@
+package gonbui
+
+import (
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+	"os"
+	"strconv"
+)
+
+var (
+	// Control SessionInfo requests/replies.
+	nextSessionInfoId      int
+	sessionInfoRequestsMap = make(map[int]chan protocol.SessionInfo)
+)
+
+// SessionInfo returns information about the notebook session executing the program: the Jupyter kernel id,
+// the notebook path (if the Jupyter server reports it), the execution count of the cell and the GoNB version.
+//
+// It can be used, for instance, to tag artifacts generated by the program with the notebook that created them.
+//
+// Similar to Sync, it blocks until GoNB replies.
+//
+// It returns an error if not running in a notebook, or if the communication with GoNB failed.
+func SessionInfo() (*protocol.SessionInfo, error) {
+	if !IsNotebook {
+		return nil, errors.New("gonbui.SessionInfo() not available: program not executed by GoNB")
+	}
+	mu.Lock()
+	id := nextSessionInfoId
+	nextSessionInfoId++
+	replyChan := make(chan protocol.SessionInfo, 1)
+	sessionInfoRequestsMap[id] = replyChan
+	mu.Unlock()
+
+	SendData(&protocol.DisplayData{
+		Data: map[protocol.MIMEType]any{
+			protocol.MIMESessionInfo: &protocol.SessionInfoRequest{Id: id},
+		},
+	})
+	if err := Error(); err != nil {
+		mu.Lock()
+		delete(sessionInfoRequestsMap, id)
+		mu.Unlock()
+		return nil, err
+	}
+	info := <-replyChan
+	return &info, nil
+}
+
+// deliverSessionInfoLocked delivers the reply to a SessionInfo request.
+// It assumes mu is locked.
+func deliverSessionInfoLocked(valueMsg *protocol.CommValue) {
+	info, ok := valueMsg.Value.(protocol.SessionInfo)
+	var replyChan chan protocol.SessionInfo
+	if ok {
+		replyChan, ok = sessionInfoRequestsMap[info.Id]
+	}
+	if !ok {
+		Logf("Received invalid SessionInfo reply %+v !?", valueMsg)
+		return
+	}
+	delete(sessionInfoRequestsMap, info.Id)
+	replyChan <- info
+}
+
+// RandomSeed returns the fixed random seed set by `%deterministic on`, and whether it is set.
+// Programs that want reproducible outputs should use it to seed their random number generators, e.g.:
+//
+//	seed, ok := gonbui.RandomSeed()
+//	if !ok {
+//		seed = time.Now().UnixNano()
+//	}
+//	rng := rand.New(rand.NewSource(seed))
+func RandomSeed() (seed int64, ok bool) {
+	value, found := os.LookupEnv(protocol.GONB_RANDOM_SEED_ENV)
+	if !found {
+		return 0, false
+	}
+	seed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return seed, true
+}
@@ -0,0 +1,18 @@
+//go:build !(linux || darwin)
+
+package store
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the contents of f, with the given size: memory mapping is not supported in this platform.
+// It returns the data and the function to release it.
+func mapFile(f *os.File, size int) ([]byte, func() error, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
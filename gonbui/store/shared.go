@@ -0,0 +1,133 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/janpfeifer/gonb/gonbui"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+)
+
+// WriteShared hands large datasets from one cell to the next without re-reading or re-parsing them: it creates a
+// file in a directory owned by GoNB (in shared memory, `/dev/shm`, when available), writes its contents with
+// write, and sets it as the value of key. The following cells memory-map the file with OpenShared.
+//
+// It is meant to be used with formats that can be read directly from memory, like the Apache Arrow IPC
+// file format, or Parquet:
+//
+//	err := store.WriteShared("sales", func(w io.Writer) error {
+//		writer, err := ipc.NewFileWriter(w, ipc.WithSchema(record.Schema()))
+//		if err != nil {
+//			return err
+//		}
+//		if err = writer.Write(record); err != nil {
+//			return err
+//		}
+//		return writer.Close()
+//	})
+//
+// GoNB owns the file from then on: it is removed when the key is deleted or replaced, or when the kernel stops.
+// Shared files are not saved with `%store save` or `%store persist`.
+func WriteShared(key string, write func(w io.Writer) error) error {
+	dir := os.Getenv(protocol.GONB_SHARED_DIR_ENV)
+	if !gonbui.IsNotebook || dir == "" {
+		return errors.Errorf("store.WriteShared(%q): the GoNB shared directory is not available", key)
+	}
+	f, err := os.CreateTemp(dir, "shared-*")
+	if err != nil {
+		return errors.Wrapf(err, "store.WriteShared(%q): failed to create shared file", key)
+	}
+	writer := bufio.NewWriter(f)
+	err = write(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		_, err = gonbui.SendStoreRequest(protocol.StoreRequest{
+			Op: protocol.StoreSet, Key: key, Value: []byte(f.Name()), File: true})
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.WithMessagef(err, "store.WriteShared(%q)", key)
+	}
+	return nil
+}
+
+// Shared is a read-only memory mapping of a file written with WriteShared, see OpenShared.
+//
+// It implements io.Reader, io.ReaderAt and io.Seeker, as required by the Apache Arrow (`ipc.NewFileReader`)
+// and Parquet (`file.NewParquetReader`) readers. Close it to release the mapping.
+type Shared struct {
+	*bytes.Reader
+	data  []byte
+	unmap func() error
+}
+
+// OpenShared memory-maps the file set for key with WriteShared. It returns an error wrapping ErrNotFound if
+// the key is not set. E.g., to read a table written in the Apache Arrow IPC file format:
+//
+//	shared, err := store.OpenShared("sales")
+//	if err != nil {
+//		return err
+//	}
+//	defer shared.Close()
+//	reader, err := ipc.NewFileReader(shared)
+//
+// The data remains valid (even if the key is deleted or replaced) until Close is called.
+func OpenShared(key string) (*Shared, error) {
+	reply, err := gonbui.SendStoreRequest(protocol.StoreRequest{Op: protocol.StoreGet, Key: key})
+	if err != nil {
+		return nil, err
+	}
+	if !reply.Found {
+		return nil, errors.Wrapf(ErrNotFound, "store.OpenShared(%q)", key)
+	}
+	if !reply.File {
+		return nil, errors.Errorf("store.OpenShared(%q): value was not set with store.WriteShared, use store.Get", key)
+	}
+	shared, err := openShared(string(reply.Value))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "store.OpenShared(%q)", key)
+	}
+	return shared, nil
+}
+
+// openShared memory-maps the file in filePath.
+func openShared(filePath string) (*Shared, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open shared file")
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open shared file")
+	}
+	data, unmap, err := mapFile(f, int(info.Size()))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to map shared file")
+	}
+	return &Shared{Reader: bytes.NewReader(data), data: data, unmap: unmap}, nil
+}
+
+// Bytes returns the contents of the file. They must not be modified, nor used after Close.
+func (s *Shared) Bytes() []byte {
+	return s.data
+}
+
+// Close releases the memory mapping of the file.
+func (s *Shared) Close() error {
+	if s.unmap == nil {
+		return nil
+	}
+	err := s.unmap()
+	s.unmap, s.data = nil, nil
+	s.Reader = bytes.NewReader(nil)
+	return err
+}
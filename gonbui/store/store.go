@@ -0,0 +1,98 @@
+// Package store implements a key/value store hosted by GoNB, to pass values from one cell to the next.
+//
+// Each cell is executed as a new program, so values computed in one cell are lost when it finishes. With
+// this package, a cell can store a value, and the following ones can retrieve it:
+//
+//	%%
+//	store.Set("model_path", modelPath)
+//
+// And in a later cell:
+//
+//	%%
+//	modelPath, err := store.Get[string]("model_path")
+//
+// The values are encoded with `encoding/gob`, so they must be of a type supported by it: the value is
+// retrieved into the type given to Get, following gob's rules of compatibility between types.
+//
+// The store is kept by the kernel until it restarts: it can be listed, saved to and loaded from disk with
+// the `%store` special command.
+//
+// Large datasets (e.g. Apache Arrow record batches) can be handed from one cell to the next through shared
+// memory, without re-reading or re-parsing them, with WriteShared and OpenShared.
+package store
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/janpfeifer/gonb/gonbui"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned by Get if the key is not in the store.
+var ErrNotFound = errors.New("key not found in the GoNB store")
+
+// Set stores the value under the key, replacing any previous value.
+func Set(key string, value any) error {
+	encoded, err := encode(value)
+	if err != nil {
+		return errors.WithMessagef(err, "store.Set(%q)", key)
+	}
+	_, err = gonbui.SendStoreRequest(protocol.StoreRequest{Op: protocol.StoreSet, Key: key, Value: encoded})
+	return err
+}
+
+// Get retrieves the value stored under key. It returns an error wrapping ErrNotFound if the key is not set.
+func Get[T any](key string) (value T, err error) {
+	reply, err := gonbui.SendStoreRequest(protocol.StoreRequest{Op: protocol.StoreGet, Key: key})
+	if err != nil {
+		return
+	}
+	if !reply.Found {
+		err = errors.Wrapf(ErrNotFound, "store.Get(%q)", key)
+		return
+	}
+	if reply.File {
+		err = errors.Errorf("store.Get(%q): value was set with store.WriteShared, use store.OpenShared", key)
+		return
+	}
+	value, err = decode[T](reply.Value)
+	if err != nil {
+		err = errors.WithMessagef(err, "store.Get(%q)", key)
+	}
+	return
+}
+
+// Delete removes the key from the store. It's a no-op if the key is not set.
+func Delete(key string) error {
+	_, err := gonbui.SendStoreRequest(protocol.StoreRequest{Op: protocol.StoreDelete, Key: key})
+	return err
+}
+
+// Keys returns the keys in the store, sorted.
+func Keys() ([]string, error) {
+	reply, err := gonbui.SendStoreRequest(protocol.StoreRequest{Op: protocol.StoreKeys})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Keys, nil
+}
+
+// encode the value with `encoding/gob`.
+func encode(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, errors.Wrapf(err, "failed to encode value of type %T", value)
+	}
+	return buf.Bytes(), nil
+}
+
+// decode the value encoded by encode into type T.
+func decode[T any](data []byte) (value T, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to decode value into type %T", value)
+	}
+	return
+}
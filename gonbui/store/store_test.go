@@ -0,0 +1,64 @@
+package store
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	type point struct{ X, Y float64 }
+	encoded, err := encode(map[string]point{"a": {1, 2}})
+	require.NoError(t, err)
+	decoded, err := decode[map[string]point](encoded)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]point{"a": {1, 2}}, decoded)
+
+	encoded, err = encode("model.bin")
+	require.NoError(t, err)
+	_, err = decode[int](encoded)
+	require.Error(t, err)
+
+	_, err = encode(func() {})
+	require.Error(t, err)
+}
+
+func TestNotInNotebook(t *testing.T) {
+	require.Error(t, Set("x", 1))
+	_, err := Get[int]("x")
+	require.Error(t, err)
+}
+
+func TestOpenShared(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "shared")
+	require.NoError(t, os.WriteFile(filePath, []byte("0123456789"), 0600))
+	shared, err := openShared(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("0123456789"), shared.Bytes())
+	buf := make([]byte, 3)
+	_, err = shared.ReadAt(buf, 5)
+	require.NoError(t, err)
+	assert.Equal(t, "567", string(buf))
+	_, err = shared.Seek(8, io.SeekStart)
+	require.NoError(t, err)
+	rest, err := io.ReadAll(shared)
+	require.NoError(t, err)
+	assert.Equal(t, "89", string(rest))
+	require.NoError(t, shared.Close())
+	assert.Nil(t, shared.Bytes())
+
+	// Empty files.
+	require.NoError(t, os.WriteFile(filePath, nil, 0600))
+	shared, err = openShared(filePath)
+	require.NoError(t, err)
+	assert.Empty(t, shared.Bytes())
+	require.NoError(t, shared.Close())
+
+	_, err = openShared(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+	require.Error(t, WriteShared("x", func(w io.Writer) error { return nil }))
+}
@@ -0,0 +1,61 @@
+package gonbui
+
+import (
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+)
+
+var (
+	// Control StoreRequest requests/replies.
+	nextStoreRequestId int
+	storeRequestsMap   = make(map[int]chan protocol.StoreReply)
+)
+
+// SendStoreRequest sends the request to the key/value store hosted by GoNB, and waits for its reply.
+// The Id of the request is set automatically.
+//
+// It is the low-level API used by the `gonbui/store` package, use that instead.
+func SendStoreRequest(req protocol.StoreRequest) (*protocol.StoreReply, error) {
+	if !IsNotebook {
+		return nil, errors.New("the GoNB store is not available: program not executed by GoNB")
+	}
+	mu.Lock()
+	req.Id = nextStoreRequestId
+	nextStoreRequestId++
+	replyChan := make(chan protocol.StoreReply, 1)
+	storeRequestsMap[req.Id] = replyChan
+	mu.Unlock()
+
+	SendData(&protocol.DisplayData{
+		Data: map[protocol.MIMEType]any{
+			protocol.MIMEStoreRequest: &req,
+		},
+	})
+	if err := Error(); err != nil {
+		mu.Lock()
+		delete(storeRequestsMap, req.Id)
+		mu.Unlock()
+		return nil, err
+	}
+	reply := <-replyChan
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+	return &reply, nil
+}
+
+// deliverStoreReplyLocked delivers the reply to a StoreRequest.
+// It assumes mu is locked.
+func deliverStoreReplyLocked(valueMsg *protocol.CommValue) {
+	reply, ok := valueMsg.Value.(protocol.StoreReply)
+	var replyChan chan protocol.StoreReply
+	if ok {
+		replyChan, ok = storeRequestsMap[reply.Id]
+	}
+	if !ok {
+		Logf("Received invalid StoreReply %+v !?", valueMsg)
+		return
+	}
+	delete(storeRequestsMap, reply.Id)
+	replyChan <- reply
+}
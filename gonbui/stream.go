@@ -0,0 +1,68 @@
+package gonbui
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+)
+
+// NamedStream is a logical output stream, identified by its name, to separate some of the output of a program
+// (e.g.: logs, metrics) from its results. It is created with Stream.
+//
+// GoNB routes each named stream separately: by default to its own display block in the cell output, or
+// to a file, as configured with `%route`. E.g.: `%route metrics -> capture://metrics.log`.
+//
+// Outside a notebook, what is written to a NamedStream goes to the standard output.
+//
+// It implements io.Writer, so it can be used with the `log` package, for instance.
+type NamedStream struct {
+	name string
+}
+
+// Stream returns the named logical stream with the given name. Example:
+//
+//	metrics := gonbui.Stream("metrics")
+//	for step := 0; step < numSteps; step++ {
+//		loss := train()
+//		metrics.Printf("step=%d loss=%g\n", step, loss)
+//	}
+func Stream(name string) *NamedStream {
+	return &NamedStream{name: name}
+}
+
+// Name of the stream.
+func (s *NamedStream) Name() string {
+	return s.name
+}
+
+// Write implements io.Writer.
+func (s *NamedStream) Write(p []byte) (int, error) {
+	if !IsNotebook {
+		return os.Stdout.Write(p)
+	}
+	SendData(&protocol.DisplayData{
+		Data: map[protocol.MIMEType]any{
+			protocol.MIMEStreamWrite: &protocol.StreamWrite{Name: s.name, Text: string(p)},
+		},
+	})
+	if err := Error(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Print writes to the stream, formatting args like fmt.Print.
+func (s *NamedStream) Print(args ...any) {
+	_, _ = fmt.Fprint(s, args...)
+}
+
+// Println writes to the stream, formatting args like fmt.Println.
+func (s *NamedStream) Println(args ...any) {
+	_, _ = fmt.Fprintln(s, args...)
+}
+
+// Printf writes to the stream, formatting args like fmt.Printf.
+func (s *NamedStream) Printf(format string, args ...any) {
+	_, _ = fmt.Fprintf(s, format, args...)
+}
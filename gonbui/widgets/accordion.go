@@ -0,0 +1,226 @@
+package widgets
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/gonbui"
+	"github.com/janpfeifer/gonb/gonbui/comms"
+	"github.com/janpfeifer/gonb/gonbui/dom"
+	"html"
+	"strings"
+	"text/template"
+)
+
+//go:embed accordion.js
+var accordionJs []byte
+
+var tmplAccordionJs = template.Must(template.New("accordionJs").Parse(
+	string(accordionJs)))
+
+// AccordionBuilder is used to create an accordion container on the front-end: a list of
+// collapsible sections, where at most one is open at a time.
+//
+// Widgets are placed in a section by passing the id of its panel (returned by `AddSection`) to
+// their `AppendTo` method.
+type AccordionBuilder struct {
+	address, htmlId, parentHtmlId string
+	built                         bool
+	titles                        []string
+
+	currentValue int
+
+	// listenUpdates is the channel used to keep tabs of the updates.
+	listenUpdates *comms.AddressChan[int]
+	firstUpdate   *common.Latch // If first update received.
+}
+
+// Accordion returns a builder object that builds a new accordion container. Sections can be added
+// with `AddSection`, before or after it is built.
+//
+// Values (used for `Listen`, `Value` and `SetValue`) are integers representing
+// the index of the section open, or -1 if all sections are closed (the default).
+//
+// Call `Done` method when you finish configuring the AccordionBuilder.
+func Accordion() *AccordionBuilder {
+	return &AccordionBuilder{
+		address:      comms.ScopedAddress("/accordion/" + gonbui.UniqueId()),
+		htmlId:       "gonb_accordion_" + gonbui.UniqueId(),
+		currentValue: -1,
+		firstUpdate:  common.NewLatch(),
+	}
+}
+
+// WithHtmlId sets the id to use when creating the HTML element in the DOM.
+// If not set, a unique one will be generated, and can be read with HtmlId.
+//
+// This can only be set before call to Done. If called afterward, it panics.
+func (b *AccordionBuilder) WithHtmlId(htmlId string) *AccordionBuilder {
+	if b.built {
+		panicf("AccordionBuilder cannot change parameters after it is built")
+	}
+	b.htmlId = htmlId
+	return b
+}
+
+// WithAddress configures the widget to use the given address to communicate its state
+// with the front-end.
+//
+// The default is to use a randomly created unique address.
+//
+// The address is scoped to the cell execution (see `comms.ScopedAddress`), except if it is prefixed
+// with protocol.PersistentAddressPrefix: use Address to get the address actually used.
+//
+// It panics if called after the widget is built.
+func (b *AccordionBuilder) WithAddress(address string) *AccordionBuilder {
+	if b.built {
+		panicf("AccordionBuilder cannot change parameters after it is built")
+	}
+	b.address = comms.ScopedAddress(address)
+	return b
+}
+
+// SetDefault section open. If not set, it is -1, meaning all sections are closed.
+//
+// It panics if called after the widget is built.
+func (b *AccordionBuilder) SetDefault(idx int) *AccordionBuilder {
+	if b.built {
+		panicf("AccordionBuilder cannot change parameters after it is built")
+	}
+	b.currentValue = idx
+	return b
+}
+
+// AppendTo defines an id of the parent element in the DOM (in the front-end)
+// where to insert the widget. It can be the id of another container.
+//
+// If not defined, it will simply display it as default in the output of the cell.
+//
+// It panics if called after the widget is built.
+func (b *AccordionBuilder) AppendTo(parentHtmlId string) *AccordionBuilder {
+	if b.built {
+		panicf("AccordionBuilder cannot change parameters after it is built")
+	}
+	b.parentHtmlId = parentHtmlId
+	return b
+}
+
+// AddSection adds a section with the given title, and returns the `id` of its panel, to be used in the
+// `AppendTo` method of the widgets to place in the section.
+//
+// It can be called before or after Done.
+func (b *AccordionBuilder) AddSection(title string) (panelHtmlId string) {
+	idx := len(b.titles)
+	b.titles = append(b.titles, title)
+	if b.built {
+		dom.Append(b.htmlId, b.sectionHtml(idx))
+	}
+	return b.PanelHtmlId(idx)
+}
+
+// PanelHtmlId returns the `id` of the panel of the section with index idx.
+func (b *AccordionBuilder) PanelHtmlId(idx int) string {
+	return fmt.Sprintf("%s_panel_%d", b.htmlId, idx)
+}
+
+// sectionHtml returns the HTML for the section idx: its header and its panel.
+func (b *AccordionBuilder) sectionHtml(idx int) string {
+	title := html.EscapeString(b.titles[idx])
+	marker, style := "▸", ` style="display: none; padding: 0.3em 1em;"`
+	if idx == b.currentValue {
+		marker, style = "▾", ` style="padding: 0.3em 1em;"`
+	}
+	return fmt.Sprintf(`<div data-index="%d" data-title="%s" style="border: 1px solid #ccc; margin-bottom: -1px;">`+
+		`<button type="button" style="background: none; border: none; width: 100%%; text-align: left; padding: 0.3em 0.5em; cursor: pointer;">%s %s</button>`+
+		`<div id="%s"%s></div></div>`,
+		idx, title, marker, title, b.PanelHtmlId(idx), style)
+}
+
+// Done builds the HTML element in the frontend and starts listening to updates.
+//
+// After this is called options can no longer be set.
+//
+// The value associated with the widget can now be read or modified with `Value`, `GetValue` and
+// `Listen` are available.
+func (b *AccordionBuilder) Done() *AccordionBuilder {
+	if b.built {
+		panicf("AccordionBuilder.Done already called!?")
+	}
+	b.built = true
+
+	// Record incoming section selections.
+	b.listenUpdates = comms.Listen[int](b.address)
+	go func() {
+		for newValue := range b.listenUpdates.C {
+			b.firstUpdate.Trigger() // First update received, we are ready for business.
+			gonbui.Logf("Accordion(%s): section open is %d", b.htmlId, newValue)
+			b.currentValue = newValue
+		}
+	}()
+
+	parts := make([]string, 0, len(b.titles)+2)
+	parts = append(parts, fmt.Sprintf(`<div id="%s">`, b.htmlId))
+	for ii := range b.titles {
+		parts = append(parts, b.sectionHtml(ii))
+	}
+	parts = append(parts, "</div>")
+	accordionHtml := strings.Join(parts, "\n")
+	if b.parentHtmlId == "" {
+		gonbui.DisplayHtml(accordionHtml)
+	} else {
+		dom.Append(b.parentHtmlId, accordionHtml)
+	}
+
+	var buf bytes.Buffer
+	data := struct {
+		Address, HtmlId string
+		Value           int
+	}{
+		Address: b.address,
+		HtmlId:  b.htmlId,
+		Value:   b.currentValue,
+	}
+	err := tmplAccordionJs.Execute(&buf, data)
+	if err != nil {
+		panicf("Accordion template is invalid!? Please report the error to GoNB: %v", err)
+	}
+	dom.TransientJavascript(buf.String())
+
+	b.firstUpdate.Wait()
+	return b
+}
+
+// Listen returns an `AddressChannel[int]` (a wrapper for a `chan int`) that receives the index of the
+// section open (or -1 if all are closed), each time it changes.
+//
+// Close the returned channel (`Close()` method) to unsubscribe from these messages and release the resources.
+//
+// It can only be called after the Accordion is created with Done, otherwise it panics.
+func (b *AccordionBuilder) Listen() *comms.AddressChan[int] {
+	if !b.built {
+		panicf("AccordionBuilder.Listen can only be called after the accordion was created with `Done()` method")
+	}
+	return comms.Listen[int](b.address)
+}
+
+// HtmlId returns the `id` used in the widget HTML element created.
+func (b *AccordionBuilder) HtmlId() string {
+	return b.htmlId
+}
+
+// Address returns the address used to communicate to the widgets HTML element.
+func (b *AccordionBuilder) Address() string {
+	return b.address
+}
+
+// Value returns the index of the section currently open, or -1 if all are closed.
+func (b *AccordionBuilder) Value() int {
+	return b.currentValue
+}
+
+// SetValue opens the section with the given index (or closes all with -1), communicating that with the UI.
+func (b *AccordionBuilder) SetValue(value int) {
+	comms.Send(b.address, value)
+	b.currentValue = value
+}
@@ -0,0 +1,27 @@
+(() => {
+    let gonb_comm = globalThis?.gonb_comm;
+    if (!gonb_comm) {
+        console.error("Communication to GoNB not setup, accordion will not synchronize with program.")
+        return;
+    }
+    const accordion = document.getElementById("{{.HtmlId}}");
+    let selected = gonb_comm.newSyncedVariable("{{.Address}}", {{.Value}});
+    function show(index) {
+        for (const section of accordion.children) {
+            const isOpen = section.dataset.index == index;
+            section.querySelector(":scope > button").textContent =
+                (isOpen ? "▾ " : "▸ ") + section.dataset.title;
+            section.querySelector(":scope > div").style.display = isOpen ? "" : "none";
+        }
+    }
+    accordion.addEventListener("click", function(event) {
+        const header = event.target.closest("button");
+        if (!header || header.parentElement?.parentElement !== accordion) {
+            return;
+        }
+        const index = parseInt(header.parentElement.dataset.index);
+        // Clicking on the open section closes it.
+        selected.set(selected.get() == index ? -1 : index);
+    });
+    selected.subscribe((value) => show(value));
+})();
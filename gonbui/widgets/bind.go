@@ -0,0 +1,126 @@
+package widgets
+
+import (
+	"github.com/janpfeifer/gonb/gonbui/comms"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"sync"
+)
+
+// Binding keeps a Go variable synchronized with a value in the front-end, at a given address.
+// See Bind.
+type Binding[T protocol.CommValueTypes] struct {
+	address string
+	ptr     *T
+
+	mu        sync.Mutex
+	onChange  []func(value T)
+	unbound   bool
+	valueSub  comms.SubscriptionId
+	openedSub comms.SubscriptionId
+}
+
+// Bind keeps the variable pointed by ptr synchronized with the value at the address in the front-end:
+//
+//   - Updates from the front-end (e.g.: a user moving a slider using the same address) are written to
+//     the variable.
+//   - Use the returned `Binding.Set` to change the variable and update the front-end.
+//
+// The last write wins, whichever side it comes from. The current value of the variable is sent to the
+// front-end when it is bound, and again whenever the connection to the front-end is re-established
+// (e.g.: if the browser page is reloaded).
+//
+// Updates from the front-end happen asynchronously: use `Binding.Get` (or `Binding.OnChange`) to read
+// the variable safely while it is bound.
+//
+// Example:
+//
+//	var size int = 50
+//	slider := widgets.Slider(0, 100, size).Done()
+//	sizeBinding := widgets.Bind(slider.Address(), &size)
+//	...
+//	sizeBinding.Set(10)  // Moves the slider.
+func Bind[T protocol.CommValueTypes](address string, ptr *T) *Binding[T] {
+	b := &Binding[T]{
+		address: address,
+		ptr:     ptr,
+	}
+	b.valueSub = comms.Subscribe[T](address, func(_ string, value T) {
+		b.mu.Lock()
+		if b.unbound {
+			b.mu.Unlock()
+			return
+		}
+		*b.ptr = value
+		callbacks := b.onChange
+		b.mu.Unlock()
+		for _, callback := range callbacks {
+			callback(value)
+		}
+	})
+	b.openedSub = comms.Subscribe[int](protocol.GonbuiOpenedAddress, func(_ string, _ int) {
+		// Connection (re-)established: the front-end may have lost its state.
+		b.Sync()
+	})
+	b.Sync()
+	return b
+}
+
+// Address returns the address in the front-end the variable is bound to.
+func (b *Binding[T]) Address() string {
+	return b.address
+}
+
+// Get returns the current value of the bound variable.
+func (b *Binding[T]) Get() T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return *b.ptr
+}
+
+// Set the bound variable to value, and sends it to the front-end.
+func (b *Binding[T]) Set(value T) {
+	b.mu.Lock()
+	*b.ptr = value
+	unbound := b.unbound
+	b.mu.Unlock()
+	if !unbound {
+		comms.Send(b.address, value)
+	}
+}
+
+// Sync sends the current value of the bound variable to the front-end.
+// This is done automatically when the variable is bound and when the connection to the front-end
+// is re-established.
+func (b *Binding[T]) Sync() {
+	b.mu.Lock()
+	value := *b.ptr
+	unbound := b.unbound
+	b.mu.Unlock()
+	if !unbound {
+		comms.Send(b.address, value)
+	}
+}
+
+// OnChange registers a callback to be called whenever the front-end updates the bound variable.
+// The callback is called in a separate goroutine, after the variable is updated.
+//
+// It returns itself, so calls can be cascaded.
+func (b *Binding[T]) OnChange(callback func(value T)) *Binding[T] {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onChange = append(b.onChange, callback)
+	return b
+}
+
+// Unbind stops synchronizing the variable with the front-end, and releases the resources used.
+func (b *Binding[T]) Unbind() {
+	b.mu.Lock()
+	if b.unbound {
+		b.mu.Unlock()
+		return
+	}
+	b.unbound = true
+	b.mu.Unlock()
+	comms.Unsubscribe(b.valueSub)
+	comms.Unsubscribe(b.openedSub)
+}
@@ -0,0 +1,123 @@
+package widgets
+
+import (
+	"fmt"
+	"github.com/janpfeifer/gonb/gonbui"
+	"github.com/janpfeifer/gonb/gonbui/dom"
+)
+
+// BoxBuilder is used to create a layout container on the front-end, that arranges
+// the widgets appended to it in a row (HBox) or in a column (VBox).
+//
+// Widgets are placed in the box by passing its `HtmlId` (or the id of one of its slots,
+// see `NewSlot`) to their `AppendTo` method.
+type BoxBuilder struct {
+	htmlId, parentHtmlId string
+	direction, gap       string
+	built                bool
+	numSlots             int
+}
+
+// HBox returns a builder object that builds a container that arranges its contents in a row.
+//
+// Call `Done` method when you finish configuring the BoxBuilder.
+func HBox() *BoxBuilder {
+	return newBox("row")
+}
+
+// VBox returns a builder object that builds a container that arranges its contents in a column.
+//
+// Call `Done` method when you finish configuring the BoxBuilder.
+func VBox() *BoxBuilder {
+	return newBox("column")
+}
+
+func newBox(direction string) *BoxBuilder {
+	return &BoxBuilder{
+		htmlId:    "gonb_box_" + gonbui.UniqueId(),
+		direction: direction,
+		gap:       "0.5em",
+	}
+}
+
+// WithHtmlId sets the id to use when creating the HTML element in the DOM.
+// If not set, a unique one will be generated, and can be read with HtmlId.
+//
+// This can only be set before call to Done. If called afterward, it panics.
+func (b *BoxBuilder) WithHtmlId(htmlId string) *BoxBuilder {
+	if b.built {
+		panicf("BoxBuilder cannot change parameters after it is built")
+	}
+	b.htmlId = htmlId
+	return b
+}
+
+// WithGap sets the space between the items of the box, in CSS units. Default is "0.5em".
+//
+// This can only be set before call to Done. If called afterward, it panics.
+func (b *BoxBuilder) WithGap(gap string) *BoxBuilder {
+	if b.built {
+		panicf("BoxBuilder cannot change parameters after it is built")
+	}
+	b.gap = gap
+	return b
+}
+
+// AppendTo defines an id of the parent element in the DOM (in the front-end)
+// where to insert the box. It can be the id of another container, e.g.: a tab panel.
+//
+// If not defined, it will simply display it as default in the output of the cell.
+//
+// It panics if called after the widget is built.
+func (b *BoxBuilder) AppendTo(parentHtmlId string) *BoxBuilder {
+	if b.built {
+		panicf("BoxBuilder cannot change parameters after it is built")
+	}
+	b.parentHtmlId = parentHtmlId
+	return b
+}
+
+// Done builds the HTML element in the frontend.
+//
+// After this is called options can no longer be set.
+func (b *BoxBuilder) Done() *BoxBuilder {
+	if b.built {
+		panicf("BoxBuilder.Done already called!?")
+	}
+	b.built = true
+
+	alignItems := "center"
+	if b.direction == "column" {
+		alignItems = "flex-start"
+	}
+	html := fmt.Sprintf(`<div id="%s" style="display: flex; flex-direction: %s; gap: %s; align-items: %s;"></div>`,
+		b.htmlId, b.direction, b.gap, alignItems)
+	if b.parentHtmlId == "" {
+		gonbui.DisplayHtml(html)
+	} else {
+		dom.Append(b.parentHtmlId, html)
+	}
+	return b
+}
+
+// NewSlot appends a new empty item to the box, and returns its `id`, to be used in the
+// `AppendTo` method of the widgets to place in it.
+//
+// Each slot is one item of the box: the widgets appended to the same slot are kept together.
+// Widgets appended directly to the box (using `HtmlId`) are each one item.
+//
+// It can only be called after the box is created with Done, otherwise it panics.
+func (b *BoxBuilder) NewSlot() (slotHtmlId string) {
+	if !b.built {
+		panicf("BoxBuilder.NewSlot can only be called after the box was created with `Done()` method")
+	}
+	slotHtmlId = fmt.Sprintf("%s_slot_%d", b.htmlId, b.numSlots)
+	b.numSlots++
+	dom.Append(b.htmlId, fmt.Sprintf(`<div id="%s"></div>`, slotHtmlId))
+	return
+}
+
+// HtmlId returns the `id` used in the widget HTML element created.
+func (b *BoxBuilder) HtmlId() string {
+	return b.htmlId
+}
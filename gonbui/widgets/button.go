@@ -19,7 +19,7 @@ var tmplButtonJs = template.Must(template.New("buttonJs").Parse(
 // ButtonBuilder is used to create a button on the front-end.
 type ButtonBuilder struct {
 	address, label, htmlId, parentHtmlId string
-	onClick                              func()
+	onClick                              []func()
 	built                                bool
 }
 
@@ -33,7 +33,7 @@ type ButtonBuilder struct {
 func Button(label string) *ButtonBuilder {
 	return &ButtonBuilder{
 		label:   label,
-		address: "/button/" + gonbui.UniqueId(),
+		address: comms.ScopedAddress("/button/" + gonbui.UniqueId()),
 		htmlId:  "gonb_button_" + gonbui.UniqueId(),
 	}
 }
@@ -55,12 +55,15 @@ func (b *ButtonBuilder) WithHtmlId(htmlId string) *ButtonBuilder {
 //
 // The default is to use a randomly created unique address.
 //
+// The address is scoped to the cell execution (see `comms.ScopedAddress`), except if it is prefixed
+// with protocol.PersistentAddressPrefix: use Address to get the address actually used.
+//
 // It panics if called after the widget is built.
 func (b *ButtonBuilder) WithAddress(address string) *ButtonBuilder {
 	if b.built {
 		panicf("ButtonBuilder cannot change parameters after it is built")
 	}
-	b.address = address
+	b.address = comms.ScopedAddress(address)
 	return b
 }
 
@@ -107,9 +110,37 @@ func (b *ButtonBuilder) Done() *ButtonBuilder {
 
 	<-clicks.C // Consume the first incoming button message, with counter == 0.
 	clicks.Close()
+	for _, callback := range b.onClick {
+		b.subscribeOnClick(callback)
+	}
+	return b
+}
+
+// OnClick registers a callback to be called each time the button is clicked. It can be called before
+// or after the button is built with Done.
+//
+// The callback is executed in the cell program's process (see `comms.OnUpdate`): calls are serialized, and
+// only happen while the program is running. E.g.:
+//
+//	widgets.Button("Retrain").OnClick(func() { model.Retrain() }).Done()
+//	<-gonbui.Ctx().Done()  // Handle clicks until the cell is interrupted.
+func (b *ButtonBuilder) OnClick(callback func()) *ButtonBuilder {
+	if b.built {
+		b.subscribeOnClick(callback)
+	} else {
+		b.onClick = append(b.onClick, callback)
+	}
 	return b
 }
 
+func (b *ButtonBuilder) subscribeOnClick(callback func()) {
+	comms.OnUpdate[int](b.address, func(count int) {
+		if count > 0 { // Counter == 0 is sent when the button is created.
+			callback()
+		}
+	})
+}
+
 // Listen returns an `AddressChannel[int]` (a wrapper for a `chan int`) that receives a counter each time the
 // button is clicked.
 // The counter is incremented at every click.
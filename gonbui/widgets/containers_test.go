@@ -0,0 +1,28 @@
+package widgets
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTabsHtml(t *testing.T) {
+	tabs := Tabs().WithHtmlId("t").SetDefault(1)
+	assert.Equal(t, "t_panel_0", tabs.AddTab("First"))
+	assert.Equal(t, "t_panel_1", tabs.AddTab("<Second>"))
+	assert.Contains(t, tabs.tabHtml(1), "&lt;Second&gt;")
+	assert.Contains(t, tabs.tabHtml(1), "font-weight: bold")
+	assert.Contains(t, tabs.tabHtml(0), "font-weight: normal")
+	assert.Contains(t, tabs.panelHtml(0), `id="t_panel_0" data-index="0" style="display: none;"`)
+	assert.False(t, strings.Contains(tabs.panelHtml(1), "display: none"))
+}
+
+func TestAccordionHtml(t *testing.T) {
+	accordion := Accordion().WithHtmlId("a")
+	assert.Equal(t, -1, accordion.Value())
+	assert.Equal(t, "a_panel_0", accordion.AddSection("Advanced & more"))
+	section := accordion.sectionHtml(0)
+	assert.Contains(t, section, `data-title="Advanced &amp; more"`)
+	assert.Contains(t, section, `<div id="a_panel_0" style="display: none;`)
+}
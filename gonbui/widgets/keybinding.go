@@ -0,0 +1,223 @@
+package widgets
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html"
+	"strings"
+	"text/template"
+
+	"github.com/janpfeifer/gonb/gonbui"
+	"github.com/janpfeifer/gonb/gonbui/comms"
+	"github.com/janpfeifer/gonb/gonbui/dom"
+	"github.com/pkg/errors"
+)
+
+//go:embed keybinding.js
+var keyBindingJs []byte
+
+var tmplKeyBindingJs = template.Must(template.New("keyBindingJs").Parse(
+	string(keyBindingJs)))
+
+// keyCombination is a key with its modifiers, parsed by parseKeyCombination.
+type keyCombination struct {
+	// Key is the lower-cased value of the JavaScript `KeyboardEvent.key` (e.g.: "r", "enter", "arrowup").
+	Key                    string
+	Ctrl, Alt, Shift, Meta bool
+}
+
+// parseKeyCombination parses keys like "ctrl+shift+r" or "Escape": optional modifiers ("ctrl", "alt", "shift"
+// and "meta" -- "cmd" is an alias to "meta") followed by the key, separated by "+". Case is ignored.
+func parseKeyCombination(keys string) (combo keyCombination, err error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(keys)), "+")
+	for _, modifier := range parts[:len(parts)-1] {
+		switch strings.TrimSpace(modifier) {
+		case "ctrl", "control":
+			combo.Ctrl = true
+		case "alt", "option":
+			combo.Alt = true
+		case "shift":
+			combo.Shift = true
+		case "meta", "cmd":
+			combo.Meta = true
+		default:
+			return combo, errors.Errorf("invalid modifier %q in key combination %q", modifier, keys)
+		}
+	}
+	combo.Key = strings.TrimSpace(parts[len(parts)-1])
+	switch combo.Key {
+	case "":
+		return combo, errors.Errorf("missing key in key combination %q", keys)
+	case "space":
+		combo.Key = " "
+	case "esc":
+		combo.Key = "escape"
+	}
+	return combo, nil
+}
+
+// KeyBindingBuilder is used to bind a keyboard shortcut, scoped to the cell output, to the program.
+type KeyBindingBuilder struct {
+	address, keys, label, htmlId, parentHtmlId string
+	combo                                      keyCombination
+	onPress                                    []func()
+	built                                      bool
+}
+
+// KeyBinding returns a builder object that configures and builds a key binding for the given keys, e.g.:
+// "ctrl+r", "shift+Enter" or "Escape". It panics if the keys are invalid.
+//
+// The binding is scoped to the cell output: it is triggered when the key is pressed while the cell is
+// selected (and not being edited). It is removed when the output of the cell is cleared.
+//
+// Use OnPress to register callbacks, or `Listen` to get updates -- the value returned
+// is an int that is incremented at every key press.
+//
+// Call `Done` method when you finish configuring the KeyBindingBuilder.
+func KeyBinding(keys string) *KeyBindingBuilder {
+	combo, err := parseKeyCombination(keys)
+	if err != nil {
+		panicf("widgets.KeyBinding: %v", err)
+	}
+	return &KeyBindingBuilder{
+		keys:    keys,
+		combo:   combo,
+		address: comms.ScopedAddress("/key_binding/" + gonbui.UniqueId()),
+		htmlId:  "gonb_key_binding_" + gonbui.UniqueId(),
+	}
+}
+
+// WithHtmlId sets the id to use when creating the HTML element in the DOM.
+// If not set, a unique one will be generated, and can be read with HtmlId.
+//
+// This can only be set before call to Done. If called afterward, it panics.
+func (k *KeyBindingBuilder) WithHtmlId(htmlId string) *KeyBindingBuilder {
+	if k.built {
+		panicf("KeyBindingBuilder cannot change parameters after it is built")
+	}
+	k.htmlId = htmlId
+	return k
+}
+
+// WithAddress configures the widget to use the given address to communicate its state
+// with the front-end.
+//
+// The default is to use a randomly created unique address.
+//
+// The address is scoped to the cell execution (see `comms.ScopedAddress`), except if it is prefixed
+// with protocol.PersistentAddressPrefix: use Address to get the address actually used.
+//
+// It panics if called after the widget is built.
+func (k *KeyBindingBuilder) WithAddress(address string) *KeyBindingBuilder {
+	if k.built {
+		panicf("KeyBindingBuilder cannot change parameters after it is built")
+	}
+	k.address = comms.ScopedAddress(address)
+	return k
+}
+
+// WithLabel displays a hint with the keys and the given label (e.g.: "Retrain"), so the user knows about
+// the binding. By default, nothing is displayed.
+//
+// It panics if called after the widget is built.
+func (k *KeyBindingBuilder) WithLabel(label string) *KeyBindingBuilder {
+	if k.built {
+		panicf("KeyBindingBuilder cannot change parameters after it is built")
+	}
+	k.label = label
+	return k
+}
+
+// AppendTo defines an id of the parent element in the DOM (in the front-end)
+// where to insert the (hint of the) key binding.
+//
+// If not defined, it will simply display it as default in the output of the cell.
+//
+// It panics if called after the widget is built.
+func (k *KeyBindingBuilder) AppendTo(parentHtmlId string) *KeyBindingBuilder {
+	if k.built {
+		panicf("KeyBindingBuilder cannot change parameters after it is built")
+	}
+	k.parentHtmlId = parentHtmlId
+	return k
+}
+
+// OnPress registers a callback to be called each time the keys are pressed. It can be called before
+// or after the key binding is built with Done.
+//
+// The callback is executed in the cell program's process (see `comms.OnUpdate`): calls are serialized, and
+// only happen while the program is running.
+func (k *KeyBindingBuilder) OnPress(callback func()) *KeyBindingBuilder {
+	if k.built {
+		comms.OnUpdate[int](k.address, func(int) { callback() })
+	} else {
+		k.onPress = append(k.onPress, callback)
+	}
+	return k
+}
+
+// keyBindingHtml returns the HTML of the element that anchors the key binding to the cell output.
+func (k *KeyBindingBuilder) keyBindingHtml() string {
+	if k.label == "" {
+		return fmt.Sprintf(`<span id="%s" style="display: none;"></span>`, k.htmlId)
+	}
+	return fmt.Sprintf(`<span id="%s"><kbd>%s</kbd> %s</span>`,
+		k.htmlId, html.EscapeString(k.keys), html.EscapeString(k.label))
+}
+
+// Done builds the HTML element in the frontend and installs the key binding.
+func (k *KeyBindingBuilder) Done() *KeyBindingBuilder {
+	if k.built {
+		panicf("KeyBindingBuilder.Done already called!?")
+	}
+	k.built = true
+	for _, callback := range k.onPress {
+		comms.OnUpdate[int](k.address, func(int) { callback() })
+	}
+
+	if k.parentHtmlId == "" {
+		gonbui.DisplayHtml(k.keyBindingHtml())
+	} else {
+		dom.Append(k.parentHtmlId, k.keyBindingHtml())
+	}
+
+	var buf bytes.Buffer
+	data := struct {
+		keyCombination
+		Address, HtmlId string
+	}{
+		keyCombination: k.combo,
+		Address:        k.address,
+		HtmlId:         k.htmlId,
+	}
+	err := tmplKeyBindingJs.Execute(&buf, data)
+	if err != nil {
+		panicf("KeyBinding template is invalid!? Please report the error to GoNB: %v", err)
+	}
+	dom.TransientJavascript(buf.String())
+	return k
+}
+
+// Listen returns an `AddressChan[int]` (a wrapper for a `chan int`) that receives a counter each time the
+// keys are pressed.
+//
+// Close the returned channel (`Close()` method) to unsubscribe from these messages and release the resources.
+//
+// It can only be called after the KeyBinding is created with Done, otherwise it panics.
+func (k *KeyBindingBuilder) Listen() *comms.AddressChan[int] {
+	if !k.built {
+		panicf("KeyBindingBuilder.Listen can only be called after the key binding was created with `Done()` method")
+	}
+	return comms.Listen[int](k.address)
+}
+
+// HtmlId returns the `id` used in the widget HTML element created.
+func (k *KeyBindingBuilder) HtmlId() string {
+	return k.htmlId
+}
+
+// Address returns the address used to communicate to the widgets HTML element.
+func (k *KeyBindingBuilder) Address() string {
+	return k.address
+}
@@ -0,0 +1,36 @@
+(() => {
+    let gonb_comm = globalThis?.gonb_comm;
+    if (!gonb_comm) {
+        console.error("Communication to GoNB not setup, key binding will not trigger the program.")
+        return;
+    }
+    const anchor = document.getElementById("{{.HtmlId}}");
+    const cell = anchor.closest(".jp-Cell, .cell");
+    let count = 0;
+    const listener = function(event) {
+        if (!anchor.isConnected) {
+            // Cell output was cleared: the binding is no longer valid.
+            document.removeEventListener("keydown", listener, true);
+            return;
+        }
+        if (event.key.toLowerCase() !== "{{js .Key}}" || event.ctrlKey !== {{.Ctrl}} || event.altKey !== {{.Alt}} ||
+            event.shiftKey !== {{.Shift}} || event.metaKey !== {{.Meta}}) {
+            return;
+        }
+        // Scoped to the cell output: the cell must be selected, and the key not typed in an editor.
+        const target = event.target;
+        if (target.closest && target.closest(".jp-InputArea, .input, input, textarea, select")) {
+            return;
+        }
+        const inCell = cell ? (cell.contains(target) || cell.classList.contains("jp-mod-active") ||
+            cell.classList.contains("selected")) : anchor.parentElement.contains(target);
+        if (!inCell) {
+            return;
+        }
+        event.preventDefault();
+        event.stopPropagation();
+        count++;
+        gonb_comm.send("{{.Address}}", count);
+    };
+    document.addEventListener("keydown", listener, true);
+})();
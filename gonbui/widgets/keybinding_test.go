@@ -0,0 +1,33 @@
+package widgets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeyCombination(t *testing.T) {
+	combo, err := parseKeyCombination("Ctrl+Shift+R")
+	require.NoError(t, err)
+	assert.Equal(t, keyCombination{Key: "r", Ctrl: true, Shift: true}, combo)
+
+	combo, err = parseKeyCombination("cmd+space")
+	require.NoError(t, err)
+	assert.Equal(t, keyCombination{Key: " ", Meta: true}, combo)
+
+	combo, err = parseKeyCombination("Esc")
+	require.NoError(t, err)
+	assert.Equal(t, keyCombination{Key: "escape"}, combo)
+
+	_, err = parseKeyCombination("hyper+x")
+	assert.Error(t, err)
+	_, err = parseKeyCombination("ctrl+")
+	assert.Error(t, err)
+}
+
+func TestKeyBindingHtml(t *testing.T) {
+	assert.Contains(t, KeyBinding("ctrl+r").WithHtmlId("k").keyBindingHtml(), `id="k" style="display: none;"`)
+	assert.Equal(t, `<span id="k"><kbd>ctrl+r</kbd> Retrain &amp; plot</span>`,
+		KeyBinding("ctrl+r").WithHtmlId("k").WithLabel("Retrain & plot").keyBindingHtml())
+}
@@ -0,0 +1,229 @@
+package widgets
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html"
+	"os"
+	"text/template"
+
+	"github.com/janpfeifer/gonb/gonbui"
+	"github.com/janpfeifer/gonb/gonbui/comms"
+	"github.com/janpfeifer/gonb/gonbui/dom"
+)
+
+//go:embed prompt.js
+var promptJs []byte
+
+var tmplPromptJs = template.Must(template.New("promptJs").Parse(
+	string(promptJs)))
+
+// PromptBuilder is used to create a text input box on the front-end, whose submissions
+// (when the user presses Enter) are delivered to the program.
+type PromptBuilder struct {
+	address, label, placeholder, htmlId, parentHtmlId string
+	bufferSize                                        int
+	replaceStdin, built                               bool
+
+	submissions *comms.AddressChan[string]
+}
+
+// Prompt returns a builder object that configures and builds a persistent text input box,
+// displayed with the given `label` (it can be left empty).
+//
+// Each time the user presses Enter, the text typed is sent to the program and the box is cleared,
+// so the user can submit any number of inputs, while the program runs. Read them with `Listen`,
+// or use `ReplaceStdin` to read them from `os.Stdin`.
+//
+// Unlike `gonbui.RequestInput` (or `%with_inputs`), it doesn't block the notebook waiting for the input:
+// this is the recommended way of getting input for long-running programs. E.g.:
+//
+//	prompt := widgets.Prompt("Command:").Done()
+//	for cmd := range prompt.Listen().C {
+//		...
+//	}
+//
+// Unless it is appended to some other element (see AppendTo), it is kept at the bottom of the cell output.
+//
+// Call `Done` method when you finish configuring the PromptBuilder.
+func Prompt(label string) *PromptBuilder {
+	return &PromptBuilder{
+		label:      label,
+		address:    comms.ScopedAddress("/prompt/" + gonbui.UniqueId()),
+		htmlId:     "gonb_prompt_" + gonbui.UniqueId(),
+		bufferSize: 16,
+	}
+}
+
+// WithHtmlId sets the id to use when creating the HTML element in the DOM.
+// If not set, a unique one will be generated, and can be read with HtmlId.
+//
+// This can only be set before call to Done. If called afterward, it panics.
+func (p *PromptBuilder) WithHtmlId(htmlId string) *PromptBuilder {
+	if p.built {
+		panicf("PromptBuilder cannot change parameters after it is built")
+	}
+	p.htmlId = htmlId
+	return p
+}
+
+// WithAddress configures the widget to use the given address to communicate its state
+// with the front-end.
+//
+// The default is to use a randomly created unique address.
+//
+// The address is scoped to the cell execution (see `comms.ScopedAddress`), except if it is prefixed
+// with protocol.PersistentAddressPrefix: use Address to get the address actually used.
+//
+// It panics if called after the widget is built.
+func (p *PromptBuilder) WithAddress(address string) *PromptBuilder {
+	if p.built {
+		panicf("PromptBuilder cannot change parameters after it is built")
+	}
+	p.address = comms.ScopedAddress(address)
+	return p
+}
+
+// WithPlaceholder sets the text displayed in the input box while it is empty.
+//
+// It panics if called after the widget is built.
+func (p *PromptBuilder) WithPlaceholder(placeholder string) *PromptBuilder {
+	if p.built {
+		panicf("PromptBuilder cannot change parameters after it is built")
+	}
+	p.placeholder = placeholder
+	return p
+}
+
+// WithBuffer sets the number of submissions buffered, while the program is not reading them.
+// Further submissions block the delivery of other updates from the front-end, until read. Default is 16.
+//
+// It panics if called after the widget is built.
+func (p *PromptBuilder) WithBuffer(n int) *PromptBuilder {
+	if p.built {
+		panicf("PromptBuilder cannot change parameters after it is built")
+	}
+	p.bufferSize = n
+	return p
+}
+
+// ReplaceStdin replaces `os.Stdin` by a pipe where the submissions are written, each followed by a new line.
+// So they can be read with `fmt.Scan`, `bufio.Scanner`, etc. -- `os.Stdin` must be read after Done is called.
+//
+// The submissions are not delivered to Listen in this case.
+//
+// It panics if called after the widget is built.
+func (p *PromptBuilder) ReplaceStdin() *PromptBuilder {
+	if p.built {
+		panicf("PromptBuilder cannot change parameters after it is built")
+	}
+	p.replaceStdin = true
+	return p
+}
+
+// AppendTo defines an id of the parent element in the DOM (in the front-end)
+// where to insert the prompt.
+//
+// If not defined, it will be displayed in the output of the cell, and kept at its bottom.
+//
+// It panics if called after the widget is built.
+func (p *PromptBuilder) AppendTo(parentHtmlId string) *PromptBuilder {
+	if p.built {
+		panicf("PromptBuilder cannot change parameters after it is built")
+	}
+	p.parentHtmlId = parentHtmlId
+	return p
+}
+
+// promptHtml returns the HTML of the prompt element.
+func (p *PromptBuilder) promptHtml() string {
+	input := fmt.Sprintf(`<input id="%s" type="text" placeholder="%s" style="flex: 1;"/>`,
+		p.htmlId, html.EscapeString(p.placeholder))
+	label := ""
+	if p.label != "" {
+		label = fmt.Sprintf(`<label for="%s">%s</label>`, p.htmlId, html.EscapeString(p.label))
+	}
+	return fmt.Sprintf(`<div style="display: flex; gap: 0.5em; align-items: center;">%s%s</div>`, label, input)
+}
+
+// Done builds the HTML element in the frontend and starts listening to its submissions.
+func (p *PromptBuilder) Done() *PromptBuilder {
+	if p.built {
+		panicf("PromptBuilder.Done already called!?")
+	}
+	p.built = true
+
+	// Listen before creating the element, so no submission is lost.
+	p.submissions = comms.Listen[string](p.address).WithBuffer(p.bufferSize)
+	if p.replaceStdin {
+		p.pipeToStdin()
+	}
+
+	if p.parentHtmlId == "" {
+		gonbui.DisplayHtml(p.promptHtml())
+	} else {
+		dom.Append(p.parentHtmlId, p.promptHtml())
+	}
+
+	var buf bytes.Buffer
+	data := struct {
+		Address, HtmlId string
+		PinToBottom     bool
+	}{
+		Address:     p.address,
+		HtmlId:      p.htmlId,
+		PinToBottom: p.parentHtmlId == "",
+	}
+	err := tmplPromptJs.Execute(&buf, data)
+	if err != nil {
+		panicf("Prompt template is invalid!? Please report the error to GoNB: %v", err)
+	}
+	dom.TransientJavascript(buf.String())
+	return p
+}
+
+// pipeToStdin replaces os.Stdin by a pipe, and writes the submissions to it.
+func (p *PromptBuilder) pipeToStdin() {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		panicf("Prompt failed to create pipe to replace os.Stdin: %v", err)
+	}
+	os.Stdin = reader
+	go func() {
+		for value := range p.submissions.C {
+			if _, err := writer.WriteString(value + "\n"); err != nil {
+				gonbui.Logf("Prompt failed to write to os.Stdin replacement: %v", err)
+				break
+			}
+		}
+		_ = writer.Close()
+	}()
+}
+
+// Listen returns the `AddressChan[string]` (a wrapper for a `chan string`) that receives the text
+// submitted each time the user presses Enter. It is created (buffered, see WithBuffer) by Done,
+// so no submission is lost, and the same one is returned at every call.
+//
+// Close the returned channel (`Close()` method) to stop receiving submissions and release the resources.
+//
+// It can only be called after the Prompt is created with Done, and if not using ReplaceStdin, otherwise it panics.
+func (p *PromptBuilder) Listen() *comms.AddressChan[string] {
+	if !p.built {
+		panicf("PromptBuilder.Listen can only be called after the prompt was created with `Done()` method")
+	}
+	if p.replaceStdin {
+		panicf("PromptBuilder.Listen can't be used with ReplaceStdin, read the submissions from os.Stdin instead")
+	}
+	return p.submissions
+}
+
+// HtmlId returns the `id` used in the widget HTML element created.
+func (p *PromptBuilder) HtmlId() string {
+	return p.htmlId
+}
+
+// Address returns the address used to communicate to the widgets HTML element.
+func (p *PromptBuilder) Address() string {
+	return p.address
+}
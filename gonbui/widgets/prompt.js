@@ -0,0 +1,25 @@
+(() => {
+    let gonb_comm = globalThis?.gonb_comm;
+    if (!gonb_comm) {
+        console.error("Communication to GoNB not setup, prompt will not send its inputs to the program.")
+        return;
+    }
+    const input = document.getElementById("{{.HtmlId}}");
+    {{if .PinToBottom}}
+    // Keep the prompt at the bottom of the cell output, after whatever the program outputs later.
+    const outputChild = input.closest(".jp-OutputArea-child");
+    if (outputChild && outputChild.parentElement) {
+        outputChild.parentElement.style.display = "flex";
+        outputChild.parentElement.style.flexDirection = "column";
+        outputChild.style.order = "1";
+    }
+    {{end}}
+    input.addEventListener("keydown", function(event) {
+        if (event.key !== "Enter") {
+            return;
+        }
+        event.preventDefault();
+        gonb_comm.send("{{.Address}}", input.value);
+        input.value = "";
+    });
+})();
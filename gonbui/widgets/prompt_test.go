@@ -0,0 +1,15 @@
+package widgets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromptHtml(t *testing.T) {
+	prompt := Prompt("Name & age:").WithHtmlId("p").WithPlaceholder(`"Joe", 7`)
+	got := prompt.promptHtml()
+	assert.Contains(t, got, `<label for="p">Name &amp; age:</label>`)
+	assert.Contains(t, got, `<input id="p" type="text" placeholder="&#34;Joe&#34;, 7"`)
+	assert.NotContains(t, Prompt("").WithHtmlId("p").promptHtml(), "<label")
+}
@@ -42,7 +42,7 @@ type SelectBuilder struct {
 // Call `Done` method when you finish configuring the SelectBuilder.
 func Select(options []string) *SelectBuilder {
 	return &SelectBuilder{
-		address:     "/select/" + gonbui.UniqueId(),
+		address:     comms.ScopedAddress("/select/" + gonbui.UniqueId()),
 		options:     options,
 		htmlId:      "gonb_select_" + gonbui.UniqueId(),
 		firstUpdate: common.NewLatch(),
@@ -66,12 +66,15 @@ func (b *SelectBuilder) WithHtmlId(htmlId string) *SelectBuilder {
 //
 // The default is to use a randomly created unique address.
 //
+// The address is scoped to the cell execution (see `comms.ScopedAddress`), except if it is prefixed
+// with protocol.PersistentAddressPrefix: use Address to get the address actually used.
+//
 // It panics if called after the widget is built.
 func (b *SelectBuilder) WithAddress(address string) *SelectBuilder {
 	if b.built {
 		panicf("SelectBuilder cannot change parameters after it is built")
 	}
-	b.address = address
+	b.address = comms.ScopedAddress(address)
 	return b
 }
 
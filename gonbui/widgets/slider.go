@@ -9,6 +9,7 @@ import (
 	"github.com/janpfeifer/gonb/gonbui/comms"
 	"github.com/janpfeifer/gonb/gonbui/dom"
 	"text/template"
+	"time"
 )
 
 //go:embed slider.js
@@ -23,6 +24,10 @@ type SliderBuilder struct {
 	onClick                              func()
 	built                                bool
 
+	// throttle period of the updates from the front-end, if > 0. See Throttle and Debounce.
+	throttle time.Duration
+	debounce bool
+
 	// Parameters of the slider.
 	min, max, currentValue int
 
@@ -43,7 +48,7 @@ func Slider(min, max, value int) *SliderBuilder {
 		min:          min,
 		max:          max,
 		currentValue: value,
-		address:      "/select/" + gonbui.UniqueId(),
+		address:      comms.ScopedAddress("/select/" + gonbui.UniqueId()),
 		htmlId:       "gonb_slider_" + gonbui.UniqueId(),
 		firstUpdate:  common.NewLatch(),
 	}
@@ -66,12 +71,15 @@ func (b *SliderBuilder) WithHtmlId(htmlId string) *SliderBuilder {
 //
 // The default is to use a randomly created unique address.
 //
+// The address is scoped to the cell execution (see `comms.ScopedAddress`), except if it is prefixed
+// with protocol.PersistentAddressPrefix: use Address to get the address actually used.
+//
 // It panics if called after the widget is built.
 func (b *SliderBuilder) WithAddress(address string) *SliderBuilder {
 	if b.built {
 		panicf("SliderBuilder cannot change parameters after it is built")
 	}
-	b.address = address
+	b.address = comms.ScopedAddress(address)
 	return b
 }
 
@@ -89,6 +97,31 @@ func (b *SliderBuilder) AppendTo(parentHtmlId string) *SliderBuilder {
 	return b
 }
 
+// Throttle the updates from the front-end (e.g.: while the user drags the slider) to at most
+// one per period. Consecutive values are coalesced, and the latest is always delivered.
+// See `comms.Throttle` for details.
+//
+// It panics if called after the widget is built.
+func (b *SliderBuilder) Throttle(period time.Duration) *SliderBuilder {
+	if b.built {
+		panicf("SliderBuilder cannot change parameters after it is built")
+	}
+	b.throttle, b.debounce = period, false
+	return b
+}
+
+// Debounce the updates from the front-end: only the value at which the slider rests for at least
+// period is delivered. See `comms.Debounce` for details.
+//
+// It panics if called after the widget is built.
+func (b *SliderBuilder) Debounce(period time.Duration) *SliderBuilder {
+	if b.built {
+		panicf("SliderBuilder cannot change parameters after it is built")
+	}
+	b.throttle, b.debounce = period, true
+	return b
+}
+
 // Done builds the HTML element in the frontend and starts listening to updates.
 //
 // After this is called options can no longer be set.
@@ -101,6 +134,14 @@ func (b *SliderBuilder) Done() *SliderBuilder {
 	}
 	b.built = true
 
+	if b.throttle > 0 {
+		if b.debounce {
+			comms.Debounce(b.address, b.throttle)
+		} else {
+			comms.Throttle(b.address, b.throttle)
+		}
+	}
+
 	// Record incoming slider updates.
 	b.listenUpdates = comms.Listen[int](b.address)
 	go func() {
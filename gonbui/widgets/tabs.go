@@ -0,0 +1,237 @@
+package widgets
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/gonbui"
+	"github.com/janpfeifer/gonb/gonbui/comms"
+	"github.com/janpfeifer/gonb/gonbui/dom"
+	"html"
+	"strings"
+	"text/template"
+)
+
+//go:embed tabs.js
+var tabsJs []byte
+
+var tmplTabsJs = template.Must(template.New("tabsJs").Parse(
+	string(tabsJs)))
+
+// TabsBuilder is used to create a tabs container on the front-end: only the panel of the
+// selected tab is shown.
+//
+// Widgets are placed in a tab by passing the id of its panel (returned by `AddTab`) to
+// their `AppendTo` method.
+type TabsBuilder struct {
+	address, htmlId, parentHtmlId string
+	built                         bool
+	titles                        []string
+
+	currentValue int
+
+	// listenUpdates is the channel used to keep tabs of the updates.
+	listenUpdates *comms.AddressChan[int]
+	firstUpdate   *common.Latch // If first update received.
+}
+
+// Tabs returns a builder object that builds a new tabs container. Tabs can be added
+// with `AddTab`, before or after it is built.
+//
+// Values (used for `Listen`, `Value` and `SetValue`) are integers representing
+// the index of the tab selected.
+//
+// Call `Done` method when you finish configuring the TabsBuilder.
+func Tabs() *TabsBuilder {
+	return &TabsBuilder{
+		address:     comms.ScopedAddress("/tabs/" + gonbui.UniqueId()),
+		htmlId:      "gonb_tabs_" + gonbui.UniqueId(),
+		firstUpdate: common.NewLatch(),
+	}
+}
+
+// WithHtmlId sets the id to use when creating the HTML element in the DOM.
+// If not set, a unique one will be generated, and can be read with HtmlId.
+//
+// This can only be set before call to Done. If called afterward, it panics.
+func (b *TabsBuilder) WithHtmlId(htmlId string) *TabsBuilder {
+	if b.built {
+		panicf("TabsBuilder cannot change parameters after it is built")
+	}
+	b.htmlId = htmlId
+	return b
+}
+
+// WithAddress configures the widget to use the given address to communicate its state
+// with the front-end.
+//
+// The default is to use a randomly created unique address.
+//
+// The address is scoped to the cell execution (see `comms.ScopedAddress`), except if it is prefixed
+// with protocol.PersistentAddressPrefix: use Address to get the address actually used.
+//
+// It panics if called after the widget is built.
+func (b *TabsBuilder) WithAddress(address string) *TabsBuilder {
+	if b.built {
+		panicf("TabsBuilder cannot change parameters after it is built")
+	}
+	b.address = comms.ScopedAddress(address)
+	return b
+}
+
+// SetDefault tab selected. If not set, it is 0.
+//
+// It panics if called after the widget is built.
+func (b *TabsBuilder) SetDefault(idx int) *TabsBuilder {
+	if b.built {
+		panicf("TabsBuilder cannot change parameters after it is built")
+	}
+	b.currentValue = idx
+	return b
+}
+
+// AppendTo defines an id of the parent element in the DOM (in the front-end)
+// where to insert the widget. It can be the id of another container.
+//
+// If not defined, it will simply display it as default in the output of the cell.
+//
+// It panics if called after the widget is built.
+func (b *TabsBuilder) AppendTo(parentHtmlId string) *TabsBuilder {
+	if b.built {
+		panicf("TabsBuilder cannot change parameters after it is built")
+	}
+	b.parentHtmlId = parentHtmlId
+	return b
+}
+
+// AddTab adds a tab with the given title, and returns the `id` of its panel, to be used in the
+// `AppendTo` method of the widgets to place in the tab.
+//
+// It can be called before or after Done.
+func (b *TabsBuilder) AddTab(title string) (panelHtmlId string) {
+	idx := len(b.titles)
+	b.titles = append(b.titles, title)
+	if b.built {
+		dom.Append(b.htmlId+"_header", b.tabHtml(idx))
+		dom.Append(b.htmlId+"_panels", b.panelHtml(idx))
+	}
+	return b.PanelHtmlId(idx)
+}
+
+// PanelHtmlId returns the `id` of the panel of the tab with index idx.
+func (b *TabsBuilder) PanelHtmlId(idx int) string {
+	return fmt.Sprintf("%s_panel_%d", b.htmlId, idx)
+}
+
+// tabHtml returns the HTML for the header of the tab idx.
+func (b *TabsBuilder) tabHtml(idx int) string {
+	style := "font-weight: normal; border-bottom: 2px solid transparent;"
+	if idx == b.currentValue {
+		style = "font-weight: bold; border-bottom: 2px solid;"
+	}
+	return fmt.Sprintf(`<button type="button" data-index="%d" style="background: none; border: none; padding: 0.3em 0.8em; cursor: pointer; %s">%s</button>`,
+		idx, style, html.EscapeString(b.titles[idx]))
+}
+
+// panelHtml returns the HTML for the panel of the tab idx.
+func (b *TabsBuilder) panelHtml(idx int) string {
+	var style string
+	if idx != b.currentValue {
+		style = ` style="display: none;"`
+	}
+	return fmt.Sprintf(`<div id="%s" data-index="%d"%s></div>`, b.PanelHtmlId(idx), idx, style)
+}
+
+// Done builds the HTML element in the frontend and starts listening to updates.
+//
+// After this is called options can no longer be set.
+//
+// The value associated with the widget can now be read or modified with `Value`, `GetValue` and
+// `Listen` are available.
+func (b *TabsBuilder) Done() *TabsBuilder {
+	if b.built {
+		panicf("TabsBuilder.Done already called!?")
+	}
+	b.built = true
+
+	// Record incoming tab selections.
+	b.listenUpdates = comms.Listen[int](b.address)
+	go func() {
+		for newValue := range b.listenUpdates.C {
+			b.firstUpdate.Trigger() // First update received, we are ready for business.
+			gonbui.Logf("Tabs(%s): tab selected is %d", b.htmlId, newValue)
+			b.currentValue = newValue
+		}
+	}()
+
+	parts := make([]string, 0, 2*len(b.titles)+6)
+	parts = append(parts, fmt.Sprintf(`<div id="%s">`, b.htmlId))
+	parts = append(parts, fmt.Sprintf(`<div id="%s_header" style="display: flex; border-bottom: 1px solid #ccc; margin-bottom: 0.5em;">`, b.htmlId))
+	for ii := range b.titles {
+		parts = append(parts, b.tabHtml(ii))
+	}
+	parts = append(parts, "</div>", fmt.Sprintf(`<div id="%s_panels">`, b.htmlId))
+	for ii := range b.titles {
+		parts = append(parts, b.panelHtml(ii))
+	}
+	parts = append(parts, "</div>", "</div>")
+	tabsHtml := strings.Join(parts, "\n")
+	if b.parentHtmlId == "" {
+		gonbui.DisplayHtml(tabsHtml)
+	} else {
+		dom.Append(b.parentHtmlId, tabsHtml)
+	}
+
+	var buf bytes.Buffer
+	data := struct {
+		Address, HtmlId string
+		Value           int
+	}{
+		Address: b.address,
+		HtmlId:  b.htmlId,
+		Value:   b.currentValue,
+	}
+	err := tmplTabsJs.Execute(&buf, data)
+	if err != nil {
+		panicf("Tabs template is invalid!? Please report the error to GoNB: %v", err)
+	}
+	dom.TransientJavascript(buf.String())
+
+	b.firstUpdate.Wait()
+	return b
+}
+
+// Listen returns an `AddressChannel[int]` (a wrapper for a `chan int`) that receives the index of the
+// tab selected, each time it changes.
+//
+// Close the returned channel (`Close()` method) to unsubscribe from these messages and release the resources.
+//
+// It can only be called after the Tabs is created with Done, otherwise it panics.
+func (b *TabsBuilder) Listen() *comms.AddressChan[int] {
+	if !b.built {
+		panicf("TabsBuilder.Listen can only be called after the tabs were created with `Done()` method")
+	}
+	return comms.Listen[int](b.address)
+}
+
+// HtmlId returns the `id` used in the widget HTML element created.
+func (b *TabsBuilder) HtmlId() string {
+	return b.htmlId
+}
+
+// Address returns the address used to communicate to the widgets HTML element.
+func (b *TabsBuilder) Address() string {
+	return b.address
+}
+
+// Value returns the index of the tab currently selected.
+func (b *TabsBuilder) Value() int {
+	return b.currentValue
+}
+
+// SetValue selects the tab with the given index, communicating that with the UI.
+func (b *TabsBuilder) SetValue(value int) {
+	comms.Send(b.address, value)
+	b.currentValue = value
+}
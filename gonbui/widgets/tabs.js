@@ -0,0 +1,28 @@
+(() => {
+    let gonb_comm = globalThis?.gonb_comm;
+    if (!gonb_comm) {
+        console.error("Communication to GoNB not setup, tabs will not synchronize with program.")
+        return;
+    }
+    const header = document.getElementById("{{.HtmlId}}_header");
+    const panels = document.getElementById("{{.HtmlId}}_panels");
+    let selected = gonb_comm.newSyncedVariable("{{.Address}}", {{.Value}});
+    function show(index) {
+        for (const tab of header.children) {
+            const isSelected = tab.dataset.index == index;
+            tab.style.fontWeight = isSelected ? "bold" : "normal";
+            tab.style.borderBottom = isSelected ? "2px solid" : "2px solid transparent";
+        }
+        for (const panel of panels.children) {
+            panel.style.display = (panel.dataset.index == index) ? "" : "none";
+        }
+    }
+    header.addEventListener("click", function(event) {
+        const tab = event.target.closest("button");
+        if (!tab || !header.contains(tab)) {
+            return;
+        }
+        selected.set(parseInt(tab.dataset.index));
+    });
+    selected.subscribe((value) => show(value));
+})();
@@ -0,0 +1,214 @@
+package widgets
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/janpfeifer/gonb/gonbui"
+	"github.com/janpfeifer/gonb/gonbui/comms"
+	"github.com/janpfeifer/gonb/gonbui/dom"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+)
+
+//go:embed ticker.js
+var tickerJs []byte
+
+var tmplTickerJs = template.Must(template.New("tickerJs").Parse(
+	string(tickerJs)))
+
+// TickerBuilder is used to create an animation ticker driven by the front-end.
+type TickerBuilder struct {
+	address, htmlId, parentHtmlId string
+	interval                      time.Duration
+	onTick                        []func(tick int)
+	built                         bool
+}
+
+// AnimationTicker returns a builder object that configures and builds a ticker driven by the browser's
+// `requestAnimationFrame`, that sends ticks to the program at most once per interval (or at every frame,
+// if interval is 0).
+//
+// Ticks are only sent while the cell output is visible: when the browser tab is hidden, or the cell is
+// scrolled out of view, the ticks pause -- and so do visualization loops driven by them, saving CPU.
+// The ticker stops when the cell output is cleared, or when the program finishes.
+//
+// The value of each tick is a counter, incremented at every tick. Use OnTick to register callbacks, or
+// Listen to get the ticks in a channel. E.g.:
+//
+//	ticker := widgets.AnimationTicker(50 * time.Millisecond).Done()
+//	for tick := range ticker.Listen().C {
+//		drawFrame(tick)
+//	}
+//
+// Call `Done` method when you finish configuring the TickerBuilder.
+func AnimationTicker(interval time.Duration) *TickerBuilder {
+	return &TickerBuilder{
+		interval: interval,
+		address:  comms.ScopedAddress("/ticker/" + gonbui.UniqueId()),
+		htmlId:   "gonb_ticker_" + gonbui.UniqueId(),
+	}
+}
+
+// WithHtmlId sets the id to use when creating the HTML element in the DOM.
+// If not set, a unique one will be generated, and can be read with HtmlId.
+//
+// This can only be set before call to Done. If called afterward, it panics.
+func (t *TickerBuilder) WithHtmlId(htmlId string) *TickerBuilder {
+	if t.built {
+		panicf("TickerBuilder cannot change parameters after it is built")
+	}
+	t.htmlId = htmlId
+	return t
+}
+
+// WithAddress configures the widget to use the given address to communicate its state
+// with the front-end.
+//
+// The default is to use a randomly created unique address.
+//
+// The address is scoped to the cell execution (see `comms.ScopedAddress`), except if it is prefixed
+// with protocol.PersistentAddressPrefix: use Address to get the address actually used.
+//
+// It panics if called after the widget is built.
+func (t *TickerBuilder) WithAddress(address string) *TickerBuilder {
+	if t.built {
+		panicf("TickerBuilder cannot change parameters after it is built")
+	}
+	t.address = comms.ScopedAddress(address)
+	return t
+}
+
+// AppendTo defines an id of the parent element in the DOM (in the front-end) where to insert the ticker.
+// Ticks are sent only while the parent element is visible: typically, the element where the animation
+// is drawn.
+//
+// If not defined, it will be displayed in the output of the cell.
+//
+// It panics if called after the widget is built.
+func (t *TickerBuilder) AppendTo(parentHtmlId string) *TickerBuilder {
+	if t.built {
+		panicf("TickerBuilder cannot change parameters after it is built")
+	}
+	t.parentHtmlId = parentHtmlId
+	return t
+}
+
+// OnTick registers a callback to be called at each tick, with the tick counter. It can be called before
+// or after the ticker is built with Done.
+//
+// The callback is executed in the cell program's process, and only while the program is running.
+// Calls are serialized: ticks arriving while the callback is still running are dropped.
+func (t *TickerBuilder) OnTick(callback func(tick int)) *TickerBuilder {
+	if t.built {
+		t.subscribeOnTick(callback)
+	} else {
+		t.onTick = append(t.onTick, callback)
+	}
+	return t
+}
+
+func (t *TickerBuilder) subscribeOnTick(callback func(tick int)) {
+	var busy sync.Mutex
+	comms.Subscribe[int](t.address, func(_ string, tick int) {
+		if !busy.TryLock() {
+			return // Drop stale tick.
+		}
+		defer busy.Unlock()
+		callback(tick)
+	})
+}
+
+// runningAddress is the address used to pause and resume the ticker in the front-end.
+func (t *TickerBuilder) runningAddress() string {
+	return t.address + "/running"
+}
+
+// Done builds the HTML element in the frontend and starts the ticker.
+func (t *TickerBuilder) Done() *TickerBuilder {
+	if t.built {
+		panicf("TickerBuilder.Done already called!?")
+	}
+	t.built = true
+	for _, callback := range t.onTick {
+		t.subscribeOnTick(callback)
+	}
+
+	html := fmt.Sprintf(`<span id="%s" style="display: none;"></span>`, t.htmlId)
+	if t.parentHtmlId == "" {
+		gonbui.DisplayHtml(html)
+	} else {
+		dom.Append(t.parentHtmlId, html)
+	}
+
+	dom.TransientJavascript(t.tickerJavascript())
+	return t
+}
+
+// tickerJavascript returns the Javascript that runs the ticker in the front-end.
+func (t *TickerBuilder) tickerJavascript() string {
+	var buf bytes.Buffer
+	data := struct {
+		Address, RunningAddress, CleanupAddress, Scope, HtmlId string
+		IntervalMs                                             int64
+	}{
+		Address:        t.address,
+		RunningAddress: t.runningAddress(),
+		CleanupAddress: protocol.GonbuiCleanupAddress,
+		Scope:          comms.ExecutionScope(),
+		HtmlId:         t.htmlId,
+		IntervalMs:     t.interval.Milliseconds(),
+	}
+	err := tmplTickerJs.Execute(&buf, data)
+	if err != nil {
+		panicf("AnimationTicker template is invalid!? Please report the error to GoNB: %v", err)
+	}
+	return buf.String()
+}
+
+// Pause stops the ticks, until Resume is called.
+//
+// It can only be called after the ticker is created with Done, otherwise it panics.
+func (t *TickerBuilder) Pause() {
+	if !t.built {
+		panicf("TickerBuilder.Pause can only be called after the ticker was created with `Done()` method")
+	}
+	comms.Send(t.runningAddress(), 0)
+}
+
+// Resume the ticks, after Pause was called.
+//
+// It can only be called after the ticker is created with Done, otherwise it panics.
+func (t *TickerBuilder) Resume() {
+	if !t.built {
+		panicf("TickerBuilder.Resume can only be called after the ticker was created with `Done()` method")
+	}
+	comms.Send(t.runningAddress(), 1)
+}
+
+// Listen returns an `AddressChan[int]` (a wrapper for a `chan int`) that receives the tick counter at
+// each tick. It only holds the latest tick (see `AddressChan.LatestOnly`): if the program is slower than
+// the ticker, the stale ticks are dropped.
+//
+// Close the returned channel (`Close()` method) to unsubscribe from these messages and release the resources.
+//
+// It can only be called after the ticker is created with Done, otherwise it panics.
+func (t *TickerBuilder) Listen() *comms.AddressChan[int] {
+	if !t.built {
+		panicf("TickerBuilder.Listen can only be called after the ticker was created with `Done()` method")
+	}
+	return comms.Listen[int](t.address).LatestOnly()
+}
+
+// HtmlId returns the `id` used in the widget HTML element created.
+func (t *TickerBuilder) HtmlId() string {
+	return t.htmlId
+}
+
+// Address returns the address used to communicate to the widgets HTML element.
+func (t *TickerBuilder) Address() string {
+	return t.address
+}
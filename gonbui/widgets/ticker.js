@@ -0,0 +1,55 @@
+(() => {
+    let gonb_comm = globalThis?.gonb_comm;
+    if (!gonb_comm) {
+        console.error("Communication to GoNB not setup, animation ticker will not send ticks to the program.")
+        return;
+    }
+    const anchor = document.getElementById("{{.HtmlId}}");
+    const intervalMs = {{.IntervalMs}};
+    let tick = 0;
+    let lastTickTime = 0;
+    let running = true;
+    let visible = true;
+    let stopped = false;
+
+    // Only tick while the output is visible: requestAnimationFrame already pauses when the tab is hidden,
+    // and the IntersectionObserver tells whether the cell output is scrolled out of view.
+    const observer = new IntersectionObserver((entries) => {
+        visible = entries[entries.length - 1].isIntersecting;
+    });
+    observer.observe(anchor.parentElement);
+    const runningSubscription = gonb_comm.subscribe("{{.RunningAddress}}", (address, value) => {
+        running = value !== 0;
+    });
+
+    // Stop ticking when the program finished: GoNB sends the scope of its execution to "#comms/cleanup".
+    const stop = function() {
+        stopped = true;
+        observer.disconnect();
+        gonb_comm.unsubscribe(runningSubscription);
+        gonb_comm.unsubscribe(cleanupSubscription);
+    };
+    const cleanupSubscription = gonb_comm.subscribe("{{.CleanupAddress}}", (address, scope) => {
+        if (scope === "{{.Scope}}") {
+            stop();
+        }
+    });
+
+    const onFrame = function(timestamp) {
+        if (stopped) {
+            return;
+        }
+        if (!anchor.isConnected) {
+            // Cell output was cleared: stop ticking.
+            stop();
+            return;
+        }
+        if (running && visible && document.visibilityState === "visible" && timestamp - lastTickTime >= intervalMs) {
+            lastTickTime = timestamp;
+            tick++;
+            gonb_comm.send("{{.Address}}", tick);
+        }
+        requestAnimationFrame(onFrame);
+    };
+    requestAnimationFrame(onFrame);
+})();
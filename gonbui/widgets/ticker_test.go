@@ -0,0 +1,24 @@
+package widgets
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/janpfeifer/gonb/gonbui/comms"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTickerJavascript(t *testing.T) {
+	ticker := AnimationTicker(40 * time.Millisecond).WithHtmlId("t").WithAddress("/my_ticker")
+	got := ticker.tickerJavascript()
+	assert.Contains(t, got, `document.getElementById("t")`)
+	assert.Contains(t, got, "const intervalMs = 40;")
+	assert.Contains(t, got, fmt.Sprintf(`gonb_comm.send(%q, tick)`, ticker.Address()))
+	assert.Contains(t, got, fmt.Sprintf(`gonb_comm.subscribe(%q,`, ticker.Address()+"/running"))
+
+	// The animation loop stops when the program finishes.
+	assert.Contains(t, got, `gonb_comm.subscribe("#comms/cleanup",`)
+	assert.Contains(t, got, fmt.Sprintf(`if (scope === %q) {`, comms.ExecutionScope()))
+	assert.Contains(t, got, "gonb_comm.unsubscribe(cleanupSubscription);")
+}
@@ -7,6 +7,27 @@
 // have optional parameters as method calls, and then call `Done()`
 // to actually display and start it.
 //
+// Widgets can be arranged with the layout containers HBox, VBox, Tabs and
+// Accordion: pass the id of the container (or of one of its slots, tabs or
+// sections) to the `AppendTo` method of the widgets placed in it. E.g.:
+//
+//	tabs := widgets.Tabs().Done()
+//	row := widgets.HBox().AppendTo(tabs.AddTab("Settings")).Done()
+//	slider := widgets.Slider(0, 100, 50).AppendTo(row.HtmlId()).Done()
+//	button := widgets.Button("Apply").AppendTo(row.HtmlId()).Done()
+//
+// Use Prompt for a text input box whose submissions are delivered to the program as a channel (or
+// through os.Stdin), without blocking the notebook: the recommended way of getting input in long-running programs.
+//
+// Button.OnClick and KeyBinding (keyboard shortcuts scoped to the cell output) execute Go callbacks in the
+// program, while it is running.
+//
+// Use Bind to keep a Go variable synchronized with the value of a widget (or any
+// address in the front-end), instead of listening to updates.
+//
+// The addresses used by the widgets are scoped to the cell execution (see `comms.ScopedAddress`), so
+// re-running a cell doesn't cross-talk with the widgets of its previous executions.
+//
 // If you want to implement a new widget, checkout `gonb/gonbui/comms`
 // package for the communication functionality, along with tools for
 // building widgets.
@@ -16,7 +16,10 @@ import (
 	"github.com/janpfeifer/gonb/internal/kernel"
 	"github.com/janpfeifer/gonb/internal/websocket"
 	"github.com/pkg/errors"
+	"html"
 	"k8s.io/klog/v2"
+	"os"
+	"path"
 	"strings"
 	"sync"
 	"time"
@@ -60,8 +63,11 @@ type State struct {
 	HeartbeatPongLatch *common.LatchWithValue[bool]
 
 	// AddressSubscriptions by the program being executed. Needs to be reset at every program
-	// execution.
-	AddressSubscriptions common.Set[string]
+	// execution. It holds at most MaxAddressSubscriptions: new subscriptions over it are rejected.
+	AddressSubscriptions *common.LRUSet[string]
+
+	// rejectedSubscriptions counts the subscriptions rejected in the session, to respect MaxAddressSubscriptions.
+	rejectedSubscriptions int
 
 	// ProgramExecutor is a reference to the executor of the user's program (current cell).
 	// It is used to dispatch comms coming from the front-end to the program.
@@ -72,6 +78,53 @@ type State struct {
 	// This is set at the start of every cell execution, and reset to nil when the execution finishes.
 	ProgramExecMsg kernel.Message
 
+	// sendSeq is the sequence number of the last value sent to the front-end. Sequence numbers are never
+	// reset, so the front-end can recognize replayed values after it reconnects.
+	sendSeq int
+
+	// replayBuffer holds the values sent to the front-end (with their "seq") not yet acknowledged, in order.
+	// They are replayed when the connection is re-established. It holds at most ReplayBufferSize values.
+	replayBuffer []sentData
+
+	// recvSeq is the sequence number of the last value received from the front-end in the current
+	// connection, used to drop duplicates.
+	recvSeq int
+
+	// programScope is the prefix of the addresses scoped to the program being executed (see
+	// protocol.ExecAddressScope), cleaned up when it finishes. Empty if the execution count is not known.
+	programScope string
+
+	// throttles configured by the program being executed, per address. Reset at every program execution.
+	throttles map[string]*addressThrottle
+
+	// WidgetModels holds the state of the Jupyter widget (ipywidgets) models opened by the programs, indexed
+	// by their model id (also their "comm_id"). See ProgramWidgetRequest.
+	WidgetModels map[string]map[string]any
+
+	// CellId is the unique id of the last cell executed with named pipes (the "msg_id" of its
+	// "execute_request"). It is used to tag the front-end logs forwarded by the console bridge.
+	CellId string
+
+	// snapshots requested to the front-end (see RequestSnapshot), not yet fulfilled, by their id.
+	snapshots map[string]*snapshotRequest
+
+	// runNeeded are the ids of the `%run_needed` requests (see RequestRunNeeded) not yet reported by the
+	// front-end.
+	runNeeded common.Set[string]
+
+	// ConsoleBridge indicates whether the front-end should forward its console errors and uncaught
+	// exceptions to the kernel log. See SetConsoleBridge.
+	ConsoleBridge bool
+
+	// ScriptNonce, if set, is added as the `nonce` attribute of the scripts injected in the front-end, for
+	// deployments with a Content-Security-Policy that requires it.
+	ScriptNonce string
+
+	// ScriptsDir and ScriptsUrl, if set, are a directory served by Jupyter and its URL: the Javascript that
+	// installs the WebSocket is written there and loaded with `<script src=...>`, instead of being inlined,
+	// for deployments with a Content-Security-Policy that disallows inline scripts.
+	ScriptsDir, ScriptsUrl string
+
 	// LogWebsocket controls whether to turn verbose logging (on the Javascript console) of the
 	// WebSocket Javascript library, when it is installed.
 	LogWebSocket bool
@@ -86,17 +139,41 @@ const (
 
 	// HeartbeatPongAddress is a protocol private message address used as heartbeat reply.
 	HeartbeatPongAddress = "#heartbeat/pong"
+
+	// AckAddress is a protocol private message address used by the front-end to acknowledge the values
+	// received, up to the sequence number given as value.
+	AckAddress = "#comms/ack"
+
+	// ReplayBufferSize is the maximum number of values sent to the front-end, not yet acknowledged, that
+	// are kept to be replayed if the connection is re-established.
+	ReplayBufferSize = 512
+
+	// MaxAddressSubscriptions is the maximum number of addresses a program can be subscribed to: further
+	// subscriptions are rejected, and logged.
+	MaxAddressSubscriptions = 10_000
 )
 
 // New creates and initializes an empty comms.State.
 func New() *State {
 	s := &State{
 		IsWebSocketInstalled: false,
-		AddressSubscriptions: make(common.Set[string]),
+		AddressSubscriptions: common.NewLRUSet[string](MaxAddressSubscriptions),
+		WidgetModels:         make(map[string]map[string]any),
+		throttles:            make(map[string]*addressThrottle),
+		snapshots:            make(map[string]*snapshotRequest),
+		runNeeded:            common.MakeSet[string](),
 	}
 	return s
 }
 
+// SubscriptionsStats returns the number of addresses the program being executed is subscribed to,
+// and how many subscriptions were rejected in the session, to respect MaxAddressSubscriptions.
+func (s *State) SubscriptionsStats() (count, rejected int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.AddressSubscriptions.Len(), s.rejectedSubscriptions
+}
+
 // getFromJson extracts given key (split by "/") in Json parsed `map[string]any`
 // values.
 func getFromJson[T any](values map[string]any, key string) (value T, err error) {
@@ -188,16 +265,20 @@ func (s *State) installWebSocketLocked(msg kernel.Message) error {
 		// InstallWebSocket, and we can simply wait on it.
 		klog.V(1).Infof("comms.State.InstallWebSocket(): running Javascript to install WebSocket...")
 		s.openLatch = common.NewLatch()
-		js := websocket.Javascript(msg.Kernel().JupyterKernelId, s.LogWebSocket)
+		scriptHtml, err := s.webSocketScriptLocked(msg.Kernel().JupyterKernelId)
+		if err != nil {
+			klog.Error("Widgets won't work without a javascript WebSocket connection.")
+			return err
+		}
 		jsData := kernel.Data{
 			Data:      make(kernel.MIMEMap, 1),
 			Metadata:  make(kernel.MIMEMap),
 			Transient: make(kernel.MIMEMap),
 		}
-		jsData.Data[string(protocol.MIMETextHTML)] = fmt.Sprintf("<script>%s</script>", js)
+		jsData.Data[string(protocol.MIMETextHTML)] = scriptHtml
 		s.TransientDisplayId = "gonb_websocket_" + common.UniqueId()
 		jsData.Transient["display_id"] = s.TransientDisplayId
-		err := kernel.PublishUpdateDisplayData(msg, jsData)
+		err = kernel.PublishUpdateDisplayData(msg, jsData)
 		if err != nil {
 			klog.Error("Widgets won't work without a javascript WebSocket connection.")
 			klog.Errorf("Failed to publish javascript to bootstrap GoNB websocket connection: %+v", err)
@@ -231,6 +312,26 @@ func (s *State) installWebSocketLocked(msg kernel.Message) error {
 	return nil
 }
 
+// webSocketScriptLocked returns the `<script>` tag that installs the WebSocket in the front-end.
+//
+// If s.ScriptsDir is set, the Javascript is written to a file there, and the tag loads it from s.ScriptsUrl,
+// otherwise it's inlined. If s.ScriptNonce is set, it is added to the tag.
+func (s *State) webSocketScriptLocked(jupyterKernelId string) (string, error) {
+	js := websocket.Javascript(jupyterKernelId, s.LogWebSocket)
+	var nonceAttr string
+	if s.ScriptNonce != "" {
+		nonceAttr = fmt.Sprintf(" nonce=\"%s\"", html.EscapeString(s.ScriptNonce))
+	}
+	if s.ScriptsDir == "" {
+		return fmt.Sprintf("<script%s>%s</script>", nonceAttr, js), nil
+	}
+	fileName := fmt.Sprintf("gonb_comm_%s.js", jupyterKernelId)
+	if err := os.WriteFile(path.Join(s.ScriptsDir, fileName), []byte(js), 0644); err != nil {
+		return "", errors.Wrapf(err, "failed to write the WebSocket Javascript to %q", s.ScriptsDir)
+	}
+	return fmt.Sprintf("<script src=\"%s\"%s></script>", html.EscapeString(path.Join(s.ScriptsUrl, fileName)), nonceAttr), nil
+}
+
 // HandleOpen message, with `msg_type` set to "comm_open".
 //
 // If message is incomplete, or apparently not addressed to us, it returns
@@ -278,6 +379,9 @@ func (s *State) HandleOpen(msg kernel.Message) (err error) {
 		return nil
 	}
 
+	// Sequence number of the last value received by the front-end, if it is reconnecting.
+	lastSeq, _ := getFromJson[float64](content, "data/last_seq")
+
 	if s.Opened {
 		// Close the previous connection if it is still open.
 		err = s.closeLocked(msg)
@@ -299,12 +403,18 @@ func (s *State) HandleOpen(msg kernel.Message) (err error) {
 		err = nil
 	}
 
-	// Mark comms opened.
+	// Mark comms opened: the acknowledgment carries the sequence number the front-end should expect next
+	// (minus one), followed by the replay of the values it missed.
 	s.CommId = commId
 	s.LastMsgTime = time.Now()
+	s.ackLocked(int(lastSeq))
+	baseSeq := s.sendSeq
+	if len(s.replayBuffer) > 0 {
+		baseSeq = s.replayBuffer[0].seq - 1
+	}
 	err = s.sendDataLocked(msg, map[string]any{
 		"address": CommOpenAckAddress,
-		"value":   true,
+		"value":   baseSeq,
 	})
 	if err != nil {
 		klog.Warningf("Failed to acknowledge open connection to front-end, likely widgets won't work!")
@@ -312,6 +422,16 @@ func (s *State) HandleOpen(msg kernel.Message) (err error) {
 		return
 	}
 	s.Opened = true
+	s.recvSeq = 0
+	s.replayLocked(msg)
+	if s.ConsoleBridge {
+		if err := s.sendConsoleBridgeLocked(msg); err != nil {
+			klog.Warningf("comms: failed to enable console bridge in the front-end: %+v", err)
+		}
+	}
+
+	// Let the program know, in case it needs to restore the state of the front-end (e.g.: if the browser reloaded).
+	s.deliverProgramSubscriptionsLocked(protocol.GonbuiOpenedAddress, 1)
 	return nil
 }
 
@@ -334,6 +454,9 @@ func (s *State) HandleMsg(msg kernel.Message) (err error) {
 		klog.Warningf("comms: ignored comm_msg, \"comm_id\" not set: %+v", err)
 		return nil
 	}
+	if _, found := s.WidgetModels[commId]; found {
+		return s.handleWidgetMsgLocked(msg, commId, content)
+	}
 	if commId != s.CommId {
 		klog.Warningf("comms: ignored comm_msg, \"comm_id\" (%q) different than the one we established the connection (%q)",
 			commId, s.CommId)
@@ -351,19 +474,58 @@ func (s *State) HandleMsg(msg kernel.Message) (err error) {
 		return nil
 	}
 	klog.V(2).Infof("comms: HandleMsg(address=%q)", address)
+	if seq, err := getFromJson[float64](content, "data/seq"); err == nil {
+		if int(seq) <= s.recvSeq {
+			klog.V(1).Infof("comms: HandleMsg(address=%q) dropped duplicate message (seq=%d)", address, int(seq))
+			return nil
+		}
+		if int(seq) > s.recvSeq+1 {
+			klog.Warningf("comms: %d message(s) from the front-end lost before seq=%d", int(seq)-s.recvSeq-1, int(seq))
+		}
+		s.recvSeq = int(seq)
+	}
 
+	if strings.HasPrefix(address, SnapshotAddressPrefix) {
+		s.handleSnapshotLocked(msg, address, content)
+		return nil
+	}
+	if strings.HasPrefix(address, RunNeededAddressPrefix) {
+		s.handleRunNeededLocked(msg, address, content)
+		return nil
+	}
 	switch address {
 	case HeartbeatPongAddress:
 		return s.handleHeartbeatPongLocked(msg)
 	case HeartbeatPingAddress:
 		return s.handleHeartbeatPingLocked(msg)
-	default:
-		var value any
-		value, err = getFromJson[any](content, "data/value")
+	case AckAddress:
+		ack, err := getFromJson[float64](content, "data/value")
 		if err != nil {
-			klog.Warningf("comms: comm_msg did not set an \"content/data/value\" field: %+v", err)
+			klog.Warningf("comms: ack did not set a numeric \"content/data/value\" field: %+v", err)
 			return nil
 		}
+		s.ackLocked(int(ack))
+		return nil
+	case ConsoleLogAddress:
+		s.handleConsoleLogLocked(content)
+		return nil
+	default:
+		var value any
+		if binary, _ := getFromJson[bool](content, "data/binary"); binary {
+			// Value sent as a binary buffer.
+			buffers := msg.ComposedMsg().Buffers
+			if len(buffers) == 0 {
+				klog.Warningf("comms: binary comm_msg to address %q without a buffer", address)
+				return nil
+			}
+			value = buffers[0]
+		} else {
+			value, err = getFromJson[any](content, "data/value")
+			if err != nil {
+				klog.Warningf("comms: comm_msg did not set an \"content/data/value\" field: %+v", err)
+				return nil
+			}
+		}
 		if s.deliverProgramSubscriptionsLocked(address, value) {
 			klog.V(2).Infof("comms: HandleMsg(address=%q) delivered", address)
 		} else {
@@ -403,28 +565,83 @@ func (s *State) closeLocked(msg kernel.Message) error {
 
 // Send value to the given address in the front-end.
 // This, along with subscribe, is the basic communication operation with the front-end.
-// The value will be converted to JSON before being sent.
+// The value will be converted to JSON before being sent, except if it is a `[]byte`, in which case
+// it is sent as a binary buffer.
 func (s *State) Send(msg kernel.Message, address string, value any) error {
+	if blob, ok := value.([]byte); ok {
+		return s.sendData(msg, map[string]any{
+			"address": address,
+			"binary":  true,
+		}, blob)
+	}
 	return s.sendData(msg, map[string]any{
 		"address": address,
 		"value":   value,
 	})
 }
 
-// sendData using "comm_msg" message type.
-func (s *State) sendData(msg kernel.Message, data map[string]any) error {
+// sentData is a message sent to the front-end, kept until it is acknowledged.
+type sentData struct {
+	seq     int
+	data    map[string]any
+	buffers [][]byte
+}
+
+// sendData using "comm_msg" message type, optionally followed by binary buffers.
+// The data is given a sequence number ("seq") and kept in the replay buffer until the front-end acknowledges it.
+func (s *State) sendData(msg kernel.Message, data map[string]any, buffers ...[]byte) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.sendDataLocked(msg, data)
+	s.sendSeq++
+	data["seq"] = s.sendSeq
+	s.bufferLocked(sentData{seq: s.sendSeq, data: data, buffers: buffers})
+	return s.sendDataLocked(msg, data, buffers...)
+}
+
+// bufferLocked appends the data sent to the replay buffer, dropping the oldest entry if it is full.
+func (s *State) bufferLocked(sent sentData) {
+	if len(s.replayBuffer) >= ReplayBufferSize {
+		klog.V(1).Infof("comms: replay buffer full, dropping unacknowledged message (seq=%d)", s.replayBuffer[0].seq)
+		s.replayBuffer = s.replayBuffer[1:]
+	}
+	s.replayBuffer = append(s.replayBuffer, sent)
+}
+
+// ackLocked drops from the replay buffer the data acknowledged by the front-end, up to the sequence number seq.
+func (s *State) ackLocked(seq int) {
+	idx := 0
+	for idx < len(s.replayBuffer) && s.replayBuffer[idx].seq <= seq {
+		idx++
+	}
+	s.replayBuffer = s.replayBuffer[idx:]
+	klog.V(2).Infof("comms: front-end acknowledged seq=%d, %d message(s) not yet acknowledged", seq, len(s.replayBuffer))
 }
 
-// sendDataLocked is like sendData, but assumed lock is already acquired.
-func (s *State) sendDataLocked(msg kernel.Message, data map[string]any) error {
+// replayLocked sends again the data not acknowledged by the front-end. It's used when the connection
+// is re-established.
+func (s *State) replayLocked(msg kernel.Message) {
+	if len(s.replayBuffer) == 0 {
+		return
+	}
+	klog.V(1).Infof("comms: replaying %d message(s) not acknowledged by the front-end", len(s.replayBuffer))
+	for _, sent := range s.replayBuffer {
+		if err := s.sendDataLocked(msg, sent.data, sent.buffers...); err != nil {
+			klog.Warningf("comms: failed to replay message (seq=%d) to front-end: %+v", sent.seq, err)
+			return
+		}
+	}
+}
+
+// sendDataLocked is like sendData, but assumed lock is already acquired, and it doesn't use a sequence number.
+func (s *State) sendDataLocked(msg kernel.Message, data map[string]any, buffers ...[]byte) error {
 	content := map[string]any{
 		"comm_id": s.CommId,
 		"data":    data,
 	}
-	klog.V(2).Infof("comms: sendData %+v", content)
+	klog.V(2).Infof("comms: sendData %+v (%d buffers)", content, len(buffers))
+	if len(buffers) > 0 {
+		return msg.PublishWithBuffers("comm_msg", content, buffers)
+	}
 	return msg.Publish("comm_msg", content)
 	//return msg.Reply("comm_msg", content)
 }
@@ -0,0 +1,81 @@
+package comms
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayBuffer(t *testing.T) {
+	s := New()
+	for ii := 0; ii < ReplayBufferSize+10; ii++ {
+		s.sendSeq++
+		s.bufferLocked(sentData{seq: s.sendSeq, data: map[string]any{"address": "/x", "value": ii, "seq": s.sendSeq}})
+	}
+	// Oldest messages are dropped when the buffer is full.
+	assert.Len(t, s.replayBuffer, ReplayBufferSize)
+	assert.Equal(t, 11, s.replayBuffer[0].seq)
+
+	s.ackLocked(20)
+	assert.Len(t, s.replayBuffer, ReplayBufferSize+10-20)
+	assert.Equal(t, 21, s.replayBuffer[0].seq)
+
+	// Acknowledging old messages is a no-op.
+	s.ackLocked(5)
+	assert.Equal(t, 21, s.replayBuffer[0].seq)
+
+	s.ackLocked(s.sendSeq)
+	assert.Empty(t, s.replayBuffer)
+}
+
+func TestCleanupScope(t *testing.T) {
+	s := New()
+	for ii, address := range []string{"/exec/3/slider", "/persistent/x", "/exec/31/slider", "/exec/3/button"} {
+		s.bufferLocked(sentData{seq: ii + 1, data: map[string]any{"address": address, "value": ii, "seq": ii + 1}})
+	}
+	s.programScope = protocol.ExecAddressScope(3)
+	s.ProgramFinished()
+	require.Len(t, s.replayBuffer, 2)
+	assert.Equal(t, "/persistent/x", s.replayBuffer[0].data["address"])
+	assert.Equal(t, "/exec/31/slider", s.replayBuffer[1].data["address"])
+	assert.Empty(t, s.programScope)
+}
+
+func TestWebSocketScript(t *testing.T) {
+	s := New()
+	s.ScriptNonce = "abc"
+	script, err := s.webSocketScriptLocked("kernel_id")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(script, `<script nonce="abc">`))
+	assert.Contains(t, script, "kernel_id")
+
+	// Javascript served from a file.
+	s.ScriptsDir, s.ScriptsUrl = t.TempDir(), "/files/gonb"
+	script, err = s.webSocketScriptLocked("kernel_id")
+	require.NoError(t, err)
+	assert.Equal(t, `<script src="/files/gonb/gonb_comm_kernel_id.js" nonce="abc"></script>`, script)
+	js, err := os.ReadFile(path.Join(s.ScriptsDir, "gonb_comm_kernel_id.js"))
+	require.NoError(t, err)
+	assert.Contains(t, string(js), "kernel_id")
+}
+
+func TestAddSubscriptionCap(t *testing.T) {
+	s := New()
+	for ii := range MaxAddressSubscriptions {
+		require.True(t, s.addSubscription(fmt.Sprintf("/address/%d", ii)))
+	}
+	// Subscribing again to an address is fine, but new ones are rejected: live subscriptions are not evicted.
+	assert.True(t, s.addSubscription("/address/0"))
+	assert.False(t, s.addSubscription("/one_too_many"))
+	assert.False(t, s.AddressSubscriptions.Has("/one_too_many"))
+	assert.True(t, s.AddressSubscriptions.Has("/address/1"))
+	count, rejected := s.SubscriptionsStats()
+	assert.Equal(t, MaxAddressSubscriptions, count)
+	assert.Equal(t, 1, rejected)
+}
@@ -0,0 +1,67 @@
+package comms
+
+import (
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the "console bridge": an opt-in mode (`%widgets_console`) where the front-end
+// forwards `console.error` calls and uncaught Javascript exceptions to the kernel, which logs them.
+// It allows debugging of widgets and WASM programs without opening the browser developer tools.
+
+const (
+	// ConsoleAddress is a protocol private message address used to enable or disable (with a bool value)
+	// the console bridge in the front-end.
+	ConsoleAddress = "#comms/console"
+
+	// ConsoleLogAddress is a protocol private message address used by the front-end to forward
+	// console errors to the kernel.
+	ConsoleLogAddress = "#comms/console/log"
+)
+
+// SetConsoleBridge enables or disables the forwarding of the front-end console errors and uncaught
+// exceptions to the kernel log.
+//
+// When enabling it, the WebSocket is installed in the front-end, if not yet installed.
+// The setting is kept, and sent again to the front-end if the connection is re-established.
+func (s *State) SetConsoleBridge(msg kernel.Message, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ConsoleBridge = enabled
+	if enabled {
+		if err := s.installWebSocketLocked(msg); err != nil {
+			return err
+		}
+	}
+	if !s.Opened {
+		return nil
+	}
+	return s.sendConsoleBridgeLocked(msg)
+}
+
+// sendConsoleBridgeLocked sends the console bridge setting to the front-end.
+func (s *State) sendConsoleBridgeLocked(msg kernel.Message) error {
+	return s.sendDataLocked(msg, map[string]any{
+		"address": ConsoleAddress,
+		"value":   s.ConsoleBridge,
+	})
+}
+
+// handleConsoleLogLocked logs a console message forwarded by the front-end, tagged with the id of the
+// last cell executed.
+func (s *State) handleConsoleLogLocked(content map[string]any) {
+	if !s.ConsoleBridge {
+		return
+	}
+	level, _ := getFromJson[string](content, "data/value/level")
+	message, err := getFromJson[string](content, "data/value/message")
+	if err != nil {
+		klog.Warningf("comms: console log did not set a \"content/data/value/message\" field: %+v", err)
+		return
+	}
+	klog.Errorf("front-end console %s (cell %s): %s", level, s.CellId, message)
+	if stack, _ := getFromJson[string](content, "data/value/stack"); stack != "" {
+		klog.Errorf("front-end console stack (cell %s):\n%s", s.CellId, stack)
+	}
+}
@@ -0,0 +1,219 @@
+package comms
+
+import (
+	"maps"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the kernel side of the Jupyter widget messaging protocol, used by the stock
+// Jupyter widgets (ipywidgets) -- see the `gonbui/ipywidgets` package.
+//
+// Contrary to GoNB's own widgets, these don't require the WebSocket installed by InstallWebSocket: the
+// models are opened with a "comm_open" message with the "jupyter.widget" target, and the widget manager
+// of the front-end (JupyterLab, Notebook, VSCode) renders them.
+//
+// See https://github.com/jupyter-widgets/ipywidgets/blob/main/packages/schema/messages.md
+
+const (
+	// JupyterWidgetTarget is the "target_name" of the comms used by Jupyter widgets.
+	JupyterWidgetTarget = "jupyter.widget"
+
+	// JupyterWidgetProtocolVersion is the version of the Jupyter widget messaging protocol implemented.
+	JupyterWidgetProtocolVersion = "2.1.0"
+
+	// JupyterWidgetViewMIMEType is the MIME type used to display the view of a Jupyter widget model.
+	JupyterWidgetViewMIMEType = "application/vnd.jupyter.widget-view+json"
+)
+
+// ProgramWidgetRequest handler, it implements jpyexec.CommsHandler.
+// It opens, updates or closes a Jupyter widget model in the front-end, and optionally displays it.
+//
+// The state of the models is kept in State.WidgetModels, so it can be sent to the front-end on request.
+func (s *State) ProgramWidgetRequest(req *protocol.JupyterWidgetRequest) {
+	// Notice the program may end while handling this request, so we save the value
+	// of the msg that will be used to complete the request, even if the program ends.
+	msg := s.ProgramExecMsg
+	if msg == nil {
+		klog.Infof("Failed to communicate with front-end. This seems to be a logic bug in "+
+			"the program, where comms.State.ProgramStart() was not called before a request to "+
+			"communication was made (Jupyter widget model=%q)", req.ModelId)
+		return
+	}
+	if klog.V(2).Enabled() {
+		klog.Infof("comms: WidgetRequest: %+v", req)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.widgetRequestLocked(msg, req)
+	if err != nil {
+		klog.Infof("Failed to handle request for Jupyter widget model %q -- widgets may mal-function. "+
+			"Error message: %+v", req.ModelId, err)
+	}
+}
+
+// widgetRequestLocked implements ProgramWidgetRequest, but assumes `s.mu` lock is already acquired.
+func (s *State) widgetRequestLocked(msg kernel.Message, req *protocol.JupyterWidgetRequest) error {
+	modelId := req.ModelId
+	switch {
+	case req.Close:
+		if _, found := s.WidgetModels[modelId]; !found {
+			return nil
+		}
+		delete(s.WidgetModels, modelId)
+		return msg.Publish("comm_close", map[string]any{
+			"comm_id": modelId,
+			"data":    map[string]any{},
+		})
+
+	case req.Open:
+		state := maps.Clone(req.State)
+		if state == nil {
+			state = make(map[string]any)
+		}
+		s.WidgetModels[modelId] = state
+		content := map[string]any{
+			"comm_id":     modelId,
+			"target_name": JupyterWidgetTarget,
+			"data": map[string]any{
+				"state":        state,
+				"buffer_paths": []string{},
+			},
+		}
+		err := msg.PublishWithMetadata("comm_open", content, map[string]any{"version": JupyterWidgetProtocolVersion})
+		if err != nil {
+			return errors.WithMessagef(err, "failed to open Jupyter widget model %q", modelId)
+		}
+
+	default:
+		state, found := s.WidgetModels[modelId]
+		if !found {
+			return errors.Errorf("Jupyter widget model %q updated before it was opened", modelId)
+		}
+		maps.Copy(state, req.State)
+		if err := s.sendWidgetStateLocked(msg, modelId, req.State); err != nil {
+			return err
+		}
+	}
+
+	if req.Display {
+		err := kernel.PublishDisplayData(msg, kernel.Data{
+			Data: kernel.MIMEMap{
+				JupyterWidgetViewMIMEType: map[string]any{
+					"model_id":      modelId,
+					"version_major": 2,
+					"version_minor": 0,
+				},
+				string(protocol.MIMETextPlain): "Jupyter widget, it requires a front-end with ipywidgets support.",
+			},
+			Metadata:  make(kernel.MIMEMap),
+			Transient: make(kernel.MIMEMap),
+		})
+		if err != nil {
+			return errors.WithMessagef(err, "failed to display Jupyter widget model %q", modelId)
+		}
+	}
+	return nil
+}
+
+// sendWidgetStateLocked sends an "update" of the state of a Jupyter widget model to the front-end.
+func (s *State) sendWidgetStateLocked(msg kernel.Message, modelId string, state map[string]any) error {
+	content := map[string]any{
+		"comm_id": modelId,
+		"data": map[string]any{
+			"method":       "update",
+			"state":        state,
+			"buffer_paths": []string{},
+		},
+	}
+	err := msg.Publish("comm_msg", content)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to update Jupyter widget model %q", modelId)
+	}
+	return nil
+}
+
+// handleWidgetMsgLocked handles a "comm_msg" from the front-end addressed to a Jupyter widget model.
+//
+// Updates of the state and custom messages (e.g.: button clicks) are delivered to the program, if it is
+// subscribed to the model address, as a `map[string]any` with the "method" and the "state" or "content".
+func (s *State) handleWidgetMsgLocked(msg kernel.Message, modelId string, content map[string]any) error {
+	method, err := getFromJson[string](content, "data/method")
+	if err != nil {
+		klog.Warningf("comms: Jupyter widget comm_msg did not set a \"content/data/method\" field: %+v", err)
+		return nil
+	}
+	klog.V(2).Infof("comms: HandleMsg(jupyter widget=%q, method=%q)", modelId, method)
+	address := protocol.JupyterWidgetAddressPrefix + modelId
+	switch method {
+	case "update":
+		var state map[string]any
+		state, err = getFromJson[map[string]any](content, "data/state")
+		if err != nil {
+			klog.Warningf("comms: Jupyter widget update did not set a \"content/data/state\" field: %+v", err)
+			return nil
+		}
+		maps.Copy(s.WidgetModels[modelId], state)
+		s.deliverProgramSubscriptionsLocked(address, map[string]any{"method": method, "state": state})
+	case "request_state":
+		return s.sendWidgetStateLocked(msg, modelId, s.WidgetModels[modelId])
+	case "custom":
+		var custom map[string]any
+		custom, err = getFromJson[map[string]any](content, "data/content")
+		if err != nil {
+			klog.Warningf("comms: Jupyter widget custom message did not set a \"content/data/content\" field: %+v", err)
+			return nil
+		}
+		s.deliverProgramSubscriptionsLocked(address, map[string]any{"method": method, "content": custom})
+	default:
+		klog.V(1).Infof("comms: Jupyter widget message with method %q ignored", method)
+	}
+	return nil
+}
+
+// HandleClose is called by the dispatcher whenever a `comm_close` arrives from the front-end.
+// It forgets about the Jupyter widget model closed, if any.
+func (s *State) HandleClose(msg kernel.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, ok := msg.ComposedMsg().Content.(map[string]any)
+	if !ok {
+		klog.Warningf("comms: ignored comm_close, no content in msg %+v", msg.ComposedMsg())
+		return nil
+	}
+	commId, err := getFromJson[string](content, "comm_id")
+	if err != nil {
+		klog.Warningf("comms: ignored comm_close, \"comm_id\" not set: %+v", err)
+		return nil
+	}
+	if _, found := s.WidgetModels[commId]; found {
+		delete(s.WidgetModels, commId)
+		return nil
+	}
+	klog.Warningf("\"comm_close\" received for comm_id %q, but not implemented -- likely there is no impact.", commId)
+	return nil
+}
+
+// CommInfo returns the comms currently opened, in the format of kernel.CommInfoReply: it maps comm_id to
+// a map with its "target_name".
+// If targetName is not empty, only comms with that target are returned.
+func (s *State) CommInfo(targetName string) map[string]map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comms := make(map[string]map[string]string)
+	if s.Opened && (targetName == "" || targetName == "gonb_comm") {
+		comms[s.CommId] = map[string]string{"target_name": "gonb_comm"}
+	}
+	if targetName == "" || targetName == JupyterWidgetTarget {
+		for modelId := range s.WidgetModels {
+			comms[modelId] = map[string]string{"target_name": JupyterWidgetTarget}
+		}
+	}
+	return comms
+}
@@ -5,6 +5,8 @@ import (
 	"github.com/janpfeifer/gonb/gonbui/protocol"
 	"github.com/janpfeifer/gonb/internal/jpyexec"
 	"k8s.io/klog/v2"
+	"slices"
+	"strings"
 )
 
 // This file handles the communication with the named pipes created by jpyexec package.
@@ -20,9 +22,17 @@ func (s *State) ProgramStart(exec *jpyexec.Executor) {
 	defer s.mu.Unlock()
 
 	klog.V(2).Infof("comms: ProgramStart()")
-	s.AddressSubscriptions = make(common.Set[string])
+	s.AddressSubscriptions = common.NewLRUSet[string](MaxAddressSubscriptions)
+	s.resetThrottlesLocked()
 	s.ProgramExecutor = exec
 	s.ProgramExecMsg = exec.Msg
+	s.programScope = ""
+	if count := exec.CellExecutionCount(); count >= 0 {
+		s.programScope = protocol.ExecAddressScope(count)
+	}
+	if exec.Msg != nil {
+		s.CellId = exec.Msg.ComposedMsg().Header.MsgID
+	}
 }
 
 // ProgramFinished is called when the program (cell execution) finishes.
@@ -31,11 +41,38 @@ func (s *State) ProgramFinished() {
 	defer s.mu.Unlock()
 
 	klog.V(2).Infof("comms: ProgramFinished()")
-	s.AddressSubscriptions = make(common.Set[string])
+	s.AddressSubscriptions = common.NewLRUSet[string](MaxAddressSubscriptions)
+	s.resetThrottlesLocked()
+	s.cleanupScopeLocked()
 	s.ProgramExecMsg = nil
 	s.ProgramExecutor = nil
 }
 
+// cleanupScopeLocked drops the values to the addresses scoped to the program that finished, not yet
+// acknowledged by the front-end (so they are not replayed), and asks the front-end to remove the
+// subscriptions to them.
+func (s *State) cleanupScopeLocked() {
+	scope := s.programScope
+	s.programScope = ""
+	if scope == "" {
+		return
+	}
+	s.replayBuffer = slices.DeleteFunc(s.replayBuffer, func(sent sentData) bool {
+		address, _ := sent.data["address"].(string)
+		return strings.HasPrefix(address, scope)
+	})
+	if !s.Opened || s.ProgramExecMsg == nil {
+		return
+	}
+	err := s.sendDataLocked(s.ProgramExecMsg, map[string]any{
+		"address": protocol.GonbuiCleanupAddress,
+		"value":   scope,
+	})
+	if err != nil {
+		klog.Warningf("comms: failed to clean up addresses %q in the front-end: %+v", scope, err)
+	}
+}
+
 // ProgramSendValueRequest handler, it implements jpyexec.CommsHandler.
 // It sends a value to the front-end.
 //
@@ -114,6 +151,22 @@ func (s *State) ProgramReadValueRequest(address string) {
 	}
 }
 
+// addSubscription adds the address to the program subscriptions. If the program is already subscribed to
+// MaxAddressSubscriptions addresses, the new subscription is rejected (and logged), and it returns false.
+// Only called by the goroutine polling the program's named pipe.
+func (s *State) addSubscription(address string) bool {
+	if !s.AddressSubscriptions.Has(address) && s.AddressSubscriptions.Len() >= MaxAddressSubscriptions {
+		s.mu.Lock()
+		s.rejectedSubscriptions++
+		s.mu.Unlock()
+		klog.Warningf("comms: program is already subscribed to %d addresses, the subscription to %q was rejected",
+			MaxAddressSubscriptions, address)
+		return false
+	}
+	s.AddressSubscriptions.Insert(address)
+	return true
+}
+
 // ProgramSubscribeRequest handler, it implements jpyexec.CommsHandler.
 // It subscribes the program to receive updates on the given address.
 //
@@ -131,7 +184,13 @@ func (s *State) ProgramSubscribeRequest(address string) {
 	if klog.V(2).Enabled() {
 		klog.Infof("comms: SubscribeRequest: address=%q", address)
 	}
-	s.AddressSubscriptions.Insert(address)
+	if !s.addSubscription(address) {
+		return
+	}
+	if strings.HasPrefix(address, protocol.JupyterWidgetAddressPrefix) {
+		// Jupyter widgets use the front-end widget manager, they don't need the WebSocket.
+		return
+	}
 
 	err := s.InstallWebSocket(msg)
 	if err != nil {
@@ -164,6 +223,9 @@ func (s *State) ProgramUnsubscribeRequest(address string) {
 // deliverProgramSubscriptionsLocked handles an incoming "comm_msg" (from the front-end), and,
 // if the user's program (cell execution) is subscribed, delivers it to the program.
 //
+// If the address is throttled (see ProgramThrottleRequest), the delivery may be delayed, and
+// consecutive values coalesced.
+//
 // It returns true if the message was sent to program, false if program is not subscribed, and
 // the message is ignored.
 func (s *State) deliverProgramSubscriptionsLocked(address string, value any) bool {
@@ -171,7 +233,19 @@ func (s *State) deliverProgramSubscriptionsLocked(address string, value any) boo
 		klog.V(2).Infof("comms: deliverProgramSubscriptionsLocked(%q, %v) dropped", address, value)
 		return false
 	}
+	if t, found := s.throttles[address]; found {
+		s.throttleLocked(address, t, value)
+		return true
+	}
+	s.deliverLocked(address, value)
+	return true
+}
 
+// deliverLocked sends the value to the program, without checking for subscriptions or throttling.
+func (s *State) deliverLocked(address string, value any) {
+	if s.ProgramExecutor == nil {
+		return
+	}
 	valueMsg := &protocol.CommValue{
 		Address: address,
 		Value:   value,
@@ -182,5 +256,4 @@ func (s *State) deliverProgramSubscriptionsLocked(address string, value any) boo
 	default:
 		klog.V(1).Infof("comms: deliverProgramSubscriptionsLocked(%q, %v) dropped because buffer is full", address, value)
 	}
-	return true
 }
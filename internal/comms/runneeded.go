@@ -0,0 +1,116 @@
+package comms
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements `%run_needed`: the front-end finds the cells labeled (`%label`) with the labels required
+// (`%requires`) that haven't run in the session, along with their own requirements, and executes them in
+// topological order. It sends back a report, displayed in the cell output.
+
+// RunNeededAddressPrefix is the prefix of the protocol private message address used by the front-end to send
+// back the report of `%run_needed`, followed by the id of the request.
+const RunNeededAddressPrefix = "#comms/run_needed/"
+
+// RunNeededTimeout is how long to wait for the front-end to report the cells it executed.
+var RunNeededTimeout = 30 * time.Second
+
+//go:embed runneeded.js
+var runNeededJs string
+
+var tmplRunNeededJs = template.Must(template.New("runNeededJs").Parse(runNeededJs))
+
+// RequestRunNeeded asks the front-end to execute the cells labeled with the required labels, and recursively
+// their own requirements, skipping the labels in done (those that already ran in the session).
+// If required is empty, the requirements of the current cell are used, or if it has none, those of all
+// the cells of the notebook.
+//
+// It installs the WebSocket in the front-end, if not yet installed. The cells are executed after the current
+// one, and a report is displayed in the cell output when the front-end queued them.
+func (s *State) RequestRunNeeded(msg kernel.Message, required, done []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.installWebSocketLocked(msg); err != nil {
+		return err
+	}
+	id := common.UniqueId()
+	displayId := "gonb_run_needed_" + id
+	s.runNeeded.Insert(id)
+	time.AfterFunc(RunNeededTimeout, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.runNeeded.Has(id) {
+			s.runNeeded.Delete(id)
+			klog.Warningf("%%run_needed timed out: front-end didn't reply in %s", RunNeededTimeout)
+		}
+	})
+
+	if required == nil {
+		required = []string{}
+	}
+	if done == nil {
+		done = []string{}
+	}
+	requiredJson, _ := json.Marshal(required)
+	doneJson, _ := json.Marshal(done)
+	var js bytes.Buffer
+	err := tmplRunNeededJs.Execute(&js, struct {
+		Address, MarkerId, Required, Done string
+	}{
+		Address:  RunNeededAddressPrefix + id,
+		MarkerId: displayId,
+		Required: string(requiredJson),
+		Done:     string(doneJson),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to execute %%run_needed Javascript template")
+	}
+	var nonceAttr string
+	if s.ScriptNonce != "" {
+		nonceAttr = fmt.Sprintf(" nonce=\"%s\"", html.EscapeString(s.ScriptNonce))
+	}
+	return kernel.PublishUpdateDisplayData(msg, kernel.Data{
+		Data: kernel.MIMEMap{
+			string(protocol.MIMETextHTML): fmt.Sprintf(`<div id="%s"></div><script%s>%s</script>`,
+				displayId, nonceAttr, js.String()),
+		},
+		Metadata:  make(kernel.MIMEMap),
+		Transient: kernel.MIMEMap{"display_id": displayId},
+	})
+}
+
+// handleRunNeededLocked displays the report of `%run_needed` sent by the front-end.
+func (s *State) handleRunNeededLocked(msg kernel.Message, address string, content map[string]any) {
+	id := strings.TrimPrefix(address, RunNeededAddressPrefix)
+	if !s.runNeeded.Has(id) {
+		klog.V(1).Infof("comms: %%run_needed %q not requested (or timed out), ignored", id)
+		return
+	}
+	s.runNeeded.Delete(id)
+	report, err := getFromJson[string](content, "data/value")
+	if err != nil {
+		klog.Warningf("comms: %%run_needed report is not a string: %+v", err)
+		return
+	}
+	err = kernel.PublishUpdateDisplayData(msg, kernel.Data{
+		Data:      kernel.MIMEMap{string(protocol.MIMETextPlain): report},
+		Metadata:  make(kernel.MIMEMap),
+		Transient: kernel.MIMEMap{"display_id": "gonb_run_needed_" + id},
+	})
+	if err != nil {
+		klog.Errorf("%%run_needed: failed to report result: %+v", err)
+	}
+}
@@ -0,0 +1,129 @@
+(() => {
+    const address = "{{.Address}}";
+    const marker = document.getElementById("{{.MarkerId}}");
+    const gonb_comm = globalThis?.gonb_comm;
+    if (!marker || !gonb_comm) {
+        console.error("GoNB %run_needed: communication to GoNB not setup.");
+        return;
+    }
+    const required = {{.Required}};
+    const done = new Set({{.Done}});
+
+    // parseCell returns the labels and the requirements declared in the source of a cell.
+    function parseCell(source) {
+        const labels = [], requires = [];
+        for (let line of source.split("\n")) {
+            line = line.trim().replace(/^\/\/gonb:/, "");
+            const match = line.match(/^%%?(label|requires)\s+(.*)$/);
+            if (match) {
+                const names = match[2].split(/\s+/).filter((name) => name !== "");
+                (match[1] === "label" ? labels : requires).push(...names);
+            }
+        }
+        return {labels, requires};
+    }
+
+    // notebookApi returns the cells of the notebook and a function to execute them, using the classic Notebook
+    // API (`Jupyter.notebook`), or the JupyterLab / Notebook v7 application, if it is exposed (`jupyterapp`).
+    // It returns null if neither is available.
+    function notebookApi() {
+        const classic = globalThis.Jupyter?.notebook;
+        if (classic) {
+            const cells = classic.get_cells();
+            const current = cells.findIndex((cell) => cell.element[0].contains(marker));
+            return {
+                cells: cells.map((cell) => ({isCode: cell.cell_type === "code", source: cell.get_text()})),
+                current: current,
+                run: (indices) => {
+                    classic.execute_cells(indices);
+                    if (current >= 0) {
+                        classic.select(current);
+                    }
+                },
+            };
+        }
+        const app = globalThis.jupyterapp;
+        const panel = app ? Array.from(app.shell.widgets("main")).find((w) => w.node.contains(marker)) : null;
+        const notebook = panel?.content;
+        if (notebook?.widgets) {
+            const current = notebook.widgets.findIndex((cell) => cell.node.contains(marker));
+            return {
+                cells: notebook.widgets.map((cell) => ({
+                    isCode: cell.model.type === "code",
+                    source: cell.model.sharedModel.getSource(),
+                })),
+                current: current,
+                run: (indices) => {
+                    // Commands read the active cell synchronously: the executions are queued in order.
+                    for (const index of indices) {
+                        notebook.activeCellIndex = index;
+                        notebook.deselectAll();
+                        app.commands.execute("notebook:run-cell").catch((err) => console.error(err));
+                    }
+                    if (current >= 0) {
+                        notebook.activeCellIndex = current;
+                    }
+                },
+            };
+        }
+        return null;
+    }
+
+    try {
+        const api = notebookApi();
+        if (!api) {
+            throw new Error("the notebook is not accessible from the page (in JupyterLab, start it with " +
+                "`--expose-app-in-browser`): please run the required cells manually");
+        }
+        const parsed = api.cells.map((cell) => cell.isCode ? parseCell(cell.source) : {labels: [], requires: []});
+        const byLabel = new Map();  // Label -> index of the cell.
+        parsed.forEach((cell, index) => cell.labels.forEach((label) => byLabel.set(label, index)));
+        let wanted = required;
+        if (wanted.length === 0 && api.current >= 0) {
+            wanted = parsed[api.current].requires;
+        }
+        if (wanted.length === 0) {
+            wanted = parsed.flatMap((cell) => cell.requires);
+        }
+
+        // Topological order of the cells needed: requirements first.
+        const order = [], missing = [], visiting = new Set(), visited = new Set();
+        function visit(label, path) {
+            if (done.has(label)) {
+                return;
+            }
+            const index = byLabel.get(label);
+            if (index === undefined) {
+                missing.push(label);
+                return;
+            }
+            if (visited.has(index) || index === api.current) {
+                return;
+            }
+            if (visiting.has(index)) {
+                throw new Error(`cyclic requirements: ${[...path, label].join(" -> ")}`);
+            }
+            visiting.add(index);
+            parsed[index].requires.forEach((req) => visit(req, [...path, label]));
+            visiting.delete(index);
+            visited.add(index);
+            order.push(index);
+        }
+        new Set(wanted).forEach((label) => visit(label, []));
+
+        const report = [];
+        if (order.length === 0) {
+            report.push("All the required cells already ran in this session.");
+        } else {
+            api.run(order);
+            report.push(`Queued ${order.length} cell(s) for execution, after this one:`);
+            order.forEach((index) => report.push(`  cell #${index + 1}: ${parsed[index].labels.join(", ")}`));
+        }
+        if (missing.length > 0) {
+            report.push(`No cell labeled: ${[...new Set(missing)].join(", ")}`);
+        }
+        gonb_comm.send(address, report.join("\n"));
+    } catch (err) {
+        gonb_comm.send(address, `%run_needed failed: ${err.message ?? err}`);
+    }
+})();
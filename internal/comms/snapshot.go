@@ -0,0 +1,199 @@
+package comms
+
+import (
+	"bytes"
+	"compress/zlib"
+	_ "embed"
+	"fmt"
+	"html"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements `%snapshot`: the front-end rasterizes the output of a cell to a PNG image, and sends
+// it back to the kernel, that saves it to disk, as PNG or PDF.
+
+// SnapshotAddressPrefix is the prefix of the protocol private message address used by the front-end to send
+// back a snapshot (or an error message), followed by the id of the request.
+const SnapshotAddressPrefix = "#comms/snapshot/"
+
+// SnapshotTimeout is how long to wait for the front-end to send back a snapshot.
+var SnapshotTimeout = time.Minute
+
+//go:embed snapshot.js
+var snapshotJs string
+
+var tmplSnapshotJs = template.Must(template.New("snapshotJs").Parse(snapshotJs))
+
+// snapshotRequest pending to be fulfilled by the front-end.
+type snapshotRequest struct {
+	filePath, displayId string
+	timer               *time.Timer
+}
+
+// RequestSnapshot asks the front-end to rasterize the output of the cell of msg, and to send it back, to be
+// saved in filePath, as PNG or PDF (depending on its extension).
+//
+// It installs the WebSocket in the front-end, if not yet installed. The snapshot is saved asynchronously, and
+// a note is displayed in the cell output when it is done.
+func (s *State) RequestSnapshot(msg kernel.Message, filePath string) error {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if ext != ".png" && ext != ".pdf" {
+		return errors.Errorf("%%snapshot only supports \".png\" or \".pdf\" files, got %q", filePath)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.installWebSocketLocked(msg); err != nil {
+		return err
+	}
+	id := common.UniqueId()
+	req := &snapshotRequest{filePath: filePath, displayId: "gonb_snapshot_" + id}
+	req.timer = time.AfterFunc(SnapshotTimeout, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.snapshots[id] == req {
+			delete(s.snapshots, id)
+			klog.Warningf("%%snapshot to %q timed out: front-end didn't reply in %s", filePath, SnapshotTimeout)
+		}
+	})
+	s.snapshots[id] = req
+
+	var js bytes.Buffer
+	err := tmplSnapshotJs.Execute(&js, struct{ Address, MarkerId string }{
+		Address:  SnapshotAddressPrefix + id,
+		MarkerId: req.displayId,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to execute %%snapshot Javascript template")
+	}
+	var nonceAttr string
+	if s.ScriptNonce != "" {
+		nonceAttr = fmt.Sprintf(" nonce=\"%s\"", html.EscapeString(s.ScriptNonce))
+	}
+	return kernel.PublishUpdateDisplayData(msg, kernel.Data{
+		Data: kernel.MIMEMap{
+			string(protocol.MIMETextHTML): fmt.Sprintf(`<div id="%s"></div><script%s>%s</script>`,
+				req.displayId, nonceAttr, js.String()),
+		},
+		Metadata:  make(kernel.MIMEMap),
+		Transient: kernel.MIMEMap{"display_id": req.displayId},
+	})
+}
+
+// handleSnapshotLocked saves the snapshot (or reports the error) sent by the front-end.
+func (s *State) handleSnapshotLocked(msg kernel.Message, address string, content map[string]any) {
+	id := strings.TrimPrefix(address, SnapshotAddressPrefix)
+	req, found := s.snapshots[id]
+	if !found {
+		klog.V(1).Infof("comms: snapshot %q not requested (or timed out), ignored", id)
+		return
+	}
+	delete(s.snapshots, id)
+	req.timer.Stop()
+
+	var report string
+	if binary, _ := getFromJson[bool](content, "data/binary"); binary && len(msg.ComposedMsg().Buffers) > 0 {
+		if err := saveSnapshot(req.filePath, msg.ComposedMsg().Buffers[0]); err != nil {
+			klog.Errorf("%%snapshot: %+v", err)
+			report = fmt.Sprintf("%%snapshot failed: %v", err)
+		} else {
+			report = fmt.Sprintf("Snapshot saved to %q", req.filePath)
+		}
+	} else {
+		errMsg, _ := getFromJson[string](content, "data/value")
+		klog.Errorf("%%snapshot to %q failed in the front-end: %s", req.filePath, errMsg)
+		report = fmt.Sprintf("%%snapshot failed in the front-end: %s", errMsg)
+	}
+	err := kernel.PublishUpdateDisplayData(msg, kernel.Data{
+		Data:      kernel.MIMEMap{string(protocol.MIMETextPlain): report},
+		Metadata:  make(kernel.MIMEMap),
+		Transient: kernel.MIMEMap{"display_id": req.displayId},
+	})
+	if err != nil {
+		klog.Errorf("%%snapshot: failed to report result: %+v", err)
+	}
+}
+
+// saveSnapshot saves the PNG image to filePath, converting it to PDF if filePath has a ".pdf" extension.
+func saveSnapshot(filePath string, pngData []byte) error {
+	data := pngData
+	if strings.ToLower(filepath.Ext(filePath)) == ".pdf" {
+		var err error
+		data, err = pngToPDF(pngData)
+		if err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write snapshot to %q", filePath)
+	}
+	return nil
+}
+
+// pngToPDF converts a PNG image to a single page PDF document, with the page the size of the image (at 96 DPI).
+func pngToPDF(pngData []byte) ([]byte, error) {
+	img, err := png.Decode(bytes.NewReader(pngData))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode snapshot PNG")
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	// Pixels as RGB (PDF images don't support alpha), zlib compressed.
+	var pixels bytes.Buffer
+	zw := zlib.NewWriter(&pixels)
+	rgb := make([]byte, 0, 3*bounds.Dx())
+	for y := 0; y < bounds.Dy(); y++ {
+		rgb = rgb[:0]
+		row := rgba.Pix[y*rgba.Stride : y*rgba.Stride+4*bounds.Dx()]
+		for x := 0; x < len(row); x += 4 {
+			rgb = append(rgb, row[x], row[x+1], row[x+2])
+		}
+		_, _ = zw.Write(rgb)
+	}
+	if err = zw.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to compress snapshot image")
+	}
+
+	// Page size in points (1/72 inch), for an image at 96 DPI.
+	width, height := float64(bounds.Dx())*0.75, float64(bounds.Dy())*0.75
+	contents := fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Im0 Do Q", width, height)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /XObject << /Im0 4 0 R >> >> /Contents 5 0 R >>", width, height),
+		fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB "+
+			"/BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream",
+			bounds.Dx(), bounds.Dy(), pixels.Len(), pixels.String()),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(contents), contents),
+	}
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for ii, obj := range objects {
+		offsets[ii] = pdf.Len()
+		_, _ = fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", ii+1, obj)
+	}
+	xref := pdf.Len()
+	_, _ = fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		_, _ = fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	_, _ = fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return pdf.Bytes(), nil
+}
@@ -0,0 +1,61 @@
+(async () => {
+    const address = "{{.Address}}";
+    const marker = document.getElementById("{{.MarkerId}}");
+    const gonb_comm = globalThis?.gonb_comm;
+    if (!marker || !gonb_comm) {
+        console.error("GoNB %snapshot: communication to GoNB not setup.");
+        return;
+    }
+    try {
+        // Output area of the cell: JupyterLab, Notebook v7 or classic Notebook.
+        const output = marker.closest(".jp-OutputArea, .output") ?? marker.parentElement;
+        const rect = output.getBoundingClientRect();
+        const width = Math.ceil(rect.width), height = Math.ceil(rect.height);
+
+        // Clone the output, inlining the computed styles, since stylesheets are not available when
+        // rendering the SVG image. Canvases are replaced by images with their contents.
+        const clone = output.cloneNode(true);
+        const originals = [output, ...output.querySelectorAll("*")];
+        const clones = [clone, ...clone.querySelectorAll("*")];
+        originals.forEach((elem, ii) => {
+            const cloned = clones[ii];
+            if (elem === marker) {
+                return;
+            }
+            const style = getComputedStyle(elem);
+            for (const name of style) {
+                cloned.style.setProperty(name, style.getPropertyValue(name));
+            }
+            if (elem instanceof HTMLCanvasElement) {
+                const img = document.createElement("img");
+                img.src = elem.toDataURL();
+                img.style.cssText = cloned.style.cssText;
+                cloned.replaceWith(img);
+            }
+        });
+        clone.querySelectorAll("#{{.MarkerId}}, script").forEach((elem) => elem.remove());
+        clone.setAttribute("xmlns", "http://www.w3.org/1999/xhtml");
+
+        const xhtml = new XMLSerializer().serializeToString(clone);
+        const svg = `<svg xmlns="http://www.w3.org/2000/svg" width="${width}" height="${height}">` +
+            `<foreignObject width="100%" height="100%">${xhtml}</foreignObject></svg>`;
+        const img = new Image();
+        img.src = "data:image/svg+xml;charset=utf-8," + encodeURIComponent(svg);
+        await img.decode();
+
+        const scale = globalThis.devicePixelRatio ?? 1;
+        const canvas = document.createElement("canvas");
+        canvas.width = width * scale;
+        canvas.height = height * scale;
+        const ctx = canvas.getContext("2d");
+        ctx.fillStyle = "white";
+        ctx.fillRect(0, 0, canvas.width, canvas.height);
+        ctx.scale(scale, scale);
+        ctx.drawImage(img, 0, 0);
+        const blob = await new Promise((resolve, reject) => canvas.toBlob(
+            (b) => b ? resolve(b) : reject(new Error("failed to encode PNG")), "image/png"));
+        gonb_comm.send(address, new Uint8Array(await blob.arrayBuffer()));
+    } catch (err) {
+        gonb_comm.send(address, `${err}`);
+    }
+})();
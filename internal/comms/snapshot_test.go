@@ -0,0 +1,39 @@
+package comms
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveSnapshot(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	dir := t.TempDir()
+	pngPath := filepath.Join(dir, "snapshot.png")
+	require.NoError(t, saveSnapshot(pngPath, buf.Bytes()))
+	contents, err := os.ReadFile(pngPath)
+	require.NoError(t, err)
+	assert.Equal(t, buf.Bytes(), contents)
+
+	pdfPath := filepath.Join(dir, "snapshot.PDF")
+	require.NoError(t, saveSnapshot(pdfPath, buf.Bytes()))
+	contents, err = os.ReadFile(pdfPath)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(contents, []byte("%PDF-1.4\n")))
+	assert.Contains(t, string(contents), "/Width 4 /Height 3")
+	assert.Contains(t, string(contents), "/MediaBox [0 0 3.00 2.25]")
+	assert.True(t, bytes.HasSuffix(contents, []byte("%%EOF\n")))
+
+	require.Error(t, saveSnapshot(pdfPath, []byte("not a png")))
+}
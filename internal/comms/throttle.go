@@ -0,0 +1,112 @@
+package comms
+
+import (
+	"time"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the throttling (and debouncing) of the updates from the front-end delivered to the
+// program, configured per address by the program (see `gonbui/comms.Throttle`), so fast front-end events
+// (e.g.: dragging a slider) don't flood the named pipe and the program.
+
+// addressThrottle holds the throttling configuration and state of an address.
+type addressThrottle struct {
+	period   time.Duration
+	debounce bool
+
+	// lastDelivery is when the last value was delivered to the program.
+	lastDelivery time.Time
+
+	// pending value, not yet delivered, if hasPending is set. Consecutive values are coalesced:
+	// only the latest is kept.
+	pending    any
+	hasPending bool
+
+	// timer scheduled to deliver the pending value, or nil if none is scheduled.
+	timer *time.Timer
+}
+
+// ProgramThrottleRequest handler, it implements jpyexec.CommsHandler.
+// It configures the throttling of the updates from the front-end to the given address.
+// Throttling is reset at the start of each program execution.
+func (s *State) ProgramThrottleRequest(req *protocol.CommThrottle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if klog.V(2).Enabled() {
+		klog.Infof("comms: ThrottleRequest: %+v", req)
+	}
+	if t, found := s.throttles[req.Address]; found {
+		if t.hasPending {
+			// Deliver whatever is pending with the previous configuration.
+			s.deliverLocked(req.Address, t.pending)
+		}
+		t.stop()
+		delete(s.throttles, req.Address)
+	}
+	if req.Period <= 0 {
+		return
+	}
+	s.throttles[req.Address] = &addressThrottle{
+		period:   req.Period,
+		debounce: req.Debounce,
+	}
+}
+
+// resetThrottlesLocked stops and removes all throttling configuration.
+func (s *State) resetThrottlesLocked() {
+	for _, t := range s.throttles {
+		t.stop()
+	}
+	s.throttles = make(map[string]*addressThrottle)
+}
+
+// stop any scheduled delivery, dropping any pending value.
+func (t *addressThrottle) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.pending, t.hasPending = nil, false
+}
+
+// throttleLocked handles a value to an address with throttling configured: it either delivers it
+// immediately, or it keeps it as pending (replacing any previous pending value) to be delivered later.
+func (s *State) throttleLocked(address string, t *addressThrottle, value any) {
+	now := time.Now()
+	if !t.debounce && t.timer == nil && now.Sub(t.lastDelivery) >= t.period {
+		// Leading edge of the throttle: deliver immediately.
+		t.lastDelivery = now
+		s.deliverLocked(address, value)
+		return
+	}
+
+	if klog.V(2).Enabled() && t.hasPending {
+		klog.Infof("comms: value %v to %q coalesced", t.pending, address)
+	}
+	t.pending, t.hasPending = value, true
+	if t.debounce {
+		if t.timer != nil {
+			t.timer.Stop()
+		}
+		t.timer = time.AfterFunc(t.period, func() { s.flushThrottle(address, t) })
+	} else if t.timer == nil {
+		t.timer = time.AfterFunc(t.period-now.Sub(t.lastDelivery), func() { s.flushThrottle(address, t) })
+	}
+}
+
+// flushThrottle delivers the pending value of the address, if the throttle is still configured.
+func (s *State) flushThrottle(address string, t *addressThrottle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.throttles[address] != t || !t.hasPending {
+		// Throttle was reconfigured or reset in between.
+		return
+	}
+	value := t.pending
+	t.pending, t.hasPending, t.timer = nil, false, nil
+	t.lastDelivery = time.Now()
+	s.deliverLocked(address, value)
+}
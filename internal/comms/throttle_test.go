@@ -0,0 +1,81 @@
+package comms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/jpyexec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newThrottleTestState returns a State with a fake program executor subscribed to address.
+func newThrottleTestState(address string) (*State, chan *protocol.CommValue) {
+	s := New()
+	fifo := make(chan *protocol.CommValue, 16)
+	s.ProgramExecutor = &jpyexec.Executor{PipeWriterFifo: fifo}
+	s.AddressSubscriptions.Insert(address)
+	return s, fifo
+}
+
+func deliver(s *State, address string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliverProgramSubscriptionsLocked(address, value)
+}
+
+func TestThrottle(t *testing.T) {
+	const address = "/slider"
+	s, fifo := newThrottleTestState(address)
+	period := 200 * time.Millisecond
+	s.ProgramThrottleRequest(&protocol.CommThrottle{Address: address, Period: period})
+
+	// First value is delivered immediately, the following ones coalesced.
+	for ii := 0; ii < 5; ii++ {
+		deliver(s, address, ii)
+	}
+	require.Len(t, fifo, 1)
+	assert.Equal(t, 0, (<-fifo).Value)
+
+	// Only the latest value is delivered at the end of the period.
+	select {
+	case msg := <-fifo:
+		assert.Equal(t, 4, msg.Value)
+	case <-time.After(5 * period):
+		t.Fatal("throttled value never delivered")
+	}
+	time.Sleep(2 * period)
+	assert.Len(t, fifo, 0)
+
+	// Disabling throttling delivers values immediately.
+	s.ProgramThrottleRequest(&protocol.CommThrottle{Address: address})
+	deliver(s, address, 5)
+	deliver(s, address, 6)
+	require.Len(t, fifo, 2)
+}
+
+func TestDebounce(t *testing.T) {
+	const address = "/text"
+	s, fifo := newThrottleTestState(address)
+	period := 200 * time.Millisecond
+	s.ProgramThrottleRequest(&protocol.CommThrottle{Address: address, Period: period, Debounce: true})
+
+	for ii := 0; ii < 5; ii++ {
+		deliver(s, address, ii)
+		time.Sleep(period / 4)
+	}
+	assert.Len(t, fifo, 0)
+	select {
+	case msg := <-fifo:
+		assert.Equal(t, 4, msg.Value)
+	case <-time.After(5 * period):
+		t.Fatal("debounced value never delivered")
+	}
+
+	// Pending values are dropped when the program finishes.
+	deliver(s, address, 5)
+	s.ProgramFinished()
+	time.Sleep(2 * period)
+	assert.Len(t, fifo, 0)
+}
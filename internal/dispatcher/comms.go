@@ -39,13 +39,20 @@ func handleComms(msg kernel.Message, goExec *goexec.State) error {
 	switch msgType {
 	case "comm_info_request":
 		// https://jupyter-client.readthedocs.io/en/latest/messaging.html#comm-info
+		var targetName string
+		if content, ok := msg.ComposedMsg().Content.(map[string]any); ok {
+			targetName, _ = content["target_name"].(string)
+		}
+		return msg.Reply("comm_info_reply", &kernel.CommInfoReply{
+			Status: "ok",
+			Comms:  goExec.Comms.CommInfo(targetName),
+		})
 
 	case "comm_open":
 		return goExec.Comms.HandleOpen(msg)
 
 	case "comm_close":
-		klog.Warningf("\"comm_close\" received, but not implemented -- likely there is no impact.")
-		return nil
+		return goExec.Comms.HandleClose(msg)
 
 	case "comm_msg":
 		return goExec.Comms.HandleMsg(msg)
@@ -24,6 +24,18 @@ const (
 // RunKernel takes a connected kernel and dispatches the various inputs the appropriate handlers.
 // It returns only when the kernel stops running.
 func RunKernel(k *kernel.Kernel, goExec *goexec.State) {
+	runKernel(k, goExec)
+	queuesStopOnce.Do(func() { close(queuesDone) })
+}
+
+// runKernel implements RunKernel, without stopping the workers of the queues of messages, which are shared
+// with kernels attached to a shared session (see ServeSharedSession).
+func runKernel(k *kernel.Kernel, goExec *goexec.State) {
+	queuesOnce.Do(func() {
+		busyMessagesChan = make(chan *shellMsgParams, MaxExecuteRequestQueue)
+		introspectionMessagesChan = make(chan *shellMsgParams, MaxExecuteRequestQueue)
+		queuesDone = make(chan struct{})
+	})
 	var wg sync.WaitGroup
 	poll := func(ch <-chan kernel.Message, fn func(msg kernel.Message, goExec *goexec.State) error) {
 		wg.Add(1)
@@ -76,25 +88,49 @@ func RunKernel(k *kernel.Kernel, goExec *goexec.State) {
 	})
 
 	wg.Wait()
-	close(busyMessagesChan)
 }
 
 // BusyMessageTypes are messages that triggers setting the kernel status to busy
 // while they are being handled.
 //
 // Also, they are serialized, and not handled in parallel (if more than one request
-// is sent before previous one finishes).
+// is sent before previous one finishes). The exception are the IntrospectionMessageTypes,
+// which are serialized in a separate queue.
 var BusyMessageTypes = []string{
 	"execute_request", "inspect_request", "complete_request",
 	"kernel_info_request",
 	//"kernel_info_request", "shutdown_request",
 }
 
-const MaxExecuteRequestQueue = 10000
+// IntrospectionMessageTypes are the BusyMessageTypes served by a separate worker, so they are not
+// queued behind a long-running `execute_request`: auto-complete and contextual help keep working
+// while a cell program runs.
+var IntrospectionMessageTypes = []string{
+	"inspect_request", "complete_request",
+}
+
+// MaxExecuteRequestQueue is the capacity of the queues of busy messages, created when the kernel starts running.
+// It is reduced with `--low-memory`.
+var MaxExecuteRequestQueue = 10000
 
 var (
-	busyMessagesChan = make(chan *shellMsgParams, 10000)
+	queuesOnce sync.Once
+
+	// queuesDone is closed when the owner kernel stops, to stop the workers of the queues. The queues themselves
+	// are never closed, since kernels attached to a shared session may still be enqueueing messages.
+	queuesDone     chan struct{}
+	queuesStopOnce sync.Once
+
+	busyMessagesChan chan *shellMsgParams
 	busyMessagesOnce sync.Once
+
+	introspectionMessagesChan chan *shellMsgParams
+	introspectionMessagesOnce sync.Once
+
+	// numBusy is the number of busy messages being handled, from both queues. The kernel is reported busy
+	// when it goes up from zero, and idle only when it drops back to zero. Guarded by busyMu.
+	numBusy int
+	busyMu  sync.Mutex
 )
 
 type shellMsgParams struct {
@@ -118,7 +154,7 @@ func handleShellMsg(msg kernel.Message, goExec *goexec.State) (err error) {
 	if !slices.Contains(BusyMessageTypes, msgType) {
 		// Messages that are handled asynchronously and don't block kernel
 		switch msgType {
-		case "comm_open", "comm_msg", "comm_comm_close", "comm_info_request":
+		case "comm_open", "comm_msg", "comm_close", "comm_info_request":
 			// Handle in a separate goroutine.
 			go func() {
 				klog.V(1).Infof("Dispatcher: handling %q", msgType)
@@ -153,11 +189,27 @@ func handleShellMsg(msg kernel.Message, goExec *goexec.State) (err error) {
 		return
 	}
 
+	if slices.Contains(IntrospectionMessageTypes, msgType) {
+		return enqueueBusyMessage(introspectionMessagesChan, &introspectionMessagesOnce, "Introspection", msg, goExec)
+	}
+	return enqueueBusyMessage(busyMessagesChan, &busyMessagesOnce, "Execution", msg, goExec)
+}
+
+// enqueueBusyMessage sends the message to the given queue, whose messages are handled in order
+// by a worker goroutine, started on the first call (with once).
+func enqueueBusyMessage(queue chan *shellMsgParams, once *sync.Once, queueName string,
+	msg kernel.Message, goExec *goexec.State) error {
 	// Start processing of requests queue.
-	busyMessagesOnce.Do(func() {
+	once.Do(func() {
 		go func() {
-			for params := range busyMessagesChan {
-				msgType := msg.ComposedMsg().Header.MsgType
+			for {
+				var params *shellMsgParams
+				select {
+				case <-queuesDone:
+					return
+				case params = <-queue:
+				}
+				msgType := params.msg.ComposedMsg().Header.MsgType
 				klog.V(1).Infof("Dispatcher: handling %q", msgType)
 				err := handleBusyMessage(params.msg, params.goExec)
 				if err != nil {
@@ -169,10 +221,17 @@ func handleShellMsg(msg kernel.Message, goExec *goexec.State) (err error) {
 		}()
 	})
 
-	sentStatus := SendNoBlock(busyMessagesChan, &shellMsgParams{msg: msg, goExec: goExec})
+	select {
+	case <-queuesDone:
+		klog.V(1).Infof("Dispatcher: kernel stopped, dropping %q", msg.ComposedMsg().Header.MsgType)
+		return nil
+	default:
+	}
+
+	sentStatus := SendNoBlock(queue, &shellMsgParams{msg: msg, goExec: goExec})
 	if sentStatus == 1 {
-		err := errors.Errorf("Execution queue (with %d elements) is full!? Something must be going wrong with the notebook (too many cells?) or Jupyter, please check.",
-			len(busyMessagesChan))
+		err := errors.Errorf("%s queue (with %d elements) is full!? Something must be going wrong with the notebook (too many cells?) or Jupyter, please check.",
+			queueName, len(queue))
 		klog.Errorf("%v", err)
 		return err
 	}
@@ -181,24 +240,48 @@ func handleShellMsg(msg kernel.Message, goExec *goexec.State) (err error) {
 
 // handleBusyMessage handles Shell messages that need to be serialized.
 func handleBusyMessage(msg kernel.Message, goExec *goexec.State) (err error) {
-	msgType := msg.ComposedMsg().Header.MsgType
-
 	// Tell the front-end that the kernel is working and when finished, notify the
-	// front-end that the kernel is idle again.
-	if err = kernel.PublishKernelStatus(msg, kernel.StatusBusy); err != nil {
+	// front-end that the kernel is idle again -- only if no other busy message (from either queue)
+	// is being handled.
+	busyMu.Lock()
+	numBusy++
+	if numBusy == 1 {
+		err = kernel.PublishKernelStatus(msg, kernel.StatusBusy)
+		klog.V(2).Infof("> kernel status set to busy.")
+	}
+	busyMu.Unlock()
+	if err != nil {
 		err = errors.WithMessagef(err, "publishing kernel status %q", kernel.StatusBusy)
 		return
 	}
-	klog.V(2).Infof("> kernel status set to busy.")
 
 	// Defer publishing of status idle again, before returning.
 	defer func() {
+		busyMu.Lock()
+		defer busyMu.Unlock()
+		numBusy--
+		if numBusy > 0 {
+			return
+		}
 		newErr := kernel.PublishKernelStatus(msg, kernel.StatusIdle)
 		if err == nil && newErr != nil {
-			err = errors.WithMessagef(err, "publishing kernel status %q", kernel.StatusIdle)
+			err = errors.WithMessagef(newErr, "publishing kernel status %q", kernel.StatusIdle)
 		}
 		klog.V(2).Infof("> kernel status set to idle.")
 	}()
+	return handleBusyMessageContent(msg, goExec)
+}
+
+// isBusy returns whether a busy message, from either queue, is being handled.
+func isBusy() bool {
+	busyMu.Lock()
+	defer busyMu.Unlock()
+	return numBusy > 0
+}
+
+// handleBusyMessageContent handles the busy message proper, after the kernel status is set.
+func handleBusyMessageContent(msg kernel.Message, goExec *goexec.State) (err error) {
+	msgType := msg.ComposedMsg().Header.MsgType
 
 	switch msgType {
 	case "kernel_info_request":
@@ -219,7 +302,7 @@ func handleBusyMessage(msg kernel.Message, goExec *goexec.State) (err error) {
 			klog.Fatal(err)
 		}
 
-	case "comm_open", "comm_msg", "comm_comm_close", "comm_info_request":
+	case "comm_open", "comm_msg", "comm_close", "comm_info_request":
 		err = handleComms(msg, goExec)
 
 	case "is_complete_request":
@@ -234,10 +317,13 @@ func handleBusyMessage(msg kernel.Message, goExec *goexec.State) (err error) {
 
 // handleShutdownRequest sends a "shutdown" message.
 func handleShutdownRequest(msg kernel.Message, goExec *goexec.State) error {
+	content := msg.ComposedMsg().Content.(map[string]any)
+	if restart, _ := content["restart"].(bool); restart && RestartMode != RestartProcess {
+		return handleSoftRestart(msg, goExec)
+	}
 	klog.Info("Shutting down in response to shutdown_request")
 	msg.Kernel().CallInterruptSubscribers() // Interrupt current runs.
 
-	content := msg.ComposedMsg().Content.(map[string]any)
 	replyContent := make(map[string]any)
 	replyContent["status"] = "ok"
 	replyContent["restart"] = content["restart"]
@@ -247,9 +333,11 @@ func handleShutdownRequest(msg kernel.Message, goExec *goexec.State) error {
 	}
 
 	// Shutdown comms with front-end first -- this allows sending of
-	// "comm_close" message.
-	if err := goExec.Comms.Close(msg); err != nil {
-		klog.Warningf("comms: failure closing connection to front-end: %+v", err)
+	// "comm_close" message. Kernels attached to a shared session don't own the comms.
+	if goExec.Kernel == nil || msg.Kernel() == goExec.Kernel {
+		if err := goExec.Comms.Close(msg); err != nil {
+			klog.Warningf("comms: failure closing connection to front-end: %+v", err)
+		}
 	}
 
 	msg.Kernel().Stop()
@@ -274,11 +362,14 @@ func handleExecuteRequest(msg kernel.Message, goExec *goexec.State) error {
 		klog.Infof("Message content: %+v", content)
 	}
 
+	// Executions count as activity when they start and when they end, see StartIdleShutdown.
+	msg.Kernel().MarkActivity()
+	defer msg.Kernel().MarkActivity()
+
 	// Prepare the map that will hold the reply content.
 	replyContent := make(map[string]any)
 	if storeHistory {
-		msg.Kernel().ExecCounter++
-		replyContent["execution_count"] = msg.Kernel().ExecCounter
+		replyContent["execution_count"] = msg.Kernel().IncrementExecCounter()
 	}
 
 	// Tell the front-end what the kernel is about to execute.
@@ -290,30 +381,18 @@ func handleExecuteRequest(msg kernel.Message, goExec *goexec.State) error {
 	}
 
 	// Dispatch to various executors.
-	msg.Kernel().Interrupted.Store(false)
-	lines := strings.Split(code, "\n")
-	specialLines := MakeSet[int]() // lines that are special commands and not Go.
-	var executionErr error
-
-	if specialCell, err := specialcmd.ExecuteSpecialCell(msg, goExec, lines); specialCell {
-		executionErr = err // err may be nil here, if magic cell command was executed correctly.
-
-	} else {
-		if err := specialcmd.Parse(msg, goExec, true, lines, specialLines); err != nil {
-			executionErr = errors.WithMessagef(err, "executing special commands in cell")
-		}
-		hasMoreToRun := !goexec.IsEmptyLines(lines, specialLines) || goExec.CellIsTest
-		if executionErr == nil && !msg.Kernel().Interrupted.Load() && hasMoreToRun {
-			executionErr = goExec.ExecuteCell(msg, msg.Kernel().ExecCounter, lines, specialLines)
-		}
-	}
+	executionErr := ExecuteCode(msg, goExec, code)
 
 	// Final execution result.
 	if executionErr == nil {
 		// if the only non-nil value should be auto-rendered graphically, render it
 		replyContent["status"] = "ok"
 		replyContent["user_expressions"] = make(map[string]string)
+		if payloads := goExec.TakePayloads(); len(payloads) > 0 {
+			replyContent["payload"] = payloads
+		}
 	} else {
+		_ = goExec.TakePayloads() // Discard payloads of failed executions.
 		name, value, traceback := goexec.JupyterErrorSplit(executionErr)
 		replyContent["status"] = "error"
 		replyContent["ename"] = name
@@ -326,6 +405,15 @@ func handleExecuteRequest(msg kernel.Message, goExec *goexec.State) error {
 		}
 	}
 
+	// Snapshot of the cell output requested with `%snapshot`: only after everything else was displayed.
+	if goExec.SnapshotPath != "" {
+		if err := goExec.Comms.RequestSnapshot(msg, goExec.SnapshotPath); err != nil {
+			klog.Errorf("%%snapshot failed: %+v", err)
+			_ = kernel.PublishWriteStream(msg, kernel.StreamStderr, fmt.Sprintf("%%snapshot failed: %v\n", err))
+		}
+		goExec.SnapshotPath = ""
+	}
+
 	// Send the output back to the notebook.
 	if klog.V(2).Enabled() {
 		klog.Infof("> execute_reply: %+v", replyContent)
@@ -336,6 +424,29 @@ func handleExecuteRequest(msg kernel.Message, goExec *goexec.State) error {
 	return nil
 }
 
+// ExecuteCode executes the contents of a cell: either a special cell (e.g.: `%%script`), or special
+// commands followed by the Go code, if any.
+// It uses the current `msg.Kernel().ExecCounter()` as the cell id.
+//
+// It returns the execution error, if any, which is not published.
+func ExecuteCode(msg kernel.Message, goExec *goexec.State, code string) (executionErr error) {
+	msg.Kernel().Interrupted.Store(false)
+	lines := strings.Split(code, "\n")
+	specialLines := MakeSet[int]() // lines that are special commands and not Go.
+
+	if specialCell, err := specialcmd.ExecuteSpecialCell(msg, goExec, lines); specialCell {
+		return err // err may be nil here, if magic cell command was executed correctly.
+	}
+	if err := specialcmd.Parse(msg, goExec, true, lines, specialLines); err != nil {
+		return errors.WithMessagef(err, "executing special commands in cell")
+	}
+	hasMoreToRun := !goexec.IsEmptyLines(lines, specialLines) || goExec.CellIsTest
+	if !msg.Kernel().Interrupted.Load() && hasMoreToRun {
+		executionErr = goExec.ExecuteCell(msg, msg.Kernel().ExecCounter(), lines, specialLines)
+	}
+	return
+}
+
 // HandleInspectRequest presents rich data (HTML?) with contextual information for the
 // contents under the cursor.
 func HandleInspectRequest(msg kernel.Message, goExec *goexec.State) error {
@@ -358,8 +469,8 @@ func HandleInspectRequest(msg kernel.Message, goExec *goexec.State) error {
 
 		// Get data contents for reply.
 		if usedLines.Has(cursorLine) {
-			// If special command, use our help message as inspect content.
-			data = kernel.MIMEMap{string(protocol.MIMETextPlain): any(specialcmd.HelpMessage)}
+			// If special command, use the help of the command (or the whole help page) as inspect content.
+			data = kernel.MIMEMap{string(protocol.MIMETextPlain): any(specialcmd.LineHelp(lines[cursorLine]))}
 		} else {
 			// Parse Go.
 			var err error
@@ -377,7 +488,7 @@ func HandleInspectRequest(msg kernel.Message, goExec *goexec.State) error {
 		// Either empty lines or it has a "cell magic" command in the first line (like `%%script`), so we default
 		// for the [specialcmd.HelpMessage].
 		klog.V(2).Infof("HandleInspectRequest: empty or not Go cell.")
-		data = kernel.MIMEMap{string(protocol.MIMETextPlain): any(specialcmd.HelpMessage)}
+		data = kernel.MIMEMap{string(protocol.MIMETextPlain): any(specialcmd.Help())}
 	}
 
 	// Send reply.
@@ -444,10 +555,18 @@ func handleCompleteRequest(msg kernel.Message, goExec *goexec.State) (err error)
 		return
 	}
 	if usedLines.Has(cursorLine) {
-		// No auto-complete for special commands.
+		// Special commands and shell commands have their own auto-complete.
+		if strings.HasPrefix(goexec.TrimGonbCommentPrefix(lines[cursorLine]), "!") {
+			specialcmd.AutoCompleteShell(goExec, lines[cursorLine], cursorCol, reply)
+		} else {
+			specialcmd.AutoComplete(lines[cursorLine], cursorCol, reply)
+		}
 		return
 	}
 
 	err = goExec.AutoCompleteOptionsInCell(lines, usedLines, cursorLine, cursorCol, reply)
+	if err == nil {
+		goExec.MergeProviderCompletions(lines, cursorLine, cursorCol, reply)
+	}
 	return
 }
@@ -0,0 +1,50 @@
+package dispatcher
+
+import (
+	"time"
+
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the idle auto-shutdown of the kernel (`--idle_timeout`), for deployments (e.g. JupyterHub)
+// where idle kernels should release their resources.
+
+// MaxIdleCheckInterval is the maximum interval between checks of the kernel idle time.
+const MaxIdleCheckInterval = time.Minute
+
+// StartIdleShutdown starts a goroutine that stops the kernel, cleanly, when no cell is executed for the given
+// timeout. A cell running for longer than the timeout doesn't make the kernel idle.
+//
+// The last activity of the kernel is marked at the start and end of each `execute_request`, see
+// kernel.Kernel.MarkActivity. If timeout <= 0, it does nothing.
+func StartIdleShutdown(k *kernel.Kernel, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	k.IdleTimeout = timeout
+	checkInterval := min(timeout/10, MaxIdleCheckInterval)
+	checkInterval = max(checkInterval, time.Second)
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-k.StoppedChan():
+				return
+			case <-ticker.C:
+			}
+			if isBusy() {
+				continue
+			}
+			idle := time.Since(k.LastActivity())
+			if idle < timeout {
+				continue
+			}
+			klog.Infof("Kernel idle for %s (--idle_timeout=%s), last activity at %s: shutting down",
+				idle.Round(time.Second), timeout, k.LastActivity().Format(time.RFC3339))
+			k.Stop()
+			return
+		}
+	}()
+}
@@ -0,0 +1,58 @@
+package dispatcher
+
+import (
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the in-process (soft) restart of the kernel, in response to a `shutdown_request`
+// with `restart=true`, configured with `--restart`.
+
+const (
+	// RestartProcess restarts the kernel by exiting the process, and letting Jupyter start a new one. It is
+	// the default, and it guarantees a pristine process.
+	RestartProcess = "process"
+
+	// RestartSoft re-initializes the kernel in-process, keeping `gopls` and the build cache warm, but
+	// resetting `go.mod`. See goexec.State.SoftReset.
+	RestartSoft = "soft"
+
+	// RestartSoftKeepGoMod is like RestartSoft, but it also preserves `go.mod` (and `go.sum`, `go.work` and the
+	// tracked directories) of the default workspace, so dependencies don't need to be fetched again. The other
+	// `%workspace` workspaces are removed in both modes.
+	RestartSoftKeepGoMod = "soft_keep_mod"
+)
+
+// RestartModes lists the valid values of RestartMode.
+var RestartModes = []string{RestartProcess, RestartSoft, RestartSoftKeepGoMod}
+
+// RestartMode defines how a restart requested by Jupyter is handled. It should be one of RestartModes.
+var RestartMode = RestartProcess
+
+// handleSoftRestart handles a `shutdown_request` with `restart=true`, when RestartMode is one of the soft modes:
+// it re-initializes the kernel and goexec.State in-process, instead of exiting.
+func handleSoftRestart(msg kernel.Message, goExec *goexec.State) error {
+	klog.Infof("Restarting in-process (--restart=%s) in response to shutdown_request", RestartMode)
+	msg.Kernel().CallInterruptSubscribers() // Interrupt current runs.
+	err := msg.Reply("shutdown_reply", map[string]any{"status": "ok", "restart": true})
+	if err != nil {
+		return errors.WithMessagef(err, "publish 'shutdown_reply`")
+	}
+	if err = kernel.PublishKernelStatus(msg, kernel.StatusStarting); err != nil {
+		return errors.WithMessagef(err, "publishing kernel status %q", kernel.StatusStarting)
+	}
+
+	msg.Kernel().ResetSession()
+	if err := goExec.SoftReset(RestartMode == RestartSoftKeepGoMod); err != nil {
+		// The State is left usable, only the module may not be reset.
+		klog.Errorf("Soft restart failed to reset go.mod: %+v", err)
+	}
+
+	if err = kernel.PublishKernelStatus(msg, kernel.StatusIdle); err != nil {
+		return errors.WithMessagef(err, "publishing kernel status %q", kernel.StatusIdle)
+	}
+	klog.Infof("Kernel restarted in-process.")
+	return nil
+}
@@ -0,0 +1,102 @@
+package dispatcher
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements `gonb run <file.go>`: it executes a Go file with cell markers as a notebook,
+// printing the outputs to the terminal.
+
+// CellMarker starts a new cell in a Go file executed with RunFile.
+// Any text after the marker in the same line is ignored, so it can be used as a title.
+const CellMarker = goexec.GonbCommentPrefix + "cell"
+
+// JupytextCellMarker starts a new cell in the Jupytext "percent" format for Go files.
+// Cells marked as `// %% [markdown]` are skipped.
+const JupytextCellMarker = "// %%"
+
+// SplitCells splits the contents of a Go file into cells, separated by lines starting with
+// CellMarker (`//gonb:cell`) or JupytextCellMarker (`// %%`).
+// The marker lines themselves are not included in the cells.
+//
+// Markdown cells (`// %% [markdown]`), cells with only comments or empty lines, and a package clause before
+// the first cell are dropped.
+// Lines prefixed with `//gonb:` (e.g.: `//gonb:%%`) are kept as is: they are handled as special
+// commands when the cell is executed.
+func SplitCells(contents string) (cells []string) {
+	var current []string
+	isMarkdown, seenMarker := false, false
+	flush := func() {
+		if !isMarkdown && !isCommentsOnly(current) {
+			cells = append(cells, strings.Join(current, "\n"))
+		}
+		current = nil
+	}
+	for _, line := range strings.Split(contents, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, CellMarker) || strings.HasPrefix(trimmed, JupytextCellMarker) {
+			flush()
+			seenMarker = true
+			isMarkdown = strings.HasPrefix(trimmed, JupytextCellMarker) &&
+				strings.HasPrefix(strings.TrimSpace(trimmed[len(JupytextCellMarker):]), "[markdown]")
+			continue
+		}
+		if !seenMarker && strings.HasPrefix(trimmed, "package ") {
+			// Package clause before the first cell, so the file can be read by Go tools: not part of the cells.
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+	return
+}
+
+// isCommentsOnly returns whether lines only have empty lines or Go line comments, excluding the
+// ones prefixed with `//gonb:`.
+func isCommentsOnly(lines []string) bool {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "//") || strings.HasPrefix(line, goexec.GonbCommentPrefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// RunFile executes the Go file with cell markers (see SplitCells) as a sequence of cells, using the
+// offline kernel k (see kernel.NewOffline), and printing the outputs to the terminal.
+//
+// It stops at the first cell that fails, and returns its error, after printing it.
+func RunFile(k *kernel.Kernel, goExec *goexec.State, filePath string) error {
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %q", filePath)
+	}
+	cells := SplitCells(string(contents))
+	klog.V(1).Infof("gonb run %q: %d cells", filePath, len(cells))
+	for ii, code := range cells {
+		k.IncrementExecCounter()
+		msg := kernel.NewTerminalMessage(k)
+		if err := ExecuteCode(msg, goExec, code); err != nil {
+			_, value, traceback := goexec.JupyterErrorSplit(err)
+			for _, line := range traceback {
+				_, _ = fmt.Fprintln(msg.Stderr, line)
+			}
+			return errors.Errorf("cell #%d of %q failed: %s", ii+1, filePath, value)
+		}
+		if k.Interrupted.Load() {
+			return errors.Errorf("interrupted while executing cell #%d of %q", ii+1, filePath)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package dispatcher
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// This file implements shared sessions (opt-in): a GoNB kernel started with a session name serves its
+// goexec.State to other GoNB kernels started with the same name. The later ones hand over their Jupyter
+// connection file to the first one (the owner of the session), which then serves both connections
+// with the same memorized declarations, serialized in the same execution queue.
+//
+// The attached kernel process stays alive (doing nothing) while the owner is serving it, so Jupyter
+// sees it as alive. It exits when the owner stops serving it (shutdown) or exits.
+
+// SharedSessionEnv is the environment variable with the name of the shared session to create or attach to,
+// if the `--shared_session` flag is not given.
+const SharedSessionEnv = "GONB_SHARED_SESSION"
+
+var reValidSessionName = regexp.MustCompile(`^[a-zA-Z0-9_.\-]+$`)
+
+// sharedSessionSocketPath returns the path of the Unix socket used to attach to the session.
+func sharedSessionSocketPath(name string) (string, error) {
+	if !reValidSessionName.MatchString(name) {
+		return "", errors.Errorf("invalid shared session name %q: only letters, digits, '_', '.' and '-' are allowed", name)
+	}
+	return path.Join(os.TempDir(), fmt.Sprintf("gonb_session_%d_%s.sock", os.Getuid(), name)), nil
+}
+
+// AttachToSharedSession tries to attach the Jupyter connection described in connectionFile to the running
+// GoNB kernel that owns the shared session name.
+//
+// If there is no such kernel, it returns attached=false, and the caller should create the session with
+// ServeSharedSession. Otherwise, it blocks until the owner stops serving the connection, and then returns
+// attached=true.
+func AttachToSharedSession(name, connectionFile string) (attached bool, err error) {
+	socketPath, err := sharedSessionSocketPath(name)
+	if err != nil {
+		return false, err
+	}
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		klog.V(1).Infof("Shared session %q not available (%v), creating a new one", name, err)
+		return false, nil
+	}
+	defer func() { _ = conn.Close() }()
+
+	connectionFile, err = filepath.Abs(connectionFile)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to find absolute path of connection file")
+	}
+	if _, err = fmt.Fprintf(conn, "%s\n", connectionFile); err != nil {
+		return false, errors.Wrapf(err, "failed to send connection file to shared session %q", name)
+	}
+	reader := bufio.NewReader(conn)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return false, errors.Wrapf(err, "no response from shared session %q", name)
+	}
+	response = strings.TrimSpace(response)
+	if response != "ok" {
+		return false, errors.Errorf("shared session %q failed to attach connection: %s", name, response)
+	}
+	klog.Infof("Attached to shared session %q: waiting for it to finish", name)
+
+	// Block until the owner closes the connection.
+	_, _ = reader.ReadString('\n')
+	klog.Infof("Shared session %q detached", name)
+	return true, nil
+}
+
+// ServeSharedSession listens for other GoNB kernels attaching to the shared session name, and serves their
+// Jupyter connections with the given goExec, in the background.
+//
+// It returns a function that stops listening.
+func ServeSharedSession(name string, goExec *goexec.State) (stop func(), err error) {
+	socketPath, err := sharedSessionSocketPath(name)
+	if err != nil {
+		return nil, err
+	}
+	// Remove stale socket, left from a kernel that didn't exit cleanly: we know no one is listening, since
+	// AttachToSharedSession failed to connect.
+	_ = os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen to shared session %q in %q", name, socketPath)
+	}
+	klog.Infof("Serving shared session %q in %q", name, socketPath)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					klog.Errorf("Shared session %q stopped accepting connections: %+v", name, err)
+				}
+				return
+			}
+			go serveAttachedKernel(name, conn, goExec)
+		}
+	}()
+	return func() {
+		_ = listener.Close()
+		_ = os.Remove(socketPath)
+	}, nil
+}
+
+// serveAttachedKernel binds the sockets of the connection file received in conn, and dispatches its messages
+// until the attached kernel is stopped (or the owner exits).
+func serveAttachedKernel(name string, conn net.Conn, goExec *goexec.State) {
+	defer func() { _ = conn.Close() }()
+	connectionFile, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		klog.Errorf("Shared session %q: failed to read connection file: %+v", name, err)
+		return
+	}
+	connectionFile = strings.TrimSpace(connectionFile)
+	k, err := kernel.New(connectionFile)
+	if err != nil {
+		klog.Errorf("Shared session %q: failed to attach %q: %+v", name, connectionFile, err)
+		_, _ = fmt.Fprintf(conn, "%s\n", strings.ReplaceAll(err.Error(), "\n", " "))
+		return
+	}
+	if _, err = fmt.Fprintf(conn, "ok\n"); err != nil {
+		klog.Errorf("Shared session %q: failed to confirm attachment of %q: %+v", name, connectionFile, err)
+		k.Stop()
+		k.ExitWait()
+		return
+	}
+	klog.Infof("Shared session %q: serving connection %q", name, connectionFile)
+
+	// Stop the attached kernel if the owner stops.
+	if goExec.Kernel != nil {
+		go func() {
+			select {
+			case <-goExec.Kernel.StoppedChan():
+				k.Stop()
+			case <-k.StoppedChan():
+			}
+		}()
+	}
+	runKernel(k, goExec)
+	k.ExitWait()
+	klog.Infof("Shared session %q: connection %q finished", name, connectionFile)
+}
@@ -0,0 +1,214 @@
+package goexec
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the assembly (`%asm`) and escape analysis (`%escape`) views of a memorized function:
+// the memorized declarations are compiled with `-gcflags=-S` or `-gcflags=-m`, and the output of the compiler
+// is filtered to the function and mapped to the cell lines.
+
+// AsmLine is a line of the assembly of a function, see State.Asm.
+type AsmLine struct {
+	// Symbol is set for the header line of each symbol: the function and each of its closures.
+	// The other fields are then empty.
+	Symbol string
+
+	// Offset of the instruction within the symbol, e.g. "0x001a".
+	Offset string
+
+	// CellId and Line (0-based) of the code that generated the instruction. Line is NoCursorLine if the
+	// instruction is not from a cell (e.g. auto-generated code).
+	CellId, Line int
+
+	// Source is the text of the line of code that generated the instruction, if known.
+	Source string
+
+	// Instruction, e.g. "MOVQ\tAX, main.x(SB)".
+	Instruction string
+}
+
+var (
+	// regexpAsmSymbol matches the header of a function in the output of `-gcflags=-S`,
+	// e.g. "main.Foo STEXT size=10 args=0x8 locals=0x0".
+	regexpAsmSymbol = regexp.MustCompile(`^(\S+) STEXT`)
+
+	// regexpAsmInstruction matches an instruction in the output of `-gcflags=-S`,
+	// e.g. "\t0x0000 00000 (/tmp/gonb_1234/main.go:5)\tTEXT\tmain.Foo(SB), ABIInternal, $0-8".
+	// The hex dumps of the symbols are not matched.
+	regexpAsmInstruction = regexp.MustCompile(`^\t(0x[0-9a-f]+) \d+ \((.*):(\d+)\)\t(.*)$`)
+
+	// regexpTypeParams matches the type parameters of a symbol, e.g. "[go.shape.int]".
+	regexpTypeParams = regexp.MustCompile(`\[[^\[\]]*\]`)
+)
+
+// Asm returns the assembly generated by the compiler for the memorized function (or method, given as
+// `<Type>.<Method>`) and its closures.
+func (s *State) Asm(name string) ([]AsmLine, error) {
+	fn, output, fileToCellIdAndLine, mainLines, err := s.compileMemorized(name, "-S")
+	if err != nil {
+		return nil, err
+	}
+	asmLines := parseAsmOutput(output, fn, filepath.Base(s.CodePath()), fileToCellIdAndLine, mainLines)
+	if len(asmLines) == 0 {
+		return nil, errors.Errorf("no assembly found for %q", name)
+	}
+	return asmLines, nil
+}
+
+// parseAsmOutput parses the output of the compiler with `-gcflags=-S`, and returns the assembly of fn and its
+// closures. codeFile is the name of the file with the code, whose lines are mapped to the cells.
+func parseAsmOutput(output string, fn *Function, codeFile string, fileToCellIdAndLine []CellIdAndLine,
+	mainLines []string) (asmLines []AsmLine) {
+	inSymbol := false
+	for _, line := range strings.Split(output, "\n") {
+		if matches := regexpAsmSymbol.FindStringSubmatch(line); matches != nil {
+			inSymbol = asmSymbolMatches(matches[1], fn)
+			if inSymbol {
+				asmLines = append(asmLines, AsmLine{Symbol: matches[1]})
+			}
+			continue
+		}
+		if !inSymbol {
+			continue
+		}
+		matches := regexpAsmInstruction.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		asmLine := AsmLine{Offset: matches[1], CellId: -1, Line: NoCursorLine, Instruction: matches[4]}
+		if filepath.Base(matches[2]) == codeFile {
+			fileLine, _ := strconv.Atoi(matches[3])
+			fileLine-- // 0-based.
+			if fileLine >= 0 && fileLine < len(fileToCellIdAndLine) {
+				asmLine.CellId, asmLine.Line = fileToCellIdAndLine[fileLine].Id, fileToCellIdAndLine[fileLine].Line
+			}
+			if fileLine >= 0 && fileLine < len(mainLines) {
+				asmLine.Source = strings.TrimSpace(mainLines[fileLine])
+			}
+		}
+		asmLines = append(asmLines, asmLine)
+	}
+	return
+}
+
+// asmSymbolMatches returns whether the symbol (e.g. "main.(*Point).Norm" or "main.Foo[go.shape.int].func1")
+// is the function fn or one of its closures.
+func asmSymbolMatches(symbol string, fn *Function) bool {
+	symbol, found := strings.CutPrefix(symbol, "main.")
+	if !found {
+		return false
+	}
+	symbol = regexpTypeParams.ReplaceAllString(symbol, "")
+	targets := []string{fn.Name}
+	if fn.Receiver != "" {
+		targets = []string{fn.Receiver + "." + fn.Name, "(*" + fn.Receiver + ")." + fn.Name}
+	}
+	for _, target := range targets {
+		if symbol == target {
+			return true
+		}
+		if rest, found := strings.CutPrefix(symbol, target+"."); found &&
+			(strings.HasPrefix(rest, "func") || strings.HasPrefix(rest, "deferwrap") || strings.HasPrefix(rest, "gowrap")) {
+			return true
+		}
+	}
+	return false
+}
+
+// EscapeAnalysis returns the findings of the escape analysis (and inlining decisions) of the compiler for the
+// memorized function (or method, given as `<Type>.<Method>`), mapped to the cell lines.
+func (s *State) EscapeAnalysis(name string) ([]Diagnostic, error) {
+	fn, output, fileToCellIdAndLine, mainLines, err := s.compileMemorized(name, "-m")
+	if err != nil {
+		return nil, err
+	}
+	var cellLines []int
+	for _, line := range fn.CellLines.Lines {
+		if line != NoCursorLine {
+			cellLines = append(cellLines, line)
+		}
+	}
+	if len(cellLines) == 0 {
+		return nil, errors.Errorf("%q was not defined in a cell", name)
+	}
+	firstLine, lastLine := slices.Min(cellLines), slices.Max(cellLines)
+	var diagnostics []Diagnostic
+	for _, d := range parseVetOutput(output, mainLines, fileToCellIdAndLine) {
+		if d.CellId != fn.CellLines.Id || d.Line < firstLine || d.Line > lastLine {
+			continue
+		}
+		d.Source = "escape analysis"
+		if !slices.Contains(diagnostics, d) {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	return diagnostics, nil
+}
+
+// compileMemorized compiles the memorized declarations with the `-gcflags` given, and returns the memorized
+// function with the name (or method, given as `<Type>.<Method>`), the output of the compiler, the mapping of
+// the lines of the code to the cells, and the lines of the code.
+func (s *State) compileMemorized(name, gcflags string) (
+	fn *Function, output string, fileToCellIdAndLine []CellIdAndLine, mainLines []string, err error) {
+	s.composeMu.Lock()
+	defer s.composeMu.Unlock()
+	s.stateMu.Lock()
+	decls := s.Definitions.Copy()
+	fn, err = s.functionVersionLocked(name, 0)
+	s.stateMu.Unlock()
+	if err != nil {
+		return
+	}
+	output, fileToCellIdAndLine, mainLines, err = s.compileDecls(decls, gcflags)
+	return
+}
+
+// stubMainFunction is the `main` function used to compile the memorized declarations, which don't include one.
+func stubMainFunction() *Function {
+	return &Function{
+		Cursor:     NoCursor,
+		CellLines:  CellLines{Id: -1},
+		Key:        "main",
+		Name:       "main",
+		Definition: "func main() {}",
+	}
+}
+
+// compileDecls compiles decls (with a stub `main` function) with the `-gcflags` given, and returns the output
+// of the compiler, the mapping of the lines of the code to the cells, and the lines of the code.
+// It must be called with composeMu locked.
+func (s *State) compileDecls(decls *Declarations, gcflags string) (
+	output string, fileToCellIdAndLine []CellIdAndLine, mainLines []string, err error) {
+	decls = decls.Copy()
+	decls.Functions["main"] = stubMainFunction()
+	var content string
+	content, fileToCellIdAndLine, err = s.composeForRename(decls) // Keeps the names of the `init_*` functions.
+	if err != nil {
+		return
+	}
+	mainLines = strings.Split(content, "\n")
+
+	args := []string{"build", "-o", os.DevNull}
+	args = append(args, s.GoBuildFlags...)
+	args = append(args, s.buildTagsFlags()...)
+	args = append(args, "-gcflags="+gcflags)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = s.TempDir
+	klog.V(2).Infof("Executing %s", cmd)
+	outputBytes, err := cmd.CombinedOutput()
+	output = string(outputBytes)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to compile the memorized declarations with %q:\n%s", cmd, output)
+	}
+	return
+}
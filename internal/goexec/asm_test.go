@@ -0,0 +1,72 @@
+package goexec
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsmSymbolMatches(t *testing.T) {
+	foo := &Function{Name: "Foo"}
+	norm := &Function{Name: "Norm", Receiver: "Point"}
+	for _, tc := range []struct {
+		symbol string
+		fn     *Function
+		want   bool
+	}{
+		{"main.Foo", foo, true},
+		{"main.Foo.func1", foo, true},
+		{"main.Foo[go.shape.int]", foo, true},
+		{"main.FooBar", foo, false},
+		{"fmt.Foo", foo, false},
+		{"main.(*Point).Norm", norm, true},
+		{"main.Point.Norm", norm, true},
+		{"main.Norm", norm, false},
+	} {
+		assert.Equalf(t, tc.want, asmSymbolMatches(tc.symbol, tc.fn), "asmSymbolMatches(%q, %q)", tc.symbol, tc.fn.Key)
+	}
+}
+
+func TestAsmAndEscapeAnalysis(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	cells := []string{
+		"type Point struct{ X, Y int }",
+		"func NewPoint(x int) *Point {\n\tp := &Point{X: x}\n\treturn p\n}",
+		"func (p Point) Sum() int {\n\treturn p.X + p.Y\n}",
+	}
+	for ii, cell := range cells {
+		require.NoError(t, s.MemorizeCell(nil, ii+1, strings.Split(cell, "\n"), MakeSet[int]()))
+	}
+
+	asmLines, err := s.Asm("Point.Sum")
+	require.NoError(t, err)
+	require.NotEmpty(t, asmLines)
+	assert.Equal(t, "main.Point.Sum", asmLines[0].Symbol)
+	var fromCell bool
+	for _, asmLine := range asmLines[1:] {
+		if asmLine.CellId == 3 && asmLine.Line == 1 {
+			fromCell = true
+			assert.Equal(t, "return p.X + p.Y", asmLine.Source)
+		}
+	}
+	assert.True(t, fromCell, "no instruction mapped to cell 3, line 1: %+v", asmLines)
+
+	diagnostics, err := s.EscapeAnalysis("NewPoint")
+	require.NoError(t, err)
+	var escapes bool
+	for _, d := range diagnostics {
+		assert.Equal(t, 2, d.CellId)
+		if d.Line == 1 && strings.Contains(d.Message, "escapes to heap") {
+			escapes = true
+		}
+	}
+	assert.True(t, escapes, "missing escape of &Point{...}: %+v", diagnostics)
+
+	_, err = s.Asm("Missing")
+	assert.Error(t, err)
+}
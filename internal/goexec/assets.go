@@ -0,0 +1,37 @@
+package goexec
+
+import (
+	"os"
+	"path"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"k8s.io/klog/v2"
+)
+
+// AssetsSubdir is the subdirectory of the `%wasm` files location (see SetWasmLocation), under the kernel
+// unique id, where programs publish assets.
+const AssetsSubdir = "assets"
+
+// SetAssetsEnv sets the environment variables GONB_ASSETS_DIR and GONB_ASSETS_URL, with the directory where
+// programs publish files to be served to the front-end (see `gonbui.PublishAsset`), and its URL.
+//
+// The directory is only created by the program, when it publishes something. If the location can't be
+// determined (e.g.: the Jupyter root directory is not known), the variables are unset.
+func (s *State) SetAssetsEnv() {
+	if s.AssetsDir == "" {
+		var err error
+		s.AssetsDir, s.AssetsUrl, err = s.servedLocation(path.Join(s.UniqueID, AssetsSubdir))
+		if err != nil {
+			klog.V(1).Infof("Assets directory not available: %v", err)
+			_ = os.Unsetenv(protocol.GONB_ASSETS_DIR_ENV)
+			_ = os.Unsetenv(protocol.GONB_ASSETS_URL_ENV)
+			return
+		}
+	}
+	if err := os.Setenv(protocol.GONB_ASSETS_DIR_ENV, s.AssetsDir); err != nil {
+		klog.Errorf("Failed to set environment variable %q: %v", protocol.GONB_ASSETS_DIR_ENV, err)
+	}
+	if err := os.Setenv(protocol.GONB_ASSETS_URL_ENV, s.AssetsUrl); err != nil {
+		klog.Errorf("Failed to set environment variable %q: %v", protocol.GONB_ASSETS_URL_ENV, err)
+	}
+}
@@ -0,0 +1,22 @@
+package goexec
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetAssetsEnv(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	baseDir := t.TempDir()
+	s.SetWasmLocation(baseDir, "/assets_url/")
+	s.SetAssetsEnv()
+	assert.Equal(t, path.Join(baseDir, s.UniqueID, AssetsSubdir), os.Getenv(protocol.GONB_ASSETS_DIR_ENV))
+	assert.Equal(t, "/assets_url/"+s.UniqueID+"/"+AssetsSubdir, os.Getenv(protocol.GONB_ASSETS_URL_ENV))
+}
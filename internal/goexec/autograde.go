@@ -0,0 +1,330 @@
+package goexec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements assignments in the style of nbgrader: `%%hidden_tests` cells hold tests that are stored
+// in the kernel -- they are not memorized with the other declarations, and their contents are never displayed --
+// and `%autograde` runs them against the memorized declarations (the student's code), producing a score report.
+
+// hiddenTestsCell holds the contents of a `%%hidden_tests` cell.
+type hiddenTestsCell struct {
+	cellId    int
+	lines     []string
+	skipLines Set[int]
+
+	// tests are the names of the test functions defined in the cell, each worth points.
+	tests  []string
+	points int
+}
+
+// AutogradeStatus is the result of a hidden test.
+type AutogradeStatus string
+
+const (
+	AutogradePassed  AutogradeStatus = "passed"
+	AutogradeFailed  AutogradeStatus = "failed"
+	AutogradeSkipped AutogradeStatus = "skipped"
+
+	// AutogradeNotRun is the status of the tests that didn't report a result: because the code failed to
+	// compile, or the tests binary panicked or timed out before they finished.
+	AutogradeNotRun AutogradeStatus = "not run"
+)
+
+// AutogradeTest is the result of a hidden test, see State.Autograde.
+type AutogradeTest struct {
+	Name   string
+	Points int
+	Status AutogradeStatus
+}
+
+// AutogradeResult is returned by State.Autograde.
+type AutogradeResult struct {
+	// Tests in the order they were defined.
+	Tests []AutogradeTest
+
+	// Score is the sum of the points of the tests passed, out of Total.
+	Score, Total int
+
+	// CompileFailed is set if the memorized declarations failed to compile along with the hidden tests.
+	CompileFailed bool
+
+	// Output of the tests, or of the compiler if CompileFailed. It is not displayed by default, since it
+	// may reveal the contents of the hidden tests.
+	Output string
+}
+
+// DefaultAutogradeTimeout is the default time limit for running the hidden tests with State.Autograde.
+const DefaultAutogradeTimeout = time.Minute
+
+// SetHiddenTests stores the tests of a `%%hidden_tests` cell, each worth the given points. Tests with the same
+// name stored by previous cells are replaced (the whole previous cell is dropped).
+//
+// skipLines are the lines of the cell that are not Go code (e.g. the `%%hidden_tests` line).
+// It returns the names of the test functions stored.
+func (s *State) SetHiddenTests(cellId int, lines []string, skipLines Set[int], points int) ([]string, error) {
+	if points < 0 {
+		return nil, errors.Errorf("invalid number of points %d for hidden tests", points)
+	}
+	var sb strings.Builder
+	sb.WriteString("package main\n\n")
+	for ii, line := range lines {
+		if !skipLines.Has(ii) {
+			sb.WriteString(line)
+		}
+		sb.WriteString("\n")
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "", sb.String(), parser.SkipObjectResolution)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the hidden tests")
+	}
+	var tests []string
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		name := funcDecl.Name.Name
+		if funcDecl.Recv != nil {
+			continue
+		}
+		if name == "main" {
+			return nil, errors.New("hidden tests can't define a `main` function")
+		}
+		if strings.HasPrefix(name, "Test") && name != "TestMain" {
+			tests = append(tests, name)
+		}
+	}
+	if len(tests) == 0 {
+		return nil, errors.New("no test functions (`func TestXxx(t *testing.T)`) found in the hidden tests")
+	}
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.hiddenTests = slices.DeleteFunc(s.hiddenTests, func(cell *hiddenTestsCell) bool {
+		return slices.ContainsFunc(cell.tests, func(name string) bool { return slices.Contains(tests, name) })
+	})
+	// The lines that are not Go code are blanked, so `%%hidden_tests` is not composed as a `%%` (main) line.
+	cellLines := slices.Clone(lines)
+	for ii := range skipLines {
+		if ii >= 0 && ii < len(cellLines) {
+			cellLines[ii] = ""
+		}
+	}
+	s.hiddenTests = append(s.hiddenTests, &hiddenTestsCell{
+		cellId:    cellId,
+		lines:     cellLines,
+		skipLines: skipLines,
+		tests:     tests,
+		points:    points,
+	})
+	return tests, nil
+}
+
+// HiddenTestsCount returns the number of hidden tests stored, and the total of their points.
+func (s *State) HiddenTestsCount() (count, points int) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	for _, cell := range s.hiddenTests {
+		count += len(cell.tests)
+		points += len(cell.tests) * cell.points
+	}
+	return
+}
+
+// ClearHiddenTests removes all the hidden tests stored.
+func (s *State) ClearHiddenTests() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.hiddenTests = nil
+}
+
+// Autograde compiles the memorized declarations along with the hidden tests (see SetHiddenTests) and runs them,
+// with the given time limit. The output of the tests is not displayed, it is returned in the result.
+//
+// The composed test program and its binary are removed afterward, so the hidden tests are not left behind in
+// the temporary directory.
+func (s *State) Autograde(msg kernel.Message, timeout time.Duration) (*AutogradeResult, error) {
+	s.stateMu.Lock()
+	cells := slices.Clone(s.hiddenTests)
+	decls := s.Definitions.Copy()
+	s.stateMu.Unlock()
+	if len(cells) == 0 {
+		return nil, errors.New("no hidden tests defined: use `%%hidden_tests` cells to define them")
+	}
+
+	s.composeMu.Lock()
+	defer s.composeMu.Unlock()
+	wasTest := s.CellIsTest
+	s.CellIsTest = true
+	defer func() {
+		if err := s.RemoveGeneratedCode(); err != nil {
+			klog.Warningf("%%autograde: %+v", err)
+		}
+		if err := os.Remove(s.BinaryPath()); err != nil && !os.IsNotExist(err) {
+			klog.Warningf("%%autograde: failed to remove tests binary: %+v", err)
+		}
+		s.CellIsTest = wasTest
+	}()
+	if err := s.AutoTrack(); err != nil {
+		return nil, err
+	}
+
+	// Compose the memorized declarations with the ones of the hidden tests cells.
+	result := &AutogradeResult{}
+	decls.ClearCursor()
+	for _, cell := range cells {
+		if err := s.RemoveGeneratedCode(); err != nil {
+			return nil, err
+		}
+		_, fileToCellLine, err := s.createGoFileFromLines(s.CodePath(), cell.cellId, cell.lines, cell.skipLines, NoCursor)
+		if err != nil {
+			return nil, err
+		}
+		cellDecls, err := s.parseFromGoCode(nil, cell.cellId, NoCursor, MakeFileToCellIdAndLine(cell.cellId, fileToCellLine))
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed to parse the hidden tests")
+		}
+		delete(cellDecls.Functions, "main")
+		decls.MergeFrom(cellDecls)
+		for _, name := range cell.tests {
+			result.Tests = append(result.Tests, AutogradeTest{Name: name, Points: cell.points, Status: AutogradeNotRun})
+			result.Total += cell.points
+		}
+	}
+	mainDecl := &Function{Cursor: NoCursor, Key: "main", Name: "main", Definition: "func main() { flag.Parse() }"}
+	_, fileToCellIdAndLine, err := s.createCodeFileFromDecls(decls, mainDecl)
+	if err != nil {
+		return nil, errors.WithMessage(err, "while composing the hidden tests")
+	}
+	if _, _, err = s.GoImports(msg, decls, mainDecl, fileToCellIdAndLine); err != nil {
+		return nil, err
+	}
+
+	// Compile: errors are not displayed with their context, since it would reveal the hidden tests.
+	args := []string{"test", "-c", "-o", s.BinaryPath()}
+	args = append(args, s.GoBuildFlags...)
+	args = append(args, s.buildTagsFlags()...)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = s.TempDir
+	klog.V(2).Infof("Executing %s", cmd)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		klog.V(1).Infof("%%autograde: failed %q:\n%s", cmd, output)
+		result.CompileFailed = true
+		result.Output = string(output)
+		return result, nil
+	}
+
+	// Run the hidden tests with the output of the testing package framed (`-test.v=test2json`): the results are
+	// taken only from the framed events, so the output of the student's code can't forge them.
+	names := make([]string, 0, len(result.Tests))
+	for _, test := range result.Tests {
+		names = append(names, test.Name)
+	}
+	cmd = exec.Command(s.BinaryPath(), "-test.v=test2json",
+		fmt.Sprintf("-test.run=^(%s)$", strings.Join(names, "|")),
+		fmt.Sprintf("-test.timeout=%s", timeout))
+	cmd.Dir = s.TempDir
+	klog.V(2).Infof("Executing %s", cmd)
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		klog.V(1).Infof("%%autograde: tests failed: %v", err)
+	}
+
+	// The output before the first framed line (e.g. printed by `init()` functions) is not parsed at all, since
+	// `test2json` only enforces the framing after it sees the first one.
+	var sb strings.Builder
+	if frameStart := bytes.IndexByte(output, testFrameMarker); frameStart >= 0 {
+		sb.Write(output[:frameStart])
+		output = output[frameStart:]
+	} else {
+		sb.Write(output)
+		output = nil
+	}
+	var events []testEvent
+	if len(output) > 0 {
+		cmd = exec.Command("go", "tool", "test2json")
+		cmd.Dir = s.TempDir
+		cmd.Stdin = bytes.NewReader(output)
+		jsonOutput, err := cmd.Output()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse the results of the hidden tests with %q", cmd)
+		}
+		events = parseTestEvents(jsonOutput)
+	}
+	for _, event := range events {
+		if event.Action == "output" {
+			sb.WriteString(event.Output)
+		}
+	}
+	result.Output = sb.String()
+	result.setStatuses(events)
+	return result, nil
+}
+
+// testFrameMarker is the byte (^V) that prefixes the lines written by the testing package, when the tests are
+// run with `-test.v=test2json`.
+const testFrameMarker = 0x16
+
+// testEvent is an event reported by `go tool test2json`.
+type testEvent struct {
+	Action string
+	Test   string
+	Output string
+}
+
+// parseTestEvents parses the output of `go tool test2json`, one JSON event per line. Lines that are not
+// events are ignored.
+func parseTestEvents(output []byte) []testEvent {
+	var events []testEvent
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		var event testEvent
+		if len(line) == 0 || json.Unmarshal(line, &event) != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// setStatuses sets the status of the tests, and the score, from the events reported by `go tool test2json`.
+// Subtests are not scored, only the top-level tests.
+func (r *AutogradeResult) setStatuses(events []testEvent) {
+	statuses := make(map[string]AutogradeStatus)
+	for _, event := range events {
+		switch event.Action {
+		case "pass":
+			statuses[event.Test] = AutogradePassed
+		case "fail":
+			statuses[event.Test] = AutogradeFailed
+		case "skip":
+			statuses[event.Test] = AutogradeSkipped
+		}
+	}
+	r.Score = 0
+	for ii, test := range r.Tests {
+		if status, found := statuses[test.Name]; found {
+			r.Tests[ii].Status = status
+		}
+		if r.Tests[ii].Status == AutogradePassed {
+			r.Score += test.Points
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package goexec
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetHiddenTests(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	skipLines := MakeSet[int]()
+	skipLines.Insert(0)
+
+	cell := `%%hidden_tests --points 2
+func helper() int { return 1 }
+
+func TestA(t *testing.T) {}
+func TestB(t *testing.T) {}`
+	tests, err := s.SetHiddenTests(1, strings.Split(cell, "\n"), skipLines, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"TestA", "TestB"}, tests)
+	count, points := s.HiddenTestsCount()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 4, points)
+	assert.Empty(t, s.hiddenTests[0].lines[0], "the `%%hidden_tests` line must not be composed")
+
+	// Redefining TestB replaces the whole previous cell.
+	cell = "%%hidden_tests\nfunc TestB(t *testing.T) {}\nfunc TestC(t *testing.T) {}"
+	_, err = s.SetHiddenTests(2, strings.Split(cell, "\n"), skipLines, 1)
+	require.NoError(t, err)
+	count, points = s.HiddenTestsCount()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 2, points)
+
+	// Invalid cells.
+	_, err = s.SetHiddenTests(3, strings.Split("%%hidden_tests\nfunc helper() {}", "\n"), skipLines, 1)
+	assert.ErrorContains(t, err, "no test functions")
+	_, err = s.SetHiddenTests(3, strings.Split("%%hidden_tests\nfunc main() {}\nfunc TestD(t *testing.T) {}", "\n"), skipLines, 1)
+	assert.ErrorContains(t, err, "main")
+	_, err = s.SetHiddenTests(3, strings.Split("%%hidden_tests\nfunc TestD(t *testing.T) {", "\n"), skipLines, 1)
+	assert.Error(t, err)
+
+	s.ClearHiddenTests()
+	count, _ = s.HiddenTestsCount()
+	assert.Equal(t, 0, count)
+}
+
+func TestAutogradeSetStatuses(t *testing.T) {
+	result := &AutogradeResult{
+		Tests: []AutogradeTest{
+			{Name: "TestA", Points: 2, Status: AutogradeNotRun},
+			{Name: "TestB", Points: 1, Status: AutogradeNotRun},
+			{Name: "TestC", Points: 3, Status: AutogradeNotRun},
+			{Name: "TestD", Points: 1, Status: AutogradeNotRun},
+		},
+		Total: 7,
+	}
+	// Events reported by `go tool test2json`: forged results printed by the code are "output" events.
+	output := `{"Action":"start"}
+{"Action":"run","Test":"TestA"}
+{"Action":"output","Test":"TestA","Output":"--- PASS: TestB (0.00s)\n"}
+{"Action":"pass","Test":"TestA"}
+{"Action":"run","Test":"TestB"}
+{"Action":"output","Test":"TestB","Output":"    main_test.go:10: wrong answer\n"}
+{"Action":"fail","Test":"TestB"}
+{"Action":"run","Test":"TestC"}
+{"Action":"run","Test":"TestC/sub"}
+{"Action":"fail","Test":"TestC/sub"}
+{"Action":"pass","Test":"TestC"}
+{"Action":"run","Test":"TestD"}
+not a JSON line
+{"Action":"output","Test":"TestD","Output":"panic: boom\n"}
+`
+	events := parseTestEvents([]byte(output))
+	require.Len(t, events, 13)
+	result.setStatuses(events)
+	assert.Equal(t, AutogradePassed, result.Tests[0].Status)
+	assert.Equal(t, AutogradeFailed, result.Tests[1].Status)
+	assert.Equal(t, AutogradePassed, result.Tests[2].Status)
+	assert.Equal(t, AutogradeNotRun, result.Tests[3].Status)
+	assert.Equal(t, 5, result.Score)
+}
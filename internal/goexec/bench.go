@@ -0,0 +1,263 @@
+package goexec
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the benchmarks of the memorized declarations (`%bench`): the memorized `Benchmark*`
+// functions are compiled into a test binary and executed. With `%bench -compare`, they are also executed
+// with a previous version of a function (see FunctionVersion), and the results and the assembly of both
+// versions are compared.
+
+// BenchOptions configure State.RunBenchmarks and State.CompareBenchmarks.
+type BenchOptions struct {
+	// Bench is the regular expression of the benchmarks to run (`-test.bench`). If empty, all are run.
+	Bench string
+
+	// Count is the number of times each benchmark is run (`-test.count`). If 0, it is run once, or
+	// DefaultBenchCompareCount times when comparing.
+	Count int
+
+	// BenchTime is the time (e.g. "2s") or number of iterations (e.g. "100x") of each run (`-test.benchtime`).
+	// If empty, the default of `go test` is used.
+	BenchTime string
+}
+
+// DefaultBenchCompareCount is the default number of runs of each benchmark when comparing, so the
+// variance of the results can be estimated.
+const DefaultBenchCompareCount = 5
+
+// RunBenchmarks runs the memorized benchmarks, and returns their output.
+func (s *State) RunBenchmarks(opts BenchOptions) (string, error) {
+	s.composeMu.Lock()
+	defer s.composeMu.Unlock()
+	s.stateMu.Lock()
+	decls := s.Definitions.Copy()
+	s.stateMu.Unlock()
+	if opts.Count == 0 {
+		opts.Count = 1
+	}
+	return s.runBenchmarksOfDecls(decls, opts)
+}
+
+// BenchComparison holds the results of State.CompareBenchmarks.
+type BenchComparison struct {
+	// Name of the function compared, and Back how many versions back is the old version.
+	Name string
+	Back int
+
+	// OldOutput and NewOutput are the outputs of the benchmarks, with the old and current versions of the function.
+	OldOutput, NewOutput string
+
+	// OldAsm and NewAsm are the assembly of the old and current versions of the function.
+	OldAsm, NewAsm []AsmLine
+}
+
+// CompareBenchmarks runs the memorized benchmarks with a previous version of the function (or method, given
+// as `<Type>.<Method>`), back versions back (see FunctionVersion), and with its current version, and returns
+// their outputs and the assembly of both versions.
+func (s *State) CompareBenchmarks(name string, back int, opts BenchOptions) (*BenchComparison, error) {
+	if back < 1 {
+		return nil, errors.Errorf("the version of %q to compare must be a previous one (HEAD~1 or older)", name)
+	}
+	s.composeMu.Lock()
+	defer s.composeMu.Unlock()
+	s.stateMu.Lock()
+	decls := s.Definitions.Copy()
+	newFn, err := s.functionVersionLocked(name, 0)
+	var oldFn *Function
+	if err == nil {
+		oldFn, err = s.functionVersionLocked(name, back)
+	}
+	s.stateMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Count == 0 {
+		opts.Count = DefaultBenchCompareCount
+	}
+
+	comparison := &BenchComparison{Name: name, Back: back}
+	for _, version := range []struct {
+		fn     *Function
+		label  string
+		output *string
+		asm    *[]AsmLine
+	}{
+		{oldFn, fmt.Sprintf("HEAD~%d", back), &comparison.OldOutput, &comparison.OldAsm},
+		{newFn, "HEAD", &comparison.NewOutput, &comparison.NewAsm},
+	} {
+		versionDecls := decls.Copy()
+		versionDecls.Functions[newFn.Key] = version.fn
+		output, fileToCellIdAndLine, mainLines, err := s.compileDecls(versionDecls, "-S")
+		if err != nil {
+			return nil, errors.WithMessagef(err, "version %s of %q", version.label, name)
+		}
+		*version.asm = parseAsmOutput(output, version.fn, filepath.Base(s.CodePath()), fileToCellIdAndLine, mainLines)
+		*version.output, err = s.runBenchmarksOfDecls(versionDecls, opts)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "version %s of %q", version.label, name)
+		}
+	}
+	return comparison, nil
+}
+
+// runBenchmarksOfDecls compiles decls (with a stub `main` function) into a test binary, and runs the benchmarks.
+// It must be called with composeMu locked.
+func (s *State) runBenchmarksOfDecls(decls *Declarations, opts BenchOptions) (string, error) {
+	hasBenchmarks := false
+	for key := range decls.Functions {
+		if strings.HasPrefix(key, "Benchmark") && !strings.Contains(key, "~") {
+			hasBenchmarks = true
+			break
+		}
+	}
+	if !hasBenchmarks {
+		return "", errors.New("no memorized benchmarks: define `func BenchmarkXxx(b *testing.B)` functions in a cell first")
+	}
+	decls = decls.Copy()
+	decls.Functions["main"] = stubMainFunction()
+	if err := s.RemoveGeneratedCode(); err != nil {
+		return "", err
+	}
+	codePath := path.Join(s.TempDir, MainTestGo)
+	f, err := os.Create(codePath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create %q", codePath)
+	}
+	_, _, err = s.createCodeFromDecls(f, decls, nil)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = errors.Wrapf(closeErr, "failed to close %q", codePath)
+	}
+	defer func() {
+		if err := s.RemoveGeneratedCode(); err != nil {
+			klog.Warningf("Failed to remove the code of the benchmarks: %+v", err)
+		}
+	}()
+	if err != nil {
+		return "", errors.WithMessagef(err, "failed to compose the benchmarks in %q", codePath)
+	}
+
+	binaryPath := path.Join(s.TempDir, s.Package+"_bench.test")
+	args := []string{"test", "-c", "-o", binaryPath}
+	args = append(args, s.GoBuildFlags...)
+	args = append(args, s.buildTagsFlags()...)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = s.TempDir
+	klog.V(2).Infof("Executing %s", cmd)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", errors.Wrapf(err, "failed to compile the benchmarks with %q:\n%s", cmd, output)
+	}
+	defer func() { _ = os.Remove(binaryPath) }()
+
+	bench := opts.Bench
+	if bench == "" {
+		bench = "."
+	}
+	args = []string{"-test.run=^$", "-test.bench=" + bench, "-test.benchmem", "-test.count=" + strconv.Itoa(opts.Count)}
+	if opts.BenchTime != "" {
+		args = append(args, "-test.benchtime="+opts.BenchTime)
+	}
+	cmd = exec.Command(binaryPath, args...)
+	klog.V(2).Infof("Executing %s", cmd)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to run the benchmarks:\n%s", output)
+	}
+	return string(output), nil
+}
+
+// BenchmarkDelta is the comparison of the mean of a metric of a benchmark, see BenchComparison.Deltas.
+type BenchmarkDelta struct {
+	Name, Unit string
+	Old, New   float64
+}
+
+// regexpBenchmarkResult matches a line of the results of a benchmark,
+// e.g. "BenchmarkFoo-8   1000   1234 ns/op   16 B/op   1 allocs/op".
+var regexpBenchmarkResult = regexp.MustCompile(`^(Benchmark\S+)\s+\d+\s+(.*)$`)
+
+// parseBenchmarkMeans parses the output of the benchmarks, and returns the mean of each metric of each benchmark,
+// indexed by benchmark name and unit, and the pairs of benchmark name and unit in the order they appear.
+func parseBenchmarkMeans(output string) (means map[[2]string]float64, order [][2]string) {
+	sums := make(map[[2]string]float64)
+	counts := make(map[[2]string]int)
+	for _, line := range strings.Split(output, "\n") {
+		matches := regexpBenchmarkResult.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			continue
+		}
+		fields := strings.Fields(matches[2])
+		for ii := 0; ii+1 < len(fields); ii += 2 {
+			value, err := strconv.ParseFloat(fields[ii], 64)
+			if err != nil {
+				continue
+			}
+			key := [2]string{matches[1], fields[ii+1]}
+			if counts[key] == 0 {
+				order = append(order, key)
+			}
+			sums[key] += value
+			counts[key]++
+		}
+	}
+	means = make(map[[2]string]float64, len(sums))
+	for key, sum := range sums {
+		means[key] = sum / float64(counts[key])
+	}
+	return
+}
+
+// Deltas returns the comparison of the means of the metrics of each benchmark (time, memory and allocations
+// per operation) that are present in both outputs. It is a simplified version of `benchstat`, for when it
+// is not installed.
+func (c *BenchComparison) Deltas() []BenchmarkDelta {
+	oldMeans, _ := parseBenchmarkMeans(c.OldOutput)
+	newMeans, order := parseBenchmarkMeans(c.NewOutput)
+	var deltas []BenchmarkDelta
+	for _, key := range order {
+		oldMean, found := oldMeans[key]
+		if !found {
+			continue
+		}
+		deltas = append(deltas, BenchmarkDelta{Name: key[0], Unit: key[1], Old: oldMean, New: newMeans[key]})
+	}
+	return deltas
+}
+
+// Benchstat compares the outputs of the benchmarks with `benchstat` (golang.org/x/perf/cmd/benchstat), if
+// it is installed. It returns exec.ErrNotFound otherwise.
+func (c *BenchComparison) Benchstat() (string, error) {
+	benchstatPath, err := exec.LookPath("benchstat")
+	if err != nil {
+		return "", exec.ErrNotFound
+	}
+	dir, err := os.MkdirTemp("", "gonb_benchstat_")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create temporary directory for benchstat")
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	oldPath, newPath := path.Join(dir, fmt.Sprintf("HEAD~%d", c.Back)), path.Join(dir, "HEAD")
+	for filePath, output := range map[string]string{oldPath: c.OldOutput, newPath: c.NewOutput} {
+		if err := os.WriteFile(filePath, []byte(output), 0600); err != nil {
+			return "", errors.Wrapf(err, "failed to write %q", filePath)
+		}
+	}
+	cmd := exec.Command(benchstatPath, path.Base(oldPath), path.Base(newPath))
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to run %q:\n%s", cmd, output)
+	}
+	return string(output), nil
+}
@@ -0,0 +1,71 @@
+package goexec
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRevision(t *testing.T) {
+	for revision, want := range map[string]int{"HEAD": 0, "HEAD~1": 1, "HEAD~12": 12, "HEAD^": 1, "HEAD^^": 2} {
+		back, err := ParseRevision(revision)
+		require.NoErrorf(t, err, "ParseRevision(%q)", revision)
+		assert.Equalf(t, want, back, "ParseRevision(%q)", revision)
+	}
+	for _, revision := range []string{"", "HEAD~", "HEAD~-1", "main", "HEAD~1^"} {
+		_, err := ParseRevision(revision)
+		assert.Errorf(t, err, "ParseRevision(%q) should have failed", revision)
+	}
+}
+
+func TestCompareBenchmarks(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	memorize := func(cellId int, cell string) {
+		require.NoError(t, s.MemorizeCell(nil, cellId, strings.Split(cell, "\n"), MakeSet[int]()))
+	}
+	memorize(1, "func Sum(n int) (total int) {\n\tfor i := range n {\n\t\ttotal += i\n\t}\n\treturn\n}")
+	memorize(2, "import \"testing\"\n\nfunc BenchmarkSum(b *testing.B) {\n\tfor range b.N {\n\t\t_ = Sum(100)\n\t}\n}")
+	memorize(1, "func Sum(n int) int {\n\treturn n * (n - 1) / 2\n}")
+
+	previous, err := s.FunctionVersion("Sum", 1)
+	require.NoError(t, err)
+	assert.Contains(t, previous.Definition, "for i := range n")
+	_, err = s.FunctionVersion("Sum", 2)
+	assert.Error(t, err)
+	_, err = s.CompareBenchmarks("BenchmarkSum", 1, BenchOptions{})
+	assert.Error(t, err, "BenchmarkSum has no previous version")
+
+	output, err := s.RunBenchmarks(BenchOptions{BenchTime: "10x"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "BenchmarkSum")
+
+	comparison, err := s.CompareBenchmarks("Sum", 1, BenchOptions{Count: 2, BenchTime: "10x"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(comparison.OldOutput, "BenchmarkSum"))
+	assert.Equal(t, 2, strings.Count(comparison.NewOutput, "BenchmarkSum"))
+	require.NotEmpty(t, comparison.OldAsm)
+	require.NotEmpty(t, comparison.NewAsm)
+	assert.Equal(t, "main.Sum", comparison.NewAsm[0].Symbol)
+
+	deltas := comparison.Deltas()
+	require.NotEmpty(t, deltas)
+	assert.True(t, strings.HasPrefix(deltas[0].Name, "BenchmarkSum"))
+	assert.Equal(t, "ns/op", deltas[0].Unit)
+}
+
+func TestBenchmarkDeltas(t *testing.T) {
+	comparison := &BenchComparison{
+		OldOutput: "BenchmarkA-8 \t 100 \t 20.0 ns/op \t 8 B/op \t 1 allocs/op\nBenchmarkA-8 \t 100 \t 40.0 ns/op \t 8 B/op \t 1 allocs/op\n",
+		NewOutput: "goos: linux\nBenchmarkA-8 \t 100 \t 10.0 ns/op \t 0 B/op \t 0 allocs/op\nBenchmarkB-8 \t 1 \t 5 ns/op\nPASS\n",
+	}
+	assert.Equal(t, []BenchmarkDelta{
+		{Name: "BenchmarkA-8", Unit: "ns/op", Old: 30, New: 10},
+		{Name: "BenchmarkA-8", Unit: "B/op", Old: 8, New: 0},
+		{Name: "BenchmarkA-8", Unit: "allocs/op", Old: 1, New: 0},
+	}, comparison.Deltas())
+}
@@ -0,0 +1,78 @@
+package goexec
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the build tags (`%tags`): they are passed with `-tags` to `go build` and `go vet`, and
+// the session ones are also given to `gopls` (its `buildFlags` setting), so completion and inspection respect
+// the build constraints.
+
+// reValidBuildTag matches a valid build tag.
+var reValidBuildTag = regexp.MustCompile(`^[\w.]+$`)
+
+// ParseBuildTags parses a list of build tags, separated by commas or spaces (e.g. "integration,linux").
+func ParseBuildTags(list string) ([]string, error) {
+	var tags []string
+	for _, tag := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		if !reValidBuildTag.MatchString(tag) {
+			return nil, errors.Errorf("invalid build tag %q: only letters, digits, '_' and '.' are allowed", tag)
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// SetBuildTags sets the build tags of the session (BuildTags), used in all following builds, and configures
+// `gopls` with them. An empty list removes them.
+func (s *State) SetBuildTags(tags []string) {
+	s.stateMu.Lock()
+	s.BuildTags = slices.Clone(tags)
+	s.stateMu.Unlock()
+
+	gopls := s.goplsClient() // Settings are sent to gopls when it starts, no need to start it on demand.
+	if gopls == nil {
+		return
+	}
+	// Replace only the `-tags` flag of the `buildFlags` setting, which may have been configured with `%gopls`.
+	var buildFlags []any
+	if values, ok := gopls.Settings()["buildFlags"].([]any); ok {
+		buildFlags = slices.DeleteFunc(slices.Clone(values), func(value any) bool {
+			flag, _ := value.(string)
+			return strings.HasPrefix(flag, "-tags=")
+		})
+	}
+	if len(tags) > 0 {
+		buildFlags = append(buildFlags, "-tags="+strings.Join(tags, ","))
+	}
+	var value any
+	if len(buildFlags) > 0 {
+		value = buildFlags
+	}
+	if err := gopls.SetSetting(context.Background(), "buildFlags", value); err != nil {
+		klog.Warningf("Failed to configure gopls with the build tags %q: %+v", tags, err)
+	}
+}
+
+// buildTagsFlags returns the `-tags` flag for `go build` and `go vet` with the build tags of the session
+// and of the current cell, or nil if there are none.
+func (s *State) buildTagsFlags() []string {
+	tags := slices.Clone(s.BuildTags)
+	for _, tag := range s.CellBuildTags {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return []string{"-tags=" + strings.Join(tags, ",")}
+}
@@ -0,0 +1,34 @@
+package goexec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBuildTags(t *testing.T) {
+	tags, err := ParseBuildTags("integration,linux integration go1.23")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"integration", "linux", "go1.23"}, tags)
+	tags, err = ParseBuildTags("")
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+	_, err = ParseBuildTags("linux,!windows")
+	assert.Error(t, err)
+}
+
+func TestBuildTagsFlags(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	assert.Nil(t, s.buildTagsFlags())
+	s.SetBuildTags([]string{"integration", "linux"})
+	assert.Equal(t, []string{"-tags=integration,linux"}, s.buildTagsFlags())
+	s.CellBuildTags = []string{"linux", "slow"}
+	assert.Equal(t, []string{"-tags=integration,linux,slow"}, s.buildTagsFlags())
+	s.PostExecuteCell()
+	assert.Nil(t, s.CellBuildTags)
+	s.SetBuildTags(nil)
+	assert.Nil(t, s.buildTagsFlags())
+}
@@ -0,0 +1,304 @@
+package goexec
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+	"io"
+	"k8s.io/klog/v2"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// This file implements the capturing of the output of a cell execution, configured with `%capture`.
+
+// CaptureFormat defines how the output of a cell is saved by `%capture`.
+type CaptureFormat int
+
+const (
+	// CaptureText saves stdout, stderr and the text contents of displayed data to a plain text file.
+	CaptureText CaptureFormat = iota
+
+	// CaptureNotebook saves the outputs to an `.ipynb` file, with one code cell holding all
+	// outputs (streams and rich display data) of the captured execution.
+	CaptureNotebook
+
+	// CaptureDirectory saves stdout and stderr to the file `output.txt`, and each displayed
+	// data (HTML, images, markdown, etc.) to its own file, in the given directory.
+	CaptureDirectory
+)
+
+// CaptureTextFileName is the name of the file holding stdout/stderr when capturing to a directory.
+const CaptureTextFileName = "output.txt"
+
+// Capture holds the outputs being captured from the execution of a cell.
+// It is created by NewCapture, and it is closed at the end of the execution of the cell (see State.PostExecuteCell).
+type Capture struct {
+	// Path where to save the captured output.
+	Path string
+
+	// Format of the captured output, based on Path.
+	Format CaptureFormat
+
+	// Quiet indicates that the output is only captured, and not displayed in the notebook.
+	Quiet bool
+
+	mu sync.Mutex
+
+	// textFile for CaptureText and CaptureDirectory formats.
+	textFile *os.File
+
+	// notebook is the contents of the captured notebook (CaptureNotebook format), and outputs
+	// are the outputs of the current cell being captured.
+	notebook map[string]any
+	outputs  []map[string]any
+
+	// numAssets saved so far, for CaptureDirectory format.
+	numAssets int
+}
+
+// NewCapture creates a Capture to the given filePath. The format is chosen based on the filePath:
+//
+//   - If it ends with ".ipynb" it is saved as a notebook (CaptureNotebook).
+//   - If it ends with "/" or if it is an existing directory, it is saved to a directory (CaptureDirectory).
+//   - Otherwise, the output is saved as plain text (CaptureText).
+//
+// If appendTo is true, the captured contents are appended to the existing file (or directory).
+// Otherwise, previous contents are overwritten. If quiet is true, the output is not displayed.
+func NewCapture(filePath string, appendTo, quiet bool) (c *Capture, err error) {
+	c = &Capture{Path: filePath, Quiet: quiet, Format: CaptureText}
+	if strings.HasSuffix(filePath, ".ipynb") {
+		c.Format = CaptureNotebook
+	} else if strings.HasSuffix(filePath, "/") {
+		c.Format = CaptureDirectory
+	} else if fileInfo, statErr := os.Stat(filePath); statErr == nil && fileInfo.IsDir() {
+		c.Format = CaptureDirectory
+	}
+
+	switch c.Format {
+	case CaptureText:
+		c.textFile, err = openCaptureTextFile(filePath, appendTo)
+	case CaptureNotebook:
+		err = c.loadNotebook(appendTo)
+	case CaptureDirectory:
+		err = c.openDirectory(appendTo)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func openCaptureTextFile(filePath string, appendTo bool) (f *os.File, err error) {
+	if appendTo {
+		f, err = os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			err = errors.Wrapf(err, "failed to append to \"%%capture\" file %q", filePath)
+		}
+		return
+	}
+	f, err = os.Create(filePath)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to create \"%%capture\" file %q", filePath)
+	}
+	return
+}
+
+// loadNotebook loads the previous notebook, if appending, or creates a new empty one.
+func (c *Capture) loadNotebook(appendTo bool) error {
+	if appendTo {
+		contents, err := os.ReadFile(c.Path)
+		if err == nil {
+			err = json.Unmarshal(contents, &c.notebook)
+			if err != nil {
+				return errors.Wrapf(err, "failed to parse notebook %q to append captured output", c.Path)
+			}
+		} else if !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to read notebook %q to append captured output", c.Path)
+		}
+	}
+	if c.notebook == nil {
+		c.notebook = map[string]any{
+			"cells":          []any{},
+			"metadata":       map[string]any{},
+			"nbformat":       4,
+			"nbformat_minor": 5,
+		}
+	}
+	// Check we can write to the file, so errors are reported early.
+	f, err := os.OpenFile(c.Path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create \"%%capture\" notebook %q", c.Path)
+	}
+	return f.Close()
+}
+
+// openDirectory creates the directory if needed, and opens the text file for the stdout/stderr streams.
+// If appending, it also counts the previously saved assets, so they are not overwritten.
+func (c *Capture) openDirectory(appendTo bool) (err error) {
+	err = os.MkdirAll(c.Path, 0755)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create \"%%capture\" directory %q", c.Path)
+	}
+	if appendTo {
+		entries, err := os.ReadDir(c.Path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read \"%%capture\" directory %q", c.Path)
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), "display_") {
+				c.numAssets++
+			}
+		}
+	}
+	c.textFile, err = openCaptureTextFile(path.Join(c.Path, CaptureTextFileName), appendTo)
+	return
+}
+
+// Stream returns a writer that captures the output stream with the given name ("stdout" or "stderr").
+func (c *Capture) Stream(name string) io.Writer {
+	return &captureStreamWriter{c: c, name: name}
+}
+
+type captureStreamWriter struct {
+	c    *Capture
+	name string
+}
+
+// Write implements io.Writer.
+func (w *captureStreamWriter) Write(p []byte) (n int, err error) {
+	c := w.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Format != CaptureNotebook {
+		return c.textFile.Write(p)
+	}
+
+	// Consecutive writes to the same stream are merged into one output.
+	if len(c.outputs) > 0 {
+		last := c.outputs[len(c.outputs)-1]
+		if last["output_type"] == "stream" && last["name"] == w.name {
+			last["text"] = last["text"].(string) + string(p)
+			return len(p), nil
+		}
+	}
+	c.outputs = append(c.outputs, map[string]any{
+		"output_type": "stream",
+		"name":        w.name,
+		"text":        string(p),
+	})
+	return len(p), nil
+}
+
+// Write implements io.Writer, and it is used to capture the text contents of the display data,
+// if the capture is not able to capture rich content.
+// It's equivalent to writing to the "stdout" stream.
+func (c *Capture) Write(p []byte) (n int, err error) {
+	return c.Stream("stdout").Write(p)
+}
+
+// CaptureDisplayData implements jpyexec.DisplayDataCapturer.
+func (c *Capture) CaptureDisplayData(data *protocol.DisplayData) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.Format {
+	case CaptureText:
+		// Only text contents are captured.
+		for _, content := range data.Data {
+			if str, ok := content.(string); ok {
+				if _, err := c.textFile.Write([]byte(str)); err != nil {
+					return errors.Wrapf(err, "failed to write to \"%%capture\" file %q", c.Path)
+				}
+			}
+		}
+
+	case CaptureNotebook:
+		output := map[string]any{
+			"output_type": "display_data",
+			"data":        data.Data,
+			"metadata":    map[string]any{},
+		}
+		if len(data.Metadata) > 0 {
+			output["metadata"] = data.Metadata
+		}
+		c.outputs = append(c.outputs, output)
+
+	case CaptureDirectory:
+		c.numAssets++
+		for mimeType, content := range data.Data {
+			assetPath := path.Join(c.Path, fmt.Sprintf("display_%03d%s", c.numAssets, mimeTypeExtension(mimeType)))
+			var contents []byte
+			switch v := content.(type) {
+			case string:
+				contents = []byte(v)
+			case []byte:
+				contents = v
+			default:
+				klog.Warningf("%%capture: display data with mime-type %q of unknown type %T not saved", mimeType, content)
+				continue
+			}
+			if err := os.WriteFile(assetPath, contents, 0644); err != nil {
+				return errors.Wrapf(err, "failed to write captured display data to %q", assetPath)
+			}
+		}
+	}
+	return nil
+}
+
+// mimeTypeExtension returns the file extension used to save the given mime-type.
+func mimeTypeExtension(mimeType protocol.MIMEType) string {
+	switch mimeType {
+	case protocol.MIMETextHTML:
+		return ".html"
+	case protocol.MIMETextJavascript:
+		return ".js"
+	case protocol.MIMETextMarkdown:
+		return ".md"
+	case protocol.MIMETextPlain:
+		return ".txt"
+	case protocol.MIMEImagePNG:
+		return ".png"
+	case protocol.MIMEImageSVG:
+		return ".svg"
+	}
+	return ".data"
+}
+
+// Close implements io.Closer. It flushes the captured contents, if needed, and closes the open files.
+func (c *Capture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Format == CaptureNotebook {
+		cells, _ := c.notebook["cells"].([]any)
+		outputs := c.outputs
+		if outputs == nil {
+			outputs = []map[string]any{}
+		}
+		c.notebook["cells"] = append(cells, map[string]any{
+			"cell_type":       "code",
+			"execution_count": nil,
+			"metadata":        map[string]any{},
+			"source":          []string{},
+			"outputs":         outputs,
+		})
+		c.outputs = nil
+		contents, err := json.MarshalIndent(c.notebook, "", " ")
+		if err != nil {
+			return errors.Wrapf(err, "failed to encode captured notebook %q", c.Path)
+		}
+		err = os.WriteFile(c.Path, contents, 0644)
+		if err != nil {
+			return errors.Wrapf(err, "failed to write captured notebook %q", c.Path)
+		}
+		return nil
+	}
+	if c.textFile == nil {
+		return nil
+	}
+	err := c.textFile.Close()
+	c.textFile = nil
+	return err
+}
@@ -0,0 +1,71 @@
+package goexec
+
+import (
+	"encoding/json"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Plain text capture.
+	textPath := path.Join(tmpDir, "out.txt")
+	c, err := NewCapture(textPath, false, true)
+	require.NoError(t, err)
+	assert.Equal(t, CaptureText, c.Format)
+	_, _ = c.Stream("stdout").Write([]byte("Ping\n"))
+	require.NoError(t, c.CaptureDisplayData(&protocol.DisplayData{
+		Data: map[protocol.MIMEType]any{protocol.MIMETextHTML: "<b>Pong</b>\n"}}))
+	require.NoError(t, c.Close())
+	contents, err := os.ReadFile(textPath)
+	require.NoError(t, err)
+	assert.Equal(t, "Ping\n<b>Pong</b>\n", string(contents))
+
+	// Notebook capture, appended twice.
+	nbPath := path.Join(tmpDir, "out.ipynb")
+	for ii := 0; ii < 2; ii++ {
+		c, err = NewCapture(nbPath, true, false)
+		require.NoError(t, err)
+		assert.Equal(t, CaptureNotebook, c.Format)
+		_, _ = c.Stream("stdout").Write([]byte("Ping\n"))
+		_, _ = c.Stream("stdout").Write([]byte("Pong\n"))
+		_, _ = c.Stream("stderr").Write([]byte("Oops\n"))
+		require.NoError(t, c.CaptureDisplayData(&protocol.DisplayData{
+			Data: map[protocol.MIMEType]any{protocol.MIMEImagePNG: []byte{1, 2, 3}}}))
+		require.NoError(t, c.Close())
+	}
+	contents, err = os.ReadFile(nbPath)
+	require.NoError(t, err)
+	var nb struct {
+		Cells []struct {
+			Outputs []map[string]any `json:"outputs"`
+		} `json:"cells"`
+	}
+	require.NoError(t, json.Unmarshal(contents, &nb))
+	require.Len(t, nb.Cells, 2)
+	outputs := nb.Cells[1].Outputs
+	require.Len(t, outputs, 3)
+	assert.Equal(t, "Ping\nPong\n", outputs[0]["text"])
+	assert.Equal(t, "stderr", outputs[1]["name"])
+	assert.Equal(t, "display_data", outputs[2]["output_type"])
+	assert.Equal(t, "AQID", outputs[2]["data"].(map[string]any)["image/png"])
+
+	// Directory capture.
+	dirPath := path.Join(tmpDir, "assets") + "/"
+	c, err = NewCapture(dirPath, false, true)
+	require.NoError(t, err)
+	assert.Equal(t, CaptureDirectory, c.Format)
+	_, _ = c.Stream("stdout").Write([]byte("Ping\n"))
+	require.NoError(t, c.CaptureDisplayData(&protocol.DisplayData{
+		Data: map[protocol.MIMEType]any{protocol.MIMETextHTML: "<b>Pong</b>"}}))
+	require.NoError(t, c.Close())
+	assert.FileExists(t, path.Join(dirPath, CaptureTextFileName))
+	contents, err = os.ReadFile(path.Join(dirPath, "display_001.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "<b>Pong</b>", string(contents))
+}
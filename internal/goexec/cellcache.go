@@ -0,0 +1,150 @@
+package goexec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements the cache of the outputs of cells (see `%%cache`): the outputs of a cell are stored
+// under a key derived from its inputs, and replayed, instead of executing the cell again, while the inputs
+// don't change.
+
+// CellCacheDirEnv is the environment variable that can be used to change the directory where the outputs of
+// the cells are cached. If not set, `gonb/cell_cache` under the user's cache directory is used.
+const CellCacheDirEnv = "GONB_CELL_CACHE_DIR"
+
+// CellCacheEntry is the cached outputs of a cell.
+type CellCacheEntry struct {
+	Key     string                  `json:"key"`
+	Created time.Time               `json:"created"`
+	Outputs []kernel.RecordedOutput `json:"outputs"`
+}
+
+// CellCacheDir returns the directory where the outputs of the cells are cached.
+func CellCacheDir() (string, error) {
+	if dir := os.Getenv(CellCacheDirEnv); dir != "" {
+		return ReplaceTildeInDir(dir), nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to find user cache directory, set %s to configure one", CellCacheDirEnv)
+	}
+	return path.Join(cacheDir, "gonb", "cell_cache"), nil
+}
+
+// CellCacheKey returns the key of the cell outputs in the cache: a hash of the userKey (given to `%%cache`),
+// the cell contents, the memorized declarations, and the `go.mod` and `go.sum` files.
+func (s *State) CellCacheKey(userKey string, lines []string) (string, error) {
+	h := sha256.New()
+	writePart := func(name string, contents []byte) {
+		_, _ = fmt.Fprintf(h, "%s:%d\n", name, len(contents))
+		_, _ = h.Write(contents)
+	}
+	writePart("key", []byte(userKey))
+	writePart("cell", []byte(strings.Join(lines, "\n")))
+	var definitions bytes.Buffer
+	if _, _, err := s.createCodeFromDecls(&definitions, s.Definitions, nil); err != nil {
+		return "", errors.WithMessage(err, "failed to render memorized definitions for the cache key")
+	}
+	writePart("definitions", definitions.Bytes())
+	for _, name := range []string{"go.mod", "go.sum"} {
+		contents, err := os.ReadFile(path.Join(s.TempDir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return "", errors.Wrapf(err, "failed to read %q for the cache key", name)
+		}
+		writePart(name, contents)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// cellCacheEntryPath returns the path of the cache entry for the key.
+func cellCacheEntryPath(key string) (string, error) {
+	dir, err := CellCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, key+".json"), nil
+}
+
+// LoadCellCache returns the cached outputs for the key, or nil if they are not cached.
+func LoadCellCache(key string) (*CellCacheEntry, error) {
+	entryPath, err := cellCacheEntryPath(key)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(entryPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to read cache entry %q", entryPath)
+	}
+	entry := &CellCacheEntry{}
+	if err := json.Unmarshal(contents, entry); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode cache entry %q", entryPath)
+	}
+	return entry, nil
+}
+
+// SaveCellCache stores the outputs of a cell under the key.
+func SaveCellCache(key string, outputs []kernel.RecordedOutput) error {
+	entryPath, err := cellCacheEntryPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(entryPath), 0700); err != nil {
+		return errors.Wrapf(err, "failed to create cache directory %q", path.Dir(entryPath))
+	}
+	contents, err := json.Marshal(&CellCacheEntry{Key: key, Created: time.Now(), Outputs: outputs})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode cache entry")
+	}
+	// Write to a temporary file first, so concurrent kernels never read a partial entry.
+	tmpPath := entryPath + ".tmp"
+	if err := os.WriteFile(tmpPath, contents, 0600); err != nil {
+		return errors.Wrapf(err, "failed to write cache entry %q", tmpPath)
+	}
+	if err := os.Rename(tmpPath, entryPath); err != nil {
+		return errors.Wrapf(err, "failed to write cache entry %q", entryPath)
+	}
+	return nil
+}
+
+// MemorizeCell parses the cell and memorizes its declarations, without compiling or executing it.
+// It is used when the outputs of a cell are replayed from the cache.
+func (s *State) MemorizeCell(msg kernel.Message, cellId int, lines []string, skipLines Set[int]) error {
+	params := &cellExecParams{
+		msg:          msg,
+		cellId:       cellId,
+		lines:        lines,
+		skipLines:    skipLines,
+		memorizeOnly: true,
+		done:         NewLatchWithValue[error](),
+	}
+	s.cellExecChan <- params
+	return params.done.Wait()
+}
+
+// memorizeCellImpl implements MemorizeCell. It should only be called by serializeExecuteCell.
+func (s *State) memorizeCellImpl(msg kernel.Message, cellId int, lines []string, skipLines Set[int]) error {
+	defer s.PostExecuteCell()
+	s.composeMu.Lock()
+	defer s.composeMu.Unlock()
+	updatedDecls, _, _, _, err := s.parseLinesAndComposeMain(msg, cellId, lines, skipLines, NoCursor)
+	if err != nil {
+		return err
+	}
+	s.recordFunctionHistory(updatedDecls)
+	s.setDefinitions(updatedDecls)
+	return nil
+}
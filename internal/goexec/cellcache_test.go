@@ -0,0 +1,40 @@
+package goexec
+
+import (
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestCellCache(t *testing.T) {
+	t.Setenv(CellCacheDirEnv, t.TempDir())
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	lines := strings.Split("func f() int { return 1 }", "\n")
+	key, err := s.CellCacheKey("", lines)
+	require.NoError(t, err)
+	otherKey, err := s.CellCacheKey("other", lines)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, otherKey)
+
+	entry, err := LoadCellCache(key)
+	require.NoError(t, err)
+	assert.Nil(t, entry)
+	outputs := []kernel.RecordedOutput{{MsgType: "stream", Content: []byte(`{"name":"stdout","text":"1\n"}`)}}
+	require.NoError(t, SaveCellCache(key, outputs))
+	entry, err = LoadCellCache(key)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	assert.Equal(t, outputs, entry.Outputs)
+
+	// Memorizing the cell changes the memorized definitions, and hence the key.
+	require.NoError(t, s.MemorizeCell(nil, 1, lines, MakeSet[int]()))
+	assert.Contains(t, s.Definitions.Functions, "f")
+	newKey, err := s.CellCacheKey("", lines)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, newKey)
+}
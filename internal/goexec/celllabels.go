@@ -0,0 +1,73 @@
+package goexec
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// This file implements the labels of cells (`%label`) and the declaration of their dependencies (`%requires`):
+// the kernel keeps track of the labels of the cells that ran in the session, and `%run_needed` asks the front-end
+// to execute the cells required that haven't.
+
+// cellAttributeCommands are the `%%` commands that declare attributes of a Go cell: unlike `%%` (optionally
+// followed by the program arguments), they don't start a `func main()`.
+var cellAttributeCommands = []string{"%%label", "%%requires"}
+
+// isCellAttributeLine returns whether the (trimmed) line is one of cellAttributeCommands.
+func isCellAttributeLine(line string) bool {
+	fields := strings.Fields(line)
+	return len(fields) > 0 && slices.Contains(cellAttributeCommands, fields[0])
+}
+
+// regexpCellLabel matches valid cell labels.
+var regexpCellLabel = regexp.MustCompile(`^[\w.-]+$`)
+
+// ValidateCellLabel returns an error if label is not a valid cell label: only letters, digits, `_`, `.`
+// and `-` are accepted.
+func ValidateCellLabel(label string) error {
+	if !regexpCellLabel.MatchString(label) {
+		return errors.Errorf("invalid cell label %q: only letters, digits, \"_\", \".\" and \"-\" are accepted", label)
+	}
+	return nil
+}
+
+// SetCellLabel records that the cell cellId, labeled label, ran in the session.
+func (s *State) SetCellLabel(label string, cellId int) error {
+	if err := ValidateCellLabel(label); err != nil {
+		return err
+	}
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.cellLabels == nil {
+		s.cellLabels = make(map[string]int)
+	}
+	s.cellLabels[label] = cellId
+	return nil
+}
+
+// LabelsRun returns the labels of the cells that ran in the session, sorted.
+func (s *State) LabelsRun() []string {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	labels := make([]string, 0, len(s.cellLabels))
+	for label := range s.cellLabels {
+		labels = append(labels, label)
+	}
+	slices.Sort(labels)
+	return labels
+}
+
+// MissingLabels returns the labels (in the given order) of the cells that didn't run in the session.
+func (s *State) MissingLabels(labels []string) (missing []string) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	for _, label := range labels {
+		if _, found := s.cellLabels[label]; !found {
+			missing = append(missing, label)
+		}
+	}
+	return
+}
@@ -0,0 +1,44 @@
+package goexec
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCellLabels(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	require.NoError(t, s.SetCellLabel("setupData", 1))
+	require.NoError(t, s.SetCellLabel("model.v2", 2))
+	assert.Error(t, s.SetCellLabel("</script>", 3))
+	assert.Equal(t, []string{"model.v2", "setupData"}, s.LabelsRun())
+	assert.Equal(t, []string{"train", "eval"}, s.MissingLabels([]string{"setupData", "train", "eval"}))
+
+	require.NoError(t, s.SoftReset(true))
+	assert.Empty(t, s.LabelsRun())
+}
+
+func TestCellAttributeLines(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	// `%%label` and `%%requires` don't start a `func main()`, but `%%` does.
+	cellLines := strings.Split("%%label setup\n%%requires data\nvar x = 1\n%%\nfmt.Println(x)", "\n")
+	skipLines := MakeSet[int]()
+	skipLines.Insert(0)
+	skipLines.Insert(1)
+	skipLines.Insert(3)
+	_, _, err := s.createGoFileFromLines(s.CodePath(), 1, cellLines, skipLines, NoCursor)
+	require.NoError(t, err)
+	content, err := os.ReadFile(s.CodePath())
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(content), "func main()"))
+	assert.NotContains(t, string(content), "%%")
+	assert.Less(t, strings.Index(string(content), "var x = 1"), strings.Index(string(content), "func main()"))
+}
@@ -0,0 +1,206 @@
+package goexec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// This file implements the optional external completion provider: an external command or HTTP endpoint
+// (e.g. a locally running LLM) whose suggestions are merged with those of gopls.
+// It is disabled by default.
+
+// CompletionProviderEnv is the environment variable that configures the external completion provider,
+// if the `--completion_provider` flag is not given. See NewCompletionProvider for the format.
+const CompletionProviderEnv = "GONB_COMPLETION_PROVIDER"
+
+// CompletionProviderTimeout is the maximum time waited for an external completion provider.
+// After that its suggestions are ignored.
+var CompletionProviderTimeout = 2 * time.Second
+
+// CompletionProviderType is used in the `_jupyter_types_experimental` metadata of the `complete_reply`
+// to mark the suggestions that came from the external completion provider.
+const CompletionProviderType = "external"
+
+// CompletionRequest is sent (JSON encoded) to the external completion provider.
+type CompletionRequest struct {
+	// Code of the cell being edited.
+	Code string `json:"code"`
+
+	// CursorLine and CursorCol (in bytes) are 0-based.
+	CursorLine int `json:"cursor_line"`
+	CursorCol  int `json:"cursor_col"`
+
+	// Prefix is the text immediately before the cursor that will be replaced by the suggestions.
+	// Usually the partially typed identifier, and it may be empty.
+	Prefix string `json:"prefix"`
+}
+
+// CompletionResponse is the JSON expected back from the external completion provider.
+// Each match replaces CompletionRequest.Prefix.
+type CompletionResponse struct {
+	Matches []string `json:"matches"`
+}
+
+// CompletionProvider is an external source of auto-complete suggestions.
+type CompletionProvider interface {
+	Complete(ctx context.Context, req *CompletionRequest) ([]string, error)
+}
+
+// NewCompletionProvider creates a CompletionProvider from its specification:
+//
+//   - "": no provider, it returns nil.
+//   - URL starting with "http://" or "https://": the CompletionRequest is POSTed as JSON to the URL.
+//   - Anything else is taken as a command line (split on spaces, no shell interpretation): the
+//     CompletionRequest is written as JSON to the command's standard input.
+//
+// In both cases the provider must reply with a CompletionResponse in JSON.
+func NewCompletionProvider(spec string) (CompletionProvider, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return &httpCompletionProvider{url: spec}, nil
+	}
+	args := strings.Fields(spec)
+	cmdPath, err := exec.LookPath(args[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "completion provider command %q not found", args[0])
+	}
+	args[0] = cmdPath
+	return &commandCompletionProvider{args: args}, nil
+}
+
+type httpCompletionProvider struct {
+	url string
+}
+
+// Complete implements CompletionProvider.
+func (p *httpCompletionProvider) Complete(ctx context.Context, req *CompletionRequest) ([]string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode completion request")
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request to completion provider %q", p.url)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request to completion provider %q failed", p.url)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("completion provider %q returned status %q", p.url, resp.Status)
+	}
+	var response CompletionResponse
+	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode response from completion provider %q", p.url)
+	}
+	return response.Matches, nil
+}
+
+type commandCompletionProvider struct {
+	args []string
+}
+
+// Complete implements CompletionProvider.
+func (p *commandCompletionProvider) Complete(ctx context.Context, req *CompletionRequest) ([]string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode completion request")
+	}
+	cmd := exec.CommandContext(ctx, p.args[0], p.args[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "completion provider %q failed", cmd)
+	}
+	var response CompletionResponse
+	if err = json.Unmarshal(output, &response); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode response from completion provider %q", cmd)
+	}
+	return response.Matches, nil
+}
+
+// MergeProviderCompletions queries the external CompletionProvider, if one is configured, and appends its
+// suggestions to the reply, marking them with CompletionProviderType in the `_jupyter_types_experimental`
+// metadata.
+//
+// It should be called after the gopls completions were filled in reply. Errors from the provider are only logged.
+func (s *State) MergeProviderCompletions(cellLines []string, cursorLine, cursorCol int, reply *kernel.CompleteReply) {
+	if s.CompletionProvider == nil || cursorLine >= len(cellLines) {
+		return
+	}
+	line := cellLines[cursorLine]
+	cursorCol = min(cursorCol, len(line))
+
+	// Find the text to be replaced: either what gopls is already replacing, or the identifier before the cursor.
+	var prefix string
+	if replaceLen := reply.CursorEnd - reply.CursorStart; replaceLen > 0 {
+		before := utf16.Encode([]rune(line[:cursorCol]))
+		prefix = string(utf16.Decode(before[max(len(before)-replaceLen, 0):]))
+	} else if len(reply.Matches) == 0 {
+		start := cursorCol
+		for start > 0 {
+			r, size := utf8.DecodeLastRuneInString(line[:start])
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+				break
+			}
+			start -= size
+		}
+		prefix = line[start:cursorCol]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), CompletionProviderTimeout)
+	defer cancel()
+	matches, err := s.CompletionProvider.Complete(ctx, &CompletionRequest{
+		Code:       strings.Join(cellLines, "\n"),
+		CursorLine: cursorLine,
+		CursorCol:  cursorCol,
+		Prefix:     prefix,
+	})
+	if err != nil {
+		klog.Warningf("External completion provider failed: %+v", err)
+		return
+	}
+	if len(matches) == 0 {
+		return
+	}
+	if len(reply.Matches) == 0 {
+		reply.CursorStart = reply.CursorEnd - len(utf16.Encode([]rune(prefix)))
+	}
+
+	// Mark the origin of each match.
+	types := make([]map[string]any, 0, len(reply.Matches)+len(matches))
+	seen := make(map[string]bool, len(reply.Matches))
+	for _, match := range reply.Matches {
+		seen[match] = true
+		types = append(types, map[string]any{"start": reply.CursorStart, "end": reply.CursorEnd, "text": match})
+	}
+	for _, match := range matches {
+		if match == "" || seen[match] {
+			continue
+		}
+		seen[match] = true
+		reply.Matches = append(reply.Matches, match)
+		types = append(types, map[string]any{
+			"start": reply.CursorStart, "end": reply.CursorEnd, "text": match, "type": CompletionProviderType})
+	}
+	if reply.Metadata == nil {
+		reply.Metadata = make(kernel.MIMEMap)
+	}
+	reply.Metadata["_jupyter_types_experimental"] = types
+}
@@ -0,0 +1,60 @@
+package goexec
+
+import (
+	"encoding/json"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMergeProviderCompletions(t *testing.T) {
+	// The handler runs in the server goroutine: requests and decoding errors are sent back to the test goroutine.
+	requests := make(chan CompletionRequest, 1)
+	decodeErrs := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req CompletionRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		decodeErrs <- err
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests <- req
+		_ = json.NewEncoder(w).Encode(&CompletionResponse{Matches: []string{"Println", "PrintAll"}})
+	}))
+	defer server.Close()
+
+	provider, err := NewCompletionProvider(server.URL)
+	require.NoError(t, err)
+	s := &State{CompletionProvider: provider}
+
+	// No gopls matches: the identifier before the cursor is replaced.
+	lines := []string{"import \"fmt\"", "fmt.Pri"}
+	reply := &kernel.CompleteReply{CursorStart: 20, CursorEnd: 20}
+	s.MergeProviderCompletions(lines, 1, 7, reply)
+	require.NoError(t, <-decodeErrs)
+	received := <-requests
+	assert.Equal(t, "Pri", received.Prefix)
+	assert.Equal(t, 1, received.CursorLine)
+	assert.Equal(t, []string{"Println", "PrintAll"}, reply.Matches)
+	assert.Equal(t, 17, reply.CursorStart)
+
+	// Merged with gopls matches, without duplicates.
+	reply = &kernel.CompleteReply{Matches: []string{"Println", "Printf"}, CursorStart: 17, CursorEnd: 20}
+	s.MergeProviderCompletions(lines, 1, 7, reply)
+	require.NoError(t, <-decodeErrs)
+	<-requests
+	assert.Equal(t, []string{"Println", "Printf", "PrintAll"}, reply.Matches)
+	types := reply.Metadata["_jupyter_types_experimental"].([]map[string]any)
+	require.Len(t, types, 3)
+	assert.NotContains(t, types[0], "type")
+	assert.Equal(t, CompletionProviderType, types[2]["type"])
+
+	// Disabled by default.
+	provider, err = NewCompletionProvider("")
+	require.NoError(t, err)
+	assert.Nil(t, provider)
+}
@@ -198,11 +198,12 @@ func (d *Declarations) RenderFunctions(w *WriterWithCursor, fileToCellIdAndLine
 		return cursor, fileToCellIdAndLine
 	}
 
-	for _, key := range SortedKeys(d.Functions) {
+	for _, key := range d.functionKeysInRenderOrder() {
 		funcDecl := d.Functions[key]
 
 		// First render the corresponding comments.
-		tmpCursor, fileToCellIdAndLine := funcDecl.Comments.Render(w, fileToCellIdAndLine)
+		var tmpCursor Cursor
+		tmpCursor, fileToCellIdAndLine = funcDecl.Comments.Render(w, fileToCellIdAndLine)
 		if tmpCursor != NoCursor {
 			// Cursor in comment, register it.
 			cursor = tmpCursor
@@ -353,9 +354,10 @@ func (s *State) createGoFileFromLines(filePath string, cellId int, lines []strin
 	cursorInFile Cursor, fileToCellLines []int, err error) {
 	cursorInFile = NoCursor
 
-	// Maximum number of extra Lines created is 5, so we create a map with that amount of line. Later we trim it
-	// to the correct number.
-	fileToCellLines = make([]int, len(lines)+5)
+	// Maximum number of extra Lines created is 6, plus the ones of the template of the `main` function, so we
+	// create a map with that amount of line. Later we trim it to the correct number.
+	tmpl := s.currentMainTemplate()
+	fileToCellLines = make([]int, len(lines)+6+len(tmpl.preamble)+len(tmpl.epilogue))
 	for ii := 0; ii < len(fileToCellLines); ii++ {
 		fileToCellLines[ii] = NoCursorLine
 	}
@@ -378,13 +380,31 @@ func (s *State) createGoFileFromLines(filePath string, cellId int, lines []strin
 
 	w.Write("package main\n\n")
 	var needsClosingMain bool
+	var mainLine int
 	for ii, line := range lines {
 		trimmedLine := TrimGonbCommentPrefix(line)
-		if strings.HasPrefix(trimmedLine, "%main") || strings.HasPrefix(trimmedLine, "%%") {
+		if strings.HasPrefix(trimmedLine, "%main") ||
+			(strings.HasPrefix(trimmedLine, "%%") && !isCellAttributeLine(trimmedLine)) {
 			// Write preamble of func main() and associate to the "%%" line:
 			fileToCellLines[w.Line] = ii
-			fileToCellLines[w.Line+1] = ii
-			w.Write("func main() {\n\tflag.Parse()\n")
+			w.Write("func main() {\n")
+			// Context canceled on interrupt, see `gonbui.Ctx`: declared before the preamble if it uses it, and
+			// not declared at all if `ctx` is a top-level declaration.
+			preambleUsesCtx, preambleDeclaresCtx := tmpl.usesCtx()
+			declareCtx := !preambleDeclaresCtx && !s.ctxDeclaredOutsideMain(lines[:ii], skipLines)
+			if declareCtx && preambleUsesCtx {
+				fileToCellLines[w.Line] = ii
+				w.Write(ctxDeclaration)
+			}
+			for _, templateLine := range tmpl.preamble {
+				fileToCellLines[w.Line] = ii
+				w.Write(templateLine + "\n")
+			}
+			if declareCtx && !preambleUsesCtx && cellUsesCtx(lines, skipLines, ii+1) {
+				fileToCellLines[w.Line] = ii
+				w.Write(ctxDeclaration)
+			}
+			mainLine = ii
 			needsClosingMain = true
 			continue
 		}
@@ -392,16 +412,23 @@ func (s *State) createGoFileFromLines(filePath string, cellId int, lines []strin
 			parts := strings.Split(trimmedLine, " ")
 			if len(parts) < 2 {
 				err = errors.Errorf("%%exec requires the name of a function to execute, none given in line %d: %q", ii, line)
+				return
 			}
 			mainFuncName := parts[1]
-			for jj := range 4 {
-				fileToCellLines[w.Line+jj] = ii
+			fileToCellLines[w.Line] = ii
+			w.Write("func main() {\n")
+			for _, templateLine := range tmpl.preamble {
+				fileToCellLines[w.Line] = ii
+				w.Write(templateLine + "\n")
 			}
-			w.Write(fmt.Sprintf(`func main() {
-	flag.Parse()
-	%s()
-}
-`, mainFuncName))
+			fileToCellLines[w.Line] = ii
+			w.Write(fmt.Sprintf("\t%s()\n", mainFuncName))
+			for _, templateLine := range tmpl.epilogue {
+				fileToCellLines[w.Line] = ii
+				w.Write(templateLine + "\n")
+			}
+			fileToCellLines[w.Line] = ii
+			w.Write("}\n")
 			continue
 		}
 		if _, found := skipLines[ii]; found {
@@ -421,7 +448,12 @@ func (s *State) createGoFileFromLines(filePath string, cellId int, lines []strin
 		w.Write("\n")
 	}
 	if needsClosingMain {
-		w.Write("\n}\n")
+		w.Write("\n")
+		for _, templateLine := range tmpl.epilogue {
+			fileToCellLines[w.Line] = mainLine
+			w.Write(templateLine + "\n")
+		}
+		w.Write("}\n")
 	}
 	if w.Error() != nil {
 		err = w.Error()
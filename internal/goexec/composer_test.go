@@ -76,3 +76,55 @@ func TestCreateGoFileFromLines(t *testing.T) {
 	require.Contains(t, content, "Hello")
 	require.NotContains(t, content, "xxx", "`package xxx` should have been discarded")
 }
+
+func TestCellUsesCtx(t *testing.T) {
+	uses := func(cell string) bool {
+		return cellUsesCtx(strings.Split(cell, "\n"), MakeSet[int](), 1)
+	}
+	require.True(t, uses("%%\nselect {\ncase <-ctx.Done():\n}"))
+	require.True(t, uses("%%\nctx, cancel := context.WithTimeout(ctx, time.Second)\ndefer cancel()"))
+	require.False(t, uses("%%\nfmt.Println(\"Hello\")"))
+	require.False(t, uses("%%\nfmt.Println(req.ctx) // ctx"))
+	require.False(t, uses("%%\nctx := context.Background()\nrun(ctx)"))
+	require.False(t, uses("%%\nvar ctx context.Context\nrun(ctx)"))
+	require.False(t, uses("%%\nreq := Request{ctx: nil, id: 1}\nrun(req)"))
+	require.False(t, uses("%%\ntype T struct {\n\tctx context.Context\n}\nfmt.Println(T{})"))
+	require.False(t, uses("%%\nrun(func(ctx context.Context) { <-ctx.Done() })"))
+
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	cellLines := strings.Split("%%\n<-ctx.Done()", "\n")
+	_, fileToCellLines, err := s.createGoFileFromLines(s.CodePath(), 1, cellLines, MakeSet[int](), NoCursor)
+	require.NoError(t, err)
+	contentBytes, err := os.ReadFile(s.CodePath())
+	require.NoError(t, err)
+	fileLines := strings.Split(string(contentBytes), "\n")
+	require.Equal(t, strings.TrimSuffix(ctxDeclaration, "\n"), fileLines[4])
+	require.Equal(t, 0, fileToCellLines[4])
+	require.Equal(t, 1, fileToCellLines[5])
+	require.NotContains(t, string(contentBytes), "gonbui", "`ctx` must not depend on the gonbui module")
+
+	// A struct key named `ctx` is not a use of the variable.
+	cellLines = strings.Split("%%\nfmt.Println(struct{ ctx int }{ctx: 1})", "\n")
+	_, _, err = s.createGoFileFromLines(s.CodePath(), 1, cellLines, MakeSet[int](), NoCursor)
+	require.NoError(t, err)
+	contentBytes, err = os.ReadFile(s.CodePath())
+	require.NoError(t, err)
+	require.NotContains(t, string(contentBytes), "ctx, gonbCtxStop")
+
+	// `ctx` declared before the `%%` in the same cell, or memorized from another cell, is not shadowed.
+	cellLines = strings.Split("var ctx = context.WithValue(context.Background(), \"k\", 1)\n%%\n<-ctx.Done()", "\n")
+	_, _, err = s.createGoFileFromLines(s.CodePath(), 2, cellLines, MakeSet[int](), NoCursor)
+	require.NoError(t, err)
+	contentBytes, err = os.ReadFile(s.CodePath())
+	require.NoError(t, err)
+	require.NotContains(t, string(contentBytes), "ctx, gonbCtxStop")
+
+	require.NoError(t, s.MemorizeCell(nil, 3, []string{"var ctx = context.Background()"}, MakeSet[int]()))
+	cellLines = strings.Split("%%\n<-ctx.Done()", "\n")
+	_, _, err = s.createGoFileFromLines(s.CodePath(), 4, cellLines, MakeSet[int](), NoCursor)
+	require.NoError(t, err)
+	contentBytes, err = os.ReadFile(s.CodePath())
+	require.NoError(t, err)
+	require.NotContains(t, string(contentBytes), "ctx, gonbCtxStop")
+}
@@ -0,0 +1,458 @@
+package goexec
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the coverage sessions (see `%cover-session`): the cells executed while a session is
+// active are compiled with coverage instrumentation, and the coverage data (GOCOVERDIR) of each execution is
+// accumulated, to be rendered as a combined per-function report.
+
+// CoverageSession holds the coverage data of the cells executed since `%cover-session start`.
+type CoverageSession struct {
+	// Dir where the coverage data is stored, one subdirectory per execution.
+	Dir string
+
+	// Active is true while the cells are being instrumented, that is, until `%cover-session stop`.
+	Active bool
+
+	runs []*coverageRun
+}
+
+// coverageRun holds the information of one execution of a cell with coverage.
+type coverageRun struct {
+	dir    string // GOCOVERDIR used by the execution.
+	cellId int
+
+	// source of the notebook code (`main.go` or `main_test.go`) compiled, and its mapping to the cells.
+	source              []byte
+	fileToCellIdAndLine []CellIdAndLine
+}
+
+// StartCoverageSession starts accumulating the coverage of the cells executed, discarding any previous
+// coverage data.
+func (s *State) StartCoverageSession() error {
+	dir := path.Join(s.TempDir, "coverage")
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrapf(err, "failed to remove previous coverage data in %q", dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrapf(err, "failed to create directory for coverage data %q", dir)
+	}
+	s.Coverage = &CoverageSession{Dir: dir, Active: true}
+	return nil
+}
+
+// StopCoverageSession stops instrumenting the cells executed. The coverage data accumulated is kept, and
+// can still be reported with CoverageReport.
+func (s *State) StopCoverageSession() error {
+	if s.Coverage == nil || !s.Coverage.Active {
+		return errors.New("no coverage session active, start one with `%cover-session start`")
+	}
+	s.Coverage.Active = false
+	return nil
+}
+
+// coverageActive returns whether the current cell should be compiled with coverage instrumentation.
+func (s *State) coverageActive() bool {
+	return s.Coverage != nil && s.Coverage.Active && !s.CellIsWasm
+}
+
+// coverageBuildFlags returns the flags to pass to `go build` or `go test -c` to instrument the code for
+// coverage, if a coverage session is active.
+//
+// All the main modules (the notebook module, and the ones in `go.work`, see `%track`) are instrumented.
+func (s *State) coverageBuildFlags() []string {
+	if !s.coverageActive() {
+		return nil
+	}
+	flags := []string{"-cover", "-covermode=set"}
+	patterns, err := s.mainModulesPatterns()
+	if err != nil {
+		klog.Warningf("Failed to list main modules for coverage, only the notebook will be instrumented: %v", err)
+		return flags
+	}
+	return append(flags, "-coverpkg="+strings.Join(patterns, ","))
+}
+
+// mainModulesPatterns returns the package patterns that match all packages of the main modules.
+func (s *State) mainModulesPatterns() ([]string, error) {
+	cmd := exec.Command("go", "list", "-m")
+	cmd.Dir = s.TempDir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to run %q", cmd)
+	}
+	var patterns []string
+	for _, module := range strings.Fields(string(output)) {
+		patterns = append(patterns, module+"/...")
+	}
+	if len(patterns) == 0 {
+		return nil, errors.Errorf("no modules listed by %q", cmd)
+	}
+	return patterns, nil
+}
+
+// startCoverageRun creates the GOCOVERDIR for the execution of the current cell, and records the source of the
+// program being executed. It returns an empty directory if no coverage session is active.
+func (s *State) startCoverageRun(cellId int, source []byte, fileToCellIdAndLine []CellIdAndLine) (string, error) {
+	if !s.coverageActive() {
+		return "", nil
+	}
+	run := &coverageRun{
+		dir:                 path.Join(s.Coverage.Dir, fmt.Sprintf("run-%04d", len(s.Coverage.runs))),
+		cellId:              cellId,
+		source:              source,
+		fileToCellIdAndLine: fileToCellIdAndLine,
+	}
+	if err := os.MkdirAll(run.dir, 0700); err != nil {
+		return "", errors.Wrapf(err, "failed to create directory for coverage data %q", run.dir)
+	}
+	s.Coverage.runs = append(s.Coverage.runs, run)
+	return run.dir, nil
+}
+
+// coverageBlock is a block of code instrumented for coverage, as listed in a coverage profile.
+type coverageBlock struct {
+	startLine, startCol, endLine, endCol int
+	numStmts                             int
+	covered                              bool
+}
+
+// parseCoverageProfile parses a coverage profile in text format (`go tool covdata textfmt`), and returns
+// the blocks per file.
+func parseCoverageProfile(profile []byte) (map[string][]coverageBlock, error) {
+	blocks := make(map[string][]coverageBlock)
+	scanner := bufio.NewScanner(bytes.NewReader(profile))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		// Format: "<file>:<startLine>.<startCol>,<endLine>.<endCol> <numStmts> <count>"
+		var b coverageBlock
+		fields := strings.Fields(line)
+		colonIdx := strings.LastIndex(line, ":")
+		if len(fields) != 3 || colonIdx < 0 {
+			return nil, errors.Errorf("invalid coverage profile line %q", line)
+		}
+		file := line[:colonIdx]
+		var count int
+		_, err := fmt.Sscanf(line[colonIdx+1:], "%d.%d,%d.%d %d %d",
+			&b.startLine, &b.startCol, &b.endLine, &b.endCol, &b.numStmts, &count)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid coverage profile line %q", line)
+		}
+		b.covered = count > 0
+		blocks[file] = append(blocks[file], b)
+	}
+	return blocks, scanner.Err()
+}
+
+// coverageFuncDecl is a function declaration in a source file, used to attribute coverage blocks.
+type coverageFuncDecl struct {
+	name               string
+	startLine, endLine int
+	version            string // Hash of the source of the function.
+}
+
+// parseCoverageFuncs returns the function declarations of the source file.
+func parseCoverageFuncs(fileName string, source []byte) ([]coverageFuncDecl, error) {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, fileName, source, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %q for coverage", fileName)
+	}
+	var funcs []coverageFuncDecl
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		name := funcDecl.Name.Name
+		if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
+			recvType := funcDecl.Recv.List[0].Type
+			if star, ok := recvType.(*ast.StarExpr); ok {
+				recvType = star.X
+			}
+			if index, ok := recvType.(*ast.IndexExpr); ok {
+				recvType = index.X
+			} else if index, ok := recvType.(*ast.IndexListExpr); ok {
+				recvType = index.X
+			}
+			if ident, ok := recvType.(*ast.Ident); ok {
+				name = ident.Name + "." + name
+			}
+		}
+		start, end := fileSet.Position(funcDecl.Pos()), fileSet.Position(funcDecl.End())
+		hash := sha256.Sum256(source[start.Offset:end.Offset])
+		funcs = append(funcs, coverageFuncDecl{
+			name:      name,
+			startLine: start.Line,
+			endLine:   end.Line,
+			version:   fmt.Sprintf("%x", hash[:8]),
+		})
+	}
+	return funcs, nil
+}
+
+// CoverageFunc is the combined coverage of one function, see CoverageReport.
+type CoverageFunc struct {
+	// Name of the function, prefixed by the receiver type for methods.
+	Name string
+
+	// File where the function is defined: empty for functions defined in the notebook cells.
+	File string
+
+	// CellId where the function is defined, for functions defined in the notebook, or -1 if not known.
+	CellId int
+
+	// Line where the function is defined, in the File or in the cell.
+	Line int
+
+	NumStmts, NumCovered int
+
+	// Only used while accumulating coverage.
+	lastRun      int
+	coveredBlock map[[4]int]bool
+	stmtsBlock   map[[4]int]int
+}
+
+// Percent of statements covered.
+func (f *CoverageFunc) Percent() float64 {
+	if f.NumStmts == 0 {
+		return 0
+	}
+	return 100 * float64(f.NumCovered) / float64(f.NumStmts)
+}
+
+// coverageAccumulator combines the coverage of different executions (builds) by function: executions of
+// the same version of a function (with the same source) have their blocks merged, and only the latest
+// version of each function is reported.
+type coverageAccumulator struct {
+	notebookFile string // File name used in the coverage profile for the notebook code.
+	fileDirs     map[string]string
+	funcsCache   map[string][]coverageFuncDecl
+	funcs        map[string]*CoverageFunc // Key is file, name and version.
+}
+
+// add the blocks of the run (with index runIdx) to the accumulated coverage.
+func (acc *coverageAccumulator) add(runIdx int, run *coverageRun, blocks map[string][]coverageBlock) error {
+	for file, fileBlocks := range blocks {
+		var funcs []coverageFuncDecl
+		var err error
+		isNotebook := file == acc.notebookFile
+		if isNotebook {
+			funcs, err = parseCoverageFuncs(file, run.source)
+		} else {
+			funcs, err = acc.diskFuncs(file)
+		}
+		if err != nil {
+			return err
+		}
+		for _, block := range fileBlocks {
+			idx := sort.Search(len(funcs), func(ii int) bool { return funcs[ii].endLine >= block.startLine })
+			if idx == len(funcs) || funcs[idx].startLine > block.startLine {
+				// Block not in a function declaration, e.g.: a function literal in a global variable.
+				continue
+			}
+			decl := funcs[idx]
+			displayFile := file
+			if isNotebook {
+				displayFile = ""
+			}
+			key := displayFile + "\x00" + decl.name + "\x00" + decl.version
+			f, found := acc.funcs[key]
+			if !found {
+				f = &CoverageFunc{
+					Name:         decl.name,
+					File:         displayFile,
+					CellId:       -1,
+					Line:         decl.startLine,
+					coveredBlock: make(map[[4]int]bool),
+					stmtsBlock:   make(map[[4]int]int),
+				}
+				acc.funcs[key] = f
+			}
+			if isNotebook && decl.startLine-1 < len(run.fileToCellIdAndLine) {
+				cellIdAndLine := run.fileToCellIdAndLine[decl.startLine-1]
+				f.CellId, f.Line = cellIdAndLine.Id, cellIdAndLine.Line+1
+			}
+			f.lastRun = runIdx
+			// Positions relative to the start of the function, so they match across builds where the function moved.
+			blockKey := [4]int{block.startLine - decl.startLine, block.startCol, block.endLine - decl.startLine, block.endCol}
+			f.stmtsBlock[blockKey] = block.numStmts
+			f.coveredBlock[blockKey] = f.coveredBlock[blockKey] || block.covered
+		}
+	}
+	return nil
+}
+
+// diskFuncs returns the functions declared in a file (given as "<import path>/<file name>") of a package
+// other than the notebook, read from disk.
+func (acc *coverageAccumulator) diskFuncs(file string) ([]coverageFuncDecl, error) {
+	if funcs, found := acc.funcsCache[file]; found {
+		return funcs, nil
+	}
+	pkg, fileName := path.Split(file)
+	dir, found := acc.fileDirs[strings.TrimSuffix(pkg, "/")]
+	var funcs []coverageFuncDecl
+	if found {
+		filePath := path.Join(dir, fileName)
+		source, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %q for coverage", filePath)
+		}
+		funcs, err = parseCoverageFuncs(filePath, source)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		klog.Warningf("Coverage: directory of package %q not found, its coverage is not reported", pkg)
+	}
+	acc.funcsCache[file] = funcs
+	return funcs, nil
+}
+
+// results returns the latest version of each function, sorted by cell and then by file.
+func (acc *coverageAccumulator) results() []*CoverageFunc {
+	latest := make(map[string]*CoverageFunc)
+	for _, f := range acc.funcs {
+		nameKey := f.File + "\x00" + f.Name
+		if other, found := latest[nameKey]; !found || f.lastRun > other.lastRun {
+			latest[nameKey] = f
+		}
+	}
+	results := make([]*CoverageFunc, 0, len(latest))
+	for _, f := range latest {
+		f.NumStmts, f.NumCovered = 0, 0
+		for blockKey, numStmts := range f.stmtsBlock {
+			f.NumStmts += numStmts
+			if f.coveredBlock[blockKey] {
+				f.NumCovered += numStmts
+			}
+		}
+		results = append(results, f)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.File != b.File {
+			return a.File < b.File // Notebook functions (empty File) first.
+		}
+		if a.CellId != b.CellId {
+			return a.CellId < b.CellId
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Name < b.Name
+	})
+	return results
+}
+
+// CoverageFuncs returns the combined per-function coverage of the executions in the coverage session.
+func (s *State) CoverageFuncs() ([]*CoverageFunc, error) {
+	if s.Coverage == nil {
+		return nil, errors.New("no coverage session, start one with `%cover-session start`")
+	}
+	acc := &coverageAccumulator{
+		notebookFile: s.Package + "/" + MainGo,
+		fileDirs:     make(map[string]string),
+		funcsCache:   make(map[string][]coverageFuncDecl),
+		funcs:        make(map[string]*CoverageFunc),
+	}
+	patterns, err := s.mainModulesPatterns()
+	if err == nil {
+		cmd := exec.Command("go", append([]string{"list", "-f", "{{.ImportPath}}\t{{.Dir}}"}, patterns...)...)
+		cmd.Dir = s.TempDir
+		var output []byte
+		output, err = cmd.Output()
+		for _, line := range strings.Split(string(output), "\n") {
+			if importPath, dir, found := strings.Cut(line, "\t"); found {
+				acc.fileDirs[importPath] = dir
+			}
+		}
+	}
+	if err != nil {
+		klog.Warningf("Coverage: failed to list packages: %v", err)
+	}
+
+	numRuns := 0
+	for runIdx, run := range s.Coverage.runs {
+		entries, err := os.ReadDir(run.dir)
+		if err != nil || len(entries) == 0 {
+			// Program didn't finish normally (e.g.: panic, or it failed to compile).
+			continue
+		}
+		profilePath := run.dir + ".txt"
+		cmd := exec.Command("go", "tool", "covdata", "textfmt", "-i="+run.dir, "-o="+profilePath)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			klog.Warningf("Coverage: failed %q, ignoring coverage of cell %d:\n%s", cmd, run.cellId, output)
+			continue
+		}
+		profile, err := os.ReadFile(profilePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read coverage profile %q", profilePath)
+		}
+		blocks, err := parseCoverageProfile(profile)
+		if err != nil {
+			return nil, err
+		}
+		if err := acc.add(runIdx, run, blocks); err != nil {
+			return nil, err
+		}
+		numRuns++
+	}
+	if numRuns == 0 {
+		return nil, errors.New("no coverage data collected: no cell with Go code completed since `%cover-session start`")
+	}
+	return acc.results(), nil
+}
+
+// CoverageReport returns the per-function coverage of the coverage session, as a Markdown table.
+func (s *State) CoverageReport() (string, error) {
+	funcs, err := s.CoverageFuncs()
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	var numStmts, numCovered int
+	sb.WriteString("| Function | Defined in | Statements | Coverage |\n|---|---|---:|---:|\n")
+	for _, f := range funcs {
+		location := f.File + ":" + strconv.Itoa(f.Line)
+		if f.File == "" {
+			location = fmt.Sprintf("Cell[%d]: Line %d", f.CellId, f.Line)
+			if f.CellId < 0 {
+				location = "_(generated)_"
+			}
+		}
+		_, _ = fmt.Fprintf(&sb, "| `%s` | %s | %d | %.1f%% |\n", f.Name, location, f.NumStmts, f.Percent())
+		numStmts += f.NumStmts
+		numCovered += f.NumCovered
+	}
+	var total float64
+	if numStmts > 0 {
+		total = 100 * float64(numCovered) / float64(numStmts)
+	}
+	_, _ = fmt.Fprintf(&sb, "| **Total** | | %d | **%.1f%%** |\n", numStmts, total)
+	state := "stopped"
+	if s.Coverage.Active {
+		state = "active"
+	}
+	return fmt.Sprintf("## Coverage Session (%s)\n\n%s", state, sb.String()), nil
+}
@@ -0,0 +1,85 @@
+package goexec
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestCoverageSession(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	require.NoError(t, s.StartCoverageSession())
+
+	// runCell compiles and executes the code as the given cell id, collecting its coverage.
+	runCell := func(cellId int, code string) {
+		require.NoError(t, os.WriteFile(s.CodePath(), []byte(code), 0600))
+		args := append([]string{"build", "-o", s.BinaryPath()}, s.coverageBuildFlags()...)
+		cmd := exec.Command("go", args...)
+		cmd.Dir = s.TempDir
+		output, err := cmd.CombinedOutput()
+		require.NoErrorf(t, err, "Failed %q: %s", cmd, output)
+		fileToCellIdAndLine := make([]CellIdAndLine, 20)
+		for ii := range fileToCellIdAndLine {
+			fileToCellIdAndLine[ii] = CellIdAndLine{Id: cellId, Line: ii}
+		}
+		coverDir, err := s.startCoverageRun(cellId, []byte(code), fileToCellIdAndLine)
+		require.NoError(t, err)
+		cmd = exec.Command(s.BinaryPath())
+		cmd.Env = append(os.Environ(), "GOCOVERDIR="+coverDir)
+		output, err = cmd.CombinedOutput()
+		require.NoErrorf(t, err, "Failed %q: %s", cmd, output)
+	}
+
+	// Each execution covers one branch of f, and the second moves it to a different line.
+	runCell(1, `package main
+
+func f(x int) int {
+	if x > 0 {
+		return 1
+	}
+	return 2
+}
+
+func g() {}
+
+func main() { f(1) }
+`)
+	runCell(2, `package main
+
+// Comment that moves f.
+func f(x int) int {
+	if x > 0 {
+		return 1
+	}
+	return 2
+}
+
+func g() {
+	println("changed")
+}
+
+func main() { f(-1) }
+`)
+	require.NoError(t, s.StopCoverageSession())
+	assert.Empty(t, s.coverageBuildFlags())
+
+	funcs, err := s.CoverageFuncs()
+	require.NoError(t, err)
+	byName := make(map[string]*CoverageFunc)
+	for _, f := range funcs {
+		byName[f.Name] = f
+	}
+	require.Len(t, byName, 3)
+	assert.Equal(t, 100.0, byName["f"].Percent()) // Both branches covered, across executions.
+	assert.Equal(t, 2, byName["f"].CellId)
+	assert.Equal(t, 4, byName["f"].Line)
+	assert.Equal(t, 0.0, byName["g"].Percent()) // Only the latest version of g is reported.
+	assert.Equal(t, 1, byName["g"].NumStmts)
+
+	report, err := s.CoverageReport()
+	require.NoError(t, err)
+	assert.Contains(t, report, "| `f` | Cell[2]: Line 4 | 3 | 100.0% |")
+}
@@ -0,0 +1,27 @@
+package goexec
+
+import (
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// MakeScriptsSubdir creates a subdirectory under the Jupyter root directory (served by Jupyter under `/files`),
+// where the Javascript injected by GoNB in the front-end is written, so it can be loaded with `<script src=...>`.
+//
+// This is needed for deployments with a Content-Security-Policy that disallows inline scripts.
+// It configures Comms.ScriptsDir and Comms.ScriptsUrl.
+func (s *State) MakeScriptsSubdir() error {
+	jupyterRoot, err := JupyterRootDirectory()
+	if err != nil {
+		return err
+	}
+	scriptsDir := path.Join(jupyterRoot, JupyterFilesSubdir, s.UniqueID)
+	if err = os.MkdirAll(scriptsDir, 0777); err != nil {
+		return errors.Wrapf(err, "failed to created subdirectory %q required to serve Javascript files", scriptsDir)
+	}
+	s.Comms.ScriptsDir = scriptsDir
+	s.Comms.ScriptsUrl = JupyterFilesUrl(path.Join(JupyterFilesSubdir, s.UniqueID))
+	return nil
+}
@@ -0,0 +1,134 @@
+package goexec
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+
+	. "github.com/janpfeifer/gonb/common"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the `ctx` variable available in `%%` cells: a context.Context canceled when the
+// execution is interrupted, see `gonbui.Ctx`.
+
+// ctxDeclaration is the line declaring `ctx` in the `main` function created for `%%` cells that use it: the
+// same as `gonbui.Ctx`, but using only the standard library, so it doesn't depend on the `gonbui` module.
+// The blank assignment avoids the "declared and not used" error, when `ctx` is only shadowed (e.g. by a
+// parameter of a function literal).
+const ctxDeclaration = "\tctx, gonbCtxStop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM); " +
+	"go func() { <-ctx.Done(); gonbCtxStop() }(); _ = ctx\n"
+
+// regexpCtxTopLevel matches the top-level declarations of `ctx`.
+var regexpCtxTopLevel = regexp.MustCompile(`^\s*(var|const|func|type)\s+ctx\b|^\s*import\s+ctx\s`)
+
+// parseMainBody parses the Go code lines of a `%%` cell (the lines from firstLine on) as the body of the `main`
+// function. Lines in skipLines are ignored.
+//
+// The code may not be complete (e.g. while being edited): the returned file holds whatever could be parsed,
+// or it is nil if nothing could.
+func parseMainBody(lines []string, skipLines Set[int], firstLine int) (file *ast.File, body *ast.BlockStmt) {
+	var sb strings.Builder
+	sb.WriteString("package main\nfunc main() {\n")
+	for ii := firstLine; ii < len(lines); ii++ {
+		if !skipLines.Has(ii) {
+			sb.WriteString(lines[ii])
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("}\n")
+	file, err := parser.ParseFile(token.NewFileSet(), "", sb.String(), parser.AllErrors)
+	if err != nil {
+		klog.V(2).Infof("Parsing the `main` function to look for `ctx`: %v", err)
+	}
+	if file == nil {
+		return
+	}
+	for _, decl := range file.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Name.Name == "main" {
+			body = funcDecl.Body
+		}
+	}
+	return
+}
+
+// cellUsesCtx returns whether the Go code lines of a `%%` cell (the lines following the `%%`) use the `ctx`
+// variable, without declaring it: that is, if there is an identifier `ctx` that is not resolved to a declaration
+// in the cell. Struct fields, keys of composite literals and selectors named `ctx` are not uses of the variable.
+func cellUsesCtx(lines []string, skipLines Set[int], firstLine int) bool {
+	file, _ := parseMainBody(lines, skipLines, firstLine)
+	if file == nil {
+		return false
+	}
+	for _, ident := range file.Unresolved {
+		if ident.Name == "ctx" {
+			return true
+		}
+	}
+	return false
+}
+
+// mainDeclaresCtx returns whether the Go code lines, parsed as the body of the `main` function, declare the
+// `ctx` variable in its top-level scope.
+func mainDeclaresCtx(lines []string) bool {
+	_, body := parseMainBody(lines, nil, 0)
+	if body == nil {
+		return false
+	}
+	for _, stmt := range body.List {
+		switch stmt := stmt.(type) {
+		case *ast.AssignStmt:
+			if stmt.Tok != token.DEFINE {
+				continue
+			}
+			for _, lhs := range stmt.Lhs {
+				if ident, ok := lhs.(*ast.Ident); ok && ident.Name == "ctx" {
+					return true
+				}
+			}
+		case *ast.DeclStmt:
+			genDecl, ok := stmt.Decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					if name.Name == "ctx" {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ctxDeclaredOutsideMain returns whether `ctx` is declared at the top level: memorized by a previous cell, or in
+// the lines of the cell before the `%%` line. In that case, the `ctx` of the cell refers to that declaration and
+// it must not be shadowed by ctxDeclaration.
+func (s *State) ctxDeclaredOutsideMain(linesBeforeMain []string, skipLines Set[int]) bool {
+	for ii, line := range linesBeforeMain {
+		if !skipLines.Has(ii) && regexpCtxTopLevel.MatchString(line) {
+			return true
+		}
+	}
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	decls := s.Definitions
+	if _, found := decls.Variables["ctx"]; found {
+		return true
+	}
+	if _, found := decls.Constants["ctx"]; found {
+		return true
+	}
+	if _, found := decls.Functions["ctx"]; found {
+		return true
+	}
+	if _, found := decls.Types["ctx"]; found {
+		return true
+	}
+	_, found := decls.Imports["ctx"]
+	return found
+}
@@ -0,0 +1,196 @@
+package goexec
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the report of the modules the kernel depends on (`%deps`), with their licenses, detected
+// from the license files of the downloaded modules.
+
+// ModuleDependency is a module the kernel depends on, see State.Dependencies.
+type ModuleDependency struct {
+	// Path and Version of the module. If the module is replaced (`replace` directive in go.mod), Replacement is
+	// the replacement path (and version, if any).
+	Path, Version, Replacement string
+
+	// Indirect is true for modules only required by other modules.
+	Indirect bool
+
+	// License is the SPDX identifier of the license detected (e.g. "Apache-2.0"), LicenseUnknown if there is
+	// a license file not recognized, LicenseNotFound if there is no license file, or empty if the module is
+	// not downloaded.
+	License string
+
+	// LicenseFile is the path to the license file, if one was found.
+	LicenseFile string
+}
+
+const (
+	// LicenseUnknown is the ModuleDependency.License of modules whose license files are not recognized.
+	LicenseUnknown = "Unknown"
+
+	// LicenseNotFound is the ModuleDependency.License of modules without a license file.
+	LicenseNotFound = "Not found"
+)
+
+// goListModule is the output of `go list -m -json`: only the fields used are declared.
+type goListModule struct {
+	Path, Version, Dir string
+	Main, Indirect     bool
+	Replace            *goListModule
+}
+
+// Dependencies lists the modules (direct and transitive) the kernel depends on, with `go list -m all`,
+// and detects their licenses. The main module (the kernel's) is not included.
+func (s *State) Dependencies() ([]ModuleDependency, error) {
+	cmd := exec.Command("go", "list", "-m", "-json", "all")
+	cmd.Dir = s.TempDir
+	cmd.Stderr = &strings.Builder{}
+	klog.V(2).Infof("Executing %s", cmd)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to run %q:\n%s", cmd, cmd.Stderr)
+	}
+	modules, err := parseGoListModules(strings.NewReader(string(output)))
+	if err != nil {
+		return nil, err
+	}
+	deps := make([]ModuleDependency, 0, len(modules))
+	for _, m := range modules {
+		if m.Main {
+			continue
+		}
+		dep := ModuleDependency{Path: m.Path, Version: m.Version, Indirect: m.Indirect}
+		dir := m.Dir
+		if m.Replace != nil {
+			dep.Replacement = m.Replace.Path
+			if m.Replace.Version != "" {
+				dep.Replacement += "@" + m.Replace.Version
+			}
+			dir = m.Replace.Dir
+			if dir == "" && m.Replace.Version == "" {
+				// Replacement by a local directory.
+				dir = m.Replace.Path
+				if !filepath.IsAbs(dir) {
+					dir = filepath.Join(s.TempDir, dir)
+				}
+			}
+		}
+		if dir != "" {
+			dep.License, dep.LicenseFile = detectModuleLicense(dir)
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// parseGoListModules parses the stream of JSON objects output by `go list -m -json`.
+func parseGoListModules(reader io.Reader) ([]*goListModule, error) {
+	decoder := json.NewDecoder(reader)
+	var modules []*goListModule
+	for {
+		m := &goListModule{}
+		if err := decoder.Decode(m); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "failed to parse the output of `go list -m -json`")
+		}
+		modules = append(modules, m)
+	}
+	return modules, nil
+}
+
+// regexpLicenseFile matches the names of license files.
+var regexpLicenseFile = regexp.MustCompile(`(?i)^(LICEN[CS]E|COPYING|UNLICENSE)([-._].*)?$`)
+
+// detectModuleLicense detects the license of the module in dir, from its license files.
+// It returns the license and the path of the license file.
+func detectModuleLicense(dir string) (license, licenseFile string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", ""
+	}
+	license = LicenseNotFound
+	for _, entry := range entries {
+		if entry.IsDir() || !regexpLicenseFile.MatchString(entry.Name()) {
+			continue
+		}
+		filePath := filepath.Join(dir, entry.Name())
+		contents, err := os.ReadFile(filePath)
+		if err != nil {
+			continue
+		}
+		license, licenseFile = DetectLicense(string(contents)), filePath
+		if license != LicenseUnknown {
+			break
+		}
+	}
+	return
+}
+
+// licensePatterns are the SPDX identifiers of the licenses recognized by DetectLicense, and the phrases (all
+// required, lower-cased and with normalized spaces) that identify them. The more specific come first.
+// If inHeader is set, the phrases must be in the header (the first licenseHeaderLength characters): the texts
+// of these licenses mention other licenses of the same family.
+var licensePatterns = []struct {
+	spdx     string
+	inHeader bool
+	phrases  []string
+}{
+	{"AGPL-3.0", true, []string{"gnu affero general public license", "version 3"}},
+	{"LGPL-3.0", true, []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", true, []string{"gnu lesser general public license", "version 2.1"}},
+	{"GPL-3.0", true, []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", true, []string{"gnu general public license", "version 2"}},
+	{"Apache-2.0", true, []string{"apache license", "version 2.0"}},
+	{"MPL-2.0", true, []string{"mozilla public license", "2.0"}},
+	{"EPL-2.0", true, []string{"eclipse public license", "2.0"}},
+	{"BSL-1.0", false, []string{"boost software license"}},
+	{"CC0-1.0", false, []string{"cc0 1.0 universal"}},
+	{"Unlicense", false, []string{"this is free and unencumbered software released into the public domain"}},
+	{"MIT", false, []string{"permission is hereby granted, free of charge"}},
+	{"ISC", false, []string{"permission to use, copy, modify, and", "distribute this software for any purpose"}},
+	{"BSD-3-Clause", false, []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-3-Clause", false, []string{"redistribution and use in source and binary forms", "the names of its contributors may not be used"}},
+	{"BSD-2-Clause", false, []string{"redistribution and use in source and binary forms"}},
+}
+
+// licenseHeaderLength is the length of the header of a license text, see licensePatterns.
+const licenseHeaderLength = 300
+
+// DetectLicense returns the SPDX identifier of the license in the text of a license file, or LicenseUnknown.
+// It recognizes the most common open source licenses by their distinctive phrases.
+func DetectLicense(text string) string {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	header := text
+	if len(header) > licenseHeaderLength {
+		header = header[:licenseHeaderLength]
+	}
+	for _, pattern := range licensePatterns {
+		searched := text
+		if pattern.inHeader {
+			searched = header
+		}
+		matched := true
+		for _, phrase := range pattern.phrases {
+			if !strings.Contains(searched, phrase) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return pattern.spdx
+		}
+	}
+	return LicenseUnknown
+}
@@ -0,0 +1,81 @@
+package goexec
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectLicense(t *testing.T) {
+	for text, want := range map[string]string{
+		"                                 Apache License\n                           Version 2.0, January 2004\n": "Apache-2.0",
+		"MIT License\n\nCopyright (c) 2022 Foo\n\nPermission is hereby granted, free of charge, to any person":    "MIT",
+		"Copyright (c) 2009 The Go Authors.\n\nRedistribution and use in source and binary forms, with or without\n" +
+			"modification, are permitted ...\n   * Neither the name of Google Inc. nor the names of its": "BSD-3-Clause",
+		"Redistribution and use in source and binary forms, with or without modification": "BSD-2-Clause",
+		"GNU GENERAL PUBLIC LICENSE\n Version 3, 29 June 2007\n" + strings.Repeat("...", 200) +
+			" GNU Affero General Public License": "GPL-3.0",
+		"Mozilla Public License Version 2.0\n==================================": "MPL-2.0",
+		"All rights reserved.": LicenseUnknown,
+	} {
+		assert.Equalf(t, want, DetectLicense(text), "DetectLicense(%q)", text)
+	}
+}
+
+func TestParseGoListModules(t *testing.T) {
+	output := `{
+	"Path": "gonb_12345",
+	"Main": true,
+	"Dir": "/tmp/gonb_12345"
+}
+{
+	"Path": "golang.org/x/text",
+	"Version": "v0.14.0",
+	"Indirect": true,
+	"Dir": "/go/pkg/mod/golang.org/x/text@v0.14.0"
+}
+{
+	"Path": "github.com/foo/bar",
+	"Version": "v1.0.0",
+	"Replace": {
+		"Path": "../bar"
+	}
+}
+`
+	modules, err := parseGoListModules(strings.NewReader(output))
+	require.NoError(t, err)
+	require.Len(t, modules, 3)
+	assert.True(t, modules[0].Main)
+	assert.Equal(t, "v0.14.0", modules[1].Version)
+	assert.True(t, modules[1].Indirect)
+	assert.Equal(t, "../bar", modules[2].Replace.Path)
+}
+
+func TestDependencies(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	// Local module replacing a required one, with a license file.
+	barDir := path.Join(s.TempDir, "bar")
+	require.NoError(t, os.Mkdir(barDir, 0755))
+	require.NoError(t, os.WriteFile(path.Join(barDir, "go.mod"), []byte("module github.com/foo/bar\n\ngo 1.21\n"), 0644))
+	require.NoError(t, os.WriteFile(path.Join(barDir, "LICENSE"),
+		[]byte("Permission is hereby granted, free of charge, to any person obtaining a copy"), 0644))
+	goModPath := path.Join(s.TempDir, "go.mod")
+	contents, err := os.ReadFile(goModPath)
+	require.NoError(t, err)
+	contents = append(contents, []byte("\nrequire github.com/foo/bar v1.0.0\n\nreplace github.com/foo/bar => ./bar\n")...)
+	require.NoError(t, os.WriteFile(goModPath, contents, 0644))
+
+	deps, err := s.Dependencies()
+	require.NoError(t, err)
+	require.Len(t, deps, 1)
+	assert.Equal(t, "github.com/foo/bar", deps[0].Path)
+	assert.Equal(t, "./bar", deps[0].Replacement)
+	assert.Equal(t, "MIT", deps[0].License)
+	assert.Equal(t, path.Join(barDir, "LICENSE"), deps[0].LicenseFile)
+}
@@ -0,0 +1,177 @@
+package goexec
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/janpfeifer/gonb/version"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the deterministic execution mode (see `%deterministic`): builds are made reproducible,
+// a fixed random seed is given to the programs, and a reproducibility manifest is attached to the output
+// of each cell.
+
+// DeterministicGoFlags are the GOFLAGS pinned in deterministic mode.
+const DeterministicGoFlags = "-trimpath -buildvcs=false"
+
+// DefaultDeterministicSeed is the random seed used by `%deterministic on`, if none is given.
+const DefaultDeterministicSeed = 42
+
+// ManifestMetadataKey is the key in the metadata of the output where the ReproducibilityManifest is stored.
+const ManifestMetadataKey = "gonb_reproducibility"
+
+// DeterministicMode holds the configuration of the deterministic execution mode.
+type DeterministicMode struct {
+	Seed int64
+
+	// Tools versions, recorded when the mode is enabled.
+	Tools map[string]string
+
+	// previousGoFlags holds GOFLAGS before the mode was enabled, to be restored.
+	previousGoFlags    string
+	hadPreviousGoFlags bool
+}
+
+// ReproducibilityManifest describes the inputs of the execution of a cell, so its outputs can be reproduced.
+type ReproducibilityManifest struct {
+	GoVersion   string            `json:"go_version"`
+	GOOS        string            `json:"goos"`
+	GOARCH      string            `json:"goarch"`
+	GoNBVersion string            `json:"gonb_version"`
+	GoNBCommit  string            `json:"gonb_commit"`
+	GoFlags     string            `json:"goflags"`
+	Seed        int64             `json:"seed"`
+	Tools       map[string]string `json:"tools,omitempty"`
+
+	// Hashes (sha256, hex-encoded) of the files that determine the program executed.
+	Hashes map[string]string `json:"hashes"`
+}
+
+// EnableDeterministic turns on the deterministic mode: it pins GOFLAGS (DeterministicGoFlags), sets
+// GONB_RANDOM_SEED to seed, and records the versions of the tools used.
+func (s *State) EnableDeterministic(seed int64) error {
+	if s.Deterministic == nil {
+		// Only save GOFLAGS the first time, if enabled again (to change the seed).
+		s.Deterministic = &DeterministicMode{}
+		s.Deterministic.previousGoFlags, s.Deterministic.hadPreviousGoFlags = os.LookupEnv("GOFLAGS")
+	}
+	s.Deterministic.Seed = seed
+	s.Deterministic.Tools = toolsVersions()
+	if err := os.Setenv("GOFLAGS", DeterministicGoFlags); err != nil {
+		return errors.Wrap(err, "failed to set GOFLAGS")
+	}
+	if err := os.Setenv(protocol.GONB_RANDOM_SEED_ENV, strconv.FormatInt(seed, 10)); err != nil {
+		return errors.Wrapf(err, "failed to set %s", protocol.GONB_RANDOM_SEED_ENV)
+	}
+	return nil
+}
+
+// DisableDeterministic turns off the deterministic mode, restoring GOFLAGS.
+func (s *State) DisableDeterministic() error {
+	if s.Deterministic == nil {
+		return nil
+	}
+	var err error
+	if s.Deterministic.hadPreviousGoFlags {
+		err = os.Setenv("GOFLAGS", s.Deterministic.previousGoFlags)
+	} else {
+		err = os.Unsetenv("GOFLAGS")
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to restore GOFLAGS")
+	}
+	_ = os.Unsetenv(protocol.GONB_RANDOM_SEED_ENV)
+	s.Deterministic = nil
+	return nil
+}
+
+// toolsVersions returns the versions of the tools used to build the cells.
+func toolsVersions() map[string]string {
+	tools := make(map[string]string)
+	if goimportsPath, err := exec.LookPath("goimports"); err == nil {
+		tools["goimports"] = goimportsPath
+	}
+	if goplsPath, err := exec.LookPath("gopls"); err == nil {
+		if output, err := exec.Command(goplsPath, "version").Output(); err == nil {
+			tools["gopls"] = strings.SplitN(strings.TrimSpace(string(output)), "\n", 2)[0]
+		} else {
+			tools["gopls"] = goplsPath
+		}
+	}
+	return tools
+}
+
+// ReproducibilityManifest returns the manifest for the cell compiled last.
+func (s *State) ReproducibilityManifest() (*ReproducibilityManifest, error) {
+	if s.Deterministic == nil {
+		return nil, errors.New("deterministic mode is not enabled, see `%deterministic on`")
+	}
+	m := &ReproducibilityManifest{
+		GOOS:        runtime.GOOS,
+		GOARCH:      runtime.GOARCH,
+		GoNBVersion: version.AppVersion.Version,
+		GoNBCommit:  version.AppVersion.Commit,
+		GoFlags:     os.Getenv("GOFLAGS"),
+		Seed:        s.Deterministic.Seed,
+		Tools:       s.Deterministic.Tools,
+		Hashes:      make(map[string]string),
+	}
+	output, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the Go version")
+	}
+	m.GoVersion = strings.TrimSpace(string(output))
+	for _, name := range []string{"go.mod", "go.sum", "go.work", "go.work.sum", MainGo, MainTestGo} {
+		contents, err := os.ReadFile(path.Join(s.TempDir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "failed to read %q for the reproducibility manifest", name)
+		}
+		m.Hashes[name] = fmt.Sprintf("%x", sha256.Sum256(contents))
+	}
+	return m, nil
+}
+
+// publishReproducibilityManifest publishes the ReproducibilityManifest of the cell being executed, with the
+// manifest also in the metadata of the output (under ManifestMetadataKey), so it is saved with the notebook.
+func (s *State) publishReproducibilityManifest(msg kernel.Message) {
+	m, err := s.ReproducibilityManifest()
+	if err != nil {
+		klog.Errorf("Failed to create the reproducibility manifest: %+v", err)
+		_ = kernel.PublishWriteStream(msg, kernel.StreamStderr, fmt.Sprintf("Reproducibility manifest not available: %v\n", err))
+		return
+	}
+	encoded, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		klog.Errorf("Failed to encode the reproducibility manifest: %+v", err)
+		return
+	}
+	var metadata map[string]any
+	_ = json.Unmarshal(encoded, &metadata)
+	summary := fmt.Sprintf("Reproducibility manifest: %s, seed=%d", m.GoVersion, m.Seed)
+	err = kernel.PublishDisplayData(msg, kernel.Data{
+		Data: kernel.MIMEMap{
+			string(protocol.MIMETextPlain): summary,
+			string(protocol.MIMETextHTML): fmt.Sprintf("<details><summary>%s</summary><pre>%s</pre></details>",
+				html.EscapeString(summary), html.EscapeString(string(encoded))),
+		},
+		Metadata: kernel.MIMEMap{ManifestMetadataKey: metadata},
+	})
+	if err != nil {
+		klog.Errorf("Failed to publish the reproducibility manifest: %+v", err)
+	}
+}
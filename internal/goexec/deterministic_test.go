@@ -0,0 +1,35 @@
+package goexec
+
+import (
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestDeterministic(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	t.Setenv("GOFLAGS", "-mod=mod")
+
+	_, err := s.ReproducibilityManifest()
+	require.Error(t, err)
+
+	require.NoError(t, s.EnableDeterministic(7))
+	assert.Equal(t, DeterministicGoFlags, os.Getenv("GOFLAGS"))
+	assert.Equal(t, "7", os.Getenv(protocol.GONB_RANDOM_SEED_ENV))
+	require.NoError(t, s.EnableDeterministic(11)) // Changing the seed.
+
+	manifest, err := s.ReproducibilityManifest()
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), manifest.Seed)
+	assert.Equal(t, DeterministicGoFlags, manifest.GoFlags)
+	assert.NotEmpty(t, manifest.GoVersion)
+	assert.Len(t, manifest.Hashes["go.mod"], 64)
+
+	require.NoError(t, s.DisableDeterministic())
+	assert.Equal(t, "-mod=mod", os.Getenv("GOFLAGS"))
+	_, found := os.LookupEnv(protocol.GONB_RANDOM_SEED_ENV)
+	assert.False(t, found)
+}
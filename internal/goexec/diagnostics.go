@@ -0,0 +1,208 @@
+package goexec
+
+import (
+	"fmt"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"k8s.io/klog/v2"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// This file implements the lint subsystem: when enabled with `%vet`, `go vet` is executed after each successful
+// compilation, and its findings are reported and kept in a cache, so they can be shown in the contextual help
+// (`inspect_request`) of the corresponding lines.
+
+// Diagnostic is a finding of a linter (`go vet`) for one line of a cell.
+type Diagnostic struct {
+	CellId, Line, Col int // Line and Col are 0-based.
+
+	// LineText is the trimmed text of the line, used to check that the line hasn't been edited since.
+	LineText string
+
+	Source, Message string
+}
+
+// diagnosticsCache holds the diagnostics of the last lint run, indexed by cell id and line.
+type diagnosticsCache struct {
+	mu     sync.Mutex
+	byCell map[int]map[int][]Diagnostic
+
+	// cellLines holds the trimmed text of the lines of the cells linted, indexed by cell id and line.
+	// It is used to identify the cell being edited in an `inspect_request`, which doesn't carry the cell id.
+	cellLines map[int]map[int]string
+}
+
+// set replaces all cached diagnostics, and the text of the cells they refer to.
+func (c *diagnosticsCache) set(diagnostics []Diagnostic, cellLines map[int]map[int]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cellLines = cellLines
+	c.byCell = make(map[int]map[int][]Diagnostic)
+	for _, d := range diagnostics {
+		byLine, found := c.byCell[d.CellId]
+		if !found {
+			byLine = make(map[int][]Diagnostic)
+			c.byCell[d.CellId] = byLine
+		}
+		byLine[d.Line] = append(byLine[d.Line], d)
+	}
+}
+
+// cellIdForLinesLocked identifies the linted cell with the given lines: the one with the most lines matching
+// at the same position. It returns false if no line matches, or if more than one cell matches equally well.
+func (c *diagnosticsCache) cellIdForLinesLocked(lines []string) (cellId int, found bool) {
+	bestCount := 0
+	for id, byLine := range c.cellLines {
+		count := 0
+		for ii, line := range lines {
+			if text, ok := byLine[ii]; ok && text != "" && text == strings.TrimSpace(line) {
+				count++
+			}
+		}
+		if count > bestCount {
+			cellId, bestCount, found = id, count, true
+		} else if count == bestCount {
+			found = false
+		}
+	}
+	return
+}
+
+// forCellLine returns the diagnostics of the line cursorLine of the cell with the given lines, provided the line
+// hasn't been edited since the lint run.
+func (c *diagnosticsCache) forCellLine(lines []string, cursorLine int) (diagnostics []Diagnostic) {
+	if cursorLine < 0 || cursorLine >= len(lines) {
+		return
+	}
+	line := strings.TrimSpace(lines[cursorLine])
+	if line == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cellId, found := c.cellIdForLinesLocked(lines)
+	if !found {
+		return
+	}
+	for _, d := range c.byCell[cellId][cursorLine] {
+		if d.LineText == line {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	return
+}
+
+// Diagnostics returns the cached diagnostics for the given cell id and line (0-based).
+func (s *State) Diagnostics(cellId, line int) []Diagnostic {
+	s.diagnostics.mu.Lock()
+	defer s.diagnostics.mu.Unlock()
+	return s.diagnostics.byCell[cellId][line]
+}
+
+// regexpVetFinding matches a line of `go vet` output, e.g.: "./main.go:12:5: fmt.Printf format %d has arg ...".
+var regexpVetFinding = regexp.MustCompile(`^(?:\./)?main\.go:(\d+):(\d+): (.*)$`)
+
+// parseVetOutput parses the output of `go vet`, and maps the findings in `main.go` to cell lines.
+// mainLines are the lines of `main.go`, used to fill Diagnostic.LineText.
+func parseVetOutput(output string, mainLines []string, fileToCellIdAndLine []CellIdAndLine) (diagnostics []Diagnostic) {
+	for _, line := range strings.Split(output, "\n") {
+		matches := regexpVetFinding.FindStringSubmatch(strings.TrimSpace(line))
+		if len(matches) != 4 {
+			continue
+		}
+		fileLine, _ := strconv.Atoi(matches[1])
+		col, _ := strconv.Atoi(matches[2])
+		fileLine-- // 0-based.
+		if fileLine < 0 || fileLine >= len(fileToCellIdAndLine) || fileToCellIdAndLine[fileLine].Line == NoCursorLine {
+			continue
+		}
+		d := Diagnostic{
+			CellId:  fileToCellIdAndLine[fileLine].Id,
+			Line:    fileToCellIdAndLine[fileLine].Line,
+			Col:     col - 1,
+			Source:  "go vet",
+			Message: matches[3],
+		}
+		if fileLine < len(mainLines) {
+			d.LineText = strings.TrimSpace(mainLines[fileLine])
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return
+}
+
+// cellLinesFromMain returns the trimmed text of the cell lines in `main.go`, indexed by cell id and line.
+func cellLinesFromMain(mainLines []string, fileToCellIdAndLine []CellIdAndLine) map[int]map[int]string {
+	cellLines := make(map[int]map[int]string)
+	for fileLine, idAndLine := range fileToCellIdAndLine {
+		if idAndLine.Line == NoCursorLine || fileLine >= len(mainLines) {
+			continue
+		}
+		byLine, found := cellLines[idAndLine.Id]
+		if !found {
+			byLine = make(map[int]string)
+			cellLines[idAndLine.Id] = byLine
+		}
+		byLine[idAndLine.Line] = strings.TrimSpace(mainLines[fileLine])
+	}
+	return cellLines
+}
+
+// runVet runs `go vet` on the generated program, caches the findings and reports them to stderr.
+// Failures to run it are only logged, since they shouldn't prevent the execution of the cell.
+func (s *State) runVet(msg kernel.Message, fileToCellIdAndLine []CellIdAndLine) {
+	cmd := exec.Command("go", append([]string{"vet"}, s.buildTagsFlags()...)...)
+	cmd.Dir = s.TempDir
+	klog.V(2).Infof("Executing %s", cmd)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		s.diagnostics.set(nil, nil)
+		return
+	}
+	mainContents, readErr := os.ReadFile(s.CodePath())
+	if readErr != nil {
+		klog.Errorf("Failed to read %q for `go vet` findings: %+v", s.CodePath(), readErr)
+	}
+	mainLines := strings.Split(string(mainContents), "\n")
+	diagnostics := parseVetOutput(string(output), mainLines, fileToCellIdAndLine)
+	s.diagnostics.set(diagnostics, cellLinesFromMain(mainLines, fileToCellIdAndLine))
+	if len(diagnostics) == 0 {
+		klog.Warningf("`go vet` failed without findings in cells: %v\n%s", err, output)
+		return
+	}
+	var parts []string
+	for _, d := range diagnostics {
+		parts = append(parts, fmt.Sprintf("%s: cell[%d]:%d:%d: %s", d.Source, d.CellId, d.Line+1, d.Col+1, d.Message))
+	}
+	_ = kernel.PublishWriteStream(msg, kernel.StreamStderr, strings.Join(parts, "\n")+"\n")
+}
+
+// appendDiagnosticsToInspect appends to the contextual help the findings associated to the line under the cursor,
+// in the cell with the given lines.
+func (s *State) appendDiagnosticsToInspect(mimeMap kernel.MIMEMap, lines []string, cursorLine int) kernel.MIMEMap {
+	diagnostics := s.diagnostics.forCellLine(lines, cursorLine)
+	if len(diagnostics) == 0 {
+		return mimeMap
+	}
+	var parts []string
+	for _, d := range diagnostics {
+		parts = append(parts, fmt.Sprintf("⚠️ **%s**: %s", d.Source, d.Message))
+	}
+	warnings := strings.Join(parts, "\n\n")
+	if mimeMap == nil {
+		mimeMap = make(kernel.MIMEMap)
+	}
+	if desc, ok := mimeMap[string(protocol.MIMETextMarkdown)].(string); ok {
+		mimeMap[string(protocol.MIMETextMarkdown)] = desc + "\n\n---\n\n" + warnings
+	} else if desc, ok := mimeMap[string(protocol.MIMETextPlain)].(string); ok {
+		mimeMap[string(protocol.MIMETextPlain)] = desc + "\n\n" + strings.ReplaceAll(warnings, "**", "")
+	} else {
+		mimeMap[string(protocol.MIMETextMarkdown)] = warnings
+	}
+	return mimeMap
+}
@@ -0,0 +1,61 @@
+package goexec
+
+import (
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestRunVet(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() {
+		err := s.Stop()
+		require.NoError(t, err, "Failed to finalized state")
+	}()
+	code := `package main
+
+import "fmt"
+
+func main() {
+	fmt.Printf("%d\n", "not a number")
+}
+`
+	require.NoError(t, os.WriteFile(s.CodePath(), []byte(code), 0644))
+	fileToCellLine := []int{NoCursorLine, NoCursorLine, 0, NoCursorLine, 1, 2, 3}
+	s.runVet(nil, MakeFileToCellIdAndLine(7, fileToCellLine))
+
+	diagnostics := s.Diagnostics(7, 2)
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, "go vet", diagnostics[0].Source)
+	assert.Contains(t, diagnostics[0].Message, "fmt.Printf format %d")
+	assert.Equal(t, `fmt.Printf("%d\n", "not a number")`, diagnostics[0].LineText)
+
+	// Inspect of the same line, in the cell being edited, includes the finding.
+	lines := []string{`import "fmt"`, "func main() {", `    fmt.Printf("%d\n", "not a number")`, "}"}
+	mimeMap := s.appendDiagnosticsToInspect(kernel.MIMEMap{string(protocol.MIMETextMarkdown): "func Printf"}, lines, 2)
+	assert.Contains(t, mimeMap[string(protocol.MIMETextMarkdown)], "fmt.Printf format %d")
+	mimeMap = s.appendDiagnosticsToInspect(kernel.MIMEMap{string(protocol.MIMETextMarkdown): "func Printf"}, lines, 1)
+	assert.Equal(t, "func Printf", mimeMap[string(protocol.MIMETextMarkdown)])
+}
+
+func TestDiagnosticsForCellLine(t *testing.T) {
+	var c diagnosticsCache
+	c.set([]Diagnostic{{CellId: 1, Line: 1, LineText: "x := f()", Source: "go vet", Message: "finding"}},
+		map[int]map[int]string{
+			1: {0: "func g() {", 1: "x := f()", 2: "}"},
+			2: {0: "func h() {", 1: "x := f()", 2: "}"},
+		})
+
+	assert.Len(t, c.forCellLine([]string{"func g() {", "\tx := f()", "}"}, 1), 1)
+	// Identical line in another cell.
+	assert.Empty(t, c.forCellLine([]string{"func h() {", "\tx := f()", "}"}, 1))
+	// Identical line, at a different line of the cell.
+	assert.Empty(t, c.forCellLine([]string{"func g() {", "", "\tx := f()", "}"}, 2))
+	// Line edited since the lint run.
+	assert.Empty(t, c.forCellLine([]string{"func g() {", "\tx := f(1)", "}"}, 1))
+	// Cell can't be identified.
+	assert.Empty(t, c.forCellLine([]string{"x := f()"}, 0))
+}
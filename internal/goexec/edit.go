@@ -0,0 +1,37 @@
+package goexec
+
+import (
+	"fmt"
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// This file implements `%edit`: it loads a file from a tracked directory into a new cell, which when executed
+// saves the file back with `%%writefile`.
+
+// EditFileCell returns the contents of a cell to edit filePath: the contents of the file preceded by a
+// `%%writefile <filePath>` line, so executing the cell saves the file back.
+//
+// The file must be tracked (see Track), or be under a tracked directory.
+func (s *State) EditFileCell(filePath string) (string, error) {
+	filePath = ReplaceEnvVars(ReplaceTildeInDir(filePath))
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to find absolute path of %q", filePath)
+	}
+	if strings.ContainsAny(absPath, " \t") {
+		return "", errors.Errorf("%%edit doesn't support paths with spaces, got %q", absPath)
+	}
+	if !s.IsTracked(absPath) {
+		return "", errors.Errorf("file %q is not under a tracked directory, use `%%track <dir>` first", absPath)
+	}
+	contents, err := os.ReadFile(absPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read %q for editing", absPath)
+	}
+	// `%%writefile` adds a new-line after each line of the cell.
+	return fmt.Sprintf("%%%%writefile %s\n%s", absPath, strings.TrimSuffix(string(contents), "\n")), nil
+}
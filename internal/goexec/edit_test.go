@@ -0,0 +1,29 @@
+package goexec
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestEditFileCell(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	dir := t.TempDir()
+	filePath := path.Join(dir, "pkg", "lib.go")
+	require.NoError(t, os.MkdirAll(path.Dir(filePath), 0700))
+	require.NoError(t, os.WriteFile(filePath, []byte("package pkg\n\nconst X = 1\n"), 0600))
+
+	_, err := s.EditFileCell(filePath)
+	require.Error(t, err, "file not tracked should fail")
+
+	require.NoError(t, s.Track(dir))
+	assert.True(t, s.IsTracked(filePath))
+	assert.False(t, s.IsTracked(dir+"_other/lib.go"))
+	cell, err := s.EditFileCell(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "%%writefile "+filePath+"\npackage pkg\n\nconst X = 1", cell)
+}
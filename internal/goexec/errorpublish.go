@@ -74,22 +74,61 @@ var templateErrorReport = template.Must(template.New("error_report").Parse(`
 // Example type of err message:
 // /tmp/gonb_4e5ea2e7/main.go:3:1: expected declaration, found fmt
 
+// ErrorFormat defines how compilation errors are reported.
+type ErrorFormat string
+
+const (
+	// ErrorFormatHTML reports errors in an HTML display data, with the context of each error displayed
+	// in a mouse-over pop-up window. This is the default.
+	ErrorFormatHTML ErrorFormat = "html"
+
+	// ErrorFormatText reports errors in the traceback of the Jupyter error reply, in plain text.
+	// It's the format used with the `--raw_error` flag.
+	ErrorFormatText ErrorFormat = "text"
+
+	// ErrorFormatANSI reports errors in the traceback of the Jupyter error reply, with ANSI colors and
+	// long messages wrapped. Useful for nbconvert, terminals and CI.
+	ErrorFormatANSI ErrorFormat = "ansi"
+)
+
+// ErrorLineWrapWidth is the width at which error messages are wrapped in the ErrorFormatANSI format.
+const ErrorLineWrapWidth = 100
+
+// ErrorFormat returns how compilation errors are currently reported.
+func (s *State) ErrorFormat() ErrorFormat {
+	return s.errorFormat
+}
+
+// SetErrorFormat sets how compilation errors are reported: one of "html", "text" or "ansi".
+func (s *State) SetErrorFormat(format string) error {
+	switch f := ErrorFormat(format); f {
+	case ErrorFormatHTML, ErrorFormatText, ErrorFormatANSI:
+		s.errorFormat = f
+		return nil
+	default:
+		return errors.Errorf("unknown error format %q, valid values are %q, %q and %q",
+			format, ErrorFormatHTML, ErrorFormatText, ErrorFormatANSI)
+	}
+}
+
 // DisplayErrorWithContext in an HTML div, with a mouse-over pop-up window
 // listing the Lines with the error, and highlighting the exact position.
 //
-// Except if `rawError` is set to true (see `New() *State`): in which case the enriched GonbError is returned
-// instead, for a textual report back.
+// Except if the error format is not ErrorFormatHTML (see SetErrorFormat): in which case the enriched GonbError
+// is returned instead, for a textual report back in the traceback of the error reply.
 //
 // Any errors within here are logged and simply ignored, since this is already
 // used to report errors.
 func (s *State) DisplayErrorWithContext(msg kernel.Message, fileToCellIdAndLine []CellIdAndLine, errorMsg string, err error) error {
 	nbErr := newGonbErrors(s, fileToCellIdAndLine, errorMsg, err)
-	if s.rawError {
-		return nbErr
-	} else {
-		nbErr.PublishWithHTML(msg)
+	if nbErr == nil {
 		return err
 	}
+	if s.errorFormat != ErrorFormatHTML {
+		return nbErr
+	}
+	nbErr.PublishWithHTML(msg)
+	return err
 }
 
 // LinesForErrorContext indicates how many lines to display in the error context, before and after the offending line.
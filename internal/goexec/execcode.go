@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/i18n"
 	"github.com/janpfeifer/gonb/internal/jpyexec"
 	"github.com/janpfeifer/gonb/internal/kernel"
 	"github.com/pkg/errors"
@@ -21,11 +22,13 @@ import (
 // cellExecParams are the parameters of ExecuteCell, packaged so they
 // can be serialized in the channel `state.cellExecChan`.
 type cellExecParams struct {
-	msg       kernel.Message
-	cellId    int
-	lines     []string
-	skipLines Set[int]
-	done      *LatchWithValue[error]
+	msg          kernel.Message
+	cellId       int
+	lines        []string
+	skipLines    Set[int]
+	isolated     bool // Whether to execute the cell isolated, see ExecuteIsolatedCell.
+	memorizeOnly bool // Whether to only memorize the cell declarations, see MemorizeCell.
+	done         *LatchWithValue[error]
 }
 
 // ExecuteCell takes the contents of a cell, parses it, merges new declarations with the ones
@@ -59,7 +62,14 @@ func (s *State) serializeExecuteCell() {
 		select {
 		case params := <-s.cellExecChan:
 			// New execution request: execute it, and report back error in the params.done latch.
-			err := s.executeCellImpl(params.msg, params.cellId, params.lines, params.skipLines)
+			var err error
+			if params.memorizeOnly {
+				err = s.memorizeCellImpl(params.msg, params.cellId, params.lines, params.skipLines)
+			} else if params.isolated {
+				err = s.executeIsolatedCellImpl(params.msg, params.cellId, params.lines, params.skipLines)
+			} else {
+				err = s.executeCellImpl(params.msg, params.cellId, params.lines, params.skipLines)
+			}
 			params.done.Trigger(err)
 
 		case <-stopC:
@@ -79,26 +89,70 @@ func (s *State) executeCellImpl(msg kernel.Message, cellId int, lines []string,
 
 	klog.V(1).Infof("ExecuteCell: %q", lines)
 
+	// Hooks registered with `%hook`: post-run hooks are executed even if the cell fails.
+	if err := s.runHooks(msg, HookPreRun); err != nil {
+		return err
+	}
+	defer func() {
+		if err := s.runHooks(msg, HookPostRun); err != nil {
+			klog.Errorf("goexec.ExecuteCell(): %+v", err)
+			_ = kernel.PublishWriteStream(msg, kernel.StreamStderr, err.Error()+"\n")
+		}
+	}()
+
 	klog.V(2).Infof("ExecuteCell(): CellIsTest=%v, CellIsWasm=%v", s.CellIsTest, s.CellIsWasm)
 	if s.CellIsTest && s.CellIsWasm {
 		return errors.Errorf("Cannot execute test in a %%wasm cell. Please, choose either `%%wasm` or `%%test`.")
 	}
 
-	// Runs AutoTrack: makes sure redirects in go.mod and use clauses in go.work are tracked.
-	err := s.AutoTrack()
+	fileToCellIdAndLine, err := s.composeAndCompile(msg, cellId, lines, skipLines)
 	if err != nil {
 		return err
 	}
 
+	// Execute compiled code.
+	return s.Execute(msg, fileToCellIdAndLine)
+}
+
+// composeAndCompile composes the program (`main.go` or `main_test.go`) with the cell contents and the memorized
+// declarations, and compiles it. On success, the merged declarations are memorized.
+//
+// It holds State.composeMu, so introspection requests don't update `go.mod` while the program is being built.
+func (s *State) composeAndCompile(msg kernel.Message, cellId int, lines []string, skipLines Set[int]) (
+	fileToCellIdAndLine []CellIdAndLine, err error) {
+	s.composeMu.Lock()
+	defer s.composeMu.Unlock()
+
+	// Runs AutoTrack: makes sure redirects in go.mod and use clauses in go.work are tracked.
+	err = s.AutoTrack()
+	if err != nil {
+		return
+	}
+
 	klog.V(2).Infof("ExecuteCell: after AutoTrack")
 
 	updatedDecls, mainDecl, _, fileToCellIdAndLine, err := s.parseLinesAndComposeMain(msg, cellId, lines, skipLines, NoCursor)
 	if err != nil {
 		klog.Infof("goexec.ExecuteCell() failed to parse the cell: %+v", err)
-		return err
+		return
 	}
 	klog.V(2).Infof("ExecuteCell: after s.parseLinesAndComposeMain()")
 
+	// `%persist`: save and reload the values of the persisted variables.
+	mainDecl, restorePersisted := s.injectPersistedVariables(updatedDecls, mainDecl, cellId)
+	if restorePersisted != nil {
+		_, fileToCellIdAndLine, err = s.createCodeFileFromDecls(updatedDecls, mainDecl)
+		if err != nil {
+			err = errors.WithMessagef(err, "while composing main.go with the persisted variables")
+			return
+		}
+	}
+
+	// Friendlier error for identifiers not defined anywhere, typically from cells not executed in the session.
+	if err = s.checkUndefinedSymbols(cellId, fileToCellIdAndLine); err != nil {
+		return
+	}
+
 	// ProgramExecutor `goimports` (or the code that implements it) -- it updates `updatedDecls` with
 	// the new imports, if there are any.
 	_, fileToCellIdAndLine, err = s.GoImports(msg, updatedDecls, mainDecl, fileToCellIdAndLine)
@@ -107,22 +161,34 @@ func (s *State) executeCellImpl(msg kernel.Message, cellId int, lines []string,
 
 	if err != nil {
 		klog.Infof("goexec.ExecuteCell() failed to run `go imports` and `go get`: %+v", err)
-		return err
+		return
 	}
 
 	// And then compile it.
-	if err := s.Compile(msg, fileToCellIdAndLine); err != nil {
+	if err = s.Compile(msg, fileToCellIdAndLine); err != nil {
 		klog.Infof("goexec.ExecuteCell() failed to compile cell: %+v", err)
-		return err
+		return
 	}
 
 	klog.V(2).Infof("ExecuteCell: after s.Compile()")
+	if code, err := os.ReadFile(s.CodePath()); err == nil {
+		s.previousCode, s.lastCode = s.lastCode, string(code)
+		s.lastFileToCellIdAndLine = fileToCellIdAndLine
+	}
+	if s.VetEnabled && !s.CellIsWasm {
+		s.runVet(msg, fileToCellIdAndLine)
+	}
 
 	// Compilation successful: save merged declarations into current State.
-	s.Definitions = updatedDecls
-
-	// Execute compiled code.
-	return s.Execute(msg, fileToCellIdAndLine)
+	if restorePersisted != nil {
+		restorePersisted(updatedDecls)
+	}
+	s.recordFunctionHistory(updatedDecls)
+	s.setDefinitions(updatedDecls)
+	if s.Deterministic != nil {
+		s.publishReproducibilityManifest(msg)
+	}
+	return
 }
 
 // PostExecuteCell reset state that is valid only for the duration of a cell.
@@ -131,21 +197,22 @@ func (s *State) PostExecuteCell() {
 	klog.V(2).Infof("PostExecuteCell(): CellIsTest=%v", s.CellIsTest)
 	if s.CellIsWasm {
 		// Remove declarations exported for running in WASM.
-		s.RemoveWasmConstants(s.Definitions)
+		s.UpdateDefinitions(s.RemoveWasmConstants)
 	}
 
 	s.Args = nil
 	s.CellIsTest = false
 	s.CellTests = nil
 	s.CellHasBenchmarks = false
+	s.CellBuildTags = nil
 	s.CellIsWasm = false
 	s.WasmDivId = ""
-	if s.CaptureFile != nil {
-		err := s.CaptureFile.Close()
+	if s.Capture != nil {
+		err := s.Capture.Close()
 		if err != nil {
 			klog.Errorf("goexec.PostExecuteCell(): failed to close capture file: %+v", err)
 		}
-		s.CaptureFile = nil
+		s.Capture = nil
 	}
 }
 
@@ -168,6 +235,19 @@ func (s *State) CodePath() string {
 	return path.Join(s.TempDir, name)
 }
 
+// ComposedCodeHistory returns the contents of the last two composed programs (`main.go` or `main_test.go`)
+// that compiled successfully, the most recent one last. They are empty if not available.
+func (s *State) ComposedCodeHistory() (previous, last string) {
+	return s.previousCode, s.lastCode
+}
+
+// LastComposedCode returns the contents of the last composed program (`main.go` or `main_test.go`) that compiled
+// successfully, and the mapping of each of its lines to the cell and line where it was defined.
+// The code is empty if no cell was executed successfully yet.
+func (s *State) LastComposedCode() (code string, fileToCellIdAndLine []CellIdAndLine) {
+	return s.lastCode, s.lastFileToCellIdAndLine
+}
+
 // RemoveGeneratedCode removes the code files (`main.go` or `main_test.go`).
 // Usually, it is used just before creating a new version.
 func (s *State) RemoveGeneratedCode() error {
@@ -197,6 +277,7 @@ func (s *State) Execute(msg kernel.Message, fileToCellIdAndLine []CellIdAndLine)
 	if s.CellIsWasm {
 		return s.ExecuteWasm(msg)
 	}
+	s.SetAssetsEnv()
 	args := s.Args
 	if len(args) == 0 && s.CellIsTest {
 		args = s.DefaultCellTestArgs()
@@ -204,22 +285,57 @@ func (s *State) Execute(msg kernel.Message, fileToCellIdAndLine []CellIdAndLine)
 
 	// Create stdout and stderr pipes that write to Jupyter stdout/stderr streams.
 	stdout := kernel.NewJupyterStreamWriter(msg, kernel.StreamStdout)
-	stderrWithAnnotator := newJupyterStackTraceMapperWriter(msg, "stderr", s.CodePath(), fileToCellIdAndLine)
-	if s.CaptureFile != nil {
-		stdout = io.MultiWriter(stdout, s.CaptureFile)
-		stderrWithAnnotator = io.MultiWriter(stderrWithAnnotator, s.CaptureFile)
+	stderrMapper := newJupyterStackTraceMapperWriter(msg, "stderr", s.CodePath(), fileToCellIdAndLine)
+	stderrMapper.trackedRoots = s.trackedRoots()
+	var stderrWithAnnotator io.Writer = stderrMapper
+	executor := jpyexec.New(msg, s.BinaryPath(), args...).
+		UseNamedPipes(s.Comms).
+		ExecutionCount(msg.Kernel().ExecCounter()).
+		WithScriptNonce(s.Comms.ScriptNonce).
+		WithStreamBuffer(s.StreamBufferInterval).
+		WithBinaryPolicy(s.BinaryPolicy).
+		WithStreamRoutes(s.StreamRoutes).
+		WithSignalPolicy(s.SignalPolicy).
+		WithStore(s.Store)
+	if s.SanitizeHTML {
+		executor.SanitizeHTML()
+	}
+	s.stateMu.Lock()
+	for name, listener := range s.listeners {
+		executor.WithListener(name, listener)
+	}
+	s.stateMu.Unlock()
+	if coverDir, err := s.startCoverageRun(msg.Kernel().ExecCounter(), []byte(s.lastCode), fileToCellIdAndLine); err != nil {
+		klog.Errorf("Coverage of the cell will not be collected: %+v", err)
+	} else if coverDir != "" {
+		executor.WithEnv("GOCOVERDIR=" + coverDir)
+		if s.CellIsTest {
+			executor.WithArgs("-test.gocoverdir=" + coverDir)
+		}
+	}
+	if s.Capture != nil {
+		if s.Capture.Quiet {
+			// Output is only captured, not displayed.
+			stdout = s.Capture.Stream("stdout")
+			stderrWithAnnotator = s.Capture.Stream("stderr")
+			executor.SuppressDisplayData()
+		} else {
+			stdout = io.MultiWriter(stdout, s.Capture.Stream("stdout"))
+			stderrWithAnnotator = io.MultiWriter(stderrWithAnnotator, s.Capture.Stream("stderr"))
+		}
+		executor.CaptureDisplayDataOutput(s.Capture)
 	}
 
-	err := jpyexec.New(msg, s.BinaryPath(), args...).
-		UseNamedPipes(s.Comms).
-		ExecutionCount(msg.Kernel().ExecCounter).
+	err := executor.
 		WithStdout(stdout).
 		WithStderr(stderrWithAnnotator).
-		CaptureDisplayDataOutput(s.CaptureFile).
 		Exec()
 	if err != nil {
 		klog.Infof("goexec.Execute(): failed to run the compiled cell: %+v", msg)
 	}
+	if s.Capture == nil || !s.Capture.Quiet {
+		stderrMapper.publishTraceback()
+	}
 	return err
 }
 
@@ -237,6 +353,8 @@ func (s *State) Compile(msg kernel.Message, fileToCellIdAndLines []CellIdAndLine
 		args = []string{"build", "-o", s.BinaryPath()}
 	}
 	args = append(args, s.GoBuildFlags...)
+	args = append(args, s.buildTagsFlags()...)
+	args = append(args, s.coverageBuildFlags()...)
 	cmd := exec.Command("go", args...)
 	cmd.Dir = s.TempDir
 	if s.CellIsWasm {
@@ -254,6 +372,7 @@ func (s *State) Compile(msg kernel.Message, fileToCellIdAndLines []CellIdAndLine
 	var output []byte
 	klog.V(2).Infof("Executing %s", cmd)
 	output, err := cmd.CombinedOutput()
+	s.recordModuleDownloads(output)
 	if err != nil {
 		klog.Errorf("Failed %q:\n%s\n", cmd, output)
 		err := s.DisplayErrorWithContext(msg, fileToCellIdAndLines, string(output), err)
@@ -271,14 +390,7 @@ func (s *State) GoImports(msg kernel.Message, decls *Declarations, mainDecl *Fun
 	cursorInFile = NoCursor
 	goimportsPath, err := exec.LookPath("goimports")
 	if err != nil {
-		_ = kernel.PublishWriteStream(msg, kernel.StreamStderr, `
-Program goimports is not installed. It is used to automatically import
-missing standard packages, and is a standard Go toolkit package. You
-can install it from the notebook with:
-
-!go install golang.org/x/tools/cmd/goimports@latest
-
-`)
+		_ = kernel.PublishWriteStream(msg, kernel.StreamStderr, i18n.T(i18n.MsgGoImportsMissing))
 		err = errors.WithMessagef(err, "while trying to run goimports\n")
 		return
 	}
@@ -339,6 +451,7 @@ can install it from the notebook with:
 	cmd.Dir = s.TempDir
 	klog.V(2).Infof("Executing %s", cmd)
 	output, err = cmd.CombinedOutput()
+	s.recordModuleDownloads(output)
 	if err != nil {
 		err = errors.Wrapf(err, "failed to run %q", cmd.String())
 		strOutput := fmt.Sprintf("%v\n\n%s", err, output)
@@ -346,27 +459,40 @@ can install it from the notebook with:
 		err = s.DisplayErrorWithContext(msg, fileToCellIdAndLine, strOutput, err)
 		return
 	}
+	if s.VulnCheckAfterGet && regexpGoDownloading.Match(output) {
+		s.vulnCheckModules(msg)
+	}
 	return
 }
 
 // jupyterStackTraceMapperWriter implements an io.Writer that maps stack traces to their corresponding
 // cell Lines, to facilitate debugging.
+//
+// It also keeps the tail of what was written, so once the program finishes, the traceback of a panic can
+// be rendered in HTML, see publishTraceback.
 type jupyterStackTraceMapperWriter struct {
+	msg                 kernel.Message
 	jupyterWriter       io.Writer
 	mainPath            string
 	fileToCellIdAndLine []CellIdAndLine
 	regexpMainPath      *regexp.Regexp
+	tail                []byte
+
+	// trackedRoots are the absolute paths of the tracked files and directories: frames in those files
+	// are linked in the traceback.
+	trackedRoots []string
 }
 
 // newJupyterStackTraceMapperWriter creates an io.Writer that allows for mapping of references to the `main.go`
 // to its corresponding position in a cell.
-func newJupyterStackTraceMapperWriter(msg kernel.Message, stream string, mainPath string, fileToCellIdAndLine []CellIdAndLine) io.Writer {
+func newJupyterStackTraceMapperWriter(msg kernel.Message, stream string, mainPath string, fileToCellIdAndLine []CellIdAndLine) *jupyterStackTraceMapperWriter {
 	r, err := regexp.Compile(fmt.Sprintf("%s:(\\d+)", regexp.QuoteMeta(mainPath)))
 	if err != nil {
 		klog.Errorf("Failed to compile expression to match %q: won't be able to map stack traces with cell Lines", mainPath)
 	}
 
 	return &jupyterStackTraceMapperWriter{
+		msg:                 msg,
 		jupyterWriter:       kernel.NewJupyterStreamWriter(msg, stream),
 		mainPath:            mainPath,
 		regexpMainPath:      r,
@@ -377,6 +503,10 @@ func newJupyterStackTraceMapperWriter(msg kernel.Message, stream string, mainPat
 // Write implements io.Writer, and maps references to the `main.go` file to their corresponding Lines in cells.
 func (w *jupyterStackTraceMapperWriter) Write(p []byte) (int, error) {
 	n := len(p) // Save original number of bytes.
+	w.tail = append(w.tail, p...)
+	if len(w.tail) > MaxTracebackBufferSize {
+		w.tail = w.tail[len(w.tail)-MaxTracebackBufferSize:]
+	}
 	if w.regexpMainPath == nil {
 		return w.jupyterWriter.Write(p)
 	}
@@ -428,8 +558,11 @@ Alternatively try '%goworkfix' that will do it automatically for you.
 )
 
 // filterGoGetError parses the "go get" execution err, and adds a warning in case it's about the
-// `go get` not supporting workspaces (`go.work`).
+// `go get` not supporting workspaces (`go.work`), or about fetching private modules.
 func (s *State) filterGoGetError(output string) string {
+	if note := privateModuleNote(output); note != "" {
+		output = fmt.Sprintf("%s\n%s", output, note)
+	}
 	if !s.hasGoWork {
 		// Nothing to do.
 		return output
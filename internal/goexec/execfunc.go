@@ -0,0 +1,243 @@
+package goexec
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// This file implements the zero-boilerplate calls of `%exec <FuncName> [<args...>]`: if the function has
+// parameters or results, a `main` function is generated that converts the program arguments to the parameters
+// (based on their declared types) and prints the results.
+
+// cellExecFunction returns the name of the function to execute given by a `%exec <FuncName>` line of the cell,
+// or an empty string if there is none.
+func cellExecFunction(lines []string) string {
+	for _, line := range lines {
+		parts := strings.Fields(TrimGonbCommentPrefix(line))
+		if len(parts) >= 2 && parts[0] == "%exec" {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
+// execMainFunction returns the `main` function for `%exec fnName`: if the function has parameters or results,
+// it is a wrapper that converts the program arguments and prints the results. Otherwise (or if the function
+// is not found), the mainDecl given (that simply calls the function) is returned.
+func execMainFunction(decls *Declarations, fnName string, mainDecl *Function) (*Function, error) {
+	fn, found := decls.Functions[fnName]
+	if !found || fn.Receiver != "" {
+		return mainDecl, nil
+	}
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "", "package main\n\n"+fn.Definition, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%%exec: failed to parse the definition of %q", fnName)
+	}
+	var funcDecl *ast.FuncDecl
+	if len(file.Decls) > 0 {
+		funcDecl, _ = file.Decls[len(file.Decls)-1].(*ast.FuncDecl)
+	}
+	if funcDecl == nil {
+		return nil, errors.Errorf("%%exec: %q is not a function", fnName)
+	}
+	definition, err := execWrapperDefinition(fnName, funcDecl.Type)
+	if err != nil || definition == "" {
+		return mainDecl, err
+	}
+	wrapper := &Function{
+		Cursor:     NoCursor,
+		Key:        "main",
+		Name:       "main",
+		Definition: definition,
+	}
+	// All lines of the wrapper are attributed to the `%exec` line of the cell.
+	wrapper.CellLines.Id = mainDecl.CellLines.Id
+	if len(mainDecl.CellLines.Lines) > 0 {
+		numLines := strings.Count(definition, "\n") + 1
+		wrapper.CellLines.Lines = make([]int, numLines)
+		for ii := range wrapper.CellLines.Lines {
+			wrapper.CellLines.Lines[ii] = mainDecl.CellLines.Lines[0]
+		}
+	}
+	return wrapper, nil
+}
+
+// execParam is a parameter of the function called by `%exec`.
+type execParam struct {
+	name, typeStr string
+	variadic      bool
+}
+
+// execWrapperDefinition returns the definition of the `main` function wrapping the call to fnName, with the
+// given signature. It returns an empty string if the function has no parameters and no results.
+func execWrapperDefinition(fnName string, fnType *ast.FuncType) (string, error) {
+	if fnType.TypeParams != nil && len(fnType.TypeParams.List) > 0 {
+		return "", errors.Errorf("%%exec doesn't support generic functions, %q has type parameters", fnName)
+	}
+	var params []execParam
+	if fnType.Params != nil {
+		for _, field := range fnType.Params.List {
+			param := execParam{typeStr: types.ExprString(field.Type)}
+			if ellipsis, ok := field.Type.(*ast.Ellipsis); ok {
+				param.typeStr, param.variadic = types.ExprString(ellipsis.Elt), true
+			}
+			if len(field.Names) == 0 {
+				param.name = fmt.Sprintf("arg%d", len(params))
+				params = append(params, param)
+				continue
+			}
+			for _, name := range field.Names {
+				param.name = name.Name
+				params = append(params, param)
+			}
+		}
+	}
+	var resultNames, resultTypes []string
+	if fnType.Results != nil {
+		for _, field := range fnType.Results.List {
+			typeStr := types.ExprString(field.Type)
+			if len(field.Names) == 0 {
+				resultNames, resultTypes = append(resultNames, ""), append(resultTypes, typeStr)
+				continue
+			}
+			for _, name := range field.Names {
+				resultNames, resultTypes = append(resultNames, name.Name), append(resultTypes, typeStr)
+			}
+		}
+	}
+	if len(params) == 0 && len(resultTypes) == 0 {
+		return "", nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("func main() {\n\tflag.Parse()\n\tgonbExecArgs := flag.Args()\n")
+	numFixed := len(params)
+	usage := make([]string, 0, len(params))
+	for _, param := range params {
+		if param.variadic {
+			numFixed--
+			usage = append(usage, fmt.Sprintf("%s ...%s", param.name, param.typeStr))
+		} else {
+			usage = append(usage, fmt.Sprintf("%s %s", param.name, param.typeStr))
+		}
+	}
+	if numFixed == len(params) {
+		_, _ = fmt.Fprintf(&sb, "\tif len(gonbExecArgs) != %d {\n", numFixed)
+	} else {
+		_, _ = fmt.Fprintf(&sb, "\tif len(gonbExecArgs) < %d {\n", numFixed)
+	}
+	_, _ = fmt.Fprintf(&sb, "\t\tfmt.Fprintf(os.Stderr, \"%%%%exec %s: expected arguments (%s), got %%d\\n\", len(gonbExecArgs))\n",
+		fnName, strings.ReplaceAll(strings.Join(usage, ", "), `"`, `\"`))
+	sb.WriteString("\t\tos.Exit(2)\n\t}\n")
+
+	needsFail := false
+	for _, param := range params {
+		if param.typeStr != "string" {
+			needsFail = true
+		}
+	}
+	if needsFail {
+		_, _ = fmt.Fprintf(&sb, "\tgonbExecFail := func(name, value string, err error) {\n"+
+			"\t\tfmt.Fprintf(os.Stderr, \"%%%%exec %s: invalid value %%q for parameter %%s: %%v\\n\", value, name, err)\n"+
+			"\t\tos.Exit(2)\n\t}\n", fnName)
+	}
+	callArgs := make([]string, 0, len(params))
+	for ii, param := range params {
+		argVar := fmt.Sprintf("gonbArg%d", ii)
+		if param.variadic {
+			_, _ = fmt.Fprintf(&sb, "\t%s := make([]%s, 0, len(gonbExecArgs)-%d)\n", argVar, param.typeStr, ii)
+			_, _ = fmt.Fprintf(&sb, "\tfor _, gonbValue := range gonbExecArgs[%d:] {\n", ii)
+			_, _ = fmt.Fprintf(&sb, "\t\tvar gonbElem %s\n", param.typeStr)
+			sb.WriteString(execConversion(param, "gonbValue", "gonbElem", "\t\t"))
+			_, _ = fmt.Fprintf(&sb, "\t\t%s = append(%s, gonbElem)\n\t}\n", argVar, argVar)
+			callArgs = append(callArgs, argVar+"...")
+			continue
+		}
+		_, _ = fmt.Fprintf(&sb, "\tvar %s %s\n", argVar, param.typeStr)
+		sb.WriteString(execConversion(param, fmt.Sprintf("gonbExecArgs[%d]", ii), argVar, "\t"))
+		callArgs = append(callArgs, argVar)
+	}
+
+	call := fmt.Sprintf("%s(%s)", fnName, strings.Join(callArgs, ", "))
+	if len(resultTypes) == 0 {
+		_, _ = fmt.Fprintf(&sb, "\t%s\n}", call)
+		return sb.String(), nil
+	}
+	resultVars := make([]string, len(resultTypes))
+	for ii := range resultTypes {
+		resultVars[ii] = fmt.Sprintf("gonbResult%d", ii)
+	}
+	_, _ = fmt.Fprintf(&sb, "\t%s := %s\n", strings.Join(resultVars, ", "), call)
+	for ii, typeStr := range resultTypes {
+		if typeStr == "error" {
+			_, _ = fmt.Fprintf(&sb, "\tif %s != nil {\n\t\tfmt.Fprintf(os.Stderr, \"%%%%exec %s: %%+v\\n\", %s)\n\t\tos.Exit(1)\n\t}\n",
+				resultVars[ii], fnName, resultVars[ii])
+		}
+	}
+	for ii, typeStr := range resultTypes {
+		if typeStr == "error" {
+			continue
+		}
+		label := ""
+		if resultNames[ii] != "" && resultNames[ii] != "_" {
+			label = resultNames[ii] + " = "
+		}
+		if typeStr == "string" {
+			_, _ = fmt.Fprintf(&sb, "\tfmt.Printf(\"%s%%s\\n\", %s)\n", label, resultVars[ii])
+		} else {
+			_, _ = fmt.Fprintf(&sb, "\tfmt.Printf(\"%s%%+v\\n\", %s)\n", label, resultVars[ii])
+		}
+	}
+	sb.WriteString("}")
+	return sb.String(), nil
+}
+
+// execParsers maps the types of parameters converted with a `strconv` (or `time`) function to the conversion
+// expression, given the name of the string variable holding the value.
+var execParsers = map[string]string{
+	"int":           "strconv.ParseInt(%s, 0, 0)",
+	"int8":          "strconv.ParseInt(%s, 0, 8)",
+	"int16":         "strconv.ParseInt(%s, 0, 16)",
+	"int32":         "strconv.ParseInt(%s, 0, 32)",
+	"rune":          "strconv.ParseInt(%s, 0, 32)",
+	"int64":         "strconv.ParseInt(%s, 0, 64)",
+	"uint":          "strconv.ParseUint(%s, 0, 0)",
+	"uint8":         "strconv.ParseUint(%s, 0, 8)",
+	"byte":          "strconv.ParseUint(%s, 0, 8)",
+	"uint16":        "strconv.ParseUint(%s, 0, 16)",
+	"uint32":        "strconv.ParseUint(%s, 0, 32)",
+	"uint64":        "strconv.ParseUint(%s, 0, 64)",
+	"uintptr":       "strconv.ParseUint(%s, 0, 64)",
+	"float32":       "strconv.ParseFloat(%s, 32)",
+	"float64":       "strconv.ParseFloat(%s, 64)",
+	"bool":          "strconv.ParseBool(%s)",
+	"time.Duration": "time.ParseDuration(%s)",
+}
+
+// execConversion returns the code that converts the string in variable src to the type of the param, storing
+// it in variable dst. Strings are used as is, basic types are parsed with `strconv`, and any other type
+// (slices, maps, structs, named types) is parsed as JSON.
+func execConversion(param execParam, src, dst, indent string) string {
+	if param.typeStr == "string" {
+		return fmt.Sprintf("%s%s = %s\n", indent, dst, src)
+	}
+	if parse, found := execParsers[param.typeStr]; found {
+		return fmt.Sprintf("%[1]sif gonbValue, err := %[2]s; err != nil {\n"+
+			"%[1]s\tgonbExecFail(%[3]q, %[4]s, err)\n"+
+			"%[1]s} else {\n"+
+			"%[1]s\t%[5]s = %[6]s(gonbValue)\n"+
+			"%[1]s}\n",
+			indent, fmt.Sprintf(parse, src), param.name, src, dst, param.typeStr)
+	}
+	return fmt.Sprintf("%[1]sif err := json.Unmarshal([]byte(%[2]s), &%[3]s); err != nil {\n"+
+		"%[1]s\tgonbExecFail(%[4]q, %[2]s, err)\n"+
+		"%[1]s}\n",
+		indent, src, dst, param.name)
+}
@@ -0,0 +1,96 @@
+package goexec
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCellExecFunction(t *testing.T) {
+	assert.Equal(t, "Add", cellExecFunction([]string{"func Add(a, b int) int { return a + b }", "%exec Add 1 2"}))
+	assert.Equal(t, "Add", cellExecFunction([]string{"//gonb:%exec Add"}))
+	assert.Equal(t, "", cellExecFunction([]string{"%exec", "%%"}))
+}
+
+// runExecWrapper compiles the function definition with the `main` wrapper generated for it, runs it with args,
+// and returns its combined output.
+func runExecWrapper(t *testing.T, fnName, fnDefinition string, args ...string) (string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", "package main\n\n"+fnDefinition, parser.SkipObjectResolution)
+	require.NoError(t, err)
+	wrapper, err := execWrapperDefinition(fnName, file.Decls[0].(*ast.FuncDecl).Type)
+	require.NoError(t, err)
+	require.NotEmpty(t, wrapper)
+	code := "package main\n\nimport (\n\t\"encoding/json\"\n\t\"flag\"\n\t\"fmt\"\n\t\"os\"\n\t\"strconv\"\n\t\"time\"\n)\n\n" +
+		"var _, _, _ = json.Marshal, strconv.Itoa, time.Second\n\n" + fnDefinition + "\n\n" + wrapper + "\n"
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "main.go"), []byte(code), 0600))
+	cmd := exec.Command("go", append([]string{"run", "main.go"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO111MODULE=off")
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func TestExecWrapperDefinition(t *testing.T) {
+	fnDefinition := `func Scale(factor float64, verbose bool, d time.Duration, xs []int, names ...string) (sum float64, err error) {
+	if len(xs) == 0 {
+		return 0, fmt.Errorf("no values")
+	}
+	for _, x := range xs {
+		sum += factor * float64(x)
+	}
+	if verbose {
+		fmt.Println(d, describe(names))
+	}
+	return
+}
+
+func describe(names []string) string { return fmt.Sprint(len(names), names) }`
+	output, err := runExecWrapper(t, "Scale", fnDefinition, "0.5", "true", "2s", "[1,2,3]", "a", "b")
+	require.NoErrorf(t, err, "output: %s", output)
+	assert.Equal(t, "2s 2 [a b]\nsum = 3\n", output)
+
+	output, err = runExecWrapper(t, "Scale", fnDefinition, "0.5", "false", "2s", "[]")
+	require.Error(t, err)
+	assert.Contains(t, output, "%exec Scale: no values")
+
+	output, err = runExecWrapper(t, "Scale", fnDefinition, "0.5", "maybe", "2s", "[1]")
+	require.Error(t, err)
+	assert.Contains(t, output, `%exec Scale: invalid value "maybe" for parameter verbose`)
+
+	output, err = runExecWrapper(t, "Scale", fnDefinition, "0.5")
+	require.Error(t, err)
+	assert.Contains(t, output, "%exec Scale: expected arguments (factor float64, verbose bool, d time.Duration, xs []int, names ...string), got 1")
+
+	output, err = runExecWrapper(t, "Greet", `func Greet(name string) string { return "Hello, " + name }`, "Gopher")
+	require.NoErrorf(t, err, "output: %s", output)
+	assert.Equal(t, "Hello, Gopher\n", output)
+
+	// Functions without parameters nor results are called directly.
+	file, err := parser.ParseFile(token.NewFileSet(), "", "package main\n\nfunc Run() {}", parser.SkipObjectResolution)
+	require.NoError(t, err)
+	wrapper, err := execWrapperDefinition("Run", file.Decls[0].(*ast.FuncDecl).Type)
+	require.NoError(t, err)
+	assert.Empty(t, wrapper)
+}
+
+func TestExecMainFunction(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	require.NoError(t, s.MemorizeCell(nil, 1, []string{"func Add(a, b int) int { return a + b }"}, MakeSet[int]()))
+	_, mainDecl, _, _, err := s.parseLinesAndComposeMain(nil, 2, []string{"%exec Add 1 2"}, SetWithValues(0), NoCursor)
+	require.NoError(t, err)
+	assert.Contains(t, mainDecl.Definition, "gonbResult0 := Add(gonbArg0, gonbArg1)")
+	assert.Equal(t, 2, mainDecl.CellLines.Id)
+	for _, line := range mainDecl.CellLines.Lines {
+		assert.Equal(t, 0, line)
+	}
+}
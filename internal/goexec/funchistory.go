@@ -0,0 +1,83 @@
+package goexec
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// This file implements the history of the memorized functions: when a cell redefines (or removes) a function,
+// its previous version is kept, so it can be compared with the current one, see `%bench -compare`.
+
+// MaxFunctionVersions is the maximum number of previous versions kept for each memorized function.
+var MaxFunctionVersions = 10
+
+// recordFunctionHistory records the previous versions of the memorized functions that are redefined (or
+// removed) in updatedDecls, before they replace the memorized declarations.
+func (s *State) recordFunctionHistory(updatedDecls *Declarations) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	for key, fn := range s.Definitions.Functions {
+		if updated, found := updatedDecls.Functions[key]; found && updated.Definition == fn.Definition {
+			continue
+		}
+		if s.functionHistory == nil {
+			s.functionHistory = make(map[string][]*Function)
+		}
+		versions := append(s.functionHistory[key], fn)
+		if len(versions) > MaxFunctionVersions {
+			versions = versions[len(versions)-MaxFunctionVersions:]
+		}
+		s.functionHistory[key] = versions
+	}
+}
+
+// regexpRevision matches a revision of a function, e.g.: "HEAD", "HEAD~2" or "HEAD^".
+var regexpRevision = regexp.MustCompile(`^HEAD(?:~(\d+)|(\^*))$`)
+
+// ParseRevision parses a revision of a function, in the format of git: "HEAD" is the current version, "HEAD~1"
+// (or "HEAD^") the previous one, "HEAD~2" (or "HEAD^^") the one before, etc.
+// It returns how many versions back the revision is.
+func ParseRevision(revision string) (int, error) {
+	matches := regexpRevision.FindStringSubmatch(revision)
+	if matches == nil {
+		return 0, errors.Errorf("invalid revision %q: use HEAD~<n> for the n-th previous version", revision)
+	}
+	if matches[1] != "" {
+		return strconv.Atoi(matches[1])
+	}
+	return len(matches[2]), nil
+}
+
+// FunctionVersion returns a version of the memorized function (or method, given as `<Type>.<Method>`):
+// back is 0 for the current version, 1 for the previous one, etc.
+func (s *State) FunctionVersion(name string, back int) (*Function, error) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.functionVersionLocked(name, back)
+}
+
+// functionVersionLocked implements FunctionVersion. It must be called with stateMu locked.
+func (s *State) functionVersionLocked(name string, back int) (*Function, error) {
+	key := functionKeyFromName(name)
+	if back == 0 {
+		fn, found := s.Definitions.Functions[key]
+		if !found {
+			return nil, errors.Errorf("function %q is not among the memorized declarations (methods are given as `<Type>.<Method>`)", name)
+		}
+		return fn, nil
+	}
+	versions := s.functionHistory[key]
+	if back > len(versions) {
+		return nil, errors.Errorf("function %q has only %d previous versions, HEAD~%d is not available", name, len(versions), back)
+	}
+	return versions[len(versions)-back], nil
+}
+
+// functionKeyFromName returns the key in Declarations.Functions of a function, or a method given as
+// `<Type>.<Method>`.
+func functionKeyFromName(name string) string {
+	return strings.Replace(name, ".", "~", 1)
+}
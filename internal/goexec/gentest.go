@@ -0,0 +1,190 @@
+package goexec
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// This file implements the generation of a table-driven test skeleton for a memorized function,
+// used by `%gentest`.
+
+// AddPayload adds a payload to be sent back to the front-end in the `execute_reply` of the
+// current cell. See https://jupyter-client.readthedocs.io/en/latest/messaging.html#payloads-deprecated
+func (s *State) AddPayload(payload map[string]any) {
+	s.payloads = append(s.payloads, payload)
+}
+
+// SetNextInput adds a "set_next_input" payload, which makes the front-end create a new cell (or
+// replace the current one, if replace is true) with the given text.
+func (s *State) SetNextInput(text string, replace bool) {
+	s.AddPayload(map[string]any{
+		"source":  "set_next_input",
+		"text":    text,
+		"replace": replace,
+	})
+}
+
+// TakePayloads returns the payloads added during the execution of the current cell, and resets them.
+func (s *State) TakePayloads() []map[string]any {
+	payloads := s.payloads
+	s.payloads = nil
+	return payloads
+}
+
+// GenerateTest returns the contents of a `%test` cell with a table-driven test skeleton for the
+// memorized function funcName. Methods can be given as "Type.Method".
+//
+// The fields of the test cases are derived from the parameters and results of the function: if the
+// last result is an `error`, it is checked with a `wantErr` field.
+func (s *State) GenerateTest(funcName string) (string, error) {
+	key := strings.Replace(funcName, ".", "~", 1)
+	fn, found := s.Definitions.Functions[key]
+	if !found {
+		return "", errors.Errorf("function %q not found in memorized definitions, see `%%list`", funcName)
+	}
+	return generateTest(fn.Definition)
+}
+
+// generateTest parses the function definition and returns the test skeleton for it.
+func generateTest(definition string) (string, error) {
+	fileSet := token.NewFileSet()
+	f, err := parser.ParseFile(fileSet, "", "package main\n\n"+definition, parser.SkipObjectResolution)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse function definition")
+	}
+	var funcDecl *ast.FuncDecl
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok {
+			funcDecl = fd
+			break
+		}
+	}
+	if funcDecl == nil {
+		return "", errors.New("no function found in definition")
+	}
+	if funcDecl.Type.TypeParams != nil && len(funcDecl.Type.TypeParams.List) > 0 {
+		return "", errors.Errorf("%%gentest doesn't support generic functions (%s)", funcDecl.Name.Name)
+	}
+
+	exprStr := func(expr ast.Expr) string {
+		var buf bytes.Buffer
+		_ = format.Node(&buf, fileSet, expr)
+		return buf.String()
+	}
+	reserved := map[string]bool{"name": true, "wantErr": true, "t": true, "tc": true, "got": true, "err": true}
+
+	type field struct{ name, typ string }
+	var fields []field
+
+	// Receiver.
+	callee := funcDecl.Name.Name
+	testName := "Test" + strings.ToUpper(callee[:1]) + callee[1:]
+	if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
+		recvType := exprStr(funcDecl.Recv.List[0].Type)
+		fields = append(fields, field{"receiver", recvType})
+		callee = "tc.receiver." + callee
+		testName = fmt.Sprintf("Test%s_%s", strings.TrimPrefix(recvType, "*"), funcDecl.Name.Name)
+	}
+
+	// Parameters.
+	var args []string
+	numParams := 0
+	for _, param := range funcDecl.Type.Params.List {
+		typ := param.Type
+		variadic := false
+		if ellipsis, ok := typ.(*ast.Ellipsis); ok {
+			variadic = true
+			typ = ellipsis.Elt
+		}
+		typStr := exprStr(typ)
+		if variadic {
+			typStr = "[]" + typStr
+		}
+		names := param.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{{Name: "_"}}
+		}
+		for _, ident := range names {
+			name := ident.Name
+			if name == "_" || reserved[name] || name == "receiver" || strings.HasPrefix(name, "want") {
+				name = fmt.Sprintf("arg%d", numParams)
+			}
+			numParams++
+			fields = append(fields, field{name, typStr})
+			arg := "tc." + name
+			if variadic {
+				arg += "..."
+			}
+			args = append(args, arg)
+		}
+	}
+
+	// Results.
+	var results []string
+	var gots []string
+	hasErr := false
+	if funcDecl.Type.Results != nil {
+		for _, result := range funcDecl.Type.Results.List {
+			n := max(len(result.Names), 1)
+			for ii := 0; ii < n; ii++ {
+				results = append(results, exprStr(result.Type))
+			}
+		}
+	}
+	if len(results) > 0 && results[len(results)-1] == "error" {
+		hasErr = true
+		results = results[:len(results)-1]
+	}
+	for ii, typ := range results {
+		name, got := "want", "got"
+		if len(results) > 1 {
+			name, got = fmt.Sprintf("want%d", ii), fmt.Sprintf("got%d", ii)
+		}
+		fields = append(fields, field{name, typ})
+		gots = append(gots, got)
+	}
+	if hasErr {
+		fields = append(fields, field{"wantErr", "bool"})
+		gots = append(gots, "err")
+	}
+
+	var w strings.Builder
+	fmt.Fprintf(&w, "func %s(t *testing.T) {\n", testName)
+	w.WriteString("\ttestCases := []struct {\n\t\tname string\n")
+	for _, f := range fields {
+		fmt.Fprintf(&w, "\t\t%s %s\n", f.name, f.typ)
+	}
+	w.WriteString("\t}{\n\t\t// TODO: Add test cases.\n\t}\n")
+	w.WriteString("\tfor _, tc := range testCases {\n\t\tt.Run(tc.name, func(t *testing.T) {\n")
+	call := fmt.Sprintf("%s(%s)", callee, strings.Join(args, ", "))
+	if len(gots) > 0 {
+		fmt.Fprintf(&w, "\t\t\t%s := %s\n", strings.Join(gots, ", "), call)
+	} else {
+		fmt.Fprintf(&w, "\t\t\t%s\n", call)
+	}
+	if hasErr {
+		fmt.Fprintf(&w, "\t\t\tif (err != nil) != tc.wantErr {\n"+
+			"\t\t\t\tt.Fatalf(\"%s() error = %%v, wantErr %%v\", err, tc.wantErr)\n\t\t\t}\n", funcDecl.Name.Name)
+	}
+	for ii := range results {
+		got, want := gots[ii], "tc.want"
+		if len(results) > 1 {
+			want = fmt.Sprintf("tc.want%d", ii)
+		}
+		fmt.Fprintf(&w, "\t\t\tif !reflect.DeepEqual(%s, %s) {\n"+
+			"\t\t\t\tt.Errorf(\"%s() %s = %%v, want %%v\", %s, %s)\n\t\t\t}\n",
+			got, want, funcDecl.Name.Name, got, got, want)
+	}
+	w.WriteString("\t\t})\n\t}\n}\n")
+	formatted, err := format.Source([]byte(w.String()))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to format generated test:\n%s", w.String())
+	}
+	return "%test\n" + string(formatted), nil
+}
@@ -0,0 +1,46 @@
+package goexec
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestGenerateTest(t *testing.T) {
+	for _, definition := range []string{
+		"func Div(a, b int) (int, error) { return a / b, nil }",
+		"func (p *Point) Scale(factor float64, _ bool) Point { return *p }",
+		"func sum(name string, values ...int) (total int, count int) { return }",
+		"func run() {}",
+	} {
+		test, err := generateTest(definition)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(test, "%test\n"))
+		_, err = parser.ParseFile(token.NewFileSet(), "", "package main\n"+strings.TrimPrefix(test, "%test\n"), 0)
+		require.NoErrorf(t, err, "Generated test for %q doesn't parse:\n%s", definition, test)
+	}
+
+	test, err := generateTest("func Div(a, b int) (int, error) { return a / b, nil }")
+	require.NoError(t, err)
+	assert.Contains(t, test, "func TestDiv(t *testing.T)")
+	assert.Contains(t, test, "got, err := Div(tc.a, tc.b)")
+	assert.Contains(t, test, "wantErr bool")
+
+	test, err = generateTest("func (p *Point) Scale(factor float64, _ bool) Point { return *p }")
+	require.NoError(t, err)
+	assert.Contains(t, test, "func TestPoint_Scale(t *testing.T)")
+	assert.Contains(t, test, "receiver *Point")
+	assert.Contains(t, test, "got := tc.receiver.Scale(tc.factor, tc.arg1)")
+
+	test, err = generateTest("func sum(name string, values ...int) (total int, count int) { return }")
+	require.NoError(t, err)
+	assert.Contains(t, test, "func TestSum(t *testing.T)")
+	assert.Contains(t, test, "values []int")
+	assert.Contains(t, test, "got0, got1 := sum(tc.arg0, tc.values...)")
+
+	_, err = generateTest("func Map[T any](x T) T { return x }")
+	require.Error(t, err)
+}
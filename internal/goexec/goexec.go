@@ -10,15 +10,19 @@ import (
 	"github.com/janpfeifer/gonb/gonbui/protocol"
 	"github.com/janpfeifer/gonb/internal/comms"
 	"github.com/janpfeifer/gonb/internal/goexec/goplsclient"
+	"github.com/janpfeifer/gonb/internal/jpyexec"
 	"github.com/janpfeifer/gonb/internal/kernel"
 	"github.com/pkg/errors"
-	"io"
+	"golang.org/x/mod/module"
 	"k8s.io/klog/v2"
+	"net"
 	"os"
 	"os/exec"
 	"path"
 	"regexp"
 	"slices"
+	"sync"
+	"time"
 )
 
 const (
@@ -51,6 +55,10 @@ type State struct {
 	GoBuildFlags []string // Flags to be passed to `go build`, in State.Compile.
 	AutoGet      bool     // Whether to do a "go get" before compiling, to fetch missing external modules.
 
+	// BuildTags are the build tags of the session, passed with `-tags` to the builds, see SetBuildTags.
+	// CellBuildTags are additional tags for the current cell only. See `%tags`.
+	BuildTags, CellBuildTags []string
+
 	// Global elements defined mapped by their keys.
 	Definitions *Declarations
 
@@ -77,13 +85,34 @@ type State struct {
 	// preserved for debugging.
 	preserveTempDir bool
 
-	// rawError indicates no HTML context to compilation errors should be added.
-	rawError bool
+	// errorFormat defines how compilation errors are reported, see SetErrorFormat.
+	errorFormat ErrorFormat
+
+	// startupSettings are the settings configured by the kernel flags, restored by SoftReset.
+	// See SaveStartupSettings.
+	startupSettings startupSettings
 
 	// cellExecChan serializes requests to `ExecuteCell`, since requests come from
 	// Jupyter before previous cell execution finishes, and we want to keep the order.
 	cellExecChan chan *cellExecParams
 
+	// composeMu guards the composition of the program in TempDir, the tracking of `go.mod` and the compilation.
+	// It is held by cell executions until the program is built. Introspection requests (InspectIdentifierInCell
+	// and AutoCompleteOptionsInCell) compose their programs in the shadow package (see ShadowDir), and only use it
+	// if they need to update `go.mod`.
+	composeMu sync.Mutex
+
+	// stateMu guards the fields shared with the introspection requests, which are served concurrently with
+	// the cell executions. See UpdateDefinitions and the other methods in `stateupdate.go`.
+	stateMu sync.Mutex
+
+	// introspectionMu serializes the introspection requests, which share the shadow package.
+	introspectionMu sync.Mutex
+
+	// moduleDir, if set, is the directory of `go.mod`, when it is not TempDir: the case of the State used by
+	// introspection requests, see introspectionState.
+	moduleDir string
+
 	// CellIsTest indicates whether the current cell is to be compiled with `go test` (as opposed to `go build`).
 	// This also triggers writing the code to `main_test.go` as opposed to `main.go`.
 	// Usually this is set and reset after the execution -- the default being the normal build.
@@ -95,13 +124,126 @@ type State struct {
 	CellIsWasm                  bool
 	WasmDir, WasmUrl, WasmDivId string
 
+	// WasmBaseDir and WasmBaseUrl override where the `%wasm` files are stored, and the URL from where they are
+	// served. If empty, the directory `jupyter_files` under the Jupyter root directory is used. See SetWasmLocation.
+	WasmBaseDir, WasmBaseUrl string
+
+	// AssetsDir and AssetsUrl are where the programs publish assets (files) to be served to the front-end,
+	// see SetAssetsEnv.
+	AssetsDir, AssetsUrl string
+
 	// Comms represents the communication with the front-end.
 	Comms *comms.State
 
-	// CaptureFile is the file where to write any cell output. It is closed and set to nil at the end of the cell
-	// executions.
+	// SnapshotPath, if set, is where to save a snapshot of the output of the cell being executed, requested with
+	// `%snapshot`. It is taken (and reset) by the dispatcher after the cell is executed.
+	SnapshotPath string
+
+	// Deterministic holds the configuration of the deterministic mode, if enabled with `%deterministic on`.
+	Deterministic *DeterministicMode
+
+	// Coverage holds the coverage data accumulated by `%cover-session`, or nil if no session was started.
+	Coverage *CoverageSession
+
+	// Capture is where to write any cell output, configured with `%capture`. It is closed and set to nil
+	// at the end of the cell executions.
 	// If nil, no output is to be captured.
-	CaptureFile io.WriteCloser
+	Capture *Capture
+
+	// PreRunHooks and PostRunHooks are command lines (special commands or shell commands) executed
+	// before and after each cell with Go code. See `%hook` and HookRunner.
+	PreRunHooks, PostRunHooks []string
+
+	// HookRunner is used to execute PreRunHooks and PostRunHooks.
+	HookRunner HookRunner
+
+	// CompletionProvider is an optional external source of auto-complete suggestions, merged with
+	// those of gopls. See NewCompletionProvider.
+	CompletionProvider CompletionProvider
+
+	// VetEnabled indicates `go vet` should be executed after each successful compilation. See `%vet`.
+	VetEnabled bool
+
+	// VulnCheckAfterGet indicates the modules are scanned for vulnerabilities (with `govulncheck`, if installed)
+	// after `go get` downloads new versions. See `%vulncheck`.
+	VulnCheckAfterGet bool
+
+	// diagnostics holds the findings of the last `go vet` run, used by InspectIdentifierInCell.
+	diagnostics diagnosticsCache
+
+	// workspaceName is the name of the current workspace, and workspaces holds the other ones. See `%workspace`.
+	workspaceName string
+	workspaces    map[string]*workspace
+
+	// payloads to be included in the `execute_reply` of the current cell. See AddPayload.
+	payloads []map[string]any
+
+	// SanitizeHTML indicates that the HTML output by the cells is sanitized (scripts, iframes, event handlers, etc.
+	// are removed). See `%sanitize_html`.
+	SanitizeHTML bool
+
+	// PagerLines is the number of lines above which long textual outputs (e.g. `%doc`) are sent to the
+	// front-end pager, instead of being displayed inline. If 0, the pager is not used. See `%pager`.
+	PagerLines int
+
+	// StreamBufferInterval is the interval between flushes of the stdout/stderr of the cell programs and shell
+	// commands to the front-end. If 0, the output is published as soon as it is read. See `%stream_buffer`.
+	StreamBufferInterval time.Duration
+
+	// BinaryPolicy defines how the output of the cell programs and shell commands that is not valid UTF-8
+	// is displayed. See `%binary`.
+	BinaryPolicy jpyexec.BinaryPolicy
+
+	// StreamRoutes configures the destination of the named streams written by the cell programs with
+	// `gonbui.Stream`. See `%route`.
+	StreamRoutes map[string]jpyexec.StreamRoute
+
+	// SignalPolicy defines the signals forwarded to the cell programs when the execution is interrupted (or the
+	// kernel shuts down), and how long to wait before killing them. See `%signals`.
+	SignalPolicy jpyexec.SignalPolicy
+
+	// functionHistory holds the previous versions of the memorized functions, indexed by their keys, the most
+	// recent last. See FunctionVersion. Guarded by stateMu.
+	functionHistory map[string][]*Function
+
+	// moduleDownloads are the modules downloaded by the `go` commands executed by the kernel in the session,
+	// see GoProxyStats. Guarded by stateMu.
+	moduleDownloads map[module.Version]bool
+
+	// previousCode and lastCode are the contents of the last two composed programs (`main.go` or `main_test.go`)
+	// that compiled successfully. See ComposedCodeHistory.
+	previousCode, lastCode string
+
+	// lastFileToCellIdAndLine maps the lines of lastCode to the cells and lines where they were defined.
+	lastFileToCellIdAndLine []CellIdAndLine
+
+	// shellHistory holds the shell commands (`!` lines) executed in the session, the most recent last.
+	// See AddShellHistory.
+	shellHistory []string
+
+	// listeners are the listening sockets created with `%listen`, indexed by name, inherited by the cell
+	// programs. See Listen. Guarded by stateMu.
+	listeners map[string]net.Listener
+
+	// persistedVars are the names of the variables whose values are carried over from one cell to the next.
+	// See PersistVariable. Guarded by stateMu.
+	persistedVars common.Set[string]
+
+	// hiddenTests are the tests stored by `%%hidden_tests` cells, run by `%autograde`. See SetHiddenTests.
+	// Guarded by stateMu.
+	hiddenTests []*hiddenTestsCell
+
+	// cellLabels maps the labels (`%label`) of the cells that ran in the session to the id of the last cell
+	// with the label. See SetCellLabel. Guarded by stateMu.
+	cellLabels map[string]int
+
+	// mainTemplate is the template of the `main` function composed for `%%` cells. See SetMainTemplate.
+	// Guarded by stateMu.
+	mainTemplate *mainTemplate
+
+	// Store is the key/value store used by the cell programs (with `gonbui/store`) to pass values from one
+	// cell to the next. See `%store`.
+	Store *Store
 }
 
 // Declarations is a collection of declarations that we carry over from one cell to another.
@@ -111,6 +253,10 @@ type Declarations struct {
 	Types     map[string]*TypeDecl
 	Imports   map[string]*Import
 	Constants map[string]*Constant
+
+	// InitOrder holds the keys of the `init_*` functions in the order they should be rendered (and hence executed).
+	// Init functions not listed are rendered afterward, sorted by key. See SetInitOrder.
+	InitOrder []string
 }
 
 // New returns an empty State object, that can be used to execute Cells.
@@ -119,7 +265,7 @@ type Declarations struct {
 // and it's preserved when the kernel exits -- helpful for debugging.
 //
 // If rawError is true, the parsing of compiler errors doesn't generate HTML, instead it
-// uses only text.
+// uses only text (ErrorFormatText). It can be changed later with SetErrorFormat.
 //
 // The kernel object passed in `k` can be nil for testing, but this may lead to some leaking
 // goroutines, that stop when the kernel stops.
@@ -128,14 +274,18 @@ func New(k *kernel.Kernel, uniqueID string, preserveTempDir, rawError bool) (*St
 		Kernel:          k,
 		UniqueID:        uniqueID,
 		Package:         "gonb_" + uniqueID,
-		Definitions:     NewDeclarations(),
-		AutoGet:         true,
 		trackingInfo:    newTrackingInfo(),
 		preserveTempDir: preserveTempDir,
-		rawError:        rawError,
 		Comms:           comms.New(),
 		cellExecChan:    make(chan *cellExecParams),
+		errorFormat:     ErrorFormatHTML,
+		Store:           NewStore(),
 	}
+	if rawError {
+		s.errorFormat = ErrorFormatText
+	}
+	s.SaveStartupSettings()
+	s.resetSession()
 
 	// Goroutine that processes incoming ExecuteCell requests.
 	// It stops when the kernel stops.
@@ -168,6 +318,13 @@ func New(k *kernel.Kernel, uniqueID string, preserveTempDir, rawError bool) (*St
 		klog.Errorf("Failed to set environment variable %q: %+v", protocol.GONB_TMP_DIR_ENV, err)
 		err = nil
 	}
+	if err = s.Store.createSharedDir(s.Package, s.TempDir); err != nil {
+		klog.Errorf("Files can't be handed between cells with `store.WriteShared`: %+v", err)
+		err = nil
+	} else if err = os.Setenv(protocol.GONB_SHARED_DIR_ENV, s.Store.SharedDir()); err != nil {
+		klog.Errorf("Failed to set environment variable %q: %+v", protocol.GONB_SHARED_DIR_ENV, err)
+		err = nil
+	}
 
 	if err = s.GoModInit(); err != nil {
 		return nil, err
@@ -175,11 +332,16 @@ func New(k *kernel.Kernel, uniqueID string, preserveTempDir, rawError bool) (*St
 
 	if _, err = exec.LookPath("gopls"); err == nil {
 		s.gopls = goplsclient.New(s.TempDir)
-		err = s.gopls.Start()
-		if err != nil {
-			klog.Errorf("Failed to start `gopls`: %v", err)
+		s.gopls.SetOnDemand(GoplsOnDemand)
+		if GoplsOnDemand {
+			klog.V(1).Infof("`gopls` will be started on demand.")
+		} else {
+			err = s.gopls.Start()
+			if err != nil {
+				klog.Errorf("Failed to start `gopls`: %v", err)
+			}
+			klog.V(1).Infof("Started `gopls`.")
 		}
-		klog.V(1).Infof("Started `gopls`.")
 	} else {
 		msg := `
 Program gopls is not installed. It is used to inspect into code
@@ -230,22 +392,33 @@ func (s *State) GoModInit() error {
 
 // Stop stops gopls and removes temporary files and directories.
 func (s *State) Stop() error {
-	if s.gopls != nil {
-		s.gopls.Shutdown()
+	if gopls := s.goplsClient(); gopls != nil {
+		gopls.Shutdown()
+		s.stateMu.Lock()
 		s.gopls = nil
+		s.stateMu.Unlock()
+	}
+	if !s.preserveTempDir {
+		s.removeWorkspacesDirs()
+	}
+	if err := s.Store.Close(); err != nil {
+		klog.Errorf("Failed to close the store: %+v", err)
 	}
 	if s.TempDir != "" && !s.preserveTempDir {
 		err := os.RemoveAll(s.TempDir)
 		if err != nil {
 			return errors.Wrapf(err, "Failed to remove goexec.State temporary directory %s", s.TempDir)
 		}
+		s.stateMu.Lock()
 		s.TempDir = "/"
+		s.stateMu.Unlock()
 	}
 	if s.Comms != nil {
 		// Close without a message (no sending back a comm_close message),
 		// if not yet closed.
 		s.Comms.Close(nil)
 	}
+	s.closeListeners()
 	return nil
 }
 
@@ -260,6 +433,9 @@ func NewDeclarations() *Declarations {
 }
 
 // Copy returns a new deep copy of the declarations.
+//
+// The declarations themselves are copied as well, so the copy can be changed (e.g. ClearCursor) without
+// affecting the original, which may be shared with concurrent introspection requests.
 func (d *Declarations) Copy() *Declarations {
 	d2 := &Declarations{
 		Imports:   make(map[string]*Import, len(d.Imports)),
@@ -267,8 +443,66 @@ func (d *Declarations) Copy() *Declarations {
 		Variables: make(map[string]*Variable, len(d.Variables)),
 		Types:     make(map[string]*TypeDecl, len(d.Types)),
 		Constants: make(map[string]*Constant, len(d.Constants)),
+		InitOrder: slices.Clone(d.InitOrder),
+	}
+	for key, imp := range d.Imports {
+		impCopy := *imp
+		impCopy.CellLines.Lines = slices.Clone(imp.CellLines.Lines)
+		d2.Imports[key] = &impCopy
+	}
+	for key, fn := range d.Functions {
+		fnCopy := *fn
+		fnCopy.CellLines.Lines = slices.Clone(fn.CellLines.Lines)
+		if fn.Comments != nil {
+			comments := *fn.Comments
+			fnCopy.Comments = &comments
+		}
+		d2.Functions[key] = &fnCopy
+	}
+	for key, typeDecl := range d.Types {
+		typeCopy := *typeDecl
+		typeCopy.CellLines.Lines = slices.Clone(typeDecl.CellLines.Lines)
+		d2.Types[key] = &typeCopy
+	}
+
+	// Variables in tuples and constants in blocks point to each other: the links are remapped to the copies.
+	varCopies := make(map[*Variable]*Variable, len(d.Variables))
+	copyVariable := func(v *Variable) *Variable {
+		if vCopy, found := varCopies[v]; found {
+			return vCopy
+		}
+		vCopy := *v
+		vCopy.CellLines.Lines = slices.Clone(v.CellLines.Lines)
+		varCopies[v] = &vCopy
+		return &vCopy
+	}
+	for key, v := range d.Variables {
+		d2.Variables[key] = copyVariable(v)
+	}
+	for _, vCopy := range varCopies {
+		if vCopy.TupleDefinitions != nil {
+			tuple := make([]*Variable, len(vCopy.TupleDefinitions))
+			for ii, tupleVar := range vCopy.TupleDefinitions {
+				tuple[ii] = copyVariable(tupleVar)
+			}
+			vCopy.TupleDefinitions = tuple
+		}
+	}
+	constCopies := make(map[*Constant]*Constant, len(d.Constants))
+	for key, c := range d.Constants {
+		cCopy := *c
+		cCopy.CellLines.Lines = slices.Clone(c.CellLines.Lines)
+		constCopies[c] = &cCopy
+		d2.Constants[key] = &cCopy
+	}
+	for _, cCopy := range constCopies {
+		if next, found := constCopies[cCopy.Next]; found {
+			cCopy.Next = next
+		}
+		if prev, found := constCopies[cCopy.Prev]; found {
+			cCopy.Prev = prev
+		}
 	}
-	d2.MergeFrom(d)
 	return d2
 }
 
@@ -279,6 +513,9 @@ func (d *Declarations) MergeFrom(d2 *Declarations) {
 	variablesCopyFrom(d.Variables, d2.Variables)
 	copyMap(d.Types, d2.Types)
 	copyMap(d.Constants, d2.Constants)
+	if d2.InitOrder != nil {
+		d.InitOrder = slices.Clone(d2.InitOrder)
+	}
 }
 
 func copyMap[K comparable, V any](dst, src map[K]V) {
@@ -485,5 +722,5 @@ var reDefaultImportPathAlias = regexp.MustCompile(`^.*?(\w[\w0-9_]*)\s*$`)
 //
 // It is connected to the special command `%reset`.
 func (s *State) Reset() {
-	s.Definitions = NewDeclarations()
+	s.setDefinitions(NewDeclarations())
 }
@@ -21,3 +21,30 @@ func TestDirEnv(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, pwd, os.Getenv(protocol.GONB_DIR_ENV))
 }
+
+func TestDeclarationsCopy(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	code := "import \"fmt\"\nvar a, b = fmt.Println()\nconst (\n\tX = iota\n\tY\n)\ntype T int\nfunc f() {}"
+	parseCellForTest(t, s, 1, code)
+	decls := s.Definitions
+	for _, fn := range decls.Functions {
+		fn.Cursor = Cursor{Line: 1, Col: 1}
+	}
+
+	declsCopy := decls.Copy()
+	declsCopy.ClearCursor()
+	assert.True(t, decls.Functions["f"].HasCursor(), "ClearCursor of the copy must not change the original")
+	assert.NotSame(t, decls.Functions["f"], declsCopy.Functions["f"])
+	assert.NotSame(t, decls.Types["T"], declsCopy.Types["T"])
+	assert.NotSame(t, decls.Imports["fmt"], declsCopy.Imports["fmt"])
+
+	// Links between the declarations point to the copies.
+	varA, varB := declsCopy.Variables["a"], declsCopy.Variables["b"]
+	require.Len(t, varA.TupleDefinitions, 2)
+	assert.Same(t, varA, varA.TupleDefinitions[0])
+	assert.Same(t, varB, varA.TupleDefinitions[1])
+	assert.Equal(t, varA.TupleDefinitions, varB.TupleDefinitions)
+	assert.Same(t, declsCopy.Constants["Y"], declsCopy.Constants["X"].Next)
+	assert.Same(t, declsCopy.Constants["X"], declsCopy.Constants["Y"].Prev)
+}
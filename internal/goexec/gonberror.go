@@ -22,6 +22,7 @@ type GonbError struct {
 	Lines  []errorLine
 	errMsg string
 	err    error
+	ansi   bool // Whether the traceback uses ANSI colors, see ErrorFormatANSI.
 }
 
 // newGonbErrors creates a new GonbError object, translating line numbers for each of the
@@ -43,7 +44,8 @@ func newGonbErrors(s *State, fileToCellIdAndLine []CellIdAndLine, errorMsg strin
 
 	// Parse err Lines.
 	lines := strings.Split(errorMsg, "\n")
-	nbErr := &GonbError{Lines: make([]errorLine, len(lines)), errMsg: errorMsg, err: baseErr}
+	nbErr := &GonbError{Lines: make([]errorLine, len(lines)), errMsg: errorMsg, err: baseErr,
+		ansi: s.errorFormat == ErrorFormatANSI}
 	for ii, line := range lines {
 		parsed := s.parseErrorLine(line, codeLines, fileToCellIdAndLine)
 		nbErr.Lines[ii] = parsed
@@ -66,7 +68,7 @@ func (nbErr *GonbError) Error() string {
 func (nbErr *GonbError) Traceback() []string {
 	traceback := make([]string, len(nbErr.Lines))
 	for ii, line := range nbErr.Lines {
-		traceback[ii] = line.getTraceback()
+		traceback[ii] = line.getTraceback(nbErr.ansi)
 	}
 	return traceback
 }
@@ -108,18 +110,49 @@ type errorLine struct {
 	CellInfo    string
 }
 
-// getTraceback renders the colored traceback sent to Jupyter for this errorLine.
-func (e *errorLine) getTraceback() (message string) {
+// getTraceback renders the traceback sent to Jupyter for this errorLine.
+// If ansi is true, it is colored with ANSI escape sequences and the message is wrapped, otherwise it's plain text.
+func (e *errorLine) getTraceback(ansi bool) (message string) {
+	cellInfoColor, contextColor, messageColor := color.New(color.FgCyan, color.Bold), color.New(color.Faint),
+		color.New(color.FgRed)
+	for _, c := range []*color.Color{cellInfoColor, contextColor, messageColor} {
+		if ansi {
+			c.EnableColor()
+		} else {
+			c.DisableColor()
+		}
+	}
 	if e.HasCellInfo {
-		message += e.CellInfo + "\n"
+		message += cellInfoColor.Sprint(e.CellInfo) + "\n"
 	}
 	if e.HasContext {
-		message += e.RawContext + "\n"
+		message += contextColor.Sprint(e.RawContext) + "\n"
+	}
+	errMessage := e.Message
+	if ansi {
+		errMessage = wrapText(errMessage, ErrorLineWrapWidth)
 	}
-	message += color.New(color.FgRed).Sprint(e.Message)
+	message += messageColor.Sprint(errMessage)
 	return message
 }
 
+// wrapText breaks text in lines of at most width characters, at spaces, if possible.
+func wrapText(text string, width int) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		for len(line) > width {
+			idx := strings.LastIndex(line[:width+1], " ")
+			if idx <= 0 {
+				idx = width
+			}
+			lines = append(lines, strings.TrimRight(line[:idx], " "))
+			line = strings.TrimLeft(line[idx:], " ")
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (e *errorLine) getCol() int {
 	split := strings.Split(e.Location, ":")
 	if split[0] != "" {
@@ -4,6 +4,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 )
 
@@ -41,3 +42,33 @@ func TestRawError(t *testing.T) {
 	assert.True(t, errors.As(err, &gonbError))
 
 }
+
+func TestErrorFormat(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() {
+		err := s.Stop()
+		require.NoError(t, err, "Failed to finalized state")
+	}()
+	assert.Equal(t, ErrorFormatHTML, s.ErrorFormat())
+	require.Error(t, s.SetErrorFormat("pdf"))
+
+	fileToCellLine := createTestGoMain(t, s, sampleCellCode)
+	fileToCellIdAndLine := MakeFileToCellIdAndLine(-1, fileToCellLine)
+	errorMsg := "./main.go:3:1: " + strings.Repeat("very long error message ", 10)
+	for _, format := range []string{"text", "ansi"} {
+		require.NoError(t, s.SetErrorFormat(format))
+		err := s.DisplayErrorWithContext(nil, fileToCellIdAndLine, errorMsg, errors.New("failed"))
+		var gonbError *GonbError
+		require.True(t, errors.As(err, &gonbError))
+		traceback := strings.Join(gonbError.Traceback(), "\n")
+		if format == "ansi" {
+			assert.Contains(t, traceback, "\x1b[31m")
+			for _, line := range strings.Split(traceback, "\n") {
+				assert.LessOrEqual(t, len(line), ErrorLineWrapWidth+len("\x1b[31m"))
+			}
+		} else {
+			assert.NotContains(t, traceback, "\x1b[")
+			assert.Contains(t, traceback, strings.TrimSpace(strings.Repeat("very long error message ", 10)))
+		}
+	}
+}
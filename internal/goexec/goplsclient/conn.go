@@ -38,20 +38,21 @@ func (c *Client) connCloseLocked() {
 	}
 }
 
-// minTimeout extends (or returns a new context with extended Deadline), discarding the
-// previous one -- not the correct use of context, but will do for now.
-func minTimeout(ctx context.Context, timeout time.Duration) context.Context {
+// minTimeout returns a context whose deadline is at most timeout from now, and the function to
+// release it, to be called when the request is finished.
+func minTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
 	minDeadline := time.Now().Add(timeout)
 	if deadline, ok := ctx.Deadline(); !ok || deadline.After(minDeadline) {
-		ctx, _ = context.WithDeadline(ctx, minDeadline)
+		return context.WithDeadline(ctx, minDeadline)
 	}
-	return ctx
+	return ctx, func() {}
 }
 
 // Connect to the `gopls` in address given by `c.Address()`. It also starts
 // a goroutine to monitor receiving requests.
 func (c *Client) Connect(ctx context.Context) error {
-	ctx = minTimeout(ctx, ConnectTimeout)
+	ctx, cancel := minTimeout(ctx, ConnectTimeout)
+	defer cancel()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -91,7 +92,11 @@ func (c *Client) Connect(ctx context.Context) error {
 
 	callId, err := c.jsonConn.Call(ctx, lsp.MethodInitialize, &lsp.InitializeParams{
 		ProcessID: 0,
-		// Capabilities:          lsp.ClientCapabilities{},
+		// Settings are pulled by gopls with "workspace/configuration" requests, see Client.SetSetting.
+		InitializationOptions: c.Settings(),
+		Capabilities: lsp.ClientCapabilities{
+			Workspace: &lsp.WorkspaceClientCapabilities{Configuration: true},
+		},
 		WorkspaceFolders: []lsp.WorkspaceFolder{
 			lsp.WorkspaceFolder{
 				URI:  string(uri.File(c.dir)),
@@ -116,6 +121,7 @@ func (c *Client) Connect(ctx context.Context) error {
 		c.conn = nil
 		return errors.Wrapf(err, "failed \"initialized\" notification to gopls in %q", addr)
 	}
+	c.resyncLocked(ctx)
 	return nil
 }
 
@@ -129,12 +135,14 @@ func (c *Client) NotifyDidOpenOrChange(ctx context.Context, filePath string) (er
 		// Silently do nothing, if no connection available.
 		return
 	}
-	ctx = minTimeout(ctx, CommunicationTimeout)
+	ctx, cancel := minTimeout(ctx, CommunicationTimeout)
+	defer cancel()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.conn == nil {
 		return
 	}
+	defer func(start time.Time) { c.recordCallLocked(lsp.MethodTextDocumentDidChange, start, err) }(time.Now())
 	return c.notifyDidOpenOrChangeLocked(ctx, filePath)
 }
 
@@ -227,12 +235,14 @@ func (c *Client) CallDefinition(ctx context.Context, filePath string, line, col
 		// Silently do nothing, if no connection available.
 		return
 	}
-	ctx = minTimeout(ctx, CommunicationTimeout)
+	ctx, cancel := minTimeout(ctx, CommunicationTimeout)
+	defer cancel()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.conn == nil {
 		return
 	}
+	defer func(start time.Time) { c.recordCallLocked(lsp.MethodTextDocumentDefinition, start, err) }(time.Now())
 	return c.callDefinitionLocked(ctx, filePath, line, col)
 }
 
@@ -277,12 +287,14 @@ func (c *Client) CallHover(ctx context.Context, filePath string, line, col int)
 		// Silently do nothing, if no connection available.
 		return
 	}
-	ctx = minTimeout(ctx, CommunicationTimeout)
+	ctx, cancel := minTimeout(ctx, CommunicationTimeout)
+	defer cancel()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.conn == nil {
 		return
 	}
+	defer func(start time.Time) { c.recordCallLocked(lsp.MethodTextDocumentHover, start, err) }(time.Now())
 	return c.callHoverLocked(ctx, filePath, line, col)
 }
 
@@ -319,12 +331,14 @@ func (c *Client) CallComplete(ctx context.Context, filePath string, line, col in
 		// Silently do nothing, if no connection available.
 		return
 	}
-	ctx = minTimeout(ctx, CommunicationTimeout)
+	ctx, cancel := minTimeout(ctx, CommunicationTimeout)
+	defer cancel()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.conn == nil {
 		return
 	}
+	defer func(start time.Time) { c.recordCallLocked(lsp.MethodTextDocumentCompletion, start, err) }(time.Now())
 	return c.callCompleteLocked(ctx, filePath, line, col)
 }
 
@@ -359,6 +373,101 @@ func (c *Client) callCompleteLocked(ctx context.Context, filePath string, line,
 	return
 }
 
+// CallRename service in `gopls`: it returns the edits needed to rename the symbol under the given position
+// to newName, in all files where it is used.
+//
+// This will automatically call NotifyDidOpenOrChange, if file hasn't been sent yet.
+func (c *Client) CallRename(ctx context.Context, filePath string, line, col int, newName string) (edit *lsp.WorkspaceEdit, err error) {
+	if !c.WaitConnection(ctx) {
+		return nil, errors.New("no connection to gopls")
+	}
+	ctx, cancel := minTimeout(ctx, CommunicationTimeout)
+	defer cancel()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil, errors.New("no connection to gopls")
+	}
+	defer func(start time.Time) { c.recordCallLocked(lsp.MethodTextDocumentRename, start, err) }(time.Now())
+	return c.callRenameLocked(ctx, filePath, line, col, newName)
+}
+
+func (c *Client) callRenameLocked(ctx context.Context, filePath string, line, col int, newName string) (edit *lsp.WorkspaceEdit, err error) {
+	klog.V(2).Infof("goplsclient.CallRename(ctx, %s, %d, %d, %q)", uri.File(filePath), line, col, newName)
+	if _, found := c.fileVersions[filePath]; !found {
+		err = c.notifyDidOpenOrChangeLocked(ctx, filePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	params := &lsp.RenameParams{
+		TextDocumentPositionParams: lsp.TextDocumentPositionParams{
+			TextDocument: lsp.TextDocumentIdentifier{
+				URI: uri.File(filePath),
+			},
+			Position: lsp.Position{
+				Line:      uint32(line),
+				Character: uint32(col),
+			},
+		},
+		NewName: newName,
+	}
+	edit = &lsp.WorkspaceEdit{}
+	_, err = c.jsonConn.Call(ctx, lsp.MethodTextDocumentRename, params, edit)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed call to `gopls` \"rename\"")
+	}
+	return
+}
+
+// CallReferences service in `gopls`: it returns the locations where the symbol under the given position is used,
+// in all files of the workspace. The declaration itself is not included.
+//
+// This will automatically call NotifyDidOpenOrChange, if file hasn't been sent yet.
+func (c *Client) CallReferences(ctx context.Context, filePath string, line, col int) (locations []lsp.Location, err error) {
+	if !c.WaitConnection(ctx) {
+		return nil, errors.New("no connection to gopls")
+	}
+	ctx, cancel := minTimeout(ctx, CommunicationTimeout)
+	defer cancel()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil, errors.New("no connection to gopls")
+	}
+	defer func(start time.Time) { c.recordCallLocked(lsp.MethodTextDocumentReferences, start, err) }(time.Now())
+	return c.callReferencesLocked(ctx, filePath, line, col)
+}
+
+func (c *Client) callReferencesLocked(ctx context.Context, filePath string, line, col int) (locations []lsp.Location, err error) {
+	klog.V(2).Infof("goplsclient.CallReferences(ctx, %s, %d, %d)", uri.File(filePath), line, col)
+	if _, found := c.fileVersions[filePath]; !found {
+		err = c.notifyDidOpenOrChangeLocked(ctx, filePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	params := &lsp.ReferenceParams{
+		TextDocumentPositionParams: lsp.TextDocumentPositionParams{
+			TextDocument: lsp.TextDocumentIdentifier{
+				URI: uri.File(filePath),
+			},
+			Position: lsp.Position{
+				Line:      uint32(line),
+				Character: uint32(col),
+			},
+		},
+		Context: lsp.ReferenceContext{IncludeDeclaration: false},
+	}
+	_, err = c.jsonConn.Call(ctx, lsp.MethodTextDocumentReferences, params, &locations)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed call to `gopls` \"references\"")
+	}
+	return
+}
+
 func (c *Client) ConsumeMessages() []string {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -376,7 +485,6 @@ func trimString(s string, maxLen int) string {
 
 // Handler implements jsonrpc2.Handler, and receives messages initiated by gopls.
 func (c *Client) Handler(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
-	_ = ctx
 	method := req.Method()
 	switch method {
 	case lsp.MethodWindowShowMessage:
@@ -416,6 +524,14 @@ func (c *Client) Handler(ctx context.Context, reply jsonrpc2.Replier, req jsonrp
 			klog.V(2).Infof("received gopls diagnostics: %+v",
 				trimString(fmt.Sprintf("%+v", params), 100))
 		}
+	case lsp.MethodWorkspaceConfiguration:
+		var params lsp.ConfigurationParams
+		if err := json.Unmarshal(req.Params(), &params); err != nil {
+			klog.Errorf("Failed to parse ConfigurationParams: %v", err)
+			return reply(ctx, nil, err)
+		}
+		return reply(ctx, c.configurationReply(params), nil)
+
 	default:
 		klog.Errorf("gopls jsonrpc2 message delivered to GoNB but not handled: %q", method)
 	}
@@ -2,6 +2,7 @@ package goplsclient
 
 import (
 	"context"
+	"fmt"
 	"k8s.io/klog/v2"
 	"os"
 	"os/exec"
@@ -23,19 +24,64 @@ var StartTimeout = 5 * time.Second
 //
 // While it is not started the various services return empty results.
 func (c *Client) Start() error {
+	klog.Infof("gopls.Client.Start()")
+	goplsPath, err := c.lookPath()
 	c.mu.Lock()
 	defer c.mu.Unlock()
-
-	klog.Infof("gopls.Client.Start()")
 	if !c.IsStopped() {
 		klog.Errorf("attempting to start gopls, but it is still running")
 		return nil
 	}
+	return c.startLocked(goplsPath, err)
+}
+
+// SetOnDemand configures the client to start `gopls` only when it is needed, see StartOnDemand.
+func (c *Client) SetOnDemand(onDemand bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onDemand = onDemand
+}
+
+// StartOnDemand starts `gopls` if the client is configured to start it on demand (see SetOnDemand), and it is
+// not running nor waiting to be restarted by the supervisor. It is safe to call concurrently: `gopls` is
+// started only once.
+func (c *Client) StartOnDemand() error {
+	c.mu.Lock()
+	needed := c.onDemand && c.IsStopped() && c.restartTimer == nil
+	c.mu.Unlock()
+	if !needed {
+		return nil
+	}
+	goplsPath, err := c.lookPath()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.IsStopped() || c.restartTimer != nil {
+		// Started concurrently.
+		return nil
+	}
+	klog.Infof("Starting `gopls` on demand.")
+	return c.startLocked(goplsPath, err)
+}
+
+// lookPath returns the path to the `gopls` binary, and checks its version.
+// It must be called without holding Client.mu: running `gopls version` may take a while.
+func (c *Client) lookPath() (string, error) {
+	goplsPath, err := exec.LookPath("gopls")
+	if err != nil {
+		return "", err
+	}
+	c.checkVersion(goplsPath)
+	return goplsPath, nil
+}
 
+// startLocked implements Start, given the result of lookPath.
+// It must be called with Client.mu locked, and `gopls` stopped.
+func (c *Client) startLocked(goplsPath string, err error) error {
 	c.stop = make(chan struct{})
+	c.stopRequested = false
 	c.removeUnixSocketFile()
-	goplsPath, err := exec.LookPath("gopls")
 	if err != nil {
+		close(c.stop)
 		return errors.Wrapf(err, "cannot file `gopls` binary in path")
 	}
 
@@ -60,19 +106,29 @@ func (c *Client) Start() error {
 	}
 
 	c.waitConnecting = true
+	c.startedAt = time.Now()
+	c.consecutiveTimeouts = 0
+	goplsExec, stop := c.goplsExec, c.stop
 
 	// In parallel tries to connect.
 	go func() {
-		klog.V(2).Infof("Polling connection with %s", c.goplsExec)
+		klog.V(2).Infof("Polling connection with %s", goplsExec)
 		onDeadline := time.After(StartTimeout)
 		ctx := context.Background()
 		for {
 			// Wait a bit (for gopls to startup), and try to connect.
 			select {
 			case <-onDeadline:
-				// Still failing to connect, kill job.
+				// Still failing to connect, kill job: it will be restarted by the supervisor.
 				klog.V(2).Infof("started `gopls`, but after %s it failed to connect, stopping it.", StartTimeout)
-				c.Stop()
+				c.mu.Lock()
+				if c.goplsExec == goplsExec {
+					c.killReason = fmt.Sprintf("failed to connect after %s", StartTimeout)
+					c.killLocked()
+				}
+				c.mu.Unlock()
+				return
+			case <-stop:
 				return
 			case <-time.After(ConnectTimeout):
 				// Wait before trying to connect (again)
@@ -81,7 +137,9 @@ func (c *Client) Start() error {
 			err := c.Connect(ctx)
 			if err == nil {
 				// Connected!
+				c.mu.Lock()
 				c.waitConnecting = false
+				c.mu.Unlock()
 				return
 			}
 		}
@@ -89,7 +147,7 @@ func (c *Client) Start() error {
 
 	// In parallel wait for command to finish.
 	go func() {
-		err := c.goplsExec.Wait()
+		err := goplsExec.Wait()
 		if err != nil {
 			klog.Warningf("gopls failed with: %+v", err)
 		} else {
@@ -97,9 +155,10 @@ func (c *Client) Start() error {
 		}
 		c.mu.Lock()
 		defer c.mu.Unlock()
-		close(c.stop)
+		close(stop)
 		c.removeUnixSocketFile()
-		c.stopLocked()
+		c.waitConnecting = false
+		c.onExitLocked(err)
 	}()
 
 	return nil
@@ -144,15 +203,22 @@ func (c *Client) IsStopped() bool {
 	}
 }
 
+// stopLocked stops `gopls` on purpose: it is not restarted by the supervisor.
 func (c *Client) stopLocked() {
+	c.stopRequested = true
+	c.cancelRestartLocked()
+	c.killLocked()
+}
+
+// killLocked kills the `gopls` process, if it is running.
+func (c *Client) killLocked() {
 	if !c.IsStopped() {
 		klog.Infof("killing gopls")
-		c.goplsExec.Process.Kill()
+		_ = c.goplsExec.Process.Kill()
 		c.removeUnixSocketFile()
 		// Client will be marked as stopped once the gopls process exits.
 	}
 	c.waitConnecting = false
-	return
 }
 
 // removeUnixSocketFile if it exists.
@@ -51,6 +51,25 @@ type Client struct {
 	stop           chan struct{}
 	waitConnecting bool
 
+	// Supervision of gopls, see supervisor.go.
+	stopRequested       bool // gopls stopped on purpose, it shouldn't be restarted.
+	onDemand            bool // gopls is only started when needed, see StartOnDemand.
+	startedAt           time.Time
+	restarts            int
+	restartBackoff      time.Duration
+	restartTimer        *time.Timer
+	nextRestart         time.Time
+	consecutiveTimeouts int
+	killReason          string // Reason gopls was killed by the supervisor, to be restarted.
+	lastFailure         string
+	version             string
+	rpcStats            map[string]*RPCStats // Per method, see stats.go.
+
+	// Settings of gopls, see settings.go. It has its own mutex, since they are read by the handler of
+	// requests from gopls, which may be called during a call holding Client.mu.
+	settingsMu sync.Mutex
+	settings   map[string]any
+
 	// File cache.
 	fileVersions map[string]int       // Every open file that has been sent to gopls has a version, that is bumped when it is sent again.
 	fileCache    map[string]*FileData // Cache of files stored in disk.
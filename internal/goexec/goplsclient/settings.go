@@ -0,0 +1,119 @@
+package goplsclient
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"strings"
+
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the configuration of `gopls` (see https://go.dev/gopls/settings): the settings are
+// given to `gopls` when it is initialized, and pulled by it (with "workspace/configuration" requests) when
+// notified of changes.
+
+// ParseSetting parses a `key=value` gopls setting. The value is parsed as JSON if possible
+// (e.g. `true`, `100`, `["-vendor"]`), otherwise it is taken as a string.
+// Keys with dots (e.g. `analyses.unusedparams=false`) set an entry of a map setting.
+func ParseSetting(assignment string) (key string, value any, err error) {
+	key, rawValue, found := strings.Cut(assignment, "=")
+	key = strings.TrimSpace(key)
+	if !found || key == "" {
+		return "", nil, errors.Errorf("invalid gopls setting %q, it must be in the format key=value", assignment)
+	}
+	rawValue = strings.TrimSpace(rawValue)
+	if err := json.Unmarshal([]byte(rawValue), &value); err != nil {
+		value = rawValue
+	}
+	return key, value, nil
+}
+
+// Settings returns a copy of the settings of `gopls` configured with SetSetting.
+func (c *Client) Settings() map[string]any {
+	c.settingsMu.Lock()
+	defer c.settingsMu.Unlock()
+	return cloneSettings(c.settings)
+}
+
+// SetSetting configures the `gopls` setting key to value, and notifies `gopls` of the change, if it is connected.
+// A nil value removes the setting. See ParseSetting for keys with dots.
+func (c *Client) SetSetting(ctx context.Context, key string, value any) error {
+	c.settingsMu.Lock()
+	if c.settings == nil {
+		c.settings = make(map[string]any)
+	}
+	settings := c.settings
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		subSettings, ok := settings[part].(map[string]any)
+		if !ok {
+			subSettings = make(map[string]any)
+			settings[part] = subSettings
+		}
+		settings = subSettings
+	}
+	if value == nil {
+		delete(settings, parts[len(parts)-1])
+	} else {
+		settings[parts[len(parts)-1]] = value
+	}
+	c.settingsMu.Unlock()
+	return c.notifyConfigurationChange(ctx)
+}
+
+// ResetSettings removes all settings configured with SetSetting, and notifies `gopls`, if it is connected.
+func (c *Client) ResetSettings(ctx context.Context) error {
+	c.settingsMu.Lock()
+	c.settings = nil
+	c.settingsMu.Unlock()
+	return c.notifyConfigurationChange(ctx)
+}
+
+// notifyConfigurationChange sends a "workspace/didChangeConfiguration" notification to `gopls`, after which
+// it pulls the new settings.
+func (c *Client) notifyConfigurationChange(ctx context.Context) error {
+	ctx, cancel := minTimeout(ctx, CommunicationTimeout)
+	defer cancel()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		// Settings are sent when gopls connects.
+		return nil
+	}
+	err := c.jsonConn.Notify(ctx, lsp.MethodWorkspaceDidChangeConfiguration,
+		&lsp.DidChangeConfigurationParams{Settings: map[string]any{"gopls": c.Settings()}})
+	if err != nil {
+		return errors.Wrap(err, "failed to notify gopls of the change of settings")
+	}
+	return nil
+}
+
+// configurationReply returns the reply to a "workspace/configuration" request from `gopls`: the settings
+// for the "gopls" section, and nil for others.
+func (c *Client) configurationReply(params lsp.ConfigurationParams) []any {
+	results := make([]any, len(params.Items))
+	for ii, item := range params.Items {
+		if item.Section == "gopls" {
+			results[ii] = c.Settings()
+		}
+	}
+	klog.V(2).Infof("gopls requested configuration %+v: %+v", params.Items, results)
+	return results
+}
+
+// cloneSettings returns a deep copy of the settings: maps within settings are also copied.
+func cloneSettings(settings map[string]any) map[string]any {
+	cloned := maps.Clone(settings)
+	if cloned == nil {
+		return make(map[string]any)
+	}
+	for key, value := range cloned {
+		if subSettings, ok := value.(map[string]any); ok {
+			cloned[key] = cloneSettings(subSettings)
+		}
+	}
+	return cloned
+}
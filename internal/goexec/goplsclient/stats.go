@@ -0,0 +1,86 @@
+package goplsclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// This file implements the statistics of the requests to `gopls`, and of its memory use.
+
+// RPCStats holds the statistics of the requests of one method to `gopls`.
+type RPCStats struct {
+	Calls, Errors, Timeouts int
+	TotalLatency            time.Duration
+}
+
+// AverageLatency of the requests.
+func (s RPCStats) AverageLatency() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Calls)
+}
+
+// recordStatsLocked records a request of the given method.
+func (c *Client) recordStatsLocked(method string, latency time.Duration, err error) {
+	if c.rpcStats == nil {
+		c.rpcStats = make(map[string]*RPCStats)
+	}
+	stats, found := c.rpcStats[method]
+	if !found {
+		stats = &RPCStats{}
+		c.rpcStats[method] = stats
+	}
+	stats.Calls++
+	stats.TotalLatency += latency
+	if err != nil {
+		stats.Errors++
+		if errors.Is(err, context.DeadlineExceeded) {
+			stats.Timeouts++
+		}
+	}
+}
+
+// MemoryRSS returns the resident memory of the process, in bytes. Only Linux and macOS are supported.
+func MemoryRSS(pid int) (uint64, error) {
+	switch runtime.GOOS {
+	case "linux":
+		contents, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/status")
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to read memory of process %d", pid)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(contents))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "VmRSS:" {
+				kb, err := strconv.ParseUint(fields[1], 10, 64)
+				if err != nil {
+					return 0, errors.Wrapf(err, "invalid VmRSS %q of process %d", scanner.Text(), pid)
+				}
+				return kb * 1024, nil
+			}
+		}
+		return 0, errors.Errorf("VmRSS not found for process %d", pid)
+	case "darwin":
+		output, err := exec.Command("ps", "-o", "rss=", "-p", strconv.Itoa(pid)).Output()
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to read memory of process %d", pid)
+		}
+		kb, err := strconv.ParseUint(strings.TrimSpace(string(output)), 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid memory %q reported for process %d", output, pid)
+		}
+		return kb * 1024, nil
+	default:
+		return 0, errors.Errorf("memory of processes not available in OS %q", runtime.GOOS)
+	}
+}
@@ -0,0 +1,239 @@
+package goplsclient
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/janpfeifer/gonb/common"
+	"github.com/pkg/errors"
+	"golang.org/x/mod/semver"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the supervision of `gopls`: if it crashes or hangs (consecutive requests timing out),
+// it is restarted with exponential backoff, and the files opened in the previous instance are re-sent.
+
+var (
+	// RestartInitialBackoff is the time waited before restarting `gopls` after it crashes.
+	// It doubles on each consecutive crash, up to RestartMaxBackoff.
+	RestartInitialBackoff = time.Second
+
+	// RestartMaxBackoff is the maximum time waited before restarting `gopls`.
+	RestartMaxBackoff = time.Minute
+
+	// StableRunTime is the time after which a running `gopls` is considered stable: if it crashes
+	// after that, the backoff is reset to RestartInitialBackoff.
+	StableRunTime = time.Minute
+
+	// MaxConsecutiveTimeouts is the number of consecutive requests to `gopls` that time out
+	// before it is considered hung, and it is restarted.
+	MaxConsecutiveTimeouts = 3
+)
+
+// MinVersion is the oldest `gopls` version known to work with GoNB. Older versions log a warning.
+const MinVersion = "v0.15.0"
+
+// Status of the `gopls` server, as reported by Client.Status.
+type Status struct {
+	Running, Connected bool
+
+	// OnDemand is set if `gopls` is only started when needed, see Client.StartOnDemand.
+	OnDemand bool
+
+	// Version of `gopls`, empty if not known.
+	Version string
+
+	// Restarts is the number of times `gopls` was restarted by the supervisor.
+	Restarts int
+
+	// LastFailure describes the last crash or hang of `gopls`, empty if none.
+	LastFailure string
+
+	// NextRestart is when `gopls` will be restarted, if a restart is scheduled.
+	NextRestart time.Time
+
+	// PID of the `gopls` process, if running.
+	PID int
+
+	// RPC statistics per method, see RPCStats.
+	RPC map[string]RPCStats
+}
+
+// String implements fmt.Stringer.
+func (s Status) String() string {
+	var parts []string
+	switch {
+	case s.Connected:
+		parts = append(parts, "connected")
+	case s.Running:
+		parts = append(parts, "running, not connected")
+	case !s.NextRestart.IsZero():
+		parts = append(parts, fmt.Sprintf("restarting in %s", time.Until(s.NextRestart).Round(time.Second)))
+	case s.OnDemand:
+		parts = append(parts, "stopped, started on demand")
+	default:
+		parts = append(parts, "stopped")
+	}
+	if s.Version != "" {
+		parts = append(parts, s.Version)
+	}
+	if s.Restarts > 0 {
+		parts = append(parts, fmt.Sprintf("%d restarts", s.Restarts))
+	}
+	if s.LastFailure != "" {
+		parts = append(parts, "last failure: "+s.LastFailure)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Status returns the current status of `gopls`.
+func (c *Client) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := Status{
+		Running:     !c.IsStopped(),
+		Connected:   c.conn != nil,
+		OnDemand:    c.onDemand,
+		Version:     c.version,
+		Restarts:    c.restarts,
+		LastFailure: c.lastFailure,
+		NextRestart: c.nextRestart,
+		RPC:         make(map[string]RPCStats, len(c.rpcStats)),
+	}
+	if status.Running && c.goplsExec.Process != nil {
+		status.PID = c.goplsExec.Process.Pid
+	}
+	for method, stats := range c.rpcStats {
+		status.RPC[method] = *stats
+	}
+	return status
+}
+
+// onExitLocked is called when the `gopls` process exits. Unless it was stopped on purpose,
+// a restart is scheduled.
+func (c *Client) onExitLocked(err error) {
+	if c.stopRequested {
+		return
+	}
+	switch {
+	case c.killReason != "":
+		c.lastFailure = c.killReason
+		c.killReason = ""
+	case err != nil:
+		c.lastFailure = fmt.Sprintf("crashed with %v", err)
+	default:
+		c.lastFailure = "exited unexpectedly"
+	}
+	c.scheduleRestartLocked()
+}
+
+// scheduleRestartLocked schedules the restart of `gopls` with exponential backoff.
+func (c *Client) scheduleRestartLocked() {
+	c.cancelRestartLocked()
+	if c.restartBackoff == 0 || time.Since(c.startedAt) > StableRunTime {
+		c.restartBackoff = RestartInitialBackoff
+	} else {
+		c.restartBackoff = min(2*c.restartBackoff, RestartMaxBackoff)
+	}
+	klog.Warningf("gopls %s: restarting it in %s", c.lastFailure, c.restartBackoff)
+	c.nextRestart = time.Now().Add(c.restartBackoff)
+	c.restartTimer = time.AfterFunc(c.restartBackoff, c.restart)
+}
+
+// cancelRestartLocked cancels a scheduled restart, if any.
+func (c *Client) cancelRestartLocked() {
+	if c.restartTimer != nil {
+		c.restartTimer.Stop()
+		c.restartTimer = nil
+	}
+	c.nextRestart = time.Time{}
+}
+
+// restart `gopls`, called by the timer set by scheduleRestartLocked.
+func (c *Client) restart() {
+	c.mu.Lock()
+	c.restartTimer = nil
+	c.nextRestart = time.Time{}
+	if c.stopRequested || !c.IsStopped() {
+		c.mu.Unlock()
+		return
+	}
+	c.restarts++
+	restarts := c.restarts
+	c.mu.Unlock()
+
+	klog.Infof("Restarting gopls (restart #%d)", restarts)
+	if err := c.Start(); err != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.lastFailure = fmt.Sprintf("failed to restart: %v", err)
+		c.scheduleRestartLocked()
+	}
+}
+
+// recordCallLocked records the statistics of a request to `gopls` (see RPCStats), and keeps track of requests
+// timing out: after MaxConsecutiveTimeouts it is considered hung, and it is killed, to be restarted.
+func (c *Client) recordCallLocked(method string, start time.Time, err error) {
+	c.recordStatsLocked(method, time.Since(start), err)
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+		c.consecutiveTimeouts = 0
+		return
+	}
+	c.consecutiveTimeouts++
+	if c.consecutiveTimeouts < MaxConsecutiveTimeouts {
+		return
+	}
+	c.killReason = fmt.Sprintf("hung: %d consecutive requests timed out", c.consecutiveTimeouts)
+	klog.Warningf("gopls %s, killing it", c.killReason)
+	c.connCloseLocked()
+	c.killLocked()
+}
+
+// resyncLocked re-sends the files opened in a previous `gopls` instance to the newly connected one.
+func (c *Client) resyncLocked(ctx context.Context) {
+	if len(c.fileVersions) == 0 {
+		return
+	}
+	files := common.SortedKeys(c.fileVersions)
+	c.fileVersions = make(map[string]int)
+	c.fileCache = make(map[string]*FileData)
+	klog.V(1).Infof("Re-sending %d files to gopls", len(files))
+	for _, filePath := range files {
+		if err := c.notifyDidOpenOrChangeLocked(ctx, filePath); err != nil {
+			klog.Warningf("Failed to re-send %q to gopls: %+v", filePath, err)
+		}
+	}
+}
+
+// checkVersion finds out the version of `gopls` (only once), and logs a warning if it is older than
+// MinVersion. It must be called without holding Client.mu, since it runs `gopls version`.
+func (c *Client) checkVersion(goplsPath string) {
+	c.mu.Lock()
+	known := c.version != ""
+	c.mu.Unlock()
+	if known {
+		return
+	}
+	output, err := exec.Command(goplsPath, "version").Output()
+	if err != nil {
+		klog.Warningf("Failed to get the version of gopls with `%s version`: %v", goplsPath, err)
+		return
+	}
+	// Output looks like "golang.org/x/tools/gopls v0.16.1\n..."
+	firstLine, _, _ := strings.Cut(string(output), "\n")
+	fields := strings.Fields(firstLine)
+	if len(fields) < 2 {
+		return
+	}
+	version := fields[1]
+	c.mu.Lock()
+	c.version = version
+	c.mu.Unlock()
+	if semver.IsValid(version) && semver.Compare(version, MinVersion) < 0 {
+		klog.Warningf("gopls version %s is older than %s, auto-complete and contextual help may not work: "+
+			"upgrade it with `go install golang.org/x/tools/gopls@latest`", version, MinVersion)
+	}
+}
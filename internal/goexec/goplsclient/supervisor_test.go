@@ -0,0 +1,274 @@
+package goplsclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lsp.dev/jsonrpc2"
+	lsp "go.lsp.dev/protocol"
+)
+
+// The tests use the test binary itself as a fake `gopls`: a `gopls` script in the PATH executes it with
+// fakeGoplsModeEnv set to one of the modes below.
+const (
+	fakeGoplsModeEnv = "GOPLSCLIENT_FAKE_GOPLS"
+	fakeGoplsLogEnv  = "GOPLSCLIENT_FAKE_GOPLS_LOG"
+
+	fakeVersion = "v0.16.1"
+)
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(fakeGoplsModeEnv); mode != "" {
+		os.Exit(runFakeGopls(mode, os.Args[1:]))
+	}
+
+	// Set once for all tests: goroutines of the clients of previous tests may still be reading them.
+	RestartInitialBackoff = 10 * time.Millisecond
+	RestartMaxBackoff = 40 * time.Millisecond
+	ConnectTimeout = 200 * time.Millisecond
+	os.Exit(m.Run())
+}
+
+// runFakeGopls implements the fake `gopls`, in one of the modes:
+//
+//   - "crash": exits with an error right away.
+//   - "hang": never accepts connections. It logs "started" to $GOPLSCLIENT_FAKE_GOPLS_LOG.
+//   - "slow_version": like "serve", but `gopls version` takes a second.
+//   - "serve": serves the LSP requests used by the client, logging the files opened to $GOPLSCLIENT_FAKE_GOPLS_LOG.
+func runFakeGopls(mode string, args []string) int {
+	if len(args) > 0 && args[0] == "version" {
+		if mode == "slow_version" {
+			time.Sleep(time.Second)
+		}
+		fmt.Printf("golang.org/x/tools/gopls %s\n    golang.org/x/tools/gopls@%s\n", fakeVersion, fakeVersion)
+		return 0
+	}
+	switch mode {
+	case "crash":
+		return 1
+	case "hang":
+		if f, err := os.OpenFile(os.Getenv(fakeGoplsLogEnv), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+			_, _ = f.WriteString("started\n")
+			_ = f.Close()
+		}
+		time.Sleep(time.Hour)
+		return 0
+	}
+	if len(args) != 2 || args[0] != "-listen" {
+		fmt.Fprintf(os.Stderr, "fake gopls: unexpected arguments %q\n", args)
+		return 1
+	}
+	listener, err := net.Listen("unix", strings.TrimPrefix(args[1], "unix;"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fake gopls: %v\n", err)
+		return 1
+	}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return 1
+		}
+		go serveFakeGopls(conn)
+	}
+}
+
+// serveFakeGopls serves one connection of the fake `gopls`.
+func serveFakeGopls(conn net.Conn) {
+	jsonConn := jsonrpc2.NewConn(jsonrpc2.NewStream(conn))
+	jsonConn.Go(context.Background(), func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		switch req.Method() {
+		case lsp.MethodInitialize:
+			return reply(ctx, &lsp.InitializeResult{}, nil)
+		case lsp.MethodTextDocumentDidOpen:
+			var params lsp.DidOpenTextDocumentParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			f, err := os.OpenFile(os.Getenv(fakeGoplsLogEnv), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				return reply(ctx, nil, err)
+			}
+			_, _ = fmt.Fprintf(f, "didOpen %s\n", path.Base(params.TextDocument.URI.Filename()))
+			_ = f.Close()
+		}
+		return reply(ctx, nil, nil)
+	})
+	<-jsonConn.Done()
+}
+
+// setUpFakeGopls puts a fake `gopls` in the PATH, in the given mode, and returns the path of its log.
+func setUpFakeGopls(t *testing.T, mode string) (logPath string) {
+	binDir := t.TempDir()
+	script := fmt.Sprintf("#!/bin/sh\nexec %q \"$@\"\n", os.Args[0])
+	require.NoError(t, os.WriteFile(path.Join(binDir, "gopls"), []byte(script), 0755))
+	logPath = path.Join(t.TempDir(), "gopls.log")
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv(fakeGoplsModeEnv, mode)
+	t.Setenv(fakeGoplsLogEnv, logPath)
+	return
+}
+
+// newTestClient returns a client in a temporary directory, shut down at the end of the test.
+func newTestClient(t *testing.T) *Client {
+	c := New(t.TempDir())
+	t.Cleanup(c.Shutdown)
+	return c
+}
+
+func TestCheckVersion(t *testing.T) {
+	setUpFakeGopls(t, "slow_version")
+	c := newTestClient(t)
+	versionDone := make(chan struct{})
+	go func() {
+		c.checkVersion("gopls")
+		close(versionDone)
+	}()
+
+	// The client is not locked while `gopls version` runs.
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	assert.Equal(t, "", c.Status().Version)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	<-versionDone
+	assert.Equal(t, fakeVersion, c.Status().Version)
+}
+
+func TestRestartBackoff(t *testing.T) {
+	c := newTestClient(t)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopRequested = true // The scheduled restarts do nothing.
+	c.startedAt = time.Now()
+	var backoffs []time.Duration
+	for range 4 {
+		c.scheduleRestartLocked()
+		backoffs = append(backoffs, c.restartBackoff)
+	}
+	assert.Equal(t, []time.Duration{RestartInitialBackoff, 2 * RestartInitialBackoff, 4 * RestartInitialBackoff,
+		RestartMaxBackoff}, backoffs)
+	assert.False(t, c.nextRestart.IsZero())
+
+	// After running stably, the backoff is reset.
+	c.startedAt = time.Now().Add(-2 * StableRunTime)
+	c.scheduleRestartLocked()
+	assert.Equal(t, RestartInitialBackoff, c.restartBackoff)
+	c.cancelRestartLocked()
+	assert.True(t, c.nextRestart.IsZero())
+}
+
+func TestRestartOnCrash(t *testing.T) {
+	setUpFakeGopls(t, "crash")
+	c := newTestClient(t)
+	require.NoError(t, c.Start())
+	assert.Eventually(t, func() bool { return c.Status().Restarts >= 2 }, 10*time.Second, 10*time.Millisecond)
+	assert.Contains(t, c.Status().LastFailure, "crashed")
+
+	// Stopping on purpose cancels the restarts.
+	c.Stop()
+	assert.Eventually(t, func() bool { return !c.Status().Running }, 10*time.Second, 10*time.Millisecond)
+	restarts := c.Status().Restarts
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, restarts, c.Status().Restarts)
+	assert.True(t, c.Status().NextRestart.IsZero())
+}
+
+func TestHangDetection(t *testing.T) {
+	setUpFakeGopls(t, "hang")
+	c := newTestClient(t)
+	require.NoError(t, c.Start())
+	require.True(t, c.Status().Running)
+
+	timeout := errors.WithMessage(context.DeadlineExceeded, "request to gopls")
+	c.mu.Lock()
+	for range MaxConsecutiveTimeouts - 1 {
+		c.recordCallLocked("textDocument/hover", time.Now(), timeout)
+	}
+	// A successful request resets the count of consecutive timeouts.
+	c.recordCallLocked("textDocument/hover", time.Now(), nil)
+	for range MaxConsecutiveTimeouts - 1 {
+		c.recordCallLocked("textDocument/hover", time.Now(), timeout)
+	}
+	assert.Equal(t, "", c.killReason)
+	c.recordCallLocked("textDocument/hover", time.Now(), timeout)
+	assert.Equal(t, fmt.Sprintf("hung: %d consecutive requests timed out", MaxConsecutiveTimeouts), c.killReason)
+	c.mu.Unlock()
+
+	// Killed and restarted.
+	assert.Eventually(t, func() bool { return c.Status().Restarts == 1 }, 10*time.Second, 10*time.Millisecond)
+	status := c.Status()
+	assert.Equal(t, fmt.Sprintf("hung: %d consecutive requests timed out", MaxConsecutiveTimeouts), status.LastFailure)
+	assert.Equal(t, 2*MaxConsecutiveTimeouts-1, status.RPC["textDocument/hover"].Errors)
+}
+
+func TestResync(t *testing.T) {
+	logPath := setUpFakeGopls(t, "serve")
+	c := newTestClient(t)
+	filePath := path.Join(c.dir, "main.go")
+	require.NoError(t, os.WriteFile(filePath, []byte("package main\n"), 0644))
+	readLog := func() string {
+		contents, _ := os.ReadFile(logPath)
+		return string(contents)
+	}
+
+	require.NoError(t, c.Start())
+	ctx := context.Background()
+	require.True(t, c.WaitConnection(ctx))
+	require.NoError(t, c.NotifyDidOpenOrChange(ctx, filePath))
+	assert.Eventually(t, func() bool { return readLog() == "didOpen main.go\n" }, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, fakeVersion, c.Status().Version)
+
+	// Kill gopls: once restarted, the file opened is re-sent.
+	c.mu.Lock()
+	c.killReason = "killed by test"
+	c.killLocked()
+	c.mu.Unlock()
+	assert.Eventually(t, func() bool {
+		status := c.Status()
+		return status.Restarts == 1 && status.Connected
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return readLog() == "didOpen main.go\ndidOpen main.go\n" },
+		10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "killed by test", c.Status().LastFailure)
+	c.mu.Lock()
+	assert.Equal(t, map[string]int{filePath: 1}, c.fileVersions)
+	c.mu.Unlock()
+}
+
+func TestStartOnDemand(t *testing.T) {
+	logPath := setUpFakeGopls(t, "hang")
+	c := newTestClient(t)
+	require.NoError(t, c.StartOnDemand())
+	assert.False(t, c.Status().Running, "not configured to start on demand")
+
+	c.SetOnDemand(true)
+	assert.Equal(t, "stopped, started on demand", c.Status().String())
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, c.StartOnDemand())
+		}()
+	}
+	wg.Wait()
+	assert.True(t, c.Status().Running)
+	assert.Eventually(t, func() bool {
+		contents, _ := os.ReadFile(logPath)
+		return string(contents) == "started\n"
+	}, 10*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	contents, _ := os.ReadFile(logPath)
+	assert.Equal(t, "started\n", string(contents), "gopls must be started only once")
+}
@@ -0,0 +1,188 @@
+package goexec
+
+import (
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// This file implements the configuration of the Go module proxy (`%goproxy`), and the statistics of the use
+// of the Go module cache (GOMODCACHE) by the kernel: which of the required modules were downloaded during the
+// session (misses), and which were already in the cache (hits).
+
+// SetGoProxy sets GOPROXY in the kernel environment, used by all `go` commands executed afterward in the
+// session. The value can be `off`, `direct` or the URL of a proxy (e.g. an Athens server), or a list of them,
+// separated by "," or "|", as documented in `go help goproxy`.
+func SetGoProxy(value string) error {
+	if value == "" {
+		return errors.New("missing GOPROXY value: use a URL, `direct` or `off`")
+	}
+	for _, elem := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '|' }) {
+		if elem == "off" || elem == "direct" {
+			continue
+		}
+		proxyURL, err := url.Parse(elem)
+		if err != nil {
+			return errors.Wrapf(err, "invalid GOPROXY URL %q", elem)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https":
+			if proxyURL.Host == "" {
+				return errors.Errorf("invalid GOPROXY URL %q: missing host", elem)
+			}
+		case "file":
+		default:
+			return errors.Errorf("invalid GOPROXY URL %q: it must be http://, https:// or file://, `direct` or `off`", elem)
+		}
+	}
+	if err := os.Setenv("GOPROXY", value); err != nil {
+		return errors.Wrap(err, "failed to set GOPROXY")
+	}
+	return nil
+}
+
+// regexpGoDownloading matches the modules downloaded by `go` commands, reported in their output.
+var regexpGoDownloading = regexp.MustCompile(`(?m)^go: downloading (\S+) (\S+)\s*$`)
+
+// recordModuleDownloads records the modules downloaded by a `go` command executed by the kernel, given its
+// output, for GoProxyStats.
+func (s *State) recordModuleDownloads(output []byte) {
+	matches := regexpGoDownloading.FindAllSubmatch(output, -1)
+	if len(matches) == 0 {
+		return
+	}
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.moduleDownloads == nil {
+		s.moduleDownloads = make(map[module.Version]bool)
+	}
+	for _, match := range matches {
+		s.moduleDownloads[module.Version{Path: string(match[1]), Version: string(match[2])}] = true
+	}
+}
+
+// CachedModule is a module in the report of GoProxyStats.
+type CachedModule struct {
+	module.Version
+
+	// Size of the module's zip file in the Go module cache, or 0 if it is not there.
+	Size int64
+}
+
+// GoProxyStats reports the use of the Go module cache by the kernel, see State.GoProxyStats.
+type GoProxyStats struct {
+	GoProxy, ModCache string
+
+	// CacheSize is the total size of the downloaded modules (zip files) in the Go module cache.
+	CacheSize int64
+
+	// Misses are the modules downloaded during the session, Hits the modules required by the kernel's
+	// `go.mod` that were already in the cache, and Missing the required modules not yet downloaded.
+	Hits, Misses, Missing []CachedModule
+}
+
+// HitsSize returns the total size of the modules in Hits.
+func (stats *GoProxyStats) HitsSize() int64 { return totalCachedSize(stats.Hits) }
+
+// MissesSize returns the total size of the modules in Misses.
+func (stats *GoProxyStats) MissesSize() int64 { return totalCachedSize(stats.Misses) }
+
+func totalCachedSize(modules []CachedModule) (total int64) {
+	for _, m := range modules {
+		total += m.Size
+	}
+	return
+}
+
+// GoProxyStats returns the current GOPROXY and the statistics of the use of the Go module cache by the
+// kernel: the modules downloaded during the session (misses) and the modules required by the kernel's
+// `go.mod` that were found in the cache (hits), with the sizes of their zip files.
+func (s *State) GoProxyStats() (*GoProxyStats, error) {
+	stats := &GoProxyStats{GoProxy: GoEnv("GOPROXY"), ModCache: moduleCacheDir()}
+	if stats.ModCache == "" {
+		return nil, errors.New("failed to find the Go module cache directory (GOMODCACHE)")
+	}
+	downloadDir := path.Join(stats.ModCache, "cache", "download")
+	err := filepath.WalkDir(downloadDir, func(entryPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(entryPath, ".zip") {
+			if info, err := d.Info(); err == nil {
+				stats.CacheSize += info.Size()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the Go module cache in %q", downloadDir)
+	}
+
+	s.stateMu.Lock()
+	downloads := maps.Clone(s.moduleDownloads)
+	s.stateMu.Unlock()
+	for version := range downloads {
+		stats.Misses = append(stats.Misses, CachedModule{Version: version, Size: cachedModuleSize(downloadDir, version)})
+	}
+
+	goModPath := path.Join(s.TempDir, "go.mod")
+	contents, err := os.ReadFile(goModPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %q", goModPath)
+	}
+	modFile, err := modfile.ParseLax(goModPath, contents, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %q", goModPath)
+	}
+	for _, require := range modFile.Require {
+		if downloads[require.Mod] {
+			continue
+		}
+		cached := CachedModule{Version: require.Mod, Size: cachedModuleSize(downloadDir, require.Mod)}
+		if cached.Size > 0 {
+			stats.Hits = append(stats.Hits, cached)
+		} else {
+			stats.Missing = append(stats.Missing, cached)
+		}
+	}
+	for _, modules := range [][]CachedModule{stats.Hits, stats.Misses, stats.Missing} {
+		sort.Slice(modules, func(i, j int) bool {
+			if modules[i].Path != modules[j].Path {
+				return modules[i].Path < modules[j].Path
+			}
+			return modules[i].Version.Version < modules[j].Version.Version
+		})
+	}
+	return stats, nil
+}
+
+// cachedModuleSize returns the size of the zip file of the module in the download directory of the Go
+// module cache, or 0 if it is not there.
+func cachedModuleSize(downloadDir string, version module.Version) int64 {
+	escapedPath, err := module.EscapePath(version.Path)
+	if err != nil {
+		return 0
+	}
+	escapedVersion, err := module.EscapeVersion(version.Version)
+	if err != nil {
+		return 0
+	}
+	info, err := os.Stat(path.Join(downloadDir, escapedPath, "@v", escapedVersion+".zip"))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
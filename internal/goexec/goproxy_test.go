@@ -0,0 +1,66 @@
+package goexec
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestSetGoProxy(t *testing.T) {
+	t.Setenv("GOPROXY", "")
+	for _, value := range []string{"off", "direct", "https://athens.mycorp.com", "http://localhost:3000,direct",
+		"file:///tmp/proxy|https://proxy.golang.org"} {
+		require.NoErrorf(t, SetGoProxy(value), "SetGoProxy(%q)", value)
+		assert.Equal(t, value, os.Getenv("GOPROXY"))
+	}
+	for _, value := range []string{"", "athens.mycorp.com", "ftp://proxy", "https://"} {
+		assert.Errorf(t, SetGoProxy(value), "SetGoProxy(%q) should have failed", value)
+	}
+	assert.Equal(t, "file:///tmp/proxy|https://proxy.golang.org", os.Getenv("GOPROXY"))
+}
+
+func TestGoProxyStats(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	defer func(cache string) { moduleCache = cache }(moduleCache)
+	moduleCache = t.TempDir()
+	writeZip := func(escapedPath, version string, size int) {
+		dir := path.Join(moduleCache, "cache", "download", escapedPath, "@v")
+		require.NoError(t, os.MkdirAll(dir, 0700))
+		require.NoError(t, os.WriteFile(path.Join(dir, version+".zip"), make([]byte, size), 0600))
+	}
+	writeZip("example.com/a", "v1.0.0", 100)
+	writeZip("example.com/!big", "v1.2.0", 1000)
+	writeZip("example.com/c", "v0.1.0", 10)
+
+	require.NoError(t, os.WriteFile(path.Join(s.TempDir, "go.mod"), []byte(`module gonb_test
+
+go 1.23
+
+require (
+	example.com/a v1.0.0
+	example.com/Big v1.2.0
+	example.com/missing v1.0.0
+)
+`), 0600))
+	s.recordModuleDownloads([]byte("go: downloading example.com/Big v1.2.0\ngo: downloading example.com/c v0.1.0\n" +
+		"go: added example.com/c v0.1.0\n"))
+
+	stats, err := s.GoProxyStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1110), stats.CacheSize)
+	assert.Equal(t, []CachedModule{{Version: module.Version{Path: "example.com/a", Version: "v1.0.0"}, Size: 100}},
+		stats.Hits)
+	assert.Equal(t, []CachedModule{
+		{Version: module.Version{Path: "example.com/Big", Version: "v1.2.0"}, Size: 1000},
+		{Version: module.Version{Path: "example.com/c", Version: "v0.1.0"}, Size: 10},
+	}, stats.Misses)
+	assert.Equal(t, int64(1010), stats.MissesSize())
+	assert.Equal(t, []CachedModule{{Version: module.Version{Path: "example.com/missing", Version: "v1.0.0"}}},
+		stats.Missing)
+}
@@ -0,0 +1,181 @@
+package goexec
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/janpfeifer/gonb/common"
+	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the editing of the kernel's `go.work` file, for `%gowork use|drop|list`: the `use`
+// rules are changed directly (with modfile), and the tracking of the modules is updated right away.
+
+// GoWorkUse is a `use` rule of `go.work`, as returned by State.GoWorkUses.
+type GoWorkUse struct {
+	// Path of the directory, as given in `go.work`.
+	Path string
+
+	// Module declared in the `go.mod` of the directory, or empty if not found.
+	Module string
+}
+
+// GoWorkPath returns the path of the kernel's `go.work` file.
+func (s *State) GoWorkPath() string {
+	return path.Join(s.TempDir, "go.work")
+}
+
+// GoWorkUses returns the `use` rules of the kernel's `go.work`, or nil if there is no `go.work`.
+func (s *State) GoWorkUses() ([]GoWorkUse, error) {
+	workFile, err := s.readGoWork(false)
+	if err != nil || workFile == nil {
+		return nil, err
+	}
+	uses := make([]GoWorkUse, 0, len(workFile.Use))
+	for _, use := range workFile.Use {
+		uses = append(uses, GoWorkUse{Path: use.Path, Module: moduleOfDir(s.goWorkAbsPath(use.Path))})
+	}
+	return uses, nil
+}
+
+// GoWorkAdd adds `use` rules to the kernel's `go.work` (creating it if needed) for each of the directories,
+// which must have a `go.mod` file. The directories are tracked (see Track).
+//
+// Relative directories are relative to the current directory (usually the notebook's), and they are
+// converted to absolute paths.
+func (s *State) GoWorkAdd(dirs []string) error {
+	s.composeMu.Lock()
+	defer s.composeMu.Unlock()
+	workFile, err := s.readGoWork(true)
+	if err != nil {
+		return err
+	}
+	absDirs := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		absDir, err := filepath.Abs(common.ReplaceTildeInDir(dir))
+		if err != nil {
+			return errors.Wrapf(err, "failed to find absolute path of %q", dir)
+		}
+		module := moduleOfDir(absDir)
+		if module == "" {
+			return errors.Errorf("%q doesn't have a `go.mod` file with a module declaration, it can't be used in `go.work`", dir)
+		}
+		if err = workFile.AddUse(absDir, module); err != nil {
+			return errors.Wrapf(err, "failed to add `use %s` to `go.work`", absDir)
+		}
+		absDirs = append(absDirs, absDir)
+	}
+	if err = s.writeGoWork(workFile); err != nil {
+		return err
+	}
+	// AutoTrack only logs failures to track, here they are reported (e.g.: too many files, see Track).
+	for ii, absDir := range absDirs {
+		if err = s.Track(absDir); err != nil {
+			return errors.WithMessagef(err, "%q added to `go.work`, but not tracked", dirs[ii])
+		}
+	}
+	return nil
+}
+
+// GoWorkDrop removes the `use` rules of the kernel's `go.work` for each of the directories, and stops
+// tracking them. Directories can be given as they are in `go.work`, or relative to the current directory.
+func (s *State) GoWorkDrop(dirs []string) error {
+	s.composeMu.Lock()
+	defer s.composeMu.Unlock()
+	workFile, err := s.readGoWork(false)
+	if err != nil {
+		return err
+	}
+	if workFile == nil {
+		return errors.New("there is no `go.work` file, nothing to drop")
+	}
+	for _, dir := range dirs {
+		absDir, err := filepath.Abs(common.ReplaceTildeInDir(dir))
+		if err != nil {
+			return errors.Wrapf(err, "failed to find absolute path of %q", dir)
+		}
+		var usePath string
+		for _, use := range workFile.Use {
+			if use.Path == dir || s.goWorkAbsPath(use.Path) == absDir {
+				usePath = use.Path
+				break
+			}
+		}
+		if usePath == "" {
+			return errors.Errorf("%q is not used in `go.work`", dir)
+		}
+		if err = workFile.DropUse(usePath); err != nil {
+			return errors.Wrapf(err, "failed to drop `use %s` from `go.work`", usePath)
+		}
+		if slices.Contains(s.ListTracked(), usePath) {
+			if err = s.Untrack(usePath); err != nil {
+				klog.Warningf("Failed to untrack %q dropped from `go.work`: %+v", usePath, err)
+			}
+		}
+	}
+	return s.writeGoWork(workFile)
+}
+
+// readGoWork reads and parses the kernel's `go.work`. If it doesn't exist, it returns nil, or a new
+// one (equivalent to `go work init`) if create is true.
+func (s *State) readGoWork(create bool) (*modfile.WorkFile, error) {
+	goWorkPath := s.GoWorkPath()
+	contents, err := os.ReadFile(goWorkPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "failed to read %q", goWorkPath)
+		}
+		if !create {
+			return nil, nil
+		}
+		workFile := &modfile.WorkFile{Syntax: &modfile.FileSyntax{}}
+		if goMod, err := os.ReadFile(path.Join(s.TempDir, "go.mod")); err == nil {
+			if modFile, err := modfile.ParseLax("go.mod", goMod, nil); err == nil && modFile.Go != nil {
+				if err = workFile.AddGoStmt(modFile.Go.Version); err != nil {
+					return nil, errors.Wrap(err, "failed to set the Go version of the new `go.work`")
+				}
+			}
+		}
+		workFile.AddNewUse(".", "")
+		return workFile, nil
+	}
+	workFile, err := modfile.ParseWork(goWorkPath, contents, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %q", goWorkPath)
+	}
+	return workFile, nil
+}
+
+// writeGoWork writes the kernel's `go.work`, and re-tracks its `use` rules right away.
+func (s *State) writeGoWork(workFile *modfile.WorkFile) error {
+	workFile.Cleanup()
+	goWorkPath := s.GoWorkPath()
+	if err := os.WriteFile(goWorkPath, modfile.Format(workFile.Syntax), 0644); err != nil {
+		return errors.Wrapf(err, "failed to write %q", goWorkPath)
+	}
+	// Force AutoTrack to re-parse `go.work`, even if its modification time didn't change.
+	s.trackingInfo.goWorkModTime = time.Time{}
+	return s.AutoTrack()
+}
+
+// goWorkAbsPath returns the absolute path of a `use` path of `go.work`, which is relative to TempDir.
+func (s *State) goWorkAbsPath(usePath string) string {
+	if filepath.IsAbs(usePath) {
+		return filepath.Clean(usePath)
+	}
+	return filepath.Join(s.TempDir, usePath)
+}
+
+// moduleOfDir returns the module declared in the `go.mod` of dir, or an empty string if there isn't one.
+func moduleOfDir(dir string) string {
+	contents, err := os.ReadFile(path.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	return modfile.ModulePath(contents)
+}
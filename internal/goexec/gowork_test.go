@@ -0,0 +1,39 @@
+package goexec
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoWork(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	uses, err := s.GoWorkUses()
+	require.NoError(t, err)
+	assert.Nil(t, uses)
+	require.Error(t, s.GoWorkDrop([]string{"x"}))
+
+	modDir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(modDir, "go.mod"), []byte("module example.com/mylib\n\ngo 1.23\n"), 0600))
+	require.NoError(t, os.WriteFile(path.Join(modDir, "lib.go"), []byte("package mylib\n"), 0600))
+	require.Error(t, s.GoWorkAdd([]string{t.TempDir()}), "directories without go.mod can't be used")
+
+	require.NoError(t, s.GoWorkAdd([]string{modDir}))
+	uses, err = s.GoWorkUses()
+	require.NoError(t, err)
+	assert.Equal(t, []GoWorkUse{{Path: ".", Module: s.Package}, {Path: modDir, Module: "example.com/mylib"}}, uses)
+	assert.Contains(t, s.ListTracked(), modDir)
+	assert.True(t, s.hasGoWork)
+
+	require.NoError(t, s.GoWorkDrop([]string{modDir}))
+	uses, err = s.GoWorkUses()
+	require.NoError(t, err)
+	assert.Equal(t, []GoWorkUse{{Path: ".", Module: s.Package}}, uses)
+	assert.NotContains(t, s.ListTracked(), modDir)
+	require.Error(t, s.GoWorkDrop([]string{modDir}))
+}
@@ -0,0 +1,79 @@
+package goexec
+
+import (
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the hooks executed before and after each cell execution, registered with `%hook`.
+
+// HookKind is either HookPreRun or HookPostRun.
+type HookKind string
+
+const (
+	// HookPreRun hooks are executed before the Go code of a cell is parsed and compiled.
+	HookPreRun HookKind = "pre"
+
+	// HookPostRun hooks are executed after the Go code of a cell is executed, even if it failed.
+	HookPostRun HookKind = "post"
+)
+
+// HookRunner executes one hook command line: either a special command (starting with `%`) or a
+// shell command (starting with `!`).
+//
+// It is set by the `specialcmd` package, which implements the execution of these commands.
+type HookRunner func(msg kernel.Message, cmdLine string) error
+
+// AddHook registers a command line to be executed before (HookPreRun) or after (HookPostRun)
+// each cell with Go code is executed.
+func (s *State) AddHook(kind HookKind, cmdLine string) error {
+	switch kind {
+	case HookPreRun:
+		s.PreRunHooks = append(s.PreRunHooks, cmdLine)
+	case HookPostRun:
+		s.PostRunHooks = append(s.PostRunHooks, cmdLine)
+	default:
+		return errors.Errorf("unknown hook kind %q, valid values are %q or %q", kind, HookPreRun, HookPostRun)
+	}
+	return nil
+}
+
+// ResetHooks removes the hooks of the given kind. If kind is empty, all hooks are removed.
+func (s *State) ResetHooks(kind HookKind) error {
+	switch kind {
+	case "":
+		s.PreRunHooks = nil
+		s.PostRunHooks = nil
+	case HookPreRun:
+		s.PreRunHooks = nil
+	case HookPostRun:
+		s.PostRunHooks = nil
+	default:
+		return errors.Errorf("unknown hook kind %q, valid values are %q or %q", kind, HookPreRun, HookPostRun)
+	}
+	return nil
+}
+
+// runHooks executes the hooks of the given kind, in the order they were registered.
+// It stops at the first hook that fails, and returns its error.
+func (s *State) runHooks(msg kernel.Message, kind HookKind) error {
+	hooks := s.PreRunHooks
+	if kind == HookPostRun {
+		hooks = s.PostRunHooks
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+	if s.HookRunner == nil {
+		klog.Warningf("goexec: %d %s-run hooks registered, but no HookRunner is set", len(hooks), kind)
+		return nil
+	}
+	for _, cmdLine := range hooks {
+		klog.V(2).Infof("goexec: running %s-run hook %q", kind, cmdLine)
+		if err := s.HookRunner(msg, cmdLine); err != nil {
+			return errors.WithMessagef(err, "%s-run hook %q failed", kind, cmdLine)
+		}
+	}
+	return nil
+}
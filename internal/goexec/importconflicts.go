@@ -0,0 +1,136 @@
+package goexec
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/pkg/errors"
+)
+
+// This file implements the detection of conflicting imports: different packages imported under the same name,
+// in the same cell or in different cells. Otherwise, one of the imports would be silently dropped, and the
+// compiler would report confusing errors (e.g. undefined functions) in the code using the dropped one.
+
+var (
+	// regexpMajorVersion matches the major version element of an import path, e.g. "v2" in "github.com/a/b/v2".
+	regexpMajorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+	// regexpGopkgVersion matches the version suffix of gopkg.in import paths, e.g. ".v3" in "gopkg.in/yaml.v3".
+	regexpGopkgVersion = regexp.MustCompile(`\.v[0-9]+$`)
+
+	// regexpNonAlphanumeric matches characters that can't be used in an import alias.
+	regexpNonAlphanumeric = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+)
+
+// defaultImportName returns the name under which the package importPath is imported when no alias is given:
+// its last element, skipping the major version (`/v2` or `.v2` suffixes).
+// It's a guess: the package may declare a different name.
+func defaultImportName(importPath string) string {
+	parts := strings.Split(importPath, "/")
+	name := parts[len(parts)-1]
+	if len(parts) > 1 && regexpMajorVersion.MatchString(name) {
+		name = parts[len(parts)-2]
+	}
+	name = regexpGopkgVersion.ReplaceAllString(name, "")
+	if match := reDefaultImportPathAlias.FindStringSubmatch(name); len(match) >= 2 {
+		return match[1]
+	}
+	return importPath
+}
+
+// suggestImportAlias suggests an alias for importPath, distinct from its default name: the default name prefixed
+// by the previous element of the path (e.g. "cryptorand" for "crypto/rand").
+func suggestImportAlias(importPath string) string {
+	name := defaultImportName(importPath)
+	parts := strings.Split(importPath, "/")
+	for ii := len(parts) - 2; ii >= 0; ii-- {
+		prefix := strings.ToLower(regexpNonAlphanumeric.ReplaceAllString(parts[ii], ""))
+		if prefix != "" && prefix != name && !regexpMajorVersion.MatchString(prefix) {
+			return prefix + name
+		}
+	}
+	return "my" + name
+}
+
+// describeImport returns a description of the import for error messages, including the cell and line where
+// it was defined, if known.
+func describeImport(importDecl *Import) string {
+	description := fmt.Sprintf("%q", importDecl.Path)
+	if importDecl.CellLines.Id >= 0 {
+		description += fmt.Sprintf(" (cell [%d]", importDecl.CellLines.Id)
+		if len(importDecl.CellLines.Lines) > 0 {
+			description += fmt.Sprintf(", line %d", importDecl.CellLines.Lines[0]+1)
+		}
+		description += ")"
+	}
+	return description
+}
+
+// duplicateImportError returns the error for two imports in the same cell of different packages with the
+// same name.
+func duplicateImportError(first, second *Import) error {
+	return errors.Errorf("imports %s and %s are both named `%s`: give one of them an alias, e.g. `import %s %q`",
+		describeImport(first), describeImport(second), second.Key, suggestImportAlias(second.Path), second.Path)
+}
+
+// checkImportConflicts returns an error if an import of newDecls replaces a memorized import in d, of a different
+// package under the same name, that is still used by memorized declarations not redefined by newDecls.
+// Replacing an import that is no longer used (e.g. changing the import of a cell executed again) is fine.
+func (d *Declarations) checkImportConflicts(newDecls *Declarations) error {
+	for _, key := range SortedKeys(newDecls.Imports) {
+		newImport := newDecls.Imports[key]
+		oldImport, found := d.Imports[key]
+		if !found || oldImport.Path == newImport.Path || strings.Contains(key, "~") {
+			continue
+		}
+		users := d.usesOfImport(key, newDecls)
+		if len(users) == 0 {
+			continue
+		}
+		return errors.Errorf("import %s replaces %s, imported under the same name `%s`, which is still used by %s.\n"+
+			"Give the new import an alias, e.g. `import %s %q`, or remove the previous import with `%%rm %s` "+
+			"(and the declarations using it)",
+			describeImport(newImport), describeImport(oldImport), key, strings.Join(users, ", "),
+			suggestImportAlias(newImport.Path), newImport.Path, key)
+	}
+	return nil
+}
+
+// usesOfImport returns the descriptions of the declarations in d (not redefined in newDecls) that use the import
+// with the given key, as a qualifier (e.g. `rand.`). Matching is textual, so it may include false positives in
+// comments and strings.
+func (d *Declarations) usesOfImport(key string, newDecls *Declarations) (users []string) {
+	re := regexp.MustCompile(`(^|[^\w.])` + regexp.QuoteMeta(key) + `\s*\.`)
+	describe := func(kind, name string, cellLines CellLines) string {
+		description := kind + " " + strings.Replace(name, "~", ".", 1)
+		if cellLines.Id >= 0 {
+			description += fmt.Sprintf(" (cell [%d])", cellLines.Id)
+		}
+		return description
+	}
+	for _, name := range SortedKeys(d.Functions) {
+		if _, redefined := newDecls.Functions[name]; !redefined && re.MatchString(d.Functions[name].Definition) {
+			users = append(users, describe("func", name, d.Functions[name].CellLines))
+		}
+	}
+	for _, name := range SortedKeys(d.Types) {
+		if _, redefined := newDecls.Types[name]; !redefined && re.MatchString(d.Types[name].TypeDefinition) {
+			users = append(users, describe("type", name, d.Types[name].CellLines))
+		}
+	}
+	for _, name := range SortedKeys(d.Variables) {
+		v := d.Variables[name]
+		if _, redefined := newDecls.Variables[name]; !redefined && re.MatchString(v.TypeDefinition+" "+v.ValueDefinition) {
+			users = append(users, describe("var", name, v.CellLines))
+		}
+	}
+	for _, name := range SortedKeys(d.Constants) {
+		c := d.Constants[name]
+		if _, redefined := newDecls.Constants[name]; !redefined && re.MatchString(c.TypeDefinition+" "+c.ValueDefinition) {
+			users = append(users, describe("const", name, c.CellLines))
+		}
+	}
+	return
+}
@@ -0,0 +1,48 @@
+package goexec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultImportName(t *testing.T) {
+	assert.Equal(t, "rand", defaultImportName("math/rand"))
+	assert.Equal(t, "fmt", defaultImportName("fmt"))
+	assert.Equal(t, "gonb", defaultImportName("github.com/janpfeifer/gonb/v2"))
+	assert.Equal(t, "yaml", defaultImportName("gopkg.in/yaml.v3"))
+	assert.Equal(t, "sqlite3", defaultImportName("github.com/mattn/go-sqlite3"))
+
+	assert.Equal(t, "cryptorand", suggestImportAlias("crypto/rand"))
+	assert.Equal(t, "janpfeifergonb", suggestImportAlias("github.com/janpfeifer/gonb/v2"))
+	assert.Equal(t, "myfmt", suggestImportAlias("fmt"))
+
+	// Blank imports don't replace each other.
+	assert.NotEqual(t, NewImport("a/driver", "_").Key, NewImport("b/driver", "_").Key)
+}
+
+func TestImportConflicts(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	// Same name in the same cell.
+	_, _, _, _, err := s.parseLinesAndComposeMain(nil, 1,
+		strings.Split("import (\n\t\"math/rand\"\n\t\"crypto/rand\"\n)", "\n"), nil, NoCursor)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"math/rand" (cell [1], line 2)`)
+	assert.Contains(t, err.Error(), "import cryptorand \"crypto/rand\"")
+
+	// Replacing an import still used by a memorized declaration.
+	parseCellForTest(t, s, 2, "import \"math/rand\"\n\nfunc Roll() int { return rand.Intn(6) }")
+	_, _, _, _, err = s.parseLinesAndComposeMain(nil, 3, strings.Split("import \"crypto/rand\"", "\n"), nil, NoCursor)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "func Roll (cell [2])")
+	assert.Contains(t, err.Error(), "%rm rand")
+
+	// Fine if the declarations using it are redefined as well.
+	_, _, _, _, err = s.parseLinesAndComposeMain(nil, 4,
+		strings.Split("import \"crypto/rand\"\n\nfunc Roll() int { return rand.Reader.Read(nil) }", "\n"), nil, NoCursor)
+	require.NoError(t, err)
+}
@@ -0,0 +1,76 @@
+package goexec
+
+import (
+	"github.com/pkg/errors"
+	"go/token"
+	"k8s.io/klog/v2"
+	"os/exec"
+	"strings"
+)
+
+// This file implements the direct management of the memorized imports (`%import`), without requiring
+// a cell with the `import` statement.
+
+// AddImport memorizes the import of importPath, with an optional alias.
+//
+// If AutoGet is enabled and the package is not from the standard library, it first runs `go get`.
+// It then validates that the package resolves, and returns an error otherwise.
+func (s *State) AddImport(importPath, alias string) (*Import, error) {
+	if importPath == "" || strings.ContainsAny(importPath, " \t\"") {
+		return nil, errors.Errorf("invalid import path %q", importPath)
+	}
+	if alias != "" && alias != "." && alias != "_" && !token.IsIdentifier(alias) {
+		return nil, errors.Errorf("invalid import alias %q", alias)
+	}
+	isStandard := !strings.Contains(strings.Split(importPath, "/")[0], ".")
+	if s.AutoGet && !isStandard {
+		if err := s.runGoCmd("get", importPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.runGoCmd("list", "-find", importPath); err != nil {
+		return nil, errors.WithMessagef(err, "package %q not found", importPath)
+	}
+	importDecl := NewImport(importPath, alias)
+	importDecl.CellLines = CellLines{Id: -1}
+	s.UpdateDefinitions(func(decls *Declarations) {
+		decls.Imports[importDecl.Key] = importDecl
+	})
+	return importDecl, nil
+}
+
+// RemoveImport removes the memorized import with the given key (its alias or package name), or with the given
+// import path. It returns the removed import, or an error if none was found.
+func (s *State) RemoveImport(keyOrPath string) (removed *Import, err error) {
+	s.UpdateDefinitions(func(decls *Declarations) {
+		if importDecl, found := decls.Imports[keyOrPath]; found {
+			delete(decls.Imports, keyOrPath)
+			removed = importDecl
+			return
+		}
+		for key, importDecl := range decls.Imports {
+			if importDecl.Path == keyOrPath {
+				delete(decls.Imports, key)
+				removed = importDecl
+				return
+			}
+		}
+	})
+	if removed == nil {
+		err = errors.Errorf("import %q not found in memorized definitions", keyOrPath)
+	}
+	return
+}
+
+// runGoCmd runs `go <args...>` in the temporary directory, and returns an error with its output if it fails.
+func (s *State) runGoCmd(args ...string) error {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = s.TempDir
+	klog.V(2).Infof("Executing %s", cmd)
+	output, err := cmd.CombinedOutput()
+	s.recordModuleDownloads(output)
+	if err != nil {
+		return errors.Wrapf(err, "failed to run %q:\n%s%s", cmd.String(), output, privateModuleNote(string(output)))
+	}
+	return nil
+}
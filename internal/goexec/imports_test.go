@@ -0,0 +1,34 @@
+package goexec
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAddRemoveImport(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	s.AutoGet = false
+
+	importDecl, err := s.AddImport("strings", "str")
+	require.NoError(t, err)
+	assert.Equal(t, "str", importDecl.Key)
+	_, err = s.AddImport("math/rand", "")
+	require.NoError(t, err)
+	assert.Equal(t, "rand", s.Definitions.Imports["rand"].Key)
+
+	_, err = s.AddImport("not/a/package", "")
+	require.Error(t, err)
+	_, err = s.AddImport("strings", "1bad")
+	require.Error(t, err)
+
+	// Remove by key and by path.
+	_, err = s.RemoveImport("str")
+	require.NoError(t, err)
+	_, err = s.RemoveImport("math/rand")
+	require.NoError(t, err)
+	assert.Empty(t, s.Definitions.Imports)
+	_, err = s.RemoveImport("str")
+	require.Error(t, err)
+}
@@ -0,0 +1,73 @@
+package goexec
+
+import (
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/pkg/errors"
+	"slices"
+	"strings"
+)
+
+// This file handles the ordering of the `init_*` functions, which are rendered as `func init()`, and are
+// executed by Go in the order they appear in the file.
+
+// InitFunctionKeys returns the keys of the memorized `init_*` functions, in the order they are executed.
+func (d *Declarations) InitFunctionKeys() []string {
+	var keys []string
+	for _, key := range d.InitOrder {
+		if _, found := d.Functions[key]; found {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range SortedKeys(d.Functions) {
+		if strings.HasPrefix(key, InitFunctionPrefix) && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// functionKeysInRenderOrder returns the keys of all functions sorted, except the `init_*` functions, which
+// take the slots of the sorted `init_*` functions, but in the order given by InitFunctionKeys.
+func (d *Declarations) functionKeysInRenderOrder() []string {
+	keys := SortedKeys(d.Functions)
+	if len(d.InitOrder) == 0 {
+		return keys
+	}
+	initKeys := d.InitFunctionKeys()
+	var initIdx int
+	for ii, key := range keys {
+		if strings.HasPrefix(key, InitFunctionPrefix) {
+			keys[ii] = initKeys[initIdx]
+			initIdx++
+		}
+	}
+	return keys
+}
+
+// SetInitOrder sets the order in which the memorized `init_*` functions are executed. The names can be given
+// with or without the "init_" prefix. Init functions not listed are executed afterward, sorted by name.
+//
+// An empty list resets to the default order, sorted by name.
+func (s *State) SetInitOrder(names []string) error {
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		key := name
+		if !strings.HasPrefix(key, InitFunctionPrefix) {
+			key = InitFunctionPrefix + key
+		}
+		if _, found := s.Definitions.Functions[key]; !found {
+			return errors.Errorf("init function %q not found in memorized definitions, see `%%init list`", key)
+		}
+		if slices.Contains(keys, key) {
+			return errors.Errorf("init function %q listed more than once", key)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		keys = nil
+	}
+	s.UpdateDefinitions(func(decls *Declarations) {
+		decls.InitOrder = keys
+	})
+	return nil
+}
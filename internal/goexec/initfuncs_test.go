@@ -0,0 +1,39 @@
+package goexec
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestInitOrder(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	for _, key := range []string{"init_a", "init_b", "init_c", "Helper"} {
+		s.Definitions.Functions[key] = &Function{Key: key, Name: key,
+			Definition: "func " + key + "() { println(\"" + key + "\") }"}
+	}
+	assert.Equal(t, []string{"init_a", "init_b", "init_c"}, s.Definitions.InitFunctionKeys())
+
+	require.NoError(t, s.SetInitOrder([]string{"c", "init_a"}))
+	assert.Equal(t, []string{"init_c", "init_a", "init_b"}, s.Definitions.InitFunctionKeys())
+
+	// Order is preserved when declarations are copied (at every cell execution).
+	decls := s.Definitions.Copy()
+	assert.Equal(t, []string{"Helper", "init_c", "init_a", "init_b"}, decls.functionKeysInRenderOrder())
+
+	var buf bytes.Buffer
+	_, _, err := s.createCodeFromDecls(&buf, decls, nil)
+	require.NoError(t, err)
+	code := buf.String()
+	posC, posA, posB := strings.Index(code, `println("init_c")`), strings.Index(code, `println("init_a")`),
+		strings.Index(code, `println("init_b")`)
+	assert.True(t, posC < posA && posA < posB, "init functions rendered in the wrong order:\n%s", code)
+
+	require.Error(t, s.SetInitOrder([]string{"missing"}))
+	require.Error(t, s.SetInitOrder([]string{"a", "init_a"}))
+	require.NoError(t, s.SetInitOrder(nil))
+	assert.Equal(t, []string{"init_a", "init_b", "init_c"}, s.Definitions.InitFunctionKeys())
+}
@@ -17,18 +17,26 @@ import (
 // This file implements inspecting an identifier (`InspectRequest`) in a Cell and auto-complete
 // functionalities.
 
-// standardFilesForNotification for gopls.
-var standardFilesForNotification = []string{
-	"main.go", "go.mod", "go.sum", "go.work", "other.go",
-}
+// Standard files for notification for gopls: the code files are in State.TempDir, and the module files
+// in the directory with `go.mod` (they differ for the shadow package, see ShadowDir).
+var (
+	codeFilesForNotification   = []string{"main.go", "other.go"}
+	moduleFilesForNotification = []string{"go.mod", "go.sum", "go.work"}
+)
 
 func (s *State) notifyAboutStandardAndTrackedFiles(ctx context.Context) (err error) {
-	for _, filePath := range standardFilesForNotification {
+	for _, filePath := range codeFilesForNotification {
 		err = s.gopls.NotifyDidOpenOrChange(ctx, path.Join(s.TempDir, filePath))
 		if err != nil {
 			return
 		}
 	}
+	for _, filePath := range moduleFilesForNotification {
+		err = s.gopls.NotifyDidOpenOrChange(ctx, path.Join(s.goModDir(), filePath))
+		if err != nil {
+			return
+		}
+	}
 	err = s.EnumerateUpdatedFiles(func(filePath string) error {
 		klog.V(1).Infof("Notified of change to %q", filePath)
 		return s.gopls.NotifyDidOpenOrChange(ctx, filePath)
@@ -40,10 +48,16 @@ func (s *State) notifyAboutStandardAndTrackedFiles(ctx context.Context) (err err
 }
 
 // InspectIdentifierInCell implements an `inspect_request` from Jupyter, using `gopls`.
-// It updates `main.go` with the cell contents (given as Lines)
+// It composes the program with the cell contents (given as Lines) in the shadow package (see ShadowDir),
+// so it can be called concurrently with the execution of a cell.
 func (s *State) InspectIdentifierInCell(lines []string, skipLines map[int]struct{}, cursorLine, cursorCol int) (mimeMap kernel.MIMEMap, err error) {
 	klog.V(2).Infof("InspectIdentifierInCell: ")
-	if s.gopls == nil {
+	defer func() {
+		if err == nil {
+			mimeMap = s.appendDiagnosticsToInspect(mimeMap, lines, cursorLine)
+		}
+	}()
+	if s.goplsOnDemand() == nil {
 		// gopls not installed.
 		return make(kernel.MIMEMap), nil
 	}
@@ -53,63 +67,65 @@ func (s *State) InspectIdentifierInCell(lines []string, skipLines map[int]struct
 		return
 	}
 
-	// Runs AutoTrack: makes sure redirects in go.mod and use clauses in go.work are tracked.
-	err = s.AutoTrack()
+	s.introspectionMu.Lock()
+	defer s.introspectionMu.Unlock()
+	view, release, err := s.introspectionState()
 	if err != nil {
 		return
 	}
+	defer release()
 
 	// Adjust cursor to identifier.
 	cursorInCell := Cursor{cursorLine, cursorCol}
 	cursorInCell = adjustCursorForFunctionIdentifier(lines, skipLines, cursorInCell)
 
-	// Generate `main.go` with contents of current cell.
+	// Generate `main.go` in the shadow package with contents of current cell.
 	cellId := -1 // Inspect doesn't actually execute it, so parsed contents of cell are not kept.
-	updatedDecls, mainDecl, cursorInFile, fileToCellIdAndLine, err := s.parseLinesAndComposeMain(nil, cellId, lines, skipLines, cursorInCell)
+	updatedDecls, mainDecl, cursorInFile, fileToCellIdAndLine, err := view.parseLinesAndComposeMain(nil, cellId, lines, skipLines, cursorInCell)
 	if err != nil {
 		klog.V(2).Infof("Ignoring parse err for InspectRequest: %+v", err)
 		err = nil
 		// Render memorized definitions on a side file, so `gopls` can pick those definitions if needed for
 		// auto-complete.
-		err = s.createAlternativeFileFromDecls(s.Definitions)
-		klog.V(2).Infof(". Alternative file %q with memorized definitions created", s.AlternativeDefinitionsPath())
+		err = view.createAlternativeFileFromDecls(view.Definitions)
+		klog.V(2).Infof(". Alternative file %q with memorized definitions created", view.AlternativeDefinitionsPath())
 		if err != nil {
 			return
 		}
 		defer func() {
 			// Remove alternative file after
-			err2 := os.Remove(s.AlternativeDefinitionsPath())
+			err2 := os.Remove(view.AlternativeDefinitionsPath())
 			if err2 != nil && !os.IsNotExist(err2) {
 				klog.Errorf("Failed to remove alternative definitions: %+v", err2)
 			}
-			klog.V(2).Infof(". Alternative file %q with memorized definitions removed", s.AlternativeDefinitionsPath())
+			klog.V(2).Infof(". Alternative file %q with memorized definitions removed", view.AlternativeDefinitionsPath())
 		}()
 
 	} else {
 		// ProgramExecutor `goimports`: we just want to make sure that "go get" is executed for the needed packages.
-		cursorInFile, _, err = s.GoImports(nil, updatedDecls, mainDecl, fileToCellIdAndLine)
+		cursorInFile, _, err = view.GoImports(nil, updatedDecls, mainDecl, fileToCellIdAndLine)
 		if err != nil {
 			err = errors.WithMessagef(err, "goimports failed")
 			return
 		}
 	}
 	if klog.V(1).Enabled() {
-		s.logCursor(cursorInFile)
+		view.logCursor(cursorInFile)
 	}
 
 	// Query `gopls`.
 	ctx := context.Background()
 	var desc string
 	klog.V(2).Infof("InspectIdentifierInCell: gopls.Definition(ctx, %s, %d, %d)",
-		s.CodePath(), cursorInFile.Line, cursorInFile.Col)
+		view.CodePath(), cursorInFile.Line, cursorInFile.Col)
 
 	// Notify about standard files updates:
-	err = s.notifyAboutStandardAndTrackedFiles(ctx)
+	err = view.notifyAboutStandardAndTrackedFiles(ctx)
 	if err != nil {
 		return
 	}
-	desc, err = s.gopls.Definition(ctx, s.CodePath(), cursorInFile.Line, cursorInFile.Col)
-	messages := s.gopls.ConsumeMessages()
+	desc, err = view.gopls.Definition(ctx, view.CodePath(), cursorInFile.Line, cursorInFile.Col)
+	messages := view.gopls.ConsumeMessages()
 	if err != nil {
 		parts := []string{errors.Cause(err).Error()}
 		if len(messages) > 0 {
@@ -124,10 +140,11 @@ func (s *State) InspectIdentifierInCell(lines []string, skipLines map[int]struct
 }
 
 // AutoCompleteOptionsInCell implements a `complete_request` from Jupyter, using `gopls`.
-// It updates `main.go` with the cell contents (given as Lines)
+// It composes the program with the cell contents (given as Lines) in the shadow package (see ShadowDir),
+// so it can be called concurrently with the execution of a cell.
 func (s *State) AutoCompleteOptionsInCell(cellLines []string, skipLines map[int]struct{},
 	cursorLine, cursorCol int, reply *kernel.CompleteReply) (err error) {
-	if s.gopls == nil {
+	if s.goplsOnDemand() == nil {
 		// gopls not installed.
 		return
 	}
@@ -137,57 +154,59 @@ func (s *State) AutoCompleteOptionsInCell(cellLines []string, skipLines map[int]
 		return
 	}
 
-	// Runs AutoTrack: makes sure redirects in go.mod and use clauses in go.work are tracked.
-	err = s.AutoTrack()
+	s.introspectionMu.Lock()
+	defer s.introspectionMu.Unlock()
+	view, release, err := s.introspectionState()
 	if err != nil {
 		return
 	}
+	defer release()
 
-	// Generate `main.go` (and maybe `other.go`) with contents of current cell.
+	// Generate `main.go` (and maybe `other.go`) in the shadow package with contents of current cell.
 	cellId := -1 // AutoComplete doesn't actually execute it, so parsed contents of cell are not kept.
 	cursorInCell := Cursor{cursorLine, cursorCol}
-	updatedDecls, mainDecl, cursorInFile, fileToCellIdAndLine, err := s.parseLinesAndComposeMain(nil, cellId, cellLines, skipLines, cursorInCell)
+	updatedDecls, mainDecl, cursorInFile, fileToCellIdAndLine, err := view.parseLinesAndComposeMain(nil, cellId, cellLines, skipLines, cursorInCell)
 	if err != nil {
 		klog.V(2).Infof("Ignoring ParseError for auto-complete: %+v", err)
 		err = nil
 		// Render memorized definitions on a side file, so `gopls` can pick those definitions if needed for
 		// auto-complete.
-		err = s.createAlternativeFileFromDecls(s.Definitions)
-		klog.V(2).Infof(". Alternative file %q with memorized definitions created", s.AlternativeDefinitionsPath())
+		err = view.createAlternativeFileFromDecls(view.Definitions)
+		klog.V(2).Infof(". Alternative file %q with memorized definitions created", view.AlternativeDefinitionsPath())
 		if err != nil {
 			return
 		}
 		defer func() {
 			// Remove alternative file after
-			err2 := os.Remove(s.AlternativeDefinitionsPath())
+			err2 := os.Remove(view.AlternativeDefinitionsPath())
 			if err2 != nil && !os.IsNotExist(err2) {
 				klog.Errorf("Failed to remove alternative definitions: %+v", err2)
 			}
-			klog.V(2).Infof(". Alternative file %q with memorized definitions removed", s.AlternativeDefinitionsPath())
+			klog.V(2).Infof(". Alternative file %q with memorized definitions removed", view.AlternativeDefinitionsPath())
 		}()
 	} else {
 		// If parsing succeeded, execute `goimports`: we just want to make sure that "go get" is executed for the
 		// needed packages.
-		cursorInFile, _, err = s.GoImports(nil, updatedDecls, mainDecl, fileToCellIdAndLine)
+		cursorInFile, _, err = view.GoImports(nil, updatedDecls, mainDecl, fileToCellIdAndLine)
 		if err != nil {
 			err = errors.WithMessagef(err, "goimports failed")
 			return
 		}
 	}
 	if klog.V(1).Enabled() {
-		s.logCursor(cursorInFile)
+		view.logCursor(cursorInFile)
 	}
 
 	// Query `gopls`.
 	ctx := context.Background()
-	err = s.notifyAboutStandardAndTrackedFiles(ctx)
+	err = view.notifyAboutStandardAndTrackedFiles(ctx)
 	if err != nil {
 		return
 	}
 	_ = cursorInFile
 	var matches []string
 	var replaceLength int
-	matches, replaceLength, err = s.gopls.Complete(ctx, s.CodePath(), cursorInFile.Line, cursorInFile.Col)
+	matches, replaceLength, err = view.gopls.Complete(ctx, view.CodePath(), cursorInFile.Line, cursorInFile.Col)
 	if err != nil {
 		err = errors.Cause(err)
 		return
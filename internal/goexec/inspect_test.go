@@ -0,0 +1,52 @@
+package goexec
+
+import (
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestIntrospectionState(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	lines := strings.Split("func f() int { return 1 }", "\n")
+	require.NoError(t, s.MemorizeCell(nil, 1, lines, MakeSet[int]()))
+
+	// One-shot configuration of a cell being executed concurrently.
+	s.CellIsTest = true
+	s.Args = []string{"-test.v"}
+
+	view, release, err := s.introspectionState()
+	require.NoError(t, err)
+	assert.False(t, view.CellIsTest)
+	assert.Empty(t, view.Args)
+	assert.Contains(t, view.Definitions.Functions, "f")
+
+	// Introspection composes its program in the shadow package, leaving `main.go` untouched.
+	mainContents, err := os.ReadFile(path.Join(s.TempDir, MainGo))
+	require.NoError(t, err)
+	assert.Equal(t, path.Join(s.TempDir, ShadowDirName, MainGo), view.CodePath())
+	assert.Equal(t, s.TempDir, view.goModDir())
+	_, _, _, _, err = view.parseLinesAndComposeMain(nil, -1, strings.Split("func g() int { return f() }", "\n"), MakeSet[int](), NoCursor)
+	require.NoError(t, err)
+	assert.FileExists(t, view.CodePath())
+	newMainContents, err := os.ReadFile(path.Join(s.TempDir, MainGo))
+	require.NoError(t, err)
+	assert.Equal(t, string(mainContents), string(newMainContents))
+
+	// While the introspection holds the module, cell executions wait.
+	assert.False(t, s.composeMu.TryLock())
+	release()
+	assert.True(t, s.composeMu.TryLock())
+	s.composeMu.Unlock()
+
+	// Declarations are a snapshot: changes in the executing State are not seen by the view, and vice-versa.
+	delete(s.Definitions.Functions, "f")
+	assert.Contains(t, view.Definitions.Functions, "f")
+	view.Definitions.Functions["g"] = &Function{Key: "g", Name: "g"}
+	assert.NotContains(t, s.Definitions.Functions, "g")
+}
@@ -0,0 +1,78 @@
+package goexec
+
+import (
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+	"os"
+)
+
+// This file implements the execution of isolated cells (`%%isolate`): they are compiled and executed in a
+// fresh module, without the memorized declarations, and nothing is memorized afterward.
+
+// ExecuteIsolatedCell executes the cell standalone: in a new temporary module, without any of the memorized
+// declarations, and without memorizing its declarations.
+//
+// The one-shot configuration of the cell (`%test`, `%args`, `%capture`) is used by the isolated execution,
+// and reset afterward, as in ExecuteCell. Executions are serialized with those of ExecuteCell.
+func (s *State) ExecuteIsolatedCell(msg kernel.Message, cellId int, lines []string, skipLines Set[int]) error {
+	params := &cellExecParams{
+		msg:       msg,
+		cellId:    cellId,
+		lines:     lines,
+		skipLines: skipLines,
+		isolated:  true,
+		done:      NewLatchWithValue[error](),
+	}
+	s.cellExecChan <- params
+	return params.done.Wait()
+}
+
+// executeIsolatedCellImpl implements ExecuteIsolatedCell. It should only be called by serializeExecuteCell.
+func (s *State) executeIsolatedCellImpl(msg kernel.Message, cellId int, lines []string, skipLines Set[int]) error {
+	defer s.PostExecuteCell()
+	if s.CellIsWasm {
+		return errors.New("%wasm cannot be used in an isolated cell (`%%isolate`)")
+	}
+
+	isolated := &State{
+		Kernel:            s.Kernel,
+		UniqueID:          s.UniqueID,
+		Package:           s.Package,
+		Definitions:       NewDeclarations(),
+		AutoGet:           s.AutoGet,
+		GoBuildFlags:      s.GoBuildFlags,
+		BuildTags:         s.BuildTags,
+		CellBuildTags:     s.CellBuildTags,
+		Args:              s.Args,
+		trackingInfo:      newTrackingInfo(),
+		preserveTempDir:   s.preserveTempDir,
+		errorFormat:       s.errorFormat,
+		Comms:             s.Comms,
+		CellIsTest:        s.CellIsTest,
+		CellTests:         s.CellTests,
+		CellHasBenchmarks: s.CellHasBenchmarks,
+		Capture:           s.Capture,
+	}
+	s.Capture = nil // Closed by the isolated state.
+
+	var err error
+	isolated.TempDir, err = os.MkdirTemp("", s.Package+"_isolated_")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create temporary directory for isolated cell")
+	}
+	if s.preserveTempDir {
+		klog.Infof("Isolated cell temporary work directory: %s", isolated.TempDir)
+	} else {
+		defer func() {
+			if err := os.RemoveAll(isolated.TempDir); err != nil {
+				klog.Errorf("Failed to remove isolated cell temporary directory %q: %+v", isolated.TempDir, err)
+			}
+		}()
+	}
+	if err = isolated.GoModInit(); err != nil {
+		return err
+	}
+	return isolated.executeCellImpl(msg, cellId, lines, skipLines)
+}
@@ -0,0 +1,51 @@
+package goexec
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/janpfeifer/gonb/gonbui/jupyterapi"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"k8s.io/klog/v2"
+)
+
+// This file handles the discovery of the Jupyter server running the kernel, needed to know its root directory
+// and the URLs where it serves files.
+
+var (
+	muJupyterServer  sync.Mutex
+	jupyterServer    *jupyterapi.Client
+	jupyterServerErr error
+)
+
+// JupyterServer returns a client to the Jupyter server running the kernel.
+//
+// If there are several Jupyter servers running, it picks the one that reports the kernel id (see
+// `jupyterapi.DiscoverForKernel`), instead of simply relying on the pid of the parent process.
+// The result is cached.
+func JupyterServer() (*jupyterapi.Client, error) {
+	muJupyterServer.Lock()
+	defer muJupyterServer.Unlock()
+	if jupyterServer == nil && jupyterServerErr == nil {
+		jupyterServer, jupyterServerErr = jupyterapi.DiscoverForKernel(os.Getenv(protocol.GONB_JUPYTER_KERNEL_ID_ENV))
+		if jupyterServerErr != nil {
+			klog.Warningf("Could not discover Jupyter server: %v", jupyterServerErr)
+		} else {
+			klog.Infof("Jupyter server at %q (root directory %q), discovered from %q",
+				jupyterServer.URL, jupyterServer.RootDir, jupyterServer.RuntimeFile)
+		}
+	}
+	return jupyterServer, jupyterServerErr
+}
+
+// JupyterFilesUrl returns the URL path where Jupyter serves the file in relPath, relative to the Jupyter
+// root directory. It accounts for the Jupyter server "base_url", if the server was discovered.
+func JupyterFilesUrl(relPath string) string {
+	basePath := "/"
+	if server, err := JupyterServer(); err == nil {
+		basePath = server.BasePath()
+	}
+	return path.Join(basePath, "files", filepath.ToSlash(relPath))
+}
@@ -0,0 +1,83 @@
+package goexec
+
+import (
+	"net"
+	"strings"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements `%listen`: listening sockets owned by the kernel and inherited by the cell programs
+// (see `gonbui.Listener`), so servers developed in the notebook can be restarted on the same port, without
+// waiting for it to be released.
+
+// ListenerInfo describes a listening socket created with State.Listen.
+type ListenerInfo struct {
+	Name, Network, Address string
+}
+
+// Listen creates a TCP (or Unix, if address is prefixed with "unix:") listening socket with the given name,
+// to be inherited by the cell programs. An existing listener with the same name is closed first.
+func (s *State) Listen(name, address string) (*ListenerInfo, error) {
+	if name == "" || strings.ContainsAny(name, ",= ") {
+		return nil, errors.Errorf("invalid listener name %q: it can't be empty or contain ',', '=' or spaces", name)
+	}
+	network := "tcp"
+	if unixPath, found := strings.CutPrefix(address, "unix:"); found {
+		network, address = "unix", unixPath
+	}
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if previous, found := s.listeners[name]; found {
+		_ = previous.Close()
+		delete(s.listeners, name)
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on %s %q", network, address)
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[string]net.Listener)
+	}
+	s.listeners[name] = listener
+	klog.V(1).Infof("Listening on %s %s as %q", network, listener.Addr(), name)
+	return &ListenerInfo{Name: name, Network: network, Address: listener.Addr().String()}, nil
+}
+
+// CloseListener closes the listening socket created with State.Listen.
+func (s *State) CloseListener(name string) error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	listener, found := s.listeners[name]
+	if !found {
+		return errors.Errorf("no listener named %q, see `%%listen`", name)
+	}
+	delete(s.listeners, name)
+	return errors.Wrapf(listener.Close(), "failed to close listener %q", name)
+}
+
+// Listeners returns the listening sockets created with State.Listen, sorted by name.
+func (s *State) Listeners() []ListenerInfo {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	infos := make([]ListenerInfo, 0, len(s.listeners))
+	for _, name := range SortedKeys(s.listeners) {
+		addr := s.listeners[name].Addr()
+		infos = append(infos, ListenerInfo{Name: name, Network: addr.Network(), Address: addr.String()})
+	}
+	return infos
+}
+
+// closeListeners closes all listening sockets, when the kernel stops.
+func (s *State) closeListeners() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	for name, listener := range s.listeners {
+		if err := listener.Close(); err != nil {
+			klog.Warningf("Failed to close listener %q: %v", name, err)
+		}
+	}
+	s.listeners = nil
+}
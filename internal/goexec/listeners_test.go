@@ -0,0 +1,37 @@
+package goexec
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListeners(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	info, err := s.Listen("web", "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp", info.Network)
+	conn, err := net.Dial("tcp", info.Address)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	// Listening again with the same name replaces the listener.
+	info2, err := s.Listen("web", "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.Equal(t, []ListenerInfo{*info2}, s.Listeners())
+
+	_, err = s.Listen("a,b", "127.0.0.1:0")
+	require.Error(t, err)
+	_, err = s.Listen("bad", "not an address")
+	require.Error(t, err)
+
+	require.NoError(t, s.CloseListener("web"))
+	require.Error(t, s.CloseListener("web"))
+	assert.Empty(t, s.Listeners())
+	_, err = net.Dial("tcp", info2.Address)
+	require.Error(t, err)
+}
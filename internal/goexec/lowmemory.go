@@ -0,0 +1,29 @@
+package goexec
+
+import (
+	"github.com/janpfeifer/gonb/internal/goexec/goplsclient"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the on-demand start of `gopls`, used by `--low-memory` in Raspberry Pi-class machines,
+// where `gopls` may use more memory than the notebook programs.
+
+// GoplsOnDemand makes New not start `gopls`: instead, it is started the first time it is needed, for auto-complete
+// or contextual help. Set with `--low-memory`, before creating the State.
+var GoplsOnDemand bool
+
+// goplsOnDemand returns the current gopls client, to be used for a request that needs `gopls` running: it is
+// started if configured to start on demand (see goplsclient.Client.StartOnDemand). It returns nil if gopls is
+// not available.
+//
+// Changes to the settings don't need `gopls` running: they are sent to it when it starts.
+func (s *State) goplsOnDemand() *goplsclient.Client {
+	gopls := s.goplsClient()
+	if gopls == nil {
+		return nil
+	}
+	if err := gopls.StartOnDemand(); err != nil {
+		klog.Errorf("Failed to start `gopls`: %v", err)
+	}
+	return gopls
+}
@@ -0,0 +1,140 @@
+package goexec
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"strings"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/pkg/errors"
+)
+
+// This file implements the template of the `main` function composed for `%%` (and `%main`, `%exec`) cells -- the
+// preamble and epilogue around the code of the cell. It can be configured with a file (see MainTemplateEnv) or
+// with `%template`, to inject boilerplate (e.g. profiling, telemetry initialization) into every cell execution.
+
+// MainTemplateEnv is the environment variable with the path of the file holding the template of the `main`
+// function. If not set, `gonb/main_template.go` under the user's configuration directory is used, if it exists.
+const MainTemplateEnv = "GONB_MAIN_TEMPLATE"
+
+// MainTemplateCellMarker is the line of the template that is replaced by the code of the cell: the lines before
+// it are the preamble, and the lines after it are the epilogue of the `main` function.
+const MainTemplateCellMarker = "GONB_CELL"
+
+// DefaultMainTemplate is the template of the `main` function used if none is configured.
+const DefaultMainTemplate = "flag.Parse()\n" + MainTemplateCellMarker + "\n"
+
+// mainTemplate is a parsed template of the `main` function: the lines of its body before and after the cell,
+// indented.
+type mainTemplate struct {
+	text               string
+	preamble, epilogue []string
+}
+
+// parseMainTemplate parses and validates the template of the body of the `main` function: it must have exactly
+// one MainTemplateCellMarker line, and the remaining lines must be valid Go statements.
+func parseMainTemplate(text string) (*mainTemplate, error) {
+	tmpl := &mainTemplate{text: text}
+	foundMarker := false
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if strings.TrimSpace(line) == MainTemplateCellMarker {
+			if foundMarker {
+				return nil, errors.Errorf("main template has more than one %s line", MainTemplateCellMarker)
+			}
+			foundMarker = true
+			continue
+		}
+		if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "\t") {
+			line = "\t" + line
+		}
+		if foundMarker {
+			tmpl.epilogue = append(tmpl.epilogue, line)
+		} else {
+			tmpl.preamble = append(tmpl.preamble, line)
+		}
+	}
+	if !foundMarker {
+		return nil, errors.Errorf("main template has no %s line, where the code of the cell is inserted", MainTemplateCellMarker)
+	}
+	code := "package main\n\nfunc main() {\n" + strings.Join(tmpl.preamble, "\n") + "\n" +
+		strings.Join(tmpl.epilogue, "\n") + "\n}\n"
+	if _, err := parser.ParseFile(token.NewFileSet(), "", code, parser.SkipObjectResolution); err != nil {
+		return nil, errors.Wrap(err, "main template is not valid Go code")
+	}
+	return tmpl, nil
+}
+
+// usesCtx returns whether the preamble uses the `ctx` variable (see `gonbui.Ctx`) without declaring it, and
+// whether it declares it.
+func (tmpl *mainTemplate) usesCtx() (uses, declares bool) {
+	if mainDeclaresCtx(tmpl.preamble) {
+		return false, true
+	}
+	return cellUsesCtx(tmpl.preamble, nil, 0), false
+}
+
+// ConfiguredMainTemplate returns the template of the `main` function configured by the user, and its source:
+// the file given by $GONB_MAIN_TEMPLATE, or `gonb/main_template.go` under the user's configuration directory,
+// if it exists. Otherwise, it returns DefaultMainTemplate.
+func ConfiguredMainTemplate() (text, source string, err error) {
+	filePath := os.Getenv(MainTemplateEnv)
+	if filePath != "" {
+		filePath = ReplaceTildeInDir(filePath)
+	} else if configDir, err := os.UserConfigDir(); err == nil {
+		filePath = path.Join(configDir, "gonb", "main_template.go")
+		if _, err := os.Stat(filePath); err != nil {
+			filePath = ""
+		}
+	}
+	if filePath == "" {
+		return DefaultMainTemplate, "default", nil
+	}
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to read main template from %q", filePath)
+	}
+	return string(contents), filePath, nil
+}
+
+// SetMainTemplate sets the template of the `main` function composed for the following cells. See
+// MainTemplateCellMarker for its format.
+func (s *State) SetMainTemplate(text string) error {
+	tmpl, err := parseMainTemplate(text)
+	if err != nil {
+		return err
+	}
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.mainTemplate = tmpl
+	return nil
+}
+
+// MainTemplate returns the template of the `main` function currently used.
+func (s *State) MainTemplate() string {
+	return s.currentMainTemplate().text
+}
+
+// ResetMainTemplate sets the template of the `main` function back to the one configured by the user (see
+// ConfiguredMainTemplate), and returns its source.
+func (s *State) ResetMainTemplate() (source string, err error) {
+	text, source, err := ConfiguredMainTemplate()
+	if err != nil {
+		return "", err
+	}
+	if err = s.SetMainTemplate(text); err != nil {
+		return "", errors.WithMessagef(err, "in %q", source)
+	}
+	return source, nil
+}
+
+// currentMainTemplate returns the parsed template of the `main` function.
+func (s *State) currentMainTemplate() *mainTemplate {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.mainTemplate == nil {
+		s.mainTemplate, _ = parseMainTemplate(DefaultMainTemplate)
+	}
+	return s.mainTemplate
+}
@@ -0,0 +1,78 @@
+package goexec
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMainTemplate(t *testing.T) {
+	tmpl, err := parseMainTemplate(DefaultMainTemplate)
+	require.NoError(t, err)
+	require.Equal(t, []string{"\tflag.Parse()"}, tmpl.preamble)
+	require.Empty(t, tmpl.epilogue)
+
+	tmpl, err = parseMainTemplate("flag.Parse()\n\tdefer profile.Start().Stop()\nGONB_CELL\nfmt.Println(\"done\")\n")
+	require.NoError(t, err)
+	require.Equal(t, []string{"\tflag.Parse()", "\tdefer profile.Start().Stop()"}, tmpl.preamble)
+	require.Equal(t, []string{"\tfmt.Println(\"done\")"}, tmpl.epilogue)
+
+	_, err = parseMainTemplate("flag.Parse()\n")
+	require.ErrorContains(t, err, "no GONB_CELL")
+	_, err = parseMainTemplate("GONB_CELL\nGONB_CELL\n")
+	require.ErrorContains(t, err, "more than one")
+	_, err = parseMainTemplate("if true {\nGONB_CELL\n")
+	require.ErrorContains(t, err, "not valid Go")
+
+	tmpl, err = parseMainTemplate("tracer := startTracing(ctx)\nGONB_CELL\n")
+	require.NoError(t, err)
+	uses, declares := tmpl.usesCtx()
+	require.True(t, uses)
+	require.False(t, declares)
+	tmpl, err = parseMainTemplate("ctx := context.Background()\nGONB_CELL\n")
+	require.NoError(t, err)
+	uses, declares = tmpl.usesCtx()
+	require.False(t, uses)
+	require.True(t, declares)
+}
+
+func TestMainTemplate(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	require.NoError(t, s.SetMainTemplate("flag.Parse()\ndefer fmt.Println(\"bye\")\nGONB_CELL\nfmt.Println(\"done\")\n"))
+	require.Error(t, s.SetMainTemplate("flag.Parse()\n"))
+	require.Contains(t, s.MainTemplate(), "bye")
+
+	cellLines := strings.Split("%%\nfmt.Println(\"hello\")\n<-ctx.Done()", "\n")
+	_, fileToCellLines, err := s.createGoFileFromLines(s.CodePath(), 1, cellLines, MakeSet[int](), NoCursor)
+	require.NoError(t, err)
+	contentBytes, err := os.ReadFile(s.CodePath())
+	require.NoError(t, err)
+	fileLines := strings.Split(string(contentBytes), "\n")
+	require.Equal(t, []string{
+		"func main() {",
+		"\tflag.Parse()",
+		"\tdefer fmt.Println(\"bye\")",
+		strings.TrimSuffix(ctxDeclaration, "\n"),
+		"fmt.Println(\"hello\")",
+		"<-ctx.Done()",
+		"",
+		"\tfmt.Println(\"done\")",
+		"}",
+	}, fileLines[2:11])
+	// Template lines are attributed to the `%%` line.
+	require.Equal(t, []int{0, 0, 0, 0, 1, 2, -1, 0}, fileToCellLines[2:10])
+
+	t.Setenv(MainTemplateEnv, "/nonexistent/main_template.go")
+	_, err = s.ResetMainTemplate()
+	require.Error(t, err)
+	t.Setenv(MainTemplateEnv, "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	source, err := s.ResetMainTemplate()
+	require.NoError(t, err)
+	require.Equal(t, "default", source)
+	require.Equal(t, DefaultMainTemplate, s.MainTemplate())
+}
@@ -0,0 +1,140 @@
+package goexec
+
+import (
+	"fmt"
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/i18n"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"k8s.io/klog/v2"
+	"strings"
+)
+
+// This file handles methods whose type is redefined in a later cell: methods are memorized with the key
+// `<Type>~<Method>`, independent of the receiver being a pointer or a generic instantiation, so they are
+// automatically associated with the new definition of the type. Except if the new definition can't have
+// those methods, in which case they are dropped, and the user is informed.
+
+// receiverTypeName returns the name of the type of the receiver of a method, with the pointer (`*T`) and the
+// type parameters (`T[K, V]`) stripped, and the number of type parameters.
+func receiverTypeName(expr ast.Expr) (name string, numTypeParams int) {
+	for {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			return e.Name, numTypeParams
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			numTypeParams = 1
+			expr = e.X
+		case *ast.IndexListExpr:
+			numTypeParams = len(e.Indices)
+			expr = e.X
+		default:
+			return "unknown", 0
+		}
+	}
+}
+
+// methodConflict returns why a method (given by its definition) can't be associated with the type (given by its
+// definition, without the `type` keyword), or an empty string if there is no conflict.
+func methodConflict(typeDefinition, methodName, methodDefinition string) string {
+	fileSet := token.NewFileSet()
+	typeFile, err := parser.ParseFile(fileSet, "", "package p\ntype "+typeDefinition, parser.SkipObjectResolution)
+	if err != nil || len(typeFile.Decls) == 0 {
+		return ""
+	}
+	typeSpec := typeFile.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec)
+	if typeSpec.Assign.IsValid() {
+		// Aliases share the methods of the aliased type, nothing to check.
+		return ""
+	}
+	switch t := typeSpec.Type.(type) {
+	case *ast.InterfaceType:
+		return "it is now an interface"
+	case *ast.StarExpr:
+		return "it is now a pointer type"
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			for _, fieldName := range field.Names {
+				if fieldName.Name == methodName {
+					return fmt.Sprintf("it now has a field named %q", methodName)
+				}
+			}
+		}
+	}
+
+	funcFile, err := parser.ParseFile(fileSet, "", "package p\n"+methodDefinition, parser.SkipObjectResolution)
+	if err != nil || len(funcFile.Decls) == 0 {
+		return ""
+	}
+	funcDecl, ok := funcFile.Decls[0].(*ast.FuncDecl)
+	if !ok || funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 {
+		return ""
+	}
+	_, numReceiverTypeParams := receiverTypeName(funcDecl.Recv.List[0].Type)
+	if numTypeParams := typeSpec.TypeParams.NumFields(); numTypeParams != numReceiverTypeParams {
+		return fmt.Sprintf("it now has %d type parameter(s), and the method's receiver uses %d",
+			numTypeParams, numReceiverTypeParams)
+	}
+	return ""
+}
+
+// dropConflictingMethods removes from d the methods of the types redefined in newDecls, that can no longer
+// be associated with the new definition of their type. Methods also (re-)defined in newDecls are not touched.
+//
+// It returns a description of each method dropped.
+func (d *Declarations) dropConflictingMethods(newDecls *Declarations) (dropped []string) {
+	if len(newDecls.Types) == 0 {
+		return
+	}
+	for _, key := range SortedKeys(d.Functions) {
+		typeName, methodName, isMethod := strings.Cut(key, "~")
+		if !isMethod {
+			continue
+		}
+		typeDecl, redefined := newDecls.Types[typeName]
+		if !redefined {
+			continue
+		}
+		if _, found := newDecls.Functions[key]; found {
+			continue
+		}
+		funcDecl := d.Functions[key]
+		reason := methodConflict(typeDecl.TypeDefinition, methodName, funcDecl.Definition)
+		if reason == "" {
+			continue
+		}
+		delete(d.Functions, key)
+		description := fmt.Sprintf("method %s.%s", typeName, methodName)
+		if funcDecl.CellLines.Id != -1 {
+			description += fmt.Sprintf(" (from cell [%d])", funcDecl.CellLines.Id)
+		}
+		dropped = append(dropped, fmt.Sprintf("%s was dropped: type %s was redefined and %s", description, typeName, reason))
+	}
+	return
+}
+
+// reportDroppedMethods informs the user of the methods dropped by dropConflictingMethods.
+func reportDroppedMethods(msg kernel.Message, dropped []string) {
+	if len(dropped) == 0 {
+		return
+	}
+	klog.V(1).Infof("Dropped methods: %v", dropped)
+	if msg == nil {
+		return
+	}
+	var sb strings.Builder
+	for _, description := range dropped {
+		sb.WriteString(i18n.T(i18n.MsgWarning))
+		sb.WriteString(description)
+		sb.WriteString("\n")
+	}
+	if err := kernel.PublishWriteStream(msg, kernel.StreamStderr, sb.String()); err != nil {
+		klog.Errorf("Failed to publish dropped methods: %+v", err)
+	}
+}
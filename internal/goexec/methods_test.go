@@ -0,0 +1,61 @@
+package goexec
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+// parseCellForTest parses the cell and commits the updated declarations, as if the cell was executed.
+func parseCellForTest(t *testing.T, s *State, cellId int, code string) {
+	updatedDecls, _, _, _, err := s.parseLinesAndComposeMain(nil, cellId, strings.Split(code, "\n"), nil, NoCursor)
+	require.NoError(t, err)
+	s.Definitions = updatedDecls
+}
+
+func TestReceiverKeyMigration(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	parseCellForTest(t, s, 1, "type Pair[K comparable, V any] struct { Key K; Value V }\n\n"+
+		"func (p Pair[K, V]) String() string { return \"pair\" }\n\n"+
+		"type Point struct { X, Y int }")
+	require.Contains(t, s.Definitions.Functions, "Pair~String")
+	assert.Equal(t, "Pair", s.Definitions.Functions["Pair~String"].Receiver)
+	assert.Equal(t, "String", s.Definitions.Functions["Pair~String"].Name)
+
+	parseCellForTest(t, s, 2, "func (p Point) Norm() int { return p.X*p.X + p.Y*p.Y }\n\n"+
+		"func (p Point) Y2() int { return p.Y }")
+	require.Contains(t, s.Definitions.Functions, "Point~Norm")
+
+	// Changing the receiver to a pointer redefines the same method.
+	parseCellForTest(t, s, 3, "func (p *Point) Norm() int { return p.X*p.X + p.Y*p.Y }")
+	assert.Equal(t, 3, s.Definitions.Functions["Point~Norm"].CellLines.Id)
+	assert.Len(t, s.Definitions.Functions, 3)
+
+	// Redefining the type keeps its methods from previous cells.
+	parseCellForTest(t, s, 4, "type Point struct { X, Y, Z int }")
+	assert.Contains(t, s.Definitions.Functions, "Point~Norm")
+	assert.Contains(t, s.Definitions.Functions, "Point~Y2")
+
+	// Unless they conflict with the new definition.
+	parseCellForTest(t, s, 5, "type Point struct { X, Y2 int }")
+	assert.Contains(t, s.Definitions.Functions, "Point~Norm")
+	assert.NotContains(t, s.Definitions.Functions, "Point~Y2")
+	parseCellForTest(t, s, 6, "type Pair[K comparable] struct { Key K }")
+	assert.NotContains(t, s.Definitions.Functions, "Pair~String")
+	parseCellForTest(t, s, 7, "type Point interface { Norm() int }")
+	assert.NotContains(t, s.Definitions.Functions, "Point~Norm")
+}
+
+func TestMethodConflict(t *testing.T) {
+	method := "func (p *T) Name() string { return \"\" }"
+	assert.Empty(t, methodConflict("T struct { X int }", "Name", method))
+	assert.Empty(t, methodConflict("T = U", "Name", method))
+	assert.Contains(t, methodConflict("T struct { Name string }", "Name", method), "field")
+	assert.Contains(t, methodConflict("T interface{}", "Name", method), "interface")
+	assert.Contains(t, methodConflict("T *int", "Name", method), "pointer")
+	assert.Contains(t, methodConflict("T[X any] struct{}", "Name", method), "type parameter")
+	assert.Empty(t, methodConflict("T[X any] struct{}", "Name", "func (p *T[X]) Name() string { return \"\" }"))
+}
@@ -0,0 +1,142 @@
+package goexec
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// This file implements snapshots of `go.mod` and `go.sum` (`%modsnapshot`), so one can try different versions
+// of the dependencies and deterministically roll back.
+
+// ModSnapshotsDir is the subdirectory of the temporary directory where snapshots are stored.
+const ModSnapshotsDir = ".modsnapshots"
+
+// modSnapshotFiles are the files saved in a snapshot.
+var modSnapshotFiles = []string{"go.mod", "go.sum"}
+
+// ModSnapshot holds the metadata of a saved snapshot of `go.mod` and `go.sum`.
+type ModSnapshot struct {
+	Name    string    `json:"name"`
+	SavedAt time.Time `json:"saved_at"`
+	CellId  int       `json:"cell_id"` // Cell where the snapshot was saved.
+
+	// Requires lists the required modules as "path@version".
+	Requires []string `json:"requires"`
+}
+
+const modSnapshotMetadataFile = "metadata.json"
+
+func (s *State) modSnapshotDir(name string) (string, error) {
+	if !reValidWorkspaceName.MatchString(name) {
+		return "", errors.Errorf("invalid snapshot name %q: only letters, digits, '_' and '-' are allowed", name)
+	}
+	return path.Join(s.TempDir, ModSnapshotsDir, name), nil
+}
+
+// SaveModSnapshot saves the current `go.mod` and `go.sum` under the given name, overwriting any previous
+// snapshot with the same name.
+func (s *State) SaveModSnapshot(name string, cellId int) (*ModSnapshot, error) {
+	dir, err := s.modSnapshotDir(name)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.RemoveAll(dir); err != nil {
+		return nil, errors.Wrapf(err, "failed to remove previous snapshot %q", name)
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "failed to create directory for snapshot %q", name)
+	}
+	snapshot := &ModSnapshot{Name: name, SavedAt: time.Now(), CellId: cellId}
+	for _, fileName := range modSnapshotFiles {
+		contents, err := os.ReadFile(path.Join(s.TempDir, fileName))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // go.sum doesn't exist if there are no dependencies.
+			}
+			return nil, errors.Wrapf(err, "failed to read %q", fileName)
+		}
+		if err = os.WriteFile(path.Join(dir, fileName), contents, 0600); err != nil {
+			return nil, errors.Wrapf(err, "failed to save %q in snapshot %q", fileName, name)
+		}
+		if fileName == "go.mod" {
+			goMod, err := modfile.Parse(fileName, contents, nil)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse go.mod")
+			}
+			for _, req := range goMod.Require {
+				snapshot.Requires = append(snapshot.Requires, req.Mod.String())
+			}
+		}
+	}
+	metadata, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode metadata of snapshot %q", name)
+	}
+	if err = os.WriteFile(path.Join(dir, modSnapshotMetadataFile), metadata, 0600); err != nil {
+		return nil, errors.Wrapf(err, "failed to save metadata of snapshot %q", name)
+	}
+	return snapshot, nil
+}
+
+// RestoreModSnapshot restores `go.mod` and `go.sum` saved with SaveModSnapshot.
+func (s *State) RestoreModSnapshot(name string) error {
+	dir, err := s.modSnapshotDir(name)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(path.Join(dir, modSnapshotMetadataFile)); err != nil {
+		return errors.Errorf("snapshot %q not found, see `%%modsnapshot list`", name)
+	}
+	for _, fileName := range modSnapshotFiles {
+		dst := path.Join(s.TempDir, fileName)
+		contents, err := os.ReadFile(path.Join(dir, fileName))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return errors.Wrapf(err, "failed to read %q from snapshot %q", fileName, name)
+			}
+			// File was not present when the snapshot was taken.
+			if err = os.Remove(dst); err != nil && !os.IsNotExist(err) {
+				return errors.Wrapf(err, "failed to remove %q", dst)
+			}
+			continue
+		}
+		if err = os.WriteFile(dst, contents, 0600); err != nil {
+			return errors.Wrapf(err, "failed to restore %q", dst)
+		}
+	}
+	return nil
+}
+
+// ListModSnapshots returns the metadata of the saved snapshots, sorted by the time they were saved.
+func (s *State) ListModSnapshots() ([]*ModSnapshot, error) {
+	entries, err := os.ReadDir(path.Join(s.TempDir, ModSnapshotsDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to list snapshots")
+	}
+	var snapshots []*ModSnapshot
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		metadataPath := path.Join(s.TempDir, ModSnapshotsDir, entry.Name(), modSnapshotMetadataFile)
+		contents, err := os.ReadFile(metadataPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read metadata of snapshot %q", entry.Name())
+		}
+		snapshot := &ModSnapshot{}
+		if err = json.Unmarshal(contents, snapshot); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse metadata of snapshot %q", entry.Name())
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].SavedAt.Before(snapshots[j].SavedAt) })
+	return snapshots, nil
+}
@@ -0,0 +1,45 @@
+package goexec
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestModSnapshots(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	goModPath := path.Join(s.TempDir, "go.mod")
+	original, err := os.ReadFile(goModPath)
+	require.NoError(t, err)
+
+	_, err = s.SaveModSnapshot("base", 3)
+	require.NoError(t, err)
+	modified := string(original) + "\nrequire example.com/dep v1.2.3\n"
+	require.NoError(t, os.WriteFile(goModPath, []byte(modified), 0600))
+	require.NoError(t, os.WriteFile(path.Join(s.TempDir, "go.sum"), []byte("example.com/dep v1.2.3 h1:x\n"), 0600))
+	snapshot, err := s.SaveModSnapshot("dep", 4)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com/dep@v1.2.3"}, snapshot.Requires)
+
+	require.NoError(t, s.RestoreModSnapshot("base"))
+	contents, err := os.ReadFile(goModPath)
+	require.NoError(t, err)
+	assert.Equal(t, string(original), string(contents))
+	assert.NoFileExists(t, path.Join(s.TempDir, "go.sum"))
+
+	require.NoError(t, s.RestoreModSnapshot("dep"))
+	contents, err = os.ReadFile(goModPath)
+	require.NoError(t, err)
+	assert.Equal(t, modified, string(contents))
+	assert.FileExists(t, path.Join(s.TempDir, "go.sum"))
+
+	snapshots, err := s.ListModSnapshots()
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, "base", snapshots[0].Name)
+	assert.Equal(t, 3, snapshots[0].CellId)
+	require.Error(t, s.RestoreModSnapshot("missing"))
+}
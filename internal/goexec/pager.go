@@ -0,0 +1,43 @@
+package goexec
+
+import (
+	"strings"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/kernel"
+)
+
+// This file implements the support to the front-end pager, using the "page" payload of the `execute_reply`.
+
+// DefaultPagerLines is the default value of State.PagerLines.
+const DefaultPagerLines = 50
+
+// Page adds a "page" payload, which makes the front-end display the data (keyed by MIME type) in its
+// pager (or inline, for front-ends without one), instead of in the output of the cell.
+//
+// Notice the payload is only sent with the `execute_reply`, so it's displayed after the cell execution finishes.
+func (s *State) Page(data map[string]any) {
+	s.AddPayload(map[string]any{
+		"source": "page",
+		"data":   data,
+		"start":  0,
+	})
+}
+
+// ShouldPage returns whether the text is long enough to be sent to the pager. See PagerLines.
+func (s *State) ShouldPage(text string) bool {
+	return s.PagerLines > 0 && strings.Count(text, "\n") >= s.PagerLines
+}
+
+// PublishMarkdownOrPage publishes the Markdown content in the output of the cell, or sends it to the pager if it
+// is longer than PagerLines.
+func (s *State) PublishMarkdownOrPage(msg kernel.Message, markdown string) error {
+	if !s.ShouldPage(markdown) {
+		return kernel.PublishMarkdown(msg, markdown)
+	}
+	s.Page(map[string]any{
+		string(protocol.MIMETextMarkdown): markdown,
+		string(protocol.MIMETextPlain):    markdown,
+	})
+	return nil
+}
@@ -32,6 +32,9 @@ type parseInfo struct {
 	// cell. This is used when reporting back errors with a file number. Values of -1 (NoCursorLine) are injected Lines
 	// that have no correspondent value in the cell code.
 	fileToCellIdAndLine []CellIdAndLine
+
+	// importConflict is set if two imports of different packages have the same name.
+	importConflict error
 }
 
 // getCursor returns the cursor position within this declaration, if the original cursor falls in there.
@@ -69,11 +72,21 @@ func (pi *parseInfo) getCursor(node ast.Node) Cursor {
 	return NoCursor
 }
 
+// cellIdFromFile is used as the cellId in parseFromGoCode, when parsing code composed from declarations of
+// different cells: the cell id of each declaration is taken from fileToCellIdAndLine.
+const cellIdFromFile = -2
+
 // calculateCellLines returns the CellLines information for the corresponding ast.Node.
 func (pi *parseInfo) calculateCellLines(node ast.Node) (c CellLines) {
 	c.Id = pi.cellId
 	from, to := node.Pos(), node.End()
 	fromPos, toPos := pi.fileSet.Position(from), pi.fileSet.Position(to)
+	if pi.cellId == cellIdFromFile {
+		c.Id = NoCursorLine
+		if pi.fileToCellIdAndLine != nil {
+			c.Id = pi.fileToCellIdAndLine[fromPos.Line-1].Id
+		}
+	}
 	numLines := (toPos.Line - fromPos.Line) + 1
 	c.Lines = make([]int, 0, numLines)
 	for lineNum := fromPos.Line; lineNum <= toPos.Line; lineNum++ {
@@ -113,7 +126,7 @@ func (pi *parseInfo) extractContentOfNode(node ast.Node) string {
 // Parameters:
 //   - `msg`: connection to notebook, to report errors. If nil, errors are not reported.
 //   - `cellId`: execution id of the cell being processed. Set to -1 if later this cell will be discarded (for
-//     instance, when parsing for auto-complete).
+//     instance, when parsing for auto-complete), or to cellIdFromFile to take it from fileToCellIdAndLine.
 //   - `Cursor`: where it is in the file. If set (that is, `cursor != NoCursor`), it will record the position
 //     of the cursor in the corresponding declaration.
 //   - `fileToCellLine`: for each line in the `main.go` file, the corresponding line number in the cell. This
@@ -197,23 +210,21 @@ func (s *State) parseFromGoCode(msg kernel.Message,
 			}
 		}
 	}
+	if pi.importConflict != nil {
+		err = pi.importConflict
+	}
 	return
 }
 
 // NewImport from the importPath and it's alias. If alias is empty or "<nil>", it will default to the
-// last name part of the importPath.
+// last name part of the importPath (skipping the major version, e.g. "/v2").
 func NewImport(importPath, alias string) *Import {
 	key := alias
 	if key == "" {
-		parts := reDefaultImportPathAlias.FindStringSubmatch(importPath)
-		if len(parts) < 2 {
-			key = importPath
-		} else {
-			key = parts[1]
-		}
-	} else if key == "." {
-		// More than one import can be moved to the current namespace.
-		key = ".~" + importPath
+		key = defaultImportName(importPath)
+	} else if key == "." || key == "_" {
+		// More than one import can be moved to the current namespace, or imported only for its side effects.
+		key = key + "~" + importPath
 	}
 	return &Import{Key: key, Path: importPath, Alias: alias}
 }
@@ -239,6 +250,10 @@ func (pi *parseInfo) ParseImportEntry(decls *Declarations, entry *ast.ImportSpec
 			importEntry.Cursor = c
 		}
 	}
+	if previous, found := decls.Imports[importEntry.Key]; found && previous.Path != importEntry.Path &&
+		pi.importConflict == nil {
+		pi.importConflict = duplicateImportError(previous, importEntry)
+	}
 	decls.Imports[importEntry.Key] = importEntry
 }
 
@@ -246,18 +261,15 @@ func (pi *parseInfo) ParseImportEntry(decls *Declarations, entry *ast.ImportSpec
 func (pi *parseInfo) ParseFuncEntry(decls *Declarations, funcDecl *ast.FuncDecl) {
 	// Incorporate functions.
 	key := funcDecl.Name.Name
+	var receiver string
 	if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
-		typeName := "unknown"
-		switch fieldType := funcDecl.Recv.List[0].Type.(type) {
-		case *ast.Ident:
-			typeName = fieldType.Name
-		case *ast.StarExpr:
-			typeName = pi.extractContentOfNode(fieldType.X)
-		}
-		key = fmt.Sprintf("%s~%s", typeName, key)
+		receiver, _ = receiverTypeName(funcDecl.Recv.List[0].Type)
+		key = fmt.Sprintf("%s~%s", receiver, key)
 	}
 	f := &Function{
 		Key:        key,
+		Name:       funcDecl.Name.Name,
+		Receiver:   receiver,
 		Definition: pi.extractContentOfNode(funcDecl),
 		Comments:   pi.ParseComments(funcDecl.Doc),
 	}
@@ -492,10 +504,21 @@ func (s *State) parseLinesAndComposeMain(
 	// declarations until they compile successfully.
 	updatedDecls = s.Definitions.Copy()
 	updatedDecls.ClearCursor()
+	if err = updatedDecls.checkImportConflicts(newDecls); err != nil {
+		return
+	}
+	reportDroppedMethods(msg, updatedDecls.dropConflictingMethods(newDecls))
 	updatedDecls.MergeFrom(newDecls)
 	if s.CellIsWasm {
 		s.ExportWasmConstants(updatedDecls)
 	}
+	if fnName := cellExecFunction(lines); fnName != "" && hasMain {
+		// `%exec` of a function with parameters or results: generate the wrapper `main`.
+		mainDecl, err = execMainFunction(updatedDecls, fnName, mainDecl)
+		if err != nil {
+			return
+		}
+	}
 
 	// Render declarations to main.go.
 	cursorInFile, fileToCellIdAndLine, err = s.createCodeFileFromDecls(updatedDecls, mainDecl)
@@ -0,0 +1,224 @@
+package goexec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements `%persist`: the values of the persisted variables are saved (gob-encoded) when the cell
+// program exits, and the following cells initialize the variables with the saved values, instead of their
+// original definitions. This carries the values of the variables over from one cell to the next.
+
+// PersistedVariable describes a variable persisted with State.PersistVariable.
+type PersistedVariable struct {
+	Name string
+
+	// Type of the variable: its declared type, or the type of the value saved, if not declared.
+	// It is empty if not known yet.
+	Type string
+
+	// Size of the saved value, or -1 if no value was saved yet.
+	Size int64
+}
+
+const (
+	// persistLoadFunc and persistSaveFunc are the functions injected in the composed program to load and save
+	// the values of the persisted variables.
+	persistLoadFunc = "gonbPersistLoad"
+	persistSaveFunc = "gonbPersistSave"
+)
+
+// persistDir is the directory where the values of the persisted variables are saved.
+func (s *State) persistDir() string {
+	return filepath.Join(s.TempDir, "persist")
+}
+
+// PersistVariable marks the memorized variable name to be persisted: its value is saved at the exit of the
+// following cell programs, and reloaded by the ones after them.
+func (s *State) PersistVariable(name string) error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	varDecl, found := s.Definitions.Variables[name]
+	if !found {
+		return errors.Errorf("variable %q not declared: only memorized global variables can be persisted", name)
+	}
+	if len(varDecl.TupleDefinitions) > 1 {
+		return errors.Errorf("variable %q is declared in a tuple (e.g. `var a, b = f()`), which can't be persisted", name)
+	}
+	if err := os.MkdirAll(s.persistDir(), 0700); err != nil {
+		return errors.Wrapf(err, "failed to create directory to persist variables")
+	}
+	if s.persistedVars == nil {
+		s.persistedVars = MakeSet[string]()
+	}
+	s.persistedVars.Insert(name)
+	return nil
+}
+
+// UnpersistVariable stops persisting the variable name, and removes its saved value: the following cells
+// initialize it with its original definition.
+func (s *State) UnpersistVariable(name string) error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if !s.persistedVars.Has(name) {
+		return errors.Errorf("variable %q is not persisted", name)
+	}
+	s.persistedVars.Delete(name)
+	for _, ext := range []string{".gob", ".type"} {
+		if err := os.Remove(filepath.Join(s.persistDir(), name+ext)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to remove saved value of %q", name)
+		}
+	}
+	return nil
+}
+
+// PersistedVariables returns the persisted variables, sorted by name.
+func (s *State) PersistedVariables() []PersistedVariable {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	vars := make([]PersistedVariable, 0, len(s.persistedVars))
+	for _, name := range SortedKeys(s.persistedVars) {
+		v := PersistedVariable{Name: name, Size: -1}
+		if info, err := os.Stat(filepath.Join(s.persistDir(), name+".gob")); err == nil {
+			v.Size = info.Size()
+		}
+		if varDecl, found := s.Definitions.Variables[name]; found {
+			v.Type = s.persistedVariableType(varDecl)
+		}
+		vars = append(vars, v)
+	}
+	return vars
+}
+
+// regexpMainPackage matches the qualifier of the types of the main package, as printed by `%T`.
+var regexpMainPackage = regexp.MustCompile(`\bmain\.`)
+
+// persistedVariableType returns the type of the persisted variable: the declared type, if given, otherwise the
+// type of the saved value. It returns an empty string if the type is not known.
+func (s *State) persistedVariableType(varDecl *Variable) string {
+	if varDecl.TypeDefinition != "" {
+		return varDecl.TypeDefinition
+	}
+	typeName, err := os.ReadFile(filepath.Join(s.persistDir(), varDecl.Name+".type"))
+	if err != nil {
+		return ""
+	}
+	// Types declared in the notebook are in the package main of the program.
+	return regexpMainPackage.ReplaceAllString(strings.TrimSpace(string(typeName)), "")
+}
+
+// persistLoadTemplate and persistSaveTemplate are the code of the functions injected to load and save the
+// persisted variables. GONB_PERSIST_DIR is replaced by the quoted directory, and GONB_PERSIST_SAVES by the calls
+// to save each variable.
+const persistLoadTemplate = `func gonbPersistLoad[T any](name string) (value T) {
+	f, err := os.Open(filepath.Join(GONB_PERSIST_DIR, name+".gob"))
+	if err == nil {
+		err = gob.NewDecoder(f).Decode(&value)
+		_ = f.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%%persist: failed to load the value of %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return
+}`
+
+const persistSaveTemplate = `func gonbPersistSave() {
+	save := func(name string, value any) {
+		filePath := filepath.Join(GONB_PERSIST_DIR, name+".gob")
+		f, err := os.Create(filePath + ".tmp")
+		if err == nil {
+			err = gob.NewEncoder(f).Encode(value)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err == nil {
+			err = os.Rename(filePath+".tmp", filePath)
+		}
+		if err == nil {
+			err = os.WriteFile(filepath.Join(GONB_PERSIST_DIR, name+".type"), []byte(fmt.Sprintf("%T", value)), 0600)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%%persist: failed to save the value of %s: %v\n", name, err)
+		}
+	}
+GONB_PERSIST_SAVES}`
+
+// injectPersistedVariables changes the declarations to be composed, so the persisted variables are saved when
+// the program exits (at the end of mainDecl, which is returned modified), and the ones with a saved value are
+// initialized with it, except if they are declared by the cell being executed (cellId).
+//
+// It returns the function that reverts the changes in the declarations, to be called before they are memorized,
+// or nil if no changes were made.
+func (s *State) injectPersistedVariables(decls *Declarations, mainDecl *Function, cellId int) (
+	*Function, func(decls *Declarations)) {
+	s.stateMu.Lock()
+	persisted := SortedKeys(s.persistedVars)
+	s.stateMu.Unlock()
+	if len(persisted) == 0 || s.CellIsTest || s.CellIsWasm {
+		return mainDecl, nil
+	}
+
+	originals := make(map[string]*Variable)
+	var saves strings.Builder
+	for _, name := range persisted {
+		varDecl, found := decls.Variables[name]
+		if !found || len(varDecl.TupleDefinitions) > 1 {
+			continue
+		}
+		_, _ = fmt.Fprintf(&saves, "\tsave(%q, %s)\n", name, name)
+		if varDecl.CellLines.Id == cellId {
+			// Declared by the current cell: it's initialized with its (possibly new) definition.
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(s.persistDir(), name+".gob")); err != nil {
+			continue
+		}
+		typeName := s.persistedVariableType(varDecl)
+		if typeName == "" {
+			klog.Warningf("%%persist: type of variable %q unknown, it won't be loaded", name)
+			continue
+		}
+		loaded := *varDecl
+		loaded.TupleDefinitions = nil
+		loaded.ValueDefinition = fmt.Sprintf("%s[%s](%q)", persistLoadFunc, typeName, name)
+		originals[name] = varDecl
+		decls.Variables[name] = &loaded
+	}
+	if saves.Len() == 0 {
+		return mainDecl, nil
+	}
+
+	dir := strconv.Quote(s.persistDir())
+	loadCode := strings.ReplaceAll(persistLoadTemplate, "GONB_PERSIST_DIR", dir)
+	saveCode := strings.ReplaceAll(persistSaveTemplate, "GONB_PERSIST_DIR", dir)
+	saveCode = strings.Replace(saveCode, "GONB_PERSIST_SAVES", saves.String(), 1)
+	decls.Functions[persistLoadFunc] = &Function{Cursor: NoCursor, Key: persistLoadFunc, Name: persistLoadFunc, Definition: loadCode}
+	decls.Functions[persistSaveFunc] = &Function{Cursor: NoCursor, Key: persistSaveFunc, Name: persistSaveFunc, Definition: saveCode}
+
+	// Save the values when main returns: the deferred call is inserted in the first line of its body, so the
+	// lines of the cell are preserved.
+	if bodyStart := strings.Index(mainDecl.Definition, "{"); bodyStart >= 0 {
+		mainCopy := *mainDecl
+		mainCopy.Definition = mainDecl.Definition[:bodyStart+1] + " defer " + persistSaveFunc + "();" +
+			mainDecl.Definition[bodyStart+1:]
+		mainDecl = &mainCopy
+	}
+
+	return mainDecl, func(decls *Declarations) {
+		delete(decls.Functions, persistLoadFunc)
+		delete(decls.Functions, persistSaveFunc)
+		for name, original := range originals {
+			decls.Variables[name] = original
+		}
+	}
+}
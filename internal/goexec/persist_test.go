@@ -0,0 +1,77 @@
+package goexec
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runWithPersistedVariables composes the cell with the memorized declarations and the persisted variables,
+// runs it and returns its combined output.
+func runWithPersistedVariables(t *testing.T, s *State, cellId int, cell string) string {
+	decls, mainDecl, _, _, err := s.parseLinesAndComposeMain(nil, cellId, strings.Split(cell, "\n"), MakeSet[int](), NoCursor)
+	require.NoError(t, err)
+	mainDecl, restore := s.injectPersistedVariables(decls, mainDecl, cellId)
+	require.NotNil(t, restore)
+	var sb strings.Builder
+	_, _, err = s.createCodeFromDecls(&sb, decls, mainDecl)
+	require.NoError(t, err)
+	code := strings.Replace(sb.String(), "package main\n",
+		"package main\n\nimport (\n\t\"encoding/gob\"\n\t\"fmt\"\n\t\"os\"\n\t\"path/filepath\"\n)\n", 1)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "main.go"), []byte(code), 0600))
+	cmd := exec.Command("go", "run", "main.go")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO111MODULE=off")
+	output, err := cmd.CombinedOutput()
+	require.NoErrorf(t, err, "output: %s\ncode:\n%s", output, code)
+
+	// Reverting the changes restores the memorized declarations.
+	restore(decls)
+	assert.NotContains(t, decls.Functions, persistSaveFunc)
+	for _, varDecl := range decls.Variables {
+		assert.NotContains(t, varDecl.ValueDefinition, persistLoadFunc)
+	}
+	return string(output)
+}
+
+func TestPersistVariables(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	require.NoError(t, s.MemorizeCell(nil, 1, strings.Split(
+		"type Point struct{ X, Y int }\n\nvar points []Point\n\nvar total = 1\n\nvar a, b = func() (int, int) { return 1, 2 }()", "\n"), MakeSet[int]()))
+	require.Error(t, s.PersistVariable("missing"))
+	require.Error(t, s.PersistVariable("a"))
+	require.NoError(t, s.PersistVariable("points"))
+	require.NoError(t, s.PersistVariable("total"))
+	assert.Equal(t, []PersistedVariable{{Name: "points", Type: "[]Point", Size: -1}, {Name: "total", Size: -1}},
+		s.PersistedVariables())
+
+	// First execution: variables initialized with their definitions, and saved at exit.
+	output := runWithPersistedVariables(t, s, 2,
+		"func main() {\n\tpoints = append(points, Point{1, 2})\n\ttotal += 10\n\tfmt.Println(points, total)\n}")
+	assert.Equal(t, "[{1 2}] 11\n", output)
+	vars := s.PersistedVariables()
+	require.Len(t, vars, 2)
+	assert.Greater(t, vars[0].Size, int64(0))
+	assert.Equal(t, "int", vars[1].Type)
+
+	// Following executions start with the saved values.
+	output = runWithPersistedVariables(t, s, 3,
+		"func main() {\n\tpoints = append(points, Point{3, 4})\n\ttotal += 10\n\tfmt.Println(points, total)\n}")
+	assert.Equal(t, "[{1 2} {3 4}] 21\n", output)
+
+	// Variables redeclared by the cell are initialized with the new definition.
+	output = runWithPersistedVariables(t, s, 4, "var total = 100\n\nfunc main() {\n\tfmt.Println(points, total)\n}")
+	assert.Equal(t, "[{1 2} {3 4}] 100\n", output)
+
+	require.NoError(t, s.UnpersistVariable("points"))
+	require.Error(t, s.UnpersistVariable("points"))
+	assert.Len(t, s.PersistedVariables(), 1)
+}
@@ -0,0 +1,293 @@
+package goexec
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the support for private modules (`%private`): the configuration of GOPRIVATE and
+// GONOSUMDB, the diagnostics of the git credentials (ssh-agent, netrc, credential helpers) available in the
+// kernel environment, and actionable notes when `go get` of a private module fails.
+
+// PrivateCheckTimeout is the maximum time for each of the commands run by PrivateModuleChecks (e.g.: `git ls-remote`).
+var PrivateCheckTimeout = 20 * time.Second
+
+// AddPrivateModules adds the module path patterns (e.g. `github.com/mycorp/*`) to GOPRIVATE and GONOSUMDB, so
+// `go` fetches them directly from their repository, without the public proxy and checksum database.
+// They are set in the kernel environment, used by all `go` commands executed afterward.
+//
+// It returns the resulting GOPRIVATE.
+func AddPrivateModules(patterns []string) (string, error) {
+	for _, pattern := range patterns {
+		if pattern == "" || strings.ContainsAny(pattern, ", \t") {
+			return "", errors.Errorf("invalid module path pattern %q", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return "", errors.Wrapf(err, "invalid module path pattern %q", pattern)
+		}
+	}
+	var goPrivate string
+	for _, key := range []string{"GOPRIVATE", "GONOSUMDB"} {
+		value := mergeGoEnvList(GoEnv(key), patterns)
+		if err := os.Setenv(key, value); err != nil {
+			return "", errors.Wrapf(err, "failed to set %s", key)
+		}
+		if key == "GOPRIVATE" {
+			goPrivate = value
+		}
+	}
+	return goPrivate, nil
+}
+
+// mergeGoEnvList adds the patterns to a comma-separated list of patterns (as in GOPRIVATE), skipping duplicates.
+func mergeGoEnvList(list string, patterns []string) string {
+	var values []string
+	seen := make(map[string]bool)
+	for _, value := range append(strings.Split(list, ","), patterns...) {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		values = append(values, value)
+	}
+	return strings.Join(values, ",")
+}
+
+// GoEnv returns the value of the `go env` variable key, or the environment variable, if `go` fails.
+func GoEnv(key string) string {
+	output, err := exec.Command("go", "env", key).Output()
+	if err != nil {
+		return os.Getenv(key)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// PrivateCheck is the result of one of the checks of PrivateModuleChecks.
+type PrivateCheck struct {
+	Name string
+
+	// OK is false if the check failed: Fix describes how to fix it.
+	OK bool
+
+	Detail, Fix string
+}
+
+// PrivateModuleChecks verifies, from inside the kernel environment, the configuration needed to fetch the
+// private modules matching pattern (e.g. `github.com/mycorp/*` or `github.com/mycorp/repo`): GOPRIVATE, and
+// the git credentials (ssh-agent, netrc or credential helper) for its host.
+// If pattern is a repository (no wildcards), access to it is tested with `git ls-remote`.
+func PrivateModuleChecks(pattern string) []PrivateCheck {
+	var checks []PrivateCheck
+	host, _, _ := strings.Cut(pattern, "/")
+
+	// GOPRIVATE
+	goPrivate := GoEnv("GOPRIVATE")
+	check := PrivateCheck{Name: "GOPRIVATE", Detail: fmt.Sprintf("%q", goPrivate)}
+	check.OK = matchesGoEnvList(goPrivate, pattern)
+	if !check.OK {
+		check.Fix = fmt.Sprintf("run `%%private %s`", pattern)
+	}
+	checks = append(checks, check)
+
+	// ssh-agent
+	check = PrivateCheck{Name: "ssh-agent"}
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		check.Detail = "SSH_AUTH_SOCK not set in the kernel environment"
+		check.Fix = "start Jupyter from a shell with a running ssh-agent (or set SSH_AUTH_SOCK with `%env`), " +
+			"if the repositories are fetched with ssh"
+	} else {
+		output, err := privateCheckCommand("ssh-add", "-l")
+		check.OK = err == nil
+		check.Detail = firstLine(output)
+		if !check.OK {
+			check.Fix = "add your key to the agent with `ssh-add`"
+		}
+	}
+	checks = append(checks, check)
+
+	// git URL rewrites, e.g. `url."git@github.com:".insteadOf "https://github.com/"`.
+	check = PrivateCheck{Name: "git URL rewrites", OK: true}
+	output, _ := privateCheckCommand("git", "config", "--global", "--get-regexp", `^url\..*\.insteadof$`)
+	for _, line := range strings.Split(output, "\n") {
+		if host != "" && strings.Contains(line, host) {
+			check.Detail = redactURLCredentials(strings.TrimSpace(line))
+			break
+		}
+	}
+	if check.Detail == "" {
+		check.Detail = fmt.Sprintf("none for %s: `go` uses https", host)
+	}
+	checks = append(checks, check)
+
+	// netrc and git credential helper: either works for https.
+	netrcPath := os.Getenv("NETRC")
+	if netrcPath == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			netrcPath = path.Join(home, ".netrc")
+		}
+	}
+	check = PrivateCheck{Name: "netrc"}
+	if found, err := netrcHasMachine(netrcPath, host); err != nil {
+		check.Detail = err.Error()
+	} else if !found {
+		check.Detail = fmt.Sprintf("no `machine %s` in %q", host, netrcPath)
+	} else {
+		check.OK = true
+		check.Detail = fmt.Sprintf("`machine %s` found in %q", host, netrcPath)
+		if info, err := os.Stat(netrcPath); err == nil && info.Mode().Perm()&0077 != 0 {
+			check.OK = false
+			check.Fix = fmt.Sprintf("restrict its permissions with `!chmod 600 %s`", netrcPath)
+		}
+	}
+	helper, _ := privateCheckCommand("git", "config", "--get", "credential.helper")
+	helperCheck := PrivateCheck{Name: "git credential helper", OK: helper != "", Detail: firstLine(helper)}
+	if !check.OK && !helperCheck.OK && check.Fix == "" {
+		check.Fix = fmt.Sprintf("for https, add `machine %s login <user> password <token>` to %q, or configure a "+
+			"git credential helper", host, netrcPath)
+	}
+	if helperCheck.Detail == "" {
+		helperCheck.Detail = "none configured"
+	}
+	checks = append(checks, check, helperCheck)
+
+	// Access to the repository.
+	if !strings.ContainsAny(pattern, "*?[") && strings.Count(pattern, "/") >= 2 {
+		check = PrivateCheck{Name: "git ls-remote"}
+		output, err := privateCheckCommand("git", "ls-remote", "https://"+pattern, "HEAD")
+		check.OK = err == nil
+		if check.OK {
+			check.Detail = fmt.Sprintf("https://%s accessible", pattern)
+		} else {
+			check.Detail = firstLine(output)
+			check.Fix = "fix the credentials above: git must access the repository without prompting for a password"
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// privateCheckCommand runs the command, with a PrivateCheckTimeout and without terminal prompts, and returns
+// its trimmed combined output.
+func privateCheckCommand(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), PrivateCheckTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	output, err := cmd.CombinedOutput()
+	// The output is not logged: it may hold credentials (e.g. the tokens in the git URL rewrites).
+	klog.V(2).Infof("%s: err=%v, %d bytes of output", cmd, err, len(output))
+	if err != nil && len(output) == 0 {
+		output = []byte(err.Error())
+	}
+	return strings.TrimSpace(redactURLCredentials(string(output))), err
+}
+
+// regexpURLCredentials matches the user information (`<user>:<token>@`) of URLs.
+var regexpURLCredentials = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/@\s]+@`)
+
+// redactURLCredentials replaces the user information of the URLs in s (e.g. `https://<user>:<token>@github.com/`)
+// by `***`, so they can be displayed and logged.
+func redactURLCredentials(s string) string {
+	return regexpURLCredentials.ReplaceAllString(s, "${1}***@")
+}
+
+// matchesGoEnvList returns whether the module path pattern is matched by one of the patterns of the comma-separated
+// list (as in GOPRIVATE): patterns match path prefixes, as documented in `go help private`.
+func matchesGoEnvList(list, pattern string) bool {
+	patternElems := strings.Split(pattern, "/")
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if value == pattern {
+			return true
+		}
+		valueElems := strings.Split(value, "/")
+		if len(valueElems) > len(patternElems) {
+			continue
+		}
+		matched := true
+		for ii, valueElem := range valueElems {
+			if ok, err := path.Match(valueElem, patternElems[ii]); err != nil || !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// netrcHasMachine returns whether the netrc file has a `machine` entry for host.
+func netrcHasMachine(netrcPath, host string) (bool, error) {
+	f, err := os.Open(netrcPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to read %q", netrcPath)
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	scanner.Split(bufio.ScanWords)
+	var previous string
+	for scanner.Scan() {
+		word := scanner.Text()
+		if previous == "machine" && word == host {
+			return true, nil
+		}
+		previous = word
+	}
+	return false, nil
+}
+
+// firstLine returns the first line of text.
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
+
+var (
+	// regexpGoGetPrivateFailure matches errors of `go get` when fetching a private module fails.
+	regexpGoGetPrivateFailure = regexp.MustCompile(
+		`terminal prompts disabled|could not read Username|Permission denied \(publickey\)|` +
+			`verifying module: .*: reading https://sum\.golang\.org|410 Gone|Repository not found|` +
+			`repository .* not found|Authentication failed`)
+
+	// regexpGoGetModule matches the module whose fetching failed in the output of `go get`.
+	regexpGoGetModule = regexp.MustCompile(`(?m)(?:^go: |reading |module |get ")((?:[\w.-]+\.[a-z]+)/[\w./-]+?)(?:@|: |"|$)`)
+)
+
+// privateModuleNote returns a note explaining how to fetch a private module, if the output of a `go` command
+// shows that fetching one failed, or an empty string otherwise.
+func privateModuleNote(output string) string {
+	if !regexpGoGetPrivateFailure.MatchString(output) {
+		return ""
+	}
+	pattern := "<host>/<org>/*"
+	if match := regexpGoGetModule.FindStringSubmatch(output); match != nil {
+		parts := strings.Split(match[1], "/")
+		if len(parts) >= 2 {
+			pattern = parts[0] + "/" + parts[1] + "/*"
+		}
+	}
+	return fmt.Sprintf(`---------------
+Note: this looks like a failure to fetch a private module. Try:
+  %%private %s
+It configures GOPRIVATE and GONOSUMDB, and checks the git credentials (ssh-agent, netrc) available to the kernel.
+`, pattern)
+}
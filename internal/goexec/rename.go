@@ -0,0 +1,293 @@
+package goexec
+
+import (
+	"cmp"
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf16"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/pkg/errors"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"k8s.io/klog/v2"
+)
+
+// This file implements `%rename`: it renames a memorized declaration (and all its uses) with `gopls`, on the
+// code composed from all memorized declarations, and maps the edits back to the memorized declarations.
+// Cells in the notebook are not changed: the user is informed of which cells (and lines) should be updated.
+
+// renderedInitKeyPrefix is prepended to the keys of the `init_*` functions when composing the code to rename,
+// so they are rendered with their original names (and not as `func init()`), and can be parsed back.
+const renderedInitKeyPrefix = "~"
+
+// RenameResult is returned by State.Rename.
+type RenameResult struct {
+	OldName, NewName string
+
+	// NumEdits is the number of places renamed in the memorized declarations.
+	NumEdits int
+
+	// Cells where the renamed declarations were defined, sorted by cell id.
+	Cells []RenamedCell
+
+	// IgnoredFiles are files other than the memorized declarations (e.g.: tracked directories) that
+	// `gopls` wanted to edit: they are not changed.
+	IgnoredFiles []string
+}
+
+// RenamedCell holds the lines of a cell changed by State.Rename.
+type RenamedCell struct {
+	// Id of the cell (its execution count).
+	Id int
+
+	// Lines maps the line number in the cell (0-based) to its renamed contents, as rendered in the composed code:
+	// it may differ slightly from the cell (e.g.: variables are rendered in a `var (...)` block).
+	Lines map[int]string
+}
+
+// Rename the memorized declaration oldName to newName, updating also all its uses in the memorized
+// declarations. Methods, struct fields and interface methods are given as `<Type>.<Name>`.
+//
+// It requires `gopls`.
+func (s *State) Rename(oldName, newName string) (*RenameResult, error) {
+	if !token.IsIdentifier(newName) {
+		return nil, errors.Errorf("%q is not a valid Go identifier", newName)
+	}
+	gopls := s.goplsOnDemand()
+	if gopls == nil {
+		return nil, errors.New("renaming requires `gopls`, see `%doctor`")
+	}
+
+	s.composeMu.Lock()
+	defer s.composeMu.Unlock()
+	s.stateMu.Lock()
+	decls := s.Definitions.Copy()
+	s.stateMu.Unlock()
+
+	content, fileToCellIdAndLine, err := s.composeForRename(decls)
+	if err != nil {
+		return nil, err
+	}
+	line, col, err := findDeclaredIdent(content, oldName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if err = s.notifyAboutStandardAndTrackedFiles(ctx); err != nil {
+		return nil, errors.WithMessagef(err, "failed to notify gopls of the files to rename %q", oldName)
+	}
+	lineContent := strings.Split(content, "\n")[line]
+	workspaceEdit, err := gopls.CallRename(ctx, s.CodePath(), line, byteToUTF16Col(lineContent, col), newName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only edits to the memorized declarations are applied.
+	codeURI := uri.File(s.CodePath())
+	var edits []lsp.TextEdit
+	ignoredFiles := MakeSet[string]()
+	addEdits := func(fileURI lsp.DocumentURI, fileEdits []lsp.TextEdit) {
+		if fileURI == codeURI {
+			edits = append(edits, fileEdits...)
+		} else if len(fileEdits) > 0 {
+			ignoredFiles.Insert(fileURI.Filename())
+		}
+	}
+	for fileURI, fileEdits := range workspaceEdit.Changes {
+		addEdits(fileURI, fileEdits)
+	}
+	for _, documentEdit := range workspaceEdit.DocumentChanges {
+		addEdits(documentEdit.TextDocument.URI, documentEdit.Edits)
+	}
+	klog.V(1).Infof("Rename %q to %q: %d edits, %d ignored files", oldName, newName, len(edits), len(ignoredFiles))
+
+	result := &RenameResult{
+		OldName:      oldName,
+		NewName:      newName,
+		NumEdits:     len(edits),
+		IgnoredFiles: SortedKeys(ignoredFiles),
+	}
+	result.Cells, err = s.applyRenameEdits(decls, content, edits, fileToCellIdAndLine)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// composeForRename writes `main.go` with decls, keeping the names of the `init_*` functions, and returns its
+// contents and the mapping of its lines to cells.
+func (s *State) composeForRename(decls *Declarations) (content string, fileToCellIdAndLine []CellIdAndLine, err error) {
+	renderDecls := decls.Copy()
+	renderDecls.InitOrder = nil
+	for _, key := range SortedKeys(renderDecls.Functions) {
+		if strings.HasPrefix(key, InitFunctionPrefix) {
+			renderDecls.Functions[renderedInitKeyPrefix+key] = renderDecls.Functions[key]
+			delete(renderDecls.Functions, key)
+		}
+	}
+	_, fileToCellIdAndLine, err = s.createCodeFileFromDecls(renderDecls, nil)
+	if err != nil {
+		return
+	}
+	contentBytes, err := os.ReadFile(s.CodePath())
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read %q", s.CodePath())
+		return
+	}
+	return string(contentBytes), fileToCellIdAndLine, nil
+}
+
+// applyRenameEdits applies the edits (from `gopls`) to content, the code composed from decls (with the `init_*`
+// functions keeping their names), and replaces the memorized declarations with the result.
+//
+// It returns the changed lines, mapped to the cells where they were defined.
+func (s *State) applyRenameEdits(decls *Declarations, content string, edits []lsp.TextEdit,
+	fileToCellIdAndLine []CellIdAndLine) ([]RenamedCell, error) {
+	lines := strings.Split(content, "\n")
+	edits = slices.Clone(edits)
+	slices.SortFunc(edits, func(a, b lsp.TextEdit) int {
+		// Reverse order, so edits don't change the position of the ones not yet applied.
+		return cmp.Or(cmp.Compare(b.Range.Start.Line, a.Range.Start.Line),
+			cmp.Compare(b.Range.Start.Character, a.Range.Start.Character))
+	})
+	changedLines := MakeSet[int]()
+	for _, edit := range edits {
+		start, end := edit.Range.Start, edit.Range.End
+		if start.Line != end.Line || strings.Contains(edit.NewText, "\n") || int(start.Line) >= len(lines) {
+			return nil, errors.Errorf("rename edit %+v not supported: only edits within one line can be mapped back "+
+				"to the cells", edit)
+		}
+		line := lines[start.Line]
+		from, to := utf16ToByteCol(line, int(start.Character)), utf16ToByteCol(line, int(end.Character))
+		lines[start.Line] = line[:from] + edit.NewText + line[to:]
+		changedLines.Insert(int(start.Line))
+	}
+
+	if err := os.WriteFile(s.CodePath(), []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		return nil, errors.Wrapf(err, "failed to write renamed code to %q", s.CodePath())
+	}
+	newDecls, err := s.parseFromGoCode(nil, cellIdFromFile, NoCursor, fileToCellIdAndLine)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to parse renamed code")
+	}
+	newDecls.InitOrder = slices.Clone(decls.InitOrder)
+	s.setDefinitions(newDecls)
+
+	cells := make(map[int]*RenamedCell)
+	for _, fileLine := range SortedKeys(changedLines) {
+		if fileLine >= len(fileToCellIdAndLine) {
+			continue
+		}
+		cellIdAndLine := fileToCellIdAndLine[fileLine]
+		if cellIdAndLine.Id < 0 || cellIdAndLine.Line < 0 {
+			// Automatically generated line, not from any cell.
+			continue
+		}
+		cell, found := cells[cellIdAndLine.Id]
+		if !found {
+			cell = &RenamedCell{Id: cellIdAndLine.Id, Lines: make(map[int]string)}
+			cells[cellIdAndLine.Id] = cell
+		}
+		cell.Lines[cellIdAndLine.Line] = lines[fileLine]
+	}
+	renamedCells := make([]RenamedCell, 0, len(cells))
+	for _, id := range SortedKeys(cells) {
+		renamedCells = append(renamedCells, *cells[id])
+	}
+	return renamedCells, nil
+}
+
+// findDeclaredIdent returns the position (0-based line and byte column) of the identifier of the top-level
+// declaration name in the Go code in content.
+// Methods, struct fields and interface methods are given as `<Type>.<Name>`.
+func findDeclaredIdent(content, name string) (line, col int, err error) {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "", content, parser.SkipObjectResolution)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to parse memorized declarations")
+	}
+	typeName, memberName, isMember := strings.Cut(name, ".")
+	var ident *ast.Ident
+	for _, decl := range file.Decls {
+		switch typedDecl := decl.(type) {
+		case *ast.FuncDecl:
+			if !isMember && typedDecl.Recv == nil && typedDecl.Name.Name == name {
+				ident = typedDecl.Name
+			} else if isMember && typedDecl.Recv != nil && len(typedDecl.Recv.List) > 0 &&
+				typedDecl.Name.Name == memberName {
+				if receiver, _ := receiverTypeName(typedDecl.Recv.List[0].Type); receiver == typeName {
+					ident = typedDecl.Name
+				}
+			}
+		case *ast.GenDecl:
+			for _, spec := range typedDecl.Specs {
+				switch typedSpec := spec.(type) {
+				case *ast.TypeSpec:
+					if !isMember && typedSpec.Name.Name == name {
+						ident = typedSpec.Name
+					} else if isMember && typedSpec.Name.Name == typeName {
+						ident = findMemberIdent(typedSpec.Type, memberName)
+					}
+				case *ast.ValueSpec:
+					for _, valueName := range typedSpec.Names {
+						if !isMember && valueName.Name == name {
+							ident = valueName
+						}
+					}
+				}
+			}
+		}
+		if ident != nil {
+			pos := fileSet.Position(ident.Pos())
+			return pos.Line - 1, pos.Column - 1, nil
+		}
+	}
+	return 0, 0, errors.Errorf("%q not found in the memorized declarations", name)
+}
+
+// findMemberIdent returns the identifier of the field of a struct or of the method of an interface, or nil
+// if not found.
+func findMemberIdent(typeExpr ast.Expr, memberName string) *ast.Ident {
+	var fields *ast.FieldList
+	switch t := typeExpr.(type) {
+	case *ast.StructType:
+		fields = t.Fields
+	case *ast.InterfaceType:
+		fields = t.Methods
+	}
+	if fields == nil {
+		return nil
+	}
+	for _, field := range fields.List {
+		for _, fieldName := range field.Names {
+			if fieldName.Name == memberName {
+				return fieldName
+			}
+		}
+	}
+	return nil
+}
+
+// utf16ToByteCol converts a column given in UTF-16 code units (used by the LSP protocol) to a byte offset in line.
+func utf16ToByteCol(line string, col int) int {
+	var units int
+	for ii, r := range line {
+		if units >= col {
+			return ii
+		}
+		units += utf16.RuneLen(r)
+	}
+	return len(line)
+}
+
+// byteToUTF16Col converts a byte offset in line to a column in UTF-16 code units (used by the LSP protocol).
+func byteToUTF16Col(line string, col int) int {
+	return len(utf16.Encode([]rune(line[:col])))
+}
@@ -0,0 +1,121 @@
+package goexec
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lsp "go.lsp.dev/protocol"
+)
+
+func TestFindDeclaredIdent(t *testing.T) {
+	content := `package main
+
+type Point struct {
+	X, Y float64
+}
+
+type Shape interface {
+	Area() float64
+}
+
+func (p *Point) Norm() float64 { return p.X*p.X + p.Y*p.Y }
+
+var count, total = 1, 2
+
+func Norm() {}
+`
+	for _, tc := range []struct {
+		name      string
+		line, col int
+	}{
+		{"Point", 2, 5},
+		{"Point.Y", 3, 4},
+		{"Shape.Area", 7, 1},
+		{"Point.Norm", 10, 16},
+		{"Norm", 14, 5},
+		{"total", 12, 11},
+	} {
+		line, col, err := findDeclaredIdent(content, tc.name)
+		require.NoErrorf(t, err, "findDeclaredIdent(%q)", tc.name)
+		assert.Equalf(t, []int{tc.line, tc.col}, []int{line, col}, "findDeclaredIdent(%q)", tc.name)
+	}
+	for _, name := range []string{"Area", "Point.Z", "Shape.Norm", "missing"} {
+		_, _, err := findDeclaredIdent(content, name)
+		assert.Errorf(t, err, "findDeclaredIdent(%q) should have failed", name)
+	}
+}
+
+func TestUTF16Columns(t *testing.T) {
+	line := "s := \"日本𝄞\" + x"
+	xCol := strings.Index(line, "x")
+	utf16Col := byteToUTF16Col(line, xCol)
+	assert.Equal(t, 14, utf16Col)
+	assert.Equal(t, xCol, utf16ToByteCol(line, utf16Col))
+	assert.Equal(t, len(line), utf16ToByteCol(line, 100))
+}
+
+func TestApplyRenameEdits(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	cells := []string{
+		"func Foo(x int) int {\n\treturn x + 1\n}",
+		"func init_a() {\n\tFoo(1)\n}",
+		"var y = Foo(2) + Foo(3)",
+	}
+	for ii, cell := range cells {
+		require.NoError(t, s.MemorizeCell(nil, ii+1, strings.Split(cell, "\n"), MakeSet[int]()))
+	}
+
+	content, fileToCellIdAndLine, err := s.composeForRename(s.Definitions.Copy())
+	require.NoError(t, err)
+	assert.Contains(t, content, "func init_a()")
+	line, col, err := findDeclaredIdent(content, "Foo")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(strings.Split(content, "\n")[line][col:], "Foo("))
+
+	// Edits `gopls` would return for the rename.
+	var edits []lsp.TextEdit
+	fooRegexp := regexp.MustCompile(`\bFoo\b`)
+	for lineNum, lineContent := range strings.Split(content, "\n") {
+		for _, match := range fooRegexp.FindAllStringIndex(lineContent, -1) {
+			edits = append(edits, lsp.TextEdit{
+				Range: lsp.Range{
+					Start: lsp.Position{Line: uint32(lineNum), Character: uint32(match[0])},
+					End:   lsp.Position{Line: uint32(lineNum), Character: uint32(match[1])},
+				},
+				NewText: "Bar",
+			})
+		}
+	}
+	require.Len(t, edits, 4)
+
+	renamedCells, err := s.applyRenameEdits(s.Definitions, content, edits, fileToCellIdAndLine)
+	require.NoError(t, err)
+	assert.Equal(t, []RenamedCell{
+		{Id: 1, Lines: map[int]string{0: "func Bar(x int) int {"}},
+		{Id: 2, Lines: map[int]string{1: "\tBar(1)"}},
+		{Id: 3, Lines: map[int]string{0: "\ty = Bar(2) + Bar(3)"}}, // Rendered within a `var (...)` block.
+	}, renamedCells)
+
+	decls := s.Definitions
+	assert.NotContains(t, decls.Functions, "Foo")
+	require.Contains(t, decls.Functions, "Bar")
+	assert.Equal(t, 1, decls.Functions["Bar"].Id)
+	require.Contains(t, decls.Functions, "init_a")
+	assert.Equal(t, 2, decls.Functions["init_a"].Id)
+	assert.Contains(t, decls.Functions["init_a"].Definition, "Bar(1)")
+	require.Contains(t, decls.Variables, "y")
+	assert.Equal(t, 3, decls.Variables["y"].Id)
+
+	// Multi-line edits can't be mapped back to the cells.
+	_, err = s.applyRenameEdits(s.Definitions, content, []lsp.TextEdit{{
+		Range:   lsp.Range{Start: lsp.Position{Line: 1}, End: lsp.Position{Line: 2}},
+		NewText: "x",
+	}}, fileToCellIdAndLine)
+	assert.Error(t, err)
+}
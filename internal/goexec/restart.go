@@ -0,0 +1,143 @@
+package goexec
+
+import (
+	"os"
+	"path"
+
+	"github.com/janpfeifer/gonb/internal/jpyexec"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the in-process soft restart of the kernel: when Jupyter requests a restart, the State is
+// re-initialized in place, instead of restarting the process. It keeps `gopls` running, the build cache warm and,
+// optionally, the `go.mod` of the session.
+
+// startupSettings holds the settings configured by the kernel flags, that can later be changed by special
+// commands (`%errors`, `%sanitize_html` and `%wasm`).
+type startupSettings struct {
+	errorFormat              ErrorFormat
+	sanitizeHTML             bool
+	wasmBaseDir, wasmBaseUrl string
+}
+
+// SaveStartupSettings records the current error format, SanitizeHTML and `%wasm` location (see SetWasmLocation)
+// as the ones configured at startup, to which SoftReset returns. It should be called once the kernel flags are
+// applied.
+func (s *State) SaveStartupSettings() {
+	s.startupSettings = startupSettings{
+		errorFormat:  s.errorFormat,
+		sanitizeHTML: s.SanitizeHTML,
+		wasmBaseDir:  s.WasmBaseDir,
+		wasmBaseUrl:  s.WasmBaseUrl,
+	}
+}
+
+// SoftReset re-initializes the State to how it is when the kernel starts: memorized declarations, the
+// configuration set by special commands (`%goflags`, `%hook`, `%pager`, `%route`, `%errors`, etc.) and the
+// history of the session are reset -- everything initialized by resetSession, shared with New. The workspaces
+// created with `%workspace` are removed, and the default one becomes the current again.
+//
+// If keepGoMod is true, `go.mod`, `go.sum`, `go.work` and the tracked directories of the default workspace are
+// preserved, so dependencies don't need to be fetched again. Otherwise, they are reset as well.
+//
+// The temporary directory, `gopls` and the connection with the front-end (Comms) are kept.
+func (s *State) SoftReset(keepGoMod bool) error {
+	s.composeMu.Lock()
+	defer s.composeMu.Unlock()
+	if s.WorkspaceName() != DefaultWorkspace {
+		s.switchWorkspaceLocked(DefaultWorkspace, s.workspaces[DefaultWorkspace])
+	}
+	if s.preserveTempDir {
+		s.workspaces = nil
+	} else {
+		s.removeWorkspacesDirs()
+	}
+	s.workspaceName = ""
+	s.resetSession()
+
+	if keepGoMod {
+		return nil
+	}
+	if len(s.ListTracked()) > 0 {
+		if err := s.Untrack("..."); err != nil {
+			klog.Warningf("Failed to untrack directories during restart: %+v", err)
+		}
+	}
+	for _, name := range []string{"go.work", "go.work.sum", "go.sum"} {
+		if err := os.Remove(path.Join(s.TempDir, name)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to remove %q during restart", name)
+		}
+	}
+	s.stateMu.Lock()
+	s.hasGoWork, s.goWorkUsePaths = false, nil
+	s.stateMu.Unlock()
+	return s.GoModInit()
+}
+
+// resetSession sets the state of the session to its initial values: the memorized declarations, the
+// configuration set by special commands and the history of the session. It is used by New and SoftReset:
+// a field of State not set here is kept by a restart.
+func (s *State) resetSession() {
+	s.stateMu.Lock()
+	s.Definitions = NewDeclarations()
+	s.functionHistory = nil
+	s.moduleDownloads = nil
+	s.GoBuildFlags = nil
+	hadBuildTags := len(s.BuildTags) > 0
+	s.AutoGet = true
+	s.shellHistory = nil
+	s.cellLabels = nil
+	s.hiddenTests = nil
+	hadPersistedVars := s.persistedVars != nil
+	s.persistedVars = nil
+	s.stateMu.Unlock()
+
+	s.Args = nil
+	s.CellIsTest, s.CellTests, s.CellHasBenchmarks = false, nil, false
+	s.CellBuildTags = nil
+	if hadBuildTags {
+		s.SetBuildTags(nil)
+	}
+	s.CellIsWasm = false
+	s.WasmDivId = ""
+	s.SnapshotPath = ""
+	s.Deterministic = nil
+	s.Coverage = nil
+	if s.Capture != nil {
+		if err := s.Capture.Close(); err != nil {
+			klog.Warningf("Failed to close %%capture file %q: %+v", s.Capture.Path, err)
+		}
+		s.Capture = nil
+	}
+	s.PreRunHooks, s.PostRunHooks = nil, nil
+	s.VetEnabled = false
+	s.VulnCheckAfterGet = false
+	s.diagnostics.set(nil, nil)
+	s.payloads = nil
+	s.PagerLines = DefaultPagerLines
+	s.StreamBufferInterval = jpyexec.DefaultStreamBufferInterval
+	s.BinaryPolicy = jpyexec.BinaryReplace
+	s.StreamRoutes = nil
+	s.SignalPolicy = jpyexec.DefaultSignalPolicy()
+	s.errorFormat = s.startupSettings.errorFormat
+	s.SanitizeHTML = s.startupSettings.sanitizeHTML
+	if s.WasmBaseDir != s.startupSettings.wasmBaseDir || s.WasmBaseUrl != s.startupSettings.wasmBaseUrl {
+		s.SetWasmLocation(s.startupSettings.wasmBaseDir, s.startupSettings.wasmBaseUrl)
+	}
+	s.previousCode, s.lastCode = "", ""
+	s.lastFileToCellIdAndLine = nil
+
+	s.closeListeners()
+	if hadPersistedVars {
+		if err := os.RemoveAll(s.persistDir()); err != nil {
+			klog.Warningf("Failed to remove the values of the persisted variables: %+v", err)
+		}
+	}
+	s.Store.Reset()
+	if source, err := s.ResetMainTemplate(); err != nil {
+		klog.Errorf("Failed to configure the template of the main function, using the default: %+v", err)
+	} else if source != "default" {
+		klog.V(1).Infof("Template of the main function loaded from %q", source)
+	}
+}
@@ -0,0 +1,145 @@
+package goexec
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/jpyexec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestSoftReset(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	lines := strings.Split("func f() int { return 1 }", "\n")
+	require.NoError(t, s.MemorizeCell(nil, 0, lines, MakeSet[int]()))
+	s.SetGoBuildFlags([]string{"-race"})
+	s.SetAutoGet(false)
+	s.AddShellHistory("ls")
+	s.Args = []string{"--x"}
+	s.PreRunHooks = []string{"%version"}
+	s.BinaryPolicy = jpyexec.BinaryHexDump
+	goModPath := path.Join(s.TempDir, "go.mod")
+	require.NoError(t, os.WriteFile(goModPath, []byte("module keep_me\n"), 0600))
+
+	// Keeping go.mod.
+	require.NoError(t, s.SoftReset(true))
+	assert.Empty(t, s.Definitions.Functions)
+	assert.Empty(t, s.GoBuildFlags)
+	assert.True(t, s.AutoGet)
+	assert.Empty(t, s.ShellHistory())
+	assert.Empty(t, s.Args)
+	assert.Empty(t, s.PreRunHooks)
+	assert.Equal(t, jpyexec.BinaryReplace, s.BinaryPolicy)
+	goMod, err := os.ReadFile(goModPath)
+	require.NoError(t, err)
+	assert.Equal(t, "module keep_me\n", string(goMod))
+
+	// Resetting go.mod.
+	require.NoError(t, s.SoftReset(false))
+	goMod, err = os.ReadFile(goModPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(goMod), "module "+s.Package)
+}
+
+// softResetKeptFields are the fields of State kept by SoftReset (and not initialized by resetSession): the
+// infrastructure of the kernel, and the configuration given by its flags. The Store is kept, but its contents
+// are reset.
+var softResetKeptFields = SetWithValues(
+	"Kernel", "UniqueID", "Package", "TempDir", "gopls", "trackingInfo", "hasGoWork", "goWorkUsePaths",
+	"preserveTempDir", "startupSettings", "cellExecChan", "composeMu", "stateMu", "introspectionMu", "moduleDir",
+	"WasmDir", "WasmUrl", "AssetsDir", "AssetsUrl", "Comms", "HookRunner", "CompletionProvider", "Store")
+
+// stateFieldValue returns the value of the field (exported or not) of the State.
+func stateFieldValue(s *State, field int) any {
+	value := reflect.ValueOf(s).Elem().Field(field)
+	return reflect.NewAt(value.Type(), unsafe.Pointer(value.UnsafeAddr())).Elem().Interface()
+}
+
+// TestSoftResetAllFields checks that SoftReset resets every field of State, except softResetKeptFields, to the
+// value it has in a new State.
+func TestSoftResetAllFields(t *testing.T) {
+	fresh := newEmptyState(t)
+	defer func() { require.NoError(t, fresh.Stop()) }()
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	// Change every field of the session, in a workspace other than the default.
+	defaultTempDir := s.TempDir
+	require.NoError(t, s.CreateWorkspace("other"))
+	require.NoError(t, s.SwitchWorkspace("other"))
+	otherTempDir := s.TempDir
+	require.NoError(t, s.MemorizeCell(nil, 0, strings.Split("var x = 1\nfunc f() int { return 1 }", "\n"), MakeSet[int]()))
+	require.NoError(t, s.MemorizeCell(nil, 1, strings.Split("func f() int { return 2 }", "\n"), MakeSet[int]()))
+	s.moduleDownloads = map[module.Version]bool{{Path: "example.com/m", Version: "v1.0.0"}: true}
+	s.SetGoBuildFlags([]string{"-race"})
+	s.SetBuildTags([]string{"integration"})
+	s.CellBuildTags = []string{"cell"}
+	s.SetAutoGet(false)
+	s.AddShellHistory("ls")
+	require.NoError(t, s.SetCellLabel("setup", 1))
+	s.hiddenTests = []*hiddenTestsCell{{cellId: 1, tests: []string{"TestA"}, points: 1}}
+	require.NoError(t, s.PersistVariable("x"))
+	s.Args = []string{"--x"}
+	s.CellIsTest, s.CellTests, s.CellHasBenchmarks = true, []string{"TestA"}, true
+	s.CellIsWasm, s.WasmDivId = true, "div"
+	s.SnapshotPath = "/tmp/snapshot.png"
+	s.Deterministic = &DeterministicMode{Seed: 1}
+	s.Coverage = &CoverageSession{Dir: t.TempDir()}
+	capture, err := NewCapture(path.Join(t.TempDir(), "output.txt"), false, false)
+	require.NoError(t, err)
+	s.Capture = capture
+	s.PreRunHooks, s.PostRunHooks = []string{"%version"}, []string{"%ls"}
+	s.VetEnabled, s.VulnCheckAfterGet = true, true
+	s.diagnostics.set([]Diagnostic{{CellId: 1, Message: "unused"}}, nil)
+	s.AddPayload(map[string]any{"source": "page"})
+	s.PagerLines = 1
+	s.StreamBufferInterval = 0
+	s.BinaryPolicy = jpyexec.BinaryHexDump
+	s.StreamRoutes = map[string]jpyexec.StreamRoute{"log": {Kind: jpyexec.RouteFile, Path: "/tmp/log"}}
+	s.SignalPolicy = jpyexec.SignalPolicy{Forward: []syscall.Signal{syscall.SIGTERM}, KillAfter: -1}
+	s.previousCode, s.lastCode = "package main", "package main\n"
+	s.lastFileToCellIdAndLine = []CellIdAndLine{{Id: 1, Line: 0}}
+	_, err = s.Listen("web", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, s.SetMainTemplate("flag.Parse()\nGONB_CELL\nfmt.Println(\"done\")\n"))
+	require.NoError(t, s.Store.Set("key", []byte("value")))
+	require.NoError(t, s.SetErrorFormat(string(ErrorFormatANSI)))
+	s.SanitizeHTML = true
+	s.SetWasmLocation(t.TempDir(), "https://example.com/files")
+
+	stateType := reflect.TypeOf(State{})
+	for ii := range stateType.NumField() {
+		name := stateType.Field(ii).Name
+		if softResetKeptFields.Has(name) {
+			continue
+		}
+		if reflect.DeepEqual(stateFieldValue(s, ii), stateFieldValue(fresh, ii)) {
+			t.Errorf("State.%s not changed by the test: new fields must be reset by resetSession, and changed here", name)
+		}
+	}
+
+	require.NoError(t, s.SoftReset(true))
+	for ii := range stateType.NumField() {
+		name := stateType.Field(ii).Name
+		if softResetKeptFields.Has(name) {
+			continue
+		}
+		assert.Equalf(t, stateFieldValue(fresh, ii), stateFieldValue(s, ii), "State.%s not reset by SoftReset", name)
+	}
+	assert.Empty(t, s.Store.Keys())
+
+	// Back to the default workspace, and the other ones are removed.
+	assert.Equal(t, defaultTempDir, s.TempDir)
+	assert.Equal(t, []string{DefaultWorkspace}, s.ListWorkspaces())
+	assert.NoDirExists(t, otherTempDir)
+}
@@ -0,0 +1,98 @@
+package goexec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/gonbui/jupyterapi"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%save_state` and `%load_state`: the memorized declarations are saved as Go code, to be
+// loaded in a later session, without executing again the cells that defined them.
+
+// StateDirEnv is the environment variable that can be used to change the directory where the states are saved
+// by default. If not set, `gonb/state` under the user's cache directory is used.
+const StateDirEnv = "GONB_STATE_DIR"
+
+// DefaultStatePath returns the path where the state of the notebook is saved by default: a file per notebook
+// (as reported by the Jupyter server), in the directory given by $GONB_STATE_DIR.
+func DefaultStatePath() (string, error) {
+	dir := os.Getenv(StateDirEnv)
+	if dir != "" {
+		dir = ReplaceTildeInDir(dir)
+	} else {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to find user cache directory, set %s to configure one", StateDirEnv)
+		}
+		dir = path.Join(cacheDir, "gonb", "state")
+	}
+	name := "default"
+	if notebook := os.Getenv(jupyterapi.JupyterSessionNameEnv); notebook != "" {
+		hash := sha256.Sum256([]byte(notebook))
+		name = strings.TrimSuffix(filepath.Base(notebook), filepath.Ext(notebook)) + "-" + hex.EncodeToString(hash[:4])
+	}
+	return path.Join(dir, name+".go"), nil
+}
+
+// SaveState saves the memorized declarations to filePath as Go code.
+func (s *State) SaveState(filePath string) error {
+	s.stateMu.Lock()
+	decls := s.Definitions.Copy()
+	s.stateMu.Unlock()
+	decls.ClearCursor()
+	var buf bytes.Buffer
+	if _, _, err := s.createCodeFromDecls(&buf, decls, nil); err != nil {
+		return errors.WithMessage(err, "failed to render the memorized declarations")
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return errors.Wrapf(err, "failed to create directory for state %q", filePath)
+	}
+	if err := os.WriteFile(filePath+".tmp", buf.Bytes(), 0600); err != nil {
+		return errors.Wrapf(err, "failed to write state to %q", filePath)
+	}
+	return errors.Wrapf(os.Rename(filePath+".tmp", filePath), "failed to write state to %q", filePath)
+}
+
+// LoadState memorizes the declarations saved in filePath by SaveState, as if they were defined by the cell cellId.
+func (s *State) LoadState(msg kernel.Message, cellId int, filePath string) error {
+	code, err := os.ReadFile(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read state from %q", filePath)
+	}
+	lines := strings.Split(string(code), "\n")
+	skipLines := MakeSet[int]()
+	for ii, line := range lines {
+		if strings.HasPrefix(line, "package ") {
+			// The package clause is added when composing the program.
+			skipLines.Insert(ii)
+			break
+		}
+	}
+	return s.MemorizeCell(msg, cellId, lines, skipLines)
+}
+
+// savedStateDeclarations returns the default state path (see DefaultStatePath) and the names declared by the
+// state saved there, or nil if there is no state saved.
+func savedStateDeclarations() (string, Set[string]) {
+	statePath, err := DefaultStatePath()
+	if err != nil {
+		return "", nil
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), statePath, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return "", nil
+	}
+	return statePath, topLevelDeclarations(map[string]*ast.File{statePath: file})
+}
@@ -0,0 +1,163 @@
+package goexec
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// This file implements `%scaffold`: it creates a new Go module from the memorized declarations.
+
+// scaffoldPlaceholderVersion is the version required for scaffolded modules: the actual code
+// comes from the local directory, through a `replace` rule.
+const scaffoldPlaceholderVersion = "v0.0.0"
+
+// regexpNonIdentifier matches the characters not allowed in a Go package name.
+var regexpNonIdentifier = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// ScaffoldPackageName returns the package name used for the module path: its last element,
+// stripped of a major version suffix (e.g. "/v2") and of characters not valid in identifiers.
+func ScaffoldPackageName(modulePath string) string {
+	name := path.Base(modulePath)
+	if len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		// Major version suffix, use the previous element.
+		name = path.Base(path.Dir(modulePath))
+	}
+	name = regexpNonIdentifier.ReplaceAllString(strings.ToLower(name), "")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "pkg" + name
+	}
+	return name
+}
+
+// scaffoldFile describes one of the files created by Scaffold.
+type scaffoldFile struct {
+	name      string
+	renderers []func(w *WriterWithCursor, fileToCellIdAndLine []CellIdAndLine) (Cursor, []CellIdAndLine)
+	isEmpty   bool
+}
+
+// Scaffold creates a new Go module with the given modulePath in dir, with the memorized
+// declarations (except `func main`) split into types.go, vars.go and funcs.go.
+//
+// It then adds a `require` and a `replace` rule to the notebook's go.mod, so subsequent cells
+// can import the new package. The memorized declarations are not changed: the user will likely
+// want to remove them (`%rm` or `%reset`) to avoid confusion.
+func (s *State) Scaffold(msg kernel.Message, modulePath, dir string) error {
+	if modulePath == "" {
+		return errors.New("%scaffold requires a module path, e.g.: `%scaffold github.com/my/project`")
+	}
+	if dir == "" {
+		dir = path.Base(modulePath)
+	}
+	dir = ReplaceTildeInDir(dir)
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get absolute path for %q", dir)
+	}
+	if entries, err := os.ReadDir(absDir); err == nil && len(entries) > 0 {
+		return errors.Errorf("%%scaffold: directory %q already exists and is not empty", absDir)
+	}
+	if err = os.MkdirAll(absDir, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create directory %q", absDir)
+	}
+
+	decls := s.Definitions.Copy()
+	delete(decls.Functions, "main")
+	decls.DropFuncInit()
+	files := []scaffoldFile{
+		{"types.go", []func(*WriterWithCursor, []CellIdAndLine) (Cursor, []CellIdAndLine){decls.RenderTypes, decls.RenderConstants},
+			len(decls.Types) == 0 && len(decls.Constants) == 0},
+		{"vars.go", []func(*WriterWithCursor, []CellIdAndLine) (Cursor, []CellIdAndLine){decls.RenderVariables},
+			len(decls.Variables) == 0},
+		{"funcs.go", []func(*WriterWithCursor, []CellIdAndLine) (Cursor, []CellIdAndLine){decls.RenderFunctions},
+			len(decls.Functions) == 0},
+	}
+	pkgName := ScaffoldPackageName(modulePath)
+	var created []string
+	for _, file := range files {
+		if file.isEmpty {
+			continue
+		}
+		var buf bytes.Buffer
+		w := NewWriterWithCursor(&buf)
+		w.Writef("package %s\n\n", pkgName)
+		// All imports are included, unused ones are removed by goimports below.
+		_, _ = decls.RenderImports(w, nil)
+		for _, renderer := range file.renderers {
+			_, _ = renderer(w, nil)
+		}
+		if w.Error() != nil {
+			return errors.WithMessagef(w.Error(), "rendering %q", file.name)
+		}
+		filePath := path.Join(absDir, file.name)
+		if err = os.WriteFile(filePath, buf.Bytes(), 0644); err != nil {
+			return errors.Wrapf(err, "failed to write %q", filePath)
+		}
+		created = append(created, filePath)
+	}
+	if len(created) == 0 {
+		return errors.New("%scaffold: there are no memorized declarations to scaffold, other than `func main`")
+	}
+
+	// Remove unused imports.
+	if goimportsPath, err := exec.LookPath("goimports"); err == nil {
+		if err = runScaffoldCmd(absDir, goimportsPath, append([]string{"-w"}, created...)...); err != nil {
+			return err
+		}
+	} else {
+		klog.Warningf("%%scaffold: goimports not found, unused imports not removed: %v", err)
+	}
+
+	// Create go.mod for the new module.
+	if err = runScaffoldCmd(absDir, "go", "mod", "init", modulePath); err != nil {
+		return err
+	}
+	if err = runScaffoldCmd(absDir, "go", "mod", "tidy"); err != nil {
+		// Not fatal: the user can fix the dependencies later.
+		_ = kernel.PublishWriteStream(msg, kernel.StreamStderr, fmt.Sprintf("Warning: %v\n", err))
+	}
+
+	// Make the new module available to the notebook.
+	if err = runScaffoldCmd(s.TempDir, "go", "mod", "edit",
+		fmt.Sprintf("-require=%s@%s", modulePath, scaffoldPlaceholderVersion),
+		fmt.Sprintf("-replace=%s=%s", modulePath, absDir)); err != nil {
+		return err
+	}
+	if err = s.AutoTrack(); err != nil {
+		klog.Warningf("%%scaffold: failed to auto-track new module in %q: %+v", absDir, err)
+	}
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout, fmt.Sprintf(
+		"Module %q created in %q (package %s), with files %s.\n"+
+			"Import it with `import %q`; consider removing the memorized declarations with `%%rm` or `%%reset`.\n",
+		modulePath, absDir, pkgName, strings.Join(filesBaseNames(created), ", "), modulePath))
+}
+
+// runScaffoldCmd runs the command in the given directory, and returns an error with its output if it fails.
+func runScaffoldCmd(dir, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	klog.V(2).Infof("Executing %s", cmd)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "failed to run %q:\n%s", cmd.String(), output)
+	}
+	return nil
+}
+
+func filesBaseNames(paths []string) []string {
+	names := make([]string, 0, len(paths))
+	for _, p := range paths {
+		names = append(names, path.Base(p))
+	}
+	return names
+}
@@ -0,0 +1,61 @@
+package goexec
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestScaffoldPackageName(t *testing.T) {
+	assert.Equal(t, "project", ScaffoldPackageName("github.com/me/project"))
+	assert.Equal(t, "project", ScaffoldPackageName("github.com/me/project/v2"))
+	assert.Equal(t, "myproject", ScaffoldPackageName("github.com/me/my-project"))
+	assert.Equal(t, "pkg3d", ScaffoldPackageName("example.com/3d"))
+}
+
+func TestScaffold(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() {
+		err := s.Stop()
+		require.NoError(t, err, "Failed to finalized state")
+	}()
+	code := `package main
+
+import "fmt"
+
+type Point struct { X, Y int }
+
+const Origin = 0
+
+var counter int
+
+func (p Point) String() string { return fmt.Sprintf("(%d, %d)", p.X, p.Y) }
+
+func main() { fmt.Println(Point{}) }
+`
+	require.NoError(t, os.WriteFile(s.CodePath(), []byte(code), 0644))
+	var err error
+	s.Definitions, err = s.parseFromGoCode(nil, 0, NoCursor, nil)
+	require.NoError(t, err)
+
+	dir := path.Join(t.TempDir(), "project")
+	require.NoError(t, s.Scaffold(nil, "example.com/me/project", dir))
+	for _, name := range []string{"types.go", "vars.go", "funcs.go", "go.mod"} {
+		assert.FileExists(t, path.Join(dir, name))
+	}
+	contents, err := os.ReadFile(path.Join(dir, "funcs.go"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(contents), "package project\n"))
+	assert.Contains(t, string(contents), "func (p Point) String()")
+	assert.NotContains(t, string(contents), "func main()")
+
+	goMod, err := os.ReadFile(path.Join(s.TempDir, "go.mod"))
+	require.NoError(t, err)
+	assert.Contains(t, string(goMod), "example.com/me/project => "+dir)
+
+	// Scaffolding again into a non-empty directory fails.
+	require.Error(t, s.Scaffold(nil, "example.com/me/project", dir))
+}
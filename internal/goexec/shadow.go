@@ -0,0 +1,84 @@
+package goexec
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+	"os"
+	"path"
+)
+
+// This file implements the shadow package used to serve the introspection requests (inspect and auto-complete):
+// the program with the cell being introspected is composed in a sub-directory of the module, so these requests
+// never rewrite the `main.go` of a cell that may be being compiled or executed at the same time.
+
+// ShadowDirName is the sub-directory of State.TempDir where the programs used by the introspection requests are
+// composed. It holds a separate `package main` of the same module: so it shares `go.mod`, `go.sum` and `go.work`,
+// and it is not built by the cell executions.
+const ShadowDirName = "gonb_shadow"
+
+// ShadowDir returns the directory of the shadow package, used to compose the programs for the introspection
+// requests. See ShadowDirName.
+func (s *State) ShadowDir() string {
+	return path.Join(s.TempDir, ShadowDirName)
+}
+
+// goModDir returns the directory with the `go.mod` file.
+func (s *State) goModDir() string {
+	if s.moduleDir != "" {
+		return s.moduleDir
+	}
+	return s.TempDir
+}
+
+// introspectionState returns the State used to serve an introspection request (inspect or auto-complete),
+// which may happen while a cell is executing.
+//
+// The returned State composes its program in the shadow package (see ShadowDir), it uses a snapshot of the
+// memorized declarations, and none of the one-shot configuration of the cell being executed (e.g.: `%test`).
+// It shares gopls and the tracking information.
+//
+// If no cell is being composed or built, it also runs AutoTrack, and allows the introspection to `go get`
+// missing packages: in which case cell executions wait until release is called.
+// Otherwise `go.mod` is left untouched.
+func (s *State) introspectionState() (view *State, release func(), err error) {
+	release = func() {}
+	moduleLocked := s.composeMu.TryLock()
+	if moduleLocked {
+		// Runs AutoTrack: makes sure redirects in go.mod and use clauses in go.work are tracked.
+		if err = s.AutoTrack(); err != nil {
+			s.composeMu.Unlock()
+			return
+		}
+		release = s.composeMu.Unlock
+	} else {
+		klog.V(1).Infof("Introspection while a cell is being built: tracking and `go get` skipped")
+	}
+
+	s.stateMu.Lock()
+	view = &State{
+		Kernel:          s.Kernel,
+		UniqueID:        s.UniqueID,
+		Package:         s.Package,
+		TempDir:         s.ShadowDir(),
+		moduleDir:       s.TempDir,
+		Definitions:     s.Definitions.Copy(),
+		GoBuildFlags:    s.GoBuildFlags,
+		BuildTags:       s.BuildTags,
+		gopls:           s.gopls,
+		trackingInfo:    s.trackingInfo,
+		preserveTempDir: s.preserveTempDir,
+		errorFormat:     s.errorFormat,
+	}
+	if moduleLocked {
+		view.AutoGet = s.AutoGet
+		view.hasGoWork, view.goWorkUsePaths = s.hasGoWork, s.goWorkUsePaths
+	}
+	s.stateMu.Unlock()
+
+	if err = os.MkdirAll(view.TempDir, 0700); err != nil {
+		err = errors.Wrapf(err, "failed to create shadow directory %q", view.TempDir)
+		release()
+		release = func() {}
+	}
+	return
+}
@@ -0,0 +1,39 @@
+package goexec
+
+import (
+	"slices"
+	"strings"
+)
+
+// This file implements the history of shell commands (`!` lines) executed in the session, used for
+// auto-completion.
+
+// MaxShellHistory is the maximum number of shell commands kept in the history. Older commands are dropped.
+const MaxShellHistory = 1000
+
+// AddShellHistory records a shell command (without the `!` or `!*` prefix) executed in the session.
+// If the command was executed before, it is moved to the end (most recent) of the history.
+func (s *State) AddShellHistory(cmd string) {
+	cmd = strings.TrimSpace(cmd)
+	if cmd == "" {
+		return
+	}
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if idx := slices.Index(s.shellHistory, cmd); idx >= 0 {
+		s.shellHistory = slices.Delete(s.shellHistory, idx, idx+1)
+	}
+	s.shellHistory = append(s.shellHistory, cmd)
+	if len(s.shellHistory) > MaxShellHistory {
+		s.shellHistory = slices.Delete(s.shellHistory, 0, len(s.shellHistory)-MaxShellHistory)
+	}
+}
+
+// ShellHistory returns the shell commands executed in the session, the most recent first.
+func (s *State) ShellHistory() []string {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	history := slices.Clone(s.shellHistory)
+	slices.Reverse(history)
+	return history
+}
@@ -0,0 +1,50 @@
+package goexec
+
+import (
+	"fmt"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// This file implements the memorization of variables set from the output of shell commands
+// (`!out := <cmd>` or `%sh --var=out <cmd>`).
+
+// SetStringVariable memorizes the variable `var <name> = "<value>"`, as if declared in the cell cellId.
+// If asLines is true, value is split in lines and the variable is a `[]string` instead.
+//
+// A previously memorized variable with the same name is replaced -- if it was declared in a tuple
+// (`var a, b = f()`), all the variables of the tuple are removed.
+func (s *State) SetStringVariable(name, value string, asLines bool, cellId int) (*Variable, error) {
+	if !token.IsIdentifier(name) || name == "_" {
+		return nil, errors.Errorf("invalid variable name %q", name)
+	}
+	var valueDefinition string
+	if asLines {
+		var quoted []string
+		if value != "" {
+			for _, line := range strings.Split(value, "\n") {
+				quoted = append(quoted, strconv.Quote(line))
+			}
+		}
+		valueDefinition = fmt.Sprintf("[]string{%s}", strings.Join(quoted, ", "))
+	} else {
+		valueDefinition = strconv.Quote(value)
+	}
+
+	var varDecl *Variable
+	s.UpdateDefinitions(func(decls *Declarations) {
+		if previous, found := decls.Variables[name]; found {
+			for _, tupleVar := range previous.TupleDefinitions {
+				delete(decls.Variables, tupleVar.Key)
+			}
+			delete(decls.Variables, name)
+		}
+		DeclareVariable(decls, name, valueDefinition)
+		varDecl = decls.Variables[name]
+		varDecl.CellLines.Id = cellId
+	})
+	return varDecl, nil
+}
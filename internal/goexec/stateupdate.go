@@ -0,0 +1,97 @@
+package goexec
+
+import (
+	"context"
+	"github.com/janpfeifer/gonb/internal/goexec/goplsclient"
+	"github.com/pkg/errors"
+	"slices"
+)
+
+// This file implements the API to change the fields of State shared with the introspection requests
+// (inspect and auto-complete), which are served concurrently with the cell executions.
+//
+// The State is otherwise only used by the goroutine handling the executions: the special commands of a cell
+// are executed before its Go code is handed to the serializer goroutine (see ExecuteCell), and the
+// dispatcher waits for it. So the one-shot configuration of the cell (CellIsTest, CellIsWasm, Args,
+// Capture, etc.) is confined to the execution of the cells, and it is never read by the introspection
+// requests (see introspectionState).
+//
+// The shared fields are: Definitions, TempDir, GoBuildFlags, BuildTags, AutoGet, gopls, trackingInfo and the
+// shell history. They are changed only while holding State.stateMu, using the methods below, and read
+// from other goroutines only while holding it as well.
+
+// UpdateDefinitions calls fn with the memorized declarations, which it can change. It is the only way
+// of changing Definitions in place.
+func (s *State) UpdateDefinitions(fn func(decls *Declarations)) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	fn(s.Definitions)
+}
+
+// setDefinitions replaces the memorized declarations.
+func (s *State) setDefinitions(decls *Declarations) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.Definitions = decls
+}
+
+// SetGoBuildFlags sets the flags passed to `go build`, see `%goflags`.
+func (s *State) SetGoBuildFlags(flags []string) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.GoBuildFlags = slices.Clone(flags)
+}
+
+// SetAutoGet configures whether to `go get` missing packages automatically, see `%autoget`.
+func (s *State) SetAutoGet(autoGet bool) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.AutoGet = autoGet
+}
+
+// GoplsStatus returns the status of `gopls`, and false if it is not available.
+// It doesn't start `gopls` if it is started on demand, see goplsOnDemand.
+func (s *State) GoplsStatus() (goplsclient.Status, bool) {
+	gopls := s.goplsClient()
+	if gopls == nil {
+		return goplsclient.Status{}, false
+	}
+	return gopls.Status(), true
+}
+
+// GoplsSettings returns the settings of `gopls` configured with SetGoplsSetting.
+func (s *State) GoplsSettings() map[string]any {
+	gopls := s.goplsClient()
+	if gopls == nil {
+		return nil
+	}
+	return gopls.Settings()
+}
+
+// SetGoplsSetting configures a setting of `gopls` (see https://go.dev/gopls/settings), and notifies it of the
+// change, if it is running -- otherwise the settings are sent when it starts, so it isn't started on demand
+// for this. A nil value removes the setting. See goplsclient.ParseSetting.
+func (s *State) SetGoplsSetting(key string, value any) error {
+	gopls := s.goplsClient()
+	if gopls == nil {
+		return errors.New("gopls is not available")
+	}
+	return gopls.SetSetting(context.Background(), key, value)
+}
+
+// ResetGoplsSettings removes the settings of `gopls` configured with SetGoplsSetting.
+func (s *State) ResetGoplsSettings() error {
+	gopls := s.goplsClient()
+	if gopls == nil {
+		return errors.New("gopls is not available")
+	}
+	return gopls.ResetSettings(context.Background())
+}
+
+// goplsClient returns the current gopls client, or nil if gopls is not available.
+// Use goplsOnDemand for requests that need `gopls` running.
+func (s *State) goplsClient() *goplsclient.Client {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.gopls
+}
@@ -0,0 +1,58 @@
+package goexec
+
+import (
+	"fmt"
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentIntrospectionAndExecution exercises introspection requests concurrently with cell executions
+// and special commands changing the State. It is meant to be run with `-race`.
+func TestConcurrentIntrospectionAndExecution(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	const numCells = 10
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		// Cell executions and special commands.
+		defer wg.Done()
+		for ii := 0; ii < numCells; ii++ {
+			lines := strings.Split(fmt.Sprintf("func f%d() int { return %d }", ii, ii), "\n")
+			assert.NoError(t, s.MemorizeCell(nil, ii, lines, MakeSet[int]()))
+			s.AddShellHistory(fmt.Sprintf("ls %d", ii))
+			s.SetGoBuildFlags([]string{fmt.Sprintf("-ldflags=-X main.cell=%d", ii)})
+			s.SetAutoGet(ii%2 == 0)
+			if ii%3 == 0 {
+				s.UpdateDefinitions(func(decls *Declarations) {
+					delete(decls.Functions, fmt.Sprintf("f%d", ii-1))
+				})
+			}
+		}
+	}()
+	go func() {
+		// Introspection requests.
+		defer wg.Done()
+		lines := strings.Split("func g() int { return 0 }", "\n")
+		for ii := 0; ii < 2*numCells; ii++ {
+			view, release, err := s.introspectionState()
+			if !assert.NoError(t, err) {
+				return
+			}
+			_, _, _, _, err = view.parseLinesAndComposeMain(nil, -1, lines, MakeSet[int](), NoCursor)
+			assert.NoError(t, err)
+			release()
+			_ = s.ShellHistory()
+		}
+	}()
+	wg.Wait()
+
+	assert.Contains(t, s.Definitions.Functions, fmt.Sprintf("f%d", numCells-1))
+	assert.NotContains(t, s.Definitions.Functions, "g")
+	assert.Len(t, s.ShellHistory(), numCells)
+}
@@ -0,0 +1,308 @@
+package goexec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the key/value store hosted by the kernel, that cell programs use (with `gonbui/store`)
+// to pass values from one cell to the next. See also `%store`.
+
+// Store is a key/value store that survives across the executions of the cells. The values are opaque bytes,
+// encoded by the cell programs, or files in the shared directory (see SetFile), used to hand large datasets
+// (e.g. Arrow record batches) from one cell to the next through shared memory.
+//
+// It can optionally be persisted to a file (see Persist), to survive kernel restarts.
+// It implements jpyexec.KeyValueStore, and it is safe for concurrent use.
+type Store struct {
+	mu          sync.Mutex
+	values      map[string][]byte
+	persistPath string
+
+	// files maps the keys of the file values to their paths, in sharedDir.
+	files     map[string]string
+	sharedDir string
+}
+
+// StoreEntry describes a value in the Store, see Store.Entries.
+type StoreEntry struct {
+	Key  string
+	Size int64
+
+	// File is set for values that are files in the shared directory, see Store.SetFile.
+	File bool
+}
+
+// NewStore returns an empty Store, not persisted.
+func NewStore() *Store {
+	return &Store{values: make(map[string][]byte), files: make(map[string]string)}
+}
+
+// sharedMemoryDir is the directory backed by memory where the shared directory is created, if it exists.
+const sharedMemoryDir = "/dev/shm"
+
+// createSharedDir creates the directory where the cell programs write the files handed to the next cells
+// (see SetFile): in sharedMemoryDir if available, otherwise in fallbackDir.
+func (st *Store) createSharedDir(name, fallbackDir string) error {
+	dir := filepath.Join(fallbackDir, "shared")
+	if info, err := os.Stat(sharedMemoryDir); err == nil && info.IsDir() {
+		dir = filepath.Join(sharedMemoryDir, name)
+	}
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return errors.Wrapf(err, "failed to create shared directory %q", dir)
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.sharedDir = dir
+	return nil
+}
+
+// SharedDir returns the directory where the cell programs create the files registered with SetFile.
+func (st *Store) SharedDir() string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.sharedDir
+}
+
+// Close removes the files of the store, and its shared directory.
+func (st *Store) Close() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.files = make(map[string]string)
+	if st.sharedDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(st.sharedDir)
+	st.sharedDir = ""
+	if err != nil {
+		return errors.Wrap(err, "failed to remove the shared directory of the store")
+	}
+	return nil
+}
+
+// Get returns the value of the key, and whether it was found. If isFile is set, the value is the path of the file
+// registered with SetFile.
+func (st *Store) Get(key string) (value []byte, isFile, found bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if filePath, found := st.files[key]; found {
+		return []byte(filePath), true, true
+	}
+	value, found = st.values[key]
+	return value, false, found
+}
+
+// Set the value of the key. If the store is persisted, it is saved.
+func (st *Store) Set(key string, value []byte) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.removeFileLocked(key)
+	st.values[key] = value
+	return st.persistLocked()
+}
+
+// SetFile sets the value of the key to the file in filePath, which must have been created in the shared
+// directory (see SharedDir). The store owns the file from then on: it is removed when the key is deleted or
+// replaced, or when the store is closed.
+//
+// Files are not saved with the store (see Save and Persist).
+func (st *Store) SetFile(key string, filePath string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	filePath = filepath.Clean(filePath)
+	if st.sharedDir == "" || filepath.Dir(filePath) != st.sharedDir {
+		return errors.Errorf("file %q is not in the shared directory %q", filePath, st.sharedDir)
+	}
+	if info, err := os.Stat(filePath); err != nil || !info.Mode().IsRegular() {
+		return errors.Errorf("file %q is not a regular file", filePath)
+	}
+	if previous, found := st.files[key]; !found || previous != filePath {
+		st.removeFileLocked(key)
+	}
+	st.files[key] = filePath
+	if _, found := st.values[key]; found {
+		delete(st.values, key)
+		return st.persistLocked()
+	}
+	return nil
+}
+
+// removeFileLocked removes the file value of the key, if any. It assumes st.mu is locked.
+func (st *Store) removeFileLocked(key string) {
+	filePath, found := st.files[key]
+	if !found {
+		return
+	}
+	delete(st.files, key)
+	if err := os.Remove(filePath); err != nil {
+		klog.Warningf("Failed to remove file %q of the store key %q: %+v", filePath, key, err)
+	}
+}
+
+// Delete the key, returning whether it was found. If the store is persisted, it is saved.
+func (st *Store) Delete(key string) (found bool, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, found = st.files[key]; found {
+		st.removeFileLocked(key)
+		return true, nil
+	}
+	if _, found = st.values[key]; !found {
+		return false, nil
+	}
+	delete(st.values, key)
+	return true, st.persistLocked()
+}
+
+// Keys returns the keys in the store, sorted.
+func (st *Store) Keys() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.keysLocked()
+}
+
+// keysLocked returns the keys of values and files, sorted. It assumes st.mu is locked.
+func (st *Store) keysLocked() []string {
+	keys := MakeSet[string](len(st.values) + len(st.files))
+	for key := range st.values {
+		keys.Insert(key)
+	}
+	for key := range st.files {
+		keys.Insert(key)
+	}
+	return SortedKeys(keys)
+}
+
+// Entries returns the keys in the store, sorted, with the sizes of their values.
+func (st *Store) Entries() []StoreEntry {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	keys := st.keysLocked()
+	entries := make([]StoreEntry, 0, len(keys))
+	for _, key := range keys {
+		if filePath, found := st.files[key]; found {
+			entry := StoreEntry{Key: key, File: true}
+			if info, err := os.Stat(filePath); err == nil {
+				entry.Size = info.Size()
+			}
+			entries = append(entries, entry)
+			continue
+		}
+		entries = append(entries, StoreEntry{Key: key, Size: int64(len(st.values[key]))})
+	}
+	return entries
+}
+
+// Clear removes all values and files. If the store is persisted, it is saved.
+func (st *Store) Clear() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for key := range st.files {
+		st.removeFileLocked(key)
+	}
+	st.values = make(map[string][]byte)
+	return st.persistLocked()
+}
+
+// Reset removes all values and files, and stops persisting the store -- the file where it was persisted is
+// left untouched. It is used when the kernel is restarted.
+func (st *Store) Reset() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for key := range st.files {
+		st.removeFileLocked(key)
+	}
+	st.values = make(map[string][]byte)
+	st.persistPath = ""
+}
+
+// Save the values of the store (but not the files, see SetFile) to the file in filePath.
+func (st *Store) Save(filePath string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.saveLocked(filePath)
+}
+
+// Load the values saved in filePath (see Save) into the store, replacing the values of the same keys.
+// If the store is persisted, it is saved.
+func (st *Store) Load(filePath string) error {
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read store from %q", filePath)
+	}
+	var values map[string][]byte
+	if err = gob.NewDecoder(bytes.NewReader(contents)).Decode(&values); err != nil {
+		return errors.Wrapf(err, "failed to decode store from %q", filePath)
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for key, value := range values {
+		st.removeFileLocked(key)
+		st.values[key] = value
+	}
+	return st.persistLocked()
+}
+
+// Persist the store in the file in filePath: if the file exists, its values are loaded first, and the store is
+// saved to it after every change. If filePath is empty, the store is no longer persisted.
+func (st *Store) Persist(filePath string) error {
+	if filePath != "" {
+		if _, err := os.Stat(filePath); err == nil {
+			if err = st.Load(filePath); err != nil {
+				return err
+			}
+		}
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.persistPath = filePath
+	return st.persistLocked()
+}
+
+// PersistPath returns the file where the store is persisted, or an empty string if it is not persisted.
+func (st *Store) PersistPath() string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.persistPath
+}
+
+// persistLocked saves the store, if it is persisted. It assumes st.mu is locked.
+func (st *Store) persistLocked() error {
+	if st.persistPath == "" {
+		return nil
+	}
+	return st.saveLocked(st.persistPath)
+}
+
+// saveLocked writes the values of the store to filePath, atomically (through a temporary file).
+// It assumes st.mu is locked.
+func (st *Store) saveLocked(filePath string) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(st.values); err != nil {
+		return errors.Wrap(err, "failed to encode store")
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "failed to save store to %q", filePath)
+	}
+	_, err = tmpFile.Write(buf.Bytes())
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), filePath)
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return errors.Wrapf(err, "failed to save store to %q", filePath)
+	}
+	klog.V(2).Infof("Saved store (%d keys) to %q", len(st.values), filePath)
+	return nil
+}
@@ -0,0 +1,96 @@
+package goexec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	st := NewStore()
+	require.NoError(t, st.Set("b", []byte("bb")))
+	require.NoError(t, st.Set("a", []byte("a")))
+	value, isFile, found := st.Get("b")
+	assert.True(t, found)
+	assert.False(t, isFile)
+	assert.Equal(t, []byte("bb"), value)
+	_, _, found = st.Get("c")
+	assert.False(t, found)
+	assert.Equal(t, []string{"a", "b"}, st.Keys())
+	assert.Equal(t, []StoreEntry{{Key: "a", Size: 1}, {Key: "b", Size: 2}}, st.Entries())
+
+	found, err := st.Delete("a")
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = st.Delete("a")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// Save and load.
+	filePath := filepath.Join(t.TempDir(), "store.gob")
+	require.NoError(t, st.Save(filePath))
+	st2 := NewStore()
+	require.NoError(t, st2.Set("c", []byte("c")))
+	require.NoError(t, st2.Load(filePath))
+	assert.Equal(t, []string{"b", "c"}, st2.Keys())
+	require.Error(t, st2.Load(filepath.Join(t.TempDir(), "missing.gob")))
+
+	// Persisted store: loads the existing file, and saves every change.
+	st3 := NewStore()
+	require.NoError(t, st3.Persist(filePath))
+	assert.Equal(t, filePath, st3.PersistPath())
+	assert.Equal(t, []string{"b"}, st3.Keys())
+	require.NoError(t, st3.Set("d", []byte("d")))
+	st4 := NewStore()
+	require.NoError(t, st4.Load(filePath))
+	assert.Equal(t, []string{"b", "d"}, st4.Keys())
+	require.NoError(t, st3.Clear())
+	require.NoError(t, st3.Persist(""))
+	require.NoError(t, st3.Set("e", []byte("e")))
+	st5 := NewStore()
+	require.NoError(t, st5.Load(filePath))
+	assert.Empty(t, st5.Keys())
+}
+
+func TestStoreFiles(t *testing.T) {
+	st := NewStore()
+	require.NoError(t, st.createSharedDir("gonb_test_"+UniqueId(), t.TempDir()))
+	sharedDir := st.SharedDir()
+	defer func() { require.NoError(t, st.Close()) }()
+
+	// Files must be in the shared directory.
+	outsidePath := filepath.Join(t.TempDir(), "data")
+	require.NoError(t, os.WriteFile(outsidePath, []byte("data"), 0600))
+	require.Error(t, st.SetFile("data", outsidePath))
+	require.Error(t, st.SetFile("data", filepath.Join(sharedDir, "missing")))
+
+	filePath := filepath.Join(sharedDir, "data")
+	require.NoError(t, os.WriteFile(filePath, []byte("data"), 0600))
+	require.NoError(t, st.Set("data", []byte("value")))
+	require.NoError(t, st.SetFile("data", filePath))
+	value, isFile, found := st.Get("data")
+	assert.True(t, found)
+	assert.True(t, isFile)
+	assert.Equal(t, filePath, string(value))
+	assert.Equal(t, []StoreEntry{{Key: "data", Size: 4, File: true}}, st.Entries())
+
+	// Replacing the value removes the file.
+	require.NoError(t, st.Set("data", []byte("value")))
+	assert.NoFileExists(t, filePath)
+	require.NoError(t, os.WriteFile(filePath, []byte("data"), 0600))
+	require.NoError(t, st.SetFile("data", filePath))
+	found, err := st.Delete("data")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.NoFileExists(t, filePath)
+
+	// Files are removed when the store is closed.
+	require.NoError(t, os.WriteFile(filePath, []byte("data"), 0600))
+	require.NoError(t, st.SetFile("data", filePath))
+	require.NoError(t, st.Close())
+	assert.NoDirExists(t, sharedDir)
+}
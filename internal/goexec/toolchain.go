@@ -0,0 +1,109 @@
+package goexec
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the selection of the Go toolchain, for environments that ship Go with conda-forge, asdf,
+// etc., where the PATH of the Jupyter server may differ from the one of a login shell.
+
+const (
+	// GoRootEnv is the environment variable that selects the GOROOT of the Go toolchain used by GoNB.
+	// Typically set in the `env` of `kernel.json` (see `--kernel-env` in `gonb --install`).
+	GoRootEnv = "GONB_GOROOT"
+
+	// GoBinaryEnv is the environment variable that selects the `go` binary used by GoNB. Its GOROOT
+	// is used as if it were given in GONB_GOROOT.
+	GoBinaryEnv = "GONB_GO_BINARY"
+)
+
+// SetupToolchain adopts the Go toolchain selected with GONB_GOROOT or GONB_GO_BINARY, if either is set: it is
+// validated, and its `bin` directory is prepended to PATH and GOROOT is set, so the `go` command executed by
+// GoNB (and by `gopls`) is the selected one.
+//
+// It returns the GOROOT of the selected toolchain, or an empty string if neither variable is set.
+// It should be called at the start of the kernel, before any `go` command is executed.
+func SetupToolchain() (string, error) {
+	root := os.Getenv(GoRootEnv)
+	if goBinary := os.Getenv(GoBinaryEnv); goBinary != "" {
+		binaryRoot, err := toolchainGoEnv(goBinary, "GOROOT")
+		if err != nil {
+			return "", errors.WithMessagef(err, "invalid %s=%q", GoBinaryEnv, goBinary)
+		}
+		if root == "" {
+			root = binaryRoot
+		} else if !sameDir(root, binaryRoot) {
+			return "", errors.Errorf("%s=%q and %s=%q (whose GOROOT is %q) select different toolchains",
+				GoRootEnv, root, GoBinaryEnv, goBinary, binaryRoot)
+		}
+	}
+	if root == "" {
+		return "", nil
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid %s=%q", GoRootEnv, root)
+	}
+	goVersion, err := toolchainGoEnv(filepath.Join(root, "bin", "go"), "GOVERSION")
+	if err != nil {
+		return "", errors.WithMessagef(err, "invalid Go toolchain in GOROOT %q", root)
+	}
+	if err = os.Setenv("GOROOT", root); err != nil {
+		return "", errors.Wrap(err, "failed to set GOROOT")
+	}
+	path := filepath.Join(root, "bin")
+	if currentPath := os.Getenv("PATH"); currentPath != "" {
+		path += string(os.PathListSeparator) + currentPath
+	}
+	if err = os.Setenv("PATH", path); err != nil {
+		return "", errors.Wrap(err, "failed to set PATH")
+	}
+	goRoot = root // Cache used by GoRoot().
+	klog.Infof("Using Go toolchain %s from GOROOT=%q", goVersion, root)
+	return root, nil
+}
+
+// toolchainGoEnv returns the value of the `go env` variable key, as reported by the given `go` binary.
+func toolchainGoEnv(goBinary, key string) (string, error) {
+	info, err := os.Stat(goBinary)
+	if err != nil {
+		return "", errors.Wrapf(err, "`go` binary %q not found", goBinary)
+	}
+	if info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return "", errors.Errorf("`go` binary %q is not an executable file", goBinary)
+	}
+	cmd := exec.Command(goBinary, "env", key)
+	cmd.Env = os.Environ()
+	for ii, v := range cmd.Env {
+		if strings.HasPrefix(v, "GOROOT=") {
+			// A GOROOT from a different toolchain would confuse the binary.
+			cmd.Env[ii] = "GOROOT="
+		}
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to run `%s env %s`: %s", goBinary, key, output)
+	}
+	value := strings.TrimSpace(string(output))
+	if value == "" {
+		return "", errors.Errorf("`%s env %s` returned nothing", goBinary, key)
+	}
+	return value, nil
+}
+
+// sameDir returns whether the paths a and b point to the same directory.
+func sameDir(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return os.SameFile(infoA, infoB)
+}
@@ -0,0 +1,54 @@
+package goexec
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupToolchain(t *testing.T) {
+	output, err := exec.Command("go", "env", "GOROOT").Output()
+	require.NoError(t, err)
+	systemRoot := strings.TrimSpace(string(output))
+	defer func(cached string) { goRoot = cached }(goRoot)
+
+	// Restored at the end of the test.
+	t.Setenv("PATH", os.Getenv("PATH"))
+	t.Setenv("GOROOT", os.Getenv("GOROOT"))
+
+	// No override.
+	t.Setenv(GoRootEnv, "")
+	t.Setenv(GoBinaryEnv, "")
+	root, err := SetupToolchain()
+	require.NoError(t, err)
+	assert.Empty(t, root)
+
+	// GONB_GOROOT.
+	t.Setenv(GoRootEnv, systemRoot)
+	root, err = SetupToolchain()
+	require.NoError(t, err)
+	assert.Equal(t, systemRoot, root)
+	assert.Equal(t, systemRoot, os.Getenv("GOROOT"))
+	assert.True(t, strings.HasPrefix(os.Getenv("PATH"), filepath.Join(systemRoot, "bin")))
+
+	// GONB_GO_BINARY.
+	t.Setenv(GoRootEnv, "")
+	t.Setenv(GoBinaryEnv, filepath.Join(systemRoot, "bin", "go"))
+	root, err = SetupToolchain()
+	require.NoError(t, err)
+	assert.True(t, sameDir(systemRoot, root))
+
+	// Invalid toolchains.
+	t.Setenv(GoRootEnv, t.TempDir())
+	_, err = SetupToolchain()
+	assert.Error(t, err)
+	t.Setenv(GoRootEnv, "")
+	t.Setenv(GoBinaryEnv, filepath.Join(t.TempDir(), "go"))
+	_, err = SetupToolchain()
+	assert.Error(t, err)
+}
@@ -0,0 +1,177 @@
+package goexec
+
+import (
+	"fmt"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"html"
+	"k8s.io/klog/v2"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// This file implements the HTML rendering of the traceback of a panic (or fatal error) of the cell program:
+// frames in the cell code are shown with an excerpt of the cell, frames in tracked local packages are linked
+// to their files, and frames of the Go runtime are collapsed.
+
+// MaxTracebackBufferSize is the maximum number of bytes of the tail of stderr kept to search for a traceback.
+const MaxTracebackBufferSize = 256 * 1024
+
+// tracebackExcerptContext is the number of lines shown before and after the line of a frame in the cell.
+const tracebackExcerptContext = 1
+
+// tracebackFrame is one frame of the stack of the goroutine that panicked.
+type tracebackFrame struct {
+	Function string // E.g.: "main.f(...)"
+	File     string
+	Line     int // 1-based, as reported by Go.
+}
+
+// IsRuntime returns whether the frame is from the Go runtime.
+func (f *tracebackFrame) IsRuntime() bool {
+	return strings.HasPrefix(f.Function, "runtime.") || strings.HasPrefix(f.Function, "panic(")
+}
+
+// traceback is a parsed Go panic (or fatal error) output.
+type traceback struct {
+	Header []string // Lines of the panic message, e.g.: "panic: boom".
+	Frames []*tracebackFrame
+}
+
+var (
+	reTracebackStart = regexp.MustCompile(`(?m)^(panic: |fatal error: )`)
+	reTracebackFile  = regexp.MustCompile(`^\t(.+):(\d+)( \+0x[0-9a-f]+)?$`)
+)
+
+// parseTraceback finds the last panic (or fatal error) in the output of a program, and parses the stack of the
+// goroutine that caused it. It returns nil if no traceback is found.
+func parseTraceback(output string) *traceback {
+	matches := reTracebackStart.FindAllStringIndex(output, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	lines := strings.Split(output[matches[len(matches)-1][0]:], "\n")
+	tb := &traceback{}
+	ii := 0
+	for ; ii < len(lines) && !strings.HasPrefix(lines[ii], "goroutine "); ii++ {
+		if line := strings.TrimRight(lines[ii], " "); line != "" {
+			tb.Header = append(tb.Header, line)
+		}
+	}
+	// Frames of the first goroutine, until an empty line.
+	for ii++; ii+1 < len(lines) && lines[ii] != ""; ii += 2 {
+		fileMatch := reTracebackFile.FindStringSubmatch(lines[ii+1])
+		if fileMatch == nil {
+			break
+		}
+		lineNum, _ := strconv.Atoi(fileMatch[2])
+		tb.Frames = append(tb.Frames, &tracebackFrame{Function: lines[ii], File: fileMatch[1], Line: lineNum})
+	}
+	if len(tb.Frames) == 0 {
+		return nil
+	}
+	return tb
+}
+
+// renderTracebackHtml renders the traceback in HTML. Frames in mainPath are annotated with their cell and line,
+// along with an excerpt of the code. Frames in files under trackedRoots (local packages being developed) are
+// linked to their files. Consecutive runtime frames are collapsed.
+func renderTracebackHtml(tb *traceback, mainPath string, fileToCellIdAndLine []CellIdAndLine, trackedRoots []string) string {
+	var mainLines []string
+	if contents, err := os.ReadFile(mainPath); err == nil {
+		mainLines = strings.Split(string(contents), "\n")
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<div style="border-left: 4px solid #d9534f; padding-left: 8px">` + "\n")
+	for _, line := range tb.Header {
+		fmt.Fprintf(&sb, "<b>%s</b><br/>\n", html.EscapeString(line))
+	}
+	sb.WriteString("<ul>\n")
+	var runtimeFrames []string
+	flushRuntimeFrames := func() {
+		if len(runtimeFrames) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "<li><details><summary>%d runtime frame(s)</summary><pre>%s</pre></details></li>\n",
+			len(runtimeFrames), strings.Join(runtimeFrames, "\n"))
+		runtimeFrames = runtimeFrames[:0]
+	}
+	for _, frame := range tb.Frames {
+		if frame.IsRuntime() {
+			runtimeFrames = append(runtimeFrames, html.EscapeString(fmt.Sprintf("%s\n\t%s:%d", frame.Function, frame.File, frame.Line)))
+			continue
+		}
+		flushRuntimeFrames()
+		fileIdx := frame.Line - 1
+		if frame.File != mainPath || fileIdx < 0 || fileIdx >= len(fileToCellIdAndLine) {
+			location := fmt.Sprintf("<code>%s:%d</code>", html.EscapeString(frame.File), frame.Line)
+			if isUnderRoots(frame.File, trackedRoots) {
+				location = fmt.Sprintf(`<a href="%s" target="_blank">%s</a>`, html.EscapeString(fileURL(frame.File)), location)
+			}
+			fmt.Fprintf(&sb, "<li><code>%s</code> at %s</li>\n", html.EscapeString(frame.Function), location)
+			continue
+		}
+		cellIdAndLine := fileToCellIdAndLine[fileIdx]
+		location := fmt.Sprintf("Cell Line %d", cellIdAndLine.Line+1)
+		if cellIdAndLine.Id != -1 {
+			location = fmt.Sprintf("Cell [%d] Line %d", cellIdAndLine.Id, cellIdAndLine.Line+1)
+		}
+		fmt.Fprintf(&sb, "<li><code>%s</code> at <b>%s</b>\n<pre>%s</pre></li>\n",
+			html.EscapeString(frame.Function), location,
+			html.EscapeString(tracebackExcerpt(mainLines, fileIdx, fileToCellIdAndLine)))
+	}
+	flushRuntimeFrames()
+	sb.WriteString("</ul>\n</div>\n")
+	return sb.String()
+}
+
+// fileURL returns a URL to open the file: if it is under the Jupyter root directory, it is served by Jupyter,
+// otherwise it is a `file://` URL.
+func fileURL(filePath string) string {
+	if jupyterRoot, err := JupyterRootDirectory(); err == nil {
+		if relPath, err := filepath.Rel(jupyterRoot, filePath); err == nil && !strings.HasPrefix(relPath, "..") {
+			return JupyterFilesUrl(relPath)
+		}
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filePath)}).String()
+}
+
+// tracebackExcerpt returns the lines around fileIdx (0-based) of the generated code, numbered with their cell
+// line numbers, and with the line fileIdx marked.
+func tracebackExcerpt(mainLines []string, fileIdx int, fileToCellIdAndLine []CellIdAndLine) string {
+	cellId := fileToCellIdAndLine[fileIdx].Id
+	var parts []string
+	for idx := fileIdx - tracebackExcerptContext; idx <= fileIdx+tracebackExcerptContext; idx++ {
+		if idx < 0 || idx >= len(mainLines) || idx >= len(fileToCellIdAndLine) {
+			continue
+		}
+		cellIdAndLine := fileToCellIdAndLine[idx]
+		if cellIdAndLine.Id != cellId || cellIdAndLine.Line == NoCursorLine {
+			// Line is not from the same cell.
+			continue
+		}
+		marker := "  "
+		if idx == fileIdx {
+			marker = "→ "
+		}
+		parts = append(parts, fmt.Sprintf("%s%4d: %s", marker, cellIdAndLine.Line+1, mainLines[idx]))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// publishTraceback publishes an HTML rendering of the traceback of a panic, if one was written to the stream.
+// It should be called after the program finished executing.
+func (w *jupyterStackTraceMapperWriter) publishTraceback() {
+	tb := parseTraceback(string(w.tail))
+	if tb == nil {
+		return
+	}
+	err := kernel.PublishHtml(w.msg, renderTracebackHtml(tb, w.mainPath, w.fileToCellIdAndLine, w.trackedRoots))
+	if err != nil {
+		klog.Errorf("Failed to publish traceback: %+v", err)
+	}
+}
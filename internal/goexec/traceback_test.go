@@ -0,0 +1,50 @@
+package goexec
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestTraceback(t *testing.T) {
+	mainPath := path.Join(t.TempDir(), "main.go")
+	code := "package main\n\nfunc f() {\n\tpanic(\"boom\")\n}\n\nfunc main() {\n\tf()\n}\n"
+	require.NoError(t, os.WriteFile(mainPath, []byte(code), 0600))
+	// Cell [3] has `f` in lines 0-2, and cell [4] has the `f()` call in line 5.
+	fileToCellIdAndLine := []CellIdAndLine{{-1, -1}, {-1, -1}, {3, 0}, {3, 1}, {3, 2}, {-1, -1}, {4, 4}, {4, 5}, {4, 6}}
+
+	output := "some output\npanic: boom\n\ngoroutine 1 [running]:\n" +
+		"main.f(...)\n\t" + mainPath + ":4\n" +
+		"main.main()\n\t" + mainPath + ":8 +0x25\n" +
+		"runtime.main()\n\t/usr/local/go/src/runtime/proc.go:272 +0x28d\n" +
+		"\ngoroutine 2 [running]:\nmain.other()\n\t" + mainPath + ":1\n"
+	tb := parseTraceback(output)
+	require.NotNil(t, tb)
+	assert.Equal(t, []string{"panic: boom"}, tb.Header)
+	require.Len(t, tb.Frames, 3)
+	assert.Equal(t, "main.main()", tb.Frames[1].Function)
+	assert.Equal(t, 8, tb.Frames[1].Line)
+	assert.True(t, tb.Frames[2].IsRuntime())
+
+	html := renderTracebackHtml(tb, mainPath, fileToCellIdAndLine, nil)
+	assert.Contains(t, html, "<b>panic: boom</b>")
+	assert.Contains(t, html, "<b>Cell [3] Line 2</b>")
+	assert.Contains(t, html, "→    2: \tpanic(&#34;boom&#34;)")
+	assert.Contains(t, html, "<b>Cell [4] Line 6</b>")
+	assert.Contains(t, html, "<details><summary>1 runtime frame(s)</summary>")
+
+	assert.Nil(t, parseTraceback("no panic here\n"))
+}
+
+func TestTracebackTrackedLinks(t *testing.T) {
+	output := "panic: boom\n\ngoroutine 1 [running]:\n" +
+		"mylib.F()\n\t/home/user/mylib/f.go:10 +0x25\n" +
+		"other.G()\n\t/home/user/other/g.go:20 +0x25\n"
+	tb := parseTraceback(output)
+	require.NotNil(t, tb)
+	html := renderTracebackHtml(tb, "/tmp/main.go", nil, []string{"/home/user/mylib"})
+	assert.Contains(t, html, `<a href="file:///home/user/mylib/f.go" target="_blank"><code>/home/user/mylib/f.go:10</code></a>`)
+	assert.Contains(t, html, "<code>/home/user/other/g.go:20</code></li>")
+}
@@ -0,0 +1,120 @@
+package goexec
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/janpfeifer/gonb/common"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the guardrails of tracking: tracking a directory with too many files, or that resolves
+// into the Go module cache (e.g. after a `replace` in `go.mod` pointing to it), could hang the kernel walking
+// and watching huge trees. Those are refused, unless forced with TrackOptions.Force.
+
+// MaxTrackedFiles is the maximum number of files (not ignored) under a directory tracked without
+// TrackOptions.Force.
+var MaxTrackedFiles = 10_000
+
+// TrackOptions configure State.TrackWithOptions.
+type TrackOptions struct {
+	// Ignore patterns of files and subdirectories not to track, see matchIgnorePattern.
+	Ignore []string
+
+	// Force tracking of directories with more than MaxTrackedFiles files, or in the Go module cache.
+	Force bool
+}
+
+// moduleCache is the Go module cache directory (`go env GOMODCACHE`), cached by moduleCacheDir.
+var moduleCache string
+
+// moduleCacheDir returns the Go module cache directory, or an empty string if it can't be found.
+func moduleCacheDir() string {
+	if moduleCache != "" {
+		return moduleCache
+	}
+	output, err := exec.Command("go", "env", "GOMODCACHE").Output()
+	if err == nil {
+		moduleCache = strings.TrimSpace(string(output))
+	}
+	if moduleCache == "" {
+		if goPath := os.Getenv("GOPATH"); goPath != "" {
+			moduleCache = path.Join(filepath.SplitList(goPath)[0], "pkg", "mod")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			moduleCache = path.Join(home, "go", "pkg", "mod")
+		}
+	}
+	if resolved, err := filepath.EvalSymlinks(moduleCache); err == nil {
+		moduleCache = resolved
+	}
+	return moduleCache
+}
+
+// isInModuleCache returns whether fileOrDirPath, after resolving symbolic links, is in the Go module cache.
+func isInModuleCache(fileOrDirPath string) bool {
+	cacheDir := moduleCacheDir()
+	if cacheDir == "" {
+		return false
+	}
+	resolved, err := filepath.EvalSymlinks(fileOrDirPath)
+	if err != nil {
+		resolved = fileOrDirPath
+	}
+	if resolved, err = filepath.Abs(resolved); err != nil {
+		return false
+	}
+	return isUnderRoots(resolved, []string{cacheDir})
+}
+
+// errTooManyFiles interrupts the walk of checkTrackGuardrails.
+var errTooManyFiles = errors.New("too many files")
+
+// checkTrackGuardrails returns an error if the entry (not yet tracked) shouldn't be tracked: if it's in the
+// Go module cache, or if it's a directory with more than MaxTrackedFiles files.
+// It always succeeds for forced entries.
+func checkTrackGuardrails(root string, entry *trackEntry) error {
+	if entry.force {
+		return nil
+	}
+	if isInModuleCache(entry.resolvedName) {
+		return errors.Errorf("%q is in the Go module cache %q, which is read-only and can be huge: "+
+			"use `%%track --force %s` to track it anyway", root, moduleCacheDir(), root)
+	}
+	if !entry.IsDir {
+		return nil
+	}
+	var numFiles int
+	err := common.WalkDirWithSymbolicLinks(entry.resolvedName, func(entryPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if entryPath != entry.resolvedName && (entry.isIgnored(entryPath, true) || isInModuleCache(entryPath)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || entry.isIgnored(entryPath, false) {
+			// Symbolic links are followed and counted separately.
+			return nil
+		}
+		numFiles++
+		if numFiles > MaxTrackedFiles {
+			return errTooManyFiles
+		}
+		return nil
+	})
+	if errors.Is(err, errTooManyFiles) {
+		return errors.Errorf("%q has more than %d files: use `--ignore <patterns>` to exclude some of them, "+
+			"or `%%track --force %s` to track it anyway", root, MaxTrackedFiles, root)
+	}
+	if err != nil {
+		klog.Warningf("Failed to count files under %q to track: %+v", root, err)
+	}
+	return nil
+}
@@ -11,7 +11,9 @@ import (
 	"k8s.io/klog/v2"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -21,6 +23,14 @@ import (
 // are sent to `gopls` to update its contents for auto-complete and contextual info
 // (`InspectRequest`) requests.
 
+// Directories are watched recursively: each subdirectory is watched (fsnotify doesn't support recursion), and
+// subdirectories created later are watched as they appear. Events are batched by directory, and only processed
+// after TrackDebounce without new events, so rapid changes (e.g.: `git checkout`) are handled once.
+
+// TrackDebounce is the time without new file system events after which the batched events of tracked files
+// are processed. Changes only affect States created afterward.
+var TrackDebounce = 100 * time.Millisecond
+
 // trackingInfo is a substructure of State that holds all the tracking information.
 type trackingInfo struct {
 	// mu protects tracking information
@@ -35,6 +45,16 @@ type trackingInfo struct {
 	// watcher for files being tracked. It is notified of file system changes.
 	watcher *fsnotify.Watcher
 
+	// watchCount holds the number of tracked entries watching each directory: the watch is only removed
+	// when no entry needs it.
+	watchCount map[string]int
+
+	// pending holds the events batched by directory, waiting to be processed by flushLocked:
+	// the changed files of each directory, or nil if the directory itself was created.
+	pending    map[string]common.Set[string]
+	flushTimer *time.Timer
+	debounce   time.Duration
+
 	// go.mod and go.work last modification time, used for the AutoTrack
 	goModModTime, goWorkModTime time.Time
 }
@@ -44,36 +64,74 @@ type trackEntry struct {
 	IsDir          bool
 	UpdatedModTime time.Time
 	resolvedName   string // Final file name, after resolving symbolic links.
+
+	// ignore patterns, matched against the path relative to resolvedName, see matchIgnorePattern.
+	ignore []string
+
+	// force tracking, bypassing the guardrails, see TrackOptions.Force.
+	force bool
+
+	// dirs watched for this entry. For a file, it is the directory of the file.
+	dirs common.Set[string]
 }
 
 func newTrackingInfo() *trackingInfo {
 	return &trackingInfo{
-		tracked: make(map[string]*trackEntry),
-		updated: common.MakeSet[string](),
+		tracked:    make(map[string]*trackEntry),
+		updated:    common.MakeSet[string](),
+		watchCount: make(map[string]int),
+		pending:    make(map[string]common.Set[string]),
+		debounce:   TrackDebounce,
 	}
 }
 
 // Track adds the fileOrDirPath to the list of tracked files and directories.
-// If fileOrDirPath is already tracked, it's a no-op.
+// If fileOrDirPath is already tracked with the same ignore patterns, it's a no-op.
+//
+// Directories are tracked recursively, except for the files and subdirectories matching one of the ignore
+// patterns (e.g. `vendor/**` or `**/*_gen.go`), see matchIgnorePattern.
 //
 // If the fileOrDirPath pointed is a symbolic link, follow instead the linked
 // file/directory.
-func (s *State) Track(fileOrDirPath string) (err error) {
+//
+// Directories with more than MaxTrackedFiles files, or in the Go module cache, are refused: see
+// TrackWithOptions to force tracking them.
+func (s *State) Track(fileOrDirPath string, ignore ...string) (err error) {
+	return s.TrackWithOptions(fileOrDirPath, TrackOptions{Ignore: ignore})
+}
+
+// TrackWithOptions is like Track, but with the given options.
+func (s *State) TrackWithOptions(fileOrDirPath string, options TrackOptions) (err error) {
+	ignore := options.Ignore
+	for _, pattern := range ignore {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid ignore pattern %q to track %q", pattern, fileOrDirPath)
+		}
+	}
 	ti := s.trackingInfo
 	ti.mu.Lock()
 	defer ti.mu.Unlock()
 
+	if entry, found := ti.tracked[fileOrDirPath]; found {
+		if slices.Equal(entry.ignore, ignore) && entry.force == options.Force {
+			return
+		}
+		// Track again with the new options.
+		if err = s.lockedUntrackEntry(fileOrDirPath); err != nil {
+			return
+		}
+	}
 	visited := common.MakeSet[string]()
-	return s.lockedTrack(fileOrDirPath, fileOrDirPath, visited)
+	return s.lockedTrack(fileOrDirPath, fileOrDirPath, options, visited)
 }
 
 // lockedTrack is the implementation of Track, it assumes `trackingInfo` is locked.
 // root is the original file path, while fileOrDirPath is the one after symbolic link resolution.
 // The visited set is used to prevent infinite loops with symbolic links.
-func (s *State) lockedTrack(root, fileOrDirPath string, visited common.Set[string]) (err error) {
+func (s *State) lockedTrack(root, fileOrDirPath string, options TrackOptions, visited common.Set[string]) (err error) {
 	// Check for infinite loops in symbolic links.
 	if visited.Has(fileOrDirPath) {
-		err = errors.Wrapf(err, "Track(%q) self-symbolic infinite loop: %v", root, visited)
+		err = errors.Errorf("Track(%q) self-symbolic infinite loop: %v", root, visited)
 		return err
 	}
 	visited.Insert(fileOrDirPath)
@@ -100,8 +158,11 @@ func (s *State) lockedTrack(root, fileOrDirPath string, visited common.Set[strin
 			err = errors.Wrapf(err, "Track(%q) failed to resolve symlink %q", root, fileOrDirPath)
 			return err
 		}
+		if !filepath.IsAbs(linkedPath) {
+			linkedPath = path.Join(path.Dir(fileOrDirPath), linkedPath)
+		}
 		klog.V(2).Infof("Track(%q): following symbolic link to %q", root, linkedPath)
-		return s.lockedTrack(root, linkedPath, visited)
+		return s.lockedTrack(root, linkedPath, options, visited)
 	}
 
 	// Create entry.
@@ -109,74 +170,270 @@ func (s *State) lockedTrack(root, fileOrDirPath string, visited common.Set[strin
 		IsDir:          fileInfo.IsDir(),
 		UpdatedModTime: fileInfo.ModTime(),
 		resolvedName:   fileOrDirPath,
+		ignore:         options.Ignore,
+		force:          options.Force,
+		dirs:           common.MakeSet[string](),
+	}
+	if err = checkTrackGuardrails(root, entry); err != nil {
+		return
+	}
+	if err = ti.startWatcherLocked(); err != nil {
+		return errors.WithMessagef(err, "not able to track %q", fileOrDirPath)
 	}
 	ti.tracked[root] = entry
-
-	// Add watcher.
-	if ti.watcher == nil {
-		ti.watcher, err = fsnotify.NewWatcher()
-		if err != nil {
-			err = errors.Wrapf(err, "failed to create a filesystem watcher, not able to track file %q", fileOrDirPath)
+	if !entry.IsDir {
+		// Files are watched through their directory, so they are not lost when editors replace them.
+		if err = ti.watchLocked(entry, path.Dir(fileOrDirPath)); err != nil {
 			return
 		}
-		go func() {
-			klog.V(2).Infof("goexec.State.Track(): Starting to listen to watcher")
-			defer klog.V(2).Infof("goexec.State.Track(): Stopped to listen to watcher")
-
-			for {
-				select {
-				case event, ok := <-ti.watcher.Events:
-					if !ok {
-						return
-					}
-					if event.Op != fsnotify.Write && event.Op != fsnotify.Remove {
-						// Not interested.
-						continue
-					}
-					if !isGoRelated(event.Name) {
-						// Not interested.
-						continue
-					}
-					ti.mu.Lock()
-					klog.V(2).Infof("goexec.Track: updates to %q", event.Name)
-					ti.updated.Insert(event.Name)
-					ti.mu.Unlock()
-				case err, ok := <-ti.watcher.Errors:
-					klog.V(2).Infof("goexec.Track: async err received %+v", err)
-					if !ok {
-						return
-					}
+		ti.updated.Insert(fileOrDirPath)
+		return
+	}
+	return ti.addDirLocked(entry, fileOrDirPath)
+}
+
+// startWatcherLocked creates the file system watcher, if not yet created, and the goroutine that listens to it.
+func (ti *trackingInfo) startWatcherLocked() (err error) {
+	if ti.watcher != nil {
+		return
+	}
+	ti.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		err = errors.Wrap(err, "failed to create a filesystem watcher")
+		return
+	}
+	watcher := ti.watcher
+	go func() {
+		klog.V(2).Infof("goexec.State.Track(): Starting to listen to watcher")
+		defer klog.V(2).Infof("goexec.State.Track(): Stopped to listen to watcher")
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				ti.handleEvent(event)
+			case err, ok := <-watcher.Errors:
+				klog.V(2).Infof("goexec.Track: async err received %+v", err)
+				if !ok {
+					return
 				}
 			}
-		}()
+		}
+	}()
+	return
+}
+
+// handleEvent batches the file system event to be processed by flushLocked, after TrackDebounce without new events.
+// Removed directories are unwatched immediately.
+func (ti *trackingInfo) handleEvent(event fsnotify.Event) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	klog.V(2).Infof("goexec.Track: event %s", event)
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		if _, watched := ti.watchCount[event.Name]; watched {
+			ti.unwatchTreeLocked(event.Name)
+			return
+		}
 	}
-	err = ti.watcher.Add(fileOrDirPath)
-	if err != nil {
-		err = errors.Wrapf(err, "Failed to watch tracked file/directory %q", fileOrDirPath)
+	dir := path.Dir(event.Name)
+	if event.Has(fsnotify.Create) {
+		if fileInfo, err := os.Stat(event.Name); err == nil && fileInfo.IsDir() {
+			// New directory: it is walked (and watched) when flushed.
+			ti.pending[event.Name] = nil
+			ti.scheduleFlushLocked()
+			return
+		}
+	}
+	if !isGoRelated(event.Name) {
+		// Not interested.
 		return
 	}
+	if files, found := ti.pending[dir]; !found {
+		ti.pending[dir] = common.MakeSet[string]()
+	} else if files == nil {
+		// Directory was created, it will be walked anyway.
+		return
+	}
+	ti.pending[dir].Insert(event.Name)
+	ti.scheduleFlushLocked()
+}
 
-	if entry.IsDir {
-		err = common.WalkDirWithSymbolicLinks(fileOrDirPath, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return errors.Wrapf(err, "failed to track file under tracked directory %q", fileOrDirPath)
+// scheduleFlushLocked (re-)starts the debounce timer to process the batched events.
+func (ti *trackingInfo) scheduleFlushLocked() {
+	if ti.flushTimer != nil {
+		ti.flushTimer.Stop()
+	}
+	ti.flushTimer = time.AfterFunc(ti.debounce, func() {
+		ti.mu.Lock()
+		defer ti.mu.Unlock()
+		ti.flushLocked()
+	})
+}
+
+// flushLocked processes the batched events: new directories are walked (and watched), and changed files
+// are marked as updated, if they belong to a tracked entry and are not ignored.
+func (ti *trackingInfo) flushLocked() {
+	ti.flushTimer = nil
+	for _, dir := range common.SortedKeys(ti.pending) {
+		files := ti.pending[dir]
+		if files == nil {
+			// New directory.
+			for _, entry := range ti.ownersLocked(dir, true) {
+				if err := ti.addDirLocked(entry, dir); err != nil {
+					klog.Warningf("Failed to track new directory %q: %+v", dir, err)
+				}
 			}
-			if d.IsDir() || !isGoRelated(path) {
-				// Directories or files we don't care about.
-				return nil
+			continue
+		}
+		for filePath := range files {
+			if len(ti.ownersLocked(filePath, false)) > 0 {
+				klog.V(2).Infof("goexec.Track: updates to %q", filePath)
+				ti.updated.Insert(filePath)
 			}
-			if !ti.updated.Has(path) {
-				ti.updated.Insert(path)
-				klog.V(2).Infof("tracking %q: added file for update %q", fileOrDirPath, path)
+		}
+	}
+	clear(ti.pending)
+}
+
+// ownersLocked returns the tracked entries that include fileOrDirPath, and don't ignore it.
+func (ti *trackingInfo) ownersLocked(fileOrDirPath string, isDir bool) (owners []*trackEntry) {
+	dir := path.Dir(fileOrDirPath)
+	for _, entry := range ti.tracked {
+		if entry.IsDir {
+			if entry.dirs.Has(dir) && !entry.isIgnored(fileOrDirPath, isDir) {
+				owners = append(owners, entry)
 			}
-			return nil
-		})
-	} else {
-		ti.updated.Insert(fileOrDirPath)
+		} else if entry.resolvedName == fileOrDirPath {
+			owners = append(owners, entry)
+		}
 	}
 	return
 }
 
+// addDirLocked walks dir, watching it and its subdirectories for the entry, and marks its Go files as updated.
+func (ti *trackingInfo) addDirLocked(entry *trackEntry, dir string) error {
+	return common.WalkDirWithSymbolicLinks(dir, func(entryPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.Wrapf(err, "failed to track file under tracked directory %q", dir)
+		}
+		if d.IsDir() {
+			if entryPath != entry.resolvedName && entry.isIgnored(entryPath, true) {
+				return filepath.SkipDir
+			}
+			if !entry.force && isInModuleCache(entryPath) {
+				klog.V(1).Infof("tracking %q: skipping %q in the Go module cache", dir, entryPath)
+				return filepath.SkipDir
+			}
+			return ti.watchLocked(entry, entryPath)
+		}
+		if !isGoRelated(entryPath) || entry.isIgnored(entryPath, false) {
+			// Files we don't care about.
+			return nil
+		}
+		if !ti.updated.Has(entryPath) {
+			ti.updated.Insert(entryPath)
+			klog.V(2).Infof("tracking %q: added file for update %q", dir, entryPath)
+		}
+		return nil
+	})
+}
+
+// watchLocked adds dir to the directories watched for entry.
+func (ti *trackingInfo) watchLocked(entry *trackEntry, dir string) error {
+	if entry.dirs.Has(dir) {
+		return nil
+	}
+	if ti.watchCount[dir] == 0 {
+		if err := ti.watcher.Add(dir); err != nil {
+			return errors.Wrapf(err, "Failed to watch tracked directory %q", dir)
+		}
+	}
+	ti.watchCount[dir]++
+	entry.dirs.Insert(dir)
+	return nil
+}
+
+// unwatchLocked removes dir from the directories watched for entry.
+func (ti *trackingInfo) unwatchLocked(entry *trackEntry, dir string) {
+	if !entry.dirs.Has(dir) {
+		return
+	}
+	entry.dirs.Delete(dir)
+	ti.watchCount[dir]--
+	if ti.watchCount[dir] > 0 {
+		return
+	}
+	delete(ti.watchCount, dir)
+	if err := ti.watcher.Remove(dir); err != nil {
+		// Directories removed from the file system are automatically unwatched.
+		klog.V(2).Infof("goexec.Untrack failed to remove watch of %q: %+v", dir, err)
+	}
+}
+
+// unwatchTreeLocked removes the watches of the removed directory dir and its subdirectories, in all entries.
+func (ti *trackingInfo) unwatchTreeLocked(dir string) {
+	for _, entry := range ti.tracked {
+		for _, watchedDir := range common.SortedKeys(entry.dirs) {
+			if watchedDir == dir || strings.HasPrefix(watchedDir, dir+"/") {
+				ti.unwatchLocked(entry, watchedDir)
+			}
+		}
+	}
+}
+
+// isIgnored returns whether fileOrDirPath matches one of the ignore patterns of the entry.
+// Paths outside the tracked directory (e.g.: followed symbolic links) are matched by their absolute path.
+func (entry *trackEntry) isIgnored(fileOrDirPath string, isDir bool) bool {
+	if len(entry.ignore) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(entry.resolvedName, fileOrDirPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		rel = strings.TrimPrefix(fileOrDirPath, "/")
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range entry.ignore {
+		if matchIgnorePattern(pattern, rel) {
+			return true
+		}
+		// `dir/*` or `dir/**` also ignore the directory itself.
+		if isDir && matchIgnorePattern(pattern, rel+"/_") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchIgnorePattern reports whether the slash-separated relative path matches the pattern: each path element
+// is matched with path.Match, and `**` matches any number (including zero) of path elements.
+// E.g.: `vendor/**` matches everything under `vendor` and `**/*_gen.go` matches the `_gen.go` files in any directory.
+func matchIgnorePattern(pattern, relPath string) bool {
+	return matchPathElements(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+}
+
+func matchPathElements(patternElems, pathElems []string) bool {
+	for len(patternElems) > 0 {
+		if patternElems[0] == "**" {
+			for skip := 0; skip <= len(pathElems); skip++ {
+				if matchPathElements(patternElems[1:], pathElems[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(pathElems) == 0 {
+			return false
+		}
+		if matched, err := path.Match(patternElems[0], pathElems[0]); err != nil || !matched {
+			return false
+		}
+		patternElems, pathElems = patternElems[1:], pathElems[1:]
+	}
+	return len(pathElems) == 0
+}
+
 // Untrack removes file or dir from path of tracked files. If it ends with "...", it un-tracks
 // anything that has fileOrDirPath as prefix. If you set `fileOrDirPath == "..."`, it will
 // un-tracks everything.
@@ -213,11 +470,9 @@ func (s *State) lockedUntrackEntry(fileOrDirPath string) (err error) {
 	}
 	delete(ti.tracked, fileOrDirPath)
 
-	// Remove watcher to the resolvedName.
-	err = ti.watcher.Remove(entry.resolvedName)
-	if err != nil {
-		klog.V(2).Infof("goexec.Untrack failed to close watcher: %+v", err)
-		err = nil
+	// Remove watches no longer needed.
+	for _, dir := range common.SortedKeys(entry.dirs) {
+		ti.unwatchLocked(entry, dir)
 	}
 	if len(ti.tracked) == 0 {
 		klog.V(2).Infof("goexec.Untrack: nothing else to track, closing watcher")
@@ -227,6 +482,11 @@ func (s *State) lockedUntrackEntry(fileOrDirPath string) (err error) {
 			err = nil
 		}
 		ti.watcher = nil
+		if ti.flushTimer != nil {
+			ti.flushTimer.Stop()
+			ti.flushTimer = nil
+		}
+		clear(ti.pending)
 	}
 	return
 }
@@ -240,6 +500,38 @@ func (s *State) ListTracked() []string {
 	return common.SortedKeys(s.trackingInfo.tracked)
 }
 
+// IsTracked returns whether filePath is tracked, or is under a tracked directory.
+func (s *State) IsTracked(filePath string) bool {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return false
+	}
+	return isUnderRoots(absPath, s.trackedRoots())
+}
+
+// trackedRoots returns the absolute paths of the tracked files and directories.
+func (s *State) trackedRoots() []string {
+	tracked := s.ListTracked()
+	roots := make([]string, 0, len(tracked))
+	for _, root := range tracked {
+		if absRoot, err := filepath.Abs(root); err == nil {
+			roots = append(roots, absRoot)
+		}
+	}
+	return roots
+}
+
+// isUnderRoots returns whether absPath is one of the roots, or is under one of them.
+func isUnderRoots(absPath string, roots []string) bool {
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, absPath)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
 // isGoRelated checks whether a file is Go related.
 func isGoRelated(fileOrDirPath string) bool {
 	base := path.Base(fileOrDirPath)
@@ -326,26 +618,9 @@ func (s *State) autoTrackGoMod() (err error) {
 			continue
 		}
 		klog.V(2).Infof("- go.mod new replace: %s", replaceTarget)
-		err = s.Track(replaceTarget)
-
-		// Because fsnotify doesn't support recursion in watching for changes in subdirectories,
-		// we need to add each subdirectory under the one defined.
-		err = common.WalkDirWithSymbolicLinks(replaceTarget, func(entryPath string, info fs.DirEntry, err error) error {
-			// Visit function for each file in the directory:
-			if err != nil {
-				return errors.Wrapf(err, "failed to auto-track file under directory %q", replaceTarget)
-			}
-			if !isGoRelated(entryPath) {
-				return nil
-			}
-
-			// Only track directories that have go files. Notice repeated tracked directories
-			// are quickly ignored.
-			dir := path.Dir(entryPath)
-			return s.Track(dir)
-		})
-		if err != nil {
-			klog.Errorf("Failed to auto-track subdirectories of %q: %+v", replaceTarget, err)
+		// Directories are tracked recursively.
+		if err = s.Track(replaceTarget); err != nil {
+			klog.Errorf("Failed to auto-track %q: %+v", replaceTarget, err)
 			err = nil
 		}
 	}
@@ -411,26 +686,9 @@ func (s *State) autoTrackGoWork() (err error) {
 			continue
 		}
 		klog.V(2).Infof("- go.work new replace: %s", p)
-		err = s.Track(p)
-
-		// Because fsnotify doesn't support recursion in watching for changes in subdirectories,
-		// we need to add each subdirectory under the one defined.
-		err = common.WalkDirWithSymbolicLinks(p, func(entryPath string, info fs.DirEntry, err error) error {
-			// Visit function for each file in the directory:
-			if err != nil {
-				return errors.Wrapf(err, "failed to auto-track file under directory %q", p)
-			}
-			if !isGoRelated(entryPath) {
-				return nil
-			}
-
-			// Only track directories that have go files. Notice repeated tracked directories
-			// are quickly ignored.
-			dir := path.Dir(entryPath)
-			return s.Track(dir)
-		})
-		if err != nil {
-			klog.Errorf("Failed to auto-track subdirectories of %q: %+v", p, err)
+		// Directories are tracked recursively.
+		if err = s.Track(p); err != nil {
+			klog.Errorf("Failed to auto-track %q: %+v", p, err)
 			err = nil
 		}
 	}
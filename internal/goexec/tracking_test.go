@@ -0,0 +1,143 @@
+package goexec
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchIgnorePattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, relPath string
+		want             bool
+	}{
+		{"vendor/**", "vendor/x/y.go", true},
+		{"vendor/**", "vendor", true},
+		{"vendor/**", "pkg/vendor/y.go", false},
+		{"**/*_gen.go", "x_gen.go", true},
+		{"**/*_gen.go", "a/b/x_gen.go", true},
+		{"**/*_gen.go", "a/b/x.go", false},
+		{"**/testdata/**", "a/testdata/b/c.go", true},
+		{"*.go", "a/b.go", false},
+		{"a/*/c.go", "a/b/c.go", true},
+	} {
+		assert.Equalf(t, tc.want, matchIgnorePattern(tc.pattern, tc.relPath),
+			"matchIgnorePattern(%q, %q)", tc.pattern, tc.relPath)
+	}
+}
+
+// updatedFiles returns the files updated since the last call.
+func updatedFiles(t *testing.T, s *State) []string {
+	var files []string
+	require.NoError(t, s.EnumerateUpdatedFiles(func(filePath string) error {
+		files = append(files, filePath)
+		return nil
+	}))
+	return files
+}
+
+func TestTrackRecursive(t *testing.T) {
+	defer func(debounce time.Duration) { TrackDebounce = debounce }(TrackDebounce)
+	TrackDebounce = 10 * time.Millisecond
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	dir := t.TempDir()
+	writeFile := func(relPath string) string {
+		filePath := path.Join(dir, relPath)
+		require.NoError(t, os.MkdirAll(path.Dir(filePath), 0700))
+		require.NoError(t, os.WriteFile(filePath, []byte("package p\n"), 0600))
+		return filePath
+	}
+	libPath := writeFile("lib.go")
+	subPath := writeFile("sub/sub.go")
+	writeFile("sub/sub_gen.go")
+	writeFile("vendor/v/v.go")
+	writeFile("README.md")
+
+	require.Error(t, s.Track(dir, "[bad"))
+	require.NoError(t, s.Track(dir, "vendor/**", "**/*_gen.go"))
+	assert.Equal(t, []string{libPath, subPath}, updatedFiles(t, s))
+	ti := s.trackingInfo
+	ti.mu.Lock()
+	assert.Len(t, ti.watchCount, 2, "only %q and its \"sub\" directory should be watched", dir)
+	ti.mu.Unlock()
+
+	// Newly created subdirectories are tracked.
+	newPath := writeFile("sub/new/new.go")
+	assert.Eventually(t, func() bool {
+		ti.mu.Lock()
+		defer ti.mu.Unlock()
+		return ti.updated.Has(newPath)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{newPath}, updatedFiles(t, s))
+
+	// Changes to ignored files are not reported, changes to tracked files are.
+	writeFile("sub/new/new_gen.go")
+	writeFile("lib.go")
+	assert.Eventually(t, func() bool {
+		ti.mu.Lock()
+		defer ti.mu.Unlock()
+		return ti.updated.Has(libPath)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{libPath}, updatedFiles(t, s))
+
+	// Removed directories are no longer watched.
+	require.NoError(t, os.RemoveAll(path.Join(dir, "sub")))
+	assert.Eventually(t, func() bool {
+		ti.mu.Lock()
+		defer ti.mu.Unlock()
+		return len(ti.watchCount) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Untracking releases all watches.
+	require.NoError(t, s.Untrack(dir))
+	ti.mu.Lock()
+	assert.Empty(t, ti.watchCount)
+	assert.Nil(t, ti.watcher)
+	ti.mu.Unlock()
+}
+
+func TestTrackGuardrails(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	dir := t.TempDir()
+	defer func(cache string) { moduleCache = cache }(moduleCache)
+	moduleCache = path.Join(dir, "modcache")
+	modulePath := path.Join(moduleCache, "example.com", "m@v1.0.0")
+	require.NoError(t, os.MkdirAll(modulePath, 0700))
+	require.NoError(t, os.WriteFile(path.Join(modulePath, "m.go"), []byte("package m\n"), 0600))
+
+	// Directories in the module cache, or linked into it.
+	linkPath := path.Join(dir, "link")
+	require.NoError(t, os.Symlink(modulePath, linkPath))
+	require.ErrorContains(t, s.Track(modulePath), "module cache")
+	require.ErrorContains(t, s.Track(linkPath), "module cache")
+	assert.Empty(t, s.ListTracked())
+	require.NoError(t, s.TrackWithOptions(linkPath, TrackOptions{Force: true}))
+	assert.Equal(t, []string{path.Join(modulePath, "m.go")}, updatedFiles(t, s))
+	require.NoError(t, s.Untrack(linkPath))
+
+	// Symbolic links into the module cache, under a tracked directory, are skipped.
+	libDir := path.Join(dir, "lib")
+	require.NoError(t, os.MkdirAll(libDir, 0700))
+	require.NoError(t, os.WriteFile(path.Join(libDir, "lib.go"), []byte("package lib\n"), 0600))
+	require.NoError(t, os.Symlink(modulePath, path.Join(libDir, "dep")))
+	require.NoError(t, s.Track(libDir))
+	assert.Equal(t, []string{path.Join(libDir, "lib.go")}, updatedFiles(t, s))
+	require.NoError(t, s.Untrack(libDir))
+
+	// Too many files.
+	defer func(maxFiles int) { MaxTrackedFiles = maxFiles }(MaxTrackedFiles)
+	MaxTrackedFiles = 1
+	require.NoError(t, os.WriteFile(path.Join(libDir, "other.go"), []byte("package lib\n"), 0600))
+	require.ErrorContains(t, s.Track(libDir), "more than 1 files")
+	require.NoError(t, s.Track(libDir, "other.go"))
+	require.NoError(t, s.Untrack(libDir))
+	require.NoError(t, s.TrackWithOptions(libDir, TrackOptions{Force: true}))
+}
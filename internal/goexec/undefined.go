@@ -0,0 +1,156 @@
+package goexec
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"strings"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the detection of the identifiers used by a cell that are neither defined in the cell nor
+// memorized -- typically because the cells that define them were not executed (or were executed out of order)
+// in the session. They are reported before compiling, with a friendlier error than the compiler's.
+
+// UndefinedSymbol is an identifier used by a cell, that is not defined anywhere.
+type UndefinedSymbol struct {
+	Name string
+
+	// Line (0-based) in the cell of the first usage.
+	Line int
+}
+
+// undefinedSymbols returns the identifiers used by the cell cellId in the composed code, that are not declared
+// anywhere: in the code, in otherDecls (the declarations of other Go files of the package), or in the universe
+// scope (e.g. `int`, `len`).
+//
+// Identifiers used as the qualifier of a selector (`fmt` in `fmt.Println`) are assumed to be packages, imported
+// later by `goimports`. It returns nil if the code doesn't parse or if it has dot-imports, leaving it to the
+// compiler.
+func undefinedSymbols(code string, cellId int, fileToCellIdAndLine []CellIdAndLine, otherDecls Set[string]) []UndefinedSymbol {
+	fileSet := token.NewFileSet()
+	// Object resolution (the default) lists the identifiers not resolved in the file.
+	file, err := parser.ParseFile(fileSet, "", code, 0)
+	if err != nil {
+		return nil
+	}
+	for _, importSpec := range file.Imports {
+		if importSpec.Name != nil && importSpec.Name.Name == "." {
+			return nil
+		}
+	}
+	qualifiers := MakeSet[*ast.Ident]()
+	ast.Inspect(file, func(node ast.Node) bool {
+		if selector, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := selector.X.(*ast.Ident); ok {
+				qualifiers.Insert(ident)
+			}
+		}
+		return true
+	})
+
+	var symbols []UndefinedSymbol
+	seen := MakeSet[string]()
+	for _, ident := range file.Unresolved {
+		name := ident.Name
+		if seen.Has(name) || qualifiers.Has(ident) || otherDecls.Has(name) || types.Universe.Lookup(name) != nil {
+			continue
+		}
+		line := fileSet.Position(ident.Pos()).Line - 1
+		if line < 0 || line >= len(fileToCellIdAndLine) || fileToCellIdAndLine[line].Id != cellId ||
+			fileToCellIdAndLine[line].Line < 0 {
+			continue
+		}
+		seen.Insert(name)
+		symbols = append(symbols, UndefinedSymbol{Name: name, Line: fileToCellIdAndLine[line].Line})
+	}
+	return symbols
+}
+
+// topLevelDeclarations returns the names declared at the top level of the Go files parsed.
+func topLevelDeclarations(files map[string]*ast.File) Set[string] {
+	names := MakeSet[string]()
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch typedDecl := decl.(type) {
+			case *ast.FuncDecl:
+				if typedDecl.Recv == nil {
+					names.Insert(typedDecl.Name.Name)
+				}
+			case *ast.GenDecl:
+				for _, spec := range typedDecl.Specs {
+					switch typedSpec := spec.(type) {
+					case *ast.TypeSpec:
+						names.Insert(typedSpec.Name.Name)
+					case *ast.ValueSpec:
+						for _, name := range typedSpec.Names {
+							names.Insert(name.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// otherFilesDeclarations returns the names declared at the top level of the Go files in TempDir, other than the
+// composed code (`main.go` or `main_test.go`): e.g. files written by `%%writefile`.
+func (s *State) otherFilesDeclarations() Set[string] {
+	packages, err := parser.ParseDir(token.NewFileSet(), s.TempDir, func(info fs.FileInfo) bool {
+		return info.Name() != MainGo && info.Name() != MainTestGo
+	}, parser.SkipObjectResolution)
+	names := MakeSet[string]()
+	if err != nil {
+		klog.V(1).Infof("Failed to parse other Go files in %q: %+v", s.TempDir, err)
+		return names
+	}
+	for _, pkg := range packages {
+		for name := range topLevelDeclarations(pkg.Files) {
+			names.Insert(name)
+		}
+	}
+	return names
+}
+
+// checkUndefinedSymbols returns an error listing the identifiers used by the cell cellId that are not defined
+// (see undefinedSymbols), or nil if there are none. If the state saved by a previous session (see SaveState)
+// defines them, it suggests loading it.
+func (s *State) checkUndefinedSymbols(cellId int, fileToCellIdAndLine []CellIdAndLine) error {
+	code, err := os.ReadFile(s.CodePath())
+	if err != nil {
+		return nil
+	}
+	symbols := undefinedSymbols(string(code), cellId, fileToCellIdAndLine, s.otherFilesDeclarations())
+	if len(symbols) == 0 {
+		return nil
+	}
+	parts := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		parts = append(parts, fmt.Sprintf("%s (line %d)", symbol.Name, symbol.Line+1))
+	}
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "undefined: %s\n", strings.Join(parts, ", "))
+	sb.WriteString("They are not defined in the cell nor memorized: maybe the cells that define them were not " +
+		"executed in this session (or were executed out of order, or after a `%reset`).")
+	if statePath, savedDecls := savedStateDeclarations(); savedDecls != nil {
+		found := 0
+		for _, symbol := range symbols {
+			if savedDecls.Has(symbol.Name) {
+				found++
+			}
+		}
+		if found > 0 {
+			_, _ = fmt.Fprintf(&sb, "\n%d of them are defined in the state saved by a previous session (%q): "+
+				"use `%%load_state` to load it.", found, statePath)
+		}
+	}
+	return errors.New(sb.String())
+}
@@ -0,0 +1,89 @@
+package goexec
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUndefinedSymbols(t *testing.T) {
+	code := `package main
+
+import "fmt"
+
+type Point struct{ X, Y int }
+
+func (p Point) Norm() int { return p.X*p.X + p.Y*p.Y }
+
+func Map[T any](values []T, fn func(T) T) []T {
+	result := make([]T, 0, len(values))
+	for _, v := range values {
+		result = append(result, fn(v))
+	}
+	return result
+}
+
+func main() {
+	p := Point{X: 1, Y: 2}
+	var x any = p
+	switch v := x.(type) {
+	case Point:
+		fmt.Println(v.Norm())
+	}
+outer:
+	for i := range 10 {
+		if i > 5 {
+			break outer
+		}
+	}
+	fmt.Println(Map([]int{1}, func(v int) int { return v * 2 }), Point.Norm(p))
+	fmt.Println(dataset, helperFromFile, strings.ToUpper("a"))
+	fmt.Println(model(dataset))
+}
+`
+	numLines := strings.Count(code, "\n") + 1
+	fileToCellIdAndLine := make([]CellIdAndLine, numLines)
+	for ii := range fileToCellIdAndLine {
+		fileToCellIdAndLine[ii] = CellIdAndLine{Id: 7, Line: ii}
+	}
+	symbols := undefinedSymbols(code, 7, fileToCellIdAndLine, SetWithValues("helperFromFile"))
+	require.Len(t, symbols, 2)
+	assert.Equal(t, UndefinedSymbol{Name: "dataset", Line: 30}, symbols[0])
+	assert.Equal(t, "model", symbols[1].Name)
+
+	// Lines from other cells (memorized declarations) are not reported.
+	assert.Empty(t, undefinedSymbols(code, 8, fileToCellIdAndLine, nil))
+
+	// Dot-imports leave it to the compiler.
+	dotCode := strings.Replace(code, `import "fmt"`, `import . "fmt"`, 1)
+	assert.Empty(t, undefinedSymbols(dotCode, 7, fileToCellIdAndLine, nil))
+}
+
+func TestSaveAndLoadState(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	t.Setenv(StateDirEnv, t.TempDir())
+
+	cell := "type Point struct{ X, Y int }\n\nfunc (p Point) Norm() int { return p.X*p.X + p.Y*p.Y }\n\nvar origin = Point{}\n"
+	require.NoError(t, s.MemorizeCell(nil, 1, strings.Split(cell, "\n"), MakeSet[int]()))
+	statePath, err := DefaultStatePath()
+	require.NoError(t, err)
+	require.NoError(t, s.SaveState(statePath))
+	savedPath, names := savedStateDeclarations()
+	assert.Equal(t, statePath, savedPath)
+	assert.True(t, names.Has("Point"))
+	assert.True(t, names.Has("origin"))
+
+	s.Reset()
+	require.NoError(t, s.LoadState(nil, 2, statePath))
+	assert.Contains(t, s.Definitions.Types, "Point")
+	assert.Contains(t, s.Definitions.Functions, "Point~Norm")
+	assert.Contains(t, s.Definitions.Variables, "origin")
+	_, err = os.Stat(path.Join(path.Dir(statePath), path.Base(statePath)+".tmp"))
+	assert.True(t, os.IsNotExist(err))
+}
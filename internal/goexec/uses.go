@@ -0,0 +1,193 @@
+package goexec
+
+import (
+	"cmp"
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.lsp.dev/uri"
+	"k8s.io/klog/v2"
+)
+
+// This file implements `%uses`: it lists where a memorized declaration is used, in the memorized declarations
+// (mapped to the cells that defined them) and in the tracked packages. It helps to find out if a declaration
+// can be safely removed with `%rm`.
+
+// Usage of a symbol in a memorized declaration, see State.Uses.
+type Usage struct {
+	// CellId and Line (0-based) of the cell where the usage was defined.
+	CellId, Line int
+
+	// Declaration is the key of the memorized declaration where the symbol is used (e.g. "Foo" for a
+	// function, "Point~Norm" for a method, or the name of a type, variable or constant).
+	Declaration string
+
+	// Content of the line, as rendered in the composed code.
+	Content string
+}
+
+// FileUsage is a usage of a symbol in a file other than the memorized declarations (e.g. tracked packages).
+type FileUsage struct {
+	// Path of the file, and Line (0-based) of the usage.
+	Path string
+	Line int
+}
+
+// UsesResult is returned by State.Uses.
+type UsesResult struct {
+	Name string
+
+	// Usages in the memorized declarations, sorted by cell id and line.
+	Usages []Usage
+
+	// FileUsages in other files, when `gopls` is available.
+	FileUsages []FileUsage
+
+	// Approximate is set when `gopls` is not available, and the usages were found by matching the identifiers
+	// of the symbol (ignoring scopes): it may report false positives (e.g. local variables with the same name).
+	Approximate bool
+}
+
+// Uses lists where the memorized declaration name is used. Methods, struct fields and interface methods are given
+// as `<Type>.<Name>`.
+//
+// It uses `gopls` references, if available, to also find the usages in the tracked packages.
+// Otherwise, the usages are found syntactically in the memorized declarations only.
+func (s *State) Uses(name string) (*UsesResult, error) {
+	s.composeMu.Lock()
+	defer s.composeMu.Unlock()
+	s.stateMu.Lock()
+	decls := s.Definitions.Copy()
+	s.stateMu.Unlock()
+
+	content, fileToCellIdAndLine, err := s.composeForRename(decls)
+	if err != nil {
+		return nil, err
+	}
+	line, col, err := findDeclaredIdent(content, name)
+	if err != nil {
+		return nil, err
+	}
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "", content, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse memorized declarations")
+	}
+
+	lines := strings.Split(content, "\n")
+	result := &UsesResult{Name: name}
+	var positions []token.Position // 0-based line and byte column of the usages in the composed code.
+	gopls := s.goplsOnDemand()
+	if gopls != nil {
+		ctx := context.Background()
+		if err = s.notifyAboutStandardAndTrackedFiles(ctx); err != nil {
+			return nil, errors.WithMessagef(err, "failed to notify gopls of the files to search for uses of %q", name)
+		}
+		locations, err := gopls.CallReferences(ctx, s.CodePath(), line, byteToUTF16Col(lines[line], col))
+		if err != nil {
+			return nil, err
+		}
+		codeURI := uri.File(s.CodePath())
+		for _, location := range locations {
+			start := location.Range.Start
+			if location.URI != codeURI {
+				result.FileUsages = append(result.FileUsages, FileUsage{Path: location.URI.Filename(), Line: int(start.Line)})
+				continue
+			}
+			if int(start.Line) < len(lines) {
+				positions = append(positions, token.Position{Line: int(start.Line),
+					Column: utf16ToByteCol(lines[start.Line], int(start.Character))})
+			}
+		}
+		slices.SortFunc(result.FileUsages, func(a, b FileUsage) int {
+			return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.Line, b.Line))
+		})
+	} else {
+		klog.V(1).Infof("`gopls` not available, %%uses %q searches identifiers syntactically", name)
+		result.Approximate = true
+		positions = findIdentUsages(fileSet, file, name, line, col)
+	}
+
+	for _, pos := range positions {
+		if pos.Line >= len(fileToCellIdAndLine) {
+			continue
+		}
+		cellIdAndLine := fileToCellIdAndLine[pos.Line]
+		if cellIdAndLine.Id < 0 || cellIdAndLine.Line < 0 {
+			// Automatically generated line, not from any cell.
+			continue
+		}
+		result.Usages = append(result.Usages, Usage{
+			CellId:      cellIdAndLine.Id,
+			Line:        cellIdAndLine.Line,
+			Declaration: enclosingDeclarationKey(fileSet, file, pos.Line),
+			Content:     strings.TrimSpace(lines[pos.Line]),
+		})
+	}
+	slices.SortFunc(result.Usages, func(a, b Usage) int {
+		return cmp.Or(cmp.Compare(a.CellId, b.CellId), cmp.Compare(a.Line, b.Line))
+	})
+	result.Usages = slices.CompactFunc(result.Usages, func(a, b Usage) bool {
+		return a.CellId == b.CellId && a.Line == b.Line
+	})
+	return result, nil
+}
+
+// findIdentUsages returns the positions (0-based line and byte column) of the identifiers matching name (or its
+// member name, for `<Type>.<Name>`) in file, excluding the declaration at declLine and declCol.
+func findIdentUsages(fileSet *token.FileSet, file *ast.File, name string, declLine, declCol int) []token.Position {
+	identName := name
+	if _, memberName, isMember := strings.Cut(name, "."); isMember {
+		identName = memberName
+	}
+	var positions []token.Position
+	ast.Inspect(file, func(node ast.Node) bool {
+		ident, ok := node.(*ast.Ident)
+		if !ok || ident.Name != identName {
+			return true
+		}
+		pos := fileSet.Position(ident.Pos())
+		pos.Line, pos.Column = pos.Line-1, pos.Column-1
+		if pos.Line != declLine || pos.Column != declCol {
+			positions = append(positions, pos)
+		}
+		return true
+	})
+	return positions
+}
+
+// enclosingDeclarationKey returns the key of the top-level declaration containing the 0-based line of file,
+// or an empty string if there is none.
+func enclosingDeclarationKey(fileSet *token.FileSet, file *ast.File, line int) string {
+	for _, decl := range file.Decls {
+		if fileSet.Position(decl.Pos()).Line-1 > line || fileSet.Position(decl.End()).Line-1 < line {
+			continue
+		}
+		switch typedDecl := decl.(type) {
+		case *ast.FuncDecl:
+			if typedDecl.Recv != nil && len(typedDecl.Recv.List) > 0 {
+				receiver, _ := receiverTypeName(typedDecl.Recv.List[0].Type)
+				return receiver + "~" + typedDecl.Name.Name
+			}
+			return typedDecl.Name.Name
+		case *ast.GenDecl:
+			for _, spec := range typedDecl.Specs {
+				if fileSet.Position(spec.Pos()).Line-1 > line || fileSet.Position(spec.End()).Line-1 < line {
+					continue
+				}
+				switch typedSpec := spec.(type) {
+				case *ast.TypeSpec:
+					return typedSpec.Name.Name
+				case *ast.ValueSpec:
+					return typedSpec.Names[0].Name
+				}
+			}
+		}
+	}
+	return ""
+}
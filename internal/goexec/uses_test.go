@@ -0,0 +1,48 @@
+package goexec
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUses(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	cells := []string{
+		"type Point struct {\n\tX, Y float64\n}",
+		"func (p *Point) Norm() float64 {\n\treturn p.X*p.X + p.Y*p.Y\n}",
+		"func Scale(p Point, f float64) Point {\n\treturn Point{X: p.X * f, Y: p.Y * f}\n}",
+		"func Unused() {}",
+	}
+	for ii, cell := range cells {
+		require.NoError(t, s.MemorizeCell(nil, ii+1, strings.Split(cell, "\n"), MakeSet[int]()))
+	}
+
+	// Without gopls, the usages are found syntactically.
+	result, err := s.Uses("Point")
+	require.NoError(t, err)
+	assert.True(t, result.Approximate)
+	assert.Equal(t, []Usage{
+		{CellId: 2, Line: 0, Declaration: "Point~Norm", Content: "func (p *Point) Norm() float64 {"},
+		{CellId: 3, Line: 0, Declaration: "Scale", Content: "func Scale(p Point, f float64) Point {"},
+		{CellId: 3, Line: 1, Declaration: "Scale", Content: "return Point{X: p.X * f, Y: p.Y * f}"},
+	}, result.Usages)
+
+	result, err = s.Uses("Point.Y")
+	require.NoError(t, err)
+	require.Len(t, result.Usages, 2)
+	assert.Equal(t, "Point~Norm", result.Usages[0].Declaration)
+	assert.Equal(t, "Scale", result.Usages[1].Declaration)
+
+	result, err = s.Uses("Unused")
+	require.NoError(t, err)
+	assert.Empty(t, result.Usages)
+
+	_, err = s.Uses("Missing")
+	require.Error(t, err)
+}
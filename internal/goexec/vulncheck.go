@@ -0,0 +1,220 @@
+package goexec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the vulnerability scanning of the module of the kernel (`%vulncheck`) with `govulncheck`,
+// which is installed on demand. Optionally (VulnCheckAfterGet), the modules are scanned after `go get`
+// downloads new versions.
+
+// GovulncheckPackage is the package installed (with `go install`) when `govulncheck` is not found.
+var GovulncheckPackage = "golang.org/x/vuln/cmd/govulncheck@latest"
+
+// Vulnerability found by `govulncheck`, see State.VulnCheck.
+type Vulnerability struct {
+	// ID of the vulnerability in the Go vulnerability database (e.g. "GO-2023-1571"), Aliases (e.g. CVE ids) and
+	// its Summary.
+	ID      string
+	Aliases []string
+	Summary string
+
+	// Module and Version (e.g. "golang.org/x/net" and "v0.5.0", or "stdlib" for the standard library) with the
+	// vulnerability, and the FixedVersion, if there is one.
+	Module, Version, FixedVersion string
+
+	// Packages imported with the vulnerability: empty if the module is required, but the vulnerable packages
+	// are not imported.
+	Packages []string
+
+	// Symbols (functions or methods) with the vulnerability called by the code: empty if they are not called.
+	Symbols []string
+}
+
+// URL returns the link to the description of the vulnerability.
+func (v *Vulnerability) URL() string {
+	return "https://pkg.go.dev/vuln/" + v.ID
+}
+
+// VulnCheck scans the module of the kernel, with the memorized declarations, with `govulncheck`. If install is
+// true, `govulncheck` is installed if not found.
+func (s *State) VulnCheck(install bool) ([]Vulnerability, error) {
+	govulncheck, err := govulncheckPath(install)
+	if err != nil {
+		return nil, err
+	}
+	s.composeMu.Lock()
+	defer s.composeMu.Unlock()
+	s.stateMu.Lock()
+	decls := s.Definitions.Copy()
+	s.stateMu.Unlock()
+	decls.Functions["main"] = stubMainFunction()
+	if _, _, err = s.createCodeFileFromDecls(decls, nil); err != nil {
+		return nil, err
+	}
+	args := []string{"-json"}
+	args = append(args, s.buildTagsFlags()...)
+	// Only the main package: "./..." would also scan the shadow package (see ShadowDir), a copy of it
+	// rewritten concurrently by the introspection requests.
+	return s.runGovulncheck(govulncheck, append(args, ".")...)
+}
+
+// vulnCheckModules scans the modules required by the kernel (not the code) with `govulncheck`, if it is
+// installed, and reports the vulnerabilities found as a warning. It's used after `go get` downloads new
+// versions of modules, when VulnCheckAfterGet is set.
+func (s *State) vulnCheckModules(msg kernel.Message) {
+	govulncheck, err := govulncheckPath(false)
+	if err != nil {
+		klog.Warningf("%%vulncheck after `go get` skipped: %v", err)
+		return
+	}
+	vulns, err := s.runGovulncheck(govulncheck, "-json", "-scan=module")
+	if err != nil {
+		klog.Warningf("%%vulncheck after `go get` failed: %+v", err)
+		return
+	}
+	if len(vulns) == 0 {
+		return
+	}
+	parts := []string{"⚠️ `go get` pulled modules with known vulnerabilities (see `%vulncheck` for details):"}
+	for _, v := range vulns {
+		fixed := "no fixed version"
+		if v.FixedVersion != "" {
+			fixed = "fixed in " + v.FixedVersion
+		}
+		parts = append(parts, fmt.Sprintf("  - %s@%s: %s (%s), %s", v.Module, v.Version, v.ID, v.URL(), fixed))
+	}
+	_ = kernel.PublishWriteStream(msg, kernel.StreamStderr, strings.Join(parts, "\n")+"\n")
+}
+
+// runGovulncheck runs `govulncheck` with the arguments (which must include `-json`) in the directory of the
+// module, and parses its output.
+func (s *State) runGovulncheck(govulncheck string, args ...string) ([]Vulnerability, error) {
+	cmd := exec.Command(govulncheck, args...)
+	cmd.Dir = s.TempDir
+	cmd.Stderr = &strings.Builder{}
+	klog.V(2).Infof("Executing %s", cmd)
+	output, err := cmd.Output()
+	if err != nil {
+		// With `-json`, `govulncheck` only fails if it can't run the analysis.
+		return nil, errors.Wrapf(err, "failed to run %q:\n%s", cmd, cmd.Stderr)
+	}
+	return parseGovulncheckJSON(strings.NewReader(string(output)))
+}
+
+// govulncheckPath returns the path to `govulncheck`. If it's not found and install is true, it is installed
+// with `go install`.
+func govulncheckPath(install bool) (string, error) {
+	if binPath, err := exec.LookPath("govulncheck"); err == nil {
+		return binPath, nil
+	}
+	binDir := GoEnv("GOBIN")
+	if binDir == "" {
+		binDir = filepath.Join(filepath.SplitList(GoEnv("GOPATH"))[0], "bin")
+	}
+	binPath := filepath.Join(binDir, "govulncheck")
+	if _, err := os.Stat(binPath); err == nil {
+		return binPath, nil
+	}
+	if !install {
+		return "", errors.Errorf("govulncheck is not installed, install it with `!go install %s`", GovulncheckPackage)
+	}
+	cmd := exec.Command("go", "install", GovulncheckPackage)
+	klog.Infof("Installing govulncheck: %s", cmd)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", errors.Wrapf(err, "failed to install govulncheck with %q:\n%s", cmd, output)
+	}
+	if _, err := os.Stat(binPath); err != nil {
+		return "", errors.Wrapf(err, "govulncheck installed, but not found in %q", binPath)
+	}
+	return binPath, nil
+}
+
+// govulncheckMessage is a message of the output of `govulncheck -json`: only the fields used are declared.
+type govulncheckMessage struct {
+	OSV *struct {
+		ID      string   `json:"id"`
+		Aliases []string `json:"aliases"`
+		Summary string   `json:"summary"`
+	} `json:"osv"`
+	Finding *struct {
+		OSV          string `json:"osv"`
+		FixedVersion string `json:"fixed_version"`
+		Trace        []struct {
+			Module   string `json:"module"`
+			Version  string `json:"version"`
+			Package  string `json:"package"`
+			Function string `json:"function"`
+			Receiver string `json:"receiver"`
+		} `json:"trace"`
+	} `json:"finding"`
+}
+
+// parseGovulncheckJSON parses the stream of messages output by `govulncheck -json`, and returns the
+// vulnerabilities found, one per OSV entry and module, in the order they are reported.
+func parseGovulncheckJSON(reader io.Reader) ([]Vulnerability, error) {
+	decoder := json.NewDecoder(reader)
+	var vulns []*Vulnerability
+	osvs := make(map[string]*Vulnerability)
+	for {
+		var message govulncheckMessage
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "failed to parse the output of govulncheck")
+		}
+		if message.OSV != nil {
+			osvs[message.OSV.ID] = &Vulnerability{ID: message.OSV.ID, Aliases: message.OSV.Aliases, Summary: message.OSV.Summary}
+		}
+		finding := message.Finding
+		if finding == nil || len(finding.Trace) == 0 {
+			continue
+		}
+		// The first frame of the trace is the vulnerable module, package or symbol.
+		frame := finding.Trace[0]
+		var v *Vulnerability
+		for _, existing := range vulns {
+			if existing.ID == finding.OSV && existing.Module == frame.Module {
+				v = existing
+				break
+			}
+		}
+		if v == nil {
+			v = &Vulnerability{ID: finding.OSV, Module: frame.Module, Version: frame.Version, FixedVersion: finding.FixedVersion}
+			if osv, found := osvs[finding.OSV]; found {
+				v.Aliases, v.Summary = osv.Aliases, osv.Summary
+			}
+			vulns = append(vulns, v)
+		}
+		if frame.Package != "" && !slices.Contains(v.Packages, frame.Package) {
+			v.Packages = append(v.Packages, frame.Package)
+		}
+		if frame.Function != "" {
+			symbol := frame.Function
+			if frame.Receiver != "" {
+				symbol = strings.TrimPrefix(frame.Receiver, "*") + "." + symbol
+			}
+			symbol = frame.Package + "." + symbol
+			if !slices.Contains(v.Symbols, symbol) {
+				v.Symbols = append(v.Symbols, symbol)
+			}
+		}
+	}
+	results := make([]Vulnerability, 0, len(vulns))
+	for _, v := range vulns {
+		results = append(results, *v)
+	}
+	return results, nil
+}
@@ -0,0 +1,67 @@
+package goexec
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGovulncheckJSON(t *testing.T) {
+	output := `{"config":{"protocol_version":"v1.0.0","scanner_name":"govulncheck"}}
+{"progress":{"message":"Scanning your code and 12 packages across 2 dependent modules for known vulnerabilities..."}}
+{"osv":{"id":"GO-2023-1571","aliases":["CVE-2022-41723"],"summary":"Denial of service via crafted HTTP/2 stream in net/http and golang.org/x/net"}}
+{"osv":{"id":"GO-2023-1988","aliases":["CVE-2023-3978"],"summary":"Improper rendering of text nodes in golang.org/x/net/html"}}
+{"finding":{"osv":"GO-2023-1571","fixed_version":"v0.7.0","trace":[{"module":"golang.org/x/net","version":"v0.5.0"}]}}
+{"finding":{"osv":"GO-2023-1571","fixed_version":"v0.7.0","trace":[{"module":"golang.org/x/net","version":"v0.5.0","package":"golang.org/x/net/http2"}]}}
+{"finding":{"osv":"GO-2023-1988","fixed_version":"v0.13.0","trace":[{"module":"golang.org/x/net","version":"v0.5.0","package":"golang.org/x/net/html","function":"Render"},{"module":"gonb_1234","package":"gonb_1234","function":"main"}]}}
+{"finding":{"osv":"GO-2023-1988","fixed_version":"v0.13.0","trace":[{"module":"golang.org/x/net","version":"v0.5.0","package":"golang.org/x/net/html","function":"Parse","receiver":"*Tokenizer"}]}}
+`
+	vulns, err := parseGovulncheckJSON(strings.NewReader(output))
+	require.NoError(t, err)
+	assert.Equal(t, []Vulnerability{
+		{
+			ID:           "GO-2023-1571",
+			Aliases:      []string{"CVE-2022-41723"},
+			Summary:      "Denial of service via crafted HTTP/2 stream in net/http and golang.org/x/net",
+			Module:       "golang.org/x/net",
+			Version:      "v0.5.0",
+			FixedVersion: "v0.7.0",
+			Packages:     []string{"golang.org/x/net/http2"},
+		},
+		{
+			ID:           "GO-2023-1988",
+			Aliases:      []string{"CVE-2023-3978"},
+			Summary:      "Improper rendering of text nodes in golang.org/x/net/html",
+			Module:       "golang.org/x/net",
+			Version:      "v0.5.0",
+			FixedVersion: "v0.13.0",
+			Packages:     []string{"golang.org/x/net/html"},
+			Symbols:      []string{"golang.org/x/net/html.Render", "golang.org/x/net/html.Tokenizer.Parse"},
+		},
+	}, vulns)
+	assert.Equal(t, "https://pkg.go.dev/vuln/GO-2023-1571", vulns[0].URL())
+
+	_, err = parseGovulncheckJSON(strings.NewReader("not json"))
+	assert.Error(t, err)
+}
+
+func TestGovulncheckPath(t *testing.T) {
+	goPath, err := exec.LookPath("go")
+	require.NoError(t, err)
+	t.Setenv("PATH", filepath.Dir(goPath))
+	binDir := t.TempDir()
+	t.Setenv("GOBIN", binDir)
+
+	_, err = govulncheckPath(false)
+	assert.ErrorContains(t, err, "not installed")
+	binPath := filepath.Join(binDir, "govulncheck")
+	require.NoError(t, os.WriteFile(binPath, []byte("#!/bin/sh\n"), 0700))
+	found, err := govulncheckPath(false)
+	require.NoError(t, err)
+	assert.Equal(t, binPath, found)
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"text/template"
@@ -25,8 +26,9 @@ const (
 	CompiledWasmName   = "gonb_cell.wasm"
 )
 
-// MakeWasmSubdir creates a subdirectory named `.wasm/<notebook name>/` in the
-// same directory as the notebook, if it is not yet created.
+// MakeWasmSubdir creates a subdirectory named `jupyter_files/<kernel unique id>/` in the
+// Jupyter root directory, if it is not yet created. If WasmBaseDir (and WasmBaseUrl) are set,
+// the subdirectory `<kernel unique id>` is created there instead.
 //
 // It also copies current Go compiler `wasm_exec.js` file to this directory, if
 // it's not there already.
@@ -38,22 +40,18 @@ func (s *State) MakeWasmSubdir() (err error) {
 		return nil
 	}
 
-	// Set and create `WasmDir`.
-	var jupyterRoot string
-	jupyterRoot, err = JupyterRootDirectory()
+	// Set and create `WasmDir` and `WasmUrl`.
+	s.WasmDir, s.WasmUrl, err = s.servedLocation(s.UniqueID)
 	if err != nil {
 		return
 	}
-	s.WasmDir = path.Join(jupyterRoot, JupyterFilesSubdir, s.UniqueID)
 	err = os.MkdirAll(s.WasmDir, 0777)
 	if err != nil {
 		err = errors.Wrapf(err, "failed to created subdirectory %q required to install WASM files", s.WasmDir)
+		s.WasmDir, s.WasmUrl = "", ""
 		return
 	}
 
-	// Set `WasmUrl`.
-	s.WasmUrl = path.Join("/files", JupyterFilesSubdir, s.UniqueID)
-
 	// Copy over `wasm_exec.js` if needed.
 	var wasmExecSrc string
 	wasmExecSrc, err = GoRoot()
@@ -62,13 +60,18 @@ func (s *State) MakeWasmSubdir() (err error) {
 		return
 	}
 	klog.Infof("GOROOT=%q", goRoot)
-	wasmExecSrc = path.Join(wasmExecSrc, "misc", "wasm", "wasm_exec.js")
+	// Since Go 1.24 `wasm_exec.js` is in `$GOROOT/lib/wasm`, before it was in `$GOROOT/misc/wasm`.
+	goRootDir := wasmExecSrc
+	wasmExecSrc = path.Join(goRootDir, "lib", "wasm", "wasm_exec.js")
+	if _, statErr := os.Stat(wasmExecSrc); statErr != nil {
+		wasmExecSrc = path.Join(goRootDir, "misc", "wasm", "wasm_exec.js")
+	}
 	wasmExecDst := path.Join(s.WasmDir, "wasm_exec.js")
 
 	var data []byte
 	data, err = os.ReadFile(wasmExecSrc)
 	if err != nil {
-		err = errors.Wrapf(err, "failed to read '$GOROOT/misc/wasm/wasm_exec.js'")
+		err = errors.Wrapf(err, "failed to read %q", wasmExecSrc)
 		return
 	}
 	err = os.WriteFile(wasmExecDst, data, 0775)
@@ -89,14 +92,61 @@ func (s *State) MakeWasmSubdir() (err error) {
 	return
 }
 
+// SetWasmLocation overrides the directory where the `%wasm` files are stored, and the URL from where they are
+// served -- e.g.: for JupyterHub setups where the files URL is prefixed per-user.
+// A subdirectory with the kernel unique id is used under them.
+//
+// If baseUrl is empty, baseDir must be under the Jupyter root directory, and it is served by Jupyter.
+// If both are empty, it reverts to the default `jupyter_files` under the Jupyter root directory.
+//
+// It takes effect on the next `%wasm` cell, and the environment variables GONB_WASM_DIR and GONB_WASM_URL
+// are updated accordingly. The assets published by programs (see SetAssetsEnv) are also stored there.
+func (s *State) SetWasmLocation(baseDir, baseUrl string) {
+	s.WasmBaseDir, s.WasmBaseUrl = baseDir, baseUrl
+	s.WasmDir, s.WasmUrl = "", ""
+	s.AssetsDir, s.AssetsUrl = "", ""
+}
+
+// servedLocation returns the directory and the URL from where it is served, for the given subdirectory of the
+// location of the `%wasm` files (see SetWasmLocation). It doesn't create the directory.
+func (s *State) servedLocation(subdir string) (dir, url string, err error) {
+	if s.WasmBaseDir == "" {
+		var jupyterRoot string
+		jupyterRoot, err = JupyterRootDirectory()
+		if err != nil {
+			return
+		}
+		dir = path.Join(jupyterRoot, JupyterFilesSubdir, subdir)
+		url = JupyterFilesUrl(path.Join(JupyterFilesSubdir, subdir))
+		return
+	}
+	dir = path.Join(s.WasmBaseDir, subdir)
+	if s.WasmBaseUrl != "" {
+		url = strings.TrimSuffix(s.WasmBaseUrl, "/") + "/" + subdir
+		return
+	}
+	// Served by Jupyter, if WasmBaseDir is under the Jupyter root directory.
+	var jupyterRoot, relPath string
+	jupyterRoot, err = JupyterRootDirectory()
+	if err == nil {
+		relPath, err = filepath.Rel(jupyterRoot, dir)
+	}
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return "", "", errors.Errorf("the WASM directory %q is not under the Jupyter root directory, "+
+			"the URL from where it is served must also be given (`%%wasm --url=...` or `--wasm_url`)", s.WasmBaseDir)
+	}
+	url = JupyterFilesUrl(relPath)
+	return
+}
+
 var jupyterRootDirectory string
 
 // JupyterRootDirectory returns Jupyter's root directory.
 // This is needed to build the URL from where it serves static files.
 //
-// Unfortunately, this isn't directly provided by Jupyter.
-// It does provide its PID number, but get the "cwd" (current-working-directory) differs
-// for different OSes.
+// It is taken from the runtime file of the Jupyter server running the kernel, see JupyterServer.
+// If the server can't be discovered, it falls back to the "cwd" (current-working-directory) of the
+// Jupyter server process, whose PID is provided by Jupyter -- how to get it differs for different OSes.
 //
 // See question here:
 // https://stackoverflow.com/questions/46247964/way-to-get-jupyter-server-root-directory/58988310#58988310
@@ -105,6 +155,13 @@ func JupyterRootDirectory() (string, error) {
 		return jupyterRootDirectory, nil
 	}
 
+	if server, err := JupyterServer(); err == nil && server.RootDir != "" {
+		if fi, err := os.Stat(server.RootDir); err == nil && fi.IsDir() {
+			jupyterRootDirectory = server.RootDir
+			return jupyterRootDirectory, nil
+		}
+	}
+
 	pidStr := os.Getenv(JupyterPidEnv)
 	if pidStr == "" {
 		return "", errors.Errorf("cannot figure out Jupyter root directory, because environment variable %q is not set!?",
@@ -0,0 +1,153 @@
+package goexec
+
+import (
+	"context"
+	"fmt"
+	"github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/goexec/goplsclient"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"slices"
+)
+
+// This file implements named workspaces (`%workspace`): independent sets of memorized declarations
+// and `go.mod`, each with its own temporary directory, within the same kernel.
+
+// DefaultWorkspace is the name of the workspace the kernel starts with.
+const DefaultWorkspace = "default"
+
+// workspace holds the parts of State that are specific to a workspace, while it is not the current one.
+type workspace struct {
+	tempDir         string
+	definitions     *Declarations
+	functionHistory map[string][]*Function
+	trackingInfo    *trackingInfo
+	hasGoWork       bool
+	goWorkUsePaths  common.Set[string]
+}
+
+var reValidWorkspaceName = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
+
+// WorkspaceName returns the name of the current workspace.
+func (s *State) WorkspaceName() string {
+	if s.workspaceName == "" {
+		return DefaultWorkspace
+	}
+	return s.workspaceName
+}
+
+// ListWorkspaces returns the sorted names of all workspaces, including the current one.
+func (s *State) ListWorkspaces() []string {
+	names := []string{s.WorkspaceName()}
+	for name := range s.workspaces {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// CreateWorkspace creates a new empty workspace: no memorized declarations, and a new `go.mod`.
+// It doesn't change the current workspace, see SwitchWorkspace.
+func (s *State) CreateWorkspace(name string) error {
+	if !reValidWorkspaceName.MatchString(name) {
+		return errors.Errorf("invalid workspace name %q: only letters, digits, '_' and '-' are allowed", name)
+	}
+	if name == s.WorkspaceName() || s.workspaces[name] != nil {
+		return errors.Errorf("workspace %q already exists", name)
+	}
+	tempDir := path.Join(os.TempDir(), fmt.Sprintf("%s_%s", s.Package, name))
+	if err := os.Mkdir(tempDir, 0700); err != nil {
+		return errors.Wrapf(err, "failed to create temporary directory %q for workspace %q", tempDir, name)
+	}
+	cmd := exec.Command("go", "mod", "init", s.Package)
+	cmd.Dir = tempDir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		klog.Errorf("Failed to run `go mod init %s`:\n%s", s.Package, output)
+		return errors.Wrapf(err, "failed to run %q", cmd.String())
+	}
+	if s.workspaces == nil {
+		s.workspaces = make(map[string]*workspace)
+	}
+	s.workspaces[name] = &workspace{
+		tempDir:      tempDir,
+		definitions:  NewDeclarations(),
+		trackingInfo: newTrackingInfo(),
+	}
+	return nil
+}
+
+// SwitchWorkspace makes the named workspace the current one: subsequent cells use its memorized declarations
+// and `go.mod`. The current workspace is preserved, and one can switch back to it later.
+func (s *State) SwitchWorkspace(name string) error {
+	current := s.WorkspaceName()
+	if name == current {
+		return nil
+	}
+	target, found := s.workspaces[name]
+	if !found {
+		return errors.Errorf("workspace %q doesn't exist, create it first with `%%workspace create %s`", name, name)
+	}
+	s.composeMu.Lock()
+	defer s.composeMu.Unlock()
+	s.switchWorkspaceLocked(name, target)
+	return nil
+}
+
+// switchWorkspaceLocked implements SwitchWorkspace. It must be called with s.composeMu locked.
+func (s *State) switchWorkspaceLocked(name string, target *workspace) {
+	current := s.WorkspaceName()
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	delete(s.workspaces, name)
+	s.workspaces[current] = &workspace{
+		tempDir:         s.TempDir,
+		definitions:     s.Definitions,
+		functionHistory: s.functionHistory,
+		trackingInfo:    s.trackingInfo,
+		hasGoWork:       s.hasGoWork,
+		goWorkUsePaths:  s.goWorkUsePaths,
+	}
+	s.workspaceName = name
+	s.TempDir = target.tempDir
+	s.Definitions = target.definitions
+	s.functionHistory = target.functionHistory
+	s.trackingInfo = target.trackingInfo
+	s.hasGoWork = target.hasGoWork
+	s.goWorkUsePaths = target.goWorkUsePaths
+
+	if err := os.Setenv(protocol.GONB_TMP_DIR_ENV, s.TempDir); err != nil {
+		klog.Errorf("Failed to set environment variable %q: %+v", protocol.GONB_TMP_DIR_ENV, err)
+	}
+
+	// gopls is bound to the directory of the workspace, so it needs restarting.
+	if s.gopls != nil {
+		wasStopped := s.gopls.IsStopped()
+		settings := s.gopls.Settings()
+		s.gopls.Shutdown()
+		s.gopls = goplsclient.New(s.TempDir)
+		s.gopls.SetOnDemand(GoplsOnDemand)
+		for key, value := range settings {
+			_ = s.gopls.SetSetting(context.Background(), key, value) // Not connected yet, it doesn't fail.
+		}
+		if !GoplsOnDemand || !wasStopped { // Otherwise, it is started when needed.
+			if err := s.gopls.Start(); err != nil {
+				klog.Errorf("Failed to start `gopls` for workspace %q: %v", name, err)
+			}
+		}
+	}
+}
+
+// removeWorkspacesDirs removes the temporary directories of the workspaces that are not the current one.
+func (s *State) removeWorkspacesDirs() {
+	for name, ws := range s.workspaces {
+		if err := os.RemoveAll(ws.tempDir); err != nil {
+			klog.Errorf("Failed to remove temporary directory %q of workspace %q: %+v", ws.tempDir, name, err)
+		}
+	}
+	s.workspaces = nil
+}
@@ -0,0 +1,35 @@
+package goexec
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path"
+	"testing"
+)
+
+func TestWorkspaces(t *testing.T) {
+	s := newEmptyState(t)
+	defaultDir := s.TempDir
+	s.Definitions.Functions["f"] = &Function{Key: "f"}
+
+	require.NoError(t, s.CreateWorkspace("exp1"))
+	require.Error(t, s.CreateWorkspace("exp1"))
+	require.Error(t, s.CreateWorkspace("bad/name"))
+	assert.Equal(t, []string{"default", "exp1"}, s.ListWorkspaces())
+	assert.Equal(t, DefaultWorkspace, s.WorkspaceName())
+
+	require.NoError(t, s.SwitchWorkspace("exp1"))
+	assert.Equal(t, "exp1", s.WorkspaceName())
+	assert.NotEqual(t, defaultDir, s.TempDir)
+	assert.FileExists(t, path.Join(s.TempDir, "go.mod"))
+	assert.Empty(t, s.Definitions.Functions)
+	exp1Dir := s.TempDir
+
+	require.NoError(t, s.SwitchWorkspace(DefaultWorkspace))
+	assert.Equal(t, defaultDir, s.TempDir)
+	assert.Contains(t, s.Definitions.Functions, "f")
+	require.Error(t, s.SwitchWorkspace("missing"))
+
+	require.NoError(t, s.Stop())
+	assert.NoDirExists(t, exp1Dir)
+}
@@ -0,0 +1,161 @@
+package i18n
+
+// This file holds the catalog of messages. To add a message, create a MessageKey and add its English version
+// (required) and its translations to catalog. To add a language, add it to supportedLanguages and catalog
+// -- and optionally translate the `%help` page, see `internal/specialcmd/help_<lang>.md`.
+
+// MessageKey identifies a message in the catalog.
+type MessageKey string
+
+const (
+	MsgUnknownSpecialCommand MessageKey = "unknown_special_command"
+	MsgOnlyAtCellStart       MessageKey = "only_at_cell_start"
+	MsgNoInputPrompting      MessageKey = "no_input_prompting"
+	MsgErrorFormat           MessageKey = "error_format"
+	MsgWarning               MessageKey = "warning"
+	MsgGoImportsMissing      MessageKey = "goimports_missing"
+	MsgDependenciesMissing   MessageKey = "dependencies_missing"
+	MsgKernelInstalled       MessageKey = "kernel_installed"
+	MsgKernelFlagMissing     MessageKey = "kernel_flag_missing"
+	MsgHelpFullReference     MessageKey = "help_full_reference"
+)
+
+// supportedLanguages in the order they are listed to the user.
+var supportedLanguages = []string{"en", "pt", "es", "zh", "ja"}
+
+// catalog maps language to message key to the (fmt.Sprintf) format of the message.
+var catalog = map[string]map[MessageKey]string{
+	"en": {
+		MsgUnknownSpecialCommand: "\"%%%s\" unknown or not implemented yet.",
+		MsgOnlyAtCellStart:       "\"%%%s\" can only appear at the start of the cell",
+		MsgNoInputPrompting:      "%%%s not available in this notebook, it doesn't allow input prompting",
+		MsgErrorFormat:           "Compilation errors reported as %q\n",
+		MsgWarning:               "Warning: ",
+		MsgGoImportsMissing: `
+Program goimports is not installed. It is used to automatically import
+missing standard packages, and is a standard Go toolkit package. You
+can install it from the notebook with:
+
+!go install golang.org/x/tools/cmd/goimports@latest
+
+`,
+		MsgDependenciesMissing: `
+Program goimports and/or gopls are not installed. They are required dependencies,
+and generally are standard Go toolkit packages. You can install them with:
+
+go install golang.org/x/tools/cmd/goimports@latest
+go install golang.org/x/tools/gopls@latest
+
+`,
+		MsgKernelInstalled:   "Go (gonb) kernel configuration installed in %q.\n",
+		MsgKernelFlagMissing: "Use either --install to install the kernel, or if started by Jupyter the flag --kernel must be provided.\n",
+		MsgHelpFullReference: "Full reference (in English)",
+	},
+
+	"pt": {
+		MsgUnknownSpecialCommand: "\"%%%s\" desconhecido ou ainda não implementado.",
+		MsgOnlyAtCellStart:       "\"%%%s\" só pode aparecer no início da célula",
+		MsgNoInputPrompting:      "%%%s não está disponível neste notebook, ele não permite pedir entradas",
+		MsgErrorFormat:           "Erros de compilação reportados como %q\n",
+		MsgWarning:               "Aviso: ",
+		MsgGoImportsMissing: `
+O programa goimports não está instalado. Ele é usado para importar automaticamente
+pacotes padrão faltantes, e é um pacote padrão das ferramentas Go. Você
+pode instalá-lo a partir do notebook com:
+
+!go install golang.org/x/tools/cmd/goimports@latest
+
+`,
+		MsgDependenciesMissing: `
+Os programas goimports e/ou gopls não estão instalados. Eles são dependências necessárias,
+e geralmente são pacotes padrão das ferramentas Go. Você pode instalá-los com:
+
+go install golang.org/x/tools/cmd/goimports@latest
+go install golang.org/x/tools/gopls@latest
+
+`,
+		MsgKernelInstalled:   "Configuração do kernel Go (gonb) instalada em %q.\n",
+		MsgKernelFlagMissing: "Use --install para instalar o kernel, ou, se iniciado pelo Jupyter, a flag --kernel deve ser fornecida.\n",
+		MsgHelpFullReference: "Referência completa (em inglês)",
+	},
+
+	"es": {
+		MsgUnknownSpecialCommand: "\"%%%s\" desconocido o aún no implementado.",
+		MsgOnlyAtCellStart:       "\"%%%s\" solo puede aparecer al inicio de la celda",
+		MsgNoInputPrompting:      "%%%s no está disponible en este notebook, no permite solicitar entradas",
+		MsgErrorFormat:           "Errores de compilación reportados como %q\n",
+		MsgWarning:               "Advertencia: ",
+		MsgGoImportsMissing: `
+El programa goimports no está instalado. Se usa para importar automáticamente
+paquetes estándar faltantes, y es un paquete estándar de las herramientas de Go.
+Puede instalarlo desde el notebook con:
+
+!go install golang.org/x/tools/cmd/goimports@latest
+
+`,
+		MsgDependenciesMissing: `
+Los programas goimports y/o gopls no están instalados. Son dependencias necesarias,
+y generalmente son paquetes estándar de las herramientas de Go. Puede instalarlos con:
+
+go install golang.org/x/tools/cmd/goimports@latest
+go install golang.org/x/tools/gopls@latest
+
+`,
+		MsgKernelInstalled:   "Configuración del kernel Go (gonb) instalada en %q.\n",
+		MsgKernelFlagMissing: "Use --install para instalar el kernel o, si lo inicia Jupyter, debe indicarse la opción --kernel.\n",
+		MsgHelpFullReference: "Referencia completa (en inglés)",
+	},
+
+	"zh": {
+		MsgUnknownSpecialCommand: "\"%%%s\" 未知或尚未实现。",
+		MsgOnlyAtCellStart:       "\"%%%s\" 只能出现在单元格的开头",
+		MsgNoInputPrompting:      "%%%s 在此笔记本中不可用，它不允许提示输入",
+		MsgErrorFormat:           "编译错误以 %q 格式报告\n",
+		MsgWarning:               "警告：",
+		MsgGoImportsMissing: `
+未安装 goimports 程序。它用于自动导入缺失的标准包，是 Go 工具集的标准包。
+可以在笔记本中通过以下命令安装：
+
+!go install golang.org/x/tools/cmd/goimports@latest
+
+`,
+		MsgDependenciesMissing: `
+未安装 goimports 和/或 gopls 程序。它们是必需的依赖项，通常是 Go 工具集的标准包。
+可以通过以下命令安装：
+
+go install golang.org/x/tools/cmd/goimports@latest
+go install golang.org/x/tools/gopls@latest
+
+`,
+		MsgKernelInstalled:   "Go (gonb) 内核配置已安装到 %q。\n",
+		MsgKernelFlagMissing: "请使用 --install 安装内核；如果由 Jupyter 启动，则必须提供 --kernel 参数。\n",
+		MsgHelpFullReference: "完整参考（英文）",
+	},
+
+	"ja": {
+		MsgUnknownSpecialCommand: "\"%%%s\" は不明か、まだ実装されていません。",
+		MsgOnlyAtCellStart:       "\"%%%s\" はセルの先頭にのみ記述できます",
+		MsgNoInputPrompting:      "%%%s はこのノートブックでは使用できません（入力の要求が許可されていません）",
+		MsgErrorFormat:           "コンパイルエラーは %q 形式で報告されます\n",
+		MsgWarning:               "警告: ",
+		MsgGoImportsMissing: `
+goimports がインストールされていません。不足している標準パッケージを自動的に
+インポートするために使われる、Go ツールキットの標準パッケージです。
+ノートブックから次のコマンドでインストールできます:
+
+!go install golang.org/x/tools/cmd/goimports@latest
+
+`,
+		MsgDependenciesMissing: `
+goimports および/または gopls がインストールされていません。これらは必須の依存関係で、
+通常は Go ツールキットの標準パッケージです。次のコマンドでインストールできます:
+
+go install golang.org/x/tools/cmd/goimports@latest
+go install golang.org/x/tools/gopls@latest
+
+`,
+		MsgKernelInstalled:   "Go (gonb) カーネルの設定を %q にインストールしました。\n",
+		MsgKernelFlagMissing: "--install でカーネルをインストールするか、Jupyter から起動する場合は --kernel フラグを指定してください。\n",
+		MsgHelpFullReference: "完全なリファレンス（英語）",
+	},
+}
@@ -0,0 +1,103 @@
+// Package i18n holds the catalog of localized messages of the kernel, and the selection of the language
+// used to display them.
+//
+// The language is selected with SetLanguage (the `--lang` flag), or otherwise from the standard locale
+// environment variables (`LC_ALL`, `LC_MESSAGES` and `LANG`). Messages not translated to the selected
+// language fall back to English.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage is used when no supported language is selected, and for messages not translated.
+const DefaultLanguage = "en"
+
+// LocaleEnvVars are the environment variables checked, in order, to select the language, if none is set
+// with SetLanguage.
+var LocaleEnvVars = []string{"LC_ALL", "LC_MESSAGES", "LANG"}
+
+var (
+	muLanguage sync.Mutex
+	language   string // Empty if not yet selected.
+)
+
+// Normalize converts a locale (e.g. "pt_BR.UTF-8", "zh-Hans" or "ja") to one of the supported languages,
+// or returns an empty string if not supported.
+func Normalize(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if idx := strings.IndexAny(locale, "_-.@"); idx >= 0 {
+		locale = locale[:idx]
+	}
+	if _, found := catalog[locale]; found {
+		return locale
+	}
+	return ""
+}
+
+// SetLanguage selects the language of the messages. It returns an error if the language is not supported,
+// see Languages.
+func SetLanguage(locale string) error {
+	lang := Normalize(locale)
+	if lang == "" {
+		return fmt.Errorf("language %q not supported, the supported languages are %q", locale, Languages())
+	}
+	muLanguage.Lock()
+	defer muLanguage.Unlock()
+	language = lang
+	return nil
+}
+
+// Language returns the selected language. If none was selected with SetLanguage, it is taken from the
+// locale environment variables (see LocaleEnvVars) the first time it is called.
+func Language() string {
+	muLanguage.Lock()
+	defer muLanguage.Unlock()
+	if language == "" {
+		language = languageFromEnv()
+	}
+	return language
+}
+
+// languageFromEnv returns the language of the first locale environment variable set, or DefaultLanguage.
+func languageFromEnv() string {
+	for _, key := range LocaleEnvVars {
+		locale := os.Getenv(key)
+		if locale == "" {
+			continue
+		}
+		if lang := Normalize(locale); lang != "" {
+			return lang
+		}
+		// "C", "POSIX" or an unsupported language: use the default.
+		break
+	}
+	return DefaultLanguage
+}
+
+// Languages returns the supported languages.
+func Languages() []string {
+	return supportedLanguages
+}
+
+// T returns the message with the given key in the selected language, formatted with args (as fmt.Sprintf)
+// if any are given.
+//
+// If the message is not translated to the selected language, the English version is used. If the key
+// doesn't exist, the key itself is returned.
+func T(key MessageKey, args ...any) string {
+	format, found := catalog[Language()][key]
+	if !found {
+		format, found = catalog[DefaultLanguage][key]
+		if !found {
+			format = string(key)
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,66 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "pt", Normalize("pt_BR.UTF-8"))
+	assert.Equal(t, "zh", Normalize("zh-Hans"))
+	assert.Equal(t, "ja", Normalize("JA"))
+	assert.Equal(t, "en", Normalize("en_US@euro"))
+	assert.Equal(t, "", Normalize("C"))
+	assert.Equal(t, "", Normalize("xx_YY"))
+}
+
+func TestLanguageFromEnv(t *testing.T) {
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "es_ES.UTF-8")
+	t.Setenv("LANG", "ja_JP.UTF-8")
+	assert.Equal(t, "es", languageFromEnv())
+	t.Setenv("LC_MESSAGES", "")
+	assert.Equal(t, "ja", languageFromEnv())
+	t.Setenv("LC_ALL", "C")
+	assert.Equal(t, DefaultLanguage, languageFromEnv())
+}
+
+func TestT(t *testing.T) {
+	defer func() { require.NoError(t, SetLanguage(DefaultLanguage)) }()
+	require.Error(t, SetLanguage("klingon"))
+
+	require.NoError(t, SetLanguage("pt_BR"))
+	assert.Equal(t, "pt", Language())
+	assert.Equal(t, `"%foo" desconhecido ou ainda não implementado.`, T(MsgUnknownSpecialCommand, "foo"))
+	assert.Equal(t, "missing_key", T("missing_key"))
+
+	require.NoError(t, SetLanguage("en"))
+	assert.Equal(t, `"%foo" unknown or not implemented yet.`, T(MsgUnknownSpecialCommand, "foo"))
+}
+
+// TestCatalog checks that all translations exist in English, and that they take the same arguments.
+func TestCatalog(t *testing.T) {
+	require.Len(t, catalog, len(supportedLanguages))
+	verbs := func(format string) string {
+		var parts []string
+		for ii := 0; ii < len(format)-1; ii++ {
+			if format[ii] == '%' {
+				parts = append(parts, format[ii:ii+2])
+				ii++
+			}
+		}
+		return strings.Join(parts, ",")
+	}
+	for _, lang := range supportedLanguages {
+		messages, found := catalog[lang]
+		require.Truef(t, found, "language %q has no catalog", lang)
+		for key, format := range messages {
+			english, found := catalog[DefaultLanguage][key]
+			require.Truef(t, found, "message %q of language %q not in English", key, lang)
+			assert.Equalf(t, verbs(english), verbs(format), "message %q of language %q", key, lang)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package jpyexec
+
+import (
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the batching of display updates (`gonbui.BeginBatch` and `gonbui.EndBatch`):
+// while a batch is open, only the latest update of each display id is kept, and they are all
+// published when the batch ends, reducing flicker and the number of messages sent to the front-end.
+
+// dispatchDisplayBatch starts or ends a batch of display updates.
+func (exec *Executor) dispatchDisplayBatch(req *protocol.DisplayBatch) {
+	if !req.End {
+		exec.batchDepth++
+		klog.V(2).Infof("DisplayBatch started (depth=%d)", exec.batchDepth)
+		return
+	}
+	if exec.batchDepth == 0 {
+		klog.Warningf("DisplayBatch ended without being started, ignored")
+		return
+	}
+	exec.batchDepth--
+	klog.V(2).Infof("DisplayBatch ended (depth=%d)", exec.batchDepth)
+	if exec.batchDepth == 0 {
+		exec.flushDisplayBatch()
+	}
+}
+
+// batchDisplayUpdate holds the update to a display id until the batch ends, replacing any previous
+// update to the same display id.
+func (exec *Executor) batchDisplayUpdate(data *protocol.DisplayData) {
+	for ii, previous := range exec.batchedUpdates {
+		if previous.DisplayID == data.DisplayID {
+			exec.batchedUpdates[ii] = data
+			return
+		}
+	}
+	exec.batchedUpdates = append(exec.batchedUpdates, data)
+}
+
+// flushDisplayBatch publishes the display updates held, and closes any open batch.
+// It's also called when the program closes the named pipe, so updates are not lost if the program
+// didn't end its batch.
+func (exec *Executor) flushDisplayBatch() {
+	exec.batchDepth = 0
+	if len(exec.batchedUpdates) == 0 {
+		return
+	}
+	klog.V(2).Infof("DisplayBatch: publishing %d display update(s)", len(exec.batchedUpdates))
+	for _, data := range exec.batchedUpdates {
+		exec.dispatchDisplayData(data)
+	}
+	exec.batchedUpdates = nil
+}
@@ -0,0 +1,147 @@
+package jpyexec
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// This file implements the handling of binary (not valid UTF-8) output written by the program to stdout/stderr:
+// the Jupyter protocol requires valid UTF-8 strings, so the binary output is converted according to a
+// BinaryPolicy.
+
+// BinaryPolicy defines how the output of the program that is not valid UTF-8 is displayed.
+type BinaryPolicy string
+
+const (
+	// BinaryReplace replaces invalid UTF-8 bytes with the Unicode replacement character (U+FFFD). It is the default.
+	BinaryReplace BinaryPolicy = "replace"
+
+	// BinaryHexDump displays binary output as a hexdump (like `hexdump -C`).
+	BinaryHexDump BinaryPolicy = "hexdump"
+
+	// BinaryBase64 displays binary output encoded as base64, one line per write.
+	BinaryBase64 BinaryPolicy = "base64"
+
+	// BinaryDiscard discards binary output, displaying only the number of bytes discarded.
+	BinaryDiscard BinaryPolicy = "discard"
+)
+
+// BinaryPolicies lists the valid values of BinaryPolicy.
+var BinaryPolicies = []BinaryPolicy{BinaryReplace, BinaryHexDump, BinaryBase64, BinaryDiscard}
+
+// ParseBinaryPolicy returns the BinaryPolicy with the given name.
+func ParseBinaryPolicy(name string) (BinaryPolicy, error) {
+	for _, policy := range BinaryPolicies {
+		if string(policy) == name {
+			return policy, nil
+		}
+	}
+	return "", errors.Errorf("unknown binary output policy %q, valid values are %q", name, BinaryPolicies)
+}
+
+// binarySafeWriter is an io.Writer that converts binary content according to its policy before writing it to
+// the underlying writer.
+//
+// Each write is checked separately: valid UTF-8 content is written unchanged, except for an incomplete
+// trailing UTF-8 sequence, which is held back until the next write (or Close).
+type binarySafeWriter struct {
+	policy  BinaryPolicy
+	writer  io.Writer
+	partial []byte
+
+	// dumper is the hexdump of the current run of binary writes, so offsets continue across writes.
+	dumper io.WriteCloser
+}
+
+// newBinarySafeWriter returns a binarySafeWriter with the given policy, writing to w.
+func newBinarySafeWriter(policy BinaryPolicy, w io.Writer) *binarySafeWriter {
+	if policy == "" {
+		policy = BinaryReplace
+	}
+	return &binarySafeWriter{policy: policy, writer: w}
+}
+
+// Write implements io.Writer.
+func (w *binarySafeWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(w.partial) > 0 {
+		p = append(w.partial, p...)
+		w.partial = nil
+	}
+	if cut := incompleteRuneSuffix(p); cut > 0 {
+		w.partial = append([]byte(nil), p[len(p)-cut:]...)
+		p = p[:len(p)-cut]
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+	if utf8.Valid(p) {
+		if err := w.closeDumper(); err != nil {
+			return 0, err
+		}
+		_, err := w.writer.Write(p)
+		return n, err
+	}
+	_, err := w.writeBinary(p)
+	return n, err
+}
+
+// writeBinary writes p, which is not valid UTF-8, according to the policy.
+func (w *binarySafeWriter) writeBinary(p []byte) (int, error) {
+	switch w.policy {
+	case BinaryHexDump:
+		if w.dumper == nil {
+			w.dumper = hex.Dumper(w.writer)
+		}
+		return w.dumper.Write(p)
+	case BinaryBase64:
+		return io.WriteString(w.writer, base64.StdEncoding.EncodeToString(p)+"\n")
+	case BinaryDiscard:
+		return io.WriteString(w.writer, fmt.Sprintf("[%d bytes of binary output discarded]\n", len(p)))
+	default:
+		return io.WriteString(w.writer, strings.ToValidUTF8(string(p), string(utf8.RuneError)))
+	}
+}
+
+// closeDumper finishes the current hexdump, if any.
+func (w *binarySafeWriter) closeDumper() error {
+	if w.dumper == nil {
+		return nil
+	}
+	err := w.dumper.Close()
+	w.dumper = nil
+	return err
+}
+
+// Close writes any content held back, and finishes the current hexdump.
+func (w *binarySafeWriter) Close() error {
+	if len(w.partial) > 0 {
+		partial := w.partial
+		w.partial = nil
+		if _, err := w.writeBinary(partial); err != nil {
+			return err
+		}
+	}
+	return w.closeDumper()
+}
+
+// incompleteRuneSuffix returns the length of the incomplete UTF-8 sequence at the end of p, or 0 if p doesn't end
+// with one.
+func incompleteRuneSuffix(p []byte) int {
+	for ii := 1; ii < utf8.UTFMax && ii <= len(p); ii++ {
+		b := p[len(p)-ii]
+		if utf8.RuneStart(b) {
+			if b >= utf8.RuneSelf && !utf8.FullRune(p[len(p)-ii:]) {
+				return ii
+			}
+			return 0
+		}
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package jpyexec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncompleteRuneSuffix(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		p    string
+		want int
+	}{
+		{"empty", "", 0},
+		{"ascii", "abc", 0},
+		{"complete 2 bytes", "café", 0},
+		{"complete 3 bytes", "a€", 0},
+		{"complete 4 bytes", "a😀", 0},
+		{"1 of 2 bytes", "caf\xc3", 1},
+		{"2 of 3 bytes", "a\xe2\x82", 2},
+		{"3 of 4 bytes", "a\xf0\x9f\x98", 3},
+		{"continuation only", "\x80", 0},
+		{"invalid byte", "a\xff", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, incompleteRuneSuffix([]byte(tc.p)))
+		})
+	}
+}
+
+func TestBinarySafeWriter(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy BinaryPolicy
+		writes []string
+		want   string
+	}{
+		{"text", BinaryReplace, []string{"hello\n", "world\n"}, "hello\nworld\n"},
+		{"default policy", "", []string{"a\xffb"}, "a�b"},
+		{"replace", BinaryReplace, []string{"a\xffb\n"}, "a�b\n"},
+		{"split rune", BinaryReplace, []string{"caf\xc3", "\xa9\n"}, "café\n"},
+		{"split rune 4 bytes", BinaryBase64, []string{"a\xf0", "\x9f", "\x98\x80\n"}, "a😀\n"},
+		{"incomplete rune at close", BinaryReplace, []string{"ab\xc3"}, "ab�"},
+		{"base64", BinaryBase64, []string{"ok\n", "\x00\xff"},
+			"ok\n" + base64.StdEncoding.EncodeToString([]byte("\x00\xff")) + "\n"},
+		{"discard", BinaryDiscard, []string{"\xff\xfe\xfd", "ok\n"},
+			"[3 bytes of binary output discarded]\nok\n"},
+		{"hexdump", BinaryHexDump, []string{"\xff\xfe"}, hex.Dump([]byte("\xff\xfe"))},
+		{"hexdump across writes", BinaryHexDump, []string{"\xffabcdefghijklmnop", "\xfe"},
+			hex.Dump([]byte("\xffabcdefghijklmnop\xfe"))},
+		{"hexdump ended by text", BinaryHexDump, []string{"\xff", "ok\n"}, hex.Dump([]byte("\xff")) + "ok\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newBinarySafeWriter(tc.policy, &buf)
+			for _, p := range tc.writes {
+				n, err := w.Write([]byte(p))
+				require.NoError(t, err)
+				assert.Equal(t, len(p), n)
+			}
+			require.NoError(t, w.Close())
+			assert.Equal(t, tc.want, buf.String())
+		})
+	}
+}
+
+func TestParseBinaryPolicy(t *testing.T) {
+	for _, policy := range BinaryPolicies {
+		got, err := ParseBinaryPolicy(string(policy))
+		require.NoError(t, err)
+		assert.Equal(t, policy, got)
+	}
+	_, err := ParseBinaryPolicy("unknown")
+	require.Error(t, err)
+}
@@ -0,0 +1,86 @@
+package jpyexec
+
+import (
+	"github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the registry of displays (output blocks with a display id) created by the
+// program with `gonbui.NewDisplay`: they are transient, and are cleared when the program exits, so they
+// don't linger in the notebook.
+
+// MaxTransientDisplays is the maximum number of displays registered (or published) by a program that are tracked:
+// beyond that, the least recently updated ones are forgotten, and they are not cleared when the program exits.
+const MaxTransientDisplays = 10_000
+
+// dispatchDisplayHandle registers a display, or unregisters it if it is to be kept.
+func (exec *Executor) dispatchDisplayHandle(req *protocol.DisplayHandle) {
+	if req.Keep {
+		if exec.displays != nil {
+			exec.displays.Delete(req.DisplayID)
+		}
+		klog.V(2).Infof("Display %q kept", req.DisplayID)
+		return
+	}
+	if exec.displays == nil {
+		exec.displays = common.NewLRUSet[string](MaxTransientDisplays)
+	}
+	if evicted, ok := exec.displays.Insert(req.DisplayID); ok {
+		klog.V(1).Infof("Too many displays registered, display %q won't be cleared at exit", evicted)
+	}
+	klog.V(2).Infof("Display %q registered", req.DisplayID)
+}
+
+// dispatchClearOutput clears the output of the cell.
+//
+// The displays published by the program are cleared along, so they are forgotten by the kernel: if they are
+// updated afterward, they are created anew.
+func (exec *Executor) dispatchClearOutput(req *protocol.ClearOutput) {
+	exec.flushDisplayBatch()
+	exec.streams.Flush()
+	if err := kernel.PublishClearOutput(exec.Msg, req.Wait); err != nil {
+		klog.Errorf("Failed to clear output (ignoring): %v", err)
+	}
+	if exec.Msg == nil {
+		return
+	}
+	if exec.publishedDisplayIds == nil {
+		return
+	}
+	knownBlockIds := exec.Msg.Kernel().KnownBlockIds()
+	for _, displayId := range exec.publishedDisplayIds.Keys() {
+		knownBlockIds.Delete(displayId)
+	}
+	exec.publishedDisplayIds = nil
+}
+
+// finishDisplays publishes the pending display updates, and clears the displays registered by the program,
+// when it closes the named pipe.
+func (exec *Executor) finishDisplays() {
+	exec.muDisplays.Lock()
+	defer exec.muDisplays.Unlock()
+	exec.flushDisplayBatch()
+	exec.clearDisplays()
+	exec.closeNamedStreams()
+}
+
+// clearDisplays clears the contents of the displays registered by the program, and resets the registry.
+// Displays never published (or already removed by a clear_output) are skipped.
+func (exec *Executor) clearDisplays() {
+	if exec.displays == nil || exec.displays.Len() == 0 {
+		return
+	}
+	klog.V(2).Infof("Clearing %d display(s) created by the program", exec.displays.Len())
+	for _, displayId := range exec.displays.Keys() {
+		if exec.publishedDisplayIds == nil || !exec.publishedDisplayIds.Has(displayId) {
+			continue
+		}
+		exec.dispatchDisplayData(&protocol.DisplayData{
+			Data:      map[protocol.MIMEType]any{protocol.MIMETextHTML: ""},
+			DisplayID: displayId,
+		})
+	}
+	exec.displays = nil
+}
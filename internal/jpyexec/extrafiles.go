@@ -0,0 +1,75 @@
+package jpyexec
+
+// This file implements the passing of extra file descriptors (e.g. listening sockets) to the executed program.
+
+import (
+	"fmt"
+	"net"
+	"os"
+	osexec "os/exec"
+	"strings"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+)
+
+// extraFile is a file descriptor to be inherited by the program: either a file or a listener.
+type extraFile struct {
+	name     string
+	file     *os.File
+	listener net.Listener
+}
+
+// WithExtraFile configures the command to inherit the open file, advertised to the program with the given name
+// in the environment variable GONB_FDS (see protocol.GONB_FDS_ENV and `gonbui.InheritedFile`).
+//
+// The file remains owned by the caller, and it should be kept open until the command starts.
+func (exec *Executor) WithExtraFile(name string, file *os.File) *Executor {
+	exec.extraFiles = append(exec.extraFiles, extraFile{name: name, file: file})
+	return exec
+}
+
+// WithListener configures the command to inherit the listening socket, advertised to the program with the given
+// name in the environment variable GONB_FDS (see protocol.GONB_FDS_ENV and `gonbui.Listener`).
+//
+// The listener remains owned by the caller, so it can be passed again to the next execution: this allows
+// programs to serve on the same port across executions, without waiting for the port to be released.
+// It must be a *net.TCPListener or a *net.UnixListener.
+func (exec *Executor) WithListener(name string, listener net.Listener) *Executor {
+	exec.extraFiles = append(exec.extraFiles, extraFile{name: name, listener: listener})
+	return exec
+}
+
+// setExtraFiles configures cmd with the extra files, and the environment variable advertising them.
+// It returns the files duplicated from the listeners, which must be closed once the command started.
+func (exec *Executor) setExtraFiles(cmd *osexec.Cmd) (listenerFiles []*os.File, err error) {
+	if len(exec.extraFiles) == 0 {
+		return nil, nil
+	}
+	fds := make([]string, 0, len(exec.extraFiles))
+	for ii, extra := range exec.extraFiles {
+		if strings.ContainsAny(extra.name, ",=") {
+			return listenerFiles, errors.Errorf("invalid name %q for extra file descriptor: it can't contain ',' or '='", extra.name)
+		}
+		file := extra.file
+		if extra.listener != nil {
+			fileListener, ok := extra.listener.(interface{ File() (*os.File, error) })
+			if !ok {
+				return listenerFiles, errors.Errorf("listener %q of type %T can't be inherited", extra.name, extra.listener)
+			}
+			file, err = fileListener.File()
+			if err != nil {
+				return listenerFiles, errors.Wrapf(err, "failed to get the file descriptor of listener %q", extra.name)
+			}
+			listenerFiles = append(listenerFiles, file)
+		}
+		cmd.ExtraFiles = append(cmd.ExtraFiles, file)
+		// The extra files are numbered after stdin, stdout and stderr.
+		fds = append(fds, fmt.Sprintf("%s=%d", extra.name, 3+ii))
+	}
+	if cmd.Env == nil {
+		cmd.Env = cmd.Environ()
+	}
+	cmd.Env = append(cmd.Env, protocol.GONB_FDS_ENV+"="+strings.Join(fds, ","))
+	return listenerFiles, nil
+}
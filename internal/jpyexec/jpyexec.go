@@ -9,12 +9,12 @@
 package jpyexec
 
 import (
+	"github.com/janpfeifer/gonb/common"
 	"github.com/janpfeifer/gonb/gonbui/protocol"
 	"github.com/janpfeifer/gonb/internal/kernel"
 	"github.com/pkg/errors"
 	"io"
 	"k8s.io/klog/v2"
-	"os"
 	osexec "os/exec"
 	"sync"
 	"syscall"
@@ -32,10 +32,16 @@ type Executor struct {
 	dir                        string
 	useNamedPipes              bool
 	commsHandler               CommsHandler
+	pipeAuthenticator          PipeAuthenticator
 	stdoutWriter, stderrWriter io.Writer
 	stdinContent               []byte
 	millisecondsToInput        int
 	inputPassword              bool
+	inProcessGroup             bool
+	env                        []string
+	extraFiles                 []extraFile
+	signalPolicy               *SignalPolicy
+	store                      KeyValueStore
 
 	// State when execution starts (after call to Exec)
 	cmd                                      *osexec.Cmd
@@ -59,9 +65,49 @@ type Executor struct {
 	// captureDisplayDataOutput is a writer to where all data to be displayed send through the named pipe is
 	// copied.
 	//
-	// Notice the contents are written raw, without the mime-type.
+	// Notice the contents are written raw, without the mime-type, unless the writer implements
+	// DisplayDataCapturer.
 	captureDisplayDataOutput io.Writer
 
+	// suppressDisplayData prevents data received through the named pipe from being published to Jupyter.
+	suppressDisplayData bool
+
+	// sanitizeHTML and scriptNonce configure the processing of the HTML received through the named pipe.
+	// See SanitizeHTML and WithScriptNonce.
+	sanitizeHTML bool
+	scriptNonce  string
+
+	// batchDepth is the number of nested display batches open, and batchedUpdates holds the latest update
+	// for each display id received while a batch is open, in the order they were first updated.
+	// They are guarded by muDisplays. See dispatchDisplayBatch.
+	batchDepth     int
+	batchedUpdates []*protocol.DisplayData
+
+	// displays registered by the program (`gonbui.NewDisplay`), to be cleared when the program exits.
+	// Guarded by muDisplays, and capped to MaxTransientDisplays. See dispatchDisplayHandle.
+	displays *common.LRUSet[string]
+
+	// publishedDisplayIds are the display ids published by the program, forgotten when the program clears
+	// its output. Guarded by muDisplays, and capped to MaxTransientDisplays.
+	publishedDisplayIds *common.LRUSet[string]
+
+	// streams buffers the stdout and stderr of the program. See WithStreamBuffer.
+	streams *streamBuffer
+
+	// streamRoutes configures the destination of the named streams, and namedStreams holds the state of the ones
+	// written by the program, guarded by muDisplays. namedStreamsTimer publishes the throttled updates to
+	// their display blocks. See WithStreamRoutes.
+	streamRoutes      map[string]StreamRoute
+	namedStreams      map[string]*namedStream
+	namedStreamsTimer *time.Timer
+
+	// muDisplays serializes the requests dispatched by the goroutine polling the named pipe with the
+	// throttled updates published by namedStreamsTimer, and guards the display state they share.
+	muDisplays sync.Mutex
+
+	// binaryPolicy defines how output that is not valid UTF-8 is handled. See WithBinaryPolicy.
+	binaryPolicy BinaryPolicy
+
 	isDone   bool
 	doneChan chan struct{}
 	muDone   sync.Mutex
@@ -82,6 +128,8 @@ func New(msg kernel.Message, command string, args ...string) *Executor {
 		command:             command,
 		args:                args,
 		millisecondsToInput: -1,
+		streams:             newStreamBuffer(DefaultStreamBufferInterval),
+		binaryPolicy:        BinaryReplace,
 	}
 }
 
@@ -108,6 +156,29 @@ func (exec *Executor) ExecutionCount(c int) *Executor {
 	return exec
 }
 
+// CellExecutionCount returns the execution count of the cell being executed: the one set with ExecutionCount,
+// or the kernel's execution counter. It returns -1 if not known.
+func (exec *Executor) CellExecutionCount() int {
+	if exec.executionCount < 0 && exec.Msg != nil && exec.Msg.Kernel() != nil {
+		return exec.Msg.Kernel().ExecCounter()
+	}
+	return exec.executionCount
+}
+
+// WithStreamBuffer configures the interval between flushes of the program's stdout and stderr to the front-end.
+// If interval <= 0, the output is published as soon as it is read. Default is DefaultStreamBufferInterval.
+func (exec *Executor) WithStreamBuffer(interval time.Duration) *Executor {
+	exec.streams = newStreamBuffer(interval)
+	return exec
+}
+
+// WithBinaryPolicy configures how the output of the program (stdout and stderr) that is not valid UTF-8 is displayed.
+// Default is BinaryReplace.
+func (exec *Executor) WithBinaryPolicy(policy BinaryPolicy) *Executor {
+	exec.binaryPolicy = policy
+	return exec
+}
+
 // InDir configures the Executor to execute within the given directory. Returns
 // the modified builder.
 func (exec *Executor) InDir(dir string) *Executor {
@@ -166,12 +237,72 @@ func (exec *Executor) WithStaticInput(stdinContent []byte) *Executor {
 // and send it as protocol.DisplayMessage messages, in the named pipe.
 //
 // The captured data is sent to the given `io.Writer` raw without any processing or attached mime-type.
+// If the writer also implements DisplayDataCapturer, it receives instead the full protocol.DisplayData,
+// which allows capturing rich content (HTML, images, etc.).
 func (exec *Executor) CaptureDisplayDataOutput(writer io.Writer) *Executor {
 	exec.captureDisplayDataOutput = writer
 	return exec
 }
 
-// WaitToKill is the to wait after an interrupt signal, before killing the process.
+// DisplayDataCapturer can be implemented by the writer given to Executor.CaptureDisplayDataOutput, to
+// capture the full display data (with all mime-types and metadata) sent by the program.
+type DisplayDataCapturer interface {
+	CaptureDisplayData(data *protocol.DisplayData) error
+}
+
+// SuppressDisplayData configures the Executor not to publish the data sent through the named pipe
+// to Jupyter. Presumably it is only being captured, see CaptureDisplayDataOutput.
+func (exec *Executor) SuppressDisplayData() *Executor {
+	exec.suppressDisplayData = true
+	return exec
+}
+
+// SanitizeHTML configures the Executor to sanitize the HTML sent through the named pipe before publishing
+// it, removing scripts, iframes, event handlers, etc. See kernel.SanitizeHTML.
+func (exec *Executor) SanitizeHTML() *Executor {
+	exec.sanitizeHTML = true
+	return exec
+}
+
+// WithScriptNonce configures the Executor to add the given nonce to the `<script>` and `<style>` tags of the
+// HTML sent through the named pipe, for front-ends with a Content-Security-Policy that requires it.
+// It is a no-op if nonce is empty.
+func (exec *Executor) WithScriptNonce(nonce string) *Executor {
+	exec.scriptNonce = nonce
+	return exec
+}
+
+// WithArgs appends arguments to the command.
+func (exec *Executor) WithArgs(args ...string) *Executor {
+	exec.args = append(exec.args[:len(exec.args):len(exec.args)], args...)
+	return exec
+}
+
+// WithEnv adds environment variables (in the form "KEY=VALUE") to the ones inherited by the command.
+func (exec *Executor) WithEnv(env ...string) *Executor {
+	exec.env = append(exec.env, env...)
+	return exec
+}
+
+// InProcessGroup configures the Executor to start the command in its own process group, and to send
+// interrupt (and kill) signals to the whole group.
+//
+// Useful for commands that start sub-processes themselves (like `make`), so they are also interrupted.
+func (exec *Executor) InProcessGroup() *Executor {
+	exec.inProcessGroup = true
+	return exec
+}
+
+// signal sends the signal to the process, or to its process group if InProcessGroup was configured.
+func (exec *Executor) signal(sig syscall.Signal) error {
+	if exec.inProcessGroup {
+		return syscall.Kill(-exec.cmd.Process.Pid, sig)
+	}
+	return exec.cmd.Process.Signal(sig)
+}
+
+// WaitToKill is the time to wait after an interrupt signal, before killing the process, in the
+// DefaultSignalPolicy.
 var WaitToKill = 5 * time.Second
 
 // Exec executes the configured New configuration.
@@ -191,8 +322,23 @@ func (exec *Executor) Exec() error {
 	cmd := osexec.Command(exec.command, exec.args...)
 	exec.cmd = cmd
 	cmd.Dir = exec.dir
+	if len(exec.env) > 0 {
+		cmd.Env = append(cmd.Environ(), exec.env...)
+	}
+	if exec.inProcessGroup {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pgid: 0}
+	}
+	listenerFiles, err := exec.setExtraFiles(cmd)
+	defer func() {
+		// The program has its own copies of the listeners' file descriptors.
+		for _, f := range listenerFiles {
+			_ = f.Close()
+		}
+	}()
+	if err != nil {
+		return err
+	}
 
-	var err error
 	exec.cmdStdout, err = cmd.StdoutPipe()
 	if err != nil {
 		return errors.WithMessagef(err, "failed to create pipe for stdout")
@@ -213,18 +359,20 @@ func (exec *Executor) Exec() error {
 	if exec.stderrWriter == nil {
 		exec.stderrWriter = kernel.NewJupyterStreamWriter(exec.Msg, kernel.StreamStderr)
 	}
+	stdout := newBinarySafeWriter(exec.binaryPolicy, exec.stdoutWriter)
+	stderr := newBinarySafeWriter(exec.binaryPolicy, exec.stderrWriter)
 	var streamersWG sync.WaitGroup
 	streamersWG.Add(2)
 	go func() {
 		defer streamersWG.Done()
-		_, err := io.Copy(exec.stdoutWriter, exec.cmdStdout)
+		_, err := io.Copy(exec.streams.Writer(stdout), exec.cmdStdout)
 		if err != nil {
 			klog.Errorf("Failed copying execution stdout: %+v", err)
 		}
 	}()
 	go func() {
 		defer streamersWG.Done()
-		_, err := io.Copy(exec.stderrWriter, exec.cmdStderr)
+		_, err := io.Copy(exec.streams.Writer(stderr), exec.cmdStderr)
 		if err != nil && err != io.EOF {
 			klog.Errorf("Failed copying execution stderr: %+v", err)
 		}
@@ -253,22 +401,11 @@ func (exec *Executor) Exec() error {
 
 	var interruptId kernel.SubscriptionId
 	interruptId = exec.Msg.Kernel().SubscribeInterrupt(func(id kernel.SubscriptionId) {
-		// Sent interrupt to process.
-		err := cmd.Process.Signal(os.Interrupt)
+		// Sent interrupt to process, see SignalPolicy.
 		exec.Msg.Kernel().UnsubscribeInterrupt(interruptId)
-		if err != nil {
+		if err := exec.interrupt(); err != nil {
 			klog.Errorf("failed to interrupt process %s (%v): %+v", cmd, cmd.Process, err)
 		}
-		select {
-		case <-exec.doneChan:
-			// Normal stop, nothing to do.
-		case <-time.After(WaitToKill):
-			// If process hasn't yet died, kill it.
-			err = cmd.Process.Signal(syscall.SIGKILL)
-			if err != nil {
-				klog.Errorf("failed to kill process %s (%v): %+v", cmd, cmd.Process, err)
-			}
-		}
 	})
 
 	if exec.stdinContent != nil {
@@ -277,6 +414,9 @@ func (exec *Executor) Exec() error {
 
 	// Wait for output pipes to finish.
 	streamersWG.Wait()
+	exec.streams.Flush()
+	_ = stdout.Close()
+	_ = stderr.Close()
 	if err := cmd.Wait(); err != nil {
 		errMsg := err.Error() + "\n"
 		if exec.Msg.Kernel().Interrupted.Load() {
@@ -327,6 +467,7 @@ func (exec *Executor) handleJupyterInput() {
 		klog.V(2).Infof("%d milliseconds elapsed, prompt for input", exec.millisecondsToInput)
 		exec.muDone.Lock()
 		if !exec.isDone {
+			exec.streams.Flush()
 			_ = exec.Msg.PromptInput(" ", exec.inputPassword, writeStdinFn)
 		}
 		exec.muDone.Unlock()
@@ -9,12 +9,14 @@ package jpyexec
 import (
 	"encoding/gob"
 	"fmt"
+	"github.com/janpfeifer/gonb/common"
 	"github.com/janpfeifer/gonb/gonbui/protocol"
 	"github.com/janpfeifer/gonb/internal/kernel"
 	"github.com/pkg/errors"
 	"io"
 	"k8s.io/klog/v2"
 	"os"
+	"strconv"
 	"sync"
 	"syscall"
 )
@@ -53,15 +55,23 @@ type CommsHandler interface {
 
 	// ProgramUnsubscribeRequest handler.
 	ProgramUnsubscribeRequest(address string)
+
+	// ProgramThrottleRequest handler: configures the throttling of the updates to an address.
+	ProgramThrottleRequest(req *protocol.CommThrottle)
+
+	// ProgramWidgetRequest handler: opens, updates or closes a Jupyter widget (ipywidgets) model.
+	ProgramWidgetRequest(req *protocol.JupyterWidgetRequest)
 }
 
 // PipeWriterFifoBufferSize is the number of CommValue messages that
 // can be buffered when writing to the named pipe before dropping.
-const PipeWriterFifoBufferSize = 128
+// It is reduced with `--low-memory`.
+var PipeWriterFifoBufferSize = 128
 
 // handleNamedPipes creates the named pipe and set up the goroutines to listen to them.
 //
-// TODO: make this more secure, maybe with a secret key also passed by the environment.
+// The named pipes are only accessible by the current user, and the program has to authenticate itself
+// in the first message it sends, see PipeAuthenticator.
 func (exec *Executor) handleNamedPipes() (err error) {
 	exec.PipeWriterFifo = make(chan *protocol.CommValue, PipeWriterFifoBufferSize)
 
@@ -74,9 +84,20 @@ func (exec *Executor) handleNamedPipes() (err error) {
 	if err != nil {
 		return errors.Wrapf(err, "creating named pipe used to write to program %s", exec.cmd)
 	}
+	if exec.pipeAuthenticator == nil {
+		exec.pipeAuthenticator = NewSecretAuthenticator()
+	}
+	authEnv, err := exec.pipeAuthenticator.Env()
+	if err != nil {
+		return err
+	}
 	exec.cmd.Env = append(exec.cmd.Environ(),
 		protocol.GONB_PIPE_ENV+"="+exec.namedPipeReaderPath,
 		protocol.GONB_PIPE_BACK_ENV+"="+exec.namedPipeWriterPath)
+	exec.cmd.Env = append(exec.cmd.Env, authEnv...)
+	if count := exec.CellExecutionCount(); count >= 0 {
+		exec.cmd.Env = append(exec.cmd.Env, protocol.GONB_EXECUTION_COUNT_ENV+"="+strconv.Itoa(count))
+	}
 
 	exec.openPipeReader()
 	exec.openPipeWriter()
@@ -101,6 +122,10 @@ func (exec *Executor) createTmpFifo() (string, error) {
 	if err = syscall.Mkfifo(pipePath, 0600); err != nil {
 		return "", errors.Wrapf(err, "failed to create pipe (Mkfifo) for %q", pipePath)
 	}
+	if err = checkFifo(pipePath); err != nil {
+		_ = os.Remove(pipePath)
+		return "", err
+	}
 	return pipePath, nil
 }
 
@@ -169,96 +194,242 @@ func (exec *Executor) openPipeReader() {
 // on the notebook or widgets updates.
 func (exec *Executor) pollNamedPipeReader() {
 	decoder := gob.NewDecoder(exec.pipeReader)
+	authenticated := false
 	for {
 		data := &protocol.DisplayData{}
 		err := decoder.Decode(data)
 		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, os.ErrClosed) {
+			exec.finishDisplays()
 			return
 		} else if err != nil {
 			klog.Infof("Named pipe: failed to parse message: %+v", err)
+			exec.finishDisplays()
 			return
 		}
 
-		// Special case for a request for input:
-		if reqAny, found := data.Data[protocol.MIMEJupyterInput]; found {
-			klog.V(2).Infof("Received InputRequest: %v", reqAny)
-			req, ok := reqAny.(protocol.InputRequest)
-			if !ok {
-				exec.reportCellError(errors.Errorf(
-					"A MIMEJupyterInput sent to GONB_PIPE without an associated protocol.InputRequest!? -- got (%T) %#v",
-					reqAny, reqAny))
-				continue
+		// The first message must authenticate the program.
+		if !authenticated {
+			if err := exec.authenticatePipe(data); err != nil {
+				exec.reportCellError(err)
+				_ = exec.pipeReader.Close()
+				return
 			}
-			exec.dispatchInputRequest(&req)
+			authenticated = true
 			continue
 		}
 
-		// CommValue: update or read value in the front-end.
-		if reqAny, found := data.Data[protocol.MIMECommValue]; found {
-			req, ok := reqAny.(protocol.CommValue)
-			if !ok {
-				exec.reportCellError(errors.Errorf(
-					"Invalid message sent in named pipes to GoNB from cell, "+
-						"this may affect widgets communication -- "+
-						"MIMECommValue sent to $GONB_PIPE_BACK without an associated `protocol.CommValue` "+
-						"type, got %T instead", reqAny))
-				continue
-			}
+		exec.muDisplays.Lock()
+		exec.dispatchPipeRequestLocked(data)
+		exec.muDisplays.Unlock()
+	}
+}
 
-			// Special addresses:
-			if req.Address == protocol.GonbuiSyncAddress {
-				syncId, ok := req.Value.(int)
-				if !ok {
-					klog.Errorf("comms: Receive Sync request with invalid value %+v. Communication with cell program may be left in an unusable state!", req)
-					continue
-				}
-				klog.V(2).Infof("comms: Received Sync(%d) at %q, sending back ack", syncId, req.Address)
-				// Acknowledge with a reply to the special address.
-				exec.PipeWriterFifo <- &protocol.CommValue{
-					Address: protocol.GonbuiSyncAckAddress,
-					Value:   syncId,
-				}
-				continue
-			}
+// dispatchPipeRequestLocked dispatches a request received from the program through the named pipe.
+// It must be called with exec.muDisplays locked.
+func (exec *Executor) dispatchPipeRequestLocked(data *protocol.DisplayData) {
+	// Special case for a request for input:
+	if reqAny, found := data.Data[protocol.MIMEJupyterInput]; found {
+		klog.V(2).Infof("Received InputRequest: %v", reqAny)
+		req, ok := reqAny.(protocol.InputRequest)
+		if !ok {
+			exec.reportCellError(errors.Errorf(
+				"A MIMEJupyterInput sent to GONB_PIPE without an associated protocol.InputRequest!? -- got (%T) %#v",
+				reqAny, reqAny))
+			return
+		}
+		exec.dispatchInputRequest(&req)
+		return
+	}
 
-			if exec.commsHandler == nil {
-				klog.V(2).Infof("Received and dropped (no handler registered) CommValue: %+v", req)
-			} else if req.Request {
-				klog.V(2).Infof("ProgramReadValueRequest(%q) requested", req.Address)
-				exec.commsHandler.ProgramReadValueRequest(req.Address)
-			} else {
-				klog.V(2).Infof("ProgramSendValueRequest(%q, %v) requested", req.Address, req.Value)
-				exec.commsHandler.ProgramSendValueRequest(req.Address, req.Value)
-			}
-			continue
+	// CommValue: update or read value in the front-end.
+	if reqAny, found := data.Data[protocol.MIMECommValue]; found {
+		req, ok := reqAny.(protocol.CommValue)
+		if !ok {
+			exec.reportCellError(errors.Errorf(
+				"Invalid message sent in named pipes to GoNB from cell, "+
+					"this may affect widgets communication -- "+
+					"MIMECommValue sent to $GONB_PIPE_BACK without an associated `protocol.CommValue` "+
+					"type, got %T instead", reqAny))
+			return
 		}
 
-		// ProgramSubscribeRequest: (un-)subscribe to address in the front-end.
-		if reqAny, found := data.Data[protocol.MIMECommSubscribe]; found {
-			req, ok := reqAny.(protocol.CommSubscription)
+		// Special addresses:
+		if req.Address == protocol.GonbuiSyncAddress {
+			syncId, ok := req.Value.(int)
 			if !ok {
-				exec.reportCellError(errors.Errorf(
-					"Invalid message sent in named pipes to GoNB from cell, "+
-						"this may affect widgets communication -- "+
-						"MIMECommSubscribe sent to $GONB_PIPE_BACK without an associated `protocol.CommSubscription` "+
-						"type, got %T instead", reqAny))
-				continue
+				klog.Errorf("comms: Receive Sync request with invalid value %+v. Communication with cell program may be left in an unusable state!", req)
+				return
 			}
-			if exec.commsHandler == nil {
-				klog.V(2).Infof("Received and dropped (no handler registered) ProgramSubscribeRequest: %+v", req)
-			} else if req.Unsubscribe {
-				klog.V(2).Infof("ProgramUnsubscribeRequest(%q) requested", req.Address)
-				exec.commsHandler.ProgramUnsubscribeRequest(req.Address)
-			} else {
-				klog.V(2).Infof("ProgramSubscribeRequest(%q) requested", req.Address)
-				exec.commsHandler.ProgramSubscribeRequest(req.Address)
+			klog.V(2).Infof("comms: Received Sync(%d) at %q, sending back ack", syncId, req.Address)
+			// Acknowledge with a reply to the special address.
+			exec.PipeWriterFifo <- &protocol.CommValue{
+				Address: protocol.GonbuiSyncAckAddress,
+				Value:   syncId,
 			}
-			continue
+			return
 		}
 
-		// Otherwise, just display with the corresponding MIME type:
-		exec.dispatchDisplayData(data)
+		if exec.commsHandler == nil {
+			klog.V(2).Infof("Received and dropped (no handler registered) CommValue: %+v", req)
+		} else if req.Request {
+			klog.V(2).Infof("ProgramReadValueRequest(%q) requested", req.Address)
+			exec.commsHandler.ProgramReadValueRequest(req.Address)
+		} else {
+			klog.V(2).Infof("ProgramSendValueRequest(%q, %v) requested", req.Address, req.Value)
+			exec.commsHandler.ProgramSendValueRequest(req.Address, req.Value)
+		}
+		return
 	}
+
+	// ProgramSubscribeRequest: (un-)subscribe to address in the front-end.
+	if reqAny, found := data.Data[protocol.MIMECommSubscribe]; found {
+		req, ok := reqAny.(protocol.CommSubscription)
+		if !ok {
+			exec.reportCellError(errors.Errorf(
+				"Invalid message sent in named pipes to GoNB from cell, "+
+					"this may affect widgets communication -- "+
+					"MIMECommSubscribe sent to $GONB_PIPE_BACK without an associated `protocol.CommSubscription` "+
+					"type, got %T instead", reqAny))
+			return
+		}
+		if exec.commsHandler == nil {
+			klog.V(2).Infof("Received and dropped (no handler registered) ProgramSubscribeRequest: %+v", req)
+		} else if req.Unsubscribe {
+			klog.V(2).Infof("ProgramUnsubscribeRequest(%q) requested", req.Address)
+			exec.commsHandler.ProgramUnsubscribeRequest(req.Address)
+		} else {
+			klog.V(2).Infof("ProgramSubscribeRequest(%q) requested", req.Address)
+			exec.commsHandler.ProgramSubscribeRequest(req.Address)
+		}
+		return
+	}
+
+	// CommThrottle: configure throttling of updates to an address.
+	if reqAny, found := data.Data[protocol.MIMECommThrottle]; found {
+		req, ok := reqAny.(protocol.CommThrottle)
+		if !ok {
+			exec.reportCellError(errors.Errorf(
+				"Invalid message sent in named pipes to GoNB from cell, "+
+					"this may affect widgets communication -- "+
+					"MIMECommThrottle sent to $GONB_PIPE_BACK without an associated `protocol.CommThrottle` "+
+					"type, got %T instead", reqAny))
+			return
+		}
+		if exec.commsHandler == nil {
+			klog.V(2).Infof("Received and dropped (no handler registered) CommThrottle: %+v", req)
+		} else {
+			klog.V(2).Infof("ProgramThrottleRequest(%q, %s) requested", req.Address, req.Period)
+			exec.commsHandler.ProgramThrottleRequest(&req)
+		}
+		return
+	}
+
+	// SessionInfoRequest: information about the notebook session.
+	if reqAny, found := data.Data[protocol.MIMESessionInfo]; found {
+		req, ok := reqAny.(protocol.SessionInfoRequest)
+		if !ok {
+			exec.reportCellError(errors.Errorf(
+				"A MIMESessionInfo sent to GONB_PIPE without an associated protocol.SessionInfoRequest!? -- got (%T) %#v",
+				reqAny, reqAny))
+			return
+		}
+		exec.dispatchSessionInfo(&req)
+		return
+	}
+
+	// StoreRequest: access to the key/value store hosted by GoNB.
+	if reqAny, found := data.Data[protocol.MIMEStoreRequest]; found {
+		req, ok := reqAny.(protocol.StoreRequest)
+		if !ok {
+			exec.reportCellError(errors.Errorf(
+				"A MIMEStoreRequest sent to GONB_PIPE without an associated protocol.StoreRequest!? -- got (%T) %#v",
+				reqAny, reqAny))
+			return
+		}
+		exec.dispatchStore(&req)
+		return
+	}
+
+	// DisplayBatch: start or end a batch of display updates.
+	if reqAny, found := data.Data[protocol.MIMEDisplayBatch]; found {
+		req, ok := reqAny.(protocol.DisplayBatch)
+		if !ok {
+			exec.reportCellError(errors.Errorf(
+				"A MIMEDisplayBatch sent to GONB_PIPE without an associated protocol.DisplayBatch!? -- got (%T) %#v",
+				reqAny, reqAny))
+			return
+		}
+		exec.dispatchDisplayBatch(&req)
+		return
+	}
+
+	// DisplayHandle: register or keep a display created by the program.
+	if reqAny, found := data.Data[protocol.MIMEDisplayHandle]; found {
+		req, ok := reqAny.(protocol.DisplayHandle)
+		if !ok {
+			exec.reportCellError(errors.Errorf(
+				"A MIMEDisplayHandle sent to GONB_PIPE without an associated protocol.DisplayHandle!? -- got (%T) %#v",
+				reqAny, reqAny))
+			return
+		}
+		exec.dispatchDisplayHandle(&req)
+		return
+	}
+
+	// StreamWrite: write to a named stream.
+	if reqAny, found := data.Data[protocol.MIMEStreamWrite]; found {
+		req, ok := reqAny.(protocol.StreamWrite)
+		if !ok {
+			exec.reportCellError(errors.Errorf(
+				"A MIMEStreamWrite sent to GONB_PIPE without an associated protocol.StreamWrite!? -- got (%T) %#v",
+				reqAny, reqAny))
+			return
+		}
+		exec.dispatchStreamWrite(&req)
+		return
+	}
+
+	// ClearOutput: clear the output of the cell.
+	if reqAny, found := data.Data[protocol.MIMEClearOutput]; found {
+		req, ok := reqAny.(protocol.ClearOutput)
+		if !ok {
+			exec.reportCellError(errors.Errorf(
+				"A MIMEClearOutput sent to GONB_PIPE without an associated protocol.ClearOutput!? -- got (%T) %#v",
+				reqAny, reqAny))
+			return
+		}
+		exec.dispatchClearOutput(&req)
+		return
+	}
+
+	// JupyterWidgetRequest: open, update or close a Jupyter widget model in the front-end.
+	if reqAny, found := data.Data[protocol.MIMEJupyterWidget]; found {
+		req, ok := reqAny.(protocol.JupyterWidgetRequest)
+		if !ok {
+			exec.reportCellError(errors.Errorf(
+				"Invalid message sent in named pipes to GoNB from cell, "+
+					"this may affect widgets communication -- "+
+					"MIMEJupyterWidget sent to $GONB_PIPE_BACK without an associated `protocol.JupyterWidgetRequest` "+
+					"type, got %T instead", reqAny))
+			return
+		}
+		if exec.commsHandler == nil {
+			klog.V(2).Infof("Received and dropped (no handler registered) JupyterWidgetRequest: %+v", req)
+		} else {
+			klog.V(2).Infof("ProgramWidgetRequest(%q) requested", req.ModelId)
+			exec.commsHandler.ProgramWidgetRequest(&req)
+		}
+		return
+	}
+
+	// Updates to a display are held while a batch is open.
+	if data.DisplayID != "" && exec.batchDepth > 0 {
+		exec.batchDisplayUpdate(data)
+		return
+	}
+
+	// Otherwise, just display with the corresponding MIME type:
+	exec.dispatchDisplayData(data)
 }
 
 // reportCellError reports error to both, the notebook and the standard logger (gonb's stderr).
@@ -273,17 +444,29 @@ func (exec *Executor) reportCellError(err error) {
 
 // dispatchDisplayData received through the named pipe (`$GONB_PIPE`).
 func (exec *Executor) dispatchDisplayData(data *protocol.DisplayData) {
+	// Output printed before the display data is shown first.
+	exec.streams.Flush()
+
 	// Log info about what is being displayed.
 	msgData := kernel.Data{
 		Data:      make(kernel.MIMEMap, len(data.Data)),
 		Metadata:  make(kernel.MIMEMap),
 		Transient: make(kernel.MIMEMap),
 	}
+	capturer, isCapturer := exec.captureDisplayDataOutput.(DisplayDataCapturer)
+	if isCapturer {
+		if err := capturer.CaptureDisplayData(data); err != nil {
+			klog.Errorf("failed to capture display data output: %v", err)
+		}
+	}
 	for mimeType, content := range data.Data {
+		if mimeType == protocol.MIMETextHTML {
+			content = exec.processHTML(content)
+		}
 		msgData.Data[string(mimeType)] = content
 
 		// Capture display data output, if requested.
-		if exec.captureDisplayDataOutput != nil {
+		if exec.captureDisplayDataOutput != nil && !isCapturer {
 			str, ok := content.(string)
 			if ok {
 				_, err := exec.captureDisplayDataOutput.Write([]byte(str))
@@ -293,6 +476,9 @@ func (exec *Executor) dispatchDisplayData(data *protocol.DisplayData) {
 			}
 		}
 	}
+	if exec.suppressDisplayData {
+		return
+	}
 
 	if klog.V(1).Enabled() {
 		kernel.LogDisplayData(msgData.Data)
@@ -302,6 +488,10 @@ func (exec *Executor) dispatchDisplayData(data *protocol.DisplayData) {
 	}
 	var err error
 	if data.DisplayID != "" {
+		if exec.publishedDisplayIds == nil {
+			exec.publishedDisplayIds = common.NewLRUSet[string](MaxTransientDisplays)
+		}
+		exec.publishedDisplayIds.Insert(data.DisplayID)
 		msgData.Transient["display_id"] = data.DisplayID
 		err = kernel.PublishUpdateDisplayData(exec.Msg, msgData)
 	} else {
@@ -312,13 +502,36 @@ func (exec *Executor) dispatchDisplayData(data *protocol.DisplayData) {
 	}
 }
 
+// processHTML sanitizes and/or adds the script nonce to HTML content, if configured.
+func (exec *Executor) processHTML(content any) any {
+	htmlContent, ok := content.(string)
+	if !ok {
+		return content
+	}
+	if exec.sanitizeHTML {
+		htmlContent = kernel.SanitizeHTML(htmlContent)
+	}
+	if exec.scriptNonce != "" {
+		htmlContent = kernel.AddScriptNonce(htmlContent, exec.scriptNonce)
+	}
+	return htmlContent
+}
+
 // dispatchInputRequest uses the standard Jupyter input mechanism.
 // It is fundamentally broken -- it locks the UI even if the program already stopped running --
 // so we suggest using the `gonb/gonbui/widgets` API instead.
 func (exec *Executor) dispatchInputRequest(req *protocol.InputRequest) {
 	klog.V(2).Infof("Received InputRequest %+v", req)
+	exec.streams.Flush()
 	writeStdinFn := func(original, input *kernel.MessageImpl) error {
 		content := input.Composed.Content.(map[string]any)
+		if req.Reply {
+			exec.sendToProgram(&protocol.CommValue{
+				Address: protocol.GonbuiInputAddress,
+				Value:   protocol.InputReply{Id: req.Id, Value: content["value"].(string)},
+			})
+			return nil
+		}
 		value := content["value"].(string) + "\n"
 		klog.V(2).Infof("stdin value: %q", value)
 		go func() {
@@ -345,6 +558,23 @@ func (exec *Executor) dispatchInputRequest(req *protocol.InputRequest) {
 	}
 }
 
+// sendToProgram sends the message to the program through the named pipe, if it is still running.
+// Unlike sending directly to PipeWriterFifo, it is safe to call after the program finished, and it doesn't block
+// (the message is dropped if the buffer is full).
+func (exec *Executor) sendToProgram(msg *protocol.CommValue) {
+	exec.muDone.Lock()
+	defer exec.muDone.Unlock()
+	if exec.isDone {
+		klog.V(1).Infof("Program already finished, dropped message to %q", msg.Address)
+		return
+	}
+	select {
+	case exec.PipeWriterFifo <- msg:
+	default:
+		klog.Warningf("Buffer to the program is full, dropped message to %q", msg.Address)
+	}
+}
+
 // openPipeWriter opens `exec.namedPipeWriterPath` and handles its proper closing, and removal of
 // the named pipe when program execution is finished.
 //
@@ -0,0 +1,45 @@
+package jpyexec
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatchInputRequestReply(t *testing.T) {
+	msg := kernel.NewTerminalMessage(kernel.NewOffline())
+	var prompts bytes.Buffer
+	msg.Stdout = &prompts
+	msg.Stdin = bufio.NewReader(strings.NewReader("first\nsecond\n"))
+	exec := New(msg, "true")
+	exec.PipeWriterFifo = make(chan *protocol.CommValue, 1)
+
+	// The value entered is sent back to the program, with the id of the request.
+	exec.dispatchInputRequest(&protocol.InputRequest{Prompt: "name: ", Reply: true, Id: 3})
+	select {
+	case reply := <-exec.PipeWriterFifo:
+		assert.Equal(t, protocol.GonbuiInputAddress, reply.Address)
+		assert.Equal(t, protocol.InputReply{Id: 3, Value: "first"}, reply.Value)
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "no reply sent to the program")
+	}
+	assert.Equal(t, "name: ", prompts.String())
+
+	// Once the program finished, the reply is dropped.
+	exec.muDone.Lock()
+	exec.isDone = true
+	exec.muDone.Unlock()
+	exec.dispatchInputRequest(&protocol.InputRequest{Prompt: "again: ", Reply: true, Id: 4})
+	select {
+	case reply := <-exec.PipeWriterFifo:
+		assert.Fail(t, "reply sent to a finished program", "reply: %+v", reply)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,100 @@
+package jpyexec
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"os"
+	"syscall"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+)
+
+// This file implements the authentication of the program on the other side of the named pipes: the first
+// message the program sends must be a protocol.PipeAuth, verified by a PipeAuthenticator. Together with the
+// permission checks on the named pipes, it prevents other local users from injecting content in a notebook.
+
+// PipeAuthenticator authenticates the program executed, on the first message it sends through the named pipe.
+// It's configured with Executor.WithPipeAuthenticator. The default is the one returned by NewSecretAuthenticator.
+type PipeAuthenticator interface {
+	// Env returns the environment variables (in the form "KEY=VALUE") to pass to the program, so it can
+	// authenticate itself. It is called once per execution, before the program starts.
+	Env() ([]string, error)
+
+	// Verify the authentication sent by the program. It returns an error if it is not valid.
+	Verify(auth *protocol.PipeAuth) error
+}
+
+// secretAuthenticator is a PipeAuthenticator based on a random secret, created for each execution, and passed
+// to the program in the environment variable protocol.GONB_PIPE_SECRET_ENV.
+type secretAuthenticator struct {
+	secret string
+}
+
+// NewSecretAuthenticator returns a PipeAuthenticator that creates a new random secret for each execution, passed to
+// the program through the environment variable protocol.GONB_PIPE_SECRET_ENV (`gonbui` sends it automatically).
+func NewSecretAuthenticator() PipeAuthenticator {
+	return &secretAuthenticator{}
+}
+
+// Env implements PipeAuthenticator.
+func (a *secretAuthenticator) Env() ([]string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, errors.Wrap(err, "failed to create secret for the named pipes")
+	}
+	a.secret = hex.EncodeToString(secret)
+	return []string{protocol.GONB_PIPE_SECRET_ENV + "=" + a.secret}, nil
+}
+
+// Verify implements PipeAuthenticator.
+func (a *secretAuthenticator) Verify(auth *protocol.PipeAuth) error {
+	if a.secret == "" || subtle.ConstantTimeCompare([]byte(a.secret), []byte(auth.Secret)) != 1 {
+		return errors.New("invalid secret")
+	}
+	return nil
+}
+
+// WithPipeAuthenticator configures how the program on the other side of the named pipes is authenticated.
+// If not set, NewSecretAuthenticator is used.
+func (exec *Executor) WithPipeAuthenticator(authenticator PipeAuthenticator) *Executor {
+	exec.pipeAuthenticator = authenticator
+	return exec
+}
+
+// authenticatePipe verifies that the first message received through the named pipe authenticates the program.
+func (exec *Executor) authenticatePipe(data *protocol.DisplayData) error {
+	authAny, found := data.Data[protocol.MIMEPipeAuth]
+	if !found {
+		return errors.New("the program didn't authenticate itself on the named pipe to GoNB: if it uses " +
+			"an old version of `github.com/janpfeifer/gonb/gonbui`, please update it")
+	}
+	auth, ok := authAny.(protocol.PipeAuth)
+	if !ok {
+		return errors.Errorf("MIMEPipeAuth sent to GONB_PIPE without an associated protocol.PipeAuth!? -- got %T", authAny)
+	}
+	if err := exec.pipeAuthenticator.Verify(&auth); err != nil {
+		return errors.WithMessage(err, "the program failed to authenticate itself on the named pipe to GoNB")
+	}
+	return nil
+}
+
+// checkFifo verifies that the named pipe in pipePath is owned by the current user and not accessible by
+// anyone else.
+func checkFifo(pipePath string) error {
+	info, err := os.Lstat(pipePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to check named pipe %q", pipePath)
+	}
+	if info.Mode().Type() != os.ModeNamedPipe {
+		return errors.Errorf("%q is not a named pipe (mode %s)", pipePath, info.Mode())
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return errors.Errorf("named pipe %q is accessible by other users (permissions %s)", pipePath, perm)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return errors.Errorf("named pipe %q is owned by another user (uid %d)", pipePath, stat.Uid)
+	}
+	return nil
+}
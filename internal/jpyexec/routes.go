@@ -0,0 +1,240 @@
+package jpyexec
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the routing of the named logical streams written by the program with `gonbui.Stream`:
+// each one goes, by default, to its own display block, or to a file or to the cell's stdout/stderr, as
+// configured with `%route`.
+
+// StreamRouteKind is the kind of destination of a named stream.
+type StreamRouteKind int
+
+const (
+	// RouteDisplay sends the stream to its own display block, updated as the stream is written. It is the default.
+	RouteDisplay StreamRouteKind = iota
+
+	// RouteFile appends the stream to a file.
+	RouteFile
+
+	// RouteStdout and RouteStderr send the stream to the cell's standard output or error.
+	RouteStdout
+	RouteStderr
+
+	// RouteDiscard drops what is written to the stream.
+	RouteDiscard
+)
+
+// StreamRoute is the destination of a named stream. See ParseStreamRoute.
+type StreamRoute struct {
+	Kind StreamRouteKind
+
+	// Path of the file, for RouteFile.
+	Path string
+}
+
+// CaptureRoutePrefix is the prefix of routes to a file: `capture://<path>`.
+const CaptureRoutePrefix = "capture://"
+
+// StreamDisplayMaxBytes is the maximum amount of text of a named stream shown in its display block:
+// only the most recent output is shown.
+const StreamDisplayMaxBytes = 64 * 1024
+
+// ParseStreamRoute parses the destination of a named stream: "display", "stdout", "stderr", "discard" or
+// "capture://<path>".
+func ParseStreamRoute(target string) (StreamRoute, error) {
+	switch target {
+	case "display":
+		return StreamRoute{Kind: RouteDisplay}, nil
+	case "stdout":
+		return StreamRoute{Kind: RouteStdout}, nil
+	case "stderr":
+		return StreamRoute{Kind: RouteStderr}, nil
+	case "discard":
+		return StreamRoute{Kind: RouteDiscard}, nil
+	}
+	if filePath, found := strings.CutPrefix(target, CaptureRoutePrefix); found {
+		if filePath == "" {
+			return StreamRoute{}, errors.Errorf("route %q is missing the file path", target)
+		}
+		return StreamRoute{Kind: RouteFile, Path: filePath}, nil
+	}
+	return StreamRoute{}, errors.Errorf(
+		"invalid route %q, it must be \"display\", \"stdout\", \"stderr\", \"discard\" or \"%s<path>\"",
+		target, CaptureRoutePrefix)
+}
+
+// String returns the route in the format accepted by ParseStreamRoute.
+func (r StreamRoute) String() string {
+	switch r.Kind {
+	case RouteFile:
+		return CaptureRoutePrefix + r.Path
+	case RouteStdout:
+		return "stdout"
+	case RouteStderr:
+		return "stderr"
+	case RouteDiscard:
+		return "discard"
+	default:
+		return "display"
+	}
+}
+
+// WithStreamRoutes configures the destination of the named streams written by the program.
+// Streams not listed are sent to their own display block (RouteDisplay).
+func (exec *Executor) WithStreamRoutes(routes map[string]StreamRoute) *Executor {
+	exec.streamRoutes = routes
+	return exec
+}
+
+// namedStream is the state of a named stream being written by the program.
+type namedStream struct {
+	route     StreamRoute
+	displayId string
+	file      *os.File
+
+	// text holds the most recent output for the display block: it grows up to twice StreamDisplayMaxBytes
+	// before being trimmed, so appending to it is amortized constant time.
+	text []byte
+
+	// lastUpdate is when the display block was last published, and pending is set if it has output
+	// not yet published.
+	lastUpdate time.Time
+	pending    bool
+}
+
+// dispatchStreamWrite writes to a named stream, according to its route.
+// It must be called with exec.muDisplays locked.
+func (exec *Executor) dispatchStreamWrite(req *protocol.StreamWrite) {
+	if exec.namedStreams == nil {
+		exec.namedStreams = make(map[string]*namedStream)
+	}
+	stream, found := exec.namedStreams[req.Name]
+	if !found {
+		stream = &namedStream{route: exec.streamRoutes[req.Name]}
+		exec.namedStreams[req.Name] = stream
+	}
+	switch stream.route.Kind {
+	case RouteDiscard:
+	case RouteStdout, RouteStderr:
+		// Goes through the same buffer as the program's stdout/stderr, so the order is preserved.
+		writer := exec.stdoutWriter
+		if stream.route.Kind == RouteStderr {
+			writer = exec.stderrWriter
+		}
+		exec.streams.write(writer, []byte(strings.ToValidUTF8(req.Text, string(utf8.RuneError))))
+	case RouteFile:
+		if stream.file == nil {
+			f, err := os.OpenFile(stream.route.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				exec.reportCellError(errors.Wrapf(err, "failed to open %q for the stream %q, discarding it",
+					stream.route.Path, req.Name))
+				stream.route = StreamRoute{Kind: RouteDiscard}
+				return
+			}
+			stream.file = f
+		}
+		if _, err := stream.file.WriteString(req.Text); err != nil {
+			klog.Errorf("Failed to write named stream %q to %q: %+v", req.Name, stream.route.Path, err)
+		}
+	default:
+		if stream.displayId == "" {
+			stream.displayId = "gonb_stream_" + common.UniqueId()
+		}
+		stream.text = append(stream.text, req.Text...)
+		if len(stream.text) > 2*StreamDisplayMaxBytes {
+			stream.text = append(stream.text[:0], stream.text[len(stream.text)-StreamDisplayMaxBytes:]...)
+		}
+		stream.pending = true
+
+		// Updates are throttled to the interval of the stdout/stderr buffer, so a program writing to the
+		// stream in a tight loop doesn't republish the whole text on every write. Within a display batch
+		// only the last update is published anyway.
+		wait := exec.streams.interval - time.Since(stream.lastUpdate)
+		if wait <= 0 || exec.batchDepth > 0 {
+			exec.publishNamedStreamLocked(req.Name, stream)
+		} else if exec.namedStreamsTimer == nil {
+			exec.namedStreamsTimer = time.AfterFunc(wait, exec.flushNamedStreams)
+		}
+	}
+}
+
+// displayData returns the display block with the most recent output of the stream.
+func (stream *namedStream) displayData(name string) *protocol.DisplayData {
+	text := stream.text
+	if len(text) > StreamDisplayMaxBytes {
+		start := len(text) - StreamDisplayMaxBytes
+		for start < len(text) && !utf8.RuneStart(text[start]) {
+			start++
+		}
+		text = text[start:]
+	}
+	textStr := string(text)
+	return &protocol.DisplayData{
+		Data: map[protocol.MIMEType]any{
+			protocol.MIMETextPlain: textStr,
+			protocol.MIMETextHTML: fmt.Sprintf("<details open><summary><b>%s</b></summary><pre>%s</pre></details>",
+				html.EscapeString(name), html.EscapeString(textStr)),
+		},
+		DisplayID: stream.displayId,
+	}
+}
+
+// publishNamedStreamLocked publishes the display block of the stream, or holds it if a display batch is open.
+// It must be called with exec.muDisplays locked.
+func (exec *Executor) publishNamedStreamLocked(name string, stream *namedStream) {
+	stream.pending = false
+	stream.lastUpdate = time.Now()
+	if exec.batchDepth > 0 {
+		exec.batchDisplayUpdate(stream.displayData(name))
+		return
+	}
+	exec.dispatchDisplayData(stream.displayData(name))
+}
+
+// flushNamedStreams publishes the display blocks of the named streams with pending output.
+// It is called by namedStreamsTimer.
+func (exec *Executor) flushNamedStreams() {
+	exec.muDisplays.Lock()
+	defer exec.muDisplays.Unlock()
+	exec.flushNamedStreamsLocked()
+}
+
+// flushNamedStreamsLocked implements flushNamedStreams.
+// It must be called with exec.muDisplays locked.
+func (exec *Executor) flushNamedStreamsLocked() {
+	if exec.namedStreamsTimer != nil {
+		exec.namedStreamsTimer.Stop()
+		exec.namedStreamsTimer = nil
+	}
+	for name, stream := range exec.namedStreams {
+		if stream.pending {
+			exec.publishNamedStreamLocked(name, stream)
+		}
+	}
+}
+
+// closeNamedStreams publishes the pending output of the named streams, and closes the files they were
+// written to. It must be called with exec.muDisplays locked.
+func (exec *Executor) closeNamedStreams() {
+	exec.flushNamedStreamsLocked()
+	for name, stream := range exec.namedStreams {
+		if stream.file != nil {
+			if err := stream.file.Close(); err != nil {
+				klog.Errorf("Failed to close %q for the stream %q: %+v", stream.route.Path, name, err)
+			}
+		}
+	}
+	exec.namedStreams = nil
+}
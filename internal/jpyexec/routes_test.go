@@ -0,0 +1,206 @@
+package jpyexec
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStreamRoute(t *testing.T) {
+	for _, tc := range []struct {
+		target  string
+		want    StreamRoute
+		wantErr bool
+	}{
+		{"display", StreamRoute{Kind: RouteDisplay}, false},
+		{"stdout", StreamRoute{Kind: RouteStdout}, false},
+		{"stderr", StreamRoute{Kind: RouteStderr}, false},
+		{"discard", StreamRoute{Kind: RouteDiscard}, false},
+		{"capture:///tmp/log.txt", StreamRoute{Kind: RouteFile, Path: "/tmp/log.txt"}, false},
+		{"capture://", StreamRoute{}, true},
+		{"elsewhere", StreamRoute{}, true},
+	} {
+		t.Run(tc.target, func(t *testing.T) {
+			route, err := ParseStreamRoute(tc.target)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, route)
+			assert.Equal(t, tc.target, route.String())
+		})
+	}
+}
+
+// displayCapturer records the display data published by the Executor.
+type displayCapturer struct {
+	bytes.Buffer
+	displays []*protocol.DisplayData
+}
+
+func (c *displayCapturer) CaptureDisplayData(data *protocol.DisplayData) error {
+	c.displays = append(c.displays, data)
+	return nil
+}
+
+// newRoutesTestExecutor returns an Executor that records its output, without a kernel.
+func newRoutesTestExecutor(interval time.Duration, routes map[string]StreamRoute) (
+	exec *Executor, stdout, stderr *bytes.Buffer, displays *displayCapturer) {
+	stdout, stderr, displays = &bytes.Buffer{}, &bytes.Buffer{}, &displayCapturer{}
+	exec = New(nil, "true").
+		WithStreamBuffer(interval).
+		WithStdout(stdout).
+		WithStderr(stderr).
+		WithStreamRoutes(routes).
+		CaptureDisplayDataOutput(displays).
+		SuppressDisplayData()
+	return
+}
+
+// dispatchLocked dispatches the stream write with exec.muDisplays locked, as the goroutine polling the named pipe does.
+func dispatchLocked(exec *Executor, req *protocol.StreamWrite) {
+	exec.muDisplays.Lock()
+	defer exec.muDisplays.Unlock()
+	exec.dispatchStreamWrite(req)
+}
+
+func TestDispatchStreamWrite(t *testing.T) {
+	logPath := path.Join(t.TempDir(), "log.txt")
+	exec, stdout, stderr, displays := newRoutesTestExecutor(0, map[string]StreamRoute{
+		"out":  {Kind: RouteStdout},
+		"err":  {Kind: RouteStderr},
+		"log":  {Kind: RouteFile, Path: logPath},
+		"none": {Kind: RouteDiscard},
+	})
+	for _, req := range []protocol.StreamWrite{
+		{Name: "out", Text: "to stdout\n"},
+		{Name: "err", Text: "to stderr\n"},
+		{Name: "log", Text: "line 1\n"},
+		{Name: "none", Text: "discarded\n"},
+		{Name: "log", Text: "line 2\n"},
+		{Name: "metrics", Text: "a"},
+		{Name: "metrics", Text: "<b>"},
+		{Name: "out", Text: "invalid \xff\n"},
+	} {
+		dispatchLocked(exec, &req)
+	}
+	exec.finishDisplays()
+
+	assert.Equal(t, "to stdout\ninvalid �\n", stdout.String())
+	assert.Equal(t, "to stderr\n", stderr.String())
+	contents, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2\n", string(contents))
+
+	// Without buffering, each write to a displayed stream updates its display block.
+	require.Len(t, displays.displays, 2)
+	last := displays.displays[1]
+	assert.Equal(t, displays.displays[0].DisplayID, last.DisplayID)
+	assert.True(t, strings.HasPrefix(last.DisplayID, "gonb_stream_"))
+	assert.Equal(t, "a<b>", last.Data[protocol.MIMETextPlain])
+	assert.Contains(t, last.Data[protocol.MIMETextHTML], "<b>metrics</b>")
+	assert.Contains(t, last.Data[protocol.MIMETextHTML], "a&lt;b&gt;")
+}
+
+func TestNamedStreamDisplayThrottling(t *testing.T) {
+	exec, _, _, displays := newRoutesTestExecutor(time.Hour, nil)
+	for ii := 0; ii < 100; ii++ {
+		dispatchLocked(exec, &protocol.StreamWrite{Name: "progress", Text: "."})
+	}
+	// Only the first write is published right away, the others are held until the interval elapses.
+	require.Len(t, displays.displays, 1)
+	assert.Equal(t, ".", displays.displays[0].Data[protocol.MIMETextPlain])
+
+	// Pending output is published when the program ends.
+	exec.finishDisplays()
+	require.Len(t, displays.displays, 2)
+	assert.Equal(t, strings.Repeat(".", 100), displays.displays[1].Data[protocol.MIMETextPlain])
+}
+
+func TestNamedStreamDisplayTimer(t *testing.T) {
+	exec, _, _, displays := newRoutesTestExecutor(10*time.Millisecond, nil)
+	dispatchLocked(exec, &protocol.StreamWrite{Name: "progress", Text: "a"})
+	dispatchLocked(exec, &protocol.StreamWrite{Name: "progress", Text: "b"})
+	numDisplays := func() int {
+		exec.muDisplays.Lock()
+		defer exec.muDisplays.Unlock()
+		return len(displays.displays)
+	}
+	assert.Eventually(t, func() bool { return numDisplays() == 2 }, 5*time.Second, time.Millisecond)
+	exec.finishDisplays()
+	require.Len(t, displays.displays, 2)
+	assert.Equal(t, "ab", displays.displays[1].Data[protocol.MIMETextPlain])
+}
+
+func TestNamedStreamDisplayMaxBytes(t *testing.T) {
+	exec, _, _, displays := newRoutesTestExecutor(time.Hour, nil)
+	chunk := strings.Repeat("é", 1000) + "x" // Odd length, so the cut may fall in the middle of a rune.
+	for ii := 0; ii < 3*StreamDisplayMaxBytes/len(chunk); ii++ {
+		dispatchLocked(exec, &protocol.StreamWrite{Name: "log", Text: chunk})
+	}
+	exec.finishDisplays()
+	text := displays.displays[len(displays.displays)-1].Data[protocol.MIMETextPlain].(string)
+	assert.True(t, utf8.ValidString(text))
+	assert.LessOrEqual(t, len(text), StreamDisplayMaxBytes)
+	assert.Greater(t, len(text), StreamDisplayMaxBytes-utf8.UTFMax)
+	assert.True(t, strings.HasSuffix(text, chunk))
+}
+
+func TestNamedStreamDisplayTimerAfterClearOutput(t *testing.T) {
+	// Published to a kernel message, so the display ids published are tracked and forgotten by the clear output.
+	msg := kernel.NewTerminalMessage(kernel.NewOffline())
+	var output bytes.Buffer
+	msg.Stdout, msg.Stderr = &output, &output
+	displays := &displayCapturer{}
+	exec := New(msg, "true").WithStreamBuffer(10 * time.Millisecond).CaptureDisplayDataOutput(displays)
+	numDisplays := func() int {
+		exec.muDisplays.Lock()
+		defer exec.muDisplays.Unlock()
+		return len(displays.displays)
+	}
+
+	dispatchLocked(exec, &protocol.StreamWrite{Name: "progress", Text: "a"})
+	dispatchLocked(exec, &protocol.StreamWrite{Name: "progress", Text: "b"})
+	exec.muDisplays.Lock()
+	exec.dispatchPipeRequestLocked(&protocol.DisplayData{Data: map[protocol.MIMEType]any{
+		protocol.MIMEClearOutput: protocol.ClearOutput{}}})
+	exec.muDisplays.Unlock()
+	assert.Eventually(t, func() bool { return numDisplays() == 2 }, 5*time.Second, time.Millisecond)
+	exec.muDisplays.Lock()
+	assert.True(t, exec.publishedDisplayIds.Has(displays.displays[1].DisplayID))
+	exec.muDisplays.Unlock()
+	exec.finishDisplays()
+}
+
+func TestNamedStreamDisplayTimerInBatch(t *testing.T) {
+	exec, _, _, displays := newRoutesTestExecutor(10*time.Millisecond, nil)
+	numDisplays := func() int {
+		exec.muDisplays.Lock()
+		defer exec.muDisplays.Unlock()
+		return len(displays.displays)
+	}
+	dispatchLocked(exec, &protocol.StreamWrite{Name: "progress", Text: "a"})
+	dispatchLocked(exec, &protocol.StreamWrite{Name: "progress", Text: "b"})
+	exec.muDisplays.Lock()
+	exec.dispatchDisplayBatch(&protocol.DisplayBatch{})
+	exec.muDisplays.Unlock()
+
+	// The pending update is held in the open batch, and published when it ends.
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, numDisplays())
+	exec.muDisplays.Lock()
+	exec.dispatchDisplayBatch(&protocol.DisplayBatch{End: true})
+	exec.muDisplays.Unlock()
+	require.Equal(t, 2, numDisplays())
+	assert.Equal(t, "ab", displays.displays[1].Data[protocol.MIMETextPlain])
+}
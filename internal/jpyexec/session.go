@@ -0,0 +1,28 @@
+package jpyexec
+
+import (
+	"os"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"k8s.io/klog/v2"
+)
+
+// dispatchSessionInfo replies to the program with the information about the notebook session.
+func (exec *Executor) dispatchSessionInfo(req *protocol.SessionInfoRequest) {
+	info := protocol.SessionInfo{
+		Id:             req.Id,
+		NotebookPath:   kernel.NotebookPath(),
+		ExecutionCount: exec.CellExecutionCount(),
+		Version:        os.Getenv(protocol.GONB_VERSION),
+		GitCommit:      os.Getenv(protocol.GONB_GIT_COMMIT),
+	}
+	if exec.Msg != nil && exec.Msg.Kernel() != nil {
+		info.KernelId = exec.Msg.Kernel().JupyterKernelId
+	}
+	klog.V(2).Infof("SessionInfo(%d) requested, replying %+v", req.Id, info)
+	exec.PipeWriterFifo <- &protocol.CommValue{
+		Address: protocol.GonbuiSessionInfoAddress,
+		Value:   info,
+	}
+}
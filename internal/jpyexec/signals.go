@@ -0,0 +1,146 @@
+package jpyexec
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// This file implements the configuration of the signals sent to the program when the execution is interrupted,
+// or the kernel shuts down. See `%signals`.
+
+// SignalPolicy defines the signals sent to the program when the execution is interrupted (or the kernel shuts
+// down), and when it is killed if it doesn't exit.
+type SignalPolicy struct {
+	// Forward are the signals sent to the program, in order, when the execution is interrupted.
+	Forward []syscall.Signal
+
+	// KillAfter is the time to wait for the program to exit after the signals are forwarded, before killing it
+	// with SIGKILL. If negative, the program is never killed.
+	KillAfter time.Duration
+}
+
+// DefaultSignalPolicy forwards SIGINT, and kills the program after WaitToKill.
+func DefaultSignalPolicy() SignalPolicy {
+	return SignalPolicy{Forward: []syscall.Signal{syscall.SIGINT}, KillAfter: WaitToKill}
+}
+
+// String implements fmt.Stringer, in the format accepted by `%signals`.
+func (p SignalPolicy) String() string {
+	names := make([]string, 0, len(p.Forward))
+	for _, sig := range p.Forward {
+		names = append(names, SignalName(sig))
+	}
+	killAfter := "never"
+	if p.KillAfter >= 0 {
+		killAfter = p.KillAfter.String()
+	}
+	return fmt.Sprintf("forward=%s kill_after=%s", strings.Join(names, ","), killAfter)
+}
+
+// signalsByName are the signals that can be forwarded to the program, see ParseSignal.
+var signalsByName = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// ParseSignal parses the name of a signal, e.g. "SIGTERM" or "term" (case-insensitive, the "SIG" prefix is
+// optional).
+func ParseSignal(name string) (syscall.Signal, error) {
+	key := strings.ToUpper(name)
+	if !strings.HasPrefix(key, "SIG") {
+		key = "SIG" + key
+	}
+	sig, found := signalsByName[key]
+	if !found {
+		return 0, errors.Errorf("unknown or unsupported signal %q", name)
+	}
+	return sig, nil
+}
+
+// SignalName returns the name of the signal, e.g. "SIGTERM".
+func SignalName(sig syscall.Signal) string {
+	for name, s := range signalsByName {
+		if s == sig {
+			return name
+		}
+	}
+	return fmt.Sprintf("signal %d", int(sig))
+}
+
+// ParseSignalPolicy updates the policy with the settings given in args: `forward=<signals...>` (comma-separated)
+// and `kill_after=<duration>|never`.
+func ParseSignalPolicy(policy SignalPolicy, args []string) (SignalPolicy, error) {
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, "=")
+		if !found {
+			return policy, errors.Errorf("invalid setting %q, expected `forward=<signals>` or `kill_after=<duration>`", arg)
+		}
+		switch key {
+		case "forward":
+			var forward []syscall.Signal
+			for _, name := range strings.Split(value, ",") {
+				sig, err := ParseSignal(name)
+				if err != nil {
+					return policy, err
+				}
+				forward = append(forward, sig)
+			}
+			policy.Forward = forward
+		case "kill_after":
+			if value == "never" {
+				policy.KillAfter = -1
+				continue
+			}
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return policy, errors.Errorf("invalid kill_after=%q, expected a non-negative duration (e.g. \"5s\") or \"never\"", value)
+			}
+			policy.KillAfter = d
+		default:
+			return policy, errors.Errorf("unknown setting %q, expected `forward=<signals>` or `kill_after=<duration>`", key)
+		}
+	}
+	return policy, nil
+}
+
+// WithSignalPolicy configures the signals sent to the program when the execution is interrupted.
+// Default is DefaultSignalPolicy.
+func (exec *Executor) WithSignalPolicy(policy SignalPolicy) *Executor {
+	exec.signalPolicy = &policy
+	return exec
+}
+
+// interrupt forwards the signals of the policy to the program, and kills it if it doesn't exit in time.
+func (exec *Executor) interrupt() error {
+	policy := DefaultSignalPolicy()
+	if exec.signalPolicy != nil {
+		policy = *exec.signalPolicy
+	}
+	for _, sig := range policy.Forward {
+		if err := exec.signal(sig); err != nil {
+			return errors.Wrapf(err, "failed to send %s to process %s", SignalName(sig), exec.cmd)
+		}
+	}
+	if policy.KillAfter < 0 {
+		return nil
+	}
+	select {
+	case <-exec.doneChan:
+		// Normal stop, nothing to do.
+	case <-time.After(policy.KillAfter):
+		// If process hasn't yet died, kill it.
+		if err := exec.signal(syscall.SIGKILL); err != nil {
+			return errors.Wrapf(err, "failed to kill process %s", exec.cmd)
+		}
+	}
+	return nil
+}
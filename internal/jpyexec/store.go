@@ -0,0 +1,64 @@
+package jpyexec
+
+import (
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"k8s.io/klog/v2"
+)
+
+// KeyValueStore is the key/value store made available to the program with WithStore, and accessed by the
+// program with `gonbui/store`. Values are opaque, encoded by the program.
+type KeyValueStore interface {
+	// Get returns the value of the key, and whether it was found. If isFile is set, the value is the path of
+	// the file set with SetFile.
+	Get(key string) (value []byte, isFile, found bool)
+
+	// Set the value of the key.
+	Set(key string, value []byte) error
+
+	// SetFile sets the value of the key to the file in filePath, created by the program in the shared
+	// directory. The store takes ownership of the file.
+	SetFile(key string, filePath string) error
+
+	// Delete the key, returning whether it was found.
+	Delete(key string) (found bool, err error)
+
+	// Keys returns the keys in the store, sorted.
+	Keys() []string
+}
+
+// WithStore makes the key/value store available to the program, through the named pipes.
+// Requests from the program (see `gonbui/store`) fail if no store is configured.
+func (exec *Executor) WithStore(store KeyValueStore) *Executor {
+	exec.store = store
+	return exec
+}
+
+// dispatchStore executes the request of the program to the key/value store, and replies with the result.
+func (exec *Executor) dispatchStore(req *protocol.StoreRequest) {
+	reply := protocol.StoreReply{Id: req.Id}
+	var err error
+	switch {
+	case exec.store == nil:
+		reply.Error = "the GoNB store is not available for this execution"
+	case req.Op == protocol.StoreGet:
+		reply.Value, reply.File, reply.Found = exec.store.Get(req.Key)
+	case req.Op == protocol.StoreSet && req.File:
+		err = exec.store.SetFile(req.Key, string(req.Value))
+	case req.Op == protocol.StoreSet:
+		err = exec.store.Set(req.Key, req.Value)
+	case req.Op == protocol.StoreDelete:
+		reply.Found, err = exec.store.Delete(req.Key)
+	case req.Op == protocol.StoreKeys:
+		reply.Keys = exec.store.Keys()
+	default:
+		reply.Error = "invalid operation requested to the GoNB store"
+	}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	klog.V(2).Infof("StoreRequest(%d, op=%d, key=%q) requested, error=%q", req.Id, req.Op, req.Key, reply.Error)
+	exec.PipeWriterFifo <- &protocol.CommValue{
+		Address: protocol.GonbuiStoreAddress,
+		Value:   reply,
+	}
+}
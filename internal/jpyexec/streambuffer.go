@@ -0,0 +1,147 @@
+package jpyexec
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// This file implements the buffering of the stdout/stderr of the program: instead of publishing one message
+// per read from the pipes, the output is accumulated and flushed periodically, so programs writing megabytes per
+// second don't saturate the ZMQ sockets and the browser.
+//
+// Both streams share the same buffer, so the order of the output in stdout and stderr is preserved. It is also
+// flushed before any display data or input request, so they show up in the order they were issued.
+
+// DefaultStreamBufferInterval is the default interval between flushes of the program's stdout/stderr.
+// See Executor.WithStreamBuffer and `%stream_buffer`.
+const DefaultStreamBufferInterval = 50 * time.Millisecond
+
+// StreamBufferMaxSize is the number of bytes buffered before the program's stdout/stderr is flushed, without
+// waiting for the flush interval.
+//
+// It also limits the rate of the output: the flushes happen at most once per interval, and the program blocks
+// on its writes to stdout/stderr while it waits (backpressure).
+const StreamBufferMaxSize = 64 * 1024
+
+// streamBuffer accumulates the output of the program for the writers of the streams.
+type streamBuffer struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	chunks    []streamChunk
+	size      int
+	timer     *time.Timer
+	lastFlush time.Time
+}
+
+// streamChunk is a contiguous piece of output for one writer.
+type streamChunk struct {
+	writer io.Writer
+	data   []byte
+}
+
+// newStreamBuffer creates a streamBuffer that flushes at the given interval.
+// If interval <= 0, the output is written through without buffering.
+func newStreamBuffer(interval time.Duration) *streamBuffer {
+	return &streamBuffer{interval: interval}
+}
+
+// Writer returns an io.Writer that buffers its content to be written to w.
+func (b *streamBuffer) Writer(w io.Writer) io.Writer {
+	return &bufferedStreamWriter{buffer: b, writer: w}
+}
+
+// bufferedStreamWriter implements io.Writer for one stream of a streamBuffer.
+type bufferedStreamWriter struct {
+	buffer *streamBuffer
+	writer io.Writer
+}
+
+// Write implements io.Writer.
+func (w *bufferedStreamWriter) Write(p []byte) (int, error) {
+	w.buffer.write(w.writer, p)
+	return len(p), nil
+}
+
+// write buffers p to be written to w. If the buffer is full, it is flushed right away, after waiting for
+// the flush interval since the last flush -- so the caller is blocked while the output is rate limited.
+//
+// The wait happens without holding the lock, so the other stream and Flush are not blocked by it.
+func (b *streamBuffer) write(w io.Writer, p []byte) {
+	if b.interval <= 0 {
+		b.writeTo(w, p)
+		return
+	}
+	b.mu.Lock()
+	if n := len(b.chunks); n > 0 && b.chunks[n-1].writer == w {
+		b.chunks[n-1].data = append(b.chunks[n-1].data, p...)
+	} else {
+		b.chunks = append(b.chunks, streamChunk{writer: w, data: bytes.Clone(p)})
+	}
+	b.size += len(p)
+	if b.size < StreamBufferMaxSize {
+		if b.timer == nil {
+			b.timer = time.AfterFunc(b.interval, b.Flush)
+		}
+		b.mu.Unlock()
+		return
+	}
+	wait := b.interval - time.Since(b.lastFlush)
+	b.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked(true)
+}
+
+// Flush writes all the buffered output.
+func (b *streamBuffer) Flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked(false)
+}
+
+// flushLocked writes the buffered output. If wholeLines is set, it holds back the last incomplete line
+// of the output (if any), so lines are not broken across messages.
+//
+// It must be called with b.mu locked.
+func (b *streamBuffer) flushLocked(wholeLines bool) {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.lastFlush = time.Now()
+	if len(b.chunks) == 0 {
+		return
+	}
+	var tail streamChunk
+	if last := &b.chunks[len(b.chunks)-1]; wholeLines {
+		if idx := bytes.LastIndexByte(last.data, '\n'); idx >= 0 && idx < len(last.data)-1 {
+			tail = streamChunk{writer: last.writer, data: bytes.Clone(last.data[idx+1:])}
+			last.data = last.data[:idx+1]
+		}
+	}
+	for _, chunk := range b.chunks {
+		b.writeTo(chunk.writer, chunk.data)
+	}
+	b.chunks = b.chunks[:0]
+	b.size = 0
+	if tail.writer != nil {
+		b.chunks = append(b.chunks, tail)
+		b.size = len(tail.data)
+		b.timer = time.AfterFunc(b.interval, b.Flush)
+	}
+}
+
+// writeTo writes p to w, logging any errors.
+func (b *streamBuffer) writeTo(w io.Writer, p []byte) {
+	if _, err := w.Write(p); err != nil {
+		klog.Errorf("Failed to write %d bytes of the program output: %+v", len(p), err)
+	}
+}
@@ -0,0 +1,132 @@
+package jpyexec
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// outputLog records the writes to several writers, in order.
+type outputLog struct {
+	mu     sync.Mutex
+	writes []string
+}
+
+// Writer returns a writer that records its writes prefixed by name.
+func (l *outputLog) Writer(name string) *outputLogWriter {
+	return &outputLogWriter{log: l, name: name}
+}
+
+// Writes returns a copy of the writes recorded so far.
+func (l *outputLog) Writes() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.writes...)
+}
+
+type outputLogWriter struct {
+	log  *outputLog
+	name string
+}
+
+func (w *outputLogWriter) Write(p []byte) (int, error) {
+	w.log.mu.Lock()
+	defer w.log.mu.Unlock()
+	w.log.writes = append(w.log.writes, w.name+":"+string(p))
+	return len(p), nil
+}
+
+func TestStreamBuffer(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		interval time.Duration
+		writes   [][2]string // Pairs of writer name and content.
+		want     []string    // Written before the explicit Flush.
+		flushed  []string    // Written after the explicit Flush.
+	}{
+		{
+			name:     "unbuffered",
+			interval: 0,
+			writes:   [][2]string{{"stdout", "a"}, {"stdout", "b"}, {"stderr", "c"}},
+			want:     []string{"stdout:a", "stdout:b", "stderr:c"},
+			flushed:  []string{"stdout:a", "stdout:b", "stderr:c"},
+		},
+		{
+			name:     "merged and ordered",
+			interval: time.Hour,
+			writes:   [][2]string{{"stdout", "a"}, {"stdout", "b"}, {"stderr", "c"}, {"stdout", "d"}},
+			want:     nil,
+			flushed:  []string{"stdout:ab", "stderr:c", "stdout:d"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var log outputLog
+			b := newStreamBuffer(tc.interval)
+			writers := map[string]*outputLogWriter{"stdout": log.Writer("stdout"), "stderr": log.Writer("stderr")}
+			for _, w := range tc.writes {
+				_, err := b.Writer(writers[w[0]]).Write([]byte(w[1]))
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.want, log.Writes())
+			b.Flush()
+			assert.Equal(t, tc.flushed, log.Writes())
+		})
+	}
+}
+
+func TestStreamBufferInterval(t *testing.T) {
+	var log outputLog
+	b := newStreamBuffer(10 * time.Millisecond)
+	_, _ = b.Writer(log.Writer("stdout")).Write([]byte("hello\n"))
+	assert.Eventually(t, func() bool { return len(log.Writes()) == 1 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []string{"stdout:hello\n"}, log.Writes())
+}
+
+func TestStreamBufferFull(t *testing.T) {
+	var log outputLog
+	b := newStreamBuffer(time.Hour)
+	w := b.Writer(log.Writer("stdout"))
+
+	// A full buffer is flushed right away (there was no previous flush), up to its last complete line.
+	line := strings.Repeat("x", 99) + "\n"
+	full := strings.Repeat(line, StreamBufferMaxSize/len(line)+1)
+	_, _ = w.Write([]byte(full + "partial"))
+	assert.Equal(t, []string{"stdout:" + full}, log.Writes())
+	b.Flush()
+	assert.Equal(t, []string{"stdout:" + full, "stdout:partial"}, log.Writes())
+}
+
+func TestStreamBufferBackpressure(t *testing.T) {
+	const interval = 500 * time.Millisecond
+	var log outputLog
+	b := newStreamBuffer(interval)
+	stdout, stderr := b.Writer(log.Writer("stdout")), b.Writer(log.Writer("stderr"))
+	b.Flush()
+
+	// The buffer was just flushed, so a write that fills it is blocked until the interval elapses.
+	writeDone := make(chan time.Duration)
+	go func() {
+		start := time.Now()
+		_, _ = stdout.Write([]byte(strings.Repeat("x", StreamBufferMaxSize-1) + "\n"))
+		writeDone <- time.Since(start)
+	}()
+
+	// While the writer is held back, Flush is not blocked, and once the buffer is flushed, neither are the
+	// writes to the other stream.
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	b.Flush()
+	_, _ = stderr.Write([]byte("error\n"))
+	assert.Less(t, time.Since(start), interval/2)
+
+	elapsed := <-writeDone
+	assert.GreaterOrEqual(t, elapsed, interval/2)
+	b.Flush()
+	writes := log.Writes()
+	require.Len(t, writes, 2)
+	assert.Equal(t, "stderr:error\n", writes[1])
+}
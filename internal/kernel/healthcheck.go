@@ -0,0 +1,103 @@
+package kernel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/pkg/errors"
+)
+
+// This file implements the health check of a running kernel (`gonb --healthcheck`), to be used as a
+// Docker/Kubernetes health probe for long-lived kernel containers.
+
+// DefaultHealthCheckTimeout is the default time to wait for the kernel to reply to the heartbeat.
+const DefaultHealthCheckTimeout = 5 * time.Second
+
+// HealthCheck verifies that the kernel is alive, given either its connection file or its PID file
+// (see WritePidFile).
+//
+// With a connection file, it sends a ping to the heartbeat socket of the kernel, and it waits up to timeout for
+// the reply. With a PID file, it checks that the process is running.
+//
+// It returns nil if the kernel is healthy.
+func HealthCheck(filePath string, timeout time.Duration) error {
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %q", filePath)
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(contents))); err == nil {
+		return checkProcess(pid)
+	}
+	var connInfo connectionInfo
+	if err = json.Unmarshal(contents, &connInfo); err != nil {
+		return errors.Wrapf(err, "%q is neither a connection file nor a PID file", filePath)
+	}
+	return pingHeartbeat(connInfo, timeout)
+}
+
+// pingHeartbeat sends a ping to the heartbeat socket of the kernel, and waits for it to be echoed back.
+func pingHeartbeat(connInfo connectionInfo, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	socket := zmq4.NewReq(ctx)
+	defer func() { _ = socket.Close() }()
+	address := connInfo.address(connInfo.HBPort)
+
+	ping := []byte(fmt.Sprintf("gonb-healthcheck-%d", time.Now().UnixNano()))
+	errChan := make(chan error, 1)
+	go func() {
+		if err := socket.Dial(address); err != nil {
+			errChan <- errors.Wrapf(err, "failed to connect to the heartbeat socket %q", address)
+			return
+		}
+		if err := socket.Send(zmq4.NewMsg(ping)); err != nil {
+			errChan <- errors.Wrapf(err, "failed to send ping to the heartbeat socket %q", address)
+			return
+		}
+		reply, err := socket.Recv()
+		if err != nil {
+			errChan <- errors.Wrapf(err, "failed to receive the reply from the heartbeat socket %q", address)
+			return
+		}
+		if !bytes.Equal(bytes.Join(reply.Frames, nil), ping) {
+			errChan <- errors.Errorf("heartbeat socket %q replied %q, expected %q", address, reply.Frames, ping)
+			return
+		}
+		errChan <- nil
+	}()
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		return errors.Errorf("no reply from the heartbeat socket %q after %s", address, timeout)
+	}
+}
+
+// checkProcess returns an error if the process with the given pid is not running.
+func checkProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return errors.Wrapf(err, "kernel process %d not found", pid)
+	}
+	if err = process.Signal(syscall.Signal(0)); err != nil {
+		return errors.Wrapf(err, "kernel process %d not running", pid)
+	}
+	return nil
+}
+
+// WritePidFile writes the PID of the current process to filePath, to be used by HealthCheck.
+// It returns a function that removes the file, to be called when the kernel exits.
+func WritePidFile(filePath string) (remove func(), err error) {
+	if err = os.WriteFile(filePath, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644); err != nil {
+		return nil, errors.Wrapf(err, "failed to write PID file %q", filePath)
+	}
+	return func() { _ = os.Remove(filePath) }, nil
+}
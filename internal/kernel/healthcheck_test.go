@@ -0,0 +1,61 @@
+package kernel
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// freePort returns a TCP port that is not in use.
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestHealthCheck(t *testing.T) {
+	connInfo := connectionInfo{Transport: "tcp", IP: "127.0.0.1", HBPort: freePort(t)}
+	connData, err := json.Marshal(connInfo)
+	require.NoError(t, err)
+	connectionFile := path.Join(t.TempDir(), "kernel.json")
+	require.NoError(t, os.WriteFile(connectionFile, connData, 0600))
+
+	// No kernel listening.
+	require.Error(t, HealthCheck(connectionFile, 200*time.Millisecond))
+
+	// Heartbeat echoing pings, like the kernel's.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hb := zmq4.NewRep(ctx)
+	defer func() { _ = hb.Close() }()
+	require.NoError(t, hb.Listen(connInfo.address(connInfo.HBPort)))
+	go func() {
+		for {
+			msg, err := hb.Recv()
+			if err != nil {
+				return
+			}
+			if err = hb.Send(msg); err != nil {
+				return
+			}
+		}
+	}()
+	require.NoError(t, HealthCheck(connectionFile, DefaultHealthCheckTimeout))
+
+	// PID files.
+	pidFile := path.Join(t.TempDir(), "gonb.pid")
+	remove, err := WritePidFile(pidFile)
+	require.NoError(t, err)
+	require.NoError(t, HealthCheck(pidFile, DefaultHealthCheckTimeout))
+	remove()
+	assert.Error(t, HealthCheck(pidFile, DefaultHealthCheckTimeout))
+}
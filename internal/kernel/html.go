@@ -0,0 +1,140 @@
+package kernel
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// This file implements the processing of HTML published by cells: the optional sanitization (see `%sanitize_html`)
+// and the addition of a nonce to scripts, for deployments with a strict Content-Security-Policy.
+
+// unsafeElements are removed, along with their contents, by SanitizeHTML.
+var unsafeElements = map[string]bool{
+	"script": true, "iframe": true, "frame": true, "frameset": true, "object": true, "embed": true,
+	"applet": true, "base": true, "meta": true,
+}
+
+// urlAttributes are attributes holding URLs, that are checked for `javascript:` (and similar) URLs.
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "action": true, "formaction": true, "data": true, "xlink:href": true, "background": true,
+}
+
+// SanitizeHTML removes from the HTML the elements that can execute code (`<script>`, `<iframe>`, `<object>`, etc.),
+// event handler attributes (`onclick`, `onload`, etc.) and `javascript:` URLs.
+//
+// Notice widgets (`gonbui/widgets`) and `gonbui/dom` rely on scripts, and won't work with sanitized HTML.
+func SanitizeHTML(htmlContent string) string {
+	return processHTML(htmlContent, true, "")
+}
+
+// AddScriptNonce adds the `nonce` attribute to the `<script>` and `<style>` tags of the HTML that don't have one,
+// so they are allowed by a Content-Security-Policy that requires it.
+func AddScriptNonce(htmlContent, nonce string) string {
+	return processHTML(htmlContent, false, nonce)
+}
+
+// processHTML implements SanitizeHTML and AddScriptNonce. Tokens not changed are copied verbatim.
+func processHTML(htmlContent string, sanitize bool, nonce string) string {
+	var buf bytes.Buffer
+	tokenizer := html.NewTokenizer(strings.NewReader(htmlContent))
+	var skipElement string // Element being removed, along with its contents.
+	skipDepth := 0
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if tokenizer.Err() != io.EOF {
+				// Unparseable remaining content is dropped when sanitizing.
+				if !sanitize {
+					buf.Write(tokenizer.Raw())
+				}
+			}
+			break
+		}
+		raw := tokenizer.Raw()
+		if skipDepth > 0 {
+			// Inside an element being removed.
+			switch tokenType {
+			case html.StartTagToken:
+				if name, _ := tokenizer.TagName(); string(name) == skipElement {
+					skipDepth++
+				}
+			case html.EndTagToken:
+				if name, _ := tokenizer.TagName(); string(name) == skipElement {
+					skipDepth--
+				}
+			}
+			continue
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken && tokenType != html.EndTagToken {
+			buf.Write(raw)
+			continue
+		}
+
+		raw = append([]byte(nil), raw...) // Token() below invalidates raw.
+		token := tokenizer.Token()
+		if sanitize && unsafeElements[token.Data] {
+			if tokenType == html.StartTagToken {
+				skipElement, skipDepth = token.Data, 1
+			}
+			continue
+		}
+		if tokenType == html.EndTagToken {
+			buf.Write(raw)
+			continue
+		}
+		changed := false
+		if sanitize {
+			attrs := token.Attr[:0]
+			for _, attr := range token.Attr {
+				if isUnsafeAttribute(attr) {
+					changed = true
+					continue
+				}
+				attrs = append(attrs, attr)
+			}
+			token.Attr = attrs
+		}
+		if nonce != "" && (token.Data == "script" || token.Data == "style") && !hasAttribute(token.Attr, "nonce") {
+			token.Attr = append(token.Attr, html.Attribute{Key: "nonce", Val: nonce})
+			changed = true
+		}
+		if changed {
+			buf.WriteString(token.String())
+		} else {
+			buf.Write(raw)
+		}
+	}
+	return buf.String()
+}
+
+// isUnsafeAttribute returns whether the attribute can execute code: event handlers, `srcdoc` and
+// URLs with `javascript:`, `vbscript:` or `data:text/html` schemes.
+func isUnsafeAttribute(attr html.Attribute) bool {
+	key := strings.ToLower(attr.Key)
+	if strings.HasPrefix(key, "on") || key == "srcdoc" {
+		return true
+	}
+	if !urlAttributes[key] {
+		return false
+	}
+	value := strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1 // Browsers ignore whitespace and control characters in the scheme.
+		}
+		return r
+	}, attr.Val))
+	return strings.HasPrefix(value, "javascript:") || strings.HasPrefix(value, "vbscript:") ||
+		strings.HasPrefix(value, "data:text/html")
+}
+
+func hasAttribute(attrs []html.Attribute, key string) bool {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
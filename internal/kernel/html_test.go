@@ -0,0 +1,24 @@
+package kernel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	assert.Equal(t, `<div style="color: red">ok &amp; fine</div>`,
+		SanitizeHTML(`<div style="color: red">ok &amp; fine</div>`))
+	assert.Equal(t, `<p>before</p><p>after</p>`,
+		SanitizeHTML(`<p>before</p><script>alert("<p>x</p>")</script><p>after</p>`))
+	assert.Equal(t, `<b>x</b>`, SanitizeHTML(`<b>x</b><iframe src="https://example.com"><iframe></iframe></iframe>`))
+	assert.Equal(t, `<img src="a.png">`, SanitizeHTML(`<img src="a.png" onerror="alert(1)">`))
+	assert.Equal(t, `<a>link</a>`, SanitizeHTML(`<a href=" JavaScript:alert(1)">link</a>`))
+	assert.Equal(t, `<style>div > p { color: red; }</style>`, SanitizeHTML(`<style>div > p { color: red; }</style>`))
+}
+
+func TestAddScriptNonce(t *testing.T) {
+	assert.Equal(t, `<div>x</div><script nonce="abc">let a = 1 < 2;</script>`,
+		AddScriptNonce(`<div>x</div><script>let a = 1 < 2;</script>`, "abc"))
+	assert.Equal(t, `<script nonce="other"></script>`, AddScriptNonce(`<script nonce="other"></script>`, "abc"))
+}
@@ -3,6 +3,7 @@ package kernel
 import (
 	_ "embed"
 	"encoding/json"
+	"github.com/janpfeifer/gonb/internal/i18n"
 	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
 	"os"
@@ -41,10 +42,13 @@ type jupyterKernelConfig struct {
 // If the binary is under `/tmp` (or if forceCopy is true), it is copied to the location of
 // the kernel configuration, and that copy is used.
 //
+// The extraArgs are appended to the command line of the kernel (`argv` in `kernel.json`), and env holds environment
+// variables set by Jupyter when starting the kernel (`env` in `kernel.json`), e.g. GOPATH, GOFLAGS or GOPROXY.
+//
 // If forceDeps is true, installation will succeed even with missing dependencies.
 //
 // Documentation: https://jupyter-client.readthedocs.io/en/latest/kernels.html#kernelspecs
-func Install(extraArgs []string, forceDeps, forceCopy bool) error {
+func Install(extraArgs []string, env map[string]string, forceDeps, forceCopy bool) error {
 	gonbPath, err := os.Executable()
 	if err != nil {
 		return errors.Wrapf(err, "Failed to find path to GoNB binary")
@@ -59,6 +63,9 @@ func Install(extraArgs []string, forceDeps, forceCopy bool) error {
 	if len(extraArgs) > 0 {
 		config.Argv = append(config.Argv, extraArgs...)
 	}
+	for key, value := range env {
+		config.Env[key] = value
+	}
 
 	// Jupyter configuration directory for gonb.
 	home := os.Getenv("HOME")
@@ -118,7 +125,7 @@ func Install(extraArgs []string, forceDeps, forceCopy bool) error {
 			return errors.WithMessagef(err, "failed to write configuration file %q", configPath)
 		}
 	}
-	klog.Infof("Go (gonb) kernel configuration installed in %q.\n", configPath)
+	klog.Info(i18n.T(i18n.MsgKernelInstalled, configPath))
 
 	// Create `logo-svg.svg`.
 	logoPath := path.Join(kernelDir, "logo-svg.svg")
@@ -133,23 +140,30 @@ func Install(extraArgs []string, forceDeps, forceCopy bool) error {
 		_, err = exec.LookPath("gopls")
 	}
 	if err != nil {
-		msg := `
-Program goimports and/or gopls are not installed. They are required dependencies,
-and generally are standard Go toolkit packages. You can install them with:
-
-go install golang.org/x/tools/cmd/goimports@latest
-go install golang.org/x/tools/gopls@latest
-
-`
+		msg := i18n.T(i18n.MsgDependenciesMissing)
 		if !forceDeps {
 			klog.Fatalf(msg)
 		}
 		klog.Infof(msg)
 		err = nil
 	}
+	warnIfLowMemory(extraArgs)
 	return nil
 }
 
+// ParseKernelEnv parses the environment variables to set in `kernel.json`, given as `KEY=VALUE` assignments.
+func ParseKernelEnv(assignments []string) (map[string]string, error) {
+	env := make(map[string]string, len(assignments))
+	for _, assignment := range assignments {
+		key, value, found := strings.Cut(assignment, "=")
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, errors.Errorf("invalid environment variable %q, it must be in the format KEY=VALUE", assignment)
+		}
+		env[key] = value
+	}
+	return env, nil
+}
+
 // copyFile, by reading all to memory -- not good for large files.
 func copyFile(dst, src string) error {
 	data, err := os.ReadFile(src)
@@ -0,0 +1,36 @@
+package kernel
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKernelEnv(t *testing.T) {
+	env, err := ParseKernelEnv([]string{"GOPROXY=direct", "GOFLAGS=-mod=mod -tags=x", "EMPTY="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"GOPROXY": "direct", "GOFLAGS": "-mod=mod -tags=x", "EMPTY": ""}, env)
+
+	for _, invalid := range []string{"GOPROXY", "=direct", "GO PROXY=direct"} {
+		_, err = ParseKernelEnv([]string{invalid})
+		assert.Errorf(t, err, "ParseKernelEnv(%q) should have failed", invalid)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv(JupyterDataDirEnv, dataDir)
+	require.NoError(t, Install([]string{"--idle_timeout=1h"}, map[string]string{"GOPROXY": "direct"}, true, false))
+
+	contents, err := os.ReadFile(path.Join(dataDir, "kernels", "gonb", "kernel.json"))
+	require.NoError(t, err)
+	var config jupyterKernelConfig
+	require.NoError(t, json.Unmarshal(contents, &config))
+	require.Len(t, config.Argv, 4)
+	assert.Equal(t, []string{"--kernel", "{connection_file}", "--idle_timeout=1h"}, config.Argv[1:])
+	assert.Equal(t, map[string]string{"GOPROXY": "direct"}, config.Env)
+}
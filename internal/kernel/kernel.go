@@ -25,6 +25,7 @@ import (
 	"regexp"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var (
@@ -59,6 +60,14 @@ type connectionInfo struct {
 	IP              string `json:"ip"`
 }
 
+// address returns the ZMQ address of the socket on the given port.
+func (connInfo connectionInfo) address(portNum int) string {
+	if connInfo.Transport == "ipc" {
+		return fmt.Sprintf("ipc://%s-%d", connInfo.IP, portNum)
+	}
+	return fmt.Sprintf("tcp://%s:%d", connInfo.IP, portNum)
+}
+
 // SyncSocket wraps a zmq socket with a lock which should be used to control write access.
 type SyncSocket struct {
 	Socket zmq4.Socket
@@ -98,8 +107,9 @@ type Kernel struct {
 	// Wait group for the various polling goroutines.
 	pollingWait sync.WaitGroup
 
-	// ExecCounter is incremented each time we run user code in the notebook.
-	ExecCounter int
+	// execCounter is incremented each time we run user code in the notebook. See ExecCounter.
+	// Guarded by muSession.
+	execCounter int
 
 	// Channel where signals are received.
 	signalsChan chan os.Signal
@@ -122,9 +132,80 @@ type Kernel struct {
 	// for the session (see `dispatcher/comm.go`).
 	JupyterKernelId string
 
-	// KnownBlockIds are display data blocks with a "display_id" that have already been created, and
-	// hence should be updated (instead of created anew) in calls to PublishUpdate
-	KnownBlockIds common.Set[string]
+	// knownBlockIds are display data blocks with a "display_id" that have already been created, and
+	// hence should be updated (instead of created anew) in calls to PublishUpdate.
+	// It holds at most MaxKnownBlockIds: the least recently updated are forgotten. Guarded by muSession.
+	knownBlockIds *common.LRUSet[string]
+
+	// muSession guards the state of the session reset by ResetSession.
+	muSession sync.Mutex
+
+	// RenderMarkdown indicates that Markdown content published is also rendered to HTML by the kernel,
+	// for front-ends that don't render Markdown. See `%markdown_render` and MarkdownToHTML.
+	RenderMarkdown bool
+
+	// IdleTimeout, if > 0, is the time without cell executions after which the kernel shuts itself down.
+	// See `--idle_timeout` and dispatcher.StartIdleShutdown.
+	IdleTimeout time.Duration
+
+	// lastActivity is the time (in Unix nanoseconds) of the last activity (execution of cells) of the kernel.
+	// See MarkActivity.
+	lastActivity atomic.Int64
+
+	// recorder of the session, if `%record` is in progress. See StartSessionRecording.
+	recorder   *sessionRecorder
+	muRecorder sync.Mutex
+}
+
+// MaxKnownBlockIds is the maximum number of display ids kept in Kernel.KnownBlockIds, so sessions with lots of
+// display updates don't grow memory unboundedly. If a forgotten display is updated later, it is created anew.
+const MaxKnownBlockIds = 10_000
+
+// MarkActivity records the current time as the last activity of the kernel: the start and end of cell executions.
+// See LastActivity.
+func (k *Kernel) MarkActivity() {
+	k.lastActivity.Store(time.Now().UnixNano())
+}
+
+// LastActivity returns the time of the last activity of the kernel, or the time it was created if no cell
+// was executed yet. It is used by the idle auto-shutdown (`--idle_timeout`).
+func (k *Kernel) LastActivity() time.Time {
+	return time.Unix(0, k.lastActivity.Load())
+}
+
+// ExecCounter returns the execution count of the current cell: it is incremented each time user code is run
+// in the notebook.
+func (k *Kernel) ExecCounter() int {
+	k.muSession.Lock()
+	defer k.muSession.Unlock()
+	return k.execCounter
+}
+
+// IncrementExecCounter increments the execution counter, and returns its new value.
+func (k *Kernel) IncrementExecCounter() int {
+	k.muSession.Lock()
+	defer k.muSession.Unlock()
+	k.execCounter++
+	return k.execCounter
+}
+
+// KnownBlockIds returns the display ids already created, see PublishUpdateDisplayData.
+func (k *Kernel) KnownBlockIds() *common.LRUSet[string] {
+	k.muSession.Lock()
+	defer k.muSession.Unlock()
+	return k.knownBlockIds
+}
+
+// ResetSession resets the state of the session kept by the kernel (execution counter, known display ids, etc.),
+// for an in-process restart of the kernel.
+func (k *Kernel) ResetSession() {
+	k.muSession.Lock()
+	k.execCounter = 0
+	k.knownBlockIds = common.NewLRUSet[string](MaxKnownBlockIds)
+	k.muSession.Unlock()
+	k.RenderMarkdown = false
+	k.Interrupted.Store(false)
+	k.MarkActivity()
 }
 
 // IsStopped returns whether the Kernel has been stopped.
@@ -149,6 +230,10 @@ func (k *Kernel) Stop() {
 	klog.V(1).Infof("Kernel.Stop()")
 	k.Interrupted.Store(true) // Also mark as interrupted.
 	close(k.stop)
+	if k.sockets == nil {
+		// Offline kernel, see NewOffline.
+		return
+	}
 	err := k.sockets.ShellSocket.Socket.Close()
 	if err != nil {
 		klog.Errorf("Failed to close Shell socket: %v", err)
@@ -328,8 +413,9 @@ func New(connectionFile string) (*Kernel, error) {
 		control: make(chan Message, 1),
 
 		interruptSubscriptions: list.New(),
-		KnownBlockIds:          make(common.Set[string]),
+		knownBlockIds:          common.NewLRUSet[string](MaxKnownBlockIds),
 	}
+	k.MarkActivity()
 
 	if matches := reExtractJupyterSessionId.FindStringSubmatch(connectionFile); len(matches) == 2 {
 		k.JupyterKernelId = matches[1]
@@ -466,18 +552,6 @@ func bindSockets(connInfo connectionInfo) (sg *SocketGroup, err error) {
 	}
 
 	// Bind the sockets.
-	var addrFn func(portNum int) string
-	switch connInfo.Transport {
-	case "tcp":
-		addrFn = func(portNum int) string {
-			return fmt.Sprintf("tcp://%s:%d", connInfo.IP, portNum)
-		}
-	case "ipc":
-		addrFn = func(portNum int) string {
-			return fmt.Sprintf("ipc://%s-%d", connInfo.IP, portNum)
-		}
-
-	}
 	portNums := []int{connInfo.ShellPort, connInfo.ControlPort, connInfo.StdinPort,
 		connInfo.IOPubPort, connInfo.HBPort}
 	sockets := []*SyncSocket{&sg.ShellSocket, &sg.ControlSocket, &sg.StdinSocket,
@@ -485,7 +559,7 @@ func bindSockets(connInfo connectionInfo) (sg *SocketGroup, err error) {
 	socketName := []string{"shell-socket", "control-socket", "stdin-socket",
 		"iopub-socket", "heartbeat-socket"}
 	for ii, portNum := range portNums {
-		address := addrFn(portNum)
+		address := connInfo.address(portNum)
 		err = sockets[ii].Socket.Listen(address)
 		if err != nil {
 			return sg, errors.WithMessagef(err, fmt.Sprintf("failed to listen on %s", socketName[ii]))
@@ -551,6 +625,10 @@ func (k *Kernel) FromWireMsg(zmqMsg zmq4.Msg) Message {
 		m.err = errors.Wrapf(err, "while decoding ComposedMsg.Content")
 		return m
 	}
+	if len(parts) > i+6 {
+		// Binary buffers are not part of the signature.
+		m.Composed.Buffers = parts[i+6:]
+	}
 	return m
 }
 
@@ -598,5 +676,7 @@ func (k *Kernel) ToWireMsg(c *ComposedMsg) ([][]byte, error) {
 		hex.Encode(parts[0], mac.Sum(nil))
 	}
 
+	// Binary buffers follow the message, and are not signed.
+	parts = append(parts, c.Buffers...)
 	return parts, nil
 }
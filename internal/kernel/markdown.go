@@ -0,0 +1,55 @@
+package kernel
+
+import (
+	"bytes"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the kernel-side rendering of Markdown to HTML, for front-ends (or nbconvert paths)
+// that don't render `text/markdown` display data. See Kernel.RenderMarkdown and `%markdown_render`.
+
+// markdownRenderer converts GitHub flavored Markdown to HTML. Raw HTML embedded in the Markdown is omitted,
+// so the generated HTML is safe.
+var markdownRenderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// MarkdownToHTML converts the Markdown to HTML.
+// Raw HTML in the Markdown is dropped, and math formulas (`$...$`) are not rendered.
+func MarkdownToHTML(markdown string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(markdown), &buf); err != nil {
+		return "", errors.Wrap(err, "failed to render Markdown to HTML")
+	}
+	return buf.String(), nil
+}
+
+// renderMarkdownData returns data with the Markdown content (if any) also rendered as HTML, if the kernel is
+// configured to do so (see Kernel.RenderMarkdown) and no HTML content was given.
+// The original data is not modified.
+func renderMarkdownData(msg Message, data MIMEMap) MIMEMap {
+	if msg == nil || msg.Kernel() == nil || !msg.Kernel().RenderMarkdown {
+		return data
+	}
+	markdown, ok := data[string(protocol.MIMETextMarkdown)].(string)
+	if !ok {
+		return data
+	}
+	if _, found := data[string(protocol.MIMETextHTML)]; found {
+		return data
+	}
+	html, err := MarkdownToHTML(markdown)
+	if err != nil {
+		klog.Warningf("Publishing Markdown without the HTML version: %+v", err)
+		return data
+	}
+	rendered := make(MIMEMap, len(data)+1)
+	for mimeType, content := range data {
+		rendered[mimeType] = content
+	}
+	rendered[string(protocol.MIMETextHTML)] = html
+	return rendered
+}
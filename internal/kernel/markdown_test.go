@@ -0,0 +1,17 @@
+package kernel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkdownToHTML(t *testing.T) {
+	html, err := MarkdownToHTML("## Title\n\nSome **bold** `code`.\n\n<script>alert(1)</script>\n\n| a | b |\n|---|---|\n| 1 | 2 |\n")
+	require.NoError(t, err)
+	assert.Contains(t, html, "<h2>Title</h2>")
+	assert.Contains(t, html, "<strong>bold</strong> <code>code</code>")
+	assert.Contains(t, html, "<table>")
+	assert.NotContains(t, html, "<script>")
+}
@@ -0,0 +1,81 @@
+package kernel
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// GoplsMinMemory is the total RAM below which `gopls` is known to be too heavy to run along with the kernel,
+// and `--low-memory` is recommended: Raspberry Pi-class machines.
+const GoplsMinMemory = 2 << 30
+
+// TotalMemory returns the total RAM of the machine in bytes. Only Linux and macOS are supported.
+func TotalMemory() (uint64, error) {
+	switch runtime.GOOS {
+	case "linux":
+		contents, err := os.ReadFile("/proc/meminfo")
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read total memory")
+		}
+		return parseMemInfo(contents)
+	case "darwin":
+		output, err := exec.Command("sysctl", "-n", "hw.memsize").Output()
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read total memory with `sysctl -n hw.memsize`")
+		}
+		total, err := strconv.ParseUint(strings.TrimSpace(string(output)), 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid total memory %q reported by `sysctl -n hw.memsize`", output)
+		}
+		return total, nil
+	default:
+		return 0, errors.Errorf("total memory not available in OS %q", runtime.GOOS)
+	}
+}
+
+// parseMemInfo returns the total memory in the contents of Linux's `/proc/meminfo`.
+func parseMemInfo(contents []byte) (uint64, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		total, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid MemTotal %q in /proc/meminfo", scanner.Text())
+		}
+		if len(fields) > 2 && strings.EqualFold(fields[2], "kB") {
+			total *= 1024
+		}
+		return total, nil
+	}
+	return 0, errors.New("MemTotal not found in /proc/meminfo")
+}
+
+// warnIfLowMemory logs a warning if gopls is installed but the machine has less than GoplsMinMemory
+// and the kernel is not installed with `--low-memory`.
+func warnIfLowMemory(extraArgs []string) {
+	for _, arg := range extraArgs {
+		if arg == "--low-memory" || arg == "-low-memory" || strings.HasPrefix(arg, "--low-memory=") {
+			return
+		}
+	}
+	if _, err := exec.LookPath("gopls"); err != nil {
+		return
+	}
+	total, err := TotalMemory()
+	if err != nil || total >= GoplsMinMemory {
+		return
+	}
+	klog.Warningf("This machine has %.1f GiB of RAM, and `gopls` may be too heavy for it: consider installing "+
+		"GoNB with `--install --low-memory`, so `gopls` is only started when needed.", float64(total)/(1<<30))
+}
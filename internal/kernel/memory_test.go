@@ -0,0 +1,17 @@
+package kernel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMemInfo(t *testing.T) {
+	total, err := parseMemInfo([]byte("MemTotal:        3884376 kB\nMemFree:          157264 kB\n"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3884376*1024), total)
+
+	_, err = parseMemInfo([]byte("MemFree:          157264 kB\n"))
+	assert.Error(t, err)
+}
@@ -29,6 +29,10 @@ type ComposedMsg struct {
 	ParentHeader zmqMsgHeader
 	Metadata     map[string]any
 	Content      any
+
+	// Buffers are optional binary buffers that follow the message on the wire, used by "comm_msg" messages
+	// to send binary data without encoding it in JSON.
+	Buffers [][]byte
 }
 
 // MIMEMap holds data that can be presented in multiple formats. The keys are MIME types
@@ -57,13 +61,30 @@ type KernelInfo struct {
 
 // KernelLanguageInfo holds information about the language that this kernel executes code in.
 type KernelLanguageInfo struct {
-	Name              string `json:"name"`
-	Version           string `json:"version"`
-	MIMEType          string `json:"mimetype"`
-	FileExtension     string `json:"file_extension"`
-	PygmentsLexer     string `json:"pygments_lexer"`
-	CodeMirrorMode    string `json:"codemirror_mode"`
-	NBConvertExporter string `json:"nbconvert_exporter"`
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	MIMEType      string `json:"mimetype"`
+	FileExtension string `json:"file_extension"`
+	PygmentsLexer string `json:"pygments_lexer,omitempty"`
+
+	// CodeMirrorMode is either the name of the mode or a map with the mode configuration (e.g.: `{"name": "go"}`).
+	CodeMirrorMode    any    `json:"codemirror_mode,omitempty"`
+	NBConvertExporter string `json:"nbconvert_exporter,omitempty"`
+}
+
+// GoLanguageInfo returns the language information of Go, included in kernel_info_reply messages.
+//
+// The CodeMirror mode is used by JupyterLab and Notebook to highlight the cells, and the Pygments lexer is
+// used by nbconvert and nbviewer.
+func GoLanguageInfo() KernelLanguageInfo {
+	return KernelLanguageInfo{
+		Name:           "go",
+		Version:        runtime.Version(),
+		MIMEType:       "text/x-go",
+		FileExtension:  ".go",
+		PygmentsLexer:  "go",
+		CodeMirrorMode: map[string]any{"name": "go"},
+	}
 }
 
 // HelpLink stores data to be displayed in the help menu of the notebook.
@@ -173,6 +194,12 @@ type Message interface {
 	// IOPub channel.
 	Publish(msgType string, content interface{}) error
 
+	// PublishWithMetadata is like Publish, but also sets the metadata of the message.
+	PublishWithMetadata(msgType string, content interface{}, metadata map[string]any) error
+
+	// PublishWithBuffers is like Publish, but the message is followed by the given binary buffers.
+	PublishWithBuffers(msgType string, content interface{}, buffers [][]byte) error
+
 	// PromptInput sends a request for input from the front-end. The text in prompt is shown
 	// to the user, and password indicates whether the input is a password (input shouldn't
 	// be echoed in terminal).
@@ -262,12 +289,32 @@ func NewComposed(msgType string, parent ComposedMsg) (*ComposedMsg, error) {
 // Publish creates a new ComposedMsg and sends it back to the return identities over the
 // IOPub channel.
 func (m *MessageImpl) Publish(msgType string, content interface{}) error {
+	return m.PublishWithMetadata(msgType, content, nil)
+}
+
+// PublishWithMetadata is like Publish, but also sets the metadata of the message.
+func (m *MessageImpl) PublishWithMetadata(msgType string, content interface{}, metadata map[string]any) error {
+	return m.publish(msgType, content, metadata, nil)
+}
+
+// PublishWithBuffers is like Publish, but the message is followed by the given binary buffers.
+func (m *MessageImpl) PublishWithBuffers(msgType string, content interface{}, buffers [][]byte) error {
+	return m.publish(msgType, content, nil, buffers)
+}
+
+// publish implements Publish, PublishWithMetadata and PublishWithBuffers.
+func (m *MessageImpl) publish(msgType string, content interface{}, metadata map[string]any, buffers [][]byte) error {
 	msg, err := NewComposed(msgType, m.Composed)
 	if err != nil {
 		return err
 	}
 	klog.V(1).Infof("[IOPub] Publish message %q -- parent msg_id=%q", msgType, msg.ParentHeader.MsgID)
 	msg.Content = content
+	if metadata != nil {
+		msg.Metadata = metadata
+	}
+	msg.Buffers = buffers
+	m.kernel.recordPublished(msgType, msg.ParentHeader.MsgID, content, metadata)
 	return m.kernel.sockets.IOPubSocket.RunLocked(func(socket zmq4.Socket) error {
 		return m.sendMessage(socket, msg)
 	})
@@ -388,8 +435,8 @@ func PublishExecuteResult(msg Message, data Data) error {
 		Data      MIMEMap `json:"data"`
 		Transient MIMEMap `json:"transient"`
 	}{
-		ExecCount: msg.Kernel().ExecCounter,
-		Data:      data.Data,
+		ExecCount: msg.Kernel().ExecCounter(),
+		Data:      renderMarkdownData(msg, data.Data),
 		Metadata:  EnsureMIMEMap(data.Metadata),
 		Transient: EnsureMIMEMap(data.Transient),
 	})
@@ -407,7 +454,7 @@ func PublishDisplayData(msg Message, data Data) error {
 		Metadata  MIMEMap `json:"metadata"`
 		Transient MIMEMap `json:"transient"`
 	}{
-		Data:      data.Data,
+		Data:      renderMarkdownData(msg, data.Data),
 		Metadata:  EnsureMIMEMap(data.Metadata),
 		Transient: EnsureMIMEMap(data.Transient),
 	})
@@ -446,10 +493,11 @@ func PublishUpdateDisplayData(msg Message, data Data) error {
 	// Check whether displayId is new.
 	kernel := msg.Kernel()
 	msgType := "display_data"
-	if kernel.KnownBlockIds.Has(displayId) {
+	knownBlockIds := kernel.KnownBlockIds()
+	if knownBlockIds.Has(displayId) {
 		msgType = "update_display_data"
 	} else {
-		kernel.KnownBlockIds.Insert(displayId)
+		knownBlockIds.Insert(displayId)
 	}
 
 	// Publish message.
@@ -458,12 +506,26 @@ func PublishUpdateDisplayData(msg Message, data Data) error {
 		Metadata  MIMEMap `json:"metadata"`
 		Transient MIMEMap `json:"transient"`
 	}{
-		Data:      data.Data,
+		Data:      renderMarkdownData(msg, data.Data),
 		Metadata:  EnsureMIMEMap(data.Metadata),
 		Transient: data.Transient,
 	})
 }
 
+// PublishClearOutput publishes a "clear_output" message, that clears the output of the cell.
+// If wait is set, the output is only cleared when new output is available, which avoids flickering.
+func PublishClearOutput(msg Message, wait bool) error {
+	if msg == nil {
+		// Ignore if there is no message to reply to.
+		return nil
+	}
+	return msg.Publish("clear_output", struct {
+		Wait bool `json:"wait"`
+	}{
+		Wait: wait,
+	})
+}
+
 // PublishHtml is a shortcut to PublishData for HTML content.
 func PublishHtml(msg Message, html string) error {
 	return PublishData(msg, Data{
@@ -564,12 +626,7 @@ func SendKernelInfo(msg Message, version string) error {
 			Implementation:        "gonb",
 			ImplementationVersion: version,
 			Banner:                fmt.Sprintf("Go kernel: gonb - v%s", version),
-			LanguageInfo: KernelLanguageInfo{
-				Name:          "go",
-				Version:       runtime.Version(),
-				FileExtension: ".go",
-				MIMEType:      "text/x-go",
-			},
+			LanguageInfo:          GoLanguageInfo(),
 			HelpLinks: []HelpLink{
 				{Text: "Go", URL: "https://golang.org/"},
 				{Text: "gonb", URL: "https://github.com/janpfeifer/gonb"},
@@ -587,7 +644,7 @@ func PublishExecuteInput(msg Message, code string) error {
 			ExecCount int    `json:"execution_count"`
 			Code      string `json:"code"`
 		}{
-			ExecCount: msg.Kernel().ExecCounter,
+			ExecCount: msg.Kernel().ExecCounter(),
 			Code:      code,
 		},
 	)
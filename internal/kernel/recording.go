@@ -0,0 +1,105 @@
+package kernel
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// RecordedOutput is an output message published to the front-end, recorded by RecordingMessage.
+type RecordedOutput struct {
+	MsgType  string          `json:"msg_type"`
+	Content  json.RawMessage `json:"content"`
+	Metadata map[string]any  `json:"metadata,omitempty"`
+}
+
+// recordedMsgTypes are the types of the messages recorded by RecordingMessage: the outputs of a cell.
+var recordedMsgTypes = map[string]bool{
+	"stream":              true,
+	"display_data":        true,
+	"update_display_data": true,
+	"execute_result":      true,
+	"clear_output":        true,
+}
+
+// RecordingMessage wraps a Message, and records the outputs published (streams and display data), so they
+// can be replayed later with Replay.
+type RecordingMessage struct {
+	Message
+
+	mu      sync.Mutex
+	outputs []RecordedOutput
+	err     error
+}
+
+var _ Message = &RecordingMessage{}
+
+// NewRecordingMessage returns a Message that records the outputs published through msg.
+func NewRecordingMessage(msg Message) *RecordingMessage {
+	return &RecordingMessage{Message: msg}
+}
+
+// Publish implements Message, recording the outputs.
+func (r *RecordingMessage) Publish(msgType string, content interface{}) error {
+	r.record(msgType, content, nil)
+	return r.Message.Publish(msgType, content)
+}
+
+// PublishWithMetadata implements Message, recording the outputs.
+func (r *RecordingMessage) PublishWithMetadata(msgType string, content interface{}, metadata map[string]any) error {
+	r.record(msgType, content, metadata)
+	return r.Message.PublishWithMetadata(msgType, content, metadata)
+}
+
+// PublishWithBuffers implements Message. Messages with binary buffers (used by widgets) are not outputs, and
+// are not recorded.
+func (r *RecordingMessage) PublishWithBuffers(msgType string, content interface{}, buffers [][]byte) error {
+	return r.Message.PublishWithBuffers(msgType, content, buffers)
+}
+
+func (r *RecordingMessage) record(msgType string, content interface{}, metadata map[string]any) {
+	if !recordedMsgTypes[msgType] {
+		return
+	}
+	encoded, err := json.Marshal(content)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		klog.Errorf("RecordingMessage: failed to encode %q content: %+v", msgType, err)
+		r.err = errors.Wrapf(err, "failed to record %q output", msgType)
+		return
+	}
+	r.outputs = append(r.outputs, RecordedOutput{MsgType: msgType, Content: encoded, Metadata: metadata})
+}
+
+// Outputs returns the outputs recorded so far, or an error if any of them failed to be recorded.
+func (r *RecordingMessage) Outputs() ([]RecordedOutput, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return append([]RecordedOutput(nil), r.outputs...), nil
+}
+
+// Replay publishes the recorded outputs through msg. The execution count of "execute_result" outputs is
+// updated to the current one.
+func Replay(msg Message, outputs []RecordedOutput) error {
+	for _, output := range outputs {
+		var content any = output.Content
+		if output.MsgType == "execute_result" {
+			var fields map[string]any
+			if err := json.Unmarshal(output.Content, &fields); err != nil {
+				return errors.Wrap(err, "failed to decode recorded execute_result")
+			}
+			fields["execution_count"] = msg.Kernel().ExecCounter()
+			content = fields
+		}
+		if err := msg.PublishWithMetadata(output.MsgType, content, output.Metadata); err != nil {
+			return errors.WithMessagef(err, "replaying %q output", output.MsgType)
+		}
+	}
+	return nil
+}
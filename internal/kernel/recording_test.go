@@ -0,0 +1,34 @@
+package kernel
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordingMessage(t *testing.T) {
+	k := NewOffline()
+	var stdout, stderr bytes.Buffer
+	msg := NewTerminalMessage(k)
+	msg.Stdout, msg.Stderr = &stdout, &stderr
+
+	recorder := NewRecordingMessage(msg)
+	require.NoError(t, PublishWriteStream(recorder, StreamStdout, "hello\n"))
+	require.NoError(t, PublishDisplayData(recorder, Data{
+		Data: MIMEMap{string(protocol.MIMETextPlain): "display"},
+	}))
+	require.NoError(t, recorder.Reply("execute_reply", map[string]any{})) // Not an output.
+	outputs, err := recorder.Outputs()
+	require.NoError(t, err)
+	require.Len(t, outputs, 2)
+	assert.Equal(t, "stream", outputs[0].MsgType)
+	assert.Equal(t, "display_data", outputs[1].MsgType)
+	assert.Equal(t, "hello\ndisplay\n", stdout.String())
+
+	stdout.Reset()
+	require.NoError(t, Replay(msg, outputs))
+	assert.Equal(t, "hello\ndisplay\n", stdout.String())
+}
@@ -0,0 +1,16 @@
+package kernel
+
+import "os"
+
+// JupyterSessionNameEnv is the environment variable set by the Jupyter server (since version 2.0) when
+// starting a kernel, with the path to the notebook it was started for.
+const JupyterSessionNameEnv = "JPY_SESSION_NAME"
+
+// NotebookPath returns the path to the notebook the kernel was started for, as reported by the Jupyter server.
+// It's usually relative to the Jupyter root directory.
+//
+// It returns "" if it's not known -- older Jupyter servers and other front-ends don't report it.
+// Notice that if the notebook is renamed after the kernel started, this won't reflect it.
+func NotebookPath() string {
+	return os.Getenv(JupyterSessionNameEnv)
+}
@@ -0,0 +1,154 @@
+package kernel
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements `%record`: the recording of all the outputs published by the kernel in a session (with
+// timestamps) to a `.gonbrec` file, which can be replayed into a notebook or an HTML file with `gonb replay`.
+
+// RecordedEvent is a message published by the kernel, recorded in a session recording (see
+// Kernel.StartSessionRecording). A `.gonbrec` file holds one JSON-encoded RecordedEvent per line.
+type RecordedEvent struct {
+	RecordedOutput
+
+	// Time the message was published.
+	Time time.Time `json:"time"`
+
+	// ParentMsgId is the id of the message (usually the "execute_request" of a cell) that originated
+	// the published message.
+	ParentMsgId string `json:"parent_msg_id"`
+}
+
+// sessionRecordedMsgTypes are the types of the messages recorded in a session: the outputs of the cells, along
+// with their code and errors.
+var sessionRecordedMsgTypes = map[string]bool{
+	"execute_input":       true,
+	"stream":              true,
+	"display_data":        true,
+	"update_display_data": true,
+	"execute_result":      true,
+	"clear_output":        true,
+	"error":               true,
+}
+
+// sessionRecorder writes the RecordedEvent of a session recording to a file.
+type sessionRecorder struct {
+	filePath  string
+	file      *os.File
+	writer    *bufio.Writer
+	encoder   *json.Encoder
+	numEvents int
+}
+
+// StartSessionRecording starts recording all the outputs published by the kernel (with their timestamps) to
+// the file filePath, until StopSessionRecording is called. It replaces any recording in progress.
+func (k *Kernel) StartSessionRecording(filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create session recording %q", filePath)
+	}
+	writer := bufio.NewWriter(file)
+	recorder := &sessionRecorder{filePath: filePath, file: file, writer: writer, encoder: json.NewEncoder(writer)}
+	k.muRecorder.Lock()
+	previous := k.recorder
+	k.recorder = recorder
+	k.muRecorder.Unlock()
+	if previous != nil {
+		if err := previous.close(); err != nil {
+			klog.Warningf("Failed to close previous session recording: %+v", err)
+		}
+	}
+	return nil
+}
+
+// StopSessionRecording stops the session recording in progress. It returns the path of the file and
+// the number of events recorded, or an empty path if there was no recording in progress.
+func (k *Kernel) StopSessionRecording() (filePath string, numEvents int, err error) {
+	k.muRecorder.Lock()
+	recorder := k.recorder
+	k.recorder = nil
+	k.muRecorder.Unlock()
+	if recorder == nil {
+		return "", 0, nil
+	}
+	return recorder.filePath, recorder.numEvents, recorder.close()
+}
+
+// SessionRecording returns the path of the file of the session recording in progress, and the number of
+// events recorded so far. It returns an empty path if there is no recording in progress.
+func (k *Kernel) SessionRecording() (filePath string, numEvents int) {
+	k.muRecorder.Lock()
+	defer k.muRecorder.Unlock()
+	if k.recorder == nil {
+		return "", 0
+	}
+	return k.recorder.filePath, k.recorder.numEvents
+}
+
+// recordPublished records the message published, if a session recording is in progress.
+func (k *Kernel) recordPublished(msgType, parentMsgId string, content any, metadata map[string]any) {
+	if !sessionRecordedMsgTypes[msgType] {
+		return
+	}
+	k.muRecorder.Lock()
+	defer k.muRecorder.Unlock()
+	if k.recorder == nil {
+		return
+	}
+	encoded, err := json.Marshal(content)
+	if err == nil {
+		err = k.recorder.encoder.Encode(&RecordedEvent{
+			RecordedOutput: RecordedOutput{MsgType: msgType, Content: encoded, Metadata: metadata},
+			Time:           time.Now(),
+			ParentMsgId:    parentMsgId,
+		})
+	}
+	if err == nil {
+		// Flushed at every event, so the recording is usable even if the kernel dies.
+		err = k.recorder.writer.Flush()
+	}
+	if err != nil {
+		klog.Errorf("Session recording to %q failed, recording stopped: %+v", k.recorder.filePath, err)
+		_ = k.recorder.close()
+		k.recorder = nil
+		return
+	}
+	k.recorder.numEvents++
+}
+
+func (r *sessionRecorder) close() error {
+	err := r.writer.Flush()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Wrapf(err, "failed to write session recording %q", r.filePath)
+}
+
+// ReadSessionRecording reads the events of a session recording file (`.gonbrec`).
+func ReadSessionRecording(filePath string) ([]RecordedEvent, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open session recording")
+	}
+	defer func() { _ = file.Close() }()
+	var events []RecordedEvent
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for decoder.More() {
+		var event RecordedEvent
+		if err := decoder.Decode(&event); err != nil {
+			return nil, errors.Wrapf(err, "failed to read event #%d of session recording %q", len(events), filePath)
+		}
+		if event.MsgType == "" {
+			return nil, errors.Errorf("invalid event #%d of session recording %q: missing msg_type", len(events), filePath)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
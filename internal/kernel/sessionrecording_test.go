@@ -0,0 +1,75 @@
+package kernel
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionRecording(t *testing.T) {
+	k := &Kernel{}
+	recordingPath := filepath.Join(t.TempDir(), "session.gonbrec")
+	require.NoError(t, k.StartSessionRecording(recordingPath))
+	k.recordPublished("status", "cell1", map[string]any{"execution_state": "busy"}, nil) // Not recorded.
+	k.recordPublished("execute_input", "cell1", map[string]any{"code": "%%\nfmt.Println(1)", "execution_count": 1}, nil)
+	k.recordPublished("stream", "cell1", map[string]any{"name": "stdout", "text": "1\n"}, nil)
+	k.recordPublished("stream", "cell1", map[string]any{"name": "stdout", "text": "2\n"}, nil)
+	k.recordPublished("display_data", "cell1", map[string]any{
+		"data": map[string]any{"text/html": "<b>old</b>"}, "transient": map[string]any{"display_id": "d1"}}, nil)
+	k.recordPublished("execute_input", "cell2", map[string]any{"code": "%%\nupdate()", "execution_count": 2}, nil)
+	k.recordPublished("update_display_data", "cell2", map[string]any{
+		"data": map[string]any{"text/html": "<b>new</b>"}, "transient": map[string]any{"display_id": "d1"}}, nil)
+	k.recordPublished("stream", "cell2", map[string]any{"name": "stderr", "text": "failed <x>\n"}, nil)
+	k.recordPublished("clear_output", "cell2", map[string]any{"wait": true}, nil)
+	k.recordPublished("error", "cell2", map[string]any{"ename": "ERROR", "evalue": "oops",
+		"traceback": []string{"\x1b[31mline 1\x1b[0m"}}, nil)
+	filePath, numEvents := k.SessionRecording()
+	assert.Equal(t, recordingPath, filePath)
+	assert.Equal(t, 9, numEvents)
+	filePath, numEvents, err := k.StopSessionRecording()
+	require.NoError(t, err)
+	assert.Equal(t, recordingPath, filePath)
+	assert.Equal(t, 9, numEvents)
+	k.recordPublished("stream", "cell3", map[string]any{"name": "stdout", "text": "not recorded"}, nil)
+
+	events, err := ReadSessionRecording(recordingPath)
+	require.NoError(t, err)
+	require.Len(t, events, 9)
+	assert.Equal(t, "execute_input", events[0].MsgType)
+	assert.Equal(t, "cell1", events[0].ParentMsgId)
+	assert.False(t, events[8].Time.Before(events[0].Time))
+
+	nb, err := ReplaySession(events)
+	require.NoError(t, err)
+	require.Len(t, nb.Cells, 2)
+	cell := nb.Cells[0]
+	assert.Equal(t, "%%\nfmt.Println(1)", cell.Source)
+	require.NotNil(t, cell.ExecutionCount)
+	assert.Equal(t, 1, *cell.ExecutionCount)
+	require.Len(t, cell.Outputs, 2)
+	assert.Equal(t, "1\n2\n", cell.Outputs[0]["text"]) // Merged.
+	assert.Equal(t, map[string]any{"text/html": "<b>new</b>"}, cell.Outputs[1]["data"])
+
+	// The stderr output was cleared (with wait) by the error.
+	require.Len(t, nb.Cells[1].Outputs, 1)
+	assert.Equal(t, "error", nb.Cells[1].Outputs[0]["output_type"])
+
+	page := nb.HTML()
+	assert.Contains(t, page, "[1]: %%\nfmt.Println(1)")
+	assert.Contains(t, page, "<b>new</b>")
+	assert.Contains(t, page, "ERROR: oops\nline 1")
+
+	dir := t.TempDir()
+	require.NoError(t, nb.WriteReplay(filepath.Join(dir, "replay.html")))
+	require.NoError(t, nb.WriteReplay(filepath.Join(dir, "replay.ipynb")))
+	contents, err := os.ReadFile(filepath.Join(dir, "replay.ipynb"))
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(contents, &decoded))
+	assert.Equal(t, 4.0, decoded["nbformat"])
+	assert.Len(t, decoded["cells"], 2)
+}
@@ -0,0 +1,247 @@
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+)
+
+// This file implements the replay of session recordings (see `%record` and `gonb replay`): the recorded events
+// are converted to a notebook (`.ipynb`) or to an HTML page.
+
+// ReplayCell is a cell rebuilt from the events of a session recording, in the Jupyter notebook format (nbformat 4).
+type ReplayCell struct {
+	CellType       string           `json:"cell_type"`
+	ExecutionCount *int             `json:"execution_count"`
+	Metadata       map[string]any   `json:"metadata"`
+	Outputs        []map[string]any `json:"outputs"`
+	Source         string           `json:"source"`
+
+	// pendingClear is set by a "clear_output" with wait: the outputs are cleared at the next output.
+	pendingClear bool
+}
+
+// ReplayNotebook is a notebook rebuilt from the events of a session recording, in the Jupyter notebook
+// format (nbformat 4).
+type ReplayNotebook struct {
+	Cells         []*ReplayCell  `json:"cells"`
+	Metadata      map[string]any `json:"metadata"`
+	NbFormat      int            `json:"nbformat"`
+	NbFormatMinor int            `json:"nbformat_minor"`
+}
+
+// ReplaySession rebuilds the notebook from the events of a session recording: the events are grouped in cells
+// by the message that originated them (the execution of a cell), and applied in order (updates of displays,
+// clearing of the output, etc.).
+func ReplaySession(events []RecordedEvent) (*ReplayNotebook, error) {
+	nb := &ReplayNotebook{
+		Metadata: map[string]any{
+			"kernelspec":    map[string]any{"display_name": "Go (gonb)", "language": "go", "name": "gonb"},
+			"language_info": GoLanguageInfo(),
+		},
+		NbFormat:      4,
+		NbFormatMinor: 4,
+	}
+	cellsByParent := make(map[string]*ReplayCell)
+	type outputRef struct {
+		cell  *ReplayCell
+		index int
+	}
+	displays := make(map[string]outputRef)
+	for ii, event := range events {
+		var content map[string]any
+		if err := json.Unmarshal(event.Content, &content); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode the content of event #%d (%q)", ii, event.MsgType)
+		}
+		cell, found := cellsByParent[event.ParentMsgId]
+		if !found {
+			cell = &ReplayCell{CellType: "code", Metadata: map[string]any{}, Outputs: []map[string]any{}}
+			cellsByParent[event.ParentMsgId] = cell
+			nb.Cells = append(nb.Cells, cell)
+		}
+		if event.MsgType == "execute_input" {
+			cell.Source, _ = content["code"].(string)
+			if count, ok := content["execution_count"].(float64); ok {
+				c := int(count)
+				cell.ExecutionCount = &c
+			}
+			continue
+		}
+		if event.MsgType == "update_display_data" {
+			displayId, _ := getFromMap(content, "transient", "display_id").(string)
+			if ref, found := displays[displayId]; found && ref.index < len(ref.cell.Outputs) {
+				ref.cell.Outputs[ref.index]["data"] = content["data"]
+				ref.cell.Outputs[ref.index]["metadata"] = replayMetadata(content)
+			}
+			continue
+		}
+		if event.MsgType == "clear_output" {
+			if wait, _ := content["wait"].(bool); wait {
+				cell.pendingClear = true
+			} else {
+				cell.Outputs = []map[string]any{}
+			}
+			continue
+		}
+		if cell.pendingClear {
+			cell.Outputs = []map[string]any{}
+			cell.pendingClear = false
+		}
+		switch event.MsgType {
+		case "stream":
+			name, _ := content["name"].(string)
+			text, _ := content["text"].(string)
+			if n := len(cell.Outputs); n > 0 && cell.Outputs[n-1]["output_type"] == "stream" && cell.Outputs[n-1]["name"] == name {
+				// Merge consecutive outputs to the same stream.
+				cell.Outputs[n-1]["text"] = cell.Outputs[n-1]["text"].(string) + text
+				continue
+			}
+			cell.Outputs = append(cell.Outputs, map[string]any{"output_type": "stream", "name": name, "text": text})
+		case "display_data", "execute_result":
+			output := map[string]any{"output_type": event.MsgType, "data": content["data"], "metadata": replayMetadata(content)}
+			if event.MsgType == "execute_result" {
+				output["execution_count"] = content["execution_count"]
+			}
+			if displayId, _ := getFromMap(content, "transient", "display_id").(string); displayId != "" {
+				displays[displayId] = outputRef{cell: cell, index: len(cell.Outputs)}
+			}
+			cell.Outputs = append(cell.Outputs, output)
+		case "error":
+			cell.Outputs = append(cell.Outputs, map[string]any{"output_type": "error",
+				"ename": content["ename"], "evalue": content["evalue"], "traceback": content["traceback"]})
+		}
+	}
+	return nb, nil
+}
+
+// getFromMap returns the value at the path of keys in nested maps, or nil if not found.
+func getFromMap(m map[string]any, keys ...string) any {
+	var value any = m
+	for _, key := range keys {
+		asMap, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = asMap[key]
+	}
+	return value
+}
+
+// replayMetadata returns the metadata of the display content, never nil.
+func replayMetadata(content map[string]any) map[string]any {
+	if metadata, ok := content["metadata"].(map[string]any); ok {
+		return metadata
+	}
+	return map[string]any{}
+}
+
+// regexpAnsiEscape matches the ANSI escape sequences (colors) used in error tracebacks.
+var regexpAnsiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// HTML renders the notebook as a stand-alone HTML page.
+func (nb *ReplayNotebook) HTML() string {
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>GoNB session replay</title>\n" +
+		"<style>.gonb-cell{margin:1em 0;} .gonb-source{background:#f5f5f5;padding:0.5em;} " +
+		".gonb-stderr{background:#fdd;} .gonb-error{color:#b00;}</style></head><body>\n")
+	for _, cell := range nb.Cells {
+		sb.WriteString("<div class=\"gonb-cell\">\n")
+		if cell.Source != "" {
+			prompt := ""
+			if cell.ExecutionCount != nil {
+				prompt = fmt.Sprintf("[%d]: ", *cell.ExecutionCount)
+			}
+			_, _ = fmt.Fprintf(&sb, "<pre class=\"gonb-source\">%s%s</pre>\n", prompt, html.EscapeString(cell.Source))
+		}
+		for _, output := range cell.Outputs {
+			sb.WriteString(outputHTML(output))
+		}
+		sb.WriteString("</div>\n")
+	}
+	sb.WriteString("</body></html>\n")
+	return sb.String()
+}
+
+// outputHTML renders an output of a cell to HTML, using the richest MIME type available.
+func outputHTML(output map[string]any) string {
+	switch output["output_type"] {
+	case "stream":
+		class := "gonb-stream"
+		if output["name"] == "stderr" {
+			class = "gonb-stderr"
+		}
+		text, _ := output["text"].(string)
+		return fmt.Sprintf("<pre class=%q>%s</pre>\n", class, html.EscapeString(text))
+	case "error":
+		var lines []string
+		if traceback, ok := output["traceback"].([]any); ok {
+			for _, line := range traceback {
+				if s, ok := line.(string); ok {
+					lines = append(lines, regexpAnsiEscape.ReplaceAllString(s, ""))
+				}
+			}
+		}
+		return fmt.Sprintf("<pre class=\"gonb-error\">%s: %s\n%s</pre>\n",
+			html.EscapeString(fmt.Sprint(output["ename"])), html.EscapeString(fmt.Sprint(output["evalue"])),
+			html.EscapeString(strings.Join(lines, "\n")))
+	}
+	data, _ := output["data"].(map[string]any)
+	if text, ok := data[string(protocol.MIMETextHTML)].(string); ok {
+		return text + "\n"
+	}
+	if text, ok := data[string(protocol.MIMEImageSVG)].(string); ok {
+		return text + "\n"
+	}
+	for _, mimeType := range []string{"image/png", "image/jpeg", "image/gif"} {
+		if encoded, ok := data[mimeType].(string); ok {
+			return fmt.Sprintf("<img src=\"data:%s;base64,%s\"/>\n", mimeType, strings.TrimSpace(encoded))
+		}
+	}
+	if text, ok := data[string(protocol.MIMETextMarkdown)].(string); ok {
+		if rendered, err := MarkdownToHTML(text); err == nil {
+			return rendered + "\n"
+		}
+	}
+	if text, ok := data[string(protocol.MIMETextPlain)].(string); ok {
+		return fmt.Sprintf("<pre>%s</pre>\n", html.EscapeString(text))
+	}
+	if len(data) > 0 {
+		mimeTypes := make([]string, 0, len(data))
+		for mimeType := range data {
+			mimeTypes = append(mimeTypes, mimeType)
+		}
+		sort.Strings(mimeTypes)
+		return fmt.Sprintf("<p><i>Output of type %s not rendered.</i></p>\n", html.EscapeString(strings.Join(mimeTypes, ", ")))
+	}
+	return ""
+}
+
+// WriteReplay writes the notebook to filePath: as HTML if its extension is ".html" (or ".htm"), otherwise
+// as a Jupyter notebook (`.ipynb`). The file is written atomically, so it can be watched while replaying
+// in real time.
+func (nb *ReplayNotebook) WriteReplay(filePath string) error {
+	var contents []byte
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".html", ".htm":
+		contents = []byte(nb.HTML())
+	default:
+		var err error
+		contents, err = json.MarshalIndent(nb, "", " ")
+		if err != nil {
+			return errors.Wrap(err, "failed to encode the notebook of the session replay")
+		}
+	}
+	tmpPath := filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, contents, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write session replay")
+	}
+	return errors.Wrapf(os.Rename(tmpPath, filePath), "failed to write session replay %q", filePath)
+}
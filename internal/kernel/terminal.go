@@ -0,0 +1,192 @@
+package kernel
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements a Kernel and Message not connected to Jupyter, that print the outputs to a terminal.
+// They are used to execute notebooks (Go files with cell markers) from the command line, see `gonb run`.
+
+// NewOffline creates a Kernel not connected to Jupyter. It can be used with TerminalMessage.
+func NewOffline() *Kernel {
+	k := &Kernel{
+		stop:                   make(chan struct{}),
+		interruptSubscriptions: list.New(),
+		knownBlockIds:          common.NewLRUSet[string](MaxKnownBlockIds),
+	}
+	k.MarkActivity()
+	return k
+}
+
+// TerminalMessage implements Message for a Kernel not connected to Jupyter (see NewOffline): the outputs
+// published are printed to Stdout and Stderr, and input is read from Stdin.
+//
+// Rich content (HTML, images, etc.) can't be printed, and is replaced by a note with its MIME types,
+// unless there is also a textual representation (plain text or Markdown).
+type TerminalMessage struct {
+	Composed       ComposedMsg
+	Stdout, Stderr io.Writer
+	Stdin          *bufio.Reader
+
+	kernel *Kernel
+	mu     *sync.Mutex
+}
+
+var _ Message = &TerminalMessage{}
+
+// terminalStdin is shared by all TerminalMessage, so buffered input is not lost.
+var (
+	terminalStdin   = bufio.NewReader(os.Stdin)
+	terminalOutputs sync.Mutex
+)
+
+// NewTerminalMessage creates a new "execute_request" TerminalMessage for the offline kernel k, writing to
+// the process standard output and error.
+func NewTerminalMessage(k *Kernel) *TerminalMessage {
+	m := &TerminalMessage{
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Stdin:  terminalStdin,
+		kernel: k,
+		mu:     &terminalOutputs,
+	}
+	m.Composed.Header.MsgType = "execute_request"
+	if u, err := uuid.NewV4(); err == nil {
+		m.Composed.Header.MsgID = u.String()
+	}
+	return m
+}
+
+// Error implements Message: there are no errors for TerminalMessage.
+func (m *TerminalMessage) Error() error { return nil }
+
+// Ok implements Message.
+func (m *TerminalMessage) Ok() bool { return true }
+
+// ComposedMsg implements Message.
+func (m *TerminalMessage) ComposedMsg() ComposedMsg { return m.Composed }
+
+// Kernel implements Message.
+func (m *TerminalMessage) Kernel() *Kernel { return m.kernel }
+
+// Publish implements Message, by printing the content to the terminal.
+func (m *TerminalMessage) Publish(msgType string, content interface{}) error {
+	// Content is usually a struct with JSON tags: convert to a map to access the fields.
+	var fields map[string]any
+	encoded, err := json.Marshal(content)
+	if err == nil {
+		err = json.Unmarshal(encoded, &fields)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse content of %q message", msgType)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch msgType {
+	case "stream":
+		text, _ := fields["text"].(string)
+		w := m.Stdout
+		if fields["name"] == StreamStderr {
+			w = m.Stderr
+		}
+		_, err = io.WriteString(w, text)
+	case "display_data", "execute_result", "update_display_data":
+		data, _ := fields["data"].(map[string]any)
+		_, err = io.WriteString(m.Stdout, terminalDisplayText(data))
+	case "error":
+		traceback, _ := fields["traceback"].([]any)
+		for _, line := range traceback {
+			if _, err = fmt.Fprintln(m.Stderr, line); err != nil {
+				break
+			}
+		}
+	default:
+		klog.V(2).Infof("TerminalMessage: %q message not printed", msgType)
+	}
+	return err
+}
+
+// terminalDisplayText returns the text to print for the display data.
+func terminalDisplayText(data map[string]any) string {
+	var text string
+	for _, mimeType := range []protocol.MIMEType{protocol.MIMETextPlain, protocol.MIMETextMarkdown} {
+		if s, ok := data[string(mimeType)].(string); ok {
+			text = s
+			break
+		}
+	}
+	if text == "" {
+		if len(data) == 0 {
+			return ""
+		}
+		mimeTypes := make([]string, 0, len(data))
+		for mimeType := range data {
+			mimeTypes = append(mimeTypes, mimeType)
+		}
+		sort.Strings(mimeTypes)
+		text = fmt.Sprintf("[%s output not displayed in the terminal]", strings.Join(mimeTypes, ", "))
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text
+}
+
+// PublishWithMetadata implements Message: metadata is ignored.
+func (m *TerminalMessage) PublishWithMetadata(msgType string, content interface{}, _ map[string]any) error {
+	return m.Publish(msgType, content)
+}
+
+// PublishWithBuffers implements Message: buffers are ignored.
+func (m *TerminalMessage) PublishWithBuffers(msgType string, content interface{}, _ [][]byte) error {
+	return m.Publish(msgType, content)
+}
+
+// PromptInput implements Message, by printing the prompt and reading a line from Stdin.
+// The input is read in a separate goroutine, and passed to onInput as the "value" of the input message.
+// The original message passed to onInput is nil.
+func (m *TerminalMessage) PromptInput(prompt string, _ bool, onInput OnInputFn) error {
+	m.mu.Lock()
+	_, _ = io.WriteString(m.Stdout, prompt)
+	m.mu.Unlock()
+	go func() {
+		line, err := m.Stdin.ReadString('\n')
+		if err != nil && line == "" {
+			klog.Warningf("TerminalMessage: failed to read input: %v", err)
+			return
+		}
+		input := &MessageImpl{kernel: m.kernel}
+		input.Composed.Content = map[string]any{"value": strings.TrimSuffix(line, "\n")}
+		if err := onInput(nil, input); err != nil {
+			klog.Errorf("TerminalMessage: failed to deliver input: %+v", err)
+		}
+	}()
+	return nil
+}
+
+// CancelInput implements Message: it's a no-op.
+func (m *TerminalMessage) CancelInput() error { return nil }
+
+// DeliverInput implements Message: it's a no-op, input is delivered directly by PromptInput.
+func (m *TerminalMessage) DeliverInput() error { return nil }
+
+// Reply implements Message: replies are not printed.
+func (m *TerminalMessage) Reply(msgType string, _ interface{}) error {
+	klog.V(2).Infof("TerminalMessage: %q reply not printed", msgType)
+	return nil
+}
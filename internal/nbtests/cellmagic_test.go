@@ -2,6 +2,7 @@ package nbtests
 
 import (
 	"fmt"
+	. "github.com/janpfeifer/gonb/gonbtest"
 	"github.com/stretchr/testify/require"
 	"k8s.io/klog/v2"
 	"os"
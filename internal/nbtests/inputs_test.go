@@ -1,6 +1,7 @@
 package nbtests
 
 import (
+	. "github.com/janpfeifer/gonb/gonbtest"
 	"github.com/stretchr/testify/require"
 	"k8s.io/klog/v2"
 	"os"
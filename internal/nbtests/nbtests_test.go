@@ -13,6 +13,7 @@ import (
 	"flag"
 	"fmt"
 	"github.com/janpfeifer/gonb/common"
+	. "github.com/janpfeifer/gonb/gonbtest"
 	"github.com/janpfeifer/gonb/internal/goexec"
 	"github.com/janpfeifer/gonb/internal/kernel"
 	"github.com/janpfeifer/must"
@@ -48,7 +49,7 @@ func mustRemoveAll(dir string) {
 
 var (
 	rootDir, jupyterDir string
-	jupyterExecPath     string
+	runner              *Runner
 	tmpGocoverdir       string // Created if {REAL_}GOCOVERDIR is not set at start up.
 )
 
@@ -92,9 +93,8 @@ func setup() {
 
 	}
 
-	// Find jupyter executable.
-	var err error
-	jupyterExecPath, err = exec.LookPath("jupyter")
+	// Check jupyter executable.
+	jupyterExecPath, err := exec.LookPath("jupyter")
 	if err != nil {
 		panicf(
 			"Command `jupyter` is not in path. To run integration tests from `nbtests` "+
@@ -109,6 +109,7 @@ func setup() {
 	// Compile and install gonb binary as a local jupyter kernel.
 	jupyterDir = must.M1(InstallTmpGonbKernel(gonbRunArgs, extraInstallArgs))
 	fmt.Printf("%s=%s\n", kernel.JupyterDataDirEnv, jupyterDir)
+	runner = &Runner{JupyterDir: jupyterDir, RootDir: rootDir, LogExec: *flagLogExec}
 }
 
 // TestMain is used to set-up / shutdown needed for these integration tests.
@@ -142,47 +143,8 @@ func executeNotebook(t *testing.T, notebook string) *os.File {
 // executeNotebookWithInputBoxes is like executeNotebook, but takes a list of values to be used
 // in input boxes.
 func executeNotebookWithInputBoxes(t *testing.T, notebook string, inputBoxValues []string) *os.File {
-	// Execute notebook.
-	notebookRelPath := path.Join("examples", "tests", notebook+".ipynb")
-	args := []string{"-n=" + notebookRelPath, "-jupyter_dir=" + rootDir, "-logtostderr"}
-	if *flagLogExec {
-		args = append(args, "-jupyter_log", "-console_log", "-vmodule=main=2,nbexec=2")
-	}
-	if len(inputBoxValues) > 0 {
-		// Check there are no commas in the values.
-		for ii, v := range inputBoxValues {
-			if strings.Index(v, ",") != -1 {
-				panicf("executeNotebookWithInputBoxes: inputBoxValues[%d]=%q has a comma in it, this won't work",
-					ii, v)
-			}
-		}
-		args = append(args, fmt.Sprintf("-input_boxes=%s", strings.Join(inputBoxValues, ",")))
-	}
-	nbexec := exec.Command(
-		path.Join(jupyterDir, "nbexec"), args...)
-	nbexec.Stderr = os.Stderr
-	nbexec.Stdout = os.Stdout
-	require.NoErrorf(t, nbexec.Run(), "Failed to execute notebook %q with %q",
-		path.Join(rootDir, notebookRelPath), nbexec)
-
-	// Convert notebook output to text ("asciidoc").
-	tmpOutput := must.M1(os.CreateTemp("", "gonb_nbtests_output"))
-	nbconvertOutputName := tmpOutput.Name()
-	must.M(tmpOutput.Close())
-	must.M(os.Remove(nbconvertOutputName))
-	nbconvertOutputPath := nbconvertOutputName + ".asciidoc" // nbconvert adds this suffix.
-	nbconvert := exec.Command(
-		jupyterExecPath, "nbconvert", "--to", "asciidoc",
-		"--output", nbconvertOutputName,
-		path.Join(rootDir, notebookRelPath))
-	nbconvert.Stdout, nbconvert.Stderr = os.Stderr, os.Stdout
-	klog.Infof("Executing: %q", nbconvert)
-	err := nbconvert.Run()
+	f, err := runner.Execute(path.Join("examples", "tests", notebook+".ipynb"), inputBoxValues...)
 	require.NoError(t, err)
-
-	// Open converted output:
-	f, err := os.Open(nbconvertOutputPath)
-	require.NoErrorf(t, err, "Failed to open the output of %q", nbconvert)
 	return f
 }
 
@@ -191,15 +153,7 @@ func clearNotebook(t *testing.T, notebook string) {
 		// Keep outputs.
 		return
 	}
-	// Execute notebook.
-	notebookRelPath := path.Join("examples", "tests", notebook+".ipynb")
-	nbexec := exec.Command(
-		path.Join(jupyterDir, "nbexec"), "-n="+notebookRelPath,
-		"-jupyter_dir="+rootDir, "-clear")
-	nbexec.Stderr = os.Stderr
-	nbexec.Stdout = os.Stdout
-	require.NoErrorf(t, nbexec.Run(), "Failed to clear notebook %q with %q",
-		path.Join(rootDir, notebookRelPath), nbexec)
+	require.NoError(t, runner.Clear(path.Join("examples", "tests", notebook+".ipynb")))
 }
 
 func TestInstallation(t *testing.T) {
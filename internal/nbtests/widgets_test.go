@@ -1,6 +1,7 @@
 package nbtests
 
 import (
+	. "github.com/janpfeifer/gonb/gonbtest"
 	"github.com/stretchr/testify/require"
 	"os"
 	"testing"
@@ -0,0 +1,75 @@
+package specialcmd
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%asm` and `%escape`: the assembly and escape analysis views of a memorized function.
+
+// execAsm implements `%asm <FuncName>`: it displays the assembly of the function, interleaved with the
+// lines of code that generated it.
+func execAsm(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) != 1 {
+		return errors.New("%asm requires the name of a memorized function, or `<Type>.<Method>`")
+	}
+	asmLines, err := goExec.Asm(args[0])
+	if err != nil {
+		return errors.WithMessage(err, "%asm")
+	}
+	return kernel.PublishHtml(msg, asmHtml(asmLines))
+}
+
+// asmHtml renders the assembly lines in HTML: the source lines are highlighted as Go, and the
+// instructions with their mnemonic highlighted.
+func asmHtml(asmLines []goexec.AsmLine) string {
+	var sb strings.Builder
+	sb.WriteString(highlightStyle)
+	sb.WriteString("<pre>")
+	lastCellId, lastLine := -1, goexec.NoCursorLine
+	for _, asmLine := range asmLines {
+		if asmLine.Symbol != "" {
+			_, _ = fmt.Fprintf(&sb, "<b>%s</b>\n", html.EscapeString(asmLine.Symbol))
+			lastCellId, lastLine = -1, goexec.NoCursorLine
+			continue
+		}
+		if asmLine.Line != goexec.NoCursorLine && (asmLine.CellId != lastCellId || asmLine.Line != lastLine) {
+			lastCellId, lastLine = asmLine.CellId, asmLine.Line
+			_, _ = fmt.Fprintf(&sb, `<span class="gonb-hl-comment">// [%d]:%d</span> %s`+"\n",
+				asmLine.CellId, asmLine.Line+1, strings.Join(highlightGo(asmLine.Source), " "))
+		}
+		mnemonic, operands, _ := strings.Cut(asmLine.Instruction, "\t")
+		_, _ = fmt.Fprintf(&sb, `    <span class="gonb-hl-number">%s</span> <span class="gonb-hl-keyword">%-8s</span>%s`+"\n",
+			asmLine.Offset, html.EscapeString(mnemonic), html.EscapeString(operands))
+	}
+	sb.WriteString("</pre>")
+	return sb.String()
+}
+
+// execEscape implements `%escape <FuncName>`: it displays the findings of the escape analysis (and inlining
+// decisions) of the compiler for the function, mapped to the cell lines.
+func execEscape(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) != 1 {
+		return errors.New("%escape requires the name of a memorized function, or `<Type>.<Method>`")
+	}
+	diagnostics, err := goExec.EscapeAnalysis(args[0])
+	if err != nil {
+		return errors.WithMessage(err, "%escape")
+	}
+	if len(diagnostics) == 0 {
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			fmt.Sprintf("No escape analysis findings for %q.\n", args[0]))
+	}
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "### Escape analysis of `%s`\n\n| Cell | Line | Code | Finding |\n|---|---|---|---|\n", args[0])
+	for _, d := range diagnostics {
+		_, _ = fmt.Fprintf(&sb, "| [%d] | %d | `%s` | %s |\n", d.CellId, d.Line+1,
+			escapeMarkdownTableCell(d.LineText), escapeMarkdownTableCell(d.Message))
+	}
+	return kernel.PublishMarkdown(msg, sb.String())
+}
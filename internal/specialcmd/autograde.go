@@ -0,0 +1,118 @@
+package specialcmd
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%%hidden_tests` and `%autograde`, for assignments in the style of nbgrader.
+
+// cellCmdHiddenTests implements `%%hidden_tests [--points <n>]`: the tests of the cell are stored in the kernel,
+// to be run by `%autograde`. The cell is not executed, and its contents are not displayed.
+func cellCmdHiddenTests(msg kernel.Message, goExec *goexec.State, args []string, lines []string) error {
+	points := 1
+	for ii := 0; ii < len(args); ii++ {
+		switch args[ii] {
+		case "--points", "-points":
+			if ii+1 >= len(args) {
+				return errors.New("%%hidden_tests --points expects the number of points of each test")
+			}
+			var err error
+			points, err = strconv.Atoi(args[ii+1])
+			if err != nil {
+				return errors.Errorf("%%%%hidden_tests: invalid number of points %q", args[ii+1])
+			}
+			ii++
+		default:
+			return errors.Errorf("%%%%hidden_tests: unknown argument %q, use `%%%%hidden_tests [--points <n>]`", args[ii])
+		}
+	}
+	var cellId int
+	if msg != nil {
+		cellId = msg.Kernel().ExecCounter()
+	}
+	skipLines := MakeSet[int]()
+	skipLines.Insert(0)
+	tests, err := goExec.SetHiddenTests(cellId, lines, skipLines, points)
+	if err != nil {
+		return errors.WithMessage(err, "%%hidden_tests")
+	}
+	count, total := goExec.HiddenTestsCount()
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+		fmt.Sprintf("%d hidden tests stored, worth %d points each (total of %d hidden tests, %d points).\n",
+			len(tests), points, count, total))
+}
+
+// execAutograde implements `%autograde [--verbose] [--timeout <duration>] [--clear]`.
+func execAutograde(msg kernel.Message, goExec *goexec.State, args []string) error {
+	verbose := false
+	timeout := goexec.DefaultAutogradeTimeout
+	for ii := 0; ii < len(args); ii++ {
+		switch args[ii] {
+		case "--verbose", "-verbose", "-v":
+			verbose = true
+		case "--timeout", "-timeout":
+			if ii+1 >= len(args) {
+				return errors.New("%autograde --timeout expects a duration, e.g. `30s`")
+			}
+			var err error
+			timeout, err = time.ParseDuration(args[ii+1])
+			if err != nil {
+				return errors.Errorf("%%autograde: invalid --timeout %q", args[ii+1])
+			}
+			ii++
+		case "--clear", "-clear":
+			goExec.ClearHiddenTests()
+			return kernel.PublishWriteStream(msg, kernel.StreamStdout, "Hidden tests cleared.\n")
+		default:
+			return errors.Errorf("%%autograde: unknown argument %q, use `%%autograde [--verbose] [--timeout <duration>] [--clear]`", args[ii])
+		}
+	}
+	result, err := goExec.Autograde(msg, timeout)
+	if err != nil {
+		return errors.WithMessage(err, "%autograde")
+	}
+	if err := kernel.PublishHtml(msg, autogradeHtml(result)); err != nil {
+		return err
+	}
+	if verbose && result.Output != "" {
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout, result.Output)
+	}
+	return nil
+}
+
+// autogradeStatusStyle is the HTML rendering of each of the status of the tests.
+var autogradeStatusStyle = map[goexec.AutogradeStatus]string{
+	goexec.AutogradePassed:  `<span style="color: green">&#10004; passed</span>`,
+	goexec.AutogradeFailed:  `<span style="color: red">&#10008; failed</span>`,
+	goexec.AutogradeSkipped: `<span style="color: gray">skipped</span>`,
+	goexec.AutogradeNotRun:  `<span style="color: red">not run</span>`,
+}
+
+// autogradeHtml renders the score report of `%autograde`.
+func autogradeHtml(result *goexec.AutogradeResult) string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "<p><b>Score: %d / %d</b></p>\n", result.Score, result.Total)
+	if result.CompileFailed {
+		sb.WriteString("<p style=\"color: red\">The code failed to compile along with the hidden tests: no test was run.</p>\n")
+	}
+	sb.WriteString("<table><thead><tr><th>Test</th><th>Points</th><th>Result</th></tr></thead><tbody>\n")
+	for _, test := range result.Tests {
+		points := fmt.Sprintf("0 / %d", test.Points)
+		if test.Status == goexec.AutogradePassed {
+			points = fmt.Sprintf("%d / %d", test.Points, test.Points)
+		}
+		_, _ = fmt.Fprintf(&sb, "<tr><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			html.EscapeString(test.Name), points, autogradeStatusStyle[test.Status])
+	}
+	sb.WriteString("</tbody></table>\n")
+	return sb.String()
+}
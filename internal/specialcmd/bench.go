@@ -0,0 +1,144 @@
+package specialcmd
+
+import (
+	"fmt"
+	"html"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%bench`: it runs the memorized benchmarks, and with `-compare` compares them (and the
+// assembly) with a previous version of a function.
+
+// benchArgs are the parsed arguments of `%bench`.
+type benchArgs struct {
+	// compareName and compareBack are the function and how many versions back to compare, if compareName is set.
+	compareName string
+	compareBack int
+
+	options goexec.BenchOptions
+}
+
+// parseBenchArgs parses `[-compare <revision> <FuncName>] [-bench=<regexp>] [-count=<n>] [-benchtime=<t>]`.
+func parseBenchArgs(args []string) (parsed benchArgs, err error) {
+	for ii := 0; ii < len(args); ii++ {
+		arg := args[ii]
+		if strings.HasPrefix(arg, "--") {
+			arg = arg[1:] // Both `-flag` and `--flag` are accepted.
+		}
+		switch {
+		case arg == "-compare":
+			if ii+2 >= len(args) {
+				err = errors.New("%bench -compare expects a revision and a function name, e.g. `%bench -compare HEAD~1 Sum`")
+				return
+			}
+			parsed.compareBack, err = goexec.ParseRevision(args[ii+1])
+			if err != nil {
+				return
+			}
+			parsed.compareName = args[ii+2]
+			ii += 2
+		case strings.HasPrefix(arg, "-bench="):
+			parsed.options.Bench = strings.TrimPrefix(arg, "-bench=")
+		case strings.HasPrefix(arg, "-benchtime="):
+			parsed.options.BenchTime = strings.TrimPrefix(arg, "-benchtime=")
+		case strings.HasPrefix(arg, "-count="):
+			parsed.options.Count, err = strconv.Atoi(strings.TrimPrefix(arg, "-count="))
+			if err != nil || parsed.options.Count < 1 {
+				err = errors.Errorf("%%bench: invalid %q, it must be a positive number", args[ii])
+				return
+			}
+		default:
+			err = errors.Errorf("%%bench: unknown argument %q", args[ii])
+			return
+		}
+	}
+	return
+}
+
+// execBench implements `%bench`.
+func execBench(msg kernel.Message, goExec *goexec.State, args []string) error {
+	parsed, err := parseBenchArgs(args)
+	if err != nil {
+		return err
+	}
+	if parsed.compareName == "" {
+		output, err := goExec.RunBenchmarks(parsed.options)
+		if err != nil {
+			return errors.WithMessage(err, "%bench")
+		}
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout, output)
+	}
+
+	comparison, err := goExec.CompareBenchmarks(parsed.compareName, parsed.compareBack, parsed.options)
+	if err != nil {
+		return errors.WithMessage(err, "%bench -compare")
+	}
+	oldLabel := fmt.Sprintf("HEAD~%d", comparison.Back)
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "<h3>Benchmarks of <code>%s</code>: %s vs HEAD</h3>\n", html.EscapeString(comparison.Name), oldLabel)
+	benchstat, err := comparison.Benchstat()
+	if err == nil {
+		_, _ = fmt.Fprintf(&sb, "<pre>%s</pre>\n", html.EscapeString(benchstat))
+	} else {
+		if !errors.Is(err, exec.ErrNotFound) {
+			return errors.WithMessage(err, "%bench -compare")
+		}
+		sb.WriteString(benchDeltasHtml(comparison.Deltas(), oldLabel))
+		sb.WriteString("<p><i>Install <code>benchstat</code> (<code>go install golang.org/x/perf/cmd/benchstat@latest</code>) " +
+			"for a statistical comparison.</i></p>\n")
+	}
+
+	diff, err := composedCodeDiff(asmDiffText(comparison.OldAsm), asmDiffText(comparison.NewAsm), comparison.Name+".s")
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(&sb, "<h3>Assembly of <code>%s</code>: %s vs HEAD</h3>\n", html.EscapeString(comparison.Name), oldLabel)
+	if diff == "" {
+		sb.WriteString("<i>No differences in the assembly.</i>")
+	} else {
+		sb.WriteString(gitStyle + renderSideBySideDiff("", diff))
+	}
+	return kernel.PublishHtml(msg, sb.String())
+}
+
+// benchDeltasHtml renders the comparison of the means of the benchmarks as an HTML table.
+func benchDeltasHtml(deltas []goexec.BenchmarkDelta, oldLabel string) string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "<table><tr><th>Benchmark</th><th>Unit</th><th>%s</th><th>HEAD</th><th>Delta</th></tr>\n", oldLabel)
+	for _, delta := range deltas {
+		change := "~"
+		if delta.Old != 0 {
+			change = fmt.Sprintf("%+.1f%%", 100*(delta.New-delta.Old)/delta.Old)
+		}
+		_, _ = fmt.Fprintf(&sb, "<tr><td>%s</td><td>%s</td><td>%.4g</td><td>%.4g</td><td>%s</td></tr>\n",
+			html.EscapeString(delta.Name), html.EscapeString(delta.Unit), delta.Old, delta.New, change)
+	}
+	sb.WriteString("</table>\n")
+	return sb.String()
+}
+
+// asmDiffText returns the assembly as text to be diffed: the offsets (which change with any instruction added
+// or removed) are omitted, and the source lines are included as comments.
+func asmDiffText(asmLines []goexec.AsmLine) string {
+	var sb strings.Builder
+	lastSource := ""
+	for _, asmLine := range asmLines {
+		if asmLine.Symbol != "" {
+			_, _ = fmt.Fprintf(&sb, "%s:\n", asmLine.Symbol)
+			lastSource = ""
+			continue
+		}
+		if asmLine.Source != "" && asmLine.Source != lastSource {
+			lastSource = asmLine.Source
+			_, _ = fmt.Fprintf(&sb, "    // %s\n", asmLine.Source)
+		}
+		_, _ = fmt.Fprintf(&sb, "    %s\n", strings.ReplaceAll(asmLine.Instruction, "\t", " "))
+	}
+	return sb.String()
+}
@@ -0,0 +1,84 @@
+package specialcmd
+
+import (
+	"slices"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// cellCmdCache implements `%%cache [key]`: the outputs of the cell are cached, and replayed instead of executing
+// the cell again, while its inputs (see goexec.State.CellCacheKey) don't change.
+func cellCmdCache(msg kernel.Message, goExec *goexec.State, args []string, lines []string) error {
+	if len(args) > 1 {
+		return errors.Errorf("%%%%cache takes at most one argument, a key, got %q", args)
+	}
+	var userKey string
+	if len(args) == 1 {
+		userKey = args[0]
+	}
+
+	// The `%%cache` line is blanked, otherwise it would be taken as a `%%` (start of `func main`).
+	lines = slices.Clone(lines)
+	lines[0] = ""
+	usedLines := MakeSet[int]()
+	usedLines.Insert(0)
+	var cellId int
+	if msg != nil {
+		cellId = msg.Kernel().ExecCounter()
+	}
+
+	key, err := goExec.CellCacheKey(userKey, lines)
+	if err != nil {
+		return err
+	}
+	entry, err := goexec.LoadCellCache(key)
+	if err != nil {
+		klog.Warningf("%%%%cache: ignoring cache entry: %+v", err)
+		entry = nil
+	}
+
+	if entry != nil {
+		// Cache hit: declarations are still memorized, but the cell is not executed.
+		klog.V(1).Infof("%%%%cache: hit for key %s", key)
+		if err := Parse(msg, goExec, false, lines, usedLines); err != nil {
+			return errors.WithMessagef(err, "parsing special commands in cell")
+		}
+		if !goexec.IsEmptyLines(lines, usedLines) {
+			if err := goExec.MemorizeCell(msg, cellId, lines, usedLines); err != nil {
+				return err
+			}
+		}
+		_ = kernel.PublishWriteStream(msg, kernel.StreamStderr, "%%cache: outputs replayed from the cache.\n")
+		return kernel.Replay(msg, entry.Outputs)
+	}
+
+	// Cache miss: execute the cell recording its outputs.
+	recorder := kernel.NewRecordingMessage(msg)
+	if err := Parse(recorder, goExec, true, lines, usedLines); err != nil {
+		goExec.PostExecuteCell()
+		return errors.WithMessagef(err, "executing special commands in cell")
+	}
+	if !goexec.IsEmptyLines(lines, usedLines) || goExec.CellIsTest {
+		if err := goExec.ExecuteCell(recorder, cellId, lines, usedLines); err != nil {
+			return err
+		}
+	} else {
+		goExec.PostExecuteCell()
+	}
+	if msg != nil && msg.Kernel().Interrupted.Load() {
+		return nil
+	}
+	outputs, err := recorder.Outputs()
+	if err == nil {
+		err = goexec.SaveCellCache(key, outputs)
+	}
+	if err != nil {
+		klog.Errorf("%%%%cache: failed to cache outputs: %+v", err)
+		_ = kernel.PublishWriteStream(msg, kernel.StreamStderr, "%%cache: failed to cache the outputs: "+err.Error()+"\n")
+	}
+	return nil
+}
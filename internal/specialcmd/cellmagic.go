@@ -10,6 +10,7 @@ import (
 	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
 	"os"
+	"slices"
 	"strings"
 )
 
@@ -18,7 +19,10 @@ var (
 		"%%writefile",
 		"%%script",
 		"%%bash",
-		"%%sh")
+		"%%sh",
+		"%%isolate",
+		"%%cache",
+		"%%hidden_tests")
 )
 
 // IsGoCell returns whether the cell is expected to be a Go cell, based on the first line.
@@ -63,6 +67,19 @@ func ExecuteSpecialCell(msg kernel.Message, goExec *goexec.State, lines []string
 		}
 		err = cellCmdScript(msg, goExec, args, lines[1:])
 
+	case "%%isolate":
+		if len(parts) != 1 {
+			err = errors.Errorf("%q expects no extra arguments, %v was given", parts[0], parts[1:])
+			return
+		}
+		err = cellCmdIsolate(msg, goExec, lines)
+
+	case "%%cache":
+		err = cellCmdCache(msg, goExec, parts[1:], lines)
+
+	case "%%hidden_tests":
+		err = cellCmdHiddenTests(msg, goExec, parts[1:], lines)
+
 	default:
 		err = errors.Errorf("special cell command %q not implemented", parts[0])
 	}
@@ -94,6 +111,29 @@ func cellCmdWritefile(msg kernel.Message, goExec *goexec.State, args []string, l
 	return nil
 }
 
+// cellCmdIsolate implements `%%isolate`: the cell (including the `%%isolate` line, which is skipped) is executed
+// standalone, without memorized definitions, and nothing is memorized.
+func cellCmdIsolate(msg kernel.Message, goExec *goexec.State, lines []string) error {
+	// The `%%isolate` line is blanked, otherwise it would be taken as a `%%` (start of `func main`).
+	lines = slices.Clone(lines)
+	lines[0] = ""
+	usedLines := MakeSet[int]()
+	usedLines.Insert(0)
+	if err := Parse(msg, goExec, true, lines, usedLines); err != nil {
+		goExec.PostExecuteCell()
+		return errors.WithMessagef(err, "executing special commands in cell")
+	}
+	if goexec.IsEmptyLines(lines, usedLines) && !goExec.CellIsTest {
+		goExec.PostExecuteCell()
+		return nil
+	}
+	var cellId int
+	if msg != nil {
+		cellId = msg.Kernel().ExecCounter()
+	}
+	return goExec.ExecuteIsolatedCell(msg, cellId, lines, usedLines)
+}
+
 // writeLinesToFile. If `append` is true open the file with append.
 func writeLinesToFile(filePath string, lines []string, appendToFile bool) error {
 	var f *os.File
@@ -123,7 +163,9 @@ func cellCmdScript(msg kernel.Message, goExec *goexec.State, args []string, line
 		klog.Infof("Input: %q", strings.Join(lines, "\n"))
 	}
 	return jpyexec.New(msg, args[0], args[1:]...).
-		ExecutionCount(msg.Kernel().ExecCounter).
+		ExecutionCount(msg.Kernel().ExecCounter()).
+		WithStreamBuffer(goExec.StreamBufferInterval).
+		WithBinaryPolicy(goExec.BinaryPolicy).
 		WithStaticInput([]byte(strings.Join(lines, "\n") + "\n")).
 		Exec()
 }
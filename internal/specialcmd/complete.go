@@ -0,0 +1,147 @@
+package specialcmd
+
+import (
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf16"
+)
+
+// AutoComplete fills the reply with auto-complete matches for a special command line (starting with `%` or `!`),
+// where the cursor is at the given column (in bytes).
+//
+// It expects reply.CursorStart to be set to the cursor position, and it moves it back to the start of the
+// word being completed. If there are no suggestions, reply is left unchanged.
+func AutoComplete(line string, cursorCol int, reply *kernel.CompleteReply) {
+	if cursorCol > len(line) {
+		cursorCol = len(line)
+	}
+	line = goexec.TrimGonbCommentPrefix(line[:cursorCol])
+	if len(line) < 2 || line[0] != '%' {
+		return
+	}
+	cmd, args, found := strings.Cut(line[1:], " ")
+	if !found {
+		// Complete the name of the command itself.
+		completeHelpCommands(strings.TrimLeft(cmd, "%"), reply)
+		return
+	}
+
+	// Only the last word being typed is completed.
+	word := args
+	if idx := strings.LastIndexAny(args, " \t"); idx >= 0 {
+		word = args[idx+1:]
+	}
+	var candidates []string
+	switch cmd {
+	case "make":
+		candidates = MakeTargets()
+	case "task":
+		candidates = TaskTargets()
+	case "help":
+		if word == args {
+			// Only the first argument is a command.
+			completeHelpCommands(word, reply)
+		}
+		return
+	default:
+		return
+	}
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	reply.Matches = matches
+	reply.CursorStart -= utf16Len(word)
+}
+
+// AutoCompleteShell fills the reply with auto-complete matches for a shell command line (starting with `!` or
+// `!*`), where the cursor is at the given column (in bytes): commands previously executed in the session that
+// start with the text typed so far, and, while typing the first word, executables in the PATH.
+//
+// It expects reply.CursorStart to be set to the cursor position, and it moves it back to the start of the
+// shell command. If there are no suggestions, reply is left unchanged.
+func AutoCompleteShell(goExec *goexec.State, line string, cursorCol int, reply *kernel.CompleteReply) {
+	if cursorCol > len(line) {
+		cursorCol = len(line)
+	}
+	line = goexec.TrimGonbCommentPrefix(line[:cursorCol])
+	if len(line) == 0 || line[0] != '!' {
+		return
+	}
+	typed := strings.TrimLeft(strings.TrimPrefix(line[1:], "*"), " \t")
+
+	var matches []string
+	if goExec != nil {
+		for _, cmd := range goExec.ShellHistory() {
+			if strings.HasPrefix(cmd, typed) && cmd != typed {
+				matches = append(matches, cmd)
+			}
+		}
+	}
+	if typed != "" && !strings.ContainsAny(typed, " \t") {
+		for _, executable := range executablesInPath(typed) {
+			if !slices.Contains(matches, executable) {
+				matches = append(matches, executable)
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	reply.Matches = matches
+	reply.CursorStart -= utf16Len(typed)
+}
+
+// executablesInPath returns the sorted names of the executable files in the directories of the PATH environment
+// variable that start with prefix.
+func executablesInPath(prefix string) []string {
+	var executables []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasPrefix(name, prefix) || entry.IsDir() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || info.Mode()&0111 == 0 {
+				continue
+			}
+			executables = append(executables, name)
+		}
+	}
+	slices.Sort(executables)
+	return slices.Compact(executables)
+}
+
+// completeHelpCommands fills the reply with the commands documented in the help page that start with prefix.
+func completeHelpCommands(prefix string, reply *kernel.CompleteReply) {
+	var matches []string
+	for _, command := range HelpCommands() {
+		if strings.HasPrefix(command, prefix) && !strings.HasPrefix(command, "!") && command != "%%" {
+			matches = append(matches, command)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	reply.Matches = matches
+	reply.CursorStart -= utf16Len(prefix)
+}
+
+// utf16Len returns the length of str in UTF-16 code units, the unit used by Jupyter for cursor positions.
+func utf16Len(str string) int {
+	return len(utf16.Encode([]rune(str)))
+}
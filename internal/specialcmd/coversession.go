@@ -0,0 +1,36 @@
+package specialcmd
+
+import (
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// execCoverSession implements `%cover-session start|stop|report`.
+func execCoverSession(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) != 1 {
+		return errors.Errorf("%%cover-session expects `start`, `stop` or `report`, got %q", args)
+	}
+	switch args[0] {
+	case "start":
+		if err := goExec.StartCoverageSession(); err != nil {
+			return err
+		}
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			"Coverage session started: the following cells will be compiled with coverage instrumentation.\n")
+	case "stop":
+		if err := goExec.StopCoverageSession(); err != nil {
+			return err
+		}
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			"Coverage session stopped: use `%cover-session report` to display the coverage collected.\n")
+	case "report":
+		report, err := goExec.CoverageReport()
+		if err != nil {
+			return err
+		}
+		return kernel.PublishMarkdown(msg, report)
+	default:
+		return errors.Errorf("%%cover-session expects `start`, `stop` or `report`, got %q", args[0])
+	}
+}
@@ -5,7 +5,14 @@ import (
 	"github.com/janpfeifer/gonb/common"
 	"github.com/janpfeifer/gonb/internal/goexec"
 	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"html"
 	"k8s.io/klog/v2"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -21,63 +28,300 @@ func resetDefinitions(msg kernel.Message, goExec *goexec.State) {
 	}
 }
 
-func displayEnumeration(msg kernel.Message, title string, items []string) {
-	if len(items) == 0 {
-		return
-	}
-	htmlParts := make([]string, 0, len(items)+3)
-	htmlParts = append(htmlParts, "<h4>"+title+"</h4>")
-	htmlParts = append(htmlParts, "<ul>")
-	for _, item := range items {
-		htmlParts = append(htmlParts, "<li><pre>"+item+"</pre></li>")
-	}
-	htmlParts = append(htmlParts, "</ul>")
-	err := kernel.PublishHtml(msg, strings.Join(htmlParts, "\n"))
-	if err != nil {
-		klog.Errorf("Failed to publish list for %q back to jupyter: %+v", title, err)
-	}
+// definitionKinds lists the kinds of definitions, in the order they are displayed.
+var definitionKinds = []string{"import", "const", "type", "var", "func"}
+
+// definitionEntry is one memorized definition, as listed by `%list`.
+type definitionEntry struct {
+	Kind, Key string
+	CellId    int // -1 if it was not defined in a cell.
+	Source    string
+}
+
+// listFilter holds the parsed arguments of `%list`.
+type listFilter struct {
+	kinds  common.Set[string] // If empty, all kinds are listed.
+	cellId int                // If -1, all cells are listed.
+	match  *regexp.Regexp     // If nil, all keys are listed.
 }
 
-// listDefinitions lists all memorized definitions. It implements the "%list" (or "%ls") command.
-func listDefinitions(msg kernel.Message, goExec *goexec.State) {
-	_ = kernel.PublishHtml(msg, "<h3>Memorized Definitions</h3>\n")
-	displayEnumeration(msg, "Imports", common.SortedKeys(goExec.Definitions.Imports))
-	displayEnumeration(msg, "Constants", common.SortedKeys(goExec.Definitions.Constants))
-	displayEnumeration(msg, "Types", common.SortedKeys(goExec.Definitions.Types))
-	displayEnumeration(msg, "Variables", common.SortedKeys(goExec.Definitions.Variables))
-	displayEnumeration(msg, "Functions", common.SortedKeys(goExec.Definitions.Functions))
+// parseListArgs parses the arguments of `%list`: optional kinds of definitions (e.g.: `func` or `types`),
+// `-cell <id>` and `-match <regexp>`.
+func parseListArgs(args []string) (*listFilter, error) {
+	filter := &listFilter{kinds: common.MakeSet[string](), cellId: -1}
+	for ii := 0; ii < len(args); ii++ {
+		arg := args[ii]
+		switch arg {
+		case "-cell", "-match":
+			if ii+1 >= len(args) {
+				return nil, errors.Errorf("%%list %s requires a value", arg)
+			}
+			ii++
+			if arg == "-cell" {
+				cellId, err := strconv.Atoi(args[ii])
+				if err != nil {
+					return nil, errors.Errorf("%%list -cell requires the cell execution number, got %q", args[ii])
+				}
+				filter.cellId = cellId
+			} else {
+				re, err := regexp.Compile(args[ii])
+				if err != nil {
+					return nil, errors.Wrapf(err, "%%list -match with invalid regular expression %q", args[ii])
+				}
+				filter.match = re
+			}
+		default:
+			kind := strings.TrimSuffix(arg, "s")
+			if !slices.Contains(definitionKinds, kind) {
+				return nil, errors.Errorf("%%list: unknown kind of definition %q, valid values are %v", arg, definitionKinds)
+			}
+			filter.kinds.Insert(kind)
+		}
+	}
+	return filter, nil
 }
 
-func removeDefinitionImpl[T any](msg kernel.Message, mapName string, m *map[string]*T, key string) bool {
-	_, found := (*m)[key]
-	if !found {
+// keep returns whether the entry should be listed.
+func (f *listFilter) keep(entry *definitionEntry) bool {
+	if len(f.kinds) > 0 && !f.kinds.Has(entry.Kind) {
+		return false
+	}
+	if f.cellId != -1 && entry.CellId != f.cellId {
 		return false
 	}
-	delete(*m, key)
-	err := kernel.PublishWriteStream(msg, kernel.StreamStdout,
-		fmt.Sprintf(". removed %s %s\n", mapName, key))
+	return f.match == nil || f.match.MatchString(entry.Key)
+}
+
+// collectDefinitions returns the memorized definitions that pass the filter, sorted by cell, kind and key.
+func collectDefinitions(decls *goexec.Declarations, filter *listFilter) []*definitionEntry {
+	var entries []*definitionEntry
+	add := func(kind, key string, cellLines goexec.CellLines, source string) {
+		entry := &definitionEntry{Kind: kind, Key: key, CellId: cellLines.Id, Source: source}
+		if filter.keep(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	for key, importDecl := range decls.Imports {
+		source := fmt.Sprintf("import %q", importDecl.Path)
+		if importDecl.Alias != "" {
+			source = fmt.Sprintf("import %s %q", importDecl.Alias, importDecl.Path)
+		}
+		add("import", key, importDecl.CellLines, source)
+	}
+	for key, constDecl := range decls.Constants {
+		add("const", key, constDecl.CellLines, constantSource(constDecl))
+	}
+	for key, typeDecl := range decls.Types {
+		add("type", key, typeDecl.CellLines, "type "+typeDecl.TypeDefinition)
+	}
+	for key, varDecl := range decls.Variables {
+		add("var", key, varDecl.CellLines, variableSource(varDecl))
+	}
+	for key, funcDecl := range decls.Functions {
+		source := funcDecl.Definition
+		if funcDecl.Comments != nil {
+			source = strings.Join(funcDecl.Comments.Lines, "\n") + "\n" + source
+		}
+		add("func", key, funcDecl.CellLines, source)
+	}
+	kindOrder := func(kind string) int { return slices.Index(definitionKinds, kind) }
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.CellId != b.CellId {
+			// Definitions not coming from a cell (CellId == -1) are listed last.
+			if a.CellId == -1 || b.CellId == -1 {
+				return b.CellId == -1
+			}
+			return a.CellId < b.CellId
+		}
+		if a.Kind != b.Kind {
+			return kindOrder(a.Kind) < kindOrder(b.Kind)
+		}
+		return a.Key < b.Key
+	})
+	return entries
+}
+
+// constantSource returns the definition of a constant.
+// Constants that are part of a block with implicit values (e.g.: using `iota`) are shown without a value.
+func constantSource(c *goexec.Constant) string {
+	source := "const " + c.Key
+	if c.TypeDefinition != "" {
+		source += " " + c.TypeDefinition
+	}
+	if c.ValueDefinition != "" {
+		source += " = " + c.ValueDefinition
+	}
+	return source
+}
+
+// variableSource returns the definition of a variable, including the other variables defined in the same tuple.
+func variableSource(v *goexec.Variable) string {
+	names := []string{v.Name}
+	if len(v.TupleDefinitions) > 0 {
+		v = v.TupleDefinitions[0] // Only the first variable of the tuple holds the value.
+		names = names[:0]
+		for _, tupleVar := range v.TupleDefinitions {
+			names = append(names, tupleVar.Name)
+		}
+	}
+	source := "var " + strings.Join(names, ", ")
+	if v.TypeDefinition != "" {
+		source += " " + v.TypeDefinition
+	}
+	if v.ValueDefinition != "" {
+		source += " = " + v.ValueDefinition
+	}
+	return source
+}
+
+// listDefinitions lists memorized definitions, grouped by the cell where they were defined.
+// Each definition can be expanded to show its source.
+// It implements the "%list" (or "%ls") command, and `args` excludes the command itself.
+func listDefinitions(msg kernel.Message, goExec *goexec.State, args []string) error {
+	filter, err := parseListArgs(args)
 	if err != nil {
-		klog.Errorf("Failed to publish back to jupyter output of removing definitions: %+v", err)
+		return err
+	}
+	entries := collectDefinitions(goExec.Definitions, filter)
+	htmlParts := []string{"<h3>Memorized Definitions</h3>"}
+	if len(entries) == 0 {
+		htmlParts = append(htmlParts, "<p>No memorized definitions found.</p>")
 	}
-	return true
+	for ii, entry := range entries {
+		if ii == 0 || entry.CellId != entries[ii-1].CellId {
+			if ii > 0 {
+				htmlParts = append(htmlParts, "</ul>")
+			}
+			if entry.CellId == -1 {
+				htmlParts = append(htmlParts, "<h4>Not from a cell</h4>")
+			} else {
+				htmlParts = append(htmlParts, fmt.Sprintf("<h4>Cell [%d]</h4>", entry.CellId))
+			}
+			htmlParts = append(htmlParts, "<ul>")
+		}
+		htmlParts = append(htmlParts, fmt.Sprintf(
+			"<li><details><summary><code>%s %s</code></summary><pre>%s</pre></details></li>",
+			entry.Kind, html.EscapeString(entry.Key), html.EscapeString(entry.Source)))
+	}
+	if len(entries) > 0 {
+		htmlParts = append(htmlParts, "</ul>")
+	}
+	return kernel.PublishHtml(msg, strings.Join(htmlParts, "\n")+"\n")
+}
+
+// matchingKeys returns the sorted keys of m that match the glob pattern (see path.Match).
+func matchingKeys[T any](m map[string]*T, pattern string) []string {
+	var keys []string
+	for key := range m {
+		if matched, _ := path.Match(pattern, key); matched {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
 }
 
 // removeDefinitions from the memorized list. It implements the "%remove" (or "%rm") command.
-func removeDefinitions(msg kernel.Message, goExec *goexec.State, keys []string) {
-	klog.V(1).Infof("removing definitions %v", keys)
-	for _, key := range keys {
-		var found bool
-		found = found || removeDefinitionImpl(msg, "import", &goExec.Definitions.Imports, key)
-		found = found || removeDefinitionImpl(msg, "const", &goExec.Definitions.Constants, key)
-		found = found || removeDefinitionImpl(msg, "type", &goExec.Definitions.Types, key)
-		found = found || removeDefinitionImpl(msg, "var", &goExec.Definitions.Variables, key)
-		found = found || removeDefinitionImpl(msg, "func", &goExec.Definitions.Functions, key)
-		if !found {
+//
+// Each argument is a key, or a glob pattern (see path.Match) of keys, optionally prefixed by the kind of
+// definition (e.g.: `func:Test*`). Removing one variable of a tuple (`var a, b = f()`) removes all of them.
+// If dryRun is set, it only reports what would be removed.
+func removeDefinitions(msg kernel.Message, goExec *goexec.State, args []string) error {
+	dryRun := false
+	var patterns []string
+	for _, arg := range args {
+		if arg == "--dry-run" || arg == "-n" {
+			dryRun = true
+		} else {
+			patterns = append(patterns, arg)
+		}
+	}
+	klog.V(1).Infof("removing definitions %v (dryRun=%v)", patterns, dryRun)
+	decls := goExec.Definitions
+	toRemove := make(map[string]common.Set[string])
+	for _, kind := range definitionKinds {
+		toRemove[kind] = common.MakeSet[string]()
+	}
+	for _, pattern := range patterns {
+		kinds := definitionKinds
+		if kind, keyPattern, found := strings.Cut(pattern, ":"); found {
+			kind = strings.TrimSuffix(kind, "s")
+			if !slices.Contains(definitionKinds, kind) {
+				return errors.Errorf("%%rm: unknown kind of definition %q in %q, valid values are %v",
+					kind, pattern, definitionKinds)
+			}
+			kinds = []string{kind}
+			pattern = keyPattern
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "%%rm: invalid pattern %q", pattern)
+		}
+		var numMatches int
+		for _, kind := range kinds {
+			var keys []string
+			switch kind {
+			case "import":
+				keys = matchingKeys(decls.Imports, pattern)
+			case "const":
+				keys = matchingKeys(decls.Constants, pattern)
+			case "type":
+				keys = matchingKeys(decls.Types, pattern)
+			case "var":
+				keys = matchingKeys(decls.Variables, pattern)
+				for _, key := range keys {
+					// Variables of a tuple are removed together.
+					for _, tupleVar := range decls.Variables[key].TupleDefinitions {
+						toRemove[kind].Insert(tupleVar.Key)
+					}
+				}
+			case "func":
+				keys = matchingKeys(decls.Functions, pattern)
+			}
+			for _, key := range keys {
+				toRemove[kind].Insert(key)
+			}
+			numMatches += len(keys)
+		}
+		if numMatches == 0 {
 			err := kernel.PublishWriteStream(msg, kernel.StreamStderr,
-				fmt.Sprintf(". key %q not found in any definition, not removed\n", key))
+				fmt.Sprintf(". key %q not found in any definition, not removed\n", pattern))
 			if err != nil {
 				klog.Errorf("Failed to publish back to jupyter output of removing definitions: %+v", err)
 			}
 		}
 	}
+
+	var report []string
+	// Deletions go through UpdateDefinitions: the memorized definitions are shared with introspection requests.
+	goExec.UpdateDefinitions(func(decls *goexec.Declarations) {
+		for _, kind := range definitionKinds {
+			for _, key := range common.SortedKeys(toRemove[kind]) {
+				if dryRun {
+					report = append(report, fmt.Sprintf(". would remove %s %s\n", kind, key))
+					continue
+				}
+				switch kind {
+				case "import":
+					delete(decls.Imports, key)
+				case "const":
+					delete(decls.Constants, key)
+				case "type":
+					delete(decls.Types, key)
+				case "var":
+					delete(decls.Variables, key)
+				case "func":
+					delete(decls.Functions, key)
+				}
+				report = append(report, fmt.Sprintf(". removed %s %s\n", kind, key))
+			}
+		}
+	})
+	if len(report) > 0 {
+		err := kernel.PublishWriteStream(msg, kernel.StreamStdout, strings.Join(report, ""))
+		if err != nil {
+			klog.Errorf("Failed to publish back to jupyter output of removing definitions: %+v", err)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,150 @@
+package specialcmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%deps`: the report of the modules the kernel depends on, with their versions and licenses.
+
+// execDeps implements `%deps [--direct] [--csv <file>]`.
+func execDeps(msg kernel.Message, goExec *goexec.State, args []string) error {
+	directOnly := false
+	csvPath := ""
+	for ii := 0; ii < len(args); ii++ {
+		switch args[ii] {
+		case "--direct", "-direct":
+			directOnly = true
+		case "--csv", "-csv":
+			if ii+1 >= len(args) {
+				return errors.New("%deps --csv expects the path of the CSV file to write")
+			}
+			csvPath = args[ii+1]
+			ii++
+		default:
+			return errors.Errorf("%%deps: unknown argument %q, use `%%deps [--direct] [--csv <file>]`", args[ii])
+		}
+	}
+	deps, err := goExec.Dependencies()
+	if err != nil {
+		return errors.WithMessage(err, "%deps")
+	}
+	if directOnly {
+		deps = slices.DeleteFunc(deps, func(dep goexec.ModuleDependency) bool { return dep.Indirect })
+	}
+	csvContent, err := depsCSV(deps)
+	if err != nil {
+		return err
+	}
+	if csvPath != "" {
+		if err := os.WriteFile(csvPath, csvContent, 0644); err != nil {
+			return errors.Wrapf(err, "%%deps: failed to write %q", csvPath)
+		}
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			fmt.Sprintf("Wrote %d modules to %q\n", len(deps), csvPath))
+	}
+	// Sorting requires an inline script: it's skipped if the Content-Security-Policy disallows them (--csp_no_inline).
+	sortable := goExec.Comms.ScriptsDir == ""
+	return kernel.PublishHtml(msg, depsHtml(deps, csvContent, sortable, goExec.Comms.ScriptNonce))
+}
+
+// depsCSV returns the dependencies in CSV format.
+func depsCSV(deps []goexec.ModuleDependency) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"Module", "Version", "Replacement", "Direct", "License", "License File"})
+	for _, dep := range deps {
+		_ = w.Write([]string{dep.Path, dep.Version, dep.Replacement, fmt.Sprint(!dep.Indirect), dep.License, dep.LicenseFile})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, errors.Wrap(err, "%deps: failed to generate CSV")
+	}
+	return buf.Bytes(), nil
+}
+
+// depsSortScript makes the columns of the table of dependencies sortable by clicking on the headers.
+// The `nonce` attribute (or an empty string) and the table id are given as parameters.
+const depsSortScript = `<script%s>
+(() => {
+	const table = document.getElementById("%s");
+	table.querySelectorAll("th").forEach((th, column) => {
+		th.style.cursor = "pointer";
+		th.addEventListener("click", () => {
+			const tbody = table.tBodies[0];
+			const ascending = th.dataset.order !== "asc";
+			th.dataset.order = ascending ? "asc" : "desc";
+			Array.from(tbody.rows)
+				.sort((a, b) => a.cells[column].textContent.localeCompare(b.cells[column].textContent) * (ascending ? 1 : -1))
+				.forEach(row => tbody.appendChild(row));
+		});
+	});
+})();
+</script>
+`
+
+// depsHtml renders the dependencies as an HTML table, with a summary of the licenses and a link to
+// download them as CSV. If sortable, a script to sort the table is included, with the given nonce, if not empty.
+func depsHtml(deps []goexec.ModuleDependency, csvContent []byte, sortable bool, scriptNonce string) string {
+	if len(deps) == 0 {
+		return "<p>No module dependencies.</p>"
+	}
+	var sb strings.Builder
+	licenseCounts := make(map[string]int)
+	for _, dep := range deps {
+		license := dep.License
+		if license == "" {
+			license = "Not downloaded"
+		}
+		licenseCounts[license]++
+	}
+	licenses := common.SortedKeys(licenseCounts)
+	summary := make([]string, 0, len(licenses))
+	for _, license := range licenses {
+		summary = append(summary, fmt.Sprintf("%s: %d", html.EscapeString(license), licenseCounts[license]))
+	}
+	_, _ = fmt.Fprintf(&sb, "<p><b>%d modules</b> (%s) &mdash; "+
+		`<a href="data:text/csv;base64,%s" download="deps.csv">download as CSV</a></p>`+"\n",
+		len(deps), strings.Join(summary, ", "), base64.StdEncoding.EncodeToString(csvContent))
+
+	tableId := "gonb-deps-" + common.UniqueId()
+	_, _ = fmt.Fprintf(&sb, `<table id="%s"><thead><tr><th>Module</th><th>Version</th><th>Direct</th><th>License</th></tr></thead><tbody>`+"\n", tableId)
+	for _, dep := range deps {
+		version := html.EscapeString(dep.Version)
+		if dep.Replacement != "" {
+			version += " &rArr; " + html.EscapeString(dep.Replacement)
+		}
+		direct := "yes"
+		if dep.Indirect {
+			direct = "no"
+		}
+		license := html.EscapeString(dep.License)
+		if dep.License == "" {
+			license = "<i>not downloaded</i>"
+		} else if dep.LicenseFile != "" {
+			license = fmt.Sprintf(`<span title="%s">%s</span>`, html.EscapeString(dep.LicenseFile), license)
+		}
+		_, _ = fmt.Fprintf(&sb, `<tr><td><a href="https://pkg.go.dev/%s" target="_blank">%s</a></td><td>%s</td><td>%s</td><td>%s</td></tr>`+"\n",
+			html.EscapeString(dep.Path), html.EscapeString(dep.Path), version, direct, license)
+	}
+	sb.WriteString("</tbody></table>\n")
+	if sortable {
+		var nonceAttr string
+		if scriptNonce != "" {
+			nonceAttr = fmt.Sprintf(" nonce=\"%s\"", html.EscapeString(scriptNonce))
+		}
+		_, _ = fmt.Fprintf(&sb, depsSortScript, nonceAttr, tableId)
+	}
+	return sb.String()
+}
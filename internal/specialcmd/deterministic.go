@@ -0,0 +1,51 @@
+package specialcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// execDeterministic implements `%deterministic [on [<seed>]|off]`.
+func execDeterministic(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) == 0 {
+		if goExec.Deterministic == nil {
+			return kernel.PublishWriteStream(msg, kernel.StreamStdout, "Deterministic mode is off.\n")
+		}
+		manifest, err := goExec.ReproducibilityManifest()
+		if err != nil {
+			return err
+		}
+		encoded, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "failed to encode reproducibility manifest")
+		}
+		return kernel.PublishMarkdown(msg, fmt.Sprintf("Deterministic mode is on:\n\n```json\n%s\n```\n", encoded))
+	}
+	switch args[0] {
+	case "on":
+		seed := int64(goexec.DefaultDeterministicSeed)
+		if len(args) > 2 {
+			return errors.Errorf("%%deterministic on takes at most one argument, the random seed, got %q", args[1:])
+		}
+		if len(args) == 2 {
+			var err error
+			seed, err = strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return errors.Wrapf(err, "%%deterministic on: invalid seed %q", args[1])
+			}
+		}
+		return goExec.EnableDeterministic(seed)
+	case "off":
+		if len(args) != 1 {
+			return errors.Errorf("%%deterministic off takes no arguments, got %q", args[1:])
+		}
+		return goExec.DisableDeterministic()
+	default:
+		return errors.Errorf("%%deterministic expects `on [<seed>]` or `off`, got %q", args[0])
+	}
+}
@@ -0,0 +1,45 @@
+package specialcmd
+
+import (
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"strings"
+)
+
+// execDiffState implements `%diffstate`: it shows what changed in the composed program (`main.go`) between the
+// last two successful executions.
+func execDiffState(msg kernel.Message, goExec *goexec.State) error {
+	previous, last := goExec.ComposedCodeHistory()
+	if previous == "" {
+		return errors.New("%diffstate requires at least two cells executed successfully")
+	}
+	diff, err := composedCodeDiff(previous, last, goExec.CodePath())
+	if err != nil {
+		return err
+	}
+	if diff == "" {
+		return kernel.PublishHtml(msg, "<i>No differences in the composed program since the previous execution.</i>")
+	}
+	return kernel.PublishHtml(msg, gitStyle+renderSideBySideDiff("", diff))
+}
+
+// composedCodeDiff returns the unified diff between the previous and last composed programs, in the format
+// of `git diff`, so it can be rendered with renderSideBySideDiff.
+func composedCodeDiff(previous, last, name string) (string, error) {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(previous),
+		B:        difflib.SplitLines(last),
+		FromFile: "a/" + name,
+		ToFile:   "b/" + name,
+		Context:  3,
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to diff composed programs")
+	}
+	if diff == "" {
+		return "", nil
+	}
+	return "diff --git a/" + name + " b/" + name + "\n" + strings.TrimRight(diff, "\n"), nil
+}
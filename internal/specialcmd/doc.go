@@ -0,0 +1,164 @@
+package specialcmd
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"k8s.io/klog/v2"
+	"os/exec"
+	"strings"
+)
+
+// This file implements `%doc`: documentation of packages and symbols rendered as Markdown.
+
+// execDoc implements `%doc <package>[.<symbol>[.<method>]]`: it looks first for a symbol memorized from previous
+// cells, and if not found uses `go doc`. Long documentation is sent to the front-end pager, see `%pager`.
+func execDoc(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) != 1 {
+		return errors.New("%doc takes one argument, the package, symbol or `package.Symbol` to document")
+	}
+	name := args[0]
+	if markdown, found := memorizedDoc(goExec.Definitions, name); found {
+		return goExec.PublishMarkdownOrPage(msg, markdown)
+	}
+	markdown, err := goDoc(goExec, name)
+	if err != nil {
+		return err
+	}
+	return goExec.PublishMarkdownOrPage(msg, markdown)
+}
+
+// memorizedDoc returns the Markdown documentation for a symbol (or method, as `Type.Method`) defined in
+// previous cells.
+func memorizedDoc(decls *goexec.Declarations, name string) (markdown string, found bool) {
+	var parts []string
+	header := func(kind string) {
+		parts = append(parts, fmt.Sprintf("### %s `%s`\n\n_Defined in the notebook._\n", kind, name))
+	}
+	codeBlock := func(code string) {
+		parts = append(parts, "```go\n"+strings.TrimSpace(code)+"\n```\n")
+	}
+	if fn, ok := decls.Functions[strings.Replace(name, ".", "~", 1)]; ok {
+		header("func")
+		if fn.Comments != nil {
+			parts = append(parts, commentsToMarkdown(fn.Comments.Lines))
+		}
+		codeBlock(funcSignature(fn.Definition))
+		return strings.Join(parts, "\n"), true
+	}
+	if typeDecl, ok := decls.Types[name]; ok {
+		header("type")
+		codeBlock("type " + typeDecl.TypeDefinition)
+		var methods []string
+		for _, key := range SortedKeys(decls.Functions) {
+			if strings.HasPrefix(key, name+"~") {
+				methods = append(methods, funcSignature(decls.Functions[key].Definition))
+			}
+		}
+		if len(methods) > 0 {
+			parts = append(parts, "**Methods:**\n")
+			codeBlock(strings.Join(methods, "\n"))
+		}
+		return strings.Join(parts, "\n"), true
+	}
+	if v, ok := decls.Variables[name]; ok {
+		header("var")
+		def := "var " + v.Name
+		if v.TypeDefinition != "" {
+			def += " " + v.TypeDefinition
+		}
+		if v.ValueDefinition != "" {
+			def += " = " + v.ValueDefinition
+		}
+		codeBlock(def)
+		return strings.Join(parts, "\n"), true
+	}
+	if c, ok := decls.Constants[name]; ok {
+		header("const")
+		def := "const " + c.Key
+		if c.TypeDefinition != "" {
+			def += " " + c.TypeDefinition
+		}
+		if c.ValueDefinition != "" {
+			def += " = " + c.ValueDefinition
+		}
+		codeBlock(def)
+		return strings.Join(parts, "\n"), true
+	}
+	return "", false
+}
+
+// commentsToMarkdown strips the comment markers of the lines, so they can be rendered as Markdown.
+func commentsToMarkdown(lines []string) string {
+	var out []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		line = strings.TrimPrefix(line, "//")
+		line = strings.TrimPrefix(line, "/*")
+		line = strings.TrimSuffix(line, "*/")
+		out = append(out, strings.TrimPrefix(line, " "))
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+// funcSignature returns the function definition without its body. If it fails to parse, it returns
+// the definition as is.
+func funcSignature(definition string) string {
+	fileSet := token.NewFileSet()
+	f, err := parser.ParseFile(fileSet, "", "package main\n\n"+definition, parser.SkipObjectResolution)
+	if err != nil || len(f.Decls) == 0 {
+		return definition
+	}
+	funcDecl, ok := f.Decls[0].(*ast.FuncDecl)
+	if !ok {
+		return definition
+	}
+	funcDecl.Body = nil
+	funcDecl.Doc = nil
+	var buf bytes.Buffer
+	if err = format.Node(&buf, fileSet, funcDecl); err != nil {
+		return definition
+	}
+	return buf.String()
+}
+
+// goDoc runs `go doc` for the package or symbol, and returns its output formatted as Markdown, with a link to
+// pkg.go.dev. Package names are resolved using the imports memorized from previous cells.
+func goDoc(goExec *goexec.State, name string) (string, error) {
+	pkgPath, symbol := name, ""
+	base := strings.LastIndex(name, "/") + 1 // Dots before the last "/" are part of the package path.
+	if idx := strings.Index(name[base:], "."); idx > 0 {
+		pkgPath, symbol = name[:base+idx], name[base+idx+1:]
+	}
+	if imp, found := goExec.Definitions.Imports[pkgPath]; found {
+		pkgPath = imp.Path
+	}
+	target := pkgPath
+	args := []string{"doc"}
+	if symbol == "" {
+		args = append(args, "-all")
+	} else {
+		target += "." + symbol
+	}
+	args = append(args, target)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = goExec.TempDir
+	klog.V(2).Infof("Executing %s", cmd)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.Errorf("`go doc %s` failed:\n%s", target, output)
+	}
+
+	link := "https://pkg.go.dev/" + pkgPath
+	if symbol != "" {
+		link += "#" + symbol
+	}
+	return fmt.Sprintf("### [`%s`](%s)\n\n```go\n%s\n```\n", target, link, strings.TrimRight(string(output), "\n")), nil
+}
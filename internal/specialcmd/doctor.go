@@ -0,0 +1,117 @@
+package specialcmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/janpfeifer/gonb/gonbui/jupyterapi"
+	"github.com/janpfeifer/gonb/internal/comms"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/janpfeifer/gonb/version"
+)
+
+// This file implements `%doctor`: a report of the environment GoNB is running in, to help diagnose problems.
+
+// execDoctor implements `%doctor`.
+func execDoctor(msg kernel.Message, goExec *goexec.State) error {
+	return kernel.PublishMarkdown(msg, doctorReport(msg, goExec))
+}
+
+// doctorReport returns the `%doctor` report in Markdown.
+func doctorReport(msg kernel.Message, goExec *goexec.State) string {
+	var sb strings.Builder
+	row := func(name, value string) {
+		if value == "" {
+			value = "_(unknown)_"
+		} else {
+			value = "`" + strings.ReplaceAll(value, "`", "'") + "`"
+		}
+		_, _ = fmt.Fprintf(&sb, "| %s | %s |\n", name, value)
+	}
+	errRow := func(name string, err error) {
+		_, _ = fmt.Fprintf(&sb, "| %s | ⚠️ %s |\n", name, strings.ReplaceAll(err.Error(), "|", "\\|"))
+	}
+
+	sb.WriteString("## GoNB Doctor\n\n| | |\n|---|---|\n")
+	row("GoNB version", version.AppVersion.Version)
+	if output, err := exec.Command("go", "env", "GOVERSION").Output(); err == nil {
+		row("Go version", strings.TrimSpace(string(output)))
+	} else {
+		errRow("Go version", err)
+	}
+	if goPath, err := exec.LookPath("go"); err == nil {
+		row("go", goPath)
+	} else {
+		errRow("go", err)
+	}
+	for _, key := range []string{goexec.GoRootEnv, goexec.GoBinaryEnv} {
+		if value := os.Getenv(key); value != "" {
+			row(key, value)
+		}
+	}
+	if goplsPath, err := exec.LookPath("gopls"); err == nil {
+		if goexec.GoplsOnDemand {
+			goplsPath += " (started on demand, --low-memory)"
+		}
+		row("gopls", goplsPath)
+	} else {
+		errRow("gopls", err)
+	}
+	if status, ok := goExec.GoplsStatus(); ok {
+		row("gopls status", status.String())
+	}
+	row("Go code directory", goExec.TempDir)
+	if total, err := kernel.TotalMemory(); err == nil {
+		row("Total memory", fmt.Sprintf("%.1f GiB", float64(total)/(1<<30)))
+	} else {
+		errRow("Total memory", err)
+	}
+
+	var kernelId string
+	if msg != nil && msg.Kernel() != nil {
+		kernelId = msg.Kernel().JupyterKernelId
+	}
+	row("Jupyter kernel id", kernelId)
+	row("Notebook path", kernel.NotebookPath())
+	if servers, err := jupyterapi.Servers(); err == nil {
+		row("Jupyter servers running", fmt.Sprintf("%d", len(servers)))
+	} else {
+		errRow("Jupyter servers running", err)
+	}
+	if server, err := goexec.JupyterServer(); err == nil {
+		row("Jupyter server", server.URL)
+		row("Jupyter server runtime file", server.RuntimeFile)
+	} else {
+		errRow("Jupyter server", err)
+	}
+	if root, err := goexec.JupyterRootDirectory(); err == nil {
+		row("Jupyter root directory", root)
+	} else {
+		errRow("Jupyter root directory", err)
+	}
+	row("Files URL", goexec.JupyterFilesUrl(""))
+	if cwd, err := os.Getwd(); err == nil {
+		row("Current directory", cwd)
+	}
+	if msg != nil && msg.Kernel() != nil {
+		lastActivity := msg.Kernel().LastActivity()
+		row("Last activity", fmt.Sprintf("%s (idle for %s)", lastActivity.Format(time.RFC3339),
+			time.Since(lastActivity).Round(time.Second)))
+		if idleTimeout := msg.Kernel().IdleTimeout; idleTimeout > 0 {
+			row("Idle timeout", idleTimeout.String())
+		}
+		knownBlockIds := msg.Kernel().KnownBlockIds()
+		row("Known display ids", fmt.Sprintf("%d (max %d, %d evicted)",
+			knownBlockIds.Len(), knownBlockIds.Capacity(), knownBlockIds.Evictions()))
+	}
+	if goExec.Comms != nil {
+		count, rejected := goExec.Comms.SubscriptionsStats()
+		row("Program address subscriptions", fmt.Sprintf("%d (max %d, %d rejected)",
+			count, comms.MaxAddressSubscriptions, rejected))
+	}
+	return sb.String()
+}
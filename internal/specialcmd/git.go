@@ -0,0 +1,330 @@
+package specialcmd
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"html"
+	"k8s.io/klog/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// This file implements `%git`: a few git sub-commands with their output rendered as HTML.
+
+// DefaultGitLogEntries is the number of commits displayed by `%git log`, if not specified with `-n`.
+const DefaultGitLogEntries = 10
+
+// execGit implements the `%git` special command. The parameter `args` excludes "%git".
+func execGit(msg kernel.Message, args []string) error {
+	if len(args) == 0 {
+		return errors.New("%git requires a sub-command: status, diff, log or root")
+	}
+	switch args[0] {
+	case "status":
+		return gitStatus(msg)
+	case "diff":
+		return gitDiff(msg, args[1:])
+	case "log":
+		return gitLog(msg, args[1:])
+	case "root":
+		return gitRoot(msg)
+	default:
+		return errors.Errorf("%%git %s not supported, use one of status, diff, log or root -- or use `!git %s` instead",
+			args[0], strings.Join(args, " "))
+	}
+}
+
+// runGit runs git with the given arguments in the current directory and returns its output.
+func runGit(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	klog.V(2).Infof("Executing %q", cmd)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to execute %q: %s", cmd, strings.TrimSpace(stderr.String()))
+	}
+	return string(output), nil
+}
+
+// gitTopLevel returns the top-level directory of the git repository of the current directory.
+func gitTopLevel() (string, error) {
+	output, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// gitRoot finds the top-level directory of the git repository, sets protocol.GONB_GIT_TOPLEVEL_ENV and prints it.
+func gitRoot(msg kernel.Message) error {
+	root, err := gitTopLevel()
+	if err != nil {
+		return err
+	}
+	if err = os.Setenv(protocol.GONB_GIT_TOPLEVEL_ENV, root); err != nil {
+		return errors.Wrapf(err, "failed to set environment variable %q", protocol.GONB_GIT_TOPLEVEL_ENV)
+	}
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+		fmt.Sprintf("%s=%q\n", protocol.GONB_GIT_TOPLEVEL_ENV, root))
+}
+
+// gitFilePath returns the absolute path of a file as reported by git: relative paths are relative to the
+// top-level directory of the repository (root), not the current directory. If root is empty, relative
+// paths are resolved against the current directory.
+func gitFilePath(root, filePath string) (string, error) {
+	if root != "" && !filepath.IsAbs(filePath) {
+		return filepath.Join(root, filePath), nil
+	}
+	return filepath.Abs(filePath)
+}
+
+// fileLink returns an HTML link to the file, if it is under the Jupyter root directory, so it can be
+// opened in the notebook. Otherwise, it returns the escaped file name. See gitFilePath about root.
+func fileLink(root, filePath string) string {
+	escaped := html.EscapeString(filePath)
+	jupyterRoot, err := goexec.JupyterRootDirectory()
+	if err != nil {
+		return escaped
+	}
+	absPath, err := gitFilePath(root, filePath)
+	if err != nil {
+		return escaped
+	}
+	relPath, err := filepath.Rel(jupyterRoot, absPath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return escaped
+	}
+	return fmt.Sprintf(`<a href="%s" target="_blank">%s</a>`, html.EscapeString(goexec.JupyterFilesUrl(relPath)), escaped)
+}
+
+const gitStyle = `<style>
+.gonb-git { font-family: monospace; border-collapse: collapse; }
+.gonb-git td { padding: 0 0.5em; text-align: left; vertical-align: top; white-space: pre; }
+.gonb-git-add { background-color: rgba(0, 200, 0, 0.15); }
+.gonb-git-del { background-color: rgba(220, 0, 0, 0.15); }
+.gonb-git-hunk { color: #888; }
+.gonb-git-num { color: #888; text-align: right !important; user-select: none; }
+</style>
+`
+
+// gitStatus renders `git status` as an HTML table.
+func gitStatus(msg kernel.Message) error {
+	root, err := gitTopLevel()
+	if err != nil {
+		return err
+	}
+	output, err := runGit("status", "--porcelain=v1", "--branch")
+	if err != nil {
+		return err
+	}
+	var parts []string
+	parts = append(parts, gitStyle)
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "## ") {
+		parts = append(parts, fmt.Sprintf("<b>Branch:</b> <code>%s</code><br/>", html.EscapeString(lines[0][3:])))
+		lines = lines[1:]
+	}
+	if len(lines) == 0 || (len(lines) == 1 && lines[0] == "") {
+		parts = append(parts, "<i>Nothing to commit, working tree clean.</i>")
+		return kernel.PublishHtml(msg, strings.Join(parts, "\n"))
+	}
+	parts = append(parts, `<table class="gonb-git">`)
+	for _, line := range lines {
+		if len(line) < 4 {
+			continue
+		}
+		code, file := line[:2], line[3:]
+		class := ""
+		switch {
+		case code == "??":
+			class = "gonb-git-hunk"
+		case strings.Contains(code, "D"):
+			class = "gonb-git-del"
+		default:
+			class = "gonb-git-add"
+		}
+		parts = append(parts, fmt.Sprintf(`<tr><td class="%s">%s</td><td>%s</td></tr>`,
+			class, html.EscapeString(code), fileLink(root, file)))
+	}
+	parts = append(parts, "</table>")
+	return kernel.PublishHtml(msg, strings.Join(parts, "\n"))
+}
+
+// gitLog renders `git log -n <N>` as an HTML table.
+func gitLog(msg kernel.Message, args []string) error {
+	n := DefaultGitLogEntries
+	for len(args) > 0 {
+		if args[0] != "-n" || len(args) < 2 {
+			return errors.Errorf("%%git log only accepts `-n <number_of_entries>`, got %q", args)
+		}
+		var err error
+		n, err = strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return errors.Errorf("%%git log -n %q: invalid number of entries", args[1])
+		}
+		args = args[2:]
+	}
+	output, err := runGit("log", "-n", strconv.Itoa(n), "--date=short", "--pretty=format:%h%x09%ad%x09%an%x09%s")
+	if err != nil {
+		return err
+	}
+	parts := []string{gitStyle, `<table class="gonb-git">`}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, "\t", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf(`<tr><td class="gonb-git-hunk">%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			html.EscapeString(fields[0]), html.EscapeString(fields[1]), html.EscapeString(fields[2]),
+			html.EscapeString(fields[3])))
+	}
+	parts = append(parts, "</table>")
+	return kernel.PublishHtml(msg, strings.Join(parts, "\n"))
+}
+
+// gitDiff renders `git diff [files...]` side-by-side as HTML.
+func gitDiff(msg kernel.Message, files []string) error {
+	root, err := gitTopLevel()
+	if err != nil {
+		return err
+	}
+	args := append([]string{"diff", "--no-color", "--no-ext-diff"}, files...)
+	output, err := runGit(args...)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(output) == "" {
+		return kernel.PublishHtml(msg, "<i>No differences.</i>")
+	}
+	return kernel.PublishHtml(msg, gitStyle+renderSideBySideDiff(root, output))
+}
+
+// diffRow is one row of the side-by-side rendering of a diff.
+type diffRow struct {
+	oldNum, newNum   int // 0 if not present.
+	oldText, newText string
+	class            string
+}
+
+// renderSideBySideDiff renders the output of `git diff` (unified format) as side-by-side HTML tables, one per file.
+// The file names are linked relative to root, see gitFilePath.
+func renderSideBySideDiff(root, diff string) string {
+	var parts []string
+	var rows []diffRow
+	var removed, added []diffRow // Pending removed/added lines, to be paired side-by-side.
+	var oldNum, newNum int
+	var oldName string
+	flushChanges := func() {
+		for ii := 0; ii < max(len(removed), len(added)); ii++ {
+			var row diffRow
+			if ii < len(removed) {
+				row.oldNum, row.oldText = removed[ii].oldNum, removed[ii].oldText
+			}
+			if ii < len(added) {
+				row.newNum, row.newText = added[ii].newNum, added[ii].newText
+			}
+			row.class = "changed"
+			rows = append(rows, row)
+		}
+		removed, added = nil, nil
+	}
+	flushFile := func() {
+		flushChanges()
+		if len(rows) == 0 {
+			return
+		}
+		parts = append(parts, `<table class="gonb-git">`)
+		for _, row := range rows {
+			parts = append(parts, row.render())
+		}
+		parts = append(parts, "</table>")
+		rows = nil
+	}
+
+	inHeader := false // Whether we are in the header of a file, as opposed to its hunks.
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flushFile()
+			inHeader = true
+		case inHeader && strings.HasPrefix(line, "--- "):
+			oldName = strings.TrimPrefix(line[4:], "a/")
+		case inHeader && strings.HasPrefix(line, "+++ "):
+			name := strings.TrimPrefix(line[4:], "b/")
+			if name == "/dev/null" {
+				// File deleted.
+				name = oldName
+			}
+			parts = append(parts, fmt.Sprintf("<h4>%s</h4>", fileLink(root, name)))
+		case inHeader && !strings.HasPrefix(line, "@@"):
+			// Other header lines (index, mode, rename, etc.) are ignored.
+		case strings.HasPrefix(line, "@@"):
+			inHeader = false
+			flushChanges()
+			oldNum, newNum = parseHunkHeader(line)
+			rows = append(rows, diffRow{oldText: line, class: "hunk"})
+		case strings.HasPrefix(line, "-"):
+			removed = append(removed, diffRow{oldNum: oldNum, oldText: line[1:]})
+			oldNum++
+		case strings.HasPrefix(line, "+"):
+			added = append(added, diffRow{newNum: newNum, newText: line[1:]})
+			newNum++
+		case strings.HasPrefix(line, " "):
+			flushChanges()
+			rows = append(rows, diffRow{oldNum: oldNum, newNum: newNum, oldText: line[1:], newText: line[1:]})
+			oldNum++
+			newNum++
+		}
+	}
+	flushFile()
+	return strings.Join(parts, "\n")
+}
+
+// parseHunkHeader parses the starting line numbers of a hunk header like "@@ -10,7 +10,8 @@ func ...".
+func parseHunkHeader(line string) (oldStart, newStart int) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return
+	}
+	parse := func(field string) int {
+		field = field[1:] // Remove "-" or "+".
+		if idx := strings.Index(field, ","); idx >= 0 {
+			field = field[:idx]
+		}
+		n, _ := strconv.Atoi(field)
+		return n
+	}
+	return parse(fields[1]), parse(fields[2])
+}
+
+func (row diffRow) render() string {
+	if row.class == "hunk" {
+		return fmt.Sprintf(`<tr><td colspan="4" class="gonb-git-hunk">%s</td></tr>`, html.EscapeString(row.oldText))
+	}
+	num := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	oldClass, newClass := "", ""
+	if row.class == "changed" {
+		if row.oldNum > 0 {
+			oldClass = "gonb-git-del"
+		}
+		if row.newNum > 0 {
+			newClass = "gonb-git-add"
+		}
+	}
+	return fmt.Sprintf(`<tr><td class="gonb-git-num">%s</td><td class="%s">%s</td><td class="gonb-git-num">%s</td><td class="%s">%s</td></tr>`,
+		num(row.oldNum), oldClass, html.EscapeString(row.oldText),
+		num(row.newNum), newClass, html.EscapeString(row.newText))
+}
@@ -0,0 +1,101 @@
+package specialcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/goexec/goplsclient"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%gopls`: the configuration of `gopls` and the report of its status.
+
+// execGopls implements `%gopls set <key>=<value>...`, `%gopls unset <key>...`, `%gopls reset`,
+// `%gopls settings` and `%gopls status`.
+func execGopls(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) == 0 {
+		return errors.New("%gopls expects `set <key>=<value>`, `unset <key>`, `reset`, `settings` or `status`")
+	}
+	switch args[0] {
+	case "set":
+		if len(args) == 1 {
+			return errors.New("%gopls set expects one or more `<key>=<value>` settings")
+		}
+		for _, assignment := range args[1:] {
+			key, value, err := goplsclient.ParseSetting(assignment)
+			if err != nil {
+				return errors.WithMessage(err, "%gopls set")
+			}
+			if err = goExec.SetGoplsSetting(key, value); err != nil {
+				return errors.WithMessagef(err, "%%gopls set %s", key)
+			}
+		}
+	case "unset":
+		if len(args) == 1 {
+			return errors.New("%gopls unset expects one or more keys")
+		}
+		for _, key := range args[1:] {
+			if err := goExec.SetGoplsSetting(key, nil); err != nil {
+				return errors.WithMessagef(err, "%%gopls unset %s", key)
+			}
+		}
+	case "reset":
+		return goExec.ResetGoplsSettings()
+	case "settings":
+		return listGoplsSettings(msg, goExec)
+	case "status":
+		return goplsStatus(msg, goExec)
+	default:
+		return errors.Errorf("%%gopls %s not supported, use one of set, unset, reset, settings or status", args[0])
+	}
+	return nil
+}
+
+// listGoplsSettings displays the settings of `gopls` configured with `%gopls set`.
+func listGoplsSettings(msg kernel.Message, goExec *goexec.State) error {
+	settings := goExec.GoplsSettings()
+	if len(settings) == 0 {
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout, "No gopls settings configured.\n")
+	}
+	contents, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "%gopls settings")
+	}
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout, string(contents)+"\n")
+}
+
+// goplsStatus displays the status of `gopls`, its memory use and the statistics of the requests sent to it.
+func goplsStatus(msg kernel.Message, goExec *goexec.State) error {
+	status, ok := goExec.GoplsStatus()
+	if !ok {
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout, "gopls is not available.\n")
+	}
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "## gopls\n\n| | |\n|---|---|\n| Status | %s |\n", status)
+	if status.PID != 0 {
+		_, _ = fmt.Fprintf(&sb, "| PID | %d |\n", status.PID)
+		if rss, err := goplsclient.MemoryRSS(status.PID); err == nil {
+			_, _ = fmt.Fprintf(&sb, "| Memory (RSS) | %.1f MiB |\n", float64(rss)/(1<<20))
+		} else {
+			_, _ = fmt.Fprintf(&sb, "| Memory (RSS) | ⚠️ %s |\n", err)
+		}
+	}
+	if len(status.RPC) > 0 {
+		sb.WriteString("\n| Request | Calls | Errors | Timeouts | Average latency |\n|---|---|---|---|---|\n")
+		methods := make([]string, 0, len(status.RPC))
+		for method := range status.RPC {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			stats := status.RPC[method]
+			_, _ = fmt.Fprintf(&sb, "| `%s` | %d | %d | %d | %s |\n", method, stats.Calls, stats.Errors,
+				stats.Timeouts, stats.AverageLatency())
+		}
+	}
+	return kernel.PublishMarkdown(msg, sb.String())
+}
@@ -0,0 +1,69 @@
+package specialcmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%goproxy`: the configuration of the Go module proxy, and the statistics of the Go
+// module cache.
+
+// execGoProxy implements `%goproxy [<url>|off|direct|stats]`.
+func execGoProxy(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) == 0 {
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			fmt.Sprintf("GOPROXY=%q\n", goexec.GoEnv("GOPROXY")))
+	}
+	if len(args) > 1 {
+		return errors.Errorf("%%goproxy takes one argument (a URL, `off`, `direct` or `stats`), got %q", args)
+	}
+	if args[0] == "stats" {
+		stats, err := goExec.GoProxyStats()
+		if err != nil {
+			return errors.WithMessage(err, "%goproxy stats")
+		}
+		return kernel.PublishMarkdown(msg, goProxyStatsMarkdown(stats))
+	}
+	if err := goexec.SetGoProxy(args[0]); err != nil {
+		return errors.WithMessage(err, "%goproxy")
+	}
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout, fmt.Sprintf("Set GOPROXY=%q\n", args[0]))
+}
+
+// goProxyStatsMarkdown renders the report of `%goproxy stats`.
+func goProxyStatsMarkdown(stats *goexec.GoProxyStats) string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "### Go module cache\n\n- GOPROXY: `%s`\n- GOMODCACHE: `%s` (%s of downloaded modules)\n\n",
+		stats.GoProxy, stats.ModCache, formatBytes(stats.CacheSize))
+	sb.WriteString("| | Modules | Size |\n|---|---|---|\n")
+	_, _ = fmt.Fprintf(&sb, "| Hits (already in the cache) | %d | %s |\n", len(stats.Hits), formatBytes(stats.HitsSize()))
+	_, _ = fmt.Fprintf(&sb, "| Misses (downloaded in this session) | %d | %s |\n", len(stats.Misses), formatBytes(stats.MissesSize()))
+	if len(stats.Missing) > 0 {
+		_, _ = fmt.Fprintf(&sb, "| Not downloaded yet | %d | |\n", len(stats.Missing))
+	}
+	if len(stats.Misses) > 0 {
+		sb.WriteString("\n**Downloaded in this session:**\n\n| Module | Version | Size |\n|---|---|---|\n")
+		for _, m := range stats.Misses {
+			_, _ = fmt.Fprintf(&sb, "| `%s` | `%s` | %s |\n", m.Path, m.Version.Version, formatBytes(m.Size))
+		}
+	}
+	return sb.String()
+}
+
+// formatBytes formats a size in bytes in a human-readable form.
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exp := float64(size)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[exp])
+}
@@ -0,0 +1,67 @@
+package specialcmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%gowork use|drop|list`, which edits the kernel's `go.work` file.
+
+// execGoWork implements `%gowork use <dir>...`, `%gowork drop <dir>...` and `%gowork list`.
+// After changes, the resulting `go.work` is displayed.
+func execGoWork(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) == 0 {
+		return errors.New("%gowork expects `use <dir>...`, `drop <dir>...` or `list`")
+	}
+	switch args[0] {
+	case "use", "drop":
+		if len(args) == 1 {
+			return errors.Errorf("%%gowork %s expects one or more directories", args[0])
+		}
+		var err error
+		if args[0] == "use" {
+			err = goExec.GoWorkAdd(args[1:])
+		} else {
+			err = goExec.GoWorkDrop(args[1:])
+		}
+		if err != nil {
+			return errors.WithMessagef(err, "%%gowork %s", args[0])
+		}
+		return execShow(msg, goExec, []string{"go.work"})
+	case "list":
+		if len(args) != 1 {
+			return errors.New("%gowork list takes no arguments")
+		}
+		return listGoWorkUses(msg, goExec)
+	default:
+		return errors.Errorf("%%gowork %s not supported, use one of use, drop or list", args[0])
+	}
+}
+
+// listGoWorkUses displays the `use` rules of the kernel's `go.work`, with the corresponding modules.
+func listGoWorkUses(msg kernel.Message, goExec *goexec.State) error {
+	uses, err := goExec.GoWorkUses()
+	if err != nil {
+		return err
+	}
+	if uses == nil {
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			"No `go.work` file, create one with `%gowork use <dir>`.\n")
+	}
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "## `%s`\n\n| Directory | Module |\n|---|---|\n", goExec.GoWorkPath())
+	for _, use := range uses {
+		module := use.Module
+		if module == "" {
+			module = "⚠️ no `go.mod` found"
+		} else {
+			module = "`" + module + "`"
+		}
+		_, _ = fmt.Fprintf(&sb, "| `%s` | %s |\n", use.Path, module)
+	}
+	return kernel.PublishMarkdown(msg, sb.String())
+}
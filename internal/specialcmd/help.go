@@ -0,0 +1,32 @@
+package specialcmd
+
+import (
+	"embed"
+	"fmt"
+
+	"github.com/janpfeifer/gonb/internal/i18n"
+	"k8s.io/klog/v2"
+)
+
+// This file implements the localization of the `%help` page: translations are in `help_<lang>.md` files,
+// see package i18n.
+
+//go:embed help_*.md
+var localizedHelpFS embed.FS
+
+// Help returns the help page in the language selected (see i18n.Language).
+//
+// Translated pages only cover the main commands, so they are followed by the full reference in English,
+// [HelpMessage].
+func Help() string {
+	lang := i18n.Language()
+	if lang == i18n.DefaultLanguage {
+		return HelpMessage
+	}
+	localized, err := localizedHelpFS.ReadFile(fmt.Sprintf("help_%s.md", lang))
+	if err != nil {
+		klog.V(1).Infof("No %%help translation for language %q: %v", lang, err)
+		return HelpMessage
+	}
+	return fmt.Sprintf("%s\n---\n\n_%s:_\n\n%s", localized, i18n.T(i18n.MsgHelpFullReference), HelpMessage)
+}
@@ -0,0 +1,294 @@
+package specialcmd
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements a registry of the special commands, parsed from the help page (help.md), used by
+// `%help <cmd>`, `%help -s <keyword>`, and by the auto-complete and contextual help of special commands.
+//
+// The help page is parsed into blocks: items of a list, paragraphs and sub-sections (headed by "####" or
+// by "###" with a command in its title). The commands documented in a block are the ones quoted (with "`")
+// in the first line of an item of a list, at the start of a paragraph, or in the title of a sub-section.
+
+// HelpEntry is a block of the help page.
+type HelpEntry struct {
+	// Section is the title of the section of the help page where the entry is.
+	Section string
+
+	// Commands documented by the entry, as typed, e.g.: "%list", "%ls", "%%writefile", "!*".
+	Commands []string
+
+	// Text of the entry, in Markdown.
+	Text string
+}
+
+// helpSection is a section ("###") of the help page.
+type helpSection struct {
+	Title   string
+	Entries []*HelpEntry
+
+	// Examples are the code blocks in the section.
+	Examples []string
+}
+
+var (
+	helpSectionsOnce sync.Once
+	helpSections     []*helpSection
+)
+
+// getHelpSections returns the help page parsed into sections and entries. It is parsed only once.
+func getHelpSections() []*helpSection {
+	helpSectionsOnce.Do(func() {
+		helpSections = parseHelp(HelpMessage)
+	})
+	return helpSections
+}
+
+var (
+	reHelpCommand = regexp.MustCompile("`((?:%%?|!\\*?)[a-zA-Z0-9_]*)[^`]*`")
+	reHelpHeader  = regexp.MustCompile(`^(#{2,4}) +(.*)$`)
+)
+
+// parseHelp parses the help page (in Markdown) into sections and entries.
+func parseHelp(helpMarkdown string) (sections []*helpSection) {
+	section := &helpSection{}
+	sections = append(sections, section)
+	var current *HelpEntry
+	var block []string
+	inCode := false
+	flush := func() {
+		if current != nil && len(block) > 0 {
+			current.Text = strings.TrimSpace(strings.Join(block, "\n"))
+			section.Entries = append(section.Entries, current)
+		}
+		current, block = nil, nil
+	}
+	newEntry := func(commandsLine string) {
+		flush()
+		current = &HelpEntry{Section: section.Title, Commands: helpCommandsIn(commandsLine)}
+	}
+
+	var code []string
+	for _, line := range strings.Split(helpMarkdown, "\n") {
+		// Sub-sections include everything until the next header: paragraphs and code blocks.
+		isSubSection := current != nil && len(block) > 0 && strings.HasPrefix(block[0], "#")
+		if strings.HasPrefix(line, "```") {
+			if inCode {
+				code = append(code, line)
+				section.Examples = append(section.Examples, strings.Join(code, "\n"))
+				code = nil
+			} else {
+				code = []string{line}
+			}
+			inCode = !inCode
+			if isSubSection {
+				block = append(block, line)
+			}
+			continue
+		}
+		if inCode {
+			code = append(code, line)
+			if isSubSection {
+				block = append(block, line)
+			}
+			continue
+		}
+
+		if matches := reHelpHeader.FindStringSubmatch(line); matches != nil {
+			title := strings.TrimSpace(matches[2])
+			if len(matches[1]) <= 3 {
+				flush()
+				section = &helpSection{Title: title}
+				sections = append(sections, section)
+				if len(matches[1]) == 2 || !strings.Contains(title, "`") {
+					continue
+				}
+			}
+			// Sub-sections (or sections about a command) are an entry on their own.
+			newEntry(title)
+			block = append(block, line)
+			continue
+		}
+
+		switch {
+		case isSubSection:
+			// Sub-sections include everything until the next header.
+			if strings.HasPrefix(line, "`%") {
+				current.Commands = append(current.Commands, helpCommandsIn(line[:strings.Index(line+": ", ": ")])...)
+			}
+			block = append(block, line)
+		case strings.HasPrefix(line, "- "):
+			// New item of a list.
+			newEntry(line[:strings.Index(line+": ", ": ")])
+			block = append(block, line)
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || current != nil:
+			// Continuation of the current entry.
+			if current == nil {
+				newEntry(line)
+			}
+			block = append(block, line)
+		default:
+			// New paragraph: it documents commands only if it starts with them.
+			newEntry("")
+			if strings.HasPrefix(line, "`") {
+				current.Commands = helpCommandsIn(line[:strings.Index(line+": ", ": ")])
+			}
+			block = append(block, line)
+		}
+	}
+	flush()
+	return sections
+}
+
+// helpCommandsIn returns the commands quoted in the text.
+func helpCommandsIn(text string) (commands []string) {
+	for _, match := range reHelpCommand.FindAllStringSubmatch(text, -1) {
+		if !slices.Contains(commands, match[1]) {
+			commands = append(commands, match[1])
+		}
+	}
+	return commands
+}
+
+// normalizeHelpCommand returns the command without the "%" prefixes (except for "%%" itself), so `%help track`,
+// `%help %track` and `%help %%track` are all the same.
+func normalizeHelpCommand(command string) string {
+	command = strings.TrimPrefix(command, "//gonb:")
+	if trimmed := strings.TrimLeft(command, "%"); trimmed != "" {
+		return trimmed
+	}
+	return command
+}
+
+// HelpCommands returns the (normalized) names of all the commands documented in the help page, sorted.
+func HelpCommands() []string {
+	var commands []string
+	for _, section := range getHelpSections() {
+		for _, entry := range section.Entries {
+			for _, command := range entry.Commands {
+				command = normalizeHelpCommand(command)
+				if !slices.Contains(commands, command) {
+					commands = append(commands, command)
+				}
+			}
+		}
+	}
+	slices.Sort(commands)
+	return commands
+}
+
+// CommandHelp returns the help of the given command (with or without the "%" prefix), in Markdown: the entries
+// that document it, along with the title of their section and the examples in the section.
+// It returns false if the command is not documented.
+func CommandHelp(command string) (string, bool) {
+	command = normalizeHelpCommand(command)
+	var parts []string
+	for _, section := range getHelpSections() {
+		var texts []string
+		for _, entry := range section.Entries {
+			if slices.ContainsFunc(entry.Commands, func(c string) bool { return normalizeHelpCommand(c) == command }) {
+				texts = append(texts, entry.Text)
+			}
+		}
+		if len(texts) == 0 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("### %s\n\n%s", section.Title, strings.Join(texts, "\n\n")))
+		var examples []string
+		for _, example := range section.Examples {
+			if !slices.ContainsFunc(texts, func(text string) bool { return strings.Contains(text, example) }) {
+				examples = append(examples, example)
+			}
+		}
+		if len(examples) > 0 {
+			parts = append(parts, "**Examples:**\n\n"+strings.Join(examples, "\n\n"))
+		}
+	}
+	if len(parts) == 0 {
+		return "", false
+	}
+	return strings.Join(parts, "\n\n"), true
+}
+
+// LineHelp returns the help for the special command in the line: the help of the command if it is documented,
+// otherwise the whole help page.
+func LineHelp(line string) string {
+	line = goexec.TrimGonbCommentPrefix(strings.TrimSpace(line))
+	var command string
+	switch {
+	case strings.HasPrefix(line, "!*"):
+		command = "!*"
+	case strings.HasPrefix(line, "!"):
+		command = "!"
+	default:
+		command, _, _ = strings.Cut(line, " ")
+	}
+	if commandHelp, found := CommandHelp(command); found {
+		return commandHelp
+	}
+	return Help()
+}
+
+// SearchHelp returns the entries of the help page that contain the keyword (case-insensitive), in Markdown,
+// grouped by section. It returns false if nothing was found.
+func SearchHelp(keyword string) (string, bool) {
+	keyword = strings.ToLower(keyword)
+	var parts []string
+	for _, section := range getHelpSections() {
+		var texts []string
+		for _, entry := range section.Entries {
+			if strings.Contains(strings.ToLower(entry.Text), keyword) {
+				texts = append(texts, entry.Text)
+			}
+		}
+		if len(texts) == 0 {
+			continue
+		}
+		title := section.Title
+		if title == "" {
+			title = "GoNB"
+		}
+		parts = append(parts, fmt.Sprintf("### %s\n\n%s", title, strings.Join(texts, "\n\n")))
+	}
+	if len(parts) == 0 {
+		return "", false
+	}
+	return strings.Join(parts, "\n\n"), true
+}
+
+// execHelp implements `%help`, `%help <cmd>` and `%help -s <keyword>`. The parameter `args` excludes "%help".
+func execHelp(msg kernel.Message, args []string) error {
+	if len(args) == 0 {
+		return kernel.PublishMarkdown(msg, Help())
+	}
+	if args[0] == "-s" || args[0] == "--search" {
+		if len(args) == 1 {
+			return errors.Errorf("%%help %s requires a keyword to search", args[0])
+		}
+		keyword := strings.Join(args[1:], " ")
+		found, ok := SearchHelp(keyword)
+		if !ok {
+			return errors.Errorf("nothing found in %%help for %q", keyword)
+		}
+		return kernel.PublishMarkdown(msg, found)
+	}
+	if len(args) > 1 {
+		return errors.Errorf("%%help takes at most one command, got %q -- use `%%help -s <keyword>` to search", args)
+	}
+	commandHelp, ok := CommandHelp(args[0])
+	if !ok {
+		return errors.Errorf("no help for %q, use `%%help -s %s` to search for it", args[0], args[0])
+	}
+	return kernel.PublishMarkdown(msg, commandHelp)
+}
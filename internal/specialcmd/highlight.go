@@ -0,0 +1,133 @@
+package specialcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"go/scanner"
+	"go/token"
+	"html"
+	"strings"
+)
+
+// This file implements a simple syntax highlighter of Go code in HTML, and the `%highlight` command, which
+// displays Go code highlighted by the front-end and by GoNB, to check that highlighting works.
+
+const highlightStyle = `<style>
+.gonb-hl-keyword { color: #0000c0; font-weight: bold; }
+.gonb-hl-builtin { color: #007020; }
+.gonb-hl-string { color: #a31515; }
+.gonb-hl-number { color: #098658; }
+.gonb-hl-comment { color: #6a737d; font-style: italic; }
+</style>
+`
+
+// highlightSample is the code displayed by `%highlight` if none is given.
+const highlightSample = `// Greet returns a greeting.
+func Greet(name string, times int) (s string) {
+	for i := 0; i < times; i++ {
+		s += fmt.Sprintf("Hello, %s! %c", name, '\n')
+	}
+	return
+}`
+
+// execHighlight implements `%highlight [<code>]`: it displays the code (or a sample) highlighted as Markdown,
+// which is highlighted by the front-end (JupyterLab, nbviewer, nbconvert), and highlighted by GoNB in HTML,
+// along with the language information GoNB reports to the front-end.
+func execHighlight(msg kernel.Message, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		code = highlightSample
+	}
+	err := kernel.PublishMarkdown(msg, "**Highlighted by the front-end:**\n\n```go\n"+code+"\n```\n")
+	if err != nil {
+		return err
+	}
+	languageInfo, err := json.MarshalIndent(kernel.GoLanguageInfo(), "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode language information")
+	}
+	return kernel.PublishHtml(msg, fmt.Sprintf("%s<b>Highlighted by GoNB:</b><pre>%s</pre>"+
+		"<details><summary>Language information reported to the front-end</summary><pre>%s</pre></details>",
+		highlightStyle, strings.Join(highlightGo(code), "\n"), html.EscapeString(string(languageInfo))))
+}
+
+// goBuiltins are the predeclared identifiers highlighted.
+var goBuiltins = map[string]bool{
+	"true": true, "false": true, "nil": true, "iota": true,
+	"bool": true, "byte": true, "rune": true, "string": true, "error": true, "any": true, "comparable": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"float32": true, "float64": true, "complex64": true, "complex128": true,
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true, "copy": true, "delete": true,
+	"imag": true, "len": true, "make": true, "max": true, "min": true, "new": true, "panic": true,
+	"print": true, "println": true, "real": true, "recover": true,
+}
+
+// highlightGo returns the HTML of each line of the Go code, with its tokens wrapped in spans with
+// the classes `gonb-hl-*`. Invalid code is highlighted on a best-effort basis.
+func highlightGo(code string) []string {
+	src := []byte(code)
+	fileSet := token.NewFileSet()
+	file := fileSet.AddFile("", fileSet.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, src, func(token.Position, string) {}, scanner.ScanComments)
+
+	var sb strings.Builder
+	// writeSpan writes text wrapped in a span, closing and re-opening it at new lines, so each line is
+	// self-contained.
+	writeSpan := func(class, text string) {
+		for ii, line := range strings.Split(text, "\n") {
+			if ii > 0 {
+				sb.WriteString("\n")
+			}
+			if line == "" {
+				continue
+			}
+			if class == "" {
+				sb.WriteString(html.EscapeString(line))
+			} else {
+				fmt.Fprintf(&sb, `<span class="gonb-hl-%s">%s</span>`, class, html.EscapeString(line))
+			}
+		}
+	}
+	offset := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			// Automatically inserted semicolon, not in the source.
+			continue
+		}
+		start := file.Offset(pos)
+		if start < offset {
+			continue
+		}
+		text := lit
+		if text == "" {
+			text = tok.String()
+		}
+		end := min(start+len(text), len(src))
+		writeSpan("", code[offset:start]) // Whitespace between tokens.
+		var class string
+		switch {
+		case tok.IsKeyword():
+			class = "keyword"
+		case tok == token.STRING || tok == token.CHAR:
+			class = "string"
+		case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+			class = "number"
+		case tok == token.COMMENT:
+			class = "comment"
+		case tok == token.IDENT && goBuiltins[lit]:
+			class = "builtin"
+		}
+		writeSpan(class, code[start:end])
+		offset = end
+	}
+	writeSpan("", code[offset:])
+	return strings.Split(sb.String(), "\n")
+}
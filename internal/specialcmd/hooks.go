@@ -0,0 +1,97 @@
+package specialcmd
+
+import (
+	"fmt"
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"html"
+	"k8s.io/klog/v2"
+	"strings"
+)
+
+// hookCommands are the special commands that can be used as hooks: hooks run in the middle of a cell
+// execution, so only commands that don't change the state of the kernel (definitions, workspace, flags,
+// cell configuration, etc.) are allowed. Shell commands (`!...`) are always allowed.
+var hookCommands = SetWithValues("clear", "deps", "diffstate", "doc", "doctor", "env", "git", "help", "highlight",
+	"list", "ls", "make", "show", "task", "version")
+
+// checkHookCommand returns an error if cmdLine can't be used as a hook.
+func checkHookCommand(cmdLine string) error {
+	if cmdLine == "" || cmdLine[0] == '!' {
+		return nil
+	}
+	fields := strings.Fields(cmdLine[1:])
+	if len(fields) == 0 || !hookCommands.Has(fields[0]) {
+		return errors.Errorf("%%hook: %q may change the state of the kernel while a cell is executing, and can't be used as a hook; "+
+			"only shell commands (`!...`) and the special commands %%%s are allowed",
+			cmdLine, strings.Join(SortedKeys(hookCommands), ", %"))
+	}
+	return nil
+}
+
+// execHook executes the `%hook` special command, as well as its aliases `%pre_run` and `%post_run`.
+//
+// The parameter `args` is the raw string after the command name (not split), since the hook
+// command line is stored verbatim.
+func execHook(msg kernel.Message, goExec *goexec.State, args string) error {
+	args = strings.TrimSpace(args)
+	if args == "" || args == "list" {
+		listHooks(msg, goExec)
+		return nil
+	}
+	kindStr, cmdLine, _ := strings.Cut(args, " ")
+	cmdLine = strings.TrimSpace(cmdLine)
+	if kindStr == "reset" {
+		return goExec.ResetHooks(goexec.HookKind(cmdLine))
+	}
+	if cmdLine == "" {
+		return errors.Errorf("%%hook %s requires a special command (`%%...`) or a shell command (`!...`) to execute", kindStr)
+	}
+	if cmdLine[0] != '%' && cmdLine[0] != '!' {
+		return errors.Errorf("%%hook %s: only special commands (`%%...`) or shell commands (`!...`) can be used as hooks, got %q", kindStr, cmdLine)
+	}
+	if err := checkHookCommand(cmdLine); err != nil {
+		return err
+	}
+	if err := goExec.AddHook(goexec.HookKind(kindStr), cmdLine); err != nil {
+		return err
+	}
+	goExec.HookRunner = func(msg kernel.Message, cmdLine string) error {
+		if err := checkHookCommand(cmdLine); err != nil {
+			return err
+		}
+		return Parse(msg, goExec, true, []string{cmdLine}, MakeSet[int]())
+	}
+	return nil
+}
+
+// listHooks displays the currently registered hooks.
+func listHooks(msg kernel.Message, goExec *goexec.State) {
+	if len(goExec.PreRunHooks) == 0 && len(goExec.PostRunHooks) == 0 {
+		err := kernel.PublishHtml(msg, "<b>No hooks registered</b>\n")
+		if err != nil {
+			klog.Errorf("Failed to publish hooks list back to jupyter: %+v", err)
+		}
+		return
+	}
+	var htmlParts []string
+	for _, entry := range []struct {
+		title string
+		hooks []string
+	}{{"Pre-run hooks", goExec.PreRunHooks}, {"Post-run hooks", goExec.PostRunHooks}} {
+		if len(entry.hooks) == 0 {
+			continue
+		}
+		htmlParts = append(htmlParts, fmt.Sprintf("<b>%s:</b>", entry.title), "<ul>")
+		for _, hook := range entry.hooks {
+			htmlParts = append(htmlParts, "<li><pre>"+html.EscapeString(hook)+"</pre></li>")
+		}
+		htmlParts = append(htmlParts, "</ul>")
+	}
+	err := kernel.PublishHtml(msg, strings.Join(htmlParts, "\n")+"\n")
+	if err != nil {
+		klog.Errorf("Failed to publish hooks list back to jupyter: %+v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package specialcmd
+
+import (
+	"fmt"
+	"github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"html"
+	"strings"
+)
+
+// execImport implements `%import add <path> [as <alias>]`, `%import rm <alias|path>...` and `%import list`.
+// The parameter `args` excludes "%import".
+func execImport(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) == 0 || (args[0] == "list" && len(args) == 1) {
+		return listImports(msg, goExec)
+	}
+	switch args[0] {
+	case "add":
+		var importPath, alias string
+		switch {
+		case len(args) == 2:
+			importPath = args[1]
+		case len(args) == 4 && args[2] == "as":
+			importPath, alias = args[1], args[3]
+		default:
+			return errors.Errorf("%%import add expects `<path> [as <alias>]`, got %q", args[1:])
+		}
+		importDecl, err := goExec.AddImport(importPath, alias)
+		if err != nil {
+			return err
+		}
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			fmt.Sprintf(". added import %s %q\n", importDecl.Key, importDecl.Path))
+	case "rm", "remove":
+		if len(args) == 1 {
+			return errors.Errorf("%%import rm requires the alias or path of the imports to remove")
+		}
+		for _, keyOrPath := range args[1:] {
+			importDecl, err := goExec.RemoveImport(keyOrPath)
+			if err != nil {
+				return err
+			}
+			err = kernel.PublishWriteStream(msg, kernel.StreamStdout,
+				fmt.Sprintf(". removed import %s %q\n", importDecl.Key, importDecl.Path))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return errors.Errorf("%%import %s not supported, use one of list, add or rm", args[0])
+	}
+}
+
+// listImports displays the memorized imports.
+func listImports(msg kernel.Message, goExec *goexec.State) error {
+	imports := goExec.Definitions.Imports
+	if len(imports) == 0 {
+		return kernel.PublishHtml(msg, "<b>No memorized imports</b>\n")
+	}
+	parts := []string{"<table>", "<tr><th>Key</th><th>Alias</th><th>Path</th></tr>"}
+	for _, key := range common.SortedKeys(imports) {
+		importDecl := imports[key]
+		parts = append(parts, fmt.Sprintf("<tr><td>%s</td><td>%s</td><td style=\"text-align: left\"><code>%s</code></td></tr>",
+			html.EscapeString(key), html.EscapeString(importDecl.Alias), html.EscapeString(importDecl.Path)))
+	}
+	parts = append(parts, "</table>")
+	return kernel.PublishHtml(msg, strings.Join(parts, "\n")+"\n")
+}
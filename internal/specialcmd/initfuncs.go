@@ -0,0 +1,53 @@
+package specialcmd
+
+import (
+	"fmt"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"html"
+	"strings"
+)
+
+// execInit implements `%init list` and `%init order <name1>,<name2>,...`.
+// The parameter `args` excludes "%init".
+func execInit(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) == 0 || (args[0] == "list" && len(args) == 1) {
+		return listInitFunctions(msg, goExec)
+	}
+	if args[0] != "order" {
+		return errors.Errorf("%%init %s not supported, use `list` or `order <name1>,<name2>,...`", args[0])
+	}
+	var names []string
+	for _, arg := range args[1:] {
+		for _, name := range strings.Split(arg, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	if err := goExec.SetInitOrder(names); err != nil {
+		return err
+	}
+	return listInitFunctions(msg, goExec)
+}
+
+// listInitFunctions displays the memorized `init_*` functions in the order they are executed,
+// with the cell where they were defined.
+func listInitFunctions(msg kernel.Message, goExec *goexec.State) error {
+	keys := goExec.Definitions.InitFunctionKeys()
+	if len(keys) == 0 {
+		return kernel.PublishHtml(msg, "<b>No memorized <code>init_*</code> functions</b>\n")
+	}
+	parts := []string{"<table>", "<tr><th>Order</th><th>Function</th><th>Cell</th></tr>"}
+	for ii, key := range keys {
+		cell := "-"
+		if cellId := goExec.Definitions.Functions[key].CellLines.Id; cellId != -1 {
+			cell = fmt.Sprintf("[%d]", cellId)
+		}
+		parts = append(parts, fmt.Sprintf("<tr><td>%d</td><td><code>%s</code></td><td>%s</td></tr>",
+			ii+1, html.EscapeString(key), cell))
+	}
+	parts = append(parts, "</table>")
+	return kernel.PublishHtml(msg, strings.Join(parts, "\n")+"\n")
+}
@@ -0,0 +1,42 @@
+package specialcmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%listen`: listening sockets owned by the kernel, inherited by the cell programs.
+
+// execListen implements `%listen [<name> <address> | --close <name>]`.
+func execListen(msg kernel.Message, goExec *goexec.State, args []string) error {
+	switch {
+	case len(args) == 0:
+		listeners := goExec.Listeners()
+		if len(listeners) == 0 {
+			return kernel.PublishMarkdown(msg, "No listeners, create one with `%listen <name> <address>`.")
+		}
+		var sb strings.Builder
+		sb.WriteString("| Name | Network | Address |\n|---|---|---|\n")
+		for _, info := range listeners {
+			_, _ = fmt.Fprintf(&sb, "| `%s` | %s | `%s` |\n", info.Name, info.Network, info.Address)
+		}
+		return kernel.PublishMarkdown(msg, sb.String())
+	case len(args) == 2 && (args[0] == "--close" || args[0] == "-close"):
+		return goExec.CloseListener(args[1])
+	case len(args) == 2 && !strings.HasPrefix(args[0], "-"):
+		info, err := goExec.Listen(args[0], args[1])
+		if err != nil {
+			return errors.WithMessage(err, "%listen")
+		}
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			fmt.Sprintf("Listening on %s %s: use `gonbui.Listener(%q)` in the cells to serve on it.\n",
+				info.Network, info.Address, info.Name))
+	default:
+		return errors.Errorf("invalid %%listen arguments %q: use `%%listen <name> <address>`, `%%listen --close <name>` "+
+			"or `%%listen` to list the listeners", args)
+	}
+}
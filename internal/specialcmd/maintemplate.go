@@ -0,0 +1,39 @@
+package specialcmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%template`, to configure the template of the `main` function composed for `%%` cells.
+
+// execTemplate implements `%template [<file>|--reset]`.
+func execTemplate(msg kernel.Message, goExec *goexec.State, args []string) error {
+	switch {
+	case len(args) == 0:
+		return kernel.PublishMarkdown(msg, fmt.Sprintf("Template of the `main` function (the cell is inserted at `%s`):\n\n```go\n%s\n```\n",
+			goexec.MainTemplateCellMarker, goExec.MainTemplate()))
+	case len(args) > 1:
+		return errors.Errorf("%%template takes at most one argument, use `%%template [<file>|--reset]`, got %q", args)
+	case args[0] == "--reset" || args[0] == "-reset":
+		source, err := goExec.ResetMainTemplate()
+		if err != nil {
+			return errors.WithMessage(err, "%template --reset")
+		}
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout, fmt.Sprintf("Template of the main function reset (%s).\n", source))
+	}
+	filePath := common.ReplaceTildeInDir(args[0])
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "%%template: failed to read %q", filePath)
+	}
+	if err = goExec.SetMainTemplate(string(contents)); err != nil {
+		return errors.WithMessagef(err, "%%template %q", filePath)
+	}
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout, fmt.Sprintf("Template of the main function loaded from %q.\n", filePath))
+}
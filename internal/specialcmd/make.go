@@ -0,0 +1,123 @@
+package specialcmd
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/janpfeifer/gonb/internal/jpyexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// This file implements `%make` and `%task`, convenience wrappers to run `make` and `task` (https://taskfile.dev/)
+// targets in the notebook's current directory.
+
+var (
+	// makefileNames in the order searched by GNU make.
+	makefileNames = []string{"GNUmakefile", "makefile", "Makefile"}
+
+	// taskfileNames in the order searched by `task`.
+	taskfileNames = []string{"Taskfile.yml", "taskfile.yml", "Taskfile.yaml", "taskfile.yaml",
+		"Taskfile.dist.yml", "taskfile.dist.yml", "Taskfile.dist.yaml", "taskfile.dist.yaml"}
+
+	// regexpMakeTarget matches rules in a Makefile, but not variable assignments (`:=`, `::=`).
+	regexpMakeTarget = regexp.MustCompile(`^([a-zA-Z0-9_][^:=#%$\s]*(?:\s+[a-zA-Z0-9_][^:=#%$\s]*)*)\s*::?(?:[^=:]|$)`)
+
+	// regexpTaskName matches the name of a task in a Taskfile, already stripped of indentation.
+	regexpTaskName = regexp.MustCompile(`^([a-zA-Z0-9_][a-zA-Z0-9_:.\-]*)\s*:`)
+)
+
+// execMake runs `make` or `task` (given by tool) with the given args (targets and flags) in the current directory.
+// The output is streamed to the notebook, and the whole process group is interrupted if the cell is interrupted.
+func execMake(msg kernel.Message, tool string, args []string) error {
+	toolPath, err := exec.LookPath(tool)
+	if err != nil {
+		return errors.Wrapf(err, "%%%s requires the program %q to be installed and in the PATH", tool, tool)
+	}
+	return jpyexec.New(msg, toolPath, args...).
+		ExecutionCount(msg.Kernel().ExecCounter()).
+		InProcessGroup().
+		Exec()
+}
+
+// findFirstFile returns the contents of the first file in names that exist in the current directory.
+func findFirstFile(names []string) []byte {
+	for _, name := range names {
+		contents, err := os.ReadFile(name)
+		if err == nil {
+			return contents
+		}
+	}
+	return nil
+}
+
+// MakeTargets returns the sorted targets defined in the Makefile in the current directory.
+// It's a simple parser, and it doesn't include targets of included Makefiles or generated by
+// variables.
+func MakeTargets() []string {
+	return parseMakeTargets(findFirstFile(makefileNames))
+}
+
+func parseMakeTargets(contents []byte) (targets []string) {
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+		matches := regexpMakeTarget.FindStringSubmatch(line)
+		if len(matches) < 2 {
+			continue
+		}
+		for _, target := range strings.Fields(matches[1]) {
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+	}
+	sort.Strings(targets)
+	return
+}
+
+// TaskTargets returns the sorted names of the tasks defined in the Taskfile in the current directory.
+// It's a simple line-based parser of the `tasks:` section, and it doesn't include tasks from included Taskfiles.
+func TaskTargets() []string {
+	return parseTaskTargets(findFirstFile(taskfileNames))
+}
+
+func parseTaskTargets(contents []byte) (targets []string) {
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	inTasks := false
+	taskIndent := -1
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		if indent == 0 {
+			inTasks = strings.HasPrefix(trimmed, "tasks:")
+			taskIndent = -1
+			continue
+		}
+		if !inTasks {
+			continue
+		}
+		if taskIndent == -1 {
+			// The first indented line defines the indentation of task names.
+			taskIndent = indent
+		}
+		if indent != taskIndent {
+			continue
+		}
+		if matches := regexpTaskName.FindStringSubmatch(trimmed); len(matches) == 2 {
+			targets = append(targets, matches[1])
+		}
+	}
+	sort.Strings(targets)
+	return
+}
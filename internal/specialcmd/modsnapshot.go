@@ -0,0 +1,65 @@
+package specialcmd
+
+import (
+	"fmt"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"html"
+	"strings"
+)
+
+// execModSnapshot implements `%modsnapshot save|restore <name>` and `%modsnapshot list`.
+// The parameter `args` excludes "%modsnapshot".
+func execModSnapshot(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) == 0 || (args[0] == "list" && len(args) == 1) {
+		return listModSnapshots(msg, goExec)
+	}
+	if len(args) != 2 {
+		return errors.Errorf("%%modsnapshot expects `list`, `save <name>` or `restore <name>`, got %q", args)
+	}
+	switch args[0] {
+	case "save":
+		var cellId int
+		if msg != nil {
+			cellId = msg.Kernel().ExecCounter()
+		}
+		snapshot, err := goExec.SaveModSnapshot(args[1], cellId)
+		if err != nil {
+			return err
+		}
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			fmt.Sprintf("Saved go.mod and go.sum (%d required modules) as snapshot %q\n", len(snapshot.Requires), snapshot.Name))
+	case "restore":
+		if err := goExec.RestoreModSnapshot(args[1]); err != nil {
+			return err
+		}
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			fmt.Sprintf("Restored go.mod and go.sum from snapshot %q\n", args[1]))
+	default:
+		return errors.Errorf("%%modsnapshot %s not supported, use one of list, save or restore", args[0])
+	}
+}
+
+// listModSnapshots displays the saved snapshots with their metadata.
+func listModSnapshots(msg kernel.Message, goExec *goexec.State) error {
+	snapshots, err := goExec.ListModSnapshots()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return kernel.PublishHtml(msg, "<b>No go.mod snapshots saved</b>\n")
+	}
+	parts := []string{"<table>", "<tr><th>Name</th><th>Saved at</th><th>Cell</th><th>Required modules</th></tr>"}
+	for _, snapshot := range snapshots {
+		requires := make([]string, 0, len(snapshot.Requires))
+		for _, req := range snapshot.Requires {
+			requires = append(requires, html.EscapeString(req))
+		}
+		parts = append(parts, fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>[%d]</td><td style=\"text-align: left\">%s</td></tr>",
+			html.EscapeString(snapshot.Name), snapshot.SavedAt.Format("2006-01-02 15:04:05"), snapshot.CellId,
+			strings.Join(requires, "<br/>")))
+	}
+	parts = append(parts, "</table>")
+	return kernel.PublishHtml(msg, strings.Join(parts, "\n")+"\n")
+}
@@ -0,0 +1,59 @@
+package specialcmd
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/janpfeifer/gonb/gonbui/protocol"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements `%page` and `%pager`: sending long textual outputs to the front-end pager.
+
+// execPage implements `%page <shell_cmd>`: it executes the shell command, and sends its output (standard output
+// and standard error) to the front-end pager. The parameter `args` is the command line after "%page".
+func execPage(msg kernel.Message, goExec *goexec.State, args string) error {
+	cmdStr := strings.TrimSpace(args)
+	if cmdStr == "" {
+		return errors.New("%page requires a shell command, e.g. `%page go doc -all fmt`")
+	}
+	var output bytes.Buffer
+	cmd := exec.Command("/bin/bash", "-c", cmdStr)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	klog.V(2).Infof("Executing %q for the pager", cmdStr)
+	err := cmd.Run()
+	goExec.Page(map[string]any{string(protocol.MIMETextPlain): output.String()})
+	if err != nil {
+		return errors.Wrapf(err, "failed to execute %q", cmdStr)
+	}
+	return nil
+}
+
+// execPager implements `%pager [<lines>|off]`: it configures the number of lines above which long outputs are
+// sent to the pager, or prints the current setting.
+func execPager(msg kernel.Message, goExec *goexec.State, args []string) error {
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && args[0] == "off":
+		goExec.PagerLines = 0
+	case len(args) == 1:
+		lines, err := strconv.Atoi(args[0])
+		if err != nil || lines <= 0 {
+			return errors.Errorf("%%pager takes the number of lines (a positive integer) or \"off\", got %q", args[0])
+		}
+		goExec.PagerLines = lines
+	default:
+		return errors.Errorf("%%pager takes at most one argument, got %q", args)
+	}
+	if goExec.PagerLines == 0 {
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout, "%pager off\n")
+	}
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout, fmt.Sprintf("%%pager %d\n", goExec.PagerLines))
+}
@@ -0,0 +1,60 @@
+package specialcmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%persist`: the values of the persisted variables are carried over from one cell to the next.
+
+// execPersist implements `%persist [--off] [<vars...>]`.
+func execPersist(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) == 0 {
+		return kernel.PublishMarkdown(msg, persistedVariablesMarkdown(goExec.PersistedVariables()))
+	}
+	if args[0] == "--off" || args[0] == "-off" {
+		if len(args) == 1 {
+			return errors.New("%persist --off expects the names of the variables to stop persisting")
+		}
+		for _, name := range args[1:] {
+			if err := goExec.UnpersistVariable(name); err != nil {
+				return errors.WithMessage(err, "%persist --off")
+			}
+		}
+		return nil
+	}
+	for _, name := range args {
+		if strings.HasPrefix(name, "-") {
+			return errors.Errorf("%%persist: unknown flag %q, use `%%persist [--off] <vars...>`", name)
+		}
+		if err := goExec.PersistVariable(name); err != nil {
+			return errors.WithMessage(err, "%persist")
+		}
+	}
+	return nil
+}
+
+// persistedVariablesMarkdown lists the persisted variables in a Markdown table.
+func persistedVariablesMarkdown(vars []goexec.PersistedVariable) string {
+	if len(vars) == 0 {
+		return "No persisted variables, use `%persist <vars...>` to carry the values of global variables over to the next cells."
+	}
+	var sb strings.Builder
+	sb.WriteString("| Variable | Type | Saved value |\n|---|---|---|\n")
+	for _, v := range vars {
+		typeName := "_unknown_"
+		if v.Type != "" {
+			typeName = "`" + escapeMarkdownTableCell(v.Type) + "`"
+		}
+		saved := "_not yet_"
+		if v.Size >= 0 {
+			saved = formatBytes(v.Size)
+		}
+		_, _ = fmt.Fprintf(&sb, "| `%s` | %s | %s |\n", v.Name, typeName, saved)
+	}
+	return sb.String()
+}
@@ -0,0 +1,59 @@
+package specialcmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%private`: the configuration and diagnostics of private modules.
+
+// execPrivate implements `%private <pattern>...`: it adds the module path patterns to GOPRIVATE and GONOSUMDB,
+// and reports the diagnostics of the credentials to fetch them. Without patterns, it reports the diagnostics
+// for the patterns already in GOPRIVATE.
+func execPrivate(msg kernel.Message, args []string) error {
+	patterns := args
+	if len(patterns) > 0 {
+		goPrivate, err := goexec.AddPrivateModules(patterns)
+		if err != nil {
+			return errors.WithMessage(err, "%private")
+		}
+		if err = kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			fmt.Sprintf("Set GOPRIVATE=GONOSUMDB=%q\n", goPrivate)); err != nil {
+			return err
+		}
+	} else {
+		for _, pattern := range strings.Split(goexec.GoEnv("GOPRIVATE"), ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				patterns = append(patterns, pattern)
+			}
+		}
+		if len(patterns) == 0 {
+			return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+				"GOPRIVATE is not set: use `%private <host>/<org>/*` to configure private modules.\n")
+		}
+	}
+
+	var sb strings.Builder
+	for _, pattern := range patterns {
+		_, _ = fmt.Fprintf(&sb, "### Private modules `%s`\n\n| Check | | Details | How to fix |\n|---|---|---|---|\n", pattern)
+		for _, check := range goexec.PrivateModuleChecks(pattern) {
+			status := "✅"
+			if !check.OK {
+				status = "⚠️"
+			}
+			_, _ = fmt.Fprintf(&sb, "| %s | %s | %s | %s |\n", check.Name, status,
+				escapeMarkdownTableCell(check.Detail), check.Fix)
+		}
+		sb.WriteString("\n")
+	}
+	return kernel.PublishMarkdown(msg, sb.String())
+}
+
+// escapeMarkdownTableCell escapes the characters that would break a Markdown table cell.
+func escapeMarkdownTableCell(text string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(text)
+}
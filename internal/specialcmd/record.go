@@ -0,0 +1,42 @@
+package specialcmd
+
+import (
+	"fmt"
+
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%record`: the recording of all the outputs of the session to a `.gonbrec` file, to be
+// replayed later with `gonb replay`.
+
+// execRecord implements `%record start <file.gonbrec>`, `%record stop` and `%record` (status).
+func execRecord(msg kernel.Message, args []string) error {
+	k := msg.Kernel()
+	switch {
+	case len(args) == 0:
+		filePath, numEvents := k.SessionRecording()
+		if filePath == "" {
+			return kernel.PublishWriteStream(msg, kernel.StreamStdout, "Not recording: use `%record start <file.gonbrec>`.\n")
+		}
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			fmt.Sprintf("Recording to %q: %d events so far.\n", filePath, numEvents))
+	case args[0] == "start" && len(args) == 2:
+		if err := k.StartSessionRecording(args[1]); err != nil {
+			return errors.WithMessage(err, "%record")
+		}
+		return nil
+	case args[0] == "stop" && len(args) == 1:
+		filePath, numEvents, err := k.StopSessionRecording()
+		if err != nil {
+			return errors.WithMessage(err, "%record")
+		}
+		if filePath == "" {
+			return errors.New("%record stop: not recording")
+		}
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			fmt.Sprintf("Recorded %d events to %q: replay them with `gonb replay %s`.\n", numEvents, filePath, filePath))
+	}
+	return errors.Errorf("invalid %%record arguments %q: use `%%record start <file.gonbrec>`, `%%record stop` "+
+		"or `%%record`", args)
+}
@@ -0,0 +1,51 @@
+package specialcmd
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%rename`: the renaming of a memorized declaration with `gopls`.
+
+// execRename implements `%rename <oldName> <newName>`: it renames the memorized declarations, and reports
+// the cells that should be updated accordingly.
+func execRename(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) != 2 {
+		return errors.New("%rename expects `<oldName> <newName>`, e.g. `%rename Point Vector` or `%rename Point.X Point.U`")
+	}
+	oldName, newName := args[0], args[1]
+	if oldType, _, isMember := strings.Cut(oldName, "."); isMember {
+		// Allow `%rename Point.X Point.U`, as well as `%rename Point.X U`.
+		newName = strings.TrimPrefix(newName, oldType+".")
+	}
+	result, err := goExec.Rename(oldName, newName)
+	if err != nil {
+		return errors.WithMessagef(err, "%%rename %s %s", args[0], args[1])
+	}
+
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "Renamed `%s` to `%s` in %d places of the memorized declarations.\n",
+		result.OldName, result.NewName, result.NumEdits)
+	if len(result.Cells) > 0 {
+		sb.WriteString("\nThe following cells should be updated accordingly, or they will re-define the old names " +
+			"when executed again:\n")
+		for _, cell := range result.Cells {
+			_, _ = fmt.Fprintf(&sb, "\n**In [%d]:**\n\n", cell.Id)
+			for _, lineNum := range SortedKeys(cell.Lines) {
+				_, _ = fmt.Fprintf(&sb, "- line %d: `%s`\n", lineNum+1, strings.TrimSpace(cell.Lines[lineNum]))
+			}
+		}
+	}
+	if len(result.IgnoredFiles) > 0 {
+		sb.WriteString("\nUses in the following files were **not** renamed:\n\n")
+		for _, filePath := range result.IgnoredFiles {
+			_, _ = fmt.Fprintf(&sb, "- `%s`\n", filePath)
+		}
+	}
+	return kernel.PublishMarkdown(msg, sb.String())
+}
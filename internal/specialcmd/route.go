@@ -0,0 +1,72 @@
+package specialcmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/jpyexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%route`: the destination of the named streams written by the programs with `gonbui.Stream`.
+
+// execRoute implements `%route [<name> -> <target>]` and `%route --reset`.
+// Without arguments, it lists the configured routes.
+func execRoute(msg kernel.Message, goExec *goexec.State, args []string) error {
+	switch {
+	case len(args) == 0:
+		return listRoutes(msg, goExec)
+	case len(args) == 1 && args[0] == "--reset":
+		goExec.StreamRoutes = nil
+		return nil
+	case len(args) == 3 && args[1] == "->":
+		args = []string{args[0], args[2]}
+	case len(args) == 2:
+	default:
+		return errors.Errorf("%%route takes `<name> -> <target>` or `--reset`, got %q", args)
+	}
+
+	name := args[0]
+	route, err := jpyexec.ParseStreamRoute(args[1])
+	if err != nil {
+		return errors.WithMessagef(err, "%%route %s", name)
+	}
+	if route.Kind == jpyexec.RouteFile {
+		// Files are relative to the current directory, which may be changed later with `%cd`.
+		route.Path, err = filepath.Abs(route.Path)
+		if err != nil {
+			return errors.Wrapf(err, "%%route %s: invalid path", name)
+		}
+	}
+	if route.Kind == jpyexec.RouteDisplay {
+		delete(goExec.StreamRoutes, name)
+		return nil
+	}
+	if goExec.StreamRoutes == nil {
+		goExec.StreamRoutes = make(map[string]jpyexec.StreamRoute)
+	}
+	goExec.StreamRoutes[name] = route
+	return nil
+}
+
+// listRoutes displays the configured routes of the named streams.
+func listRoutes(msg kernel.Message, goExec *goexec.State) error {
+	if len(goExec.StreamRoutes) == 0 {
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			"No routes configured: named streams are displayed in their own output block.\n")
+	}
+	names := make([]string, 0, len(goExec.StreamRoutes))
+	for name := range goExec.StreamRoutes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		_, _ = fmt.Fprintf(&sb, "%s -> %s\n", name, goExec.StreamRoutes[name])
+	}
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout, sb.String())
+}
@@ -0,0 +1,59 @@
+package specialcmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements the cell dependencies: `%label`, `%requires` and `%run_needed`.
+
+// execLabel implements `%label <labels...>` (or `%%label`): it records that the cell with the labels ran.
+func execLabel(msg kernel.Message, goExec *goexec.State, labels []string) error {
+	if len(labels) == 0 {
+		return errors.New("%label requires the label(s) of the cell, e.g. `%label setupData`")
+	}
+	var cellId int
+	if msg != nil {
+		cellId = msg.Kernel().ExecCounter()
+	}
+	for _, label := range labels {
+		if err := goExec.SetCellLabel(label, cellId); err != nil {
+			return errors.WithMessage(err, "%label")
+		}
+	}
+	return nil
+}
+
+// execRequires implements `%requires <labels...>` (or `%%requires`): it warns about the labels of the cells
+// required that didn't run in the session.
+func execRequires(msg kernel.Message, goExec *goexec.State, labels []string) error {
+	if len(labels) == 0 {
+		return errors.New("%requires requires the label(s) of the cells required, e.g. `%requires setupData`")
+	}
+	for _, label := range labels {
+		if err := goexec.ValidateCellLabel(label); err != nil {
+			return errors.WithMessage(err, "%requires")
+		}
+	}
+	missing := goExec.MissingLabels(labels)
+	if len(missing) == 0 {
+		return nil
+	}
+	return kernel.PublishWriteStream(msg, kernel.StreamStderr,
+		fmt.Sprintf("%%requires: the cell(s) labeled %s didn't run in this session, use `%%run_needed` to run them.\n",
+			strings.Join(missing, ", ")))
+}
+
+// execRunNeeded implements `%run_needed [<labels...>]`.
+func execRunNeeded(msg kernel.Message, goExec *goexec.State, labels []string) error {
+	for _, label := range labels {
+		if err := goexec.ValidateCellLabel(label); err != nil {
+			return errors.WithMessage(err, "%run_needed")
+		}
+	}
+	return goExec.Comms.RequestRunNeeded(msg, labels, goExec.LabelsRun())
+}
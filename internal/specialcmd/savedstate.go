@@ -0,0 +1,52 @@
+package specialcmd
+
+import (
+	"fmt"
+
+	"github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%save_state` and `%load_state`.
+
+// statePathFromArgs returns the path of the state given in args, or the default one for the notebook.
+func statePathFromArgs(cmd string, args []string) (string, error) {
+	switch len(args) {
+	case 0:
+		return goexec.DefaultStatePath()
+	case 1:
+		return common.ReplaceTildeInDir(args[0]), nil
+	default:
+		return "", errors.Errorf("%%%s takes at most one argument, the path of the state file, got %q", cmd, args)
+	}
+}
+
+// execSaveState implements `%save_state [<file>]`.
+func execSaveState(msg kernel.Message, goExec *goexec.State, args []string) error {
+	statePath, err := statePathFromArgs("save_state", args)
+	if err != nil {
+		return err
+	}
+	if err := goExec.SaveState(statePath); err != nil {
+		return errors.WithMessage(err, "%save_state")
+	}
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout, fmt.Sprintf("Memorized definitions saved to %q\n", statePath))
+}
+
+// execLoadState implements `%load_state [<file>]`.
+func execLoadState(msg kernel.Message, goExec *goexec.State, args []string) error {
+	statePath, err := statePathFromArgs("load_state", args)
+	if err != nil {
+		return err
+	}
+	var cellId int
+	if msg != nil {
+		cellId = msg.Kernel().ExecCounter()
+	}
+	if err := goExec.LoadState(msg, cellId, statePath); err != nil {
+		return errors.WithMessage(err, "%load_state")
+	}
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout, fmt.Sprintf("Memorized definitions loaded from %q\n", statePath))
+}
@@ -0,0 +1,73 @@
+package specialcmd
+
+import (
+	"bytes"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// This file implements setting Go variables from the output of shell commands: `!out := <cmd>`,
+// `!out[] := <cmd>` and `%sh --var=out [--lines] <cmd>`.
+
+// reShellVar matches `<name> := <cmd>` or `<name>[] := <cmd>`.
+var reShellVar = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)(\[])?\s*:=\s*(.*)$`)
+
+// execShellToVar executes the shell command cmdStr in execDir (if empty, the current directory), and memorizes
+// its standard output in the Go variable name: a string or, if asLines is true, a []string with one element
+// per line. Trailing new lines are dropped. The standard error is displayed.
+func execShellToVar(msg kernel.Message, goExec *goexec.State, name string, asLines bool, cmdStr, execDir string) error {
+	if strings.TrimSpace(cmdStr) == "" {
+		return errors.Errorf("missing shell command to set variable %q", name)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("/bin/bash", "-c", cmdStr)
+	cmd.Dir = execDir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	klog.V(2).Infof("Executing %q to set variable %q", cmdStr, name)
+	err := cmd.Run()
+	if stderr.Len() > 0 {
+		_ = kernel.PublishWriteStream(msg, kernel.StreamStderr, stderr.String())
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to execute %q, variable %q not set", cmdStr, name)
+	}
+	cellId := -1
+	if msg != nil {
+		cellId = msg.Kernel().ExecCounter()
+	}
+	_, err = goExec.SetStringVariable(name, strings.TrimRight(stdout.String(), "\n"), asLines, cellId)
+	return err
+}
+
+// execSh implements `%sh [--var=<name> [--lines]] <cmd>`. The parameter `args` is the command line after "%sh".
+func execSh(msg kernel.Message, goExec *goexec.State, args string, status *cellStatus) error {
+	var name string
+	var asLines bool
+	args = strings.TrimSpace(args)
+	for strings.HasPrefix(args, "--") {
+		flag, rest, _ := strings.Cut(args, " ")
+		switch {
+		case strings.HasPrefix(flag, "--var="):
+			name = strings.TrimPrefix(flag, "--var=")
+		case flag == "--lines":
+			asLines = true
+		default:
+			return errors.Errorf("%%sh: unknown flag %q", flag)
+		}
+		args = strings.TrimSpace(rest)
+	}
+	if name == "" {
+		if asLines {
+			return errors.New("%sh: --lines requires --var=<name>")
+		}
+		return execShell(msg, goExec, args, status)
+	}
+	return execShellToVar(msg, goExec, name, asLines, args, "")
+}
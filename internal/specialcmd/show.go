@@ -0,0 +1,80 @@
+package specialcmd
+
+import (
+	"fmt"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"html"
+	"os"
+	"path"
+	"strings"
+)
+
+// This file implements `%show main.go|go.mod|go.work`, which displays the files GoNB composes in its
+// temporary directory.
+
+const showStyle = `<style>
+.gonb-show { font-family: monospace; border-collapse: collapse; }
+.gonb-show td { padding: 0 0.5em; text-align: left !important; vertical-align: top; white-space: pre; }
+.gonb-show-gutter { color: #888; text-align: right !important; user-select: none; }
+.gonb-show-cell { border-top: 1px solid #ddd; }
+</style>
+` + highlightStyle
+
+// execShow implements `%show <file>`. The parameter `args` excludes "%show".
+func execShow(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) != 1 {
+		return errors.Errorf("%%show expects one of main.go, go.mod or go.work, got %q", args)
+	}
+	switch args[0] {
+	case "main.go", "main_test.go":
+		code, fileToCellIdAndLine := goExec.LastComposedCode()
+		if code == "" {
+			return errors.New("%show main.go requires a cell to have been executed successfully")
+		}
+		return kernel.PublishHtml(msg, showStyle+renderComposedCode(code, fileToCellIdAndLine))
+	case "go.mod", "go.work":
+		filePath := path.Join(goExec.TempDir, args[0])
+		contents, err := os.ReadFile(filePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return errors.Errorf("%s doesn't exist in %q", args[0], goExec.TempDir)
+			}
+			return errors.Wrapf(err, "failed to read %q", filePath)
+		}
+		return kernel.PublishHtml(msg, fmt.Sprintf("%s<h4>%s</h4><pre>%s</pre>", showStyle,
+			html.EscapeString(filePath), html.EscapeString(string(contents))))
+	default:
+		return errors.Errorf("%%show %q not supported, use one of main.go, go.mod or go.work", args[0])
+	}
+}
+
+// renderComposedCode renders the code highlighted, with a gutter that shows the cell and line where each line of
+// the code came from.
+func renderComposedCode(code string, fileToCellIdAndLine []goexec.CellIdAndLine) string {
+	lines := highlightGo(code)
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	parts := []string{`<table class="gonb-show">`}
+	lastCellId := -1
+	for ii, line := range lines {
+		var origin, rowClass string
+		if ii < len(fileToCellIdAndLine) && fileToCellIdAndLine[ii].Line != goexec.NoCursorLine {
+			cellIdAndLine := fileToCellIdAndLine[ii]
+			origin = fmt.Sprintf("%d", cellIdAndLine.Line+1)
+			if cellIdAndLine.Id != -1 {
+				origin = fmt.Sprintf("[%d]:%d", cellIdAndLine.Id, cellIdAndLine.Line+1)
+				if cellIdAndLine.Id != lastCellId {
+					rowClass = ` class="gonb-show-cell"`
+					lastCellId = cellIdAndLine.Id
+				}
+			}
+		}
+		parts = append(parts, fmt.Sprintf(`<tr%s><td class="gonb-show-gutter">%d</td><td class="gonb-show-gutter">%s</td><td>%s</td></tr>`,
+			rowClass, ii+1, origin, line))
+	}
+	parts = append(parts, "</table>")
+	return strings.Join(parts, "\n")
+}
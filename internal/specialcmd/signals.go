@@ -0,0 +1,28 @@
+package specialcmd
+
+import (
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/jpyexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%signals`: the signals forwarded to the cell programs when the execution is interrupted.
+
+// execSignals implements `%signals [forward=<signals...>] [kill_after=<duration>|never]` and `%signals --reset`.
+// Without arguments, it shows the current configuration.
+func execSignals(msg kernel.Message, goExec *goexec.State, args []string) error {
+	switch {
+	case len(args) == 0:
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout, goExec.SignalPolicy.String()+"\n")
+	case len(args) == 1 && args[0] == "--reset":
+		goExec.SignalPolicy = jpyexec.DefaultSignalPolicy()
+		return nil
+	}
+	policy, err := jpyexec.ParseSignalPolicy(goExec.SignalPolicy, args)
+	if err != nil {
+		return errors.WithMessage(err, "%signals")
+	}
+	goExec.SignalPolicy = policy
+	return nil
+}
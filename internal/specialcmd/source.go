@@ -0,0 +1,115 @@
+package specialcmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+	"k8s.io/klog/v2"
+)
+
+// This file implements `%source <script> [args...]`, which runs a shell script and imports the changes it makes
+// to the environment variables into the kernel, so they affect later cells and shell commands -- e.g.:
+// `%source venv/bin/activate`.
+
+// sourceIgnoredEnv are environment variables set by the shell itself, not propagated back to the kernel.
+var sourceIgnoredEnv = []string{"_", "SHLVL", "PWD", "OLDPWD"}
+
+// execSource implements `%source <script> [args...]`. The parameter `args` excludes "%source".
+func execSource(msg kernel.Message, args []string) error {
+	if len(args) == 0 {
+		return errors.New("%source requires the path of the script to source")
+	}
+	envFile, err := os.CreateTemp("", "gonb_source_env_")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create temporary file for %%source")
+	}
+	envPath := envFile.Name()
+	_ = envFile.Close()
+	defer func() { _ = os.Remove(envPath) }()
+
+	// The environment after the script is written (separated by '\0', since values can have new lines)
+	// to envPath, and only if sourcing the script succeeded.
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("/bin/bash", append([]string{"-c", `source "$0" "$@" && env -0 >"$GONB_SOURCE_ENV_FILE"`}, args...)...)
+	cmd.Env = append(os.Environ(), "GONB_SOURCE_ENV_FILE="+envPath)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	klog.V(2).Infof("Executing %s", cmd)
+	err = cmd.Run()
+	if stdout.Len() > 0 {
+		_ = kernel.PublishWriteStream(msg, kernel.StreamStdout, stdout.String())
+	}
+	if stderr.Len() > 0 {
+		_ = kernel.PublishWriteStream(msg, kernel.StreamStderr, stderr.String())
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to source %q, environment not changed", args[0])
+	}
+	contents, err := os.ReadFile(envPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read environment after sourcing %q", args[0])
+	}
+
+	before := parseEnv(os.Environ(), "")
+	after := parseEnv(strings.Split(string(contents), "\x00"), "GONB_SOURCE_ENV_FILE")
+	set, unset := diffEnv(before, after)
+	for _, key := range set {
+		if err = os.Setenv(key, after[key]); err != nil {
+			return errors.Wrapf(err, "failed to set environment variable %q", key)
+		}
+	}
+	for _, key := range unset {
+		if err = os.Unsetenv(key); err != nil {
+			return errors.Wrapf(err, "failed to unset environment variable %q", key)
+		}
+	}
+
+	var report []string
+	if len(set) > 0 {
+		report = append(report, fmt.Sprintf("Set: %s", strings.Join(set, ", ")))
+	}
+	if len(unset) > 0 {
+		report = append(report, fmt.Sprintf("Unset: %s", strings.Join(unset, ", ")))
+	}
+	if len(report) == 0 {
+		report = append(report, "No environment variables changed")
+	}
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout, strings.Join(report, "\n")+"\n")
+}
+
+// parseEnv converts a list of "key=value" to a map, skipping empty entries and the given key.
+func parseEnv(env []string, skipKey string) map[string]string {
+	envMap := make(map[string]string, len(env))
+	for _, entry := range env {
+		key, value, found := strings.Cut(entry, "=")
+		if !found || key == "" || key == skipKey {
+			continue
+		}
+		envMap[key] = value
+	}
+	return envMap
+}
+
+// diffEnv returns the sorted keys of the environment variables that were set (new or changed) and unset, from
+// before to after. The variables in sourceIgnoredEnv are not included.
+func diffEnv(before, after map[string]string) (set, unset []string) {
+	for key, value := range after {
+		if previous, found := before[key]; (!found || previous != value) && !slices.Contains(sourceIgnoredEnv, key) {
+			set = append(set, key)
+		}
+	}
+	for key := range before {
+		if _, found := after[key]; !found && !slices.Contains(sourceIgnoredEnv, key) {
+			unset = append(unset, key)
+		}
+	}
+	slices.Sort(set)
+	slices.Sort(unset)
+	return
+}
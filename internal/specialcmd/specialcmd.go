@@ -11,6 +11,7 @@ import (
 	_ "embed"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -21,6 +22,7 @@ import (
 	. "github.com/janpfeifer/gonb/common"
 	"github.com/janpfeifer/gonb/gonbui/protocol"
 	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/i18n"
 	"github.com/janpfeifer/gonb/internal/kernel"
 	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
@@ -73,6 +75,7 @@ func Parse(msg kernel.Message, goExec *goexec.State, execute bool, codeLines []s
 						return
 					}
 				case '!':
+					goExec.AddShellHistory(strings.TrimPrefix(cmdStr, "*"))
 					err = execShell(msg, goExec, cmdStr, status)
 					if err != nil {
 						return
@@ -145,7 +148,9 @@ func execSpecialConfig(msg kernel.Message, goExec *goexec.State, cmdStr string,
 		// %% and %main are also handled specially by goexec, where it starts a main() clause.
 	case "wasm":
 		if len(parts) > 1 {
-			return errors.Errorf("`%%wasm` takes no extra parameters.")
+			if err := parseWasmFlags(goExec, parts[1:]); err != nil {
+				return err
+			}
 		}
 		goExec.CellIsWasm = true
 		var err error
@@ -158,6 +163,19 @@ func execSpecialConfig(msg kernel.Message, goExec *goexec.State, cmdStr string,
 	case "widgets":
 		return goExec.Comms.InstallWebSocket(msg)
 
+	case "widgets_console":
+		enabled := true
+		if len(parts) > 1 {
+			switch parts[1] {
+			case "on":
+			case "off":
+				enabled = false
+			default:
+				return errors.Errorf("`%%widgets_console [on|off]`: unknown parameter %q", parts[1])
+			}
+		}
+		return goExec.Comms.SetConsoleBridge(msg, enabled)
+
 	case "widgets_hb":
 		var hb bool
 		hb, err := goExec.Comms.SendHeartbeatAndWait(msg, 1*time.Second)
@@ -193,6 +211,9 @@ func execSpecialConfig(msg kernel.Message, goExec *goexec.State, cmdStr string,
 			klog.Errorf("Failed to output: %+v", err)
 		}
 
+	case "source":
+		return execSource(msg, parts[1:])
+
 	case "cd":
 		if len(parts) == 1 {
 			pwd, _ := os.Getwd()
@@ -221,7 +242,7 @@ func execSpecialConfig(msg kernel.Message, goExec *goexec.State, cmdStr string,
 	case "goflags":
 		if len(parts) > 1 {
 			nonEmptyArgs := slices.DeleteFunc(parts[1:], func(s string) bool { return s == "" })
-			goExec.GoBuildFlags = nonEmptyArgs
+			goExec.SetGoBuildFlags(nonEmptyArgs)
 		}
 		err := kernel.PublishWriteStream(msg, kernel.StreamStdout,
 			fmt.Sprintf("%%goflags=%q\n", goExec.GoBuildFlags))
@@ -231,20 +252,23 @@ func execSpecialConfig(msg kernel.Message, goExec *goexec.State, cmdStr string,
 
 	// Automatic `go get` control:
 	case "autoget":
-		goExec.AutoGet = true
+		goExec.SetAutoGet(true)
 	case "noautoget":
-		goExec.AutoGet = false
+		goExec.SetAutoGet(false)
 	case "help":
-		//_ = kernel.PublishWriteStream(msg, kernel.StreamStdout, HelpMessage)
-		err := kernel.PublishMarkdown(msg, HelpMessage)
-		if err != nil {
-			klog.Errorf("Failed publishing help contents: %+v", err)
+		return execHelp(msg, parts[1:])
+	case "clear":
+		if len(parts) > 2 || (len(parts) == 2 && parts[1] != "--wait") {
+			return errors.Errorf("%%clear only takes one optional parameter \"--wait\"")
 		}
+		return kernel.PublishClearOutput(msg, len(parts) == 2)
 	case "version":
 		err := kernel.PublishMarkdown(msg, version.AppVersion.Markdown())
 		if err != nil {
 			klog.Errorf("Failed publishing version contents: %+v", err)
 		}
+	case "doctor":
+		return execDoctor(msg, goExec)
 
 	// Definitions management.
 	case "reset":
@@ -257,43 +281,222 @@ func execSpecialConfig(msg kernel.Message, goExec *goexec.State, cmdStr string,
 		}
 		return goExec.GoModInit()
 	case "ls", "list":
-		listDefinitions(msg, goExec)
+		return listDefinitions(msg, goExec, parts[1:])
 	case "rm", "remove":
-		removeDefinitions(msg, goExec, parts[1:])
+		return removeDefinitions(msg, goExec, parts[1:])
+	case "import":
+		return execImport(msg, goExec, parts[1:])
+	case "init":
+		return execInit(msg, goExec, parts[1:])
+	case "diffstate":
+		return execDiffState(msg, goExec)
+	case "show":
+		return execShow(msg, goExec, parts[1:])
+	case "highlight":
+		return execHighlight(msg, strings.TrimPrefix(cmdStr, parts[0]))
+	case "sh":
+		return execSh(msg, goExec, strings.TrimPrefix(cmdStr, parts[0]), status)
+	case "errors":
+		if len(parts) == 1 {
+			return kernel.PublishWriteStream(msg, kernel.StreamStdout, i18n.T(i18n.MsgErrorFormat, goExec.ErrorFormat()))
+		}
+		if len(parts) > 2 {
+			return errors.Errorf("%%errors takes one of \"text\", \"html\" or \"ansi\", got %q", parts[1:])
+		}
+		return goExec.SetErrorFormat(parts[1])
 
 	// Input handling.
 	case "with_inputs":
 		allowInput := content["allow_stdin"].(bool)
 		if !allowInput && (status.withInputs || status.withPassword) {
-			return errors.Errorf("%%with_inputs not available in this notebook, it doesn't allow input prompting")
+			return errors.New(i18n.T(i18n.MsgNoInputPrompting, parts[0]))
 		}
 		status.withInputs = true
 	case "with_password":
 		allowInput := content["allow_stdin"].(bool)
 		if !allowInput && (status.withInputs || status.withPassword) {
-			return errors.Errorf("%%with_password not available in this notebook, it doesn't allow input prompting")
+			return errors.New(i18n.T(i18n.MsgNoInputPrompting, parts[0]))
 		}
 		status.withPassword = true
 
 	// Files that need tracking for `gopls` (for auto-complete and contextual help).
 	case "track":
-		execTrack(msg, goExec, parts[1:])
+		return execTrack(msg, goExec, parts[1:])
 	case "untrack":
 		if len(parts) != 2 {
 			return errors.New("%untrack takes one argument, the name Go file to tack")
 		}
 		execUntrack(msg, goExec, parts[1:])
+	case "edit":
+		if len(parts) != 2 {
+			return errors.New("%edit takes one argument, the path of the file to edit")
+		}
+		cellContents, err := goExec.EditFileCell(parts[1])
+		if err != nil {
+			return err
+		}
+		goExec.SetNextInput(cellContents, false)
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			"File loaded in the next cell: execute it to save the changes.\n")
+
+	// Hooks executed before/after each cell.
+	case "hook":
+		return execHook(msg, goExec, strings.TrimPrefix(cmdStr, parts[0]))
+	case "pre_run":
+		return execHook(msg, goExec, string(goexec.HookPreRun)+" "+strings.TrimPrefix(cmdStr, parts[0]))
+	case "post_run":
+		return execHook(msg, goExec, string(goexec.HookPostRun)+" "+strings.TrimPrefix(cmdStr, parts[0]))
+
+	// Turn memorized declarations into a Go module.
+	case "scaffold":
+		if len(parts) < 2 || len(parts) > 3 {
+			return errors.New("%scaffold takes the module path and optionally the directory: `%scaffold <module_path> [<directory>]`")
+		}
+		var dir string
+		if len(parts) == 3 {
+			dir = parts[2]
+		}
+		return goExec.Scaffold(msg, parts[1], dir)
+
+	case "modsnapshot":
+		return execModSnapshot(msg, goExec, parts[1:])
+	case "workspace":
+		return execWorkspace(msg, goExec, parts[1:])
+	case "gopls":
+		return execGopls(msg, goExec, parts[1:])
+	case "rename":
+		return execRename(msg, goExec, parts[1:])
+	case "uses":
+		return execUses(msg, goExec, parts[1:])
+	case "asm":
+		return execAsm(msg, goExec, parts[1:])
+	case "escape":
+		return execEscape(msg, goExec, parts[1:])
+	case "bench":
+		return execBench(msg, goExec, parts[1:])
+	case "listen":
+		return execListen(msg, goExec, parts[1:])
+	case "store":
+		return execStore(msg, goExec, parts[1:])
+	case "persist":
+		return execPersist(msg, goExec, parts[1:])
+	case "signals":
+		return execSignals(msg, goExec, parts[1:])
+	case "record":
+		return execRecord(msg, parts[1:])
+	case "autograde":
+		return execAutograde(msg, goExec, parts[1:])
+	case "label", "%label":
+		return execLabel(msg, goExec, parts[1:])
+	case "requires", "%requires":
+		return execRequires(msg, goExec, parts[1:])
+	case "run_needed":
+		return execRunNeeded(msg, goExec, parts[1:])
+	case "save_state":
+		return execSaveState(msg, goExec, parts[1:])
+	case "load_state":
+		return execLoadState(msg, goExec, parts[1:])
+	case "template":
+		return execTemplate(msg, goExec, parts[1:])
+	case "deps":
+		return execDeps(msg, goExec, parts[1:])
+	case "vulncheck":
+		return execVulnCheck(msg, goExec, parts[1:])
+	case "vet":
+		if len(parts) != 2 || (parts[1] != "on" && parts[1] != "off") {
+			return errors.New("%vet takes one argument, `on` or `off`")
+		}
+		goExec.VetEnabled = parts[1] == "on"
+	case "doc":
+		return execDoc(msg, goExec, parts[1:])
+	case "sanitize_html":
+		if len(parts) != 2 || (parts[1] != "on" && parts[1] != "off") {
+			return errors.New("%sanitize_html takes one argument, `on` or `off`")
+		}
+		goExec.SanitizeHTML = parts[1] == "on"
+	case "markdown_render":
+		if len(parts) > 2 || (len(parts) == 2 && parts[1] != "kernel" && parts[1] != "frontend") {
+			return errors.Errorf("%%markdown_render takes one optional argument, \"kernel\" or \"frontend\", got %q", parts[1:])
+		}
+		if msg == nil {
+			return nil
+		}
+		if len(parts) == 2 {
+			msg.Kernel().RenderMarkdown = parts[1] == "kernel"
+		}
+		mode := "frontend"
+		if msg.Kernel().RenderMarkdown {
+			mode = "kernel"
+		}
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout, fmt.Sprintf("%%markdown_render %s\n", mode))
+	case "page":
+		return execPage(msg, goExec, strings.TrimPrefix(cmdStr, parts[0]))
+	case "pager":
+		return execPager(msg, goExec, parts[1:])
+	case "stream_buffer":
+		return execStreamBuffer(msg, goExec, parts[1:])
+	case "binary":
+		return execBinary(msg, goExec, parts[1:])
+	case "route":
+		return execRoute(msg, goExec, parts[1:])
+	case "gentest":
+		if len(parts) != 2 {
+			return errors.New("%gentest takes one argument, the name of the function (or `Type.Method`) to generate a test for")
+		}
+		test, err := goExec.GenerateTest(parts[1])
+		if err != nil {
+			return err
+		}
+		goExec.SetNextInput(test, false)
+
+	// Git integration.
+	case "git":
+		return execGit(msg, parts[1:])
+
+	// Build tools.
+	case "make", "task":
+		return execMake(msg, parts[0], parts[1:])
 
 	// Fix issues with `go work`.
 	case "goworkfix":
 		return goExec.GoWorkFix(msg)
+	case "gowork":
+		return execGoWork(msg, goExec, parts[1:])
+	case "private":
+		return execPrivate(msg, parts[1:])
+	case "goproxy":
+		return execGoProxy(msg, goExec, parts[1:])
+	case "tags":
+		return execTags(msg, goExec, parts[1:])
+	case "cover-session":
+		return execCoverSession(msg, goExec, parts[1:])
+	case "deterministic":
+		return execDeterministic(msg, goExec, parts[1:])
+
+	// Snapshot of the cell output.
+	case "snapshot":
+		if len(parts) != 2 {
+			return errors.New("%snapshot takes one argument, the name of the file (.png or .pdf) where to save the snapshot")
+		}
+		filePath, err := filepath.Abs(ReplaceEnvVars(ReplaceTildeInDir(parts[1])))
+		if err != nil {
+			return errors.Wrapf(err, "%%snapshot: invalid file path %q", parts[1])
+		}
+		goExec.SnapshotPath = filePath
 
 	// Capture output of cell.
 	case "capture":
 		args := parts[1:]
-		var appendToFile bool
-		if len(args) > 1 && args[0] == "-a" {
-			appendToFile = true
+		var appendToFile, quiet bool
+		for len(args) > 1 && strings.HasPrefix(args[0], "-") {
+			switch args[0] {
+			case "-a":
+				appendToFile = true
+			case "--quiet", "-quiet", "--no-display":
+				quiet = true
+			default:
+				return errors.Errorf("%%capture: unknown flag %q", args[0])
+			}
 			args = args[1:]
 		}
 		if len(args) != 1 {
@@ -302,35 +505,23 @@ func execSpecialConfig(msg kernel.Message, goExec *goexec.State, cmdStr string,
 		filePath := args[0]
 		filePath = ReplaceTildeInDir(filePath)
 		filePath = ReplaceEnvVars(filePath)
-		var err error
-		var f *os.File
-		if appendToFile {
-			f, err = os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-			if err != nil {
-				err = errors.Wrapf(err, "failed to append to \"%%capture\" file %q", filePath)
-				klog.Errorf("Error: %+v", err)
-				return err
-			}
-		} else {
-			f, err = os.Create(filePath)
-			if err != nil {
-				err = errors.Wrapf(err, "failed to create \"%%capture\" file %q", filePath)
-				klog.Errorf("Error: %+v", err)
-				return err
-			}
+		capture, err := goexec.NewCapture(filePath, appendToFile, quiet)
+		if err != nil {
+			klog.Errorf("Error: %+v", err)
+			return err
 		}
 		// Notice, file will be closed in goExec.PostExecuteCell(), where all "one-shot" state is cleaned up.
-		goExec.CaptureFile = f
+		goExec.Capture = capture
 
 	default:
 		if CellSpecialCommands.Has("%" + parts[0]) {
 			// Cell special commands should always come first, and if they are parsed here (as opposed to being processed by specialCells)
 			// they were in the middle somewhere.
-			return errors.Errorf("\"%%%s\" can only appear at the start of the cell", parts[0])
+			return errors.New(i18n.T(i18n.MsgOnlyAtCellStart, parts[0]))
 		}
 
 		// Unknown special command.
-		err := kernel.PublishWriteStream(msg, kernel.StreamStderr, fmt.Sprintf("\"%%%s\" unknown or not implemented yet.", parts[0]))
+		err := kernel.PublishWriteStream(msg, kernel.StreamStderr, i18n.T(i18n.MsgUnknownSpecialCommand, parts[0]))
 		if err != nil {
 			klog.Errorf("Error while reporting back on unimplemented message command \"%%%s\" kernel: %+v", parts[0], err)
 		}
@@ -348,21 +539,27 @@ func execShell(msg kernel.Message, goExec *goexec.State, cmdStr string, status *
 		cmdStr = cmdStr[1:]
 		execDir = goExec.TempDir
 	}
+	if matches := reShellVar.FindStringSubmatch(strings.TrimSpace(cmdStr)); matches != nil {
+		return execShellToVar(msg, goExec, matches[1], matches[2] != "", matches[3], execDir)
+	}
 	if status.withInputs {
 		status.withInputs = false
 		status.withPassword = false
 		return jpyexec.New(msg, "/bin/bash", "-c", cmdStr).
-			ExecutionCount(msg.Kernel().ExecCounter).
+			ExecutionCount(msg.Kernel().ExecCounter()).
+			WithStreamBuffer(goExec.StreamBufferInterval).WithBinaryPolicy(goExec.BinaryPolicy).
 			InDir(execDir).WithInputs(MillisecondsWaitForInput).Exec()
 	} else if status.withPassword {
 		status.withInputs = false
 		status.withPassword = false
 		return jpyexec.New(msg, "/bin/bash", "-c", cmdStr).
-			ExecutionCount(msg.Kernel().ExecCounter).
+			ExecutionCount(msg.Kernel().ExecCounter()).
+			WithStreamBuffer(goExec.StreamBufferInterval).WithBinaryPolicy(goExec.BinaryPolicy).
 			InDir(execDir).WithPassword(MillisecondsWaitForInput).Exec()
 	} else {
 		return jpyexec.New(msg, "/bin/bash", "-c", cmdStr).
-			ExecutionCount(msg.Kernel().ExecCounter).
+			ExecutionCount(msg.Kernel().ExecCounter()).
+			WithStreamBuffer(goExec.StreamBufferInterval).WithBinaryPolicy(goExec.BinaryPolicy).
 			InDir(execDir).Exec()
 	}
 }
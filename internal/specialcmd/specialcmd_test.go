@@ -6,11 +6,14 @@ import (
 	. "github.com/janpfeifer/gonb/common"
 	"github.com/janpfeifer/gonb/gonbui/protocol"
 	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/jpyexec"
 	"github.com/janpfeifer/gonb/internal/kernel"
 	"github.com/stretchr/testify/require"
 	"os"
+	"path"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -61,3 +64,828 @@ func TestDirEnv(t *testing.T) {
 	assert.Equal(t, "/tmp", os.Getenv(protocol.GONB_DIR_ENV))
 	require.NoError(t, s.Stop())
 }
+
+func TestHooks(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	var msg kernel.Message
+	usedLines := MakeSet[int]()
+	err := Parse(msg, s, true, []string{
+		"%hook pre !gofmt -l .",
+		"%post_run %env GONB_TEST_HOOK=1",
+		"%hook post !echo done",
+	}, usedLines)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"!gofmt -l ."}, s.PreRunHooks)
+	assert.Equal(t, []string{"%env GONB_TEST_HOOK=1", "!echo done"}, s.PostRunHooks)
+	require.NotNil(t, s.HookRunner)
+
+	// Hooks are executed as if they were in a cell.
+	require.NoError(t, s.HookRunner(msg, s.PostRunHooks[0]))
+	assert.Equal(t, "1", os.Getenv("GONB_TEST_HOOK"))
+
+	// Invalid hooks.
+	require.Error(t, Parse(msg, s, true, []string{"%hook pre gofmt"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%hook middle !ls"}, MakeSet[int]()))
+
+	// Commands that change the state of the kernel are rejected, both when registered and when executed.
+	for _, cmdLine := range []string{"%reset", "%workspace switch other", "%goflags -race", "%post_run !ls", "%"} {
+		err = Parse(msg, s, true, []string{"%hook pre " + cmdLine}, MakeSet[int]())
+		require.Error(t, err, "hook %q should have been rejected", cmdLine)
+		assert.Contains(t, err.Error(), "can't be used as a hook")
+		require.Error(t, s.HookRunner(msg, cmdLine))
+	}
+	assert.Equal(t, []string{"!gofmt -l ."}, s.PreRunHooks)
+
+	require.NoError(t, Parse(msg, s, true, []string{"%hook reset post"}, MakeSet[int]()))
+	assert.Len(t, s.PreRunHooks, 1)
+	assert.Empty(t, s.PostRunHooks)
+	require.NoError(t, Parse(msg, s, true, []string{"%hook reset"}, MakeSet[int]()))
+	assert.Empty(t, s.PreRunHooks)
+}
+
+func TestClear(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	var msg kernel.Message
+	require.NoError(t, Parse(msg, s, true, []string{"%clear"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%clear --wait"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%clear now"}, MakeSet[int]()))
+}
+
+func TestPager(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	var msg kernel.Message
+	require.NoError(t, Parse(msg, s, true, []string{"%page echo hello"}, MakeSet[int]()))
+	payloads := s.TakePayloads()
+	require.Len(t, payloads, 1)
+	assert.Equal(t, "page", payloads[0]["source"])
+	assert.Equal(t, map[string]any{"text/plain": "hello\n"}, payloads[0]["data"])
+
+	require.NoError(t, Parse(msg, s, true, []string{"%pager 2"}, MakeSet[int]()))
+	assert.Equal(t, 2, s.PagerLines)
+	require.NoError(t, s.PublishMarkdownOrPage(msg, "short\n"))
+	assert.Empty(t, s.TakePayloads())
+	require.NoError(t, s.PublishMarkdownOrPage(msg, "long\ndoc\n"))
+	assert.Len(t, s.TakePayloads(), 1)
+
+	require.NoError(t, Parse(msg, s, true, []string{"%pager off"}, MakeSet[int]()))
+	assert.False(t, s.ShouldPage(strings.Repeat("\n", 1000)))
+	require.Error(t, Parse(msg, s, true, []string{"%pager -1"}, MakeSet[int]()))
+}
+
+func TestStreamBuffer(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	var msg kernel.Message
+	assert.Equal(t, jpyexec.DefaultStreamBufferInterval, s.StreamBufferInterval)
+	require.NoError(t, Parse(msg, s, true, []string{"%stream_buffer 200ms"}, MakeSet[int]()))
+	assert.Equal(t, 200*time.Millisecond, s.StreamBufferInterval)
+	require.NoError(t, Parse(msg, s, true, []string{"%stream_buffer off"}, MakeSet[int]()))
+	assert.Zero(t, s.StreamBufferInterval)
+	require.Error(t, Parse(msg, s, true, []string{"%stream_buffer -1s"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%stream_buffer fast"}, MakeSet[int]()))
+}
+
+func TestBinary(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	var msg kernel.Message
+	assert.Equal(t, jpyexec.BinaryReplace, s.BinaryPolicy)
+	require.NoError(t, Parse(msg, s, true, []string{"%binary hexdump"}, MakeSet[int]()))
+	assert.Equal(t, jpyexec.BinaryHexDump, s.BinaryPolicy)
+	require.Error(t, Parse(msg, s, true, []string{"%binary ascii"}, MakeSet[int]()))
+	assert.Equal(t, jpyexec.BinaryHexDump, s.BinaryPolicy)
+}
+
+func TestRoute(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	var msg kernel.Message
+	logPath := path.Join(t.TempDir(), "metrics.log")
+	require.NoError(t, Parse(msg, s, true, []string{"%route metrics -> capture://" + logPath}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%route debug discard"}, MakeSet[int]()))
+	assert.Equal(t, map[string]jpyexec.StreamRoute{
+		"metrics": {Kind: jpyexec.RouteFile, Path: logPath},
+		"debug":   {Kind: jpyexec.RouteDiscard},
+	}, s.StreamRoutes)
+	require.NoError(t, Parse(msg, s, true, []string{"%route"}, MakeSet[int]()))
+
+	require.NoError(t, Parse(msg, s, true, []string{"%route debug -> display"}, MakeSet[int]()))
+	assert.NotContains(t, s.StreamRoutes, "debug")
+	require.Error(t, Parse(msg, s, true, []string{"%route debug -> nowhere"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%route debug -> capture://"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%route --reset"}, MakeSet[int]()))
+	assert.Empty(t, s.StreamRoutes)
+}
+
+func TestParseTrackArgs(t *testing.T) {
+	paths, options, err := parseTrackArgs([]string{"a", "--ignore", "'vendor/**,**/*_gen.go'", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, paths)
+	assert.Equal(t, goexec.TrackOptions{Ignore: []string{"vendor/**", "**/*_gen.go"}}, options)
+
+	paths, options, err = parseTrackArgs([]string{"--ignore=testdata/**", "--force", "a"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, paths)
+	assert.Equal(t, goexec.TrackOptions{Ignore: []string{"testdata/**"}, Force: true}, options)
+
+	_, _, err = parseTrackArgs([]string{"a", "--ignore"})
+	require.Error(t, err)
+	_, _, err = parseTrackArgs([]string{"--ignore", "vendor/**"})
+	require.Error(t, err)
+}
+
+func TestGoWork(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	var msg kernel.Message
+	require.Error(t, Parse(msg, s, true, []string{"%gowork"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%gowork bogus"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%gowork use"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%gowork drop ../mypkg"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%gowork list"}, MakeSet[int]()))
+
+	modDir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(modDir, "go.mod"), []byte("module example.com/mylib\n"), 0600))
+	require.NoError(t, Parse(msg, s, true, []string{"%gowork use " + modDir}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%gowork list"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%gowork drop " + modDir}, MakeSet[int]()))
+}
+
+func TestTags(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	var msg kernel.Message
+	require.NoError(t, Parse(msg, s, true, []string{"%tags integration,linux"}, MakeSet[int]()))
+	assert.Equal(t, []string{"integration", "linux"}, s.BuildTags)
+	require.NoError(t, Parse(msg, s, true, []string{"%tags --cell slow"}, MakeSet[int]()))
+	assert.Equal(t, []string{"slow"}, s.CellBuildTags)
+	require.Error(t, Parse(msg, s, true, []string{"%tags --cell"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%tags !windows"}, MakeSet[int]()))
+	assert.Equal(t, []string{"integration", "linux"}, s.BuildTags)
+	require.NoError(t, Parse(msg, s, true, []string{"%tags --reset"}, MakeSet[int]()))
+	assert.Empty(t, s.BuildTags)
+}
+
+func TestGoProxy(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	t.Setenv("GOPROXY", "")
+
+	var msg kernel.Message
+	require.NoError(t, Parse(msg, s, true, []string{"%goproxy https://athens.example.com"}, MakeSet[int]()))
+	assert.Equal(t, "https://athens.example.com", os.Getenv("GOPROXY"))
+	require.NoError(t, Parse(msg, s, true, []string{"%goproxy off"}, MakeSet[int]()))
+	assert.Equal(t, "off", os.Getenv("GOPROXY"))
+	require.Error(t, Parse(msg, s, true, []string{"%goproxy athens.example.com"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%goproxy off direct"}, MakeSet[int]()))
+	assert.Equal(t, "off", os.Getenv("GOPROXY"))
+	require.NoError(t, Parse(msg, s, true, []string{"%goproxy"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%goproxy stats"}, MakeSet[int]()))
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "3.0 GiB", formatBytes(3<<30))
+}
+
+func TestPrivate(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	t.Setenv("GOPRIVATE", "")
+	t.Setenv("GONOSUMDB", "")
+
+	var msg kernel.Message
+	require.NoError(t, Parse(msg, s, true, []string{"%private"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%private a,b"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%private example.com/mycorp/*"}, MakeSet[int]()))
+	assert.Equal(t, "example.com/mycorp/*", os.Getenv("GOPRIVATE"))
+}
+
+func TestGopls(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	var msg kernel.Message
+	require.Error(t, Parse(msg, s, true, []string{"%gopls"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%gopls bogus"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%gopls set"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%gopls set =true"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%gopls unset"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%gopls status"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%gopls settings"}, MakeSet[int]()))
+}
+
+func TestRename(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	var msg kernel.Message
+	require.Error(t, Parse(msg, s, true, []string{"%rename"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%rename Foo"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%rename Foo Bar Baz"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%rename Foo 1Bar"}, MakeSet[int]()))
+}
+
+func TestUses(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	require.NoError(t, s.MemorizeCell(nil, 1, []string{"func Double(x int) int {", "\treturn 2 * x", "}"}, MakeSet[int]()))
+	require.NoError(t, s.MemorizeCell(nil, 2, []string{"func Quad(x int) int { return Double(Double(x)) }"}, MakeSet[int]()))
+
+	var msg kernel.Message
+	require.Error(t, Parse(msg, s, true, []string{"%uses"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%uses Missing"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%uses Double"}, MakeSet[int]()))
+
+	markdown := usesMarkdown(&goexec.UsesResult{Name: "Double", Approximate: true, Usages: []goexec.Usage{
+		{CellId: 2, Line: 0, Declaration: "Quad", Content: "func Quad(x int) int { return Double(Double(x)) }"}}})
+	assert.Contains(t, markdown, "`Double` is used in 1 place:")
+	assert.Contains(t, markdown, "| [2] | 1 | `Quad` | `func Quad(x int) int { return Double(Double(x)) }` |")
+	assert.Contains(t, markdown, "matched by name")
+	assert.Contains(t, usesMarkdown(&goexec.UsesResult{Name: "Quad"}), "can be safely removed")
+}
+
+func TestAsmAndEscape(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	require.NoError(t, s.MemorizeCell(nil, 1, []string{"func Double(x int) *int {", "\ty := 2 * x", "\treturn &y", "}"},
+		MakeSet[int]()))
+
+	var msg kernel.Message
+	require.Error(t, Parse(msg, s, true, []string{"%asm"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%asm Missing"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%asm Double"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%escape Double Other"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%escape Double"}, MakeSet[int]()))
+}
+
+func TestParseBenchArgs(t *testing.T) {
+	parsed, err := parseBenchArgs([]string{"-compare", "HEAD~2", "Point.Norm", "--bench=Norm", "-count=3", "-benchtime=100x"})
+	require.NoError(t, err)
+	assert.Equal(t, benchArgs{
+		compareName: "Point.Norm",
+		compareBack: 2,
+		options:     goexec.BenchOptions{Bench: "Norm", Count: 3, BenchTime: "100x"},
+	}, parsed)
+	parsed, err = parseBenchArgs(nil)
+	require.NoError(t, err)
+	assert.Equal(t, benchArgs{}, parsed)
+	for _, args := range [][]string{{"-compare", "HEAD~1"}, {"-compare", "main", "Foo"}, {"-count=0"}, {"Foo"}} {
+		_, err = parseBenchArgs(args)
+		assert.Errorf(t, err, "parseBenchArgs(%q) should have failed", args)
+	}
+}
+
+func TestAsmDiffText(t *testing.T) {
+	text := asmDiffText([]goexec.AsmLine{
+		{Symbol: "main.Sum"},
+		{Offset: "0x0000", CellId: 1, Line: 1, Source: "return n * (n - 1) / 2", Instruction: "LEAQ\t-1(AX), CX"},
+		{Offset: "0x0004", CellId: 1, Line: 1, Source: "return n * (n - 1) / 2", Instruction: "IMULQ\tCX, AX"},
+	})
+	assert.Equal(t, "main.Sum:\n    // return n * (n - 1) / 2\n    LEAQ -1(AX), CX\n    IMULQ CX, AX\n", text)
+}
+
+func TestAsmHtml(t *testing.T) {
+	asmHtml := asmHtml([]goexec.AsmLine{
+		{Symbol: "main.Double"},
+		{Offset: "0x0000", CellId: 1, Line: 1, Source: "y := 2 * x", Instruction: "SHLQ\t$1, AX"},
+		{Offset: "0x0003", CellId: 1, Line: 1, Source: "y := 2 * x", Instruction: "RET"},
+	})
+	assert.Contains(t, asmHtml, "<b>main.Double</b>")
+	assert.Equal(t, 1, strings.Count(asmHtml, "// [1]:2"))
+	assert.Contains(t, asmHtml, `<span class="gonb-hl-keyword">SHLQ    </span>$1, AX`)
+}
+
+func TestListen(t *testing.T) {
+	var msg kernel.Message
+	s := newEmptyState(t)
+	defer func() {
+		require.NoError(t, s.Stop())
+	}()
+	require.NoError(t, Parse(msg, s, true, []string{"%listen web 127.0.0.1:0"}, MakeSet[int]()))
+	require.Len(t, s.Listeners(), 1)
+	require.NoError(t, Parse(msg, s, true, []string{"%listen"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%listen web"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%listen --close other"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%listen --close web"}, MakeSet[int]()))
+	assert.Empty(t, s.Listeners())
+}
+
+func TestStore(t *testing.T) {
+	var msg kernel.Message
+	s := newEmptyState(t)
+	defer func() {
+		require.NoError(t, s.Stop())
+	}()
+	require.NoError(t, s.Store.Set("a", []byte("a")))
+	require.NoError(t, s.Store.Set("b", []byte("b")))
+	require.NoError(t, Parse(msg, s, true, []string{"%store"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%store rm a"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%store rm a"}, MakeSet[int]()))
+	assert.Equal(t, []string{"b"}, s.Store.Keys())
+
+	filePath := path.Join(t.TempDir(), "store.gob")
+	require.NoError(t, Parse(msg, s, true, []string{"%store save " + filePath}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%store clear"}, MakeSet[int]()))
+	assert.Empty(t, s.Store.Keys())
+	require.NoError(t, Parse(msg, s, true, []string{"%store load " + filePath}, MakeSet[int]()))
+	assert.Equal(t, []string{"b"}, s.Store.Keys())
+	require.NoError(t, Parse(msg, s, true, []string{"%store persist " + filePath}, MakeSet[int]()))
+	assert.Equal(t, filePath, s.Store.PersistPath())
+	require.NoError(t, Parse(msg, s, true, []string{"%store persist off"}, MakeSet[int]()))
+	assert.Empty(t, s.Store.PersistPath())
+	require.Error(t, Parse(msg, s, true, []string{"%store save"}, MakeSet[int]()))
+}
+
+func TestStoreMarkdown(t *testing.T) {
+	got := storeMarkdown([]goexec.StoreEntry{{Key: "a|b", Size: 2048}}, "/tmp/store.gob")
+	assert.Contains(t, got, "| `a\\|b` | 2.0 KiB |")
+	assert.Contains(t, got, "Persisted in `/tmp/store.gob`")
+	assert.Contains(t, storeMarkdown(nil, ""), "The store is empty")
+}
+
+func TestPersist(t *testing.T) {
+	var msg kernel.Message
+	s := newEmptyState(t)
+	defer func() {
+		require.NoError(t, s.Stop())
+	}()
+	require.NoError(t, s.MemorizeCell(msg, 1, []string{"var counter int"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%persist missing"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%persist --all"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%persist counter"}, MakeSet[int]()))
+	require.Len(t, s.PersistedVariables(), 1)
+	require.NoError(t, Parse(msg, s, true, []string{"%persist"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%persist --off"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%persist --off counter"}, MakeSet[int]()))
+	assert.Empty(t, s.PersistedVariables())
+
+	got := persistedVariablesMarkdown([]goexec.PersistedVariable{{Name: "x", Type: "map[string]int", Size: 2048}, {Name: "y", Size: -1}})
+	assert.Contains(t, got, "| `x` | `map[string]int` | 2.0 KiB |")
+	assert.Contains(t, got, "| `y` | _unknown_ | _not yet_ |")
+}
+
+func TestSignals(t *testing.T) {
+	var msg kernel.Message
+	s := newEmptyState(t)
+	defer func() {
+		require.NoError(t, s.Stop())
+	}()
+	require.NoError(t, Parse(msg, s, true, []string{"%signals forward=SIGTERM,hup kill_after=2s"}, MakeSet[int]()))
+	assert.Equal(t, "forward=SIGTERM,SIGHUP kill_after=2s", s.SignalPolicy.String())
+	require.NoError(t, Parse(msg, s, true, []string{"%signals kill_after=never"}, MakeSet[int]()))
+	assert.Equal(t, "forward=SIGTERM,SIGHUP kill_after=never", s.SignalPolicy.String())
+	require.NoError(t, Parse(msg, s, true, []string{"%signals"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%signals forward=SIGFOO"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%signals kill_after=-1s"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%signals grace=1s"}, MakeSet[int]()))
+	require.NoError(t, Parse(msg, s, true, []string{"%signals --reset"}, MakeSet[int]()))
+	assert.Equal(t, "forward=SIGINT kill_after=5s", s.SignalPolicy.String())
+}
+
+func TestCapture(t *testing.T) {
+	var msg kernel.Message
+	s := newEmptyState(t)
+	defer func() {
+		require.NoError(t, s.Stop())
+	}()
+	// By default, the output is displayed and saved.
+	capturePath := path.Join(t.TempDir(), "output.txt")
+	require.NoError(t, Parse(msg, s, true, []string{"%capture " + capturePath}, MakeSet[int]()))
+	require.NotNil(t, s.Capture)
+	assert.False(t, s.Capture.Quiet)
+	require.NoError(t, s.Capture.Close())
+
+	require.NoError(t, Parse(msg, s, true, []string{"%capture -a --quiet " + capturePath}, MakeSet[int]()))
+	assert.True(t, s.Capture.Quiet)
+	require.NoError(t, s.Capture.Close())
+	require.Error(t, Parse(msg, s, true, []string{"%capture --tee " + capturePath}, MakeSet[int]()))
+}
+
+func TestDeps(t *testing.T) {
+	var msg kernel.Message
+	s := newEmptyState(t)
+	defer func() {
+		require.NoError(t, s.Stop())
+	}()
+	require.Error(t, Parse(msg, s, true, []string{"%deps --csv"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%deps --all"}, MakeSet[int]()))
+	csvPath := path.Join(t.TempDir(), "deps.csv")
+	require.NoError(t, Parse(msg, s, true, []string{"%deps --direct --csv " + csvPath}, MakeSet[int]()))
+	contents, err := os.ReadFile(csvPath)
+	require.NoError(t, err)
+	assert.Equal(t, "Module,Version,Replacement,Direct,License,License File\n", string(contents))
+}
+
+func TestDepsHtml(t *testing.T) {
+	deps := []goexec.ModuleDependency{
+		{Path: "github.com/foo/bar", Version: "v1.2.0", License: "MIT", LicenseFile: "/mod/bar/LICENSE"},
+		{Path: "golang.org/x/text", Version: "v0.14.0", Indirect: true},
+	}
+	csvContent, err := depsCSV(deps)
+	require.NoError(t, err)
+	assert.Equal(t, "Module,Version,Replacement,Direct,License,License File\n"+
+		"github.com/foo/bar,v1.2.0,,true,MIT,/mod/bar/LICENSE\n"+
+		"golang.org/x/text,v0.14.0,,false,,\n", string(csvContent))
+	content := depsHtml(deps, csvContent, true, "")
+	assert.Contains(t, content, "<b>2 modules</b> (MIT: 1, Not downloaded: 1)")
+	assert.Contains(t, content, `<a href="https://pkg.go.dev/github.com/foo/bar" target="_blank">github.com/foo/bar</a>`)
+	assert.Contains(t, content, `<span title="/mod/bar/LICENSE">MIT</span>`)
+	assert.Contains(t, content, "<i>not downloaded</i>")
+	assert.Contains(t, content, `download="deps.csv"`)
+	assert.Contains(t, content, "<script>")
+
+	// Content-Security-Policy: nonce added to the script, or no script if inline scripts are disallowed.
+	assert.Contains(t, depsHtml(deps, csvContent, true, "abc123"), `<script nonce="abc123">`)
+	assert.NotContains(t, depsHtml(deps, csvContent, false, ""), "<script")
+}
+
+func TestVulnCheck(t *testing.T) {
+	var msg kernel.Message
+	s := newEmptyState(t)
+	defer func() {
+		require.NoError(t, s.Stop())
+	}()
+	require.NoError(t, Parse(msg, s, true, []string{"%vulncheck auto on"}, MakeSet[int]()))
+	assert.True(t, s.VulnCheckAfterGet)
+	require.NoError(t, Parse(msg, s, true, []string{"%vulncheck auto off"}, MakeSet[int]()))
+	assert.False(t, s.VulnCheckAfterGet)
+	require.Error(t, Parse(msg, s, true, []string{"%vulncheck auto"}, MakeSet[int]()))
+	require.Error(t, Parse(msg, s, true, []string{"%vulncheck now"}, MakeSet[int]()))
+}
+
+func TestVulnerabilitiesHtml(t *testing.T) {
+	assert.Contains(t, vulnerabilitiesHtml(nil), "No known vulnerabilities")
+	vulnHtml := vulnerabilitiesHtml([]goexec.Vulnerability{{
+		ID: "GO-2023-1571", Aliases: []string{"CVE-2022-41723"}, Summary: "Denial of service <in> HPACK",
+		Module: "golang.org/x/net", Version: "v0.5.0", FixedVersion: "v0.7.0",
+		Packages: []string{"golang.org/x/net/http2/hpack"}, Symbols: []string{"golang.org/x/net/http2/hpack.Decoder.Write"},
+	}})
+	assert.Contains(t, vulnHtml, `<a href="https://pkg.go.dev/vuln/GO-2023-1571" target="_blank">GO-2023-1571</a>`)
+	assert.Contains(t, vulnHtml, "<code>golang.org/x/net@v0.5.0</code>")
+	assert.Contains(t, vulnHtml, "<b>Called</b>: <code>golang.org/x/net/http2/hpack.Decoder.Write</code>")
+	assert.Contains(t, vulnHtml, "Denial of service &lt;in&gt; HPACK")
+}
+
+func TestMakeTargets(t *testing.T) {
+	makefile := `
+GO := go
+.PHONY: all build
+all: build test
+
+build test: deps
+	$(GO) build ./...
+
+%.o: %.c
+	cc -c $<
+deps::
+	echo deps
+`
+	assert.Equal(t, []string{"all", "build", "deps", "test"}, parseMakeTargets([]byte(makefile)))
+
+	taskfile := `version: '3'
+
+vars:
+  GREETING: Hello
+
+tasks:
+  build:
+    cmds:
+      - go build ./...
+  # Comment
+  docker:push:
+    deps: [build]
+    cmds:
+      - docker push
+  default: {cmds: [echo hi]}
+`
+	assert.Equal(t, []string{"build", "default", "docker:push"}, parseTaskTargets([]byte(taskfile)))
+}
+
+func TestRenderSideBySideDiff(t *testing.T) {
+	diff := `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,4 @@ package main
+ package main
+-// -- old comment
++// new comment
+ func main() {}
+`
+	got := renderSideBySideDiff("", diff)
+	assert.Contains(t, got, "<h4>main.go</h4>")
+	assert.Contains(t, got, `<td class="gonb-git-del">// -- old comment</td>`)
+	assert.Contains(t, got, `<td class="gonb-git-num">2</td><td class="gonb-git-add">// new comment</td>`)
+	assert.Contains(t, got, `<td class="gonb-git-num">3</td><td class="">func main() {}</td>`)
+	assert.Equal(t, 1, strings.Count(got, "<table"))
+}
+
+func TestGitFilePath(t *testing.T) {
+	// Paths reported by git are relative to the top-level of the repository, not the current directory.
+	got, err := gitFilePath("/repo", "pkg/main.go")
+	require.NoError(t, err)
+	assert.Equal(t, "/repo/pkg/main.go", got)
+	got, err = gitFilePath("/repo", "/tmp/gonb/main.go")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/gonb/main.go", got)
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	got, err = gitFilePath("", "main.go")
+	require.NoError(t, err)
+	assert.Equal(t, path.Join(cwd, "main.go"), got)
+}
+
+func TestDoc(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	s.Definitions.Functions["Scale"] = &goexec.Function{
+		Key:        "Scale",
+		Definition: "func Scale(x float64) float64 {\n\treturn 2 * x\n}",
+		Comments:   &goexec.Comments{Lines: []string{"// Scale doubles x."}},
+	}
+	markdown, found := memorizedDoc(s.Definitions, "Scale")
+	require.True(t, found)
+	assert.Contains(t, markdown, "Scale doubles x.")
+	assert.Contains(t, markdown, "func Scale(x float64) float64\n")
+	assert.NotContains(t, markdown, "return")
+	_, found = memorizedDoc(s.Definitions, "Missing")
+	assert.False(t, found)
+
+	s.Definitions.Imports["str"] = goexec.NewImport("strings", "str")
+	markdown, err := goDoc(s, "str.ToUpper")
+	require.NoError(t, err)
+	assert.Contains(t, markdown, "https://pkg.go.dev/strings#ToUpper")
+	assert.Contains(t, markdown, "func ToUpper(s string) string")
+}
+
+func TestListDefinitions(t *testing.T) {
+	decls := goexec.NewDeclarations()
+	decls.Functions["TestA"] = &goexec.Function{Key: "TestA", Name: "TestA", CellLines: goexec.CellLines{Id: 3},
+		Definition: "func TestA() {}"}
+	decls.Functions["Helper"] = &goexec.Function{Key: "Helper", Name: "Helper", CellLines: goexec.CellLines{Id: 1},
+		Definition: "func Helper() {}", Comments: &goexec.Comments{Lines: []string{"// Helper does nothing."}}}
+	decls.Types["Point"] = &goexec.TypeDecl{Key: "Point", CellLines: goexec.CellLines{Id: 3},
+		TypeDefinition: "Point struct{ X, Y int }"}
+	decls.Variables["x"] = &goexec.Variable{Key: "x", Name: "x", CellLines: goexec.CellLines{Id: 1}, ValueDefinition: "1"}
+	decls.Imports["fmt"] = &goexec.Import{Key: "fmt", Path: "fmt", CellLines: goexec.CellLines{Id: -1}}
+
+	keys := func(args ...string) (keys []string) {
+		filter, err := parseListArgs(args)
+		require.NoError(t, err)
+		for _, entry := range collectDefinitions(decls, filter) {
+			keys = append(keys, entry.Key)
+		}
+		return
+	}
+	// Grouped by cell, then kind, with definitions not from cells at the end.
+	assert.Equal(t, []string{"x", "Helper", "Point", "TestA", "fmt"}, keys())
+	assert.Equal(t, []string{"Helper", "TestA"}, keys("funcs"))
+	assert.Equal(t, []string{"Point", "TestA"}, keys("-cell", "3"))
+	assert.Equal(t, []string{"TestA"}, keys("-match", "Test.*"))
+	assert.Equal(t, []string{"Point"}, keys("type", "-cell", "3"))
+
+	entries := collectDefinitions(decls, &listFilter{kinds: MakeSet[string](), cellId: -1})
+	assert.Equal(t, "var x = 1", entries[0].Source)
+	assert.Equal(t, "// Helper does nothing.\nfunc Helper() {}", entries[1].Source)
+
+	for _, args := range [][]string{{"foo"}, {"-cell"}, {"-cell", "x"}, {"-match", "("}} {
+		_, err := parseListArgs(args)
+		assert.Error(t, err, "args=%q", args)
+	}
+}
+
+func TestRemoveDefinitions(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	reset := func() {
+		s.Reset()
+		decls := s.Definitions
+		for _, key := range []string{"TestA", "TestB", "Helper"} {
+			decls.Functions[key] = &goexec.Function{Key: key, Name: key}
+		}
+		a, b := &goexec.Variable{Key: "a", Name: "a"}, &goexec.Variable{Key: "b", Name: "b"}
+		a.TupleDefinitions = []*goexec.Variable{a, b}
+		b.TupleDefinitions = a.TupleDefinitions
+		decls.Variables["a"], decls.Variables["b"] = a, b
+		decls.Variables["tmp_x"] = &goexec.Variable{Key: "tmp_x", Name: "tmp_x"}
+		decls.Types["TestType"] = &goexec.TypeDecl{Key: "TestType"}
+	}
+
+	reset()
+	require.NoError(t, removeDefinitions(nil, s, []string{"--dry-run", "Test*"}))
+	assert.Len(t, s.Definitions.Functions, 3)
+	assert.Len(t, s.Definitions.Types, 1)
+
+	require.NoError(t, removeDefinitions(nil, s, []string{"func:Test*"}))
+	assert.Equal(t, []string{"Helper"}, SortedKeys(s.Definitions.Functions))
+	assert.Len(t, s.Definitions.Types, 1)
+
+	// Removing one variable of a tuple removes all of them.
+	require.NoError(t, removeDefinitions(nil, s, []string{"var:b"}))
+	assert.Equal(t, []string{"tmp_x"}, SortedKeys(s.Definitions.Variables))
+
+	reset()
+	require.NoError(t, removeDefinitions(nil, s, []string{"Test*", "vars:tmp_*"}))
+	assert.Equal(t, []string{"Helper"}, SortedKeys(s.Definitions.Functions))
+	assert.Empty(t, s.Definitions.Types)
+	assert.Equal(t, []string{"a", "b"}, SortedKeys(s.Definitions.Variables))
+
+	require.Error(t, removeDefinitions(nil, s, []string{"foo:bar"}))
+	require.Error(t, removeDefinitions(nil, s, []string{"[x"}))
+}
+
+func TestComposedCodeDiff(t *testing.T) {
+	previous := "package main\n\nconst x = 1\n\nfunc main() {\n\tfmt.Println(x)\n}\n"
+	last := "package main\n\nconst x = 2\n\nfunc main() {\n\tfmt.Println(x)\n}\n"
+	diff, err := composedCodeDiff(previous, last, "/tmp/gonb/main.go")
+	require.NoError(t, err)
+	html := renderSideBySideDiff("", diff)
+	assert.Contains(t, html, "<h4>/tmp/gonb/main.go</h4>")
+	assert.Contains(t, html, `<td class="gonb-git-del">const x = 1</td>`)
+	assert.Contains(t, html, `<td class="gonb-git-add">const x = 2</td>`)
+
+	diff, err = composedCodeDiff(previous, previous, "/tmp/gonb/main.go")
+	require.NoError(t, err)
+	assert.Empty(t, diff)
+}
+
+func TestShow(t *testing.T) {
+	code := "package main\n\n// Doc.\nfunc f() string { return \"<x>\" + `a\nb` }\n\nvar n = 10\n"
+	lines := highlightGo(code)
+	require.Len(t, lines, 8)
+	assert.Equal(t, `<span class="gonb-hl-keyword">package</span> main`, lines[0])
+	assert.Equal(t, `<span class="gonb-hl-comment">// Doc.</span>`, lines[2])
+	assert.Contains(t, lines[3], `<span class="gonb-hl-string">&#34;&lt;x&gt;&#34;</span>`)
+	assert.Equal(t, `<span class="gonb-hl-string">b`+"`"+`</span> }`, lines[4])
+	assert.Contains(t, lines[6], `<span class="gonb-hl-number">10</span>`)
+
+	fileToCellIdAndLine := goexec.MakeFileToCellIdAndLine(3, []int{-1, -1, 0, 1, 2, -1, 0})
+	fileToCellIdAndLine[6].Id = 4
+	html := renderComposedCode(code, fileToCellIdAndLine)
+	assert.Contains(t, html, `<td class="gonb-show-gutter">[3]:2</td>`)
+	assert.Contains(t, html, `<td class="gonb-show-gutter">[4]:1</td>`)
+}
+
+func TestHelpRegistry(t *testing.T) {
+	commands := HelpCommands()
+	for _, command := range []string{"track", "untrack", "ls", "list", "writefile", "%%", "!*", "test", "help"} {
+		assert.Containsf(t, commands, command, "command %q not found in help page", command)
+	}
+
+	trackHelp, found := CommandHelp("%track")
+	require.True(t, found)
+	assert.Contains(t, trackHelp, "### Tracking of Go Files")
+	assert.Contains(t, trackHelp, "- `%track [file_or_directory]`")
+	assert.NotContains(t, trackHelp, "%untrack")
+
+	writeFileHelp, found := CommandHelp("%%writefile")
+	require.True(t, found)
+	assert.Contains(t, writeFileHelp, "%%writefile [-a] <filePath>")
+	assert.NotContains(t, writeFileHelp, "%%script")
+
+	_, found = CommandHelp("not_a_command")
+	assert.False(t, found)
+
+	searchResult, found := SearchHelp("GO.MOD")
+	require.True(t, found)
+	assert.Contains(t, searchResult, "`%reset [go.mod]`")
+	assert.NotContains(t, searchResult, "`%track")
+	_, found = SearchHelp("no such keyword anywhere")
+	assert.False(t, found)
+
+	assert.Contains(t, LineHelp("!*go get x"), "`!*<shell_cmd>`")
+	assert.Contains(t, LineHelp("%rm func:Test*"), "`%remove [--dry-run] <definitions>`")
+
+	reply := &kernel.CompleteReply{CursorStart: 4}
+	AutoComplete("%unt", 4, reply)
+	assert.Equal(t, []string{"untrack"}, reply.Matches)
+	assert.Equal(t, 1, reply.CursorStart)
+	reply = &kernel.CompleteReply{CursorStart: 9}
+	AutoComplete("%help wid", 9, reply)
+	assert.Equal(t, []string{"widgets", "widgets_console", "widgets_hb"}, reply.Matches)
+	assert.Equal(t, 6, reply.CursorStart)
+}
+
+func TestAutoCompleteShell(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	s.AddShellHistory("go get github.com/a/b@v1")
+	s.AddShellHistory("ls -l")
+	s.AddShellHistory("go mod tidy")
+	s.AddShellHistory("go get github.com/a/b@v1") // Moved to the end.
+	assert.Equal(t, []string{"go get github.com/a/b@v1", "go mod tidy", "ls -l"}, s.ShellHistory())
+
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(binDir, "gonb_fake_tool"), []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, os.WriteFile(path.Join(binDir, "gonb_not_executable"), []byte(""), 0644))
+	t.Setenv("PATH", binDir)
+
+	line := "!*go "
+	reply := &kernel.CompleteReply{CursorStart: len(line)}
+	AutoCompleteShell(s, line, len(line), reply)
+	assert.Equal(t, []string{"go get github.com/a/b@v1", "go mod tidy"}, reply.Matches)
+	assert.Equal(t, 2, reply.CursorStart)
+
+	line = "!gonb_"
+	reply = &kernel.CompleteReply{CursorStart: len(line)}
+	AutoCompleteShell(s, line, len(line), reply)
+	assert.Equal(t, []string{"gonb_fake_tool"}, reply.Matches)
+	assert.Equal(t, 1, reply.CursorStart)
+
+	line = "!cat /tmp/x"
+	reply = &kernel.CompleteReply{CursorStart: len(line)}
+	AutoCompleteShell(s, line, len(line), reply)
+	assert.Empty(t, reply.Matches)
+	assert.Equal(t, len(line), reply.CursorStart)
+}
+
+func TestShellToVar(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	status := &cellStatus{}
+
+	require.NoError(t, execShell(nil, s, `greeting := echo "hello world"`, status))
+	require.Contains(t, s.Definitions.Variables, "greeting")
+	assert.Equal(t, `"hello world"`, s.Definitions.Variables["greeting"].ValueDefinition)
+
+	require.NoError(t, execShell(nil, s, `lines[] := printf 'a\nb "c"\n\n'`, status))
+	assert.Equal(t, `[]string{"a", "b \"c\""}`, s.Definitions.Variables["lines"].ValueDefinition)
+
+	require.NoError(t, execSh(nil, s, `--var=greeting --lines echo hi`, status))
+	assert.Equal(t, `[]string{"hi"}`, s.Definitions.Variables["greeting"].ValueDefinition)
+
+	require.Error(t, execShell(nil, s, `failed := exit 1`, status))
+	assert.NotContains(t, s.Definitions.Variables, "failed")
+	require.Error(t, execSh(nil, s, `--lines echo hi`, status))
+}
+
+func TestSource(t *testing.T) {
+	t.Setenv("GONB_TEST_SOURCE_KEEP", "keep")
+	t.Setenv("GONB_TEST_SOURCE_CHANGE", "before")
+	t.Setenv("GONB_TEST_SOURCE_UNSET", "to be removed")
+	t.Setenv("GONB_TEST_SOURCE_NEW", "")
+	require.NoError(t, os.Unsetenv("GONB_TEST_SOURCE_NEW"))
+
+	script := path.Join(t.TempDir(), "activate.sh")
+	require.NoError(t, os.WriteFile(script, []byte(`
+export GONB_TEST_SOURCE_NEW="$1
+second line"
+export GONB_TEST_SOURCE_CHANGE=after
+unset GONB_TEST_SOURCE_UNSET
+NOT_EXPORTED=1
+cd /
+`), 0644))
+	require.NoError(t, execSource(nil, []string{script, "first line"}))
+	assert.Equal(t, "first line\nsecond line", os.Getenv("GONB_TEST_SOURCE_NEW"))
+	assert.Equal(t, "after", os.Getenv("GONB_TEST_SOURCE_CHANGE"))
+	assert.Equal(t, "keep", os.Getenv("GONB_TEST_SOURCE_KEEP"))
+	_, found := os.LookupEnv("GONB_TEST_SOURCE_UNSET")
+	assert.False(t, found)
+	_, found = os.LookupEnv("NOT_EXPORTED")
+	assert.False(t, found)
+
+	require.Error(t, execSource(nil, []string{path.Join(t.TempDir(), "missing.sh")}))
+	require.Error(t, execSource(nil, nil))
+}
+
+func TestDoctor(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+	report := doctorReport(nil, s)
+	assert.Contains(t, report, "| GoNB version |")
+	assert.Contains(t, report, "| Go code directory | `"+s.TempDir+"` |")
+	assert.Contains(t, report, "| Jupyter server |")
+}
+
+func TestWasmLocation(t *testing.T) {
+	s := newEmptyState(t)
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	var msg kernel.Message
+	baseDir := t.TempDir()
+	t.Setenv("GONB_TEST_USER", "alice")
+	require.NoError(t, Parse(msg, s, true, []string{"%wasm --dir=" + baseDir + " --url=/user/${GONB_TEST_USER}/files/wasm"}, MakeSet[int]()))
+	assert.True(t, s.CellIsWasm)
+	assert.Equal(t, path.Join(baseDir, s.UniqueID), s.WasmDir)
+	assert.Equal(t, "/user/alice/files/wasm/"+s.UniqueID, s.WasmUrl)
+	assert.Equal(t, s.WasmDir, os.Getenv(protocol.GONB_WASM_DIR_ENV))
+	assert.Equal(t, s.WasmUrl, os.Getenv(protocol.GONB_WASM_URL_ENV))
+	assert.FileExists(t, path.Join(s.WasmDir, "wasm_exec.js"))
+
+	require.Error(t, Parse(msg, s, true, []string{"%wasm --unknown=1"}, MakeSet[int]()))
+}
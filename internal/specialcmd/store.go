@@ -0,0 +1,76 @@
+package specialcmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%store`: the management of the key/value store used by the cell programs with
+// `gonbui/store`.
+
+// execStore implements `%store [rm <keys...> | clear | save <file> | load <file> | persist <file>|off]`.
+func execStore(msg kernel.Message, goExec *goexec.State, args []string) error {
+	store := goExec.Store
+	if len(args) == 0 {
+		return kernel.PublishMarkdown(msg, storeMarkdown(store.Entries(), store.PersistPath()))
+	}
+	var err error
+	switch {
+	case args[0] == "rm" && len(args) >= 2:
+		for _, key := range args[1:] {
+			var found bool
+			found, err = store.Delete(key)
+			if err == nil && !found {
+				err = errors.Errorf("key %q not found", key)
+			}
+			if err != nil {
+				break
+			}
+		}
+	case args[0] == "clear" && len(args) == 1:
+		err = store.Clear()
+	case args[0] == "save" && len(args) == 2:
+		err = store.Save(args[1])
+	case args[0] == "load" && len(args) == 2:
+		err = store.Load(args[1])
+	case args[0] == "persist" && len(args) == 2:
+		filePath := args[1]
+		if filePath == "off" {
+			filePath = ""
+		}
+		err = store.Persist(filePath)
+	default:
+		return errors.Errorf("invalid %%store arguments %q: use `%%store`, `%%store rm <keys...>`, `%%store clear`, "+
+			"`%%store save <file>`, `%%store load <file>` or `%%store persist <file>|off`", args)
+	}
+	if err != nil {
+		return errors.WithMessage(err, "%store")
+	}
+	return nil
+}
+
+// storeMarkdown lists the entries of the store in a Markdown table.
+func storeMarkdown(entries []goexec.StoreEntry, persistPath string) string {
+	var sb strings.Builder
+	if len(entries) == 0 {
+		sb.WriteString("The store is empty: use `store.Set(key, value)` (package `github.com/janpfeifer/gonb/gonbui/store`) " +
+			"in the cells to add values.\n")
+	} else {
+		sb.WriteString("| Key | Size |\n|---|---|\n")
+		for _, entry := range entries {
+			size := formatBytes(entry.Size)
+			if entry.File {
+				size += " (shared file)"
+			}
+			_, _ = fmt.Fprintf(&sb, "| `%s` | %s |\n", escapeMarkdownTableCell(entry.Key), size)
+		}
+	}
+	if persistPath != "" {
+		_, _ = fmt.Fprintf(&sb, "\nPersisted in `%s`.\n", persistPath)
+	}
+	return sb.String()
+}
@@ -0,0 +1,53 @@
+package specialcmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/jpyexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%stream_buffer` and `%binary`: the buffering of the stdout/stderr of the programs executed,
+// and the handling of their binary output.
+
+// execStreamBuffer implements `%stream_buffer [<interval>|off]`: it configures the interval between flushes of
+// the output of the programs to the front-end, or prints the current setting.
+func execStreamBuffer(msg kernel.Message, goExec *goexec.State, args []string) error {
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && args[0] == "off":
+		goExec.StreamBufferInterval = 0
+	case len(args) == 1:
+		interval, err := time.ParseDuration(args[0])
+		if err != nil || interval <= 0 {
+			return errors.Errorf("%%stream_buffer takes a positive duration (e.g. \"50ms\") or \"off\", got %q", args[0])
+		}
+		goExec.StreamBufferInterval = interval
+	default:
+		return errors.Errorf("%%stream_buffer takes at most one argument, got %q", args)
+	}
+	if goExec.StreamBufferInterval == 0 {
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout, "%stream_buffer off\n")
+	}
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout, fmt.Sprintf("%%stream_buffer %s\n", goExec.StreamBufferInterval))
+}
+
+// execBinary implements `%binary [replace|hexdump|base64|discard]`: it configures how the output of the programs
+// that is not valid UTF-8 is displayed, or prints the current setting.
+func execBinary(msg kernel.Message, goExec *goexec.State, args []string) error {
+	switch len(args) {
+	case 0:
+	case 1:
+		policy, err := jpyexec.ParseBinaryPolicy(args[0])
+		if err != nil {
+			return errors.WithMessage(err, "%binary")
+		}
+		goExec.BinaryPolicy = policy
+	default:
+		return errors.Errorf("%%binary takes at most one argument, got %q", args)
+	}
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout, fmt.Sprintf("%%binary %s\n", goExec.BinaryPolicy))
+}
@@ -0,0 +1,45 @@
+package specialcmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%tags`: the build tags of the session and of the cell.
+
+// execTags implements `%tags [--cell] [<tags>]` and `%tags --reset`.
+func execTags(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) == 0 {
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			fmt.Sprintf("%%tags=%q\n", strings.Join(goExec.BuildTags, ",")))
+	}
+	switch args[0] {
+	case "--reset":
+		if len(args) > 1 {
+			return errors.Errorf("%%tags --reset takes no arguments, got %q", args[1:])
+		}
+		goExec.SetBuildTags(nil)
+		return nil
+	case "--cell":
+		tags, err := goexec.ParseBuildTags(strings.Join(args[1:], ","))
+		if err != nil {
+			return errors.WithMessage(err, "%tags --cell")
+		}
+		if len(tags) == 0 {
+			return errors.New("%tags --cell requires the build tags for the cell")
+		}
+		goExec.CellBuildTags = append(goExec.CellBuildTags, tags...)
+		return nil
+	}
+	tags, err := goexec.ParseBuildTags(strings.Join(args, ","))
+	if err != nil {
+		return errors.WithMessage(err, "%tags")
+	}
+	goExec.SetBuildTags(tags)
+	return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+		fmt.Sprintf("%%tags=%q\n", strings.Join(goExec.BuildTags, ",")))
+}
@@ -4,19 +4,24 @@ import (
 	"fmt"
 	"github.com/janpfeifer/gonb/internal/goexec"
 	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
 	"strings"
 )
 
 // execTrack executes the "%track" special command. The parameter `args` excludes
 // "%track".
-func execTrack(msg kernel.Message, goExec *goexec.State, args []string) {
+func execTrack(msg kernel.Message, goExec *goexec.State, args []string) error {
 	if len(args) == 0 {
 		showTrackedList(msg, goExec)
-		return
+		return nil
 	}
-	for _, fileOrDirPath := range args {
-		err := goExec.Track(fileOrDirPath)
+	paths, options, err := parseTrackArgs(args)
+	if err != nil {
+		return err
+	}
+	for _, fileOrDirPath := range paths {
+		err := goExec.TrackWithOptions(fileOrDirPath, options)
 		if err != nil {
 			err = kernel.PublishWriteStream(msg, kernel.StreamStderr, err.Error()+"\n")
 		} else {
@@ -25,9 +30,45 @@ func execTrack(msg kernel.Message, goExec *goexec.State, args []string) {
 		}
 		if err != nil {
 			klog.Errorf("Failed to publish to Jupyter: %+v", err)
-			return
+			return nil
 		}
 	}
+	return nil
+}
+
+// parseTrackArgs separates the paths to track from the flags: `--force` and `--ignore <patterns>`, a
+// comma-separated list of patterns, optionally quoted, e.g. `--ignore 'vendor/**,**/*_gen.go'`.
+func parseTrackArgs(args []string) (paths []string, options goexec.TrackOptions, err error) {
+	for ii := 0; ii < len(args); ii++ {
+		arg := args[ii]
+		var patterns string
+		switch {
+		case arg == "--force":
+			options.Force = true
+			continue
+		case arg == "--ignore":
+			if ii+1 == len(args) {
+				err = errors.New("%track --ignore expects a comma-separated list of patterns")
+				return
+			}
+			ii++
+			patterns = args[ii]
+		case strings.HasPrefix(arg, "--ignore="):
+			patterns = strings.TrimPrefix(arg, "--ignore=")
+		default:
+			paths = append(paths, arg)
+			continue
+		}
+		for _, pattern := range strings.Split(strings.Trim(patterns, "'"), ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				options.Ignore = append(options.Ignore, pattern)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		err = errors.New("%track expects the files or directories to track")
+	}
+	return
 }
 
 // execUntrack executes the "%track" special command. The parameter `args` excludes
@@ -0,0 +1,58 @@
+package specialcmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%uses`: the listing of where a memorized declaration is used.
+
+// execUses implements `%uses <name>`.
+func execUses(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) != 1 {
+		return errors.New("%uses expects the name of a memorized declaration, e.g. `%uses Point` or `%uses Point.X`")
+	}
+	result, err := goExec.Uses(args[0])
+	if err != nil {
+		return errors.WithMessagef(err, "%%uses %s", args[0])
+	}
+	return kernel.PublishMarkdown(msg, usesMarkdown(result))
+}
+
+// usesMarkdown renders the result of `%uses`.
+func usesMarkdown(result *goexec.UsesResult) string {
+	var sb strings.Builder
+	if len(result.Usages) == 0 && len(result.FileUsages) == 0 {
+		_, _ = fmt.Fprintf(&sb, "`%s` is not used by the memorized declarations: it can be safely removed with `%%rm`.\n",
+			result.Name)
+	} else {
+		numUses := len(result.Usages) + len(result.FileUsages)
+		places := "places"
+		if numUses == 1 {
+			places = "place"
+		}
+		_, _ = fmt.Fprintf(&sb, "`%s` is used in %d %s:\n", result.Name, numUses, places)
+	}
+	if len(result.Usages) > 0 {
+		sb.WriteString("\n| Cell | Line | Declaration | Code |\n|---|---|---|---|\n")
+		for _, usage := range result.Usages {
+			_, _ = fmt.Fprintf(&sb, "| [%d] | %d | `%s` | `%s` |\n", usage.CellId, usage.Line+1,
+				escapeMarkdownTableCell(usage.Declaration), escapeMarkdownTableCell(usage.Content))
+		}
+	}
+	if len(result.FileUsages) > 0 {
+		sb.WriteString("\nUses in other files (e.g. tracked packages):\n\n")
+		for _, usage := range result.FileUsages {
+			_, _ = fmt.Fprintf(&sb, "- `%s:%d`\n", usage.Path, usage.Line+1)
+		}
+	}
+	if result.Approximate {
+		sb.WriteString("\n*`gopls` is not available: uses were matched by name, and may include unrelated " +
+			"identifiers with the same name.*\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,66 @@
+package specialcmd
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+)
+
+// This file implements `%vulncheck`: the vulnerability scanning of the module of the kernel with `govulncheck`.
+
+// execVulnCheck implements `%vulncheck` and `%vulncheck auto on|off`.
+func execVulnCheck(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) > 0 {
+		if len(args) != 2 || args[0] != "auto" || (args[1] != "on" && args[1] != "off") {
+			return errors.Errorf("invalid %%vulncheck arguments %q: use `%%vulncheck` or `%%vulncheck auto on|off`", args)
+		}
+		goExec.VulnCheckAfterGet = args[1] == "on"
+		return nil
+	}
+	vulns, err := goExec.VulnCheck(true)
+	if err != nil {
+		return errors.WithMessage(err, "%vulncheck")
+	}
+	return kernel.PublishHtml(msg, vulnerabilitiesHtml(vulns))
+}
+
+// vulnerabilitiesHtml renders the vulnerabilities found by `govulncheck` as an HTML table.
+func vulnerabilitiesHtml(vulns []goexec.Vulnerability) string {
+	if len(vulns) == 0 {
+		return "<p>✅ <b>No known vulnerabilities found.</b></p>"
+	}
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "<p>⚠️ <b>%d known vulnerabilities found</b> by <code>govulncheck</code>:</p>\n", len(vulns))
+	sb.WriteString("<table><tr><th>Vulnerability</th><th>Module</th><th>Fixed in</th><th>Impact</th><th>Summary</th></tr>\n")
+	for _, v := range vulns {
+		id := fmt.Sprintf(`<a href="%s" target="_blank">%s</a>`, html.EscapeString(v.URL()), html.EscapeString(v.ID))
+		if len(v.Aliases) > 0 {
+			id += "<br><small>" + html.EscapeString(strings.Join(v.Aliases, ", ")) + "</small>"
+		}
+		fixed := "<i>not fixed</i>"
+		if v.FixedVersion != "" {
+			fixed = "<code>" + html.EscapeString(v.FixedVersion) + "</code>"
+		}
+		var impact string
+		switch {
+		case len(v.Symbols) > 0:
+			symbols := make([]string, 0, len(v.Symbols))
+			for _, symbol := range v.Symbols {
+				symbols = append(symbols, "<code>"+html.EscapeString(symbol)+"</code>")
+			}
+			impact = "<b>Called</b>: " + strings.Join(symbols, ", ")
+		case len(v.Packages) > 0:
+			impact = "Imported: <code>" + html.EscapeString(strings.Join(v.Packages, ", ")) + "</code>"
+		default:
+			impact = "Required module only"
+		}
+		_, _ = fmt.Fprintf(&sb, "<tr><td>%s</td><td><code>%s@%s</code></td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			id, html.EscapeString(v.Module), html.EscapeString(v.Version), fixed, impact, html.EscapeString(v.Summary))
+	}
+	sb.WriteString("</table>\n")
+	return sb.String()
+}
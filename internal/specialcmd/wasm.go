@@ -0,0 +1,52 @@
+package specialcmd
+
+import (
+	"strings"
+
+	. "github.com/janpfeifer/gonb/common"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// parseWasmFlags parses the flags of `%wasm [--dir=<dir>] [--url=<url>]`, that override where the WASM
+// files are stored and the URL from where they are served. See goexec.State.SetWasmLocation.
+//
+// Environment variables (e.g.: `${JUPYTERHUB_USER}`) in the values are expanded, and `~` in the directory
+// is replaced by the home directory.
+func parseWasmFlags(goExec *goexec.State, args []string) error {
+	var dir, url string
+	var hasDir, hasUrl bool
+	for len(args) > 0 {
+		flagName, value, hasValue := strings.Cut(args[0], "=")
+		args = args[1:]
+		if !hasValue {
+			if len(args) == 0 {
+				return errors.Errorf("%%wasm flag %q requires a value", flagName)
+			}
+			value = args[0]
+			args = args[1:]
+		}
+		switch strings.TrimLeft(flagName, "-") {
+		case "dir":
+			dir, hasDir = ReplaceEnvVars(ReplaceTildeInDir(value)), true
+		case "url":
+			url, hasUrl = ReplaceEnvVars(value), true
+		default:
+			return errors.Errorf("%%wasm: unknown flag %q, only `--dir=<dir>` and `--url=<url>` are accepted", flagName)
+		}
+	}
+	if !hasDir {
+		// Keep the current directory, only change the URL.
+		dir = goExec.WasmBaseDir
+		if dir == "" {
+			return errors.New("%wasm: `--url` requires `--dir` to be set, with the directory served by the URL")
+		}
+	}
+	if !hasUrl && dir == goExec.WasmBaseDir {
+		url = goExec.WasmBaseUrl
+	}
+	klog.V(1).Infof("%%wasm: files in %q, served from %q", dir, url)
+	goExec.SetWasmLocation(dir, url)
+	return nil
+}
@@ -0,0 +1,47 @@
+package specialcmd
+
+import (
+	"fmt"
+	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/kernel"
+	"github.com/pkg/errors"
+	"html"
+	"strings"
+)
+
+// execWorkspace implements `%workspace [list|create <name>|switch <name>]`. The parameter `args` excludes "%workspace".
+func execWorkspace(msg kernel.Message, goExec *goexec.State, args []string) error {
+	if len(args) == 0 || (args[0] == "list" && len(args) == 1) {
+		return listWorkspaces(msg, goExec)
+	}
+	if len(args) != 2 {
+		return errors.Errorf("%%workspace expects `list`, `create <name>` or `switch <name>`, got %q", args)
+	}
+	switch args[0] {
+	case "create":
+		return goExec.CreateWorkspace(args[1])
+	case "switch":
+		if err := goExec.SwitchWorkspace(args[1]); err != nil {
+			return err
+		}
+		return kernel.PublishWriteStream(msg, kernel.StreamStdout,
+			fmt.Sprintf("Switched to workspace %q\n", goExec.WorkspaceName()))
+	default:
+		return errors.Errorf("%%workspace %s not supported, use one of list, create or switch", args[0])
+	}
+}
+
+// listWorkspaces displays the workspaces, marking the current one.
+func listWorkspaces(msg kernel.Message, goExec *goexec.State) error {
+	current := goExec.WorkspaceName()
+	parts := []string{"<b>Workspaces:</b>", "<ul>"}
+	for _, name := range goExec.ListWorkspaces() {
+		if name == current {
+			parts = append(parts, fmt.Sprintf("<li><b>%s</b> (current)</li>", html.EscapeString(name)))
+		} else {
+			parts = append(parts, fmt.Sprintf("<li>%s</li>", html.EscapeString(name)))
+		}
+	}
+	parts = append(parts, "</ul>")
+	return kernel.PublishHtml(msg, strings.Join(parts, "\n")+"\n")
+}
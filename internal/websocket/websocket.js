@@ -57,9 +57,26 @@
 
         // Synced Variables:
         _address_to_synced_var: {},  // map address -> variable.
+
+        // Reliability: values sent by GoNB are numbered ("seq"), acknowledged, and replayed by GoNB when
+        // reconnecting. The last one received is kept in the sessionStorage, so it survives page reloads.
+        _last_seq_key: "gonb_comm_last_seq/{{.KernelId}}",
+        _last_seq: 0,
+        _send_seq: 0,
+        _ack_timeout_id: null,
+
+        // Console bridge: if enabled by GoNB (`%widgets_console`), errors are forwarded to GoNB's log.
+        _console_bridge: false,
+        _console_forwarding: false,  // Set while forwarding, to prevent loops.
     };
+    try {
+        gonb_comm._last_seq = parseInt(globalThis.sessionStorage?.getItem(gonb_comm._last_seq_key) ?? "0") || 0;
+    } catch (err) {
+        debug_log(`gonb_comm: sessionStorage not available: ${err.message}`);
+    }
     globalThis.gonb_comm = gonb_comm; // Make it globally available.
     gonb_comm._websocket = new WebSocket(gonb_comm._ws_url);
+    gonb_comm._websocket.binaryType = "arraybuffer";  // Messages with binary buffers.
 
     /**
      * Handles opening: mark as ready for business.
@@ -113,7 +130,8 @@
             gonb_comm.close(1000, "gonb_comm from previous kernel still hanging, closing it");
         }
 
-        const msg = JSON.parse(event.data);
+        const msg = (typeof event.data === "string") ?
+            JSON.parse(event.data) : gonb_comm._deserialize_binary_message(event.data);
         // debug_log(`gonb_comm: websocket received "${msg.msg_type}"`);
         if (msg.msg_type === "comm_msg") {
             gonb_comm._on_comm_msg(msg);
@@ -124,24 +142,34 @@
 
     /** send a value to the given address.
      *
-     * Message with value is immediately enqueued. There is no acknowledgement of delivery --
-     * in case of issues, it won't report back to the caller -- but errors are logged in the console.
+     * Message with value is immediately enqueued, and numbered in order ("seq"), so GoNB can drop duplicates.
+     * There is no acknowledgement of delivery -- in case of issues, it won't report back to the caller -- but
+     * errors are logged in the console.
      *
      * @param address A string, by convention organized hierarchically, separated by "/". E.g.: "/hyperparameters/learning_rate".
      * @param value Any pod (plain-old-data) value, or an object. It will be JASON.stringified.
+     *        If it is an ArrayBuffer (or a view of one, like a Uint8Array), it is sent as a binary buffer,
+     *        and received in Go as a `[]byte`.
      */
     gonb_comm.send = function(address, value) {
         debug_log(`gonb_comm.send(${address}, ${value})`);
         this._is_connected.
             then(() => {
                 let msg = this._build_raw_message("comm_msg");
+                this._send_seq++;
                 msg.content = {
                     comm_id: this._comm_id,
                     data: {
                         address: address,
                         value: value,
+                        seq: this._send_seq,
                     },
                 }
+                if (value instanceof ArrayBuffer || ArrayBuffer.isView(value)) {
+                    delete msg.content.data.value;
+                    msg.content.data.binary = true;
+                    msg.buffers = [value];
+                }
                 debug_log(`async gonb_comm.send(${address}, ${value})`);
                 let err = this._send(msg);
                 if (err) {
@@ -228,6 +256,10 @@
 
         if (address === "#comm_open_ack") {
             debug_log(`gonb_comm: received comm_msg addressed to #comm_open_ack.`);
+            if (typeof data?.value === "number") {
+                // Sequence number base: values up to it were received (or the kernel was restarted).
+                this._last_seq = data.value;
+            }
             if (this._onopen_ack) {
                 this._onopen_ack();
             }
@@ -237,6 +269,30 @@
             this.send("#heartbeat/pong", true);
             debug_log(`gonb_comm: replied #heartbeat/ping with /pong`);
             return;
+        } else if (address === "#comms/console") {
+            this._set_console_bridge(!!data?.value);
+            return;
+        } else if (address === "#comms/cleanup") {
+            this._cleanup_scope(data?.value);
+            return;
+        }
+
+        let seq = data?.seq;
+        if (seq) {
+            if (seq <= this._last_seq) {
+                debug_log(`gonb_comm: discarding duplicate comm_msg to address \"${address}\" (seq=${seq}).`);
+                return;
+            }
+            if (seq > this._last_seq + 1) {
+                console.warn(`gonb_comm: ${seq - this._last_seq - 1} message(s) from GoNB lost before seq=${seq}.`);
+            }
+            this._last_seq = seq;
+            try {
+                globalThis.sessionStorage?.setItem(this._last_seq_key, String(seq));
+            } catch (err) {
+                // Ignore: it only matters when reloading the page.
+            }
+            this._schedule_ack();
         }
 
         let subscribers = this._address_subscriptions[address];
@@ -245,7 +301,7 @@
             return;
         }
 
-        let value = data?.value;
+        let value = data?.binary ? msg?.buffers?.[0] : data?.value;
         if (!value) {
             console.error(`gonb_comm: comm_msg to address \"${address}\" but with no value!?.`);
             return;
@@ -258,6 +314,97 @@
         }
     }
 
+    /**
+     * _cleanup_scope removes the subscriptions (and synced variables) to the addresses with the given prefix:
+     * GoNB sends it when a cell program finishes, for the addresses scoped to its execution.
+     */
+    gonb_comm._cleanup_scope = function(prefix) {
+        if (!prefix) {
+            return;
+        }
+        for (const address of Object.keys(this._address_subscriptions)) {
+            if (!address.startsWith(prefix)) {
+                continue;
+            }
+            for (const id of Reflect.ownKeys(this._address_subscriptions[address])) {
+                delete this._address_subscriptions_id_to_address[id];
+            }
+            delete this._address_subscriptions[address];
+        }
+        for (const address of Object.keys(this._address_to_synced_var)) {
+            if (address.startsWith(prefix)) {
+                delete this._address_to_synced_var[address];
+            }
+        }
+        debug_log(`gonb_comm: cleaned up addresses under "${prefix}".`);
+
+        // Let the front-end code left by the program (e.g. animation loops) know it finished.
+        let subscribers = this._address_subscriptions["#comms/cleanup"];
+        if (subscribers) {
+            for (const key of Reflect.ownKeys(subscribers)) {
+                subscribers[key]("#comms/cleanup", prefix);
+            }
+        }
+    }
+
+    /**
+     * _schedule_ack schedules the acknowledgement of the values received from GoNB (up to `_last_seq`),
+     * so GoNB can drop them from its replay buffer. Acknowledgements are batched.
+     */
+    gonb_comm._schedule_ack = function() {
+        if (this._ack_timeout_id !== null) {
+            return;
+        }
+        this._ack_timeout_id = setTimeout(() => {
+            this._ack_timeout_id = null;
+            this.send("#comms/ack", this._last_seq);
+        }, 100);
+    }
+
+    /**
+     * _set_console_bridge enables or disables forwarding `console.error` calls and uncaught exceptions
+     * (and unhandled promise rejections) to GoNB, where they are logged.
+     *
+     * The hooks are installed only once per page, and they forward to the current `globalThis.gonb_comm`,
+     * so they survive reconnections and kernel restarts.
+     */
+    gonb_comm._set_console_bridge = function(enabled) {
+        debug_log(`gonb_comm: console bridge ${enabled ? "enabled" : "disabled"}.`);
+        this._console_bridge = enabled;
+        if (!enabled || globalThis.gonb_console_bridge_installed) {
+            return;
+        }
+        globalThis.gonb_console_bridge_installed = true;
+        const forward = (level, message, stack) => globalThis.gonb_comm?._forward_console(level, message, stack);
+        const originalError = console.error;
+        console.error = function(...args) {
+            originalError.apply(console, args);
+            forward("error", args.map((arg) => (arg instanceof Error) ? arg.message : String(arg)).join(" "),
+                args.find((arg) => arg instanceof Error)?.stack);
+        };
+        globalThis.addEventListener("error", (event) => {
+            forward("exception", `${event.message} (${event.filename}:${event.lineno}:${event.colno})`, event.error?.stack);
+        });
+        globalThis.addEventListener("unhandledrejection", (event) => {
+            forward("rejection", String(event.reason?.message ?? event.reason), event.reason?.stack);
+        });
+    }
+
+    /**
+     * _forward_console sends a console message to GoNB, if the console bridge is enabled.
+     */
+    gonb_comm._forward_console = function(level, message, stack) {
+        if (!this._console_bridge || this._console_forwarding || !this.websocket_is_opened) {
+            return;
+        }
+        this._console_forwarding = true;
+        try {
+            this.send("#comms/console/log", {level: level, message: message, stack: stack ?? ""});
+        } finally {
+            this._console_forwarding = false;
+        }
+    }
+
     /**
      * send is JSON.stringify the message and sends it to the websocket.
      *
@@ -270,7 +417,11 @@
         debug_log(`gonb_comm._send(${this._kernel_id})`);
         let msg_str = JSON.stringify(msg);
         try {
-            this._websocket.send(msg_str);
+            if (msg.buffers?.length) {
+                this._websocket.send(this._serialize_binary_message(msg));
+            } else {
+                this._websocket.send(msg_str);
+            }
             return null;
         } catch (err) {
             debug_log(`gonb_comm._send(${msg_str}) failed: ${err.message}`);
@@ -278,6 +429,60 @@
         }
     }
 
+    /**
+     * _serialize_binary_message in the format used by JupyterServer for messages with binary buffers:
+     * the number of parts and their offsets (big-endian uint32), followed by the message in JSON
+     * (without the buffers) and by the buffers.
+     *
+     * @param msg message with a `buffers` field, an array of ArrayBuffer or views of ArrayBuffer.
+     * @returns ArrayBuffer
+     */
+    gonb_comm._serialize_binary_message = function(msg) {
+        let {buffers, ...rest} = msg;
+        let parts = [new TextEncoder().encode(JSON.stringify(rest))];
+        for (const buffer of buffers) {
+            parts.push(ArrayBuffer.isView(buffer) ?
+                new Uint8Array(buffer.buffer, buffer.byteOffset, buffer.byteLength) : new Uint8Array(buffer));
+        }
+        const headerSize = 4 * (parts.length + 1);
+        let total = headerSize;
+        for (const part of parts) {
+            total += part.byteLength;
+        }
+        let result = new Uint8Array(total);
+        let view = new DataView(result.buffer);
+        view.setUint32(0, parts.length);
+        let offset = headerSize;
+        parts.forEach((part, ii) => {
+            view.setUint32(4 * (ii + 1), offset);
+            result.set(part, offset);
+            offset += part.byteLength;
+        });
+        return result.buffer;
+    }
+
+    /**
+     * _deserialize_binary_message parses a message with binary buffers, the reverse of _serialize_binary_message.
+     *
+     * @param data ArrayBuffer received from the WebSocket.
+     * @returns message with the `buffers` field set to an array of DataView.
+     */
+    gonb_comm._deserialize_binary_message = function(data) {
+        let view = new DataView(data);
+        const numParts = view.getUint32(0);
+        let offsets = [];
+        for (let ii = 0; ii < numParts; ii++) {
+            offsets.push(view.getUint32(4 * (ii + 1)));
+        }
+        offsets.push(data.byteLength);
+        const msg = JSON.parse(new TextDecoder().decode(new Uint8Array(data, offsets[0], offsets[1] - offsets[0])));
+        msg.buffers = [];
+        for (let ii = 1; ii < numParts; ii++) {
+            msg.buffers.push(new DataView(data, offsets[ii], offsets[ii + 1] - offsets[ii]));
+        }
+        return msg;
+    }
+
     /**
      * _build_raw_message of the given type, with a newly created msg_id.
      * The message has channel set to "shell" -- usual for communicating, and the content is empty.
@@ -313,7 +518,7 @@
                 comm_id: this._comm_id,
                 target_name: "gonb_comm",
                 kernel_id: this._kernel_id,
-                data: {},
+                data: {last_seq: this._last_seq},
             }
             let err = this._send(msg);
             await this._wait_open_ack();
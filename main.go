@@ -7,11 +7,18 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/janpfeifer/gonb/common"
 	"github.com/janpfeifer/gonb/internal/dispatcher"
 	"github.com/janpfeifer/gonb/internal/goexec"
+	"github.com/janpfeifer/gonb/internal/goexec/goplsclient"
+	"github.com/janpfeifer/gonb/internal/i18n"
+	"github.com/janpfeifer/gonb/internal/jpyexec"
 	"github.com/janpfeifer/gonb/internal/kernel"
 	"github.com/janpfeifer/gonb/version"
 	klog "k8s.io/klog/v2"
@@ -26,10 +33,30 @@ var (
 	flagRawError     = flag.Bool("raw_error", false, "When GoNB executes cells, force raw text errors instead of HTML errors, which facilitates command line testing of notebooks.")
 	flagWork         = flag.Bool("work", false, "Print name of temporary work directory and preserve it at exit. ")
 	flagCommsLog     = flag.Bool("comms_log", false, "Enable verbose logging from communication library in Javascript console.")
+	flagCompletion   = flag.String("completion_provider", "", "Optional external auto-complete provider: an http(s) URL or a command line, that receives the cell and cursor as JSON and returns suggestions merged with those of gopls. If empty, the environment variable "+goexec.CompletionProviderEnv+" is used. Disabled by default.")
+	flagShared       = flag.String("shared_session", "", "Opt-in: name of a shared session. The first kernel started with a given name owns the session, and kernels started later with the same name attach to it, sharing the same memorized definitions. If empty, the environment variable "+dispatcher.SharedSessionEnv+" is used.")
+	flagLang         = flag.String("lang", "", "Language of the kernel messages and of %help, one of \"en\", \"pt\", \"es\", \"zh\" or \"ja\". If empty, it is taken from the environment variables LC_ALL, LC_MESSAGES or LANG.")
+	flagSanitizeHTML = flag.Bool("sanitize_html", false, "Sanitize the HTML output by cells, removing scripts, iframes, event handlers, etc. It can be changed with %sanitize_html. Notice widgets don't work with sanitized HTML.")
+	flagCSPNonce     = flag.String("csp_nonce", "", "Nonce added to the scripts (and styles) injected in the front-end, for deployments whose Content-Security-Policy requires it.")
+	flagCSPNoInline  = flag.Bool("csp_no_inline", false, "Load the Javascript GoNB uses to communicate with the front-end from a file served by Jupyter, instead of inlining it, for deployments whose Content-Security-Policy disallows inline scripts.")
+	flagWasmDir      = flag.String("wasm_dir", "", "Directory where the %wasm files are stored, instead of `jupyter_files` under the Jupyter root directory. If not under the Jupyter root directory, --wasm_url must also be given.")
+	flagWasmUrl      = flag.String("wasm_url", "", "URL from where the --wasm_dir directory is served, e.g. for JupyterHub setups where the files URL is prefixed per-user.")
+	flagHealthCheck  = flag.String("healthcheck", "", "Check the health of a running kernel, given its connection file (its heartbeat must reply) or its PID file (see --pid_file), and exit with 0 if healthy, 1 otherwise. To be used as a Docker/Kubernetes health probe.")
+	flagHealthTime   = flag.Duration("healthcheck_timeout", kernel.DefaultHealthCheckTimeout, "Time to wait for the heartbeat reply with --healthcheck.")
+	flagIdleTimeout  = flag.Duration("idle_timeout", 0, "If set, the kernel shuts itself down when no cell is executed for the given time (e.g. \"2h\"), to release resources of idle kernels. Disabled by default.")
+	flagLowMemory    = flag.Bool("low-memory", false, "Reduced memory mode, for Raspberry Pi-class machines: gopls is only started when first needed (auto-complete or contextual help), and internal queues and buffers are smaller.")
+	flagRestart      = flag.String("restart", dispatcher.RestartProcess, "How restarts requested by Jupyter are handled: \"process\" exits the process (Jupyter starts a new one); \"soft\" re-initializes the kernel in-process, keeping gopls and the build cache warm; \"soft_keep_mod\" also preserves go.mod. The soft modes require a kernel manager that doesn't wait for the process to exit on restarts.")
+	flagPidFile      = flag.String("pid_file", "", "File where the kernel writes its PID, removed when it exits. It can be used with --healthcheck.")
 	flagShortVersion = flag.Bool("V", false, "Print version information")
 	flagLongVersion  = flag.Bool("version", false, "Print detailed version information")
 )
 
+var (
+	flagKernelEnv    common.ArrayFlag
+	flagKernelArg    common.ArrayFlag
+	flagGoplsSetting common.ArrayFlag
+)
+
 var (
 	// UniqueID uniquely identifies a kernel execution. Used to create the temporary
 	// directory holding the kernel code, and for logging.
@@ -53,6 +80,12 @@ func main() {
 	klog.InitFlags(nil)
 	defer klog.Flush()
 
+	flag.Var(&flagKernelEnv, "kernel-env", "With --install, environment variable to set for the kernel in `kernel.json`, "+
+		"in the format KEY=VALUE (e.g. GOPROXY, GOFLAGS, GOPATH). It can be set multiple times.")
+	flag.Var(&flagKernelArg, "kernel-arg", "With --install, extra argument added to the kernel command line in `kernel.json`. "+
+		"It can be set multiple times.")
+	flag.Var(&flagGoplsSetting, "gopls-setting", "Setting of gopls in the format key=value (e.g. staticcheck=true), "+
+		"see https://go.dev/gopls/settings. It can be set multiple times, and changed with %gopls.")
 	flag.Parse()
 
 	if printVersion() {
@@ -80,6 +113,12 @@ func main() {
 	SetUpLogging() // "log" package.
 	SetUpKlog()    // "github.com/golang/klog" package
 
+	if *flagLang != "" {
+		if err := i18n.SetLanguage(*flagLang); err != nil {
+			klog.Fatalf("Invalid --lang: %v", err)
+		}
+	}
+
 	if *flagInstall {
 		// Install kernel in Jupyter configuration.
 		var extraArgs []string
@@ -104,15 +143,82 @@ func main() {
 		if glogFlag := flag.Lookup("comms_log"); glogFlag != nil && glogFlag.Value.String() != "false" {
 			extraArgs = append(extraArgs, "--comms_log")
 		}
-		err := kernel.Install(extraArgs, *flagForceDeps, *flagForceCopy)
+		if *flagCompletion != "" {
+			extraArgs = append(extraArgs, "--completion_provider", *flagCompletion)
+		}
+		if *flagShared != "" {
+			extraArgs = append(extraArgs, "--shared_session", *flagShared)
+		}
+		if *flagLang != "" {
+			extraArgs = append(extraArgs, "--lang", *flagLang)
+		}
+		if *flagSanitizeHTML {
+			extraArgs = append(extraArgs, "--sanitize_html")
+		}
+		if *flagCSPNonce != "" {
+			extraArgs = append(extraArgs, "--csp_nonce", *flagCSPNonce)
+		}
+		if *flagCSPNoInline {
+			extraArgs = append(extraArgs, "--csp_no_inline")
+		}
+		if *flagWasmDir != "" {
+			extraArgs = append(extraArgs, "--wasm_dir", *flagWasmDir)
+		}
+		if *flagWasmUrl != "" {
+			extraArgs = append(extraArgs, "--wasm_url", *flagWasmUrl)
+		}
+		if *flagRestart != dispatcher.RestartProcess {
+			extraArgs = append(extraArgs, "--restart", *flagRestart)
+		}
+		if *flagLowMemory {
+			extraArgs = append(extraArgs, "--low-memory")
+		}
+		for _, setting := range flagGoplsSetting {
+			extraArgs = append(extraArgs, "--gopls-setting", setting)
+		}
+		if *flagIdleTimeout > 0 {
+			extraArgs = append(extraArgs, "--idle_timeout", flagIdleTimeout.String())
+		}
+		extraArgs = append(extraArgs, flagKernelArg...)
+		env, err := kernel.ParseKernelEnv(flagKernelEnv)
+		if err != nil {
+			log.Fatalf("Installation failed: %+v\n", err)
+		}
+		err = kernel.Install(extraArgs, env, *flagForceDeps, *flagForceCopy)
 		if err != nil {
 			log.Fatalf("Installation failed: %+v\n", err)
 		}
 		return
 	}
 
+	if !slices.Contains(dispatcher.RestartModes, *flagRestart) {
+		klog.Exitf("Invalid --restart=%q, valid values are %q", *flagRestart, dispatcher.RestartModes)
+	}
+	dispatcher.RestartMode = *flagRestart
+	if *flagLowMemory {
+		setLowMemory()
+	}
+
+	if *flagHealthCheck != "" {
+		if err := kernel.HealthCheck(*flagHealthCheck, *flagHealthTime); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "unhealthy: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("healthy")
+		return
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "run" {
+		// Execute Go files with cell markers from the command line.
+		os.Exit(runFiles(flag.Args()[1:]))
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "replay" {
+		// Replay a session recorded with %record.
+		os.Exit(replayRecording(flag.Args()[1:]))
+	}
+
 	if *flagKernel == "" {
-		_, _ = fmt.Fprintf(os.Stderr, "Use either --install to install the kernel, or if started by Jupyter the flag --kernel must be provided.\n")
+		_, _ = fmt.Fprint(os.Stderr, i18n.T(i18n.MsgKernelFlagMissing))
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
@@ -122,11 +228,30 @@ func main() {
 		klog.Infof("GOCOVERDIR=%s", gocoverdir)
 	}
 
+	if _, err := goexec.SetupToolchain(); err != nil {
+		klog.Exitf("Failed to set up the Go toolchain: %+v", err)
+	}
 	_, err := exec.LookPath("go")
 	if err != nil {
 		klog.Exitf("Failed to find path for the `go` program: %+v\n\nCurrent PATH=%q", err, os.Getenv("PATH"))
 	}
 
+	// Attach to a shared session, if one is already running.
+	sharedSession := *flagShared
+	if sharedSession == "" {
+		sharedSession = os.Getenv(dispatcher.SharedSessionEnv)
+	}
+	if sharedSession != "" {
+		attached, err := dispatcher.AttachToSharedSession(sharedSession, *flagKernel)
+		if err != nil {
+			klog.Exitf("Failed to attach to shared session %q: %+v", sharedSession, err)
+		}
+		if attached {
+			klog.Infof("Exiting...")
+			return
+		}
+	}
+
 	// Create a kernel.
 	k, err := kernel.New(*flagKernel)
 	klog.Infof("kernel created\n")
@@ -134,6 +259,14 @@ func main() {
 		log.Fatalf("Failed to start kernel: %+v", err)
 	}
 	k.HandleInterrupt() // Handle Jupyter interruptions and Control+C.
+	if *flagPidFile != "" {
+		removePidFile, err := kernel.WritePidFile(*flagPidFile)
+		if err != nil {
+			klog.Errorf("--pid_file: %+v", err)
+		} else {
+			defer removePidFile()
+		}
+	}
 
 	// Create a Go executor.
 	goExec, err := goexec.New(k, UniqueID, *flagWork, *flagRawError)
@@ -141,8 +274,45 @@ func main() {
 		log.Fatalf("Failed to create go executor: %+v", err)
 	}
 	goExec.Comms.LogWebSocket = *flagCommsLog
+	goExec.SanitizeHTML = *flagSanitizeHTML
+	goExec.Comms.ScriptNonce = *flagCSPNonce
+	goExec.SetWasmLocation(*flagWasmDir, *flagWasmUrl)
+	goExec.SaveStartupSettings()
+	for _, setting := range flagGoplsSetting {
+		key, value, err := goplsclient.ParseSetting(setting)
+		if err == nil {
+			err = goExec.SetGoplsSetting(key, value)
+		}
+		if err != nil {
+			klog.Errorf("--gopls-setting=%q ignored: %+v", setting, err)
+		}
+	}
+	if *flagCSPNoInline {
+		if err := goExec.MakeScriptsSubdir(); err != nil {
+			klog.Errorf("--csp_no_inline: failed to create directory for Javascript files, scripts will be inlined: %+v", err)
+		}
+	}
+	completionSpec := *flagCompletion
+	if completionSpec == "" {
+		completionSpec = os.Getenv(goexec.CompletionProviderEnv)
+	}
+	goExec.CompletionProvider, err = goexec.NewCompletionProvider(completionSpec)
+	if err != nil {
+		klog.Errorf("External completion provider disabled: %+v", err)
+	}
+
+	// Serve other kernels attaching to the shared session.
+	if sharedSession != "" {
+		stopSharing, err := dispatcher.ServeSharedSession(sharedSession, goExec)
+		if err != nil {
+			klog.Errorf("Shared session %q disabled: %+v", sharedSession, err)
+		} else {
+			defer stopSharing()
+		}
+	}
 
 	// Orchestrate dispatching of messages.
+	dispatcher.StartIdleShutdown(k, *flagIdleTimeout)
 	dispatcher.RunKernel(k, goExec)
 	klog.V(1).Infof("Dispatcher exited.")
 
@@ -158,6 +328,106 @@ func main() {
 	klog.Infof("Exiting...")
 }
 
+// setLowMemory configures GoNB to use less memory, see --low-memory.
+func setLowMemory() {
+	goexec.GoplsOnDemand = true
+	dispatcher.MaxExecuteRequestQueue = 100
+	jpyexec.PipeWriterFifoBufferSize = 16
+	// Log to files only once (not also in the files of lower severities), with less buffering.
+	if err := flag.Set("one_output", "true"); err != nil {
+		klog.Warningf("--low-memory: failed to set klog's --one_output: %+v", err)
+	}
+	klog.Infof("Low memory mode: gopls is started on demand.")
+}
+
+// runFiles implements `gonb run <file.go> ...`: it executes each file as a sequence of cells (see
+// dispatcher.SplitCells), printing the outputs to the terminal. It returns the exit code.
+func runFiles(files []string) int {
+	if len(files) == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "Usage: gonb [flags] run <file.go> [<file.go> ...]")
+		return 1
+	}
+	if _, err := goexec.SetupToolchain(); err != nil {
+		klog.Exitf("Failed to set up the Go toolchain: %+v", err)
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		klog.Exitf("Failed to find path for the `go` program: %+v\n\nCurrent PATH=%q", err, os.Getenv("PATH"))
+	}
+	k := kernel.NewOffline()
+	k.HandleInterrupt() // Handle Control+C.
+	goExec, err := goexec.New(k, UniqueID, *flagWork, true)
+	if err != nil {
+		log.Fatalf("Failed to create go executor: %+v", err)
+	}
+	goExec.SetWasmLocation(*flagWasmDir, *flagWasmUrl)
+	exitCode := 0
+	for _, filePath := range files {
+		if err := dispatcher.RunFile(k, goExec, filePath); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "gonb run: %v\n", err)
+			exitCode = 1
+			break
+		}
+	}
+	if err := goExec.Stop(); err != nil {
+		klog.Warningf("Error during shutdown: %+v", err)
+	}
+	k.Stop()
+	return exitCode
+}
+
+// replayRecording implements `gonb replay [--realtime] [--output <file>] <file.gonbrec>`: it replays a session
+// recorded with `%record` into a notebook or an HTML page (selected by the extension of the output file).
+// It returns the exit code.
+func replayRecording(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	output := flags.String("output", "", "Output file: a notebook (.ipynb) or an HTML page (.html). "+
+		"Defaults to the recording file with the .ipynb extension.")
+	realtime := flags.Bool("realtime", false, "Replay in real time: the output file is updated at each event "+
+		"recorded, respecting the times between them.")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: gonb [flags] replay [--realtime] [--output <file>] <file.gonbrec>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		if err == nil {
+			flags.Usage()
+		}
+		return 1
+	}
+	recordingPath := flags.Arg(0)
+	if *output == "" {
+		*output = strings.TrimSuffix(recordingPath, filepath.Ext(recordingPath)) + ".ipynb"
+	}
+	events, err := kernel.ReadSessionRecording(recordingPath)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "gonb replay: %v\n", err)
+		return 1
+	}
+	numSteps := 1
+	if *realtime {
+		numSteps = len(events)
+	}
+	for step := 1; step <= numSteps; step++ {
+		replayed := events
+		if *realtime {
+			replayed = events[:step]
+			if step > 1 {
+				time.Sleep(events[step-1].Time.Sub(events[step-2].Time))
+			}
+		}
+		nb, err := kernel.ReplaySession(replayed)
+		if err == nil {
+			err = nb.WriteReplay(*output)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "gonb replay: %v\n", err)
+			return 1
+		}
+	}
+	fmt.Printf("Replayed %d events to %q\n", len(events), *output)
+	return 0
+}
+
 func printVersion() bool {
 	if *flagShortVersion {
 		fmt.Println(version.AppVersion.String())